@@ -0,0 +1,184 @@
+// Command tavily-load runs the Tavily load balancer. Without arguments it serves
+// the proxy; the check and migrate subcommands inspect the deployment and manage
+// the database schema.
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/dbccccccc/tavily-load/internal/cache"
+	"github.com/dbccccccc/tavily-load/internal/cli"
+	"github.com/dbccccccc/tavily-load/internal/config"
+	"github.com/dbccccccc/tavily-load/internal/database"
+	"github.com/dbccccccc/tavily-load/internal/errreport"
+	"github.com/dbccccccc/tavily-load/internal/proxy"
+	"github.com/dbccccccc/tavily-load/internal/repository"
+	"github.com/sirupsen/logrus"
+)
+
+// AppVersion is set at build time with -ldflags "-X main.AppVersion=..."
+var AppVersion = "dev"
+
+const usage = `usage: tavily-load [command]
+
+commands:
+  serve     run the proxy (the default)
+  check     validate the configuration and test the connections
+  migrate   manage the database schema, see tavily-load migrate help
+  version   print the version`
+
+func main() {
+	logger := logrus.New()
+
+	if err := run(logger, os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "tavily-load:", err)
+		os.Exit(1)
+	}
+}
+
+// run dispatches to the subcommand named by args[0]
+func run(logger *logrus.Logger, args []string) error {
+	command := "serve"
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch command {
+	case "serve":
+		if len(args) > 0 {
+			return fmt.Errorf("serve takes no arguments")
+		}
+		return serve(ctx, logger)
+	case "check":
+		return cli.Check(ctx, config.NewManager(logger), logger, args, os.Stdout)
+	case "migrate":
+		if len(args) > 0 && args[0] == "help" {
+			fmt.Println(cli.MigrateUsage)
+			return nil
+		}
+		cfg, err := config.NewManager(logger).Load()
+		if err != nil {
+			return err
+		}
+		if err := configureLogger(logger, cfg); err != nil {
+			return err
+		}
+		return cli.Migrate(ctx, cfg, logger, args, os.Stdout)
+	case "version":
+		fmt.Println(AppVersion)
+		return nil
+	case "help", "-h", "--help":
+		fmt.Println(usage)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q\n\n%s", command, usage)
+	}
+}
+
+// serve connects to the configured backends, runs the proxy until ctx is
+// cancelled by SIGINT or SIGTERM and then shuts it down gracefully
+func serve(ctx context.Context, logger *logrus.Logger) error {
+	cfg, err := config.NewManager(logger).Load()
+	if err != nil {
+		return err
+	}
+	if err := configureLogger(logger, cfg); err != nil {
+		return err
+	}
+	logger.WithField("version", AppVersion).Info("Loaded configuration")
+
+	var keyRepo *repository.KeyRepository
+	if cfg.UsesDatabase() {
+		db, err := cli.ConnectDatabase(ctx, cfg, logger)
+		if err != nil {
+			return err
+		}
+		defer closeDatabase(db, logger)
+
+		if err := cli.MigrateOnStartup(ctx, cfg, db, logger); err != nil {
+			return err
+		}
+		keyRepo = repository.NewKeyRepository(db)
+	}
+
+	usageCache := cache.NewMemoryCache()
+	if cfg.UsesRedis() {
+		client, err := cli.ConnectRedis(ctx, cfg, logger)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+		usageCache = cache.NewUsageCache(client)
+	}
+
+	var reporter *errreport.Reporter
+	if cfg.SentryDSN != "" {
+		if reporter, err = errreport.New(cfg, logger); err != nil {
+			return fmt.Errorf("failed to set up error reporting: %w", err)
+		}
+	}
+
+	server, err := proxy.NewServer(cfg, logger, keyRepo, usageCache, reporter)
+	if err != nil {
+		return err
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.Start()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	if err := server.Stop(context.Background()); err != nil {
+		return fmt.Errorf("failed to stop server: %w", err)
+	}
+	return <-errCh
+}
+
+// configureLogger applies LOG_LEVEL, LOG_FORMAT and LOG_ENABLE_FILE to logger
+func configureLogger(logger *logrus.Logger, cfg *config.Config) error {
+	level, err := logrus.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		return fmt.Errorf("invalid LOG_LEVEL: %w", err)
+	}
+	logger.SetLevel(level)
+
+	if cfg.LogFormat == "json" {
+		logger.SetFormatter(&logrus.JSONFormatter{})
+	} else {
+		logger.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+	}
+
+	if cfg.LogEnableFile {
+		if err := os.MkdirAll(filepath.Dir(cfg.LogFilePath), 0o755); err != nil {
+			return fmt.Errorf("failed to create log directory: %w", err)
+		}
+		file, err := os.OpenFile(cfg.LogFilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to open log file: %w", err)
+		}
+		logger.SetOutput(io.MultiWriter(os.Stdout, file))
+	}
+	return nil
+}
+
+// closeDatabase closes the key database, logging a failure
+func closeDatabase(db *database.DB, logger *logrus.Logger) {
+	if err := db.Close(); err != nil {
+		logger.WithError(err).Warn("Failed to close database")
+	}
+}
@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/pkg/types"
+)
+
+// KeyErrorsPrefix namespaces the error counters replicas share to decide when a
+// key has failed often enough to be blacklisted
+const KeyErrorsPrefix = "key_errors:"
+
+// SetBlacklistEntry stores a key's blacklist entry for every replica. A temporary
+// entry expires when its blacklist ends; a permanent one stays until deleted.
+func (c *UsageCache) SetBlacklistEntry(ctx context.Context, entry *types.BlacklistEntry) error {
+	var ttl time.Duration
+	if !entry.Permanent && entry.BlacklistedUntil != nil {
+		ttl = time.Until(*entry.BlacklistedUntil)
+		if ttl <= 0 {
+			return nil
+		}
+	}
+	return c.setJSON(ctx, BlacklistCachePrefix+entry.Key, entry, ttl)
+}
+
+// GetBlacklistEntries returns the shared blacklist entries of the given keys,
+// leaving out keys that are not blacklisted
+func (c *UsageCache) GetBlacklistEntries(ctx context.Context, keys []string) (map[string]*types.BlacklistEntry, error) {
+	entries := make(map[string]*types.BlacklistEntry)
+	if len(keys) == 0 {
+		return entries, nil
+	}
+
+	cacheKeys := make([]string, len(keys))
+	for i, key := range keys {
+		cacheKeys[i] = BlacklistCachePrefix + key
+	}
+	values, err := c.store.MGet(ctx, cacheKeys...)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var entry types.BlacklistEntry
+		// Entries written before blacklist state was shared carry no key and are skipped
+		if err := json.Unmarshal([]byte(data), &entry); err != nil || entry.Key != keys[i] {
+			continue
+		}
+		entries[keys[i]] = &entry
+	}
+	return entries, nil
+}
+
+// DeleteBlacklistEntries clears the shared blacklist entries and error counters
+// of the given keys
+func (c *UsageCache) DeleteBlacklistEntries(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	cacheKeys := make([]string, 0, 2*len(keys))
+	for _, key := range keys {
+		cacheKeys = append(cacheKeys, BlacklistCachePrefix+key, KeyErrorsPrefix+key)
+	}
+	return c.store.Del(ctx, cacheKeys...)
+}
+
+// AddKeyError counts a failure of a key across replicas and returns the total
+// within window
+func (c *UsageCache) AddKeyError(ctx context.Context, key string, window time.Duration) (int64, error) {
+	return c.store.IncrBy(ctx, KeyErrorsPrefix+key, 1, window)
+}
+
+// DeleteKeyErrors clears a key's shared error counter
+func (c *UsageCache) DeleteKeyErrors(ctx context.Context, key string) error {
+	return c.store.Del(ctx, KeyErrorsPrefix+key)
+}
@@ -0,0 +1,11 @@
+package cache
+
+import "context"
+
+// CursorPrefix namespaces the rotation cursors replicas share per key pool
+const CursorPrefix = "cursor:"
+
+// NextCursor advances a pool's shared rotation cursor and returns its new position
+func (c *UsageCache) NextCursor(ctx context.Context, pool string) (int64, error) {
+	return c.store.IncrBy(ctx, CursorPrefix+pool, 1, 0)
+}
@@ -0,0 +1,42 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/pkg/types"
+)
+
+// IdempotencyPrefix namespaces responses remembered for Idempotency-Key headers
+const IdempotencyPrefix = "idempotency:"
+
+// ReserveIdempotencyKey stores record only if the key is unused, reporting
+// whether this caller now owns the key
+func (c *UsageCache) ReserveIdempotencyKey(ctx context.Context, key string, record *types.IdempotencyRecord, ttl time.Duration) (bool, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return false, err
+	}
+	return c.store.SetNX(ctx, IdempotencyPrefix+key, data, ttl)
+}
+
+func (c *UsageCache) SetIdempotencyRecord(ctx context.Context, key string, record *types.IdempotencyRecord, ttl time.Duration) error {
+	cacheKey := IdempotencyPrefix + key
+	return c.setJSON(ctx, cacheKey, record, ttl)
+}
+
+func (c *UsageCache) GetIdempotencyRecord(ctx context.Context, key string) (*types.IdempotencyRecord, error) {
+	cacheKey := IdempotencyPrefix + key
+	var record types.IdempotencyRecord
+	err := c.getJSON(ctx, cacheKey, &record)
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (c *UsageCache) DeleteIdempotencyRecord(ctx context.Context, key string) error {
+	cacheKey := IdempotencyPrefix + key
+	return c.store.Del(ctx, cacheKey)
+}
@@ -0,0 +1,270 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memorySweepInterval is how often expired entries are dropped from memory
+const memorySweepInterval = time.Minute
+
+// memoryEntry is a value kept in memory, with the time it expires (zero for never)
+type memoryEntry struct {
+	value     string
+	expiresAt time.Time
+}
+
+func (e *memoryEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+// memoryBucket is a requests-per-minute token bucket kept in memory
+type memoryBucket struct {
+	tokens float64
+	at     time.Time
+}
+
+// memoryStore keeps the cache in process memory for deployments without Redis.
+// Nothing is shared with other replicas and everything is lost on restart.
+type memoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+	buckets map[string]*memoryBucket
+
+	subscribersMu sync.RWMutex
+	subscribers   map[string][]chan string // channel -> subscriber queues
+}
+
+func newMemoryStore() *memoryStore {
+	s := &memoryStore{
+		entries:     make(map[string]*memoryEntry),
+		buckets:     make(map[string]*memoryBucket),
+		subscribers: make(map[string][]chan string),
+	}
+	go s.sweep()
+	return s
+}
+
+// sweep drops expired entries and idle buckets so unread keys do not pile up
+func (s *memoryStore) sweep() {
+	ticker := time.NewTicker(memorySweepInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		s.mu.Lock()
+		for key, entry := range s.entries {
+			if entry.expired(now) {
+				delete(s.entries, key)
+			}
+		}
+		for key, bucket := range s.buckets {
+			if now.Sub(bucket.at) > 2*time.Minute {
+				delete(s.buckets, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// load returns a key's entry unless it is missing or expired; s.mu must be held
+func (s *memoryStore) load(key string, now time.Time) (*memoryEntry, bool) {
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if entry.expired(now) {
+		delete(s.entries, key)
+		return nil, false
+	}
+	return entry, true
+}
+
+// store sets a key's value; s.mu must be held
+func (s *memoryStore) store(key string, value interface{}, ttl time.Duration, now time.Time) {
+	entry := &memoryEntry{value: memoryValue(value)}
+	if ttl > 0 {
+		entry.expiresAt = now.Add(ttl)
+	}
+	s.entries[key] = entry
+}
+
+// memoryValue renders a value the way Redis stores it
+func memoryValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (s *memoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (s *memoryStore) Get(ctx context.Context, key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.load(key, time.Now())
+	if !ok {
+		return "", errNotFound
+	}
+	return entry.value, nil
+}
+
+func (s *memoryStore) MGet(ctx context.Context, keys ...string) ([]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		if entry, ok := s.load(key, now); ok {
+			values[i] = entry.value
+		}
+	}
+	return values, nil
+}
+
+func (s *memoryStore) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.store(key, value, ttl, time.Now())
+	return nil
+}
+
+func (s *memoryStore) SetNX(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if _, ok := s.load(key, now); ok {
+		return false, nil
+	}
+	s.store(key, value, ttl, now)
+	return true, nil
+}
+
+func (s *memoryStore) Del(ctx context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+func (s *memoryStore) DeletePattern(ctx context.Context, pattern string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prefix, wildcard := strings.CutSuffix(pattern, "*")
+	for key := range s.entries {
+		if key == pattern || (wildcard && strings.HasPrefix(key, prefix)) {
+			delete(s.entries, key)
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) IncrBy(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var value int64
+	var expiresAt time.Time
+	if entry, ok := s.load(key, now); ok {
+		current, err := strconv.ParseInt(entry.value, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("value of %s is not an integer", key)
+		}
+		value, expiresAt = current, entry.expiresAt
+	}
+
+	value += n
+	s.entries[key] = &memoryEntry{value: strconv.FormatInt(value, 10), expiresAt: expiresAt}
+	if ttl > 0 {
+		s.entries[key].expiresAt = now.Add(ttl)
+	}
+	return value, nil
+}
+
+// TakeToken refills and takes from the bucket as the Redis token bucket script does
+func (s *memoryStore) TakeToken(ctx context.Context, key string, rpm int) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	capacity := float64(rpm)
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = &memoryBucket{tokens: capacity, at: now}
+		s.buckets[key] = bucket
+	}
+
+	elapsed := float64(now.Sub(bucket.at).Milliseconds())
+	bucket.tokens = math.Min(capacity, bucket.tokens+math.Max(0, elapsed)*capacity/60000)
+	bucket.at = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0, nil
+	}
+	wait := math.Ceil((1 - bucket.tokens) * 60000 / capacity)
+	return false, time.Duration(wait) * time.Millisecond, nil
+}
+
+// Publish delivers a message to the subscribers in this process, dropping it for
+// subscribers that are falling behind
+func (s *memoryStore) Publish(ctx context.Context, channel string, message []byte) error {
+	s.subscribersMu.RLock()
+	defer s.subscribersMu.RUnlock()
+
+	for _, queue := range s.subscribers[channel] {
+		select {
+		case queue <- string(message):
+		default:
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) Subscribe(ctx context.Context, channel string, handle func(payload string)) error {
+	queue := make(chan string, 100)
+
+	s.subscribersMu.Lock()
+	s.subscribers[channel] = append(s.subscribers[channel], queue)
+	s.subscribersMu.Unlock()
+
+	defer func() {
+		s.subscribersMu.Lock()
+		defer s.subscribersMu.Unlock()
+		queues := s.subscribers[channel]
+		for i, q := range queues {
+			if q == queue {
+				s.subscribers[channel] = append(queues[:i:i], queues[i+1:]...)
+				break
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case payload := <-queue:
+			handle(payload)
+		}
+	}
+}
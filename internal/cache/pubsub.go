@@ -0,0 +1,43 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/dbccccccc/tavily-load/pkg/types"
+)
+
+// KeyChangesChannel is the pub/sub channel replicas announce key changes on
+const KeyChangesChannel = "key_changes"
+
+// Key change actions
+const (
+	KeyChangeReload      = "reload"
+	KeyChangeBlacklist   = "blacklist"
+	KeyChangeUnblacklist = "unblacklist"
+)
+
+// KeyChange is a change to the key pool announced to the other replicas
+type KeyChange = types.KeyChange
+
+// PublishKeyChange announces a key change to every subscribed replica
+func (c *UsageCache) PublishKeyChange(ctx context.Context, change *KeyChange) error {
+	data, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	return c.store.Publish(ctx, KeyChangesChannel, data)
+}
+
+// SubscribeKeyChanges calls handle with every key change announced until ctx is
+// cancelled. The subscription is re-established by the client after a dropped
+// connection; messages published meanwhile are lost.
+func (c *UsageCache) SubscribeKeyChanges(ctx context.Context, handle func(*KeyChange)) error {
+	return c.store.Subscribe(ctx, KeyChangesChannel, func(payload string) {
+		var change KeyChange
+		if err := json.Unmarshal([]byte(payload), &change); err != nil {
+			return
+		}
+		handle(&change)
+	})
+}
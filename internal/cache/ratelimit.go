@@ -0,0 +1,137 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const RateLimitPrefix = "ratelimit:"
+
+// tokenBucketScript refills a per-key bucket of capacity tokens per minute and
+// takes one token from it. It returns whether a token was taken and, if not,
+// how many milliseconds until the next one is available.
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local now = tonumber(ARGV[2])
+
+local data = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(data[1]) or capacity
+local ts = tonumber(data[2]) or now
+
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * capacity / 60000)
+
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) * 60000 / capacity)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', KEYS[1], 120000)
+return {allowed, wait}
+`)
+
+// TakeKeyToken takes a token from the key's requests-per-minute bucket. When the
+// bucket is empty it returns false and the time until a token becomes available.
+func (c *UsageCache) TakeKeyToken(ctx context.Context, key string, rpm int) (bool, time.Duration, error) {
+	return c.store.TakeToken(ctx, RateLimitPrefix+key, rpm)
+}
+
+// TokenCreditsPrefix namespaces the daily credit counters of auth tokens
+const TokenCreditsPrefix = "token_credits:"
+
+// tokenCreditsKey returns the counter of a token for the UTC day containing t
+func tokenCreditsKey(tokenID int64, t time.Time) string {
+	return fmt.Sprintf("%s%d:%s", TokenCreditsPrefix, tokenID, t.UTC().Format("2006-01-02"))
+}
+
+// AddTokenCredits adds credits to a token's counter for today and returns the new total
+func (c *UsageCache) AddTokenCredits(ctx context.Context, tokenID int64, credits int) (int64, error) {
+	return c.store.IncrBy(ctx, tokenCreditsKey(tokenID, time.Now()), int64(credits), 48*time.Hour)
+}
+
+// GetTokenCredits returns the credits a token has used today
+func (c *UsageCache) GetTokenCredits(ctx context.Context, tokenID int64) (int64, error) {
+	used, err := c.store.Get(ctx, tokenCreditsKey(tokenID, time.Now()))
+	if err == errNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(used, 10, 64)
+}
+
+// KeyCreditsPrefix namespaces the daily and monthly credit counters of API keys
+const KeyCreditsPrefix = "key_credits:"
+
+// GlobalCreditsPrefix namespaces the daily and monthly credit counters of the
+// whole deployment
+const GlobalCreditsPrefix = "global_credits:"
+
+// windowCreditsKeys returns the counters under prefix for the UTC day and month containing t
+func windowCreditsKeys(prefix string, t time.Time) (string, string) {
+	t = t.UTC()
+	return prefix + t.Format("2006-01-02"), prefix + t.Format("2006-01")
+}
+
+// addWindowCredits adds credits to the day and month counters under prefix and
+// returns the new totals
+func (c *UsageCache) addWindowCredits(ctx context.Context, prefix string, credits int) (int64, int64, error) {
+	daily, monthly := windowCreditsKeys(prefix, time.Now())
+	dailyTotal, err := c.store.IncrBy(ctx, daily, int64(credits), 48*time.Hour)
+	if err != nil {
+		return 0, 0, err
+	}
+	monthlyTotal, err := c.store.IncrBy(ctx, monthly, int64(credits), 32*24*time.Hour)
+	if err != nil {
+		return 0, 0, err
+	}
+	return dailyTotal, monthlyTotal, nil
+}
+
+// getWindowCredits returns the day and month counters under prefix
+func (c *UsageCache) getWindowCredits(ctx context.Context, prefix string) (int64, int64, error) {
+	daily, monthly := windowCreditsKeys(prefix, time.Now())
+	values, err := c.store.MGet(ctx, daily, monthly)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	counts := make([]int64, len(values))
+	for i, value := range values {
+		if s, ok := value.(string); ok {
+			counts[i], _ = strconv.ParseInt(s, 10, 64)
+		}
+	}
+	return counts[0], counts[1], nil
+}
+
+// AddKeyCredits adds credits to an API key's counters for today and this month
+// and returns the new totals
+func (c *UsageCache) AddKeyCredits(ctx context.Context, key string, credits int) (int64, int64, error) {
+	return c.addWindowCredits(ctx, KeyCreditsPrefix+key+":", credits)
+}
+
+// GetKeyCredits returns the credits an API key has spent today and this month
+func (c *UsageCache) GetKeyCredits(ctx context.Context, key string) (int64, int64, error) {
+	return c.getWindowCredits(ctx, KeyCreditsPrefix+key+":")
+}
+
+// AddGlobalCredits adds credits to the deployment's counters for today and this
+// month and returns the new totals
+func (c *UsageCache) AddGlobalCredits(ctx context.Context, credits int) (int64, int64, error) {
+	return c.addWindowCredits(ctx, GlobalCreditsPrefix, credits)
+}
+
+// GetGlobalCredits returns the credits the deployment has spent today and this month
+func (c *UsageCache) GetGlobalCredits(ctx context.Context) (int64, int64, error) {
+	return c.getWindowCredits(ctx, GlobalCreditsPrefix)
+}
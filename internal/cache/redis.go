@@ -15,21 +15,43 @@ type Config struct {
 	Password string
 	DB       int
 	PoolSize int
+
+	// Username authenticates as a Redis 6 ACL user; empty uses the default user
+	Username string
+
+	// TLS connects over TLS, as managed Redis offerings require
+	TLS TLSConfig
+
+	// SlowThreshold logs commands taking longer than this; 0 disables the log
+	SlowThreshold time.Duration
 }
 
 type RedisClient struct {
 	*redis.Client
 	config *Config
+	logger *logrus.Logger
 }
 
-func NewRedisClient(config *Config) (*RedisClient, error) {
+func NewRedisClient(config *Config, logger *logrus.Logger) (*RedisClient, error) {
+	tlsConfig, err := config.TLS.build()
+	if err != nil {
+		return nil, err
+	}
+
 	rdb := redis.NewClient(&redis.Options{
-		Addr:     config.Host + ":" + config.Port,
-		Password: config.Password,
-		DB:       config.DB,
-		PoolSize: config.PoolSize,
+		Addr:      config.Host + ":" + config.Port,
+		Username:  config.Username,
+		Password:  config.Password,
+		DB:        config.DB,
+		PoolSize:  config.PoolSize,
+		TLSConfig: tlsConfig,
 	})
 
+	rdb.AddHook(tracingHook{})
+	if config.SlowThreshold > 0 {
+		rdb.AddHook(slowLogHook{threshold: config.SlowThreshold, logger: logger})
+	}
+
 	// Test connection
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -39,11 +61,12 @@ func NewRedisClient(config *Config) (*RedisClient, error) {
 		return nil, err
 	}
 
-	logrus.Info("Successfully connected to Redis")
+	logger.Info("Successfully connected to Redis")
 
 	return &RedisClient{
 		Client: rdb,
 		config: config,
+		logger: logger,
 	}, nil
 }
 
@@ -79,6 +102,6 @@ func (r *RedisClient) GetConfig() *Config {
 }
 
 func (r *RedisClient) Close() error {
-	logrus.Info("Closing Redis connection")
+	r.logger.Info("Closing Redis connection")
 	return r.Client.Close()
 }
\ No newline at end of file
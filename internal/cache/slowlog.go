@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+)
+
+// slowLogHook logs Redis commands that ran longer than threshold. Only command
+// names are logged, since keys and values can embed API keys.
+type slowLogHook struct {
+	threshold time.Duration
+	logger    *logrus.Logger
+}
+
+type slowLogStartKey struct{}
+
+func (h slowLogHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, slowLogStartKey{}, time.Now()), nil
+}
+
+func (h slowLogHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	h.log(ctx, cmd.Name())
+	return nil
+}
+
+func (h slowLogHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, slowLogStartKey{}, time.Now()), nil
+}
+
+func (h slowLogHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	names := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		names[i] = cmd.Name()
+	}
+	h.log(ctx, "pipeline "+strings.Join(names, ","))
+	return nil
+}
+
+// log reports the operation if it started longer than threshold ago
+func (h slowLogHook) log(ctx context.Context, operation string) {
+	start, ok := ctx.Value(slowLogStartKey{}).(time.Time)
+	if !ok {
+		return
+	}
+	if elapsed := time.Since(start); elapsed >= h.threshold {
+		h.logger.WithFields(logrus.Fields{
+			"operation": operation,
+			"duration":  elapsed.String(),
+			"threshold": h.threshold.String(),
+		}).Warn("Slow Redis operation")
+	}
+}
@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// errNotFound is returned by store.Get for a missing key. It is redis.Nil so both
+// backends report misses alike.
+var errNotFound = redis.Nil
+
+// store is the key-value backend of UsageCache: Redis, or an in-process map when
+// Redis is not configured
+type store interface {
+	Ping(ctx context.Context) error
+	Get(ctx context.Context, key string) (string, error)
+	// MGet returns a string for every key that is set and nil for the others
+	MGet(ctx context.Context, keys ...string) ([]interface{}, error)
+	Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error
+	SetNX(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error)
+	Del(ctx context.Context, keys ...string) error
+	// DeletePattern deletes the keys matching a pattern ending in *
+	DeletePattern(ctx context.Context, pattern string) error
+	// IncrBy adds n to a counter and returns its new value. A positive ttl
+	// restarts the counter's expiry.
+	IncrBy(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error)
+	// TakeToken takes a token from a bucket refilled with rpm tokens per minute,
+	// returning the wait until the next token when the bucket is empty
+	TakeToken(ctx context.Context, key string, rpm int) (bool, time.Duration, error)
+	Publish(ctx context.Context, channel string, message []byte) error
+	// Subscribe calls handle with every message published on channel until ctx is
+	// cancelled
+	Subscribe(ctx context.Context, channel string, handle func(payload string)) error
+}
+
+// redisStore keeps the cache in Redis, shared by every replica
+type redisStore struct {
+	client *RedisClient
+}
+
+func (s *redisStore) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx).Err()
+}
+
+func (s *redisStore) Get(ctx context.Context, key string) (string, error) {
+	return s.client.Get(ctx, key).Result()
+}
+
+func (s *redisStore) MGet(ctx context.Context, keys ...string) ([]interface{}, error) {
+	return s.client.MGet(ctx, keys...).Result()
+}
+
+func (s *redisStore) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	return s.client.Set(ctx, key, value, ttl).Err()
+}
+
+func (s *redisStore) SetNX(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error) {
+	return s.client.SetNX(ctx, key, value, ttl).Result()
+}
+
+func (s *redisStore) Del(ctx context.Context, keys ...string) error {
+	return s.client.Del(ctx, keys...).Err()
+}
+
+func (s *redisStore) DeletePattern(ctx context.Context, pattern string) error {
+	return s.client.DeletePattern(ctx, pattern)
+}
+
+func (s *redisStore) IncrBy(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error) {
+	if ttl <= 0 {
+		return s.client.IncrBy(ctx, key, n).Result()
+	}
+	pipe := s.client.Pipeline()
+	incr := pipe.IncrBy(ctx, key, n)
+	pipe.Expire(ctx, key, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+func (s *redisStore) TakeToken(ctx context.Context, key string, rpm int) (bool, time.Duration, error) {
+	result, err := tokenBucketScript.Run(ctx, s.client, []string{key}, rpm, time.Now().UnixMilli()).Int64Slice()
+	if err != nil {
+		return false, 0, err
+	}
+	return result[0] == 1, time.Duration(result[1]) * time.Millisecond, nil
+}
+
+func (s *redisStore) Publish(ctx context.Context, channel string, message []byte) error {
+	return s.client.Publish(ctx, channel, message).Err()
+}
+
+// Subscribe re-establishes the subscription after a dropped connection; messages
+// published meanwhile are lost
+func (s *redisStore) Subscribe(ctx context.Context, channel string, handle func(payload string)) error {
+	pubsub := s.client.Subscribe(ctx, channel)
+	defer pubsub.Close()
+
+	// Wait for the subscription to be confirmed so a broken connection is reported
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return err
+	}
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case message, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			handle(message.Payload)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// TLSConfig describes how to reach Redis over TLS
+type TLSConfig struct {
+	Enabled bool
+	// CAFile verifies the server against these PEM certificates instead of the
+	// system roots
+	CAFile string
+	// CertFile and KeyFile present a client certificate for mutual TLS
+	CertFile string
+	KeyFile  string
+	// InsecureSkipVerify accepts any server certificate; for testing only
+	InsecureSkipVerify bool
+}
+
+// build returns the TLS settings for the client, or nil when TLS is off. The server
+// name is taken from the address being dialled.
+func (c TLSConfig) build() (*tls.Config, error) {
+	if !c.Enabled {
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Redis CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in Redis CA file %s", c.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load Redis client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/dbccccccc/tavily-load/internal/tracing"
+	"github.com/go-redis/redis/v8"
+)
+
+// tracingHook records Redis commands issued on behalf of a traced request as
+// spans. Only command names are recorded, since keys and values can embed API keys.
+type tracingHook struct{}
+
+type redisSpanKey struct{}
+
+func (tracingHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	ctx, span := tracing.StartChild(ctx, "redis "+cmd.Name(), tracing.KindClient)
+	if span == nil {
+		return ctx, nil
+	}
+	span.SetAttribute("db.system", "redis")
+	span.SetAttribute("db.operation", cmd.Name())
+	return context.WithValue(ctx, redisSpanKey{}, span), nil
+}
+
+func (tracingHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	endRedisSpan(ctx, cmd.Err())
+	return nil
+}
+
+func (tracingHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	ctx, span := tracing.StartChild(ctx, "redis pipeline", tracing.KindClient)
+	if span == nil {
+		return ctx, nil
+	}
+	span.SetAttribute("db.system", "redis")
+	span.SetAttribute("db.redis.pipeline_length", len(cmds))
+	return context.WithValue(ctx, redisSpanKey{}, span), nil
+}
+
+func (tracingHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if cmdErr := cmd.Err(); cmdErr != nil && cmdErr != redis.Nil {
+			err = cmdErr
+			break
+		}
+	}
+	endRedisSpan(ctx, err)
+	return nil
+}
+
+// endRedisSpan finishes the span started for a command; a missing key is not an error
+func endRedisSpan(ctx context.Context, err error) {
+	span, ok := ctx.Value(redisSpanKey{}).(*tracing.Span)
+	if !ok {
+		return
+	}
+	if err != nil && err != redis.Nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
@@ -2,6 +2,7 @@ package cache
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"time"
@@ -14,6 +15,10 @@ const (
 	KeyAnalyticsCachePrefix = "analytics:"
 	KeyStatsCachePrefix     = "stats:"
 	BlacklistCachePrefix    = "blacklist:"
+	FailedRequestPrefix     = "failed_request:"
+	ResponseCachePrefix     = "response:"
+	JobPrefix               = "job:"
+	SelectionStrategyKey    = "selection_strategy"
 
 	DefaultUsageTTL     = 5 * time.Minute
 	DefaultAnalyticsTTL = 10 * time.Minute
@@ -22,22 +27,78 @@ const (
 )
 
 type UsageCache struct {
-	client *RedisClient
+	store store
 }
 
+var _ types.UsageCache = (*UsageCache)(nil)
+
 func NewUsageCache(client *RedisClient) *UsageCache {
-	return &UsageCache{client: client}
+	return &UsageCache{store: &redisStore{client: client}}
+}
+
+// NewMemoryCache creates a cache kept in process memory, for running without
+// Redis. State is lost on restart and not shared with other replicas.
+func NewMemoryCache() *UsageCache {
+	return &UsageCache{store: newMemoryStore()}
+}
+
+// Shared reports whether the cache is shared with other replicas through Redis.
+// It is false for a nil cache.
+func (c *UsageCache) Shared() bool {
+	if c == nil {
+		return false
+	}
+	_, ok := c.store.(*redisStore)
+	return ok
+}
+
+// Ping checks that Redis is reachable; the in-memory cache always is
+func (c *UsageCache) Ping(ctx context.Context) error {
+	return c.store.Ping(ctx)
+}
+
+// PoolStats returns the statistics of the Redis connection pool, or nil for the
+// in-memory cache
+func (c *UsageCache) PoolStats() *types.PoolStats {
+	redisStore, ok := c.store.(*redisStore)
+	if !ok {
+		return nil
+	}
+	stats := redisStore.client.PoolStats()
+	return &types.PoolStats{
+		MaxOpen:  redisStore.client.Options().PoolSize,
+		Open:     int(stats.TotalConns),
+		InUse:    int(stats.TotalConns) - int(stats.IdleConns),
+		Idle:     int(stats.IdleConns),
+		Timeouts: stats.Timeouts,
+	}
+}
+
+func (c *UsageCache) setJSON(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return c.store.Set(ctx, key, data, ttl)
+}
+
+func (c *UsageCache) getJSON(ctx context.Context, key string, dest interface{}) error {
+	data, err := c.store.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(data), dest)
 }
 
 func (c *UsageCache) SetUsage(ctx context.Context, key string, usage *types.TavilyUsage) error {
 	cacheKey := KeyUsageCachePrefix + key
-	return c.client.SetJSON(ctx, cacheKey, usage, DefaultUsageTTL)
+	return c.setJSON(ctx, cacheKey, usage, DefaultUsageTTL)
 }
 
 func (c *UsageCache) GetUsage(ctx context.Context, key string) (*types.TavilyUsage, error) {
 	cacheKey := KeyUsageCachePrefix + key
 	var usage types.TavilyUsage
-	err := c.client.GetJSON(ctx, cacheKey, &usage)
+	err := c.getJSON(ctx, cacheKey, &usage)
 	if err != nil {
 		return nil, err
 	}
@@ -46,18 +107,18 @@ func (c *UsageCache) GetUsage(ctx context.Context, key string) (*types.TavilyUsa
 
 func (c *UsageCache) DeleteUsage(ctx context.Context, key string) error {
 	cacheKey := KeyUsageCachePrefix + key
-	return c.client.Del(ctx, cacheKey).Err()
+	return c.store.Del(ctx, cacheKey)
 }
 
 func (c *UsageCache) SetKeyAnalytics(ctx context.Context, key string, analytics *types.KeyAnalytics) error {
 	cacheKey := KeyAnalyticsCachePrefix + key
-	return c.client.SetJSON(ctx, cacheKey, analytics, DefaultAnalyticsTTL)
+	return c.setJSON(ctx, cacheKey, analytics, DefaultAnalyticsTTL)
 }
 
 func (c *UsageCache) GetKeyAnalytics(ctx context.Context, key string) (*types.KeyAnalytics, error) {
 	cacheKey := KeyAnalyticsCachePrefix + key
 	var analytics types.KeyAnalytics
-	err := c.client.GetJSON(ctx, cacheKey, &analytics)
+	err := c.getJSON(ctx, cacheKey, &analytics)
 	if err != nil {
 		return nil, err
 	}
@@ -66,60 +127,19 @@ func (c *UsageCache) GetKeyAnalytics(ctx context.Context, key string) (*types.Ke
 
 func (c *UsageCache) SetKeyStats(ctx context.Context, key string, stats *types.KeyStatus) error {
 	cacheKey := KeyStatsCachePrefix + key
-	return c.client.SetJSON(ctx, cacheKey, stats, DefaultStatsTTL)
+	return c.setJSON(ctx, cacheKey, stats, DefaultStatsTTL)
 }
 
 func (c *UsageCache) GetKeyStats(ctx context.Context, key string) (*types.KeyStatus, error) {
 	cacheKey := KeyStatsCachePrefix + key
 	var stats types.KeyStatus
-	err := c.client.GetJSON(ctx, cacheKey, &stats)
+	err := c.getJSON(ctx, cacheKey, &stats)
 	if err != nil {
 		return nil, err
 	}
 	return &stats, nil
 }
 
-func (c *UsageCache) SetBlacklistStatus(ctx context.Context, key string, isBlacklisted bool, reason string, until *time.Time) error {
-	cacheKey := BlacklistCachePrefix + key
-	blacklistInfo := map[string]interface{}{
-		"is_blacklisted": isBlacklisted,
-		"reason":         reason,
-		"until":          until,
-		"cached_at":      time.Now(),
-	}
-	return c.client.SetJSON(ctx, cacheKey, blacklistInfo, DefaultBlacklistTTL)
-}
-
-func (c *UsageCache) GetBlacklistStatus(ctx context.Context, key string) (bool, string, *time.Time, error) {
-	cacheKey := BlacklistCachePrefix + key
-	var blacklistInfo map[string]interface{}
-	err := c.client.GetJSON(ctx, cacheKey, &blacklistInfo)
-	if err != nil {
-		return false, "", nil, err
-	}
-
-	isBlacklisted, ok := blacklistInfo["is_blacklisted"].(bool)
-	if !ok {
-		return false, "", nil, fmt.Errorf("invalid blacklist status format")
-	}
-
-	reason, _ := blacklistInfo["reason"].(string)
-
-	var until *time.Time
-	if untilStr, ok := blacklistInfo["until"].(string); ok && untilStr != "" {
-		if parsedTime, err := time.Parse(time.RFC3339, untilStr); err == nil {
-			until = &parsedTime
-		}
-	}
-
-	return isBlacklisted, reason, until, nil
-}
-
-func (c *UsageCache) DeleteBlacklistStatus(ctx context.Context, key string) error {
-	cacheKey := BlacklistCachePrefix + key
-	return c.client.Del(ctx, cacheKey).Err()
-}
-
 func (c *UsageCache) InvalidateKeyCache(ctx context.Context, key string) error {
 	patterns := []string{
 		KeyUsageCachePrefix + key,
@@ -129,7 +149,7 @@ func (c *UsageCache) InvalidateKeyCache(ctx context.Context, key string) error {
 	}
 
 	for _, pattern := range patterns {
-		if err := c.client.Del(ctx, pattern).Err(); err != nil {
+		if err := c.store.Del(ctx, pattern); err != nil {
 			return err
 		}
 	}
@@ -138,35 +158,47 @@ func (c *UsageCache) InvalidateKeyCache(ctx context.Context, key string) error {
 }
 
 func (c *UsageCache) InvalidateAllUsage(ctx context.Context) error {
-	return c.client.DeletePattern(ctx, KeyUsageCachePrefix+"*")
+	return c.store.DeletePattern(ctx, KeyUsageCachePrefix+"*")
 }
 
 func (c *UsageCache) InvalidateAllAnalytics(ctx context.Context) error {
-	return c.client.DeletePattern(ctx, KeyAnalyticsCachePrefix+"*")
+	return c.store.DeletePattern(ctx, KeyAnalyticsCachePrefix+"*")
 }
 
 func (c *UsageCache) SetUsageAnalytics(ctx context.Context, analytics *types.UsageAnalytics) error {
-	return c.client.SetJSON(ctx, "usage_analytics", analytics, DefaultAnalyticsTTL)
+	return c.setJSON(ctx, "usage_analytics", analytics, DefaultAnalyticsTTL)
 }
 
 func (c *UsageCache) GetUsageAnalytics(ctx context.Context) (*types.UsageAnalytics, error) {
 	var analytics types.UsageAnalytics
-	err := c.client.GetJSON(ctx, "usage_analytics", &analytics)
+	err := c.getJSON(ctx, "usage_analytics", &analytics)
 	if err != nil {
 		return nil, err
 	}
 	return &analytics, nil
 }
 
+func (c *UsageCache) SetSelectionStrategy(ctx context.Context, strategy types.SelectionStrategy) error {
+	return c.store.Set(ctx, SelectionStrategyKey, string(strategy), 0)
+}
+
+func (c *UsageCache) GetSelectionStrategy(ctx context.Context) (types.SelectionStrategy, error) {
+	strategy, err := c.store.Get(ctx, SelectionStrategyKey)
+	if err != nil {
+		return "", err
+	}
+	return types.SelectionStrategy(strategy), nil
+}
+
 func (c *UsageCache) SetStrategyMetrics(ctx context.Context, strategy types.SelectionStrategy, metrics *types.StrategyMetrics) error {
 	cacheKey := fmt.Sprintf("strategy_metrics:%s", strategy)
-	return c.client.SetJSON(ctx, cacheKey, metrics, DefaultAnalyticsTTL)
+	return c.setJSON(ctx, cacheKey, metrics, DefaultAnalyticsTTL)
 }
 
 func (c *UsageCache) GetStrategyMetrics(ctx context.Context, strategy types.SelectionStrategy) (*types.StrategyMetrics, error) {
 	cacheKey := fmt.Sprintf("strategy_metrics:%s", strategy)
 	var metrics types.StrategyMetrics
-	err := c.client.GetJSON(ctx, cacheKey, &metrics)
+	err := c.getJSON(ctx, cacheKey, &metrics)
 	if err != nil {
 		return nil, err
 	}
@@ -174,37 +206,28 @@ func (c *UsageCache) GetStrategyMetrics(ctx context.Context, strategy types.Sele
 }
 
 func (c *UsageCache) IncrementKeyUsage(ctx context.Context, key string, success bool) error {
-	pipe := c.client.Pipeline()
-
 	requestKey := fmt.Sprintf("counter:requests:%s", key)
-	pipe.Incr(ctx, requestKey)
-	pipe.Expire(ctx, requestKey, 24*time.Hour)
+	if _, err := c.store.IncrBy(ctx, requestKey, 1, 24*time.Hour); err != nil {
+		return err
+	}
 
 	if !success {
 		errorKey := fmt.Sprintf("counter:errors:%s", key)
-		pipe.Incr(ctx, errorKey)
-		pipe.Expire(ctx, errorKey, 24*time.Hour)
+		if _, err := c.store.IncrBy(ctx, errorKey, 1, 24*time.Hour); err != nil {
+			return err
+		}
 	}
 
 	lastUsedKey := fmt.Sprintf("last_used:%s", key)
-	pipe.Set(ctx, lastUsedKey, time.Now().Unix(), 24*time.Hour)
-
-	_, err := pipe.Exec(ctx)
-	return err
+	return c.store.Set(ctx, lastUsedKey, time.Now().Unix(), 24*time.Hour)
 }
 
 func (c *UsageCache) GetKeyCounters(ctx context.Context, key string) (int64, int64, *time.Time, error) {
-	pipe := c.client.Pipeline()
-
 	requestKey := fmt.Sprintf("counter:requests:%s", key)
 	errorKey := fmt.Sprintf("counter:errors:%s", key)
 	lastUsedKey := fmt.Sprintf("last_used:%s", key)
 
-	requestCmd := pipe.Get(ctx, requestKey)
-	errorCmd := pipe.Get(ctx, errorKey)
-	lastUsedCmd := pipe.Get(ctx, lastUsedKey)
-
-	_, err := pipe.Exec(ctx)
+	values, err := c.store.MGet(ctx, requestKey, errorKey, lastUsedKey)
 	if err != nil {
 		return 0, 0, nil, err
 	}
@@ -212,20 +235,20 @@ func (c *UsageCache) GetKeyCounters(ctx context.Context, key string) (int64, int
 	var requests, errors int64
 	var lastUsed *time.Time
 
-	if requestCmd.Val() != "" {
-		if val, err := strconv.ParseInt(requestCmd.Val(), 10, 64); err == nil {
+	if value, ok := values[0].(string); ok {
+		if val, err := strconv.ParseInt(value, 10, 64); err == nil {
 			requests = val
 		}
 	}
 
-	if errorCmd.Val() != "" {
-		if val, err := strconv.ParseInt(errorCmd.Val(), 10, 64); err == nil {
+	if value, ok := values[1].(string); ok {
+		if val, err := strconv.ParseInt(value, 10, 64); err == nil {
 			errors = val
 		}
 	}
 
-	if lastUsedCmd.Val() != "" {
-		if timestamp, err := strconv.ParseInt(lastUsedCmd.Val(), 10, 64); err == nil && timestamp > 0 {
+	if value, ok := values[2].(string); ok {
+		if timestamp, err := strconv.ParseInt(value, 10, 64); err == nil && timestamp > 0 {
 			t := time.Unix(timestamp, 0)
 			lastUsed = &t
 		}
@@ -233,3 +256,59 @@ func (c *UsageCache) GetKeyCounters(ctx context.Context, key string) (int64, int
 
 	return requests, errors, lastUsed, nil
 }
+
+func (c *UsageCache) SetFailedRequest(ctx context.Context, request *types.FailedRequest, ttl time.Duration) error {
+	cacheKey := FailedRequestPrefix + request.ID
+	return c.setJSON(ctx, cacheKey, request, ttl)
+}
+
+func (c *UsageCache) GetFailedRequest(ctx context.Context, id string) (*types.FailedRequest, error) {
+	cacheKey := FailedRequestPrefix + id
+	var request types.FailedRequest
+	err := c.getJSON(ctx, cacheKey, &request)
+	if err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+func (c *UsageCache) DeleteFailedRequest(ctx context.Context, id string) error {
+	cacheKey := FailedRequestPrefix + id
+	return c.store.Del(ctx, cacheKey)
+}
+
+func (c *UsageCache) SetCachedResponse(ctx context.Context, key string, response *types.CachedResponse, ttl time.Duration) error {
+	cacheKey := ResponseCachePrefix + key
+	return c.setJSON(ctx, cacheKey, response, ttl)
+}
+
+func (c *UsageCache) GetCachedResponse(ctx context.Context, key string) (*types.CachedResponse, error) {
+	cacheKey := ResponseCachePrefix + key
+	var response types.CachedResponse
+	err := c.getJSON(ctx, cacheKey, &response)
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// InvalidateCachedResponses removes cached responses whose key starts with prefix;
+// an empty prefix clears the whole response cache
+func (c *UsageCache) InvalidateCachedResponses(ctx context.Context, prefix string) error {
+	return c.store.DeletePattern(ctx, ResponseCachePrefix+prefix+"*")
+}
+
+func (c *UsageCache) SetJob(ctx context.Context, job *types.Job, ttl time.Duration) error {
+	cacheKey := JobPrefix + job.ID
+	return c.setJSON(ctx, cacheKey, job, ttl)
+}
+
+func (c *UsageCache) GetJob(ctx context.Context, id string) (*types.Job, error) {
+	cacheKey := JobPrefix + id
+	var job types.Job
+	err := c.getJSON(ctx, cacheKey, &job)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
@@ -0,0 +1,233 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/config"
+	"github.com/dbccccccc/tavily-load/internal/database"
+	"github.com/dbccccccc/tavily-load/internal/errors"
+	"github.com/dbccccccc/tavily-load/internal/keyprovider"
+	"github.com/dbccccccc/tavily-load/internal/repository"
+	"github.com/dbccccccc/tavily-load/migrations"
+	"github.com/dbccccccc/tavily-load/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// CheckUsage describes the check subcommand
+const CheckUsage = `usage: tavily-load check
+
+Loads and validates the configuration, connects to MySQL and Redis when they
+are configured, and tries up to 5 keys against the Tavily /usage endpoint,
+which spends no credits. Exits non-zero when a check fails.`
+
+// checkMaxKeyAttempts bounds the keys tried against Tavily before the key check
+// fails
+const checkMaxKeyAttempts = 5
+
+// Check statuses, as printed in the report
+const (
+	checkOK   = "OK"
+	checkWarn = "WARN"
+	checkFail = "FAIL"
+	checkSkip = "SKIP"
+)
+
+// checkReport prints one line per check and counts the failures
+type checkReport struct {
+	out      io.Writer
+	failures int
+}
+
+func (r *checkReport) add(status, name, format string, args ...interface{}) {
+	if status == checkFail {
+		r.failures++
+	}
+	fmt.Fprintf(r.out, "%-4s  %-14s %s\n", status, name, fmt.Sprintf(format, args...))
+}
+
+// Check runs `tavily-load check`: it loads the configuration with manager, tests
+// the connections the proxy would open and verifies that at least one key is
+// accepted by Tavily, writing a report to out. Connections are tried once, so a
+// service that is down is reported at once rather than waited for.
+func Check(ctx context.Context, manager *config.Manager, logger *logrus.Logger, args []string, out io.Writer) error {
+	if len(args) > 0 {
+		return fmt.Errorf("check takes no arguments\n\n%s", CheckUsage)
+	}
+	report := &checkReport{out: out}
+
+	loaded, err := manager.Load()
+	if err != nil {
+		report.add(checkFail, "Configuration", "%v", err)
+		return fmt.Errorf("configuration is invalid")
+	}
+	report.add(checkOK, "Configuration", "key source %s, upstream %s", loaded.KeySource, loaded.TavilyBaseURL)
+
+	cfg := *loaded
+	cfg.ConnectRetries = 0
+
+	var keyRepo *repository.KeyRepository
+	if cfg.UsesDatabase() {
+		db, err := ConnectDatabase(ctx, &cfg, logger)
+		if err != nil {
+			report.add(checkFail, "Database", "%v", err)
+		} else {
+			defer db.Close()
+			keyRepo = repository.NewKeyRepository(db)
+			if cfg.DBDriver == database.DriverSQLite {
+				report.add(checkOK, "Database", "opened %s", cfg.DBPath)
+			} else {
+				report.add(checkOK, "Database", "connected to %s:%s/%s", cfg.DBHost, cfg.DBPort, cfg.DBName)
+			}
+			checkMigrations(ctx, &cfg, db, logger, report)
+		}
+	} else {
+		report.add(checkSkip, "Database", "KEY_SOURCE=%s runs without the key database", cfg.KeySource)
+	}
+
+	if cfg.UsesRedis() {
+		client, err := ConnectRedis(ctx, &cfg, logger)
+		if err != nil {
+			report.add(checkFail, "Redis", "%v", err)
+		} else {
+			client.Close()
+			report.add(checkOK, "Redis", "connected to %s:%s", cfg.RedisHost, cfg.RedisPort)
+		}
+	} else {
+		report.add(checkSkip, "Redis", "REDIS_HOST is not set, the cache is kept in process memory")
+	}
+
+	checkKeys(ctx, &cfg, keyRepo, report)
+
+	if report.failures > 0 {
+		return fmt.Errorf("%d check(s) failed", report.failures)
+	}
+	fmt.Fprintln(out, "All checks passed")
+	return nil
+}
+
+// checkMigrations warns when the schema is behind the migrations built into the
+// binary or left dirty by a failed migration
+func checkMigrations(ctx context.Context, cfg *config.Config, db *database.DB, logger *logrus.Logger, report *checkReport) {
+	migrator, err := database.NewMigrator(db, migrations.Source(cfg.DBDriver, cfg.MigrationPath), logger)
+	if err != nil {
+		report.add(checkFail, "Migrations", "%v", err)
+		return
+	}
+	defer migrator.Close()
+	status, err := migrator.Status(ctx)
+	switch {
+	case err != nil:
+		report.add(checkFail, "Migrations", "%v", err)
+	case status.Dirty:
+		report.add(checkFail, "Migrations", "schema version %d is dirty, fix it by hand and run `tavily-load migrate force N`", status.Version)
+	case status.Unversioned:
+		report.add(checkFail, "Migrations", "tables exist but no schema version is recorded, run `tavily-load migrate force N`")
+	case len(status.Pending) > 0 && cfg.MigrateUp:
+		report.add(checkOK, "Migrations", "%d pending, applied on startup (MIGRATE_UP)", len(status.Pending))
+	case len(status.Pending) > 0:
+		report.add(checkWarn, "Migrations", "%d pending, run `tavily-load migrate up`", len(status.Pending))
+	default:
+		report.add(checkOK, "Migrations", "schema version %d is current", status.Version)
+	}
+}
+
+// checkKeys loads the keys from the key source and asks Tavily for the usage of
+// each in turn until one is accepted. keyRepo is nil when the key database is
+// not used or could not be reached.
+func checkKeys(ctx context.Context, cfg *config.Config, keyRepo *repository.KeyRepository, report *checkReport) {
+	keys, err := checkLoadKeys(ctx, cfg, keyRepo)
+	if err != nil {
+		report.add(checkFail, "Keys", "%v", err)
+		return
+	}
+	if len(keys) == 0 {
+		report.add(checkFail, "Keys", "no active keys in key source %s", cfg.KeySource)
+		return
+	}
+	report.add(checkOK, "Keys", "%d active key(s) in key source %s", len(keys), cfg.KeySource)
+
+	if cfg.DryRun {
+		report.add(checkSkip, "Tavily", "DRY_RUN simulates Tavily, keys are not sent upstream")
+		return
+	}
+
+	client := &http.Client{Timeout: cfg.RequestTimeout}
+	for i, key := range keys[:min(len(keys), checkMaxKeyAttempts)] {
+		err := checkKey(ctx, cfg, client, key)
+		if err == nil {
+			report.add(checkOK, "Tavily", "key %s is usable (%d of %d tried)", types.KeyPreview(key), i+1, min(len(keys), checkMaxKeyAttempts))
+			return
+		}
+		report.add(checkWarn, "Tavily", "key %s: %v", types.KeyPreview(key), err)
+	}
+	report.add(checkFail, "Tavily", "none of the %d key(s) tried is usable", min(len(keys), checkMaxKeyAttempts))
+}
+
+// checkLoadKeys returns the values of the active keys, read the way the key
+// manager reads them
+func checkLoadKeys(ctx context.Context, cfg *config.Config, keyRepo *repository.KeyRepository) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	provider, err := keyprovider.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if provider != nil {
+		keys, err := provider.FetchKeys(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load keys from %s: %w", provider.Name(), err)
+		}
+		return keys, nil
+	}
+
+	if keyRepo == nil {
+		return nil, fmt.Errorf("keys are stored in the database, which is not reachable")
+	}
+	apiKeys, err := keyRepo.GetAllActiveKeys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load keys from database: %w", err)
+	}
+	keys := make([]string, 0, len(apiKeys))
+	for _, apiKey := range apiKeys {
+		keys = append(keys, apiKey.KeyValue)
+	}
+	return keys, nil
+}
+
+// checkKey requests GET /usage with key, sending it the way the proxy does
+func checkKey(ctx context.Context, cfg *config.Config, client *http.Client, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cfg.TavilyBaseURL+"/usage", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	style := cfg.TavilyAuthHeader
+	if override, ok := cfg.TavilyAuthHeaderOverrides["/usage"]; ok {
+		style = override
+	}
+	if style == "x-api-key" {
+		req.Header.Set("X-API-Key", key)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	req.Header.Set("User-Agent", "tavily-load/1.0")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		tavilyErr := errors.ParseHTTPError(resp.StatusCode, resp.Header, body, "")
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(tavilyErr.Message))
+	}
+	return nil
+}
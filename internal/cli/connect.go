@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/cache"
+	"github.com/dbccccccc/tavily-load/internal/config"
+	"github.com/dbccccccc/tavily-load/internal/database"
+	"github.com/sirupsen/logrus"
+)
+
+// ConnectDatabase opens the key database described by the DB_* settings, retrying
+// while the database is not reachable yet
+func ConnectDatabase(ctx context.Context, cfg *config.Config, logger *logrus.Logger) (*database.DB, error) {
+	name := "MySQL"
+	if cfg.DBDriver == database.DriverSQLite {
+		name = "SQLite"
+	}
+
+	var db *database.DB
+	err := retryConnect(ctx, cfg, logger, name, func() error {
+		var err error
+		db, err = database.NewConnection(&database.Config{
+			Driver:          cfg.DBDriver,
+			Path:            cfg.DBPath,
+			Host:            cfg.DBHost,
+			Port:            cfg.DBPort,
+			Username:        cfg.DBUsername,
+			Password:        cfg.DBPassword,
+			Database:        cfg.DBName,
+			MaxOpenConns:    cfg.DBMaxOpenConns,
+			MaxIdleConns:    cfg.DBMaxIdleConns,
+			ConnMaxLifetime: cfg.DBConnMaxLifetime,
+			SlowThreshold:   cfg.SlowQueryThreshold,
+		}, logger)
+		return err
+	})
+	return db, err
+}
+
+// ConnectRedis connects to the Redis server described by the REDIS_* settings,
+// retrying while it is not reachable yet
+func ConnectRedis(ctx context.Context, cfg *config.Config, logger *logrus.Logger) (*cache.RedisClient, error) {
+	var client *cache.RedisClient
+	err := retryConnect(ctx, cfg, logger, "Redis", func() error {
+		var err error
+		client, err = cache.NewRedisClient(&cache.Config{
+			Host:          cfg.RedisHost,
+			Port:          cfg.RedisPort,
+			Password:      cfg.RedisPassword,
+			DB:            cfg.RedisDB,
+			PoolSize:      cfg.RedisPoolSize,
+			Username:      cfg.RedisUsername,
+			SlowThreshold: cfg.SlowCacheOpThreshold,
+			TLS: cache.TLSConfig{
+				Enabled:            cfg.RedisTLSEnabled,
+				CAFile:             cfg.RedisTLSCAFile,
+				CertFile:           cfg.RedisTLSCertFile,
+				KeyFile:            cfg.RedisTLSKeyFile,
+				InsecureSkipVerify: cfg.RedisTLSInsecureSkipVerify,
+			},
+		}, logger)
+		return err
+	})
+	return client, err
+}
+
+// retryConnect calls connect up to CONNECT_RETRIES more times after a failure,
+// doubling the wait between attempts from CONNECT_BACKOFF_BASE_MS up to
+// CONNECT_BACKOFF_MAX_MS
+func retryConnect(ctx context.Context, cfg *config.Config, logger *logrus.Logger, service string, connect func() error) error {
+	backoff := cfg.ConnectBackoffBase
+	for attempt := 1; ; attempt++ {
+		err := connect()
+		if err == nil {
+			return nil
+		}
+		if attempt > cfg.ConnectRetries {
+			return fmt.Errorf("failed to connect to %s after %d attempts: %w", service, attempt, err)
+		}
+
+		logger.WithError(err).WithFields(logrus.Fields{
+			"attempt": attempt,
+			"retry":   backoff.String(),
+		}).Warnf("%s is not reachable yet, retrying", service)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("gave up connecting to %s: %w", service, ctx.Err())
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > cfg.ConnectBackoffMax {
+			backoff = cfg.ConnectBackoffMax
+		}
+	}
+}
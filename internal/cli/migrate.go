@@ -0,0 +1,146 @@
+// Package cli holds what the tavily-load binary runs besides serving the proxy:
+// its subcommands and the steps taken before the server starts.
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/dbccccccc/tavily-load/internal/config"
+	"github.com/dbccccccc/tavily-load/internal/database"
+	"github.com/dbccccccc/tavily-load/migrations"
+	"github.com/sirupsen/logrus"
+)
+
+// MigrateUsage describes the migrate subcommand
+const MigrateUsage = `usage: tavily-load migrate <command>
+
+commands:
+  up        apply every pending migration
+  down [N]  revert the last N applied migrations (default 1)
+  status    show the schema version and pending migrations
+  force N   record N as the applied version without running migrations, for
+            databases created before the version was tracked or fixed by hand
+            after a failed migration; 0 clears the version
+
+Migrations are built into the binary; set MIGRATION_PATH to read them from a
+directory instead.`
+
+// Migrate runs `tavily-load migrate up|down [N]|status|force N` against the configured
+// database, writing the outcome to out
+func Migrate(ctx context.Context, cfg *config.Config, logger *logrus.Logger, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing migrate command\n\n%s", MigrateUsage)
+	}
+	command := args[0]
+
+	steps := 1
+	var forceVersion uint64
+	switch command {
+	case "up", "status":
+		if len(args) > 1 {
+			return fmt.Errorf("migrate %s takes no arguments", command)
+		}
+	case "down":
+		if len(args) > 2 {
+			return fmt.Errorf("migrate down takes at most one argument")
+		}
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				return fmt.Errorf("migrate down: N must be a positive number")
+			}
+			steps = n
+		}
+	case "force":
+		if len(args) != 2 {
+			return fmt.Errorf("migrate force takes exactly one argument")
+		}
+		n, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("migrate force: N must be a migration version")
+		}
+		forceVersion = n
+	default:
+		return fmt.Errorf("unknown migrate command %q\n\n%s", command, MigrateUsage)
+	}
+
+	if !cfg.UsesDatabase() {
+		return fmt.Errorf("KEY_SOURCE=%s does not use the key database, so there is nothing to migrate", cfg.KeySource)
+	}
+
+	db, err := ConnectDatabase(ctx, cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := database.NewMigrator(db, migrations.Source(cfg.DBDriver, cfg.MigrationPath), logger)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+
+	switch command {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		fmt.Fprintf(out, "Applied %d migration(s)\n", applied)
+		return err
+	case "down":
+		reverted, err := migrator.Down(ctx, steps)
+		fmt.Fprintf(out, "Reverted %d migration(s)\n", reverted)
+		return err
+	case "force":
+		if err := migrator.Force(ctx, forceVersion); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Schema version set to %d\n", forceVersion)
+		return nil
+	}
+
+	status, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+	version := strconv.FormatUint(status.Version, 10)
+	if status.Dirty {
+		version += " (dirty)"
+	}
+	fmt.Fprintf(out, "Schema version: %s\n", version)
+	if status.Unversioned {
+		fmt.Fprintln(out, "The database has tables but no schema version; run `tavily-load migrate force N` with the last migration its schema has")
+	}
+	if len(status.Pending) == 0 {
+		fmt.Fprintln(out, "No pending migrations")
+		return nil
+	}
+	fmt.Fprintf(out, "Pending migrations (%d):\n", len(status.Pending))
+	for _, migration := range status.Pending {
+		fmt.Fprintf(out, "  %03d_%s\n", migration.Version, migration.Name)
+	}
+	return nil
+}
+
+// MigrateOnStartup applies pending migrations before the server starts when
+// MIGRATE_UP is enabled
+func MigrateOnStartup(ctx context.Context, cfg *config.Config, db *database.DB, logger *logrus.Logger) error {
+	if !cfg.MigrateUp || db == nil {
+		return nil
+	}
+
+	migrator, err := database.NewMigrator(db, migrations.Source(cfg.DBDriver, cfg.MigrationPath), logger)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+	if applied > 0 {
+		logger.WithField("applied", applied).Info("Database migrated")
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EndpointOverride replaces global settings for one endpoint; nil fields keep
+// the global value
+type EndpointOverride struct {
+	RequestTimeout *time.Duration `json:"request_timeout,omitempty"`
+	MaxRetries     *int           `json:"max_retries,omitempty"`
+	// RateLimitRPM caps the requests per minute the proxy sends to the endpoint
+	RateLimitRPM *int `json:"rate_limit_rpm,omitempty"`
+	// CacheTTL caches the endpoint's responses this long; 0 disables caching
+	CacheTTL *time.Duration `json:"cache_ttl,omitempty"`
+}
+
+// EndpointSettings are the settings in effect for one endpoint
+type EndpointSettings struct {
+	RequestTimeout time.Duration
+	MaxRetries     int
+	RateLimitRPM   int // 0 = unlimited
+	Cached         bool
+	CacheTTL       time.Duration
+}
+
+// Endpoint returns the settings for an endpoint such as /search: the global
+// values with the endpoint's overrides applied. A query string is ignored.
+func (c *Config) Endpoint(endpoint string) EndpointSettings {
+	path, _, _ := strings.Cut(endpoint, "?")
+	reloadable := c.Reloadable()
+	settings := EndpointSettings{
+		RequestTimeout: reloadable.RequestTimeout,
+		MaxRetries:     reloadable.MaxRetries,
+		Cached:         c.ResponseCacheEnabled && contains(c.ResponseCacheEndpoints, path),
+		CacheTTL:       reloadable.ResponseCacheTTL,
+	}
+
+	override, ok := reloadable.EndpointOverrides[path]
+	if !ok {
+		return settings
+	}
+	if override.RequestTimeout != nil {
+		settings.RequestTimeout = *override.RequestTimeout
+	}
+	if override.MaxRetries != nil {
+		settings.MaxRetries = *override.MaxRetries
+	}
+	if override.RateLimitRPM != nil {
+		settings.RateLimitRPM = *override.RateLimitRPM
+	}
+	if override.CacheTTL != nil {
+		settings.Cached = c.ResponseCacheEnabled && *override.CacheTTL > 0
+		settings.CacheTTL = *override.CacheTTL
+	}
+	return settings
+}
+
+// loadEndpointOverrides reads the per-endpoint settings, each a comma-separated
+// list of endpoint=value pairs such as /crawl=300,/search=15
+func loadEndpointOverrides() (map[string]EndpointOverride, error) {
+	overrides := make(map[string]EndpointOverride)
+	set := func(key string, apply func(override *EndpointOverride, value int)) error {
+		for endpoint, raw := range getEnvStringMap(key) {
+			value, err := strconv.Atoi(raw)
+			if err != nil {
+				return fmt.Errorf("%s: %s must be a whole number", key, endpoint)
+			}
+			override := overrides[endpoint]
+			apply(&override, value)
+			overrides[endpoint] = override
+		}
+		return nil
+	}
+
+	if err := set("ENDPOINT_REQUEST_TIMEOUTS", func(o *EndpointOverride, seconds int) {
+		timeout := time.Duration(seconds) * time.Second
+		o.RequestTimeout = &timeout
+	}); err != nil {
+		return nil, err
+	}
+	if err := set("ENDPOINT_MAX_RETRIES", func(o *EndpointOverride, retries int) {
+		o.MaxRetries = &retries
+	}); err != nil {
+		return nil, err
+	}
+	if err := set("ENDPOINT_RATE_LIMITS", func(o *EndpointOverride, rpm int) {
+		o.RateLimitRPM = &rpm
+	}); err != nil {
+		return nil, err
+	}
+	if err := set("ENDPOINT_CACHE_TTLS", func(o *EndpointOverride, seconds int) {
+		ttl := time.Duration(seconds) * time.Second
+		o.CacheTTL = &ttl
+	}); err != nil {
+		return nil, err
+	}
+	return overrides, nil
+}
+
+// validateEndpointOverrides checks the per-endpoint settings
+func validateEndpointOverrides(overrides map[string]EndpointOverride) error {
+	for endpoint, override := range overrides {
+		if !strings.HasPrefix(endpoint, "/") {
+			return fmt.Errorf("endpoint overrides: %s must be a path such as /search", endpoint)
+		}
+		if override.RequestTimeout != nil && *override.RequestTimeout < 0 {
+			return fmt.Errorf("ENDPOINT_REQUEST_TIMEOUTS: %s must be >= 0", endpoint)
+		}
+		if override.MaxRetries != nil && *override.MaxRetries < 0 {
+			return fmt.Errorf("ENDPOINT_MAX_RETRIES: %s must be >= 0", endpoint)
+		}
+		if override.RateLimitRPM != nil && *override.RateLimitRPM < 0 {
+			return fmt.Errorf("ENDPOINT_RATE_LIMITS: %s must be >= 0", endpoint)
+		}
+		if override.CacheTTL != nil && *override.CacheTTL < 0 {
+			return fmt.Errorf("ENDPOINT_CACHE_TTLS: %s must be >= 0", endpoint)
+		}
+	}
+	return nil
+}
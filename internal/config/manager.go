@@ -2,12 +2,12 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/joho/godotenv"
 	"github.com/sirupsen/logrus"
 )
 
@@ -16,15 +16,26 @@ type Config struct {
 	// Server Configuration
 	Port string `json:"port"`
 	Host string `json:"host"`
+	// TLSCertFile and TLSKeyFile serve HTTPS directly when both are set
+	TLSCertFile string `json:"tls_cert_file"`
+	TLSKeyFile  string `json:"tls_key_file"`
+	// TLSRedirectPort, if set, serves plain HTTP on this port redirecting to HTTPS
+	TLSRedirectPort string `json:"tls_redirect_port"`
+	// TrustedProxies lists the CIDRs (or IPs) of reverse proxies whose
+	// X-Forwarded-For and X-Real-IP headers are honored
+	TrustedProxies []string `json:"trusted_proxies"`
 
 	// Database Configuration
-	DBHost           string        `json:"db_host"`
-	DBPort           string        `json:"db_port"`
-	DBUsername       string        `json:"db_username"`
-	DBPassword       string        `json:"db_password"`
-	DBName           string        `json:"db_name"`
-	DBMaxOpenConns   int           `json:"db_max_open_conns"`
-	DBMaxIdleConns   int           `json:"db_max_idle_conns"`
+	// DBDriver is mysql, or sqlite to keep the key database in the file at DBPath
+	DBDriver          string        `json:"db_driver"`
+	DBPath            string        `json:"db_path"`
+	DBHost            string        `json:"db_host"`
+	DBPort            string        `json:"db_port"`
+	DBUsername        string        `json:"db_username"`
+	DBPassword        string        `json:"db_password"`
+	DBName            string        `json:"db_name"`
+	DBMaxOpenConns    int           `json:"db_max_open_conns"`
+	DBMaxIdleConns    int           `json:"db_max_idle_conns"`
 	DBConnMaxLifetime time.Duration `json:"db_conn_max_lifetime"`
 
 	// Redis Configuration
@@ -33,28 +44,185 @@ type Config struct {
 	RedisPassword string `json:"redis_password"`
 	RedisDB       int    `json:"redis_db"`
 	RedisPoolSize int    `json:"redis_pool_size"`
+	// RedisUsername authenticates as a Redis ACL user instead of the default user
+	RedisUsername string `json:"redis_username"`
+
+	// Redis TLS
+	// RedisTLSEnabled connects to Redis over TLS, as managed offerings require
+	RedisTLSEnabled bool `json:"redis_tls_enabled"`
+	// RedisTLSCAFile verifies the Redis server against this PEM bundle instead of
+	// the system roots
+	RedisTLSCAFile string `json:"redis_tls_ca_file"`
+	// RedisTLSCertFile and RedisTLSKeyFile present a client certificate
+	RedisTLSCertFile string `json:"redis_tls_cert_file"`
+	RedisTLSKeyFile  string `json:"redis_tls_key_file"`
+	// RedisTLSInsecureSkipVerify accepts any server certificate; for testing only
+	RedisTLSInsecureSkipVerify bool `json:"redis_tls_insecure_skip_verify"`
+
+	// Connection Retry
+	// ConnectRetries is how often connecting to MySQL or Redis at startup is
+	// retried before giving up, so the proxy can start before its services
+	ConnectRetries int `json:"connect_retries"`
+	// ConnectBackoffBase and ConnectBackoffMax bound the exponential wait between
+	// connection attempts
+	ConnectBackoffBase time.Duration `json:"connect_backoff_base"`
+	ConnectBackoffMax  time.Duration `json:"connect_backoff_max"`
+	// DependencyCheckInterval is how often MySQL and Redis are pinged so /health
+	// reports a lost connection and its recovery
+	DependencyCheckInterval time.Duration `json:"dependency_check_interval"`
+
+	// Slow Operation Logging
+	// SlowQueryThreshold logs repository queries taking longer, 0 to disable
+	SlowQueryThreshold time.Duration `json:"slow_query_threshold"`
+	// SlowCacheOpThreshold logs Redis commands taking longer, 0 to disable
+	SlowCacheOpThreshold time.Duration `json:"slow_cache_op_threshold"`
+
+	// Replica Sync
+	// KeySyncEnabled announces key additions, deletions and blacklist changes to
+	// the other replicas over Redis pub/sub so they apply them immediately
+	KeySyncEnabled bool `json:"key_sync_enabled"`
+	// SharedBlacklistEnabled makes the blacklist entries and error counts kept in
+	// Redis authoritative, so a key blacklisted by one replica leaves every rotation
+	SharedBlacklistEnabled bool `json:"shared_blacklist_enabled"`
+	// SharedBlacklistCacheTTL is how long a replica trusts its local copy of the
+	// shared blacklist before reading it from Redis again
+	SharedBlacklistCacheTTL time.Duration `json:"shared_blacklist_cache_ttl"`
+	// SharedCursorEnabled rotates through each pool with a cursor kept in Redis, so
+	// replicas together spread requests evenly instead of each from START_INDEX
+	SharedCursorEnabled bool `json:"shared_cursor_enabled"`
 
 	// Migration Configuration
-	MigrateUp     bool   `json:"migrate_up"`
+	// MigrateUp applies pending migrations on startup
+	MigrateUp bool `json:"migrate_up"`
+	// MigrationPath reads migrations from this directory instead of the ones built
+	// into the binary
 	MigrationPath string `json:"migration_path"`
 
 	// API Keys Configuration (Legacy - now stored in database)
 	KeysFile   string `json:"keys_file"`
 	StartIndex int    `json:"start_index"`
 
+	// Key Source Configuration
+	KeySource                string        `json:"key_source"`
+	KeySourceRefreshInterval time.Duration `json:"key_source_refresh_interval"`
+	TavilyAPIKeys            []string      `json:"-"`
+	VaultAddr                string        `json:"vault_addr"`
+	VaultToken               string        `json:"-"`
+	VaultNamespace           string        `json:"vault_namespace"`
+	VaultKVMount             string        `json:"vault_kv_mount"`
+	VaultKVPath              string        `json:"vault_kv_path"`
+	VaultKeysField           string        `json:"vault_keys_field"`
+	AWSRegion                string        `json:"aws_region"`
+	AWSSecretID              string        `json:"aws_secret_id"`
+	AWSSecretKeysField       string        `json:"aws_secret_keys_field"`
+	AWSAccessKeyID           string        `json:"-"`
+	AWSSecretAccessKey       string        `json:"-"`
+	AWSSessionToken          string        `json:"-"`
+	GCPProjectID             string        `json:"gcp_project_id"`
+	GCPSecretName            string        `json:"gcp_secret_name"`
+	GCPSecretVersion         string        `json:"gcp_secret_version"`
+	GCPSecretKeysField       string        `json:"gcp_secret_keys_field"`
+	GCPAccessToken           string        `json:"-"`
+
+	// DefaultKeyPool serves requests that do not name a pool with X-Tavily-Pool
+	DefaultKeyPool string `json:"default_key_pool"`
+	// MultiTenantEnabled isolates keys, tokens, stats and blacklist state per
+	// tenant, selected by the caller's auth token or the X-Tavily-Tenant header
+	MultiTenantEnabled bool `json:"multi_tenant_enabled"`
+	// ValidateKeysOnImport checks new keys against Tavily /usage before storing them
+	ValidateKeysOnImport bool `json:"validate_keys_on_import"`
+	// MaxUploadSizeMB caps the size of key file uploads (0 = unlimited)
+	MaxUploadSizeMB int `json:"max_upload_size_mb"`
+	// ImportAsyncThreshold runs imports of at least this many keys as background jobs (0 = only on request)
+	ImportAsyncThreshold int `json:"import_async_threshold"`
+	// ImportJobTTL is how long finished import jobs can still be polled
+	ImportJobTTL time.Duration `json:"import_job_ttl"`
+
 	// Load Balancing & Error Handling
-	BlacklistThreshold    int `json:"blacklist_threshold"`
-	MaxRetries            int `json:"max_retries"`
-	MaxConcurrentRequests int `json:"max_concurrent_requests"`
+	BlacklistThreshold       int             `json:"blacklist_threshold"`
+	BlacklistBackoffSteps    []time.Duration `json:"blacklist_backoff_steps"`
+	BlacklistResetSuccesses  int             `json:"blacklist_reset_successes"`
+	CircuitHalfOpenProbes    int             `json:"circuit_half_open_probes"`
+	CircuitHalfOpenSuccesses int             `json:"circuit_half_open_successes"`
+	KeyProbationWindow       time.Duration   `json:"key_probation_window"`
+	KeyProbationTraffic      float64         `json:"key_probation_traffic"`
+	UpstreamBreakerThreshold int             `json:"upstream_breaker_threshold"`
+	UpstreamBreakerMinKeys   int             `json:"upstream_breaker_min_keys"`
+	UpstreamBreakerCooldown  time.Duration   `json:"upstream_breaker_cooldown"`
+	KeyRPMLimit              int             `json:"key_rpm_limit"`
+	MaxRetries               int             `json:"max_retries"`
+	RetryBackoffBase         time.Duration   `json:"retry_backoff_base"`
+	RetryBackoffMax          time.Duration   `json:"retry_backoff_max"`
+	RetryBudgetRatio         float64         `json:"retry_budget_ratio"`
+	RetryBudgetWindow        time.Duration   `json:"retry_budget_window"`
+	RetryBudgetMinRetries    int             `json:"retry_budget_min_retries"`
+	HedgeEnabled             bool            `json:"hedge_enabled"`
+	HedgeEndpoints           []string        `json:"hedge_endpoints"`
+	HedgeDelay               time.Duration   `json:"hedge_delay"`
+	HedgeMinDelay            time.Duration   `json:"hedge_min_delay"`
+	MaxConcurrentRequests    int             `json:"max_concurrent_requests"`
 
 	// Tavily API Configuration
 	TavilyBaseURL   string        `json:"tavily_base_url"`
 	RequestTimeout  time.Duration `json:"request_timeout"`
 	ResponseTimeout time.Duration `json:"response_timeout"`
 	IdleConnTimeout time.Duration `json:"idle_conn_timeout"`
+	// DNSServers replaces the system resolver for upstream connections (ip or ip:port)
+	DNSServers []string `json:"dns_servers"`
+	// DNSCacheTTL caches upstream host lookups for this long (0 = no caching)
+	DNSCacheTTL time.Duration `json:"dns_cache_ttl"`
+	// TavilyPassthroughAllowlist lists the paths reachable through /api/tavily/*
+	TavilyPassthroughAllowlist []string `json:"tavily_passthrough_allowlist"`
+	// MaxRequestBodySizeMB caps proxied request bodies, which are buffered for retries (0 = unlimited)
+	MaxRequestBodySizeMB int `json:"max_request_body_size_mb"`
+	// ValidateRequests checks /search and /extract bodies locally before forwarding them
+	ValidateRequests bool `json:"validate_requests"`
+	// ResponseStripFields are removed from every JSON response and its results
+	ResponseStripFields []string `json:"response_strip_fields"`
+	// ResponseMaxResults truncates the results array of responses (0 = unlimited)
+	ResponseMaxResults int `json:"response_max_results"`
+	// TavilyAuthHeader selects how keys are sent upstream: bearer or x-api-key
+	TavilyAuthHeader string `json:"tavily_auth_header"`
+	// TavilyAuthHeaderOverrides sets the auth header style for individual endpoints
+	TavilyAuthHeaderOverrides map[string]string `json:"tavily_auth_header_overrides"`
+	// EndpointOverrides replaces the request timeout, retries, rate limit and
+	// response cache TTL for individual endpoints; see Endpoint
+	EndpointOverrides map[string]EndpointOverride `json:"endpoint_overrides"`
+
+	// Dry Run
+	// DryRun answers every upstream call from a local simulation instead of Tavily
+	DryRun              bool          `json:"dry_run"`
+	DryRunLatency       time.Duration `json:"dry_run_latency"`
+	DryRunLatencyJitter time.Duration `json:"dry_run_latency_jitter"`
+	DryRunErrorRate     float64       `json:"dry_run_error_rate"`
+	DryRunRateLimitRate float64       `json:"dry_run_rate_limit_rate"`
+	DryRunQuotaRate     float64       `json:"dry_run_quota_rate"`
+
+	// Traffic Shadowing
+	// ShadowBaseURL receives a copy of ShadowPercent percent of proxied requests
+	ShadowBaseURL string  `json:"shadow_base_url"`
+	ShadowPercent float64 `json:"shadow_percent"`
+	// ShadowAPIKey is sent to the shadow target instead of a real Tavily key
+	ShadowAPIKey     string        `json:"-"`
+	ShadowTimeout    time.Duration `json:"shadow_timeout"`
+	ShadowMaxPending int           `json:"shadow_max_pending"`
 
 	// Authentication (Optional)
 	AuthKey string `json:"auth_key,omitempty"`
+	// AuthTokensEnabled accepts the named tokens managed through /api/tokens
+	AuthTokensEnabled bool          `json:"auth_tokens_enabled"`
+	AuthTokenCacheTTL time.Duration `json:"auth_token_cache_ttl"`
+	// JWTIssuer enables SSO-issued JWTs for the management API; signing keys come
+	// from JWTJWKSURL or the issuer's OIDC discovery document
+	JWTIssuer   string `json:"jwt_issuer"`
+	JWTAudience string `json:"jwt_audience"`
+	JWTJWKSURL  string `json:"jwt_jwks_url"`
+	// JWTAdminClaim and JWTAdminValue grant admin scope to tokens whose claim
+	// contains the value; without a claim no JWT caller is an admin
+	JWTAdminClaim string `json:"jwt_admin_claim"`
+	JWTAdminValue string `json:"jwt_admin_value"`
+	// AllowKeyOverride lets clients pin a request to one key with X-Tavily-Use-Key
+	AllowKeyOverride bool `json:"allow_key_override"`
 
 	// CORS Configuration
 	EnableCORS       bool     `json:"enable_cors"`
@@ -72,6 +240,23 @@ type Config struct {
 	LogEnableFile    bool   `json:"log_enable_file"`
 	LogFilePath      string `json:"log_file_path"`
 	LogEnableRequest bool   `json:"log_enable_request"`
+	AccessLogFormat  string `json:"access_log_format"`
+	// AccessLogFile writes access log lines to this file instead of stdout
+	AccessLogFile string `json:"access_log_file"`
+
+	// Tracing
+	// OTLPEndpoint is the OTLP/HTTP collector base URL spans are exported to (empty = tracing off)
+	OTLPEndpoint string `json:"otlp_endpoint"`
+	// OTLPHeaders are sent with every export, e.g. collector credentials
+	OTLPHeaders      map[string]string `json:"-"`
+	OTelServiceName  string            `json:"otel_service_name"`
+	TraceSampleRatio float64           `json:"trace_sample_ratio"`
+
+	// PprofEnabled serves /debug/pprof/* and /debug/vars to admin callers
+	PprofEnabled bool `json:"pprof_enabled"`
+	// SentryDSN reports panics and requests that failed after all retries (empty = off)
+	SentryDSN         string `json:"-"`
+	SentryEnvironment string `json:"sentry_environment"`
 
 	// Server Timeouts
 	ServerReadTimeout             time.Duration `json:"server_read_timeout"`
@@ -84,12 +269,100 @@ type Config struct {
 	UsageUpdateInterval      time.Duration `json:"usage_update_interval"`
 	DefaultSelectionStrategy string        `json:"default_selection_strategy"`
 	AutoStrategyOptimization bool          `json:"auto_strategy_optimization"`
+	LeastUsedWindow          time.Duration `json:"least_used_window"`
+	// PlanResetDay is the day of the month (UTC) plan credits refresh, used when the
+	// usage response carries no reset date
+	PlanResetDay int `json:"plan_reset_day"`
+	// QuotaPreflightEnabled rejects requests with 402 when usage data shows every
+	// key that could serve them out of credits
+	QuotaPreflightEnabled bool `json:"quota_preflight_enabled"`
+	// GlobalDailyBudget and GlobalMonthlyBudget cap the credits the whole deployment
+	// spends per UTC day and month (0 = unlimited); GlobalBudgetMode is warn,
+	// throttle or reject and applies to callers without the priority scope
+	GlobalDailyBudget       int    `json:"global_daily_budget"`
+	GlobalMonthlyBudget     int    `json:"global_monthly_budget"`
+	GlobalBudgetMode        string `json:"global_budget_mode"`
+	GlobalBudgetThrottleRPM int    `json:"global_budget_throttle_rpm"`
+	// QuarantineEnabled holds keys that look revoked or used outside the proxy out
+	// of rotation pending review; QuarantineUsageJump is how many credits a key's
+	// usage may grow beyond what this instance spent between fetches (0 = unchecked)
+	QuarantineEnabled   bool `json:"quarantine_enabled"`
+	QuarantineUsageJump int  `json:"quarantine_usage_jump"`
+	// UsageRollupInterval is how often buffered per-key usage is added to the hourly
+	// rollups, which are summed into daily rollups and kept for UsageHourlyRetention
+	UsageRollupEnabled   bool          `json:"usage_rollup_enabled"`
+	UsageRollupInterval  time.Duration `json:"usage_rollup_interval"`
+	UsageHourlyRetention time.Duration `json:"usage_hourly_retention"`
+
+	// Request Log
+	// RequestLogEnabled stores one row per proxied request for GET /api/requests,
+	// written every RequestLogFlushInterval and kept for RequestLogRetention
+	RequestLogEnabled       bool          `json:"request_log_enabled"`
+	RequestLogFlushInterval time.Duration `json:"request_log_flush_interval"`
+	RequestLogRetention     time.Duration `json:"request_log_retention"`
+
+	// Automatic Strategy Optimization
+	StrategyOptimizationInterval time.Duration `json:"strategy_optimization_interval"`
+	StrategySwitchConfirmations  int           `json:"strategy_switch_confirmations"`
+
+	// Key Health Checks
+	KeyHealthCheckEnabled  bool          `json:"key_health_check_enabled"`
+	KeyHealthCheckInterval time.Duration `json:"key_health_check_interval"`
 
 	// Cache Configuration
 	CacheUsageTTL     time.Duration `json:"cache_usage_ttl"`
 	CacheAnalyticsTTL time.Duration `json:"cache_analytics_ttl"`
 	CacheStatsTTL     time.Duration `json:"cache_stats_ttl"`
 	CacheBlacklistTTL time.Duration `json:"cache_blacklist_ttl"`
+
+	// Response Cache Configuration
+	ResponseCacheEnabled   bool          `json:"response_cache_enabled"`
+	ResponseCacheTTL       time.Duration `json:"response_cache_ttl"`
+	ResponseCacheEndpoints []string      `json:"response_cache_endpoints"`
+	IdempotencyEnabled     bool          `json:"idempotency_enabled"`
+	IdempotencyTTL         time.Duration `json:"idempotency_ttl"`
+
+	// Background Job Configuration
+	JobTTL           time.Duration `json:"job_ttl"`
+	JobMaxConcurrent int           `json:"job_max_concurrent"`
+
+	// Failed Request Capture Configuration
+	EnableFailedRequestCapture bool          `json:"enable_failed_request_capture"`
+	FailedRequestTTL           time.Duration `json:"failed_request_ttl"`
+
+	// Debug Capture Configuration
+	// CapturePercent percent of proxied request/response pairs are written to CaptureDir
+	CapturePercent      float64       `json:"capture_percent"`
+	CaptureDir          string        `json:"capture_dir"`
+	CaptureRetention    time.Duration `json:"capture_retention"`
+	CaptureMaxFiles     int           `json:"capture_max_files"`
+	CaptureMaxBodyBytes int           `json:"capture_max_body_bytes"`
+
+	// Scheduled Reports
+	ReportsEnabled bool     `json:"reports_enabled"`
+	ReportPeriods  []string `json:"report_periods"`
+	ReportTopKeys  int      `json:"report_top_keys"`
+	// ReportWebhookURL receives each new report as JSON; it may embed a token
+	ReportWebhookURL string `json:"-"`
+
+	// Webhooks
+	// WebhookURLs receive key lifecycle events as signed JSON; they may embed a token
+	WebhookURLs   []string `json:"-"`
+	WebhookSecret string   `json:"-"`
+	// WebhookEvents limits the events sent (empty = all)
+	WebhookEvents       []string      `json:"webhook_events"`
+	WebhookMaxAttempts  int           `json:"webhook_max_attempts"`
+	WebhookRetryBackoff time.Duration `json:"webhook_retry_backoff"`
+	// WebhookPoolMinActiveKeys fires pool.low_active_keys when a pool's usable keys
+	// drop below it (0 = off)
+	WebhookPoolMinActiveKeys int `json:"webhook_pool_min_active_keys"`
+
+	// Chat Notifications
+	// SlackWebhookURL and DiscordWebhookURL receive critical alerts; the URLs are secrets
+	SlackWebhookURL   string `json:"-"`
+	DiscordWebhookURL string `json:"-"`
+	// NotifyCooldown is the least time between two alerts about the same condition
+	NotifyCooldown time.Duration `json:"notify_cooldown"`
 }
 
 // Manager handles configuration loading and management
@@ -108,16 +381,22 @@ func NewManager(logger *logrus.Logger) *Manager {
 // Load loads configuration from environment variables and .env file
 func (m *Manager) Load() (*Config, error) {
 	// Load .env file if it exists
-	if err := godotenv.Load(); err != nil {
+	if err := loadDotenv(); err != nil {
 		m.logger.Debug("No .env file found, using environment variables only")
 	}
 
 	config := &Config{
 		// Server Configuration
-		Port: getEnvString("PORT", "3000"),
-		Host: getEnvString("HOST", "0.0.0.0"),
+		Port:            getEnvString("PORT", "3000"),
+		Host:            getEnvString("HOST", "0.0.0.0"),
+		TLSCertFile:     getEnvString("TLS_CERT_FILE", ""),
+		TLSKeyFile:      getEnvString("TLS_KEY_FILE", ""),
+		TLSRedirectPort: getEnvString("TLS_REDIRECT_PORT", ""),
+		TrustedProxies:  getEnvStringSlice("TRUSTED_PROXIES", nil),
 
 		// Database Configuration
+		DBDriver:          getEnvString("DB_DRIVER", "mysql"),
+		DBPath:            getEnvString("DB_PATH", "data/tavily-load.db"),
 		DBHost:            getEnvString("DB_HOST", "localhost"),
 		DBPort:            getEnvString("DB_PORT", "3306"),
 		DBUsername:        getEnvString("DB_USERNAME", "tavily_user"),
@@ -128,38 +407,143 @@ func (m *Manager) Load() (*Config, error) {
 		DBConnMaxLifetime: getEnvDuration("DB_CONN_MAX_LIFETIME", 300*time.Second),
 
 		// Redis Configuration
-		RedisHost:     getEnvString("REDIS_HOST", "localhost"),
+		RedisHost:     getEnvString("REDIS_HOST", ""),
 		RedisPort:     getEnvString("REDIS_PORT", "6379"),
 		RedisPassword: getEnvString("REDIS_PASSWORD", ""),
 		RedisDB:       getEnvInt("REDIS_DB", 0),
 		RedisPoolSize: getEnvInt("REDIS_POOL_SIZE", 10),
+		RedisUsername: getEnvString("REDIS_USERNAME", ""),
+
+		// Redis TLS
+		RedisTLSEnabled:            getEnvBool("REDIS_TLS_ENABLED", false),
+		RedisTLSCAFile:             getEnvString("REDIS_TLS_CA_FILE", ""),
+		RedisTLSCertFile:           getEnvString("REDIS_TLS_CERT_FILE", ""),
+		RedisTLSKeyFile:            getEnvString("REDIS_TLS_KEY_FILE", ""),
+		RedisTLSInsecureSkipVerify: getEnvBool("REDIS_TLS_INSECURE_SKIP_VERIFY", false),
+
+		// Connection Retry
+		ConnectRetries:          getEnvInt("CONNECT_RETRIES", 10),
+		ConnectBackoffBase:      time.Duration(getEnvInt("CONNECT_BACKOFF_BASE_MS", 500)) * time.Millisecond,
+		ConnectBackoffMax:       time.Duration(getEnvInt("CONNECT_BACKOFF_MAX_MS", 10000)) * time.Millisecond,
+		DependencyCheckInterval: getEnvDuration("DEPENDENCY_CHECK_INTERVAL", 10*time.Second),
+
+		// Slow Operation Logging
+		SlowQueryThreshold:   time.Duration(getEnvInt("SLOW_QUERY_THRESHOLD_MS", 0)) * time.Millisecond,
+		SlowCacheOpThreshold: time.Duration(getEnvInt("SLOW_CACHE_OP_THRESHOLD_MS", 0)) * time.Millisecond,
+
+		// Replica Sync
+		KeySyncEnabled:          getEnvBool("KEY_SYNC_ENABLED", true),
+		SharedBlacklistEnabled:  getEnvBool("SHARED_BLACKLIST_ENABLED", true),
+		SharedBlacklistCacheTTL: getEnvDuration("SHARED_BLACKLIST_CACHE_TTL", 5*time.Second),
+		SharedCursorEnabled:     getEnvBool("SHARED_CURSOR_ENABLED", false),
 
 		// Migration Configuration
 		MigrateUp:     getEnvBool("MIGRATE_UP", false),
-		MigrationPath: getEnvString("MIGRATION_PATH", "migrations"),
+		MigrationPath: getEnvString("MIGRATION_PATH", ""),
 
 		// API Keys Configuration (Legacy - now stored in database)
 		KeysFile:   getEnvString("KEYS_FILE", "keys.txt"),
 		StartIndex: getEnvInt("START_INDEX", 0),
 
+		// Key Source Configuration
+		KeySource:                getEnvString("KEY_SOURCE", "database"),
+		KeySourceRefreshInterval: getEnvDuration("KEY_SOURCE_REFRESH_INTERVAL", 60*time.Second),
+		TavilyAPIKeys:            getEnvStringSlice("TAVILY_API_KEYS", nil),
+		VaultAddr:                getEnvString("VAULT_ADDR", ""),
+		VaultToken:               getEnvString("VAULT_TOKEN", ""),
+		VaultNamespace:           getEnvString("VAULT_NAMESPACE", ""),
+		VaultKVMount:             getEnvString("VAULT_KV_MOUNT", "secret"),
+		VaultKVPath:              getEnvString("VAULT_KV_PATH", "tavily-load"),
+		VaultKeysField:           getEnvString("VAULT_KEYS_FIELD", "keys"),
+		AWSRegion:                getEnvString("AWS_REGION", ""),
+		AWSSecretID:              getEnvString("AWS_SECRET_ID", ""),
+		AWSSecretKeysField:       getEnvString("AWS_SECRET_KEYS_FIELD", ""),
+		AWSAccessKeyID:           getEnvString("AWS_ACCESS_KEY_ID", ""),
+		AWSSecretAccessKey:       getEnvString("AWS_SECRET_ACCESS_KEY", ""),
+		AWSSessionToken:          getEnvString("AWS_SESSION_TOKEN", ""),
+		GCPProjectID:             getEnvString("GCP_PROJECT_ID", ""),
+		GCPSecretName:            getEnvString("GCP_SECRET_NAME", ""),
+		GCPSecretVersion:         getEnvString("GCP_SECRET_VERSION", "latest"),
+		GCPSecretKeysField:       getEnvString("GCP_SECRET_KEYS_FIELD", ""),
+		GCPAccessToken:           getEnvString("GCP_ACCESS_TOKEN", ""),
+
+		DefaultKeyPool:       getEnvString("DEFAULT_KEY_POOL", "default"),
+		MultiTenantEnabled:   getEnvBool("MULTI_TENANT_ENABLED", false),
+		ValidateKeysOnImport: getEnvBool("VALIDATE_KEYS_ON_IMPORT", false),
+		MaxUploadSizeMB:      getEnvInt("MAX_UPLOAD_SIZE_MB", 100),
+		ImportAsyncThreshold: getEnvInt("IMPORT_ASYNC_THRESHOLD", 1000),
+		ImportJobTTL:         getEnvDuration("IMPORT_JOB_TTL", 3600*time.Second),
+
 		// Load Balancing & Error Handling
-		BlacklistThreshold:    getEnvInt("BLACKLIST_THRESHOLD", 1),
-		MaxRetries:            getEnvInt("MAX_RETRIES", 3),
-		MaxConcurrentRequests: getEnvInt("MAX_CONCURRENT_REQUESTS", 100),
+		BlacklistThreshold:       getEnvInt("BLACKLIST_THRESHOLD", 1),
+		BlacklistBackoffSteps:    getEnvDurationSlice("BLACKLIST_BACKOFF_STEPS", []time.Duration{time.Minute, 5 * time.Minute, 30 * time.Minute, 2 * time.Hour}),
+		BlacklistResetSuccesses:  getEnvInt("BLACKLIST_RESET_SUCCESSES", 10),
+		CircuitHalfOpenProbes:    getEnvInt("CIRCUIT_HALF_OPEN_PROBES", 1),
+		CircuitHalfOpenSuccesses: getEnvInt("CIRCUIT_HALF_OPEN_SUCCESSES", 3),
+		KeyProbationWindow:       getEnvDuration("KEY_PROBATION_WINDOW", 300*time.Second),
+		KeyProbationTraffic:      getEnvFloat("KEY_PROBATION_TRAFFIC", 0.1),
+		UpstreamBreakerThreshold: getEnvInt("UPSTREAM_BREAKER_THRESHOLD", 5),
+		UpstreamBreakerMinKeys:   getEnvInt("UPSTREAM_BREAKER_MIN_KEYS", 2),
+		UpstreamBreakerCooldown:  getEnvDuration("UPSTREAM_BREAKER_COOLDOWN", 30*time.Second),
+		KeyRPMLimit:              getEnvInt("KEY_RPM_LIMIT", 0),
+		MaxRetries:               getEnvInt("MAX_RETRIES", 3),
+		RetryBackoffBase:         time.Duration(getEnvInt("RETRY_BACKOFF_BASE_MS", 100)) * time.Millisecond,
+		RetryBackoffMax:          time.Duration(getEnvInt("RETRY_BACKOFF_MAX_MS", 2000)) * time.Millisecond,
+		RetryBudgetRatio:         getEnvFloat("RETRY_BUDGET_RATIO", 0.2),
+		RetryBudgetWindow:        getEnvDuration("RETRY_BUDGET_WINDOW", 10*time.Second),
+		RetryBudgetMinRetries:    getEnvInt("RETRY_BUDGET_MIN_RETRIES", 10),
+		HedgeEnabled:             getEnvBool("HEDGE_ENABLED", false),
+		HedgeEndpoints:           getEnvStringSlice("HEDGE_ENDPOINTS", []string{"/search"}),
+		HedgeDelay:               time.Duration(getEnvInt("HEDGE_DELAY_MS", 0)) * time.Millisecond,
+		HedgeMinDelay:            time.Duration(getEnvInt("HEDGE_MIN_DELAY_MS", 200)) * time.Millisecond,
+		MaxConcurrentRequests:    getEnvInt("MAX_CONCURRENT_REQUESTS", 100),
 
 		// Tavily API Configuration
 		TavilyBaseURL:   getEnvString("TAVILY_BASE_URL", "https://api.tavily.com"),
 		RequestTimeout:  getEnvDuration("REQUEST_TIMEOUT", 30*time.Second),
 		ResponseTimeout: getEnvDuration("RESPONSE_TIMEOUT", 30*time.Second),
 		IdleConnTimeout: getEnvDuration("IDLE_CONN_TIMEOUT", 120*time.Second),
+		DNSServers:      getEnvStringSlice("DNS_SERVERS", nil),
+		DNSCacheTTL:     getEnvDuration("DNS_CACHE_TTL", 0),
+		TavilyPassthroughAllowlist: getEnvStringSlice("TAVILY_PASSTHROUGH_ALLOWLIST",
+			[]string{"/search", "/extract", "/crawl", "/map", "/usage"}),
+		MaxRequestBodySizeMB:      getEnvInt("MAX_REQUEST_BODY_SIZE_MB", 10),
+		ValidateRequests:          getEnvBool("VALIDATE_REQUESTS", true),
+		ResponseStripFields:       getEnvStringSlice("RESPONSE_STRIP_FIELDS", nil),
+		ResponseMaxResults:        getEnvInt("RESPONSE_MAX_RESULTS", 0),
+		TavilyAuthHeader:          getEnvString("TAVILY_AUTH_HEADER", "bearer"),
+		TavilyAuthHeaderOverrides: getEnvStringMap("TAVILY_AUTH_HEADER_OVERRIDES"),
+
+		// Dry Run
+		DryRun:              getEnvBool("DRY_RUN", false),
+		DryRunLatency:       time.Duration(getEnvInt("DRY_RUN_LATENCY_MS", 200)) * time.Millisecond,
+		DryRunLatencyJitter: time.Duration(getEnvInt("DRY_RUN_LATENCY_JITTER_MS", 100)) * time.Millisecond,
+		DryRunErrorRate:     getEnvFloat("DRY_RUN_ERROR_RATE", 0.05),
+		DryRunRateLimitRate: getEnvFloat("DRY_RUN_RATE_LIMIT_RATE", 0.02),
+		DryRunQuotaRate:     getEnvFloat("DRY_RUN_QUOTA_RATE", 0.01),
+
+		// Traffic Shadowing
+		ShadowBaseURL:    strings.TrimRight(getEnvString("SHADOW_BASE_URL", ""), "/"),
+		ShadowPercent:    getEnvFloat("SHADOW_PERCENT", 0),
+		ShadowAPIKey:     getEnvString("SHADOW_API_KEY", ""),
+		ShadowTimeout:    getEnvDuration("SHADOW_TIMEOUT", 10*time.Second),
+		ShadowMaxPending: getEnvInt("SHADOW_MAX_PENDING", 100),
 
 		// Authentication (Optional)
-		AuthKey: getEnvString("AUTH_KEY", ""),
+		AuthKey:           getEnvString("AUTH_KEY", ""),
+		AllowKeyOverride:  getEnvBool("ALLOW_KEY_OVERRIDE", true),
+		AuthTokensEnabled: getEnvBool("AUTH_TOKENS_ENABLED", false),
+		AuthTokenCacheTTL: getEnvDuration("AUTH_TOKEN_CACHE_TTL", 30*time.Second),
+		JWTIssuer:         getEnvString("JWT_ISSUER", ""),
+		JWTAudience:       getEnvString("JWT_AUDIENCE", ""),
+		JWTJWKSURL:        getEnvString("JWT_JWKS_URL", ""),
+		JWTAdminClaim:     getEnvString("JWT_ADMIN_CLAIM", ""),
+		JWTAdminValue:     getEnvString("JWT_ADMIN_VALUE", ""),
 
 		// CORS Configuration
 		EnableCORS:       getEnvBool("ENABLE_CORS", true),
 		AllowedOrigins:   getEnvStringSlice("ALLOWED_ORIGINS", []string{"*"}),
-		AllowedMethods:   getEnvStringSlice("ALLOWED_METHODS", []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}),
+		AllowedMethods:   getEnvStringSlice("ALLOWED_METHODS", []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}),
 		AllowedHeaders:   getEnvStringSlice("ALLOWED_HEADERS", []string{"*"}),
 		AllowCredentials: getEnvBool("ALLOW_CREDENTIALS", false),
 
@@ -172,6 +556,19 @@ func (m *Manager) Load() (*Config, error) {
 		LogEnableFile:    getEnvBool("LOG_ENABLE_FILE", false),
 		LogFilePath:      getEnvString("LOG_FILE_PATH", "logs/app.log"),
 		LogEnableRequest: getEnvBool("LOG_ENABLE_REQUEST", true),
+		AccessLogFormat:  getEnvString("ACCESS_LOG_FORMAT", "text"),
+		AccessLogFile:    getEnvString("ACCESS_LOG_FILE", ""),
+
+		// Tracing
+		OTLPEndpoint:     getEnvString("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+		OTLPHeaders:      getEnvStringMap("OTEL_EXPORTER_OTLP_HEADERS"),
+		OTelServiceName:  getEnvString("OTEL_SERVICE_NAME", "tavily-load"),
+		TraceSampleRatio: getEnvFloat("OTEL_TRACES_SAMPLER_ARG", 1.0),
+
+		// Diagnostics
+		PprofEnabled:      getEnvBool("PPROF_ENABLED", false),
+		SentryDSN:         getEnvString("SENTRY_DSN", ""),
+		SentryEnvironment: getEnvString("SENTRY_ENVIRONMENT", ""),
 
 		// Server Timeouts
 		ServerReadTimeout:             getEnvDuration("SERVER_READ_TIMEOUT", 120*time.Second),
@@ -184,12 +581,93 @@ func (m *Manager) Load() (*Config, error) {
 		UsageUpdateInterval:      getEnvDuration("USAGE_UPDATE_INTERVAL", 300*time.Second), // 5 minutes
 		DefaultSelectionStrategy: getEnvString("DEFAULT_SELECTION_STRATEGY", "round_robin"),
 		AutoStrategyOptimization: getEnvBool("AUTO_STRATEGY_OPTIMIZATION", false),
+		LeastUsedWindow:          getEnvDuration("LEAST_USED_WINDOW", 3600*time.Second),
+		PlanResetDay:             getEnvInt("PLAN_RESET_DAY", 1),
+		QuotaPreflightEnabled:    getEnvBool("QUOTA_PREFLIGHT_ENABLED", true),
+		GlobalDailyBudget:        getEnvInt("GLOBAL_DAILY_BUDGET", 0),
+		GlobalMonthlyBudget:      getEnvInt("GLOBAL_MONTHLY_BUDGET", 0),
+		GlobalBudgetMode:         getEnvString("GLOBAL_BUDGET_MODE", "warn"),
+		GlobalBudgetThrottleRPM:  getEnvInt("GLOBAL_BUDGET_THROTTLE_RPM", 10),
+		QuarantineEnabled:        getEnvBool("QUARANTINE_ENABLED", true),
+		QuarantineUsageJump:      getEnvInt("QUARANTINE_USAGE_JUMP", 200),
+		UsageRollupEnabled:       getEnvBool("USAGE_ROLLUP_ENABLED", true),
+		UsageRollupInterval:      getEnvDuration("USAGE_ROLLUP_INTERVAL", 60*time.Second),
+		UsageHourlyRetention:     getEnvDuration("USAGE_HOURLY_RETENTION", 32*24*time.Hour),
+
+		// Request Log
+		RequestLogEnabled:       getEnvBool("REQUEST_LOG_ENABLED", false),
+		RequestLogFlushInterval: getEnvDuration("REQUEST_LOG_FLUSH_INTERVAL", 5*time.Second),
+		RequestLogRetention:     getEnvDuration("REQUEST_LOG_RETENTION", 7*24*time.Hour),
+
+		// Automatic Strategy Optimization
+		StrategyOptimizationInterval: getEnvDuration("STRATEGY_OPTIMIZATION_INTERVAL", 60*time.Second),
+		StrategySwitchConfirmations:  getEnvInt("STRATEGY_SWITCH_CONFIRMATIONS", 3),
+
+		// Key Health Checks
+		KeyHealthCheckEnabled:  getEnvBool("KEY_HEALTH_CHECK_ENABLED", false),
+		KeyHealthCheckInterval: getEnvDuration("KEY_HEALTH_CHECK_INTERVAL", 600*time.Second),
 
 		// Cache Configuration
 		CacheUsageTTL:     getEnvDuration("CACHE_USAGE_TTL", 300*time.Second),
 		CacheAnalyticsTTL: getEnvDuration("CACHE_ANALYTICS_TTL", 600*time.Second),
 		CacheStatsTTL:     getEnvDuration("CACHE_STATS_TTL", 120*time.Second),
 		CacheBlacklistTTL: getEnvDuration("CACHE_BLACKLIST_TTL", 3600*time.Second),
+
+		// Response Cache Configuration
+		ResponseCacheEnabled:   getEnvBool("RESPONSE_CACHE_ENABLED", false),
+		ResponseCacheTTL:       getEnvDuration("RESPONSE_CACHE_TTL", 3600*time.Second),
+		ResponseCacheEndpoints: getEnvStringSlice("RESPONSE_CACHE_ENDPOINTS", []string{"/search", "/extract"}),
+		IdempotencyEnabled:     getEnvBool("IDEMPOTENCY_ENABLED", true),
+		IdempotencyTTL:         getEnvDuration("IDEMPOTENCY_TTL", 3600*time.Second),
+
+		// Background Job Configuration
+		JobTTL:           getEnvDuration("JOB_TTL", 86400*time.Second),
+		JobMaxConcurrent: getEnvInt("JOB_MAX_CONCURRENT", 4),
+
+		// Failed Request Capture Configuration
+		EnableFailedRequestCapture: getEnvBool("ENABLE_FAILED_REQUEST_CAPTURE", false),
+		FailedRequestTTL:           getEnvDuration("FAILED_REQUEST_TTL", 1800*time.Second),
+
+		// Debug Capture Configuration
+		CapturePercent:      getEnvFloat("CAPTURE_PERCENT", 0),
+		CaptureDir:          getEnvString("CAPTURE_DIR", "data/captures"),
+		CaptureRetention:    getEnvDuration("CAPTURE_RETENTION", 86400*time.Second),
+		CaptureMaxFiles:     getEnvInt("CAPTURE_MAX_FILES", 1000),
+		CaptureMaxBodyBytes: getEnvInt("CAPTURE_MAX_BODY_BYTES", 65536),
+
+		// Scheduled Reports
+		ReportsEnabled:   getEnvBool("REPORTS_ENABLED", false),
+		ReportPeriods:    getEnvStringSlice("REPORT_PERIODS", []string{"daily"}),
+		ReportTopKeys:    getEnvInt("REPORT_TOP_KEYS", 10),
+		ReportWebhookURL: getEnvString("REPORT_WEBHOOK_URL", ""),
+
+		// Webhooks
+		WebhookURLs:              getEnvStringSlice("WEBHOOK_URLS", nil),
+		WebhookSecret:            getEnvString("WEBHOOK_SECRET", ""),
+		WebhookEvents:            getEnvStringSlice("WEBHOOK_EVENTS", nil),
+		WebhookMaxAttempts:       getEnvInt("WEBHOOK_MAX_ATTEMPTS", 5),
+		WebhookRetryBackoff:      getEnvDuration("WEBHOOK_RETRY_BACKOFF", 2*time.Second),
+		WebhookPoolMinActiveKeys: getEnvInt("WEBHOOK_POOL_MIN_ACTIVE_KEYS", 1),
+
+		// Chat Notifications
+		SlackWebhookURL:   getEnvString("SLACK_WEBHOOK_URL", ""),
+		DiscordWebhookURL: getEnvString("DISCORD_WEBHOOK_URL", ""),
+		NotifyCooldown:    getEnvDuration("NOTIFY_COOLDOWN", 900*time.Second),
+	}
+
+	overrides, err := loadEndpointOverrides()
+	if err != nil {
+		return nil, fmt.Errorf("configuration validation failed: %w", err)
+	}
+	config.EndpointOverrides = overrides
+
+	if err := config.loadSecretFiles(); err != nil {
+		return nil, fmt.Errorf("configuration validation failed: %w", err)
+	}
+
+	// Keys given in TAVILY_API_KEYS are rotated unless KEY_SOURCE names another source
+	if os.Getenv("KEY_SOURCE") == "" && len(config.TavilyAPIKeys) > 0 {
+		config.KeySource = "env"
 	}
 
 	// Validate configuration
@@ -208,23 +686,138 @@ func (m *Manager) GetConfig() *Config {
 
 // validate validates the configuration
 func (m *Manager) validate(config *Config) error {
+	if (config.TLSCertFile == "") != (config.TLSKeyFile == "") {
+		return fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if config.TLSRedirectPort != "" {
+		if config.TLSCertFile == "" {
+			return fmt.Errorf("TLS_REDIRECT_PORT requires TLS_CERT_FILE and TLS_KEY_FILE")
+		}
+		if config.TLSRedirectPort == config.Port {
+			return fmt.Errorf("TLS_REDIRECT_PORT must differ from PORT")
+		}
+	}
+
 	// Validate database configuration
-	if config.DBHost == "" {
-		return fmt.Errorf("DB_HOST is required")
+	switch config.DBDriver {
+	case "mysql", "sqlite":
+	default:
+		return fmt.Errorf("DB_DRIVER must be one of: mysql, sqlite")
 	}
-	if config.DBUsername == "" {
-		return fmt.Errorf("DB_USERNAME is required")
+	if config.UsesDatabase() && config.DBDriver == "sqlite" {
+		if config.DBPath == "" {
+			return fmt.Errorf("DB_PATH is required when DB_DRIVER is sqlite")
+		}
+	} else if config.UsesDatabase() {
+		if config.DBHost == "" {
+			return fmt.Errorf("DB_HOST is required")
+		}
+		if config.DBUsername == "" {
+			return fmt.Errorf("DB_USERNAME is required")
+		}
+		if config.DBPassword == "" {
+			return fmt.Errorf("DB_PASSWORD is required")
+		}
+		if config.DBName == "" {
+			return fmt.Errorf("DB_NAME is required")
+		}
 	}
-	if config.DBPassword == "" {
-		return fmt.Errorf("DB_PASSWORD is required")
+
+	switch config.KeySource {
+	case "database":
+	case "vault":
+		if config.VaultAddr == "" || config.VaultToken == "" {
+			return fmt.Errorf("VAULT_ADDR and VAULT_TOKEN are required when KEY_SOURCE is vault")
+		}
+		if config.VaultKVPath == "" || config.VaultKeysField == "" {
+			return fmt.Errorf("VAULT_KV_PATH and VAULT_KEYS_FIELD are required when KEY_SOURCE is vault")
+		}
+	case "aws":
+		if config.AWSRegion == "" || config.AWSSecretID == "" {
+			return fmt.Errorf("AWS_REGION and AWS_SECRET_ID are required when KEY_SOURCE is aws")
+		}
+		if config.AWSAccessKeyID == "" || config.AWSSecretAccessKey == "" {
+			return fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required when KEY_SOURCE is aws")
+		}
+	case "gcp":
+		if config.GCPProjectID == "" || config.GCPSecretName == "" {
+			return fmt.Errorf("GCP_PROJECT_ID and GCP_SECRET_NAME are required when KEY_SOURCE is gcp")
+		}
+	case "file":
+		if config.KeysFile == "" {
+			return fmt.Errorf("KEYS_FILE is required when KEY_SOURCE is file")
+		}
+	case "env":
+		if len(config.TavilyAPIKeys) == 0 {
+			return fmt.Errorf("TAVILY_API_KEYS is required when KEY_SOURCE is env")
+		}
+	default:
+		return fmt.Errorf("KEY_SOURCE must be one of: database, vault, aws, gcp, file, env")
+	}
+
+	if config.KeySource != "database" && config.KeySourceRefreshInterval <= 0 {
+		return fmt.Errorf("KEY_SOURCE_REFRESH_INTERVAL must be > 0")
+	}
+	for _, proxy := range config.TrustedProxies {
+		proxy = strings.TrimSpace(proxy)
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			return fmt.Errorf("TRUSTED_PROXIES entries must be CIDRs or IP addresses, got %q", proxy)
+		}
+	}
+
+	for _, server := range config.DNSServers {
+		host := strings.TrimSpace(server)
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if net.ParseIP(host) == nil {
+			return fmt.Errorf("DNS_SERVERS entries must be IP addresses with an optional port, got %q", server)
+		}
+	}
+	if config.DNSCacheTTL < 0 {
+		return fmt.Errorf("DNS_CACHE_TTL must be >= 0")
+	}
+
+	if config.OTLPEndpoint != "" && !strings.HasPrefix(config.OTLPEndpoint, "http://") && !strings.HasPrefix(config.OTLPEndpoint, "https://") {
+		return fmt.Errorf("OTEL_EXPORTER_OTLP_ENDPOINT must be an http(s) URL")
+	}
+	if config.TraceSampleRatio < 0 || config.TraceSampleRatio > 1 {
+		return fmt.Errorf("OTEL_TRACES_SAMPLER_ARG must be between 0 and 1")
+	}
+
+	// Profiles expose memory contents and command lines, so they are never served unauthenticated
+	if config.PprofEnabled && !config.AuthEnabled() {
+		return fmt.Errorf("PPROF_ENABLED requires AUTH_KEY, AUTH_TOKENS_ENABLED or JWT_ISSUER")
+	}
+
+	if config.SentryDSN != "" && ((!strings.HasPrefix(config.SentryDSN, "http://") && !strings.HasPrefix(config.SentryDSN, "https://")) || !strings.Contains(config.SentryDSN, "@")) {
+		return fmt.Errorf("SENTRY_DSN must look like https://<key>@<host>/<project>")
+	}
+
+	// Tenants are stored with the keys, so external key sources cannot carry them
+	if config.MultiTenantEnabled && config.KeySource != "database" {
+		return fmt.Errorf("MULTI_TENANT_ENABLED requires KEY_SOURCE=database")
+	}
+
+	if config.MaxRequestBodySizeMB < 0 {
+		return fmt.Errorf("MAX_REQUEST_BODY_SIZE_MB must be >= 0")
+	}
+
+	if config.ResponseMaxResults < 0 {
+		return fmt.Errorf("RESPONSE_MAX_RESULTS must be >= 0")
 	}
-	if config.DBName == "" {
-		return fmt.Errorf("DB_NAME is required")
+
+	if !validAuthHeaderStyle(config.TavilyAuthHeader) {
+		return fmt.Errorf("TAVILY_AUTH_HEADER must be bearer or x-api-key")
+	}
+	for endpoint, style := range config.TavilyAuthHeaderOverrides {
+		if !validAuthHeaderStyle(style) {
+			return fmt.Errorf("TAVILY_AUTH_HEADER_OVERRIDES: %s must be bearer or x-api-key", endpoint)
+		}
 	}
 
-	// Validate Redis configuration
-	if config.RedisHost == "" {
-		return fmt.Errorf("REDIS_HOST is required")
+	if err := validateEndpointOverrides(config.EndpointOverrides); err != nil {
+		return err
 	}
 
 	// Validate required fields
@@ -237,6 +830,18 @@ func (m *Manager) validate(config *Config) error {
 		return fmt.Errorf("MAX_RETRIES must be >= 0")
 	}
 
+	if config.RetryBackoffBase < 0 || config.RetryBackoffMax < config.RetryBackoffBase {
+		return fmt.Errorf("RETRY_BACKOFF_BASE_MS must be >= 0 and <= RETRY_BACKOFF_MAX_MS")
+	}
+
+	if config.RetryBudgetRatio < 0 || config.RetryBudgetMinRetries < 0 {
+		return fmt.Errorf("RETRY_BUDGET_RATIO and RETRY_BUDGET_MIN_RETRIES must be non-negative")
+	}
+
+	if config.HedgeDelay < 0 || config.HedgeMinDelay < 0 {
+		return fmt.Errorf("HEDGE_DELAY_MS and HEDGE_MIN_DELAY_MS must be non-negative")
+	}
+
 	if config.MaxConcurrentRequests <= 0 {
 		return fmt.Errorf("MAX_CONCURRENT_REQUESTS must be > 0")
 	}
@@ -245,6 +850,63 @@ func (m *Manager) validate(config *Config) error {
 		return fmt.Errorf("BLACKLIST_THRESHOLD must be > 0")
 	}
 
+	if len(config.BlacklistBackoffSteps) == 0 {
+		return fmt.Errorf("BLACKLIST_BACKOFF_STEPS must contain at least one duration")
+	}
+	for _, step := range config.BlacklistBackoffSteps {
+		if step <= 0 {
+			return fmt.Errorf("BLACKLIST_BACKOFF_STEPS durations must be > 0")
+		}
+	}
+
+	if config.BlacklistResetSuccesses <= 0 {
+		return fmt.Errorf("BLACKLIST_RESET_SUCCESSES must be > 0")
+	}
+
+	if config.CircuitHalfOpenProbes <= 0 {
+		return fmt.Errorf("CIRCUIT_HALF_OPEN_PROBES must be > 0")
+	}
+
+	if config.CircuitHalfOpenSuccesses <= 0 {
+		return fmt.Errorf("CIRCUIT_HALF_OPEN_SUCCESSES must be > 0")
+	}
+
+	if config.KeyRPMLimit < 0 {
+		return fmt.Errorf("KEY_RPM_LIMIT must be >= 0")
+	}
+
+	if config.MaxUploadSizeMB < 0 {
+		return fmt.Errorf("MAX_UPLOAD_SIZE_MB must be >= 0")
+	}
+
+	if config.ImportAsyncThreshold < 0 {
+		return fmt.Errorf("IMPORT_ASYNC_THRESHOLD must be >= 0")
+	}
+
+	if config.ImportJobTTL <= 0 {
+		return fmt.Errorf("IMPORT_JOB_TTL must be positive")
+	}
+
+	if config.KeyProbationWindow < 0 {
+		return fmt.Errorf("KEY_PROBATION_WINDOW must be >= 0")
+	}
+
+	if config.KeyProbationTraffic <= 0 || config.KeyProbationTraffic > 1 {
+		return fmt.Errorf("KEY_PROBATION_TRAFFIC must be > 0 and <= 1")
+	}
+
+	if config.UpstreamBreakerThreshold <= 0 {
+		return fmt.Errorf("UPSTREAM_BREAKER_THRESHOLD must be > 0")
+	}
+
+	if config.UpstreamBreakerMinKeys <= 0 {
+		return fmt.Errorf("UPSTREAM_BREAKER_MIN_KEYS must be > 0")
+	}
+
+	if config.UpstreamBreakerCooldown <= 0 {
+		return fmt.Errorf("UPSTREAM_BREAKER_COOLDOWN must be > 0")
+	}
+
 	if config.DBMaxOpenConns <= 0 {
 		return fmt.Errorf("DB_MAX_OPEN_CONNS must be > 0")
 	}
@@ -256,6 +918,207 @@ func (m *Manager) validate(config *Config) error {
 	if config.RedisPoolSize <= 0 {
 		return fmt.Errorf("REDIS_POOL_SIZE must be > 0")
 	}
+	if (config.RedisTLSCertFile == "") != (config.RedisTLSKeyFile == "") {
+		return fmt.Errorf("REDIS_TLS_CERT_FILE and REDIS_TLS_KEY_FILE must be set together")
+	}
+	if !config.RedisTLSEnabled && (config.RedisTLSCAFile != "" || config.RedisTLSCertFile != "") {
+		return fmt.Errorf("REDIS_TLS_ENABLED must be true when REDIS_TLS_CA_FILE or REDIS_TLS_CERT_FILE is set")
+	}
+	if config.ConnectRetries < 0 {
+		return fmt.Errorf("CONNECT_RETRIES must be >= 0")
+	}
+	if config.ConnectBackoffBase <= 0 || config.ConnectBackoffMax < config.ConnectBackoffBase {
+		return fmt.Errorf("CONNECT_BACKOFF_BASE_MS must be > 0 and <= CONNECT_BACKOFF_MAX_MS")
+	}
+	if config.DependencyCheckInterval <= 0 {
+		return fmt.Errorf("DEPENDENCY_CHECK_INTERVAL must be > 0")
+	}
+	if config.SlowQueryThreshold < 0 {
+		return fmt.Errorf("SLOW_QUERY_THRESHOLD_MS must be >= 0")
+	}
+	if config.SlowCacheOpThreshold < 0 {
+		return fmt.Errorf("SLOW_CACHE_OP_THRESHOLD_MS must be >= 0")
+	}
+	if config.SharedBlacklistCacheTTL <= 0 {
+		return fmt.Errorf("SHARED_BLACKLIST_CACHE_TTL must be > 0")
+	}
+
+	if config.AutoStrategyOptimization {
+		if config.StrategyOptimizationInterval <= 0 {
+			return fmt.Errorf("STRATEGY_OPTIMIZATION_INTERVAL must be > 0")
+		}
+		if config.StrategySwitchConfirmations <= 0 {
+			return fmt.Errorf("STRATEGY_SWITCH_CONFIRMATIONS must be > 0")
+		}
+	}
+
+	if config.KeyHealthCheckEnabled && config.KeyHealthCheckInterval <= 0 {
+		return fmt.Errorf("KEY_HEALTH_CHECK_INTERVAL must be > 0")
+	}
+
+	if config.ResponseCacheEnabled && config.ResponseCacheTTL <= 0 {
+		return fmt.Errorf("RESPONSE_CACHE_TTL must be > 0")
+	}
+
+	if config.DryRun {
+		if config.DryRunLatency < 0 || config.DryRunLatencyJitter < 0 {
+			return fmt.Errorf("DRY_RUN_LATENCY_MS and DRY_RUN_LATENCY_JITTER_MS must be non-negative")
+		}
+		rates := config.DryRunErrorRate + config.DryRunRateLimitRate + config.DryRunQuotaRate
+		if config.DryRunErrorRate < 0 || config.DryRunRateLimitRate < 0 || config.DryRunQuotaRate < 0 || rates > 1 {
+			return fmt.Errorf("DRY_RUN_*_RATE values must be non-negative and sum to at most 1")
+		}
+	}
+
+	// Auth tokens are stored in the key database, so without one none could be accepted
+	if config.AuthTokensEnabled && !config.UsesDatabase() {
+		return fmt.Errorf("AUTH_TOKENS_ENABLED requires the key database, which KEY_SOURCE file and env run without")
+	}
+
+	// Shared identity providers sign tokens for many applications; the audience
+	// keeps tokens issued to other applications out
+	if config.JWTIssuer != "" && config.JWTAudience == "" {
+		return fmt.Errorf("JWT_AUDIENCE is required when JWT_ISSUER is set")
+	}
+	if config.JWTAdminClaim != "" && config.JWTAdminValue == "" {
+		return fmt.Errorf("JWT_ADMIN_VALUE is required when JWT_ADMIN_CLAIM is set")
+	}
+
+	if config.ShadowPercent < 0 || config.ShadowPercent > 100 {
+		return fmt.Errorf("SHADOW_PERCENT must be between 0 and 100")
+	}
+
+	if config.IdempotencyEnabled && config.IdempotencyTTL <= 0 {
+		return fmt.Errorf("IDEMPOTENCY_TTL must be > 0")
+	}
+
+	if config.JobTTL <= 0 {
+		return fmt.Errorf("JOB_TTL must be > 0")
+	}
+
+	if config.JobMaxConcurrent <= 0 {
+		return fmt.Errorf("JOB_MAX_CONCURRENT must be > 0")
+	}
+
+	if config.EnableFailedRequestCapture && config.FailedRequestTTL <= 0 {
+		return fmt.Errorf("FAILED_REQUEST_TTL must be > 0")
+	}
+
+	if config.PlanResetDay < 1 || config.PlanResetDay > 28 {
+		return fmt.Errorf("PLAN_RESET_DAY must be between 1 and 28")
+	}
+
+	if config.GlobalDailyBudget < 0 || config.GlobalMonthlyBudget < 0 {
+		return fmt.Errorf("GLOBAL_DAILY_BUDGET and GLOBAL_MONTHLY_BUDGET must be >= 0")
+	}
+	validBudgetModes := []string{"warn", "throttle", "reject"}
+	if !contains(validBudgetModes, config.GlobalBudgetMode) {
+		return fmt.Errorf("GLOBAL_BUDGET_MODE must be one of: %s", strings.Join(validBudgetModes, ", "))
+	}
+	if config.GlobalBudgetMode == "throttle" && config.GlobalBudgetThrottleRPM <= 0 {
+		return fmt.Errorf("GLOBAL_BUDGET_THROTTLE_RPM must be > 0")
+	}
+
+	if config.QuarantineUsageJump < 0 {
+		return fmt.Errorf("QUARANTINE_USAGE_JUMP must be >= 0")
+	}
+
+	if config.UsageRollupEnabled {
+		if config.UsageRollupInterval <= 0 {
+			return fmt.Errorf("USAGE_ROLLUP_INTERVAL must be > 0")
+		}
+		// Every rollup recomputes the day before the latest daily rollup, so its
+		// hours must still be stored
+		if config.UsageHourlyRetention < 2*24*time.Hour {
+			return fmt.Errorf("USAGE_HOURLY_RETENTION must be at least 172800 (2 days)")
+		}
+	}
+
+	if config.RequestLogEnabled {
+		if !config.UsesDatabase() {
+			return fmt.Errorf("REQUEST_LOG_ENABLED requires the key database, which KEY_SOURCE file and env run without")
+		}
+		if config.RequestLogFlushInterval <= 0 {
+			return fmt.Errorf("REQUEST_LOG_FLUSH_INTERVAL must be > 0")
+		}
+		if config.RequestLogRetention <= 0 {
+			return fmt.Errorf("REQUEST_LOG_RETENTION must be > 0")
+		}
+	}
+
+	if config.CapturePercent < 0 || config.CapturePercent > 100 {
+		return fmt.Errorf("CAPTURE_PERCENT must be between 0 and 100")
+	}
+
+	if config.CapturePercent > 0 {
+		if config.CaptureDir == "" {
+			return fmt.Errorf("CAPTURE_DIR is required when CAPTURE_PERCENT is set")
+		}
+		if config.CaptureRetention <= 0 {
+			return fmt.Errorf("CAPTURE_RETENTION must be > 0")
+		}
+		if config.CaptureMaxFiles <= 0 {
+			return fmt.Errorf("CAPTURE_MAX_FILES must be > 0")
+		}
+		if config.CaptureMaxBodyBytes <= 0 {
+			return fmt.Errorf("CAPTURE_MAX_BODY_BYTES must be > 0")
+		}
+	}
+
+	if config.ReportsEnabled {
+		if !config.UsageRollupEnabled {
+			return fmt.Errorf("REPORTS_ENABLED requires USAGE_ROLLUP_ENABLED")
+		}
+		if !config.UsesDatabase() {
+			return fmt.Errorf("REPORTS_ENABLED requires the key database, which KEY_SOURCE file and env run without")
+		}
+		if len(config.ReportPeriods) == 0 {
+			return fmt.Errorf("REPORT_PERIODS must list daily, weekly or both")
+		}
+		for _, period := range config.ReportPeriods {
+			if period != "daily" && period != "weekly" {
+				return fmt.Errorf("REPORT_PERIODS must list daily, weekly or both")
+			}
+		}
+		if config.ReportTopKeys <= 0 {
+			return fmt.Errorf("REPORT_TOP_KEYS must be > 0")
+		}
+	}
+
+	if config.ReportWebhookURL != "" && !strings.HasPrefix(config.ReportWebhookURL, "http://") && !strings.HasPrefix(config.ReportWebhookURL, "https://") {
+		return fmt.Errorf("REPORT_WEBHOOK_URL must be an http or https URL")
+	}
+
+	for _, url := range config.WebhookURLs {
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			return fmt.Errorf("WEBHOOK_URLS must be http or https URLs")
+		}
+	}
+	validWebhookEvents := []string{"key.blacklisted", "key.unblacklisted", "key.exhausted", "pool.low_active_keys", "import.completed"}
+	for _, event := range config.WebhookEvents {
+		if !contains(validWebhookEvents, event) {
+			return fmt.Errorf("WEBHOOK_EVENTS must list events from: %s", strings.Join(validWebhookEvents, ", "))
+		}
+	}
+	if config.WebhookMaxAttempts <= 0 {
+		return fmt.Errorf("WEBHOOK_MAX_ATTEMPTS must be > 0")
+	}
+	if config.WebhookRetryBackoff <= 0 {
+		return fmt.Errorf("WEBHOOK_RETRY_BACKOFF must be > 0")
+	}
+	if config.WebhookPoolMinActiveKeys < 0 {
+		return fmt.Errorf("WEBHOOK_POOL_MIN_ACTIVE_KEYS must be >= 0")
+	}
+
+	if config.SlackWebhookURL != "" && !strings.HasPrefix(config.SlackWebhookURL, "https://") {
+		return fmt.Errorf("SLACK_WEBHOOK_URL must be an https URL")
+	}
+	if config.DiscordWebhookURL != "" && !strings.HasPrefix(config.DiscordWebhookURL, "https://") {
+		return fmt.Errorf("DISCORD_WEBHOOK_URL must be an https URL")
+	}
+	if config.NotifyCooldown < 0 {
+		return fmt.Errorf("NOTIFY_COOLDOWN must be >= 0")
+	}
 
 	// Validate log level
 	validLogLevels := []string{"debug", "info", "warn", "error"}
@@ -269,10 +1132,40 @@ func (m *Manager) validate(config *Config) error {
 		return fmt.Errorf("LOG_FORMAT must be one of: %s", strings.Join(validLogFormats, ", "))
 	}
 
+	// Validate access log format
+	validAccessLogFormats := []string{"text", "json", "combined", "logfmt"}
+	if !contains(validAccessLogFormats, config.AccessLogFormat) {
+		return fmt.Errorf("ACCESS_LOG_FORMAT must be one of: %s", strings.Join(validAccessLogFormats, ", "))
+	}
+	if config.AccessLogFile != "" && config.AccessLogFormat == "text" {
+		return fmt.Errorf("ACCESS_LOG_FILE requires ACCESS_LOG_FORMAT json, combined or logfmt")
+	}
+
 	return nil
 }
 
 // Helper functions for environment variable parsing
+// AuthEnabled reports whether callers must authenticate, with AUTH_KEY, auth
+// tokens or JWTs. Without authentication every caller may use the admin
+// endpoints.
+func (c *Config) AuthEnabled() bool {
+	return c.AuthKey != "" || c.AuthTokensEnabled || c.JWTIssuer != ""
+}
+
+// UsesRedis reports whether Redis is configured. Without REDIS_HOST the cache is
+// kept in process memory, which is neither shared with replicas nor kept across
+// restarts.
+func (c *Config) UsesRedis() bool {
+	return c.RedisHost != ""
+}
+
+// UsesDatabase reports whether the key database is needed. Keys read from
+// KEYS_FILE or TAVILY_API_KEYS run without one, keeping blacklist and statistics
+// in memory and Redis.
+func (c *Config) UsesDatabase() bool {
+	return c.KeySource != "file" && c.KeySource != "env"
+}
+
 func getEnvString(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -289,6 +1182,15 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
 func getEnvBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		if boolValue, err := strconv.ParseBool(value); err == nil {
@@ -307,6 +1209,42 @@ func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
 	return defaultValue
 }
 
+// getEnvDurationSlice parses a comma-separated list of seconds
+func getEnvDurationSlice(key string, defaultValue []time.Duration) []time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var durations []time.Duration
+	for _, part := range strings.Split(value, ",") {
+		seconds, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return defaultValue
+		}
+		durations = append(durations, time.Duration(seconds)*time.Second)
+	}
+	return durations
+}
+
+// validAuthHeaderStyle reports whether style is a supported upstream auth header style
+func validAuthHeaderStyle(style string) bool {
+	return style == "bearer" || style == "x-api-key"
+}
+
+// getEnvStringMap parses comma-separated key=value pairs, such as /usage=x-api-key
+func getEnvStringMap(key string) map[string]string {
+	result := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		result[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return result
+}
+
 func getEnvStringSlice(key string, defaultValue []string) []string {
 	if value := os.Getenv(key); value != "" {
 		return strings.Split(value, ",")
@@ -0,0 +1,137 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// ReloadableSettings are the settings a running proxy takes over on reload. They
+// are read each time they are used, or applied by the reload itself (log level,
+// selection strategy, concurrency limit); every other setting needs a restart.
+// Fields are named as in Config.
+type ReloadableSettings struct {
+	RequestTimeout           time.Duration
+	HedgeDelay               time.Duration
+	MaxRetries               int
+	RetryBackoffBase         time.Duration
+	RetryBackoffMax          time.Duration
+	MaxConcurrentRequests    int
+	KeyRPMLimit              int
+	BlacklistThreshold       int
+	BlacklistResetSuccesses  int
+	ResponseCacheTTL         time.Duration
+	DefaultSelectionStrategy string
+	LogLevel                 string
+	WebhookPoolMinActiveKeys int
+	QuarantineUsageJump      int
+	EndpointOverrides        map[string]EndpointOverride
+}
+
+// reloadableFields names the Config fields in ReloadableSettings
+var reloadableFields = func() map[string]bool {
+	settings := reflect.TypeOf(ReloadableSettings{})
+	fields := make(map[string]bool, settings.NumField())
+	for i := 0; i < settings.NumField(); i++ {
+		fields[settings.Field(i).Name] = true
+	}
+	return fields
+}()
+
+// reloadMu guards the reloadable settings of every Config: Apply writes them
+// while requests read them through Reloadable
+var reloadMu sync.RWMutex
+
+// Reloadable returns the current reloadable settings. Code that runs while the
+// proxy serves reads these settings here rather than from the Config fields,
+// which a reload may be writing.
+func (c *Config) Reloadable() ReloadableSettings {
+	reloadMu.RLock()
+	defer reloadMu.RUnlock()
+
+	return ReloadableSettings{
+		RequestTimeout:           c.RequestTimeout,
+		HedgeDelay:               c.HedgeDelay,
+		MaxRetries:               c.MaxRetries,
+		RetryBackoffBase:         c.RetryBackoffBase,
+		RetryBackoffMax:          c.RetryBackoffMax,
+		MaxConcurrentRequests:    c.MaxConcurrentRequests,
+		KeyRPMLimit:              c.KeyRPMLimit,
+		BlacklistThreshold:       c.BlacklistThreshold,
+		BlacklistResetSuccesses:  c.BlacklistResetSuccesses,
+		ResponseCacheTTL:         c.ResponseCacheTTL,
+		DefaultSelectionStrategy: c.DefaultSelectionStrategy,
+		LogLevel:                 c.LogLevel,
+		WebhookPoolMinActiveKeys: c.WebhookPoolMinActiveKeys,
+		QuarantineUsageJump:      c.QuarantineUsageJump,
+		EndpointOverrides:        c.EndpointOverrides,
+	}
+}
+
+// dotenvKeys are the variables set from the .env file rather than the process
+// environment. A reload may change or unset them; variables of the process
+// environment always take precedence over the file.
+var (
+	dotenvMu   sync.Mutex
+	dotenvKeys = make(map[string]bool)
+)
+
+// loadDotenv sets the variables of the .env file that the process environment
+// does not set, and unsets those an earlier load set but the file no longer has
+func loadDotenv() error {
+	// Without the file, everything an earlier load took from it is unset
+	values, err := godotenv.Read()
+
+	dotenvMu.Lock()
+	defer dotenvMu.Unlock()
+
+	for key := range dotenvKeys {
+		if _, ok := values[key]; !ok {
+			os.Unsetenv(key)
+			delete(dotenvKeys, key)
+		}
+	}
+	for key, value := range values {
+		if _, set := os.LookupEnv(key); set && !dotenvKeys[key] {
+			continue
+		}
+		os.Setenv(key, value)
+		dotenvKeys[key] = true
+	}
+	return err
+}
+
+// Apply copies the reloadable settings of next into c and returns the names of
+// those that changed, along with the names of changed settings that only take
+// effect after a restart. Secrets are named by field, the rest by their JSON name.
+func (c *Config) Apply(next *Config) (changed, restart []string) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	current := reflect.ValueOf(c).Elem()
+	updated := reflect.ValueOf(next).Elem()
+	fields := current.Type()
+
+	for i := 0; i < fields.NumField(); i++ {
+		field := fields.Field(i)
+		if reflect.DeepEqual(current.Field(i).Interface(), updated.Field(i).Interface()) {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			name = field.Name
+		}
+		if !reloadableFields[field.Name] {
+			restart = append(restart, name)
+			continue
+		}
+		current.Field(i).Set(updated.Field(i))
+		changed = append(changed, name)
+	}
+	return changed, restart
+}
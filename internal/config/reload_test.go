@@ -0,0 +1,71 @@
+package config
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReloadableSettingsMatchConfig(t *testing.T) {
+	config := reflect.TypeOf(Config{})
+	settings := reflect.TypeOf(ReloadableSettings{})
+	for i := 0; i < settings.NumField(); i++ {
+		setting := settings.Field(i)
+		field, ok := config.FieldByName(setting.Name)
+		if !ok {
+			t.Errorf("Config has no field %s", setting.Name)
+			continue
+		}
+		if field.Type != setting.Type {
+			t.Errorf("%s is %s in Config but %s in ReloadableSettings", setting.Name, field.Type, setting.Type)
+		}
+	}
+}
+
+func TestApplyReportsChangedAndRestartSettings(t *testing.T) {
+	current := &Config{MaxRetries: 3, Port: "3000"}
+	next := &Config{MaxRetries: 5, Port: "4000"}
+
+	changed, restart := current.Apply(next)
+
+	if !reflect.DeepEqual(changed, []string{"max_retries"}) {
+		t.Errorf("changed = %v, want [max_retries]", changed)
+	}
+	if !reflect.DeepEqual(restart, []string{"port"}) {
+		t.Errorf("restart = %v, want [port]", restart)
+	}
+	if got := current.Reloadable().MaxRetries; got != 5 {
+		t.Errorf("MaxRetries = %d after Apply, want 5", got)
+	}
+	if current.Port != "3000" {
+		t.Errorf("Port = %s after Apply, want it kept until a restart", current.Port)
+	}
+}
+
+// TestApplyWhileServing is meant for go test -race: reloads must not race with
+// requests reading the settings
+func TestApplyWhileServing(t *testing.T) {
+	timeout := 30 * time.Second
+	current := &Config{RequestTimeout: time.Second, MaxRetries: 1}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				current.Endpoint("/search")
+				current.Reloadable()
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		current.Apply(&Config{
+			RequestTimeout:    time.Duration(i) * time.Second,
+			MaxRetries:        i,
+			EndpointOverrides: map[string]EndpointOverride{"/search": {RequestTimeout: &timeout}},
+		})
+	}
+	wg.Wait()
+}
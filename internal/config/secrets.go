@@ -0,0 +1,95 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// secretSetting is a setting that may instead be read from the file named by
+// its <NAME>_FILE variable
+type secretSetting struct {
+	name  string
+	field *string
+}
+
+// secretListSetting is a comma-separated secretSetting. Its file may also hold
+// one value per line.
+type secretListSetting struct {
+	name  string
+	field *[]string
+}
+
+// secretSettings lists the settings of c that hold credentials
+func (c *Config) secretSettings() []secretSetting {
+	return []secretSetting{
+		{"DB_PASSWORD", &c.DBPassword},
+		{"REDIS_PASSWORD", &c.RedisPassword},
+		{"AUTH_KEY", &c.AuthKey},
+		{"VAULT_TOKEN", &c.VaultToken},
+		{"AWS_ACCESS_KEY_ID", &c.AWSAccessKeyID},
+		{"AWS_SECRET_ACCESS_KEY", &c.AWSSecretAccessKey},
+		{"AWS_SESSION_TOKEN", &c.AWSSessionToken},
+		{"GCP_ACCESS_TOKEN", &c.GCPAccessToken},
+		{"SHADOW_API_KEY", &c.ShadowAPIKey},
+		{"SENTRY_DSN", &c.SentryDSN},
+		{"WEBHOOK_SECRET", &c.WebhookSecret},
+		{"REPORT_WEBHOOK_URL", &c.ReportWebhookURL},
+		{"SLACK_WEBHOOK_URL", &c.SlackWebhookURL},
+		{"DISCORD_WEBHOOK_URL", &c.DiscordWebhookURL},
+	}
+}
+
+// secretListSettings lists the comma-separated settings of c that hold credentials
+func (c *Config) secretListSettings() []secretListSetting {
+	return []secretListSetting{
+		{"TAVILY_API_KEYS", &c.TavilyAPIKeys},
+	}
+}
+
+// loadSecretFiles reads the credentials whose <NAME>_FILE variable is set, so
+// Docker and Kubernetes secrets can be mounted rather than passed in the
+// environment. A trailing newline is dropped. Setting both NAME and NAME_FILE
+// is an error, as it is unclear which one is meant.
+func (c *Config) loadSecretFiles() error {
+	for _, secret := range c.secretSettings() {
+		data, ok, err := readSecretFile(secret.name)
+		if err != nil {
+			return err
+		}
+		if ok {
+			*secret.field = strings.TrimRight(data, "\r\n")
+		}
+	}
+
+	for _, secret := range c.secretListSettings() {
+		data, ok, err := readSecretFile(secret.name)
+		if err != nil {
+			return err
+		}
+		if ok {
+			*secret.field = strings.FieldsFunc(data, func(r rune) bool {
+				return r == '\n' || r == '\r' || r == ','
+			})
+		}
+	}
+	return nil
+}
+
+// readSecretFile returns the content of the file named by <name>_FILE, and
+// false when that variable is not set
+func readSecretFile(name string) (string, bool, error) {
+	path := os.Getenv(name + "_FILE")
+	if path == "" {
+		return "", false, nil
+	}
+	if os.Getenv(name) != "" {
+		return "", false, fmt.Errorf("%s and %s_FILE must not both be set", name, name)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("%s_FILE: %w", name, err)
+	}
+	return string(data), true, nil
+}
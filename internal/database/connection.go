@@ -10,6 +10,9 @@ import (
 )
 
 type Config struct {
+	// Driver is DriverMySQL, or DriverSQLite to use the database file at Path
+	Driver   string
+	Path     string
 	Host     string
 	Port     string
 	Username string
@@ -18,14 +21,22 @@ type Config struct {
 	MaxOpenConns int
 	MaxIdleConns int
 	ConnMaxLifetime time.Duration
+
+	// SlowThreshold logs queries taking longer than this; 0 disables the log
+	SlowThreshold time.Duration
 }
 
 type DB struct {
 	*sql.DB
 	config *Config
+	logger *logrus.Logger
 }
 
-func NewConnection(config *Config) (*DB, error) {
+func NewConnection(config *Config, logger *logrus.Logger) (*DB, error) {
+	if config.Driver == DriverSQLite {
+		return newSQLiteConnection(config, logger)
+	}
+
 	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
 		config.Username,
 		config.Password,
@@ -50,16 +61,17 @@ func NewConnection(config *Config) (*DB, error) {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	logrus.Info("Successfully connected to MySQL database")
+	logger.Info("Successfully connected to MySQL database")
 
 	return &DB{
 		DB:     db,
 		config: config,
+		logger: logger,
 	}, nil
 }
 
 func (db *DB) Close() error {
-	logrus.Info("Closing database connection")
+	db.logger.Info("Closing database connection")
 	return db.DB.Close()
 }
 
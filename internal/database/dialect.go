@@ -0,0 +1,121 @@
+package database
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Database drivers, as set in DB_DRIVER
+const (
+	DriverMySQL  = "mysql"
+	DriverSQLite = "sqlite"
+)
+
+// Driver returns the driver of the database, DriverMySQL unless SQLite was
+// configured
+func (db *DB) Driver() string {
+	if db.config != nil && db.config.Driver == DriverSQLite {
+		return DriverSQLite
+	}
+	return DriverMySQL
+}
+
+// The methods below return the SQL that differs between MySQL and SQLite, so
+// repository queries are written once for both.
+
+// Now returns the current time
+func (db *DB) Now() string {
+	if db.Driver() == DriverSQLite {
+		return "CURRENT_TIMESTAMP"
+	}
+	return "NOW()"
+}
+
+// Upsert returns the clause making an INSERT update the row that conflicts with
+// it on the unique key made of columns. Assignments refer to the values the row
+// would have been inserted with through Excluded.
+func (db *DB) Upsert(columns ...string) string {
+	if db.Driver() == DriverSQLite {
+		return "ON CONFLICT (" + strings.Join(columns, ", ") + ") DO UPDATE SET"
+	}
+	return "ON DUPLICATE KEY UPDATE"
+}
+
+// Excluded refers to the value column would have been inserted with, within an
+// Upsert clause
+func (db *DB) Excluded(column string) string {
+	if db.Driver() == DriverSQLite {
+		return "excluded." + column
+	}
+	return "VALUES(" + column + ")"
+}
+
+// ForUpdate returns the clause locking the rows a SELECT reads until the end of
+// its transaction. SQLite transactions hold the write lock from the start, so it
+// needs none.
+func (db *DB) ForUpdate() string {
+	if db.Driver() == DriverSQLite {
+		return ""
+	}
+	return " FOR UPDATE"
+}
+
+// Date truncates the time expr to its day
+func (db *DB) Date(expr string) string {
+	if db.Driver() == DriverSQLite {
+		return "date(" + expr + ")"
+	}
+	return "DATE(" + expr + ")"
+}
+
+// Timestamp converts the date or time expr to a time
+func (db *DB) Timestamp(expr string) string {
+	if db.Driver() == DriverSQLite {
+		return "datetime(" + expr + ")"
+	}
+	return "TIMESTAMP(" + expr + ")"
+}
+
+// DayBefore returns the start of the day before the date expr
+func (db *DB) DayBefore(expr string) string {
+	if db.Driver() == DriverSQLite {
+		return "datetime(" + expr + ", '-1 day')"
+	}
+	return "TIMESTAMP(" + expr + " - INTERVAL 1 DAY)"
+}
+
+// DateCompared returns the date expr in a form comparable with times. MySQL
+// compares dates with times itself; SQLite compares text, so it needs the date
+// as a time at midnight.
+func (db *DB) DateCompared(expr string) string {
+	if db.Driver() == DriverSQLite {
+		return "datetime(" + expr + ")"
+	}
+	return expr
+}
+
+// DeleteOldest returns a statement deleting up to limit rows of table whose
+// column is before a time, oldest first. It takes the time and the limit as
+// arguments. SQLite does not support ORDER BY and LIMIT on DELETE.
+func (db *DB) DeleteOldest(table, column string) string {
+	if db.Driver() == DriverSQLite {
+		return "DELETE FROM " + table + " WHERE rowid IN (SELECT rowid FROM " + table +
+			" WHERE " + column + " < ? ORDER BY " + column + " LIMIT ?)"
+	}
+	return "DELETE FROM " + table + " WHERE " + column + " < ? ORDER BY " + column + " LIMIT ?"
+}
+
+// mysqlDuplicateEntry is the MySQL error number for unique constraint violations
+const mysqlDuplicateEntry = 1062
+
+// IsDuplicate reports whether err is a unique constraint violation. The SQLite
+// driver's error type only exists in cgo builds, so its message is matched.
+func IsDuplicate(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == mysqlDuplicateEntry
+	}
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
@@ -0,0 +1,346 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/golang-migrate/migrate/v4"
+	migratedb "github.com/golang-migrate/migrate/v4/database"
+	migratemysql "github.com/golang-migrate/migrate/v4/database/mysql"
+	migratesqlite "github.com/golang-migrate/migrate/v4/database/sqlite"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/sirupsen/logrus"
+)
+
+// migrationsTable records the applied version, in golang-migrate's layout
+const migrationsTable = "schema_migrations"
+
+// baselineTable is created by the first migration. A database that has it but no
+// applied version was created outside the migrator, such as by MySQL running the
+// SQL files mounted into docker-entrypoint-initdb.d, which older releases did.
+const baselineTable = "api_keys"
+
+// ErrUnversionedSchema is returned by Up for a database whose schema was created
+// without recording a version, which re-running the first migration would break
+var ErrUnversionedSchema = errors.New("the database has tables but no schema version; run `tavily-load migrate force N` with the last migration its schema has, then migrate up")
+
+// Migration is a schema change read from its NNN_name.up.sql file
+type Migration struct {
+	Version uint64 `json:"version"`
+	Name    string `json:"name"`
+}
+
+// MigrationStatus is the schema version of a database and what remains to apply
+type MigrationStatus struct {
+	// Version is the last applied migration, 0 for an empty database
+	Version uint64 `json:"version"`
+	// Dirty means a migration failed part way and the schema needs fixing by hand
+	Dirty bool `json:"dirty"`
+	// Unversioned means the database has tables but no applied version, so its
+	// version must be stamped with Force before migrating
+	Unversioned bool        `json:"unversioned"`
+	Pending     []Migration `json:"pending"`
+}
+
+// Migrator applies the migrations of a source directory with golang-migrate
+type Migrator struct {
+	db      *DB
+	migrate *migrate.Migrate
+	source  source.Driver
+}
+
+// NewMigrator reads the migrations of source, such as the embedded migrations.FS
+// or os.DirFS(MIGRATION_PATH), and opens a connection of its own to the database
+// of db: migration files hold several statements, which the MySQL connections
+// serving requests do not allow. Callers must Close it.
+func NewMigrator(db *DB, migrations fs.FS, logger *logrus.Logger) (*Migrator, error) {
+	src, err := iofs.New(migrations, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	name, driver, err := migrationDriver(db)
+	if err != nil {
+		src.Close()
+		return nil, fmt.Errorf("failed to open migration connection: %w", err)
+	}
+
+	m, err := migrate.NewWithInstance("iofs", src, name, driver)
+	if err != nil {
+		driver.Close()
+		src.Close()
+		return nil, fmt.Errorf("failed to set up migrations: %w", err)
+	}
+	m.Log = migrationLogger{logger}
+
+	// golang-migrate closes the source it was given, so the migrator reads the
+	// migration list from a second one
+	list, err := iofs.New(migrations, ".")
+	if err != nil {
+		m.Close()
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+	return &Migrator{db: db, migrate: m, source: list}, nil
+}
+
+// migrationDriver opens the golang-migrate driver for the database of db and
+// returns it with its name
+func migrationDriver(db *DB) (string, migratedb.Driver, error) {
+	config := db.GetConfig()
+	if db.Driver() == DriverSQLite {
+		conn, err := sql.Open("sqlite", sqliteDSN(config.Path))
+		if err != nil {
+			return "", nil, err
+		}
+		driver, err := migratesqlite.WithInstance(conn, &migratesqlite.Config{
+			MigrationsTable: migrationsTable,
+		})
+		if err != nil {
+			conn.Close()
+			return "", nil, err
+		}
+		return "sqlite", driver, nil
+	}
+
+	dsn := mysql.NewConfig()
+	dsn.User = config.Username
+	dsn.Passwd = config.Password
+	dsn.Net = "tcp"
+	dsn.Addr = config.Host + ":" + config.Port
+	dsn.DBName = config.Database
+	dsn.ParseTime = true
+	dsn.MultiStatements = true
+	dsn.Params = map[string]string{"charset": "utf8mb4"}
+
+	conn, err := sql.Open("mysql", dsn.FormatDSN())
+	if err != nil {
+		return "", nil, err
+	}
+	driver, err := migratemysql.WithInstance(conn, &migratemysql.Config{
+		MigrationsTable: migrationsTable,
+		DatabaseName:    config.Database,
+	})
+	if err != nil {
+		conn.Close()
+		return "", nil, err
+	}
+	return "mysql", driver, nil
+}
+
+// Close closes the migration connection
+func (m *Migrator) Close() error {
+	m.source.Close()
+	sourceErr, dbErr := m.migrate.Close()
+	if sourceErr != nil {
+		return sourceErr
+	}
+	return dbErr
+}
+
+// Status reports the applied version and the migrations not yet applied
+func (m *Migrator) Status(ctx context.Context) (*MigrationStatus, error) {
+	version, dirty, err := m.version()
+	if err != nil {
+		return nil, err
+	}
+
+	all, err := m.migrations()
+	if err != nil {
+		return nil, err
+	}
+	status := &MigrationStatus{Version: version, Dirty: dirty, Pending: []Migration{}}
+	if version == 0 {
+		if status.Unversioned, err = m.hasTable(ctx, baselineTable); err != nil {
+			return nil, err
+		}
+	}
+	for _, migration := range all {
+		if migration.Version > version {
+			status.Pending = append(status.Pending, migration)
+		}
+	}
+	return status, nil
+}
+
+// Up applies every pending migration in order and returns how many were applied
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	before, err := m.clean(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if len(before.Pending) == 0 {
+		return 0, nil
+	}
+	if before.Unversioned {
+		return 0, ErrUnversionedSchema
+	}
+
+	err = m.run(ctx, m.migrate.Up)
+	after, statusErr := m.Status(ctx)
+	if statusErr != nil {
+		return 0, errors.Join(migrationError(err), statusErr)
+	}
+	return len(before.Pending) - len(after.Pending), migrationError(err)
+}
+
+// Down reverts the last steps applied migrations, newest first, and returns how
+// many were reverted
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	before, err := m.clean(ctx)
+	if err != nil {
+		return 0, err
+	}
+	all, err := m.migrations()
+	if err != nil {
+		return 0, err
+	}
+	applied := len(all) - len(before.Pending)
+	if steps > applied {
+		steps = applied
+	}
+	if steps == 0 {
+		return 0, nil
+	}
+
+	err = m.run(ctx, func() error { return m.migrate.Steps(-steps) })
+	after, statusErr := m.Status(ctx)
+	if statusErr != nil {
+		return 0, errors.Join(migrationError(err), statusErr)
+	}
+	return len(after.Pending) - len(before.Pending), migrationError(err)
+}
+
+// Force records version as the applied one without running any migration, and
+// clears the dirty flag. It stamps the version of a schema created outside the
+// migrator, or of one fixed by hand after a migration failed part way; 0 marks
+// the database as having none applied.
+func (m *Migrator) Force(ctx context.Context, version uint64) error {
+	if version == 0 {
+		return migrationError(m.migrate.Force(-1))
+	}
+
+	all, err := m.migrations()
+	if err != nil {
+		return err
+	}
+	for _, migration := range all {
+		if migration.Version == version {
+			return migrationError(m.migrate.Force(int(version)))
+		}
+	}
+	return fmt.Errorf("there is no migration %d", version)
+}
+
+// hasTable reports whether the database has a table called name
+func (m *Migrator) hasTable(ctx context.Context, name string) (bool, error) {
+	query := "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?"
+	if m.db.Driver() == DriverSQLite {
+		query = "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?"
+	}
+
+	var count int
+	if err := m.db.QueryRowContext(ctx, query, name).Scan(&count); err != nil {
+		return false, fmt.Errorf("failed to inspect schema: %w", err)
+	}
+	return count > 0, nil
+}
+
+// clean returns the status, refusing to go on from a failed migration
+func (m *Migrator) clean(ctx context.Context) (*MigrationStatus, error) {
+	status, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if status.Dirty {
+		return nil, fmt.Errorf("migration %d failed part way; fix the schema by hand, then run `tavily-load migrate force N` with the last migration it has", status.Version)
+	}
+	return status, nil
+}
+
+// run calls migrate, asking golang-migrate to stop after the migration in
+// progress once ctx is done
+func (m *Migrator) run(ctx context.Context, migrate func() error) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			m.migrate.GracefulStop <- true
+		case <-done:
+		}
+	}()
+
+	if err := migrate(); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// version reads the applied version, 0 for an empty database
+func (m *Migrator) version() (uint64, bool, error) {
+	version, dirty, err := m.migrate.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return uint64(version), dirty, nil
+}
+
+// migrations lists the migrations of the source ordered by version
+func (m *Migrator) migrations() ([]Migration, error) {
+	var migrations []Migration
+	version, err := m.source.First()
+	for err == nil {
+		migrations = append(migrations, Migration{Version: uint64(version), Name: m.name(version)})
+		version, err = m.source.Next(version)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+	return migrations, nil
+}
+
+// name returns the name of the migration with version, as in NNN_name.up.sql
+func (m *Migrator) name(version uint) string {
+	r, identifier, err := m.source.ReadUp(version)
+	if err != nil {
+		return ""
+	}
+	r.Close()
+	return identifier
+}
+
+// migrationError names the migration a golang-migrate error comes from
+func migrationError(err error) error {
+	var migrationErr migrate.ErrDirty
+	switch {
+	case err == nil, errors.Is(err, migrate.ErrNoChange):
+		return nil
+	case errors.As(err, &migrationErr):
+		return fmt.Errorf("migration %d failed part way; fix the schema by hand, then run `tavily-load migrate force N` with the last migration it has", migrationErr.Version)
+	default:
+		return fmt.Errorf("migration failed: %w", err)
+	}
+}
+
+// migrationLogger writes golang-migrate's progress to the service logger
+type migrationLogger struct {
+	logger *logrus.Logger
+}
+
+func (l migrationLogger) Printf(format string, v ...interface{}) {
+	l.logger.Info(strings.TrimSpace(fmt.Sprintf(format, v...)))
+}
+
+func (l migrationLogger) Verbose() bool {
+	return l.logger.IsLevelEnabled(logrus.DebugLevel)
+}
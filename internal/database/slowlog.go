@@ -0,0 +1,29 @@
+package database
+
+import (
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// logSlowQuery logs a statement that ran longer than the configured threshold.
+// It is deferred with the time the statement started.
+func (db *DB) logSlowQuery(query string, start time.Time) {
+	if db.config == nil || db.config.SlowThreshold <= 0 {
+		return
+	}
+	elapsed := time.Since(start)
+	if elapsed < db.config.SlowThreshold {
+		return
+	}
+
+	query = strings.Join(strings.Fields(query), " ")
+	operation, _, _ := strings.Cut(query, " ")
+	db.logger.WithFields(logrus.Fields{
+		"operation": strings.ToUpper(operation),
+		"query":     query,
+		"duration":  elapsed.String(),
+		"threshold": db.config.SlowThreshold.String(),
+	}).Warn("Slow database query")
+}
@@ -0,0 +1,116 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	_ "modernc.org/sqlite"
+)
+
+// sqliteTimeFormat is how times are stored in SQLite: as UTC text in the format
+// of CURRENT_TIMESTAMP, so stored and computed times compare correctly as text
+const sqliteTimeFormat = "2006-01-02 15:04:05.999999999"
+
+// sqliteScanFormats are the formats computed SQLite times are parsed from
+var sqliteScanFormats = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	sqliteTimeFormat,
+	"2006-01-02",
+}
+
+// sqliteDSN enforces foreign keys, waits for the write lock rather than failing
+// at once, and takes it when a transaction begins so two transactions cannot
+// deadlock upgrading their read locks. Times are read back in UTC, as stored.
+func sqliteDSN(path string) string {
+	return "file:" + path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate"
+}
+
+// newSQLiteConnection opens the database file at config.Path, creating it and
+// its directory if needed. The driver is pure Go, so binaries built without
+// cgo support SQLite too.
+func newSQLiteConnection(config *Config, logger *logrus.Logger) (*DB, error) {
+	if err := os.MkdirAll(filepath.Dir(config.Path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create database directory: %w", err)
+	}
+
+	db, err := sql.Open("sqlite", sqliteDSN(config.Path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	db.SetMaxOpenConns(config.MaxOpenConns)
+	db.SetMaxIdleConns(config.MaxIdleConns)
+	db.SetConnMaxLifetime(config.ConnMaxLifetime)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	logger.WithField("path", config.Path).Info("Successfully opened SQLite database")
+
+	return &DB{
+		DB:     db,
+		config: config,
+		logger: logger,
+	}, nil
+}
+
+// args prepares statement arguments for the driver. SQLite is given times as
+// UTC text in sqliteTimeFormat; the driver would otherwise store them with the
+// offset of their zone, which does not compare correctly with other times.
+func (db *DB) args(args []interface{}) []interface{} {
+	if db.Driver() != DriverSQLite {
+		return args
+	}
+
+	prepared := make([]interface{}, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case time.Time:
+			arg = v.UTC().Format(sqliteTimeFormat)
+		case *time.Time:
+			if v != nil {
+				arg = v.UTC().Format(sqliteTimeFormat)
+			}
+		case sql.NullTime:
+			if v.Valid {
+				arg = v.Time.UTC().Format(sqliteTimeFormat)
+			}
+		}
+		prepared[i] = arg
+	}
+	return prepared
+}
+
+// NullTime scans a time a query computes, such as MAX(day). MySQL returns them
+// as times, but SQLite only converts columns declared as times and returns the
+// others as text.
+type NullTime struct {
+	sql.NullTime
+}
+
+// Scan implements sql.Scanner
+func (t *NullTime) Scan(value interface{}) error {
+	var text string
+	switch v := value.(type) {
+	case string:
+		text = v
+	case []byte:
+		text = string(v)
+	default:
+		return t.NullTime.Scan(value)
+	}
+
+	for _, format := range sqliteScanFormats {
+		if parsed, err := time.ParseInLocation(format, text, time.UTC); err == nil {
+			t.Time, t.Valid = parsed.Local(), true
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot parse %q as a time", text)
+}
@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/tracing"
+)
+
+// The methods below shadow those of the embedded *sql.DB so repository queries
+// made on behalf of a traced request show up as spans, and slow ones are logged.
+// Statements are recorded with their placeholders, never their arguments, so key
+// values stay out of traces and logs.
+
+// ExecContext executes a statement, recording it in the caller's trace
+func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := db.startQuerySpan(ctx, query)
+	defer span.End()
+	defer db.logSlowQuery(query, time.Now())
+
+	result, err := db.DB.ExecContext(ctx, query, db.args(args)...)
+	span.RecordError(err)
+	return result, err
+}
+
+// QueryContext runs a query, recording it in the caller's trace. The span covers
+// the query itself, not the scanning of its rows.
+func (db *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := db.startQuerySpan(ctx, query)
+	defer span.End()
+	defer db.logSlowQuery(query, time.Now())
+
+	rows, err := db.DB.QueryContext(ctx, query, db.args(args)...)
+	span.RecordError(err)
+	return rows, err
+}
+
+// QueryRowContext runs a single-row query, recording it in the caller's trace
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := db.startQuerySpan(ctx, query)
+	defer span.End()
+	defer db.logSlowQuery(query, time.Now())
+
+	row := db.DB.QueryRowContext(ctx, query, db.args(args)...)
+	if err := row.Err(); err != nil && err != sql.ErrNoRows {
+		span.RecordError(err)
+	}
+	return row
+}
+
+// Tx is a transaction on DB. Its statements are given arguments prepared for the
+// driver, as those of DB are.
+type Tx struct {
+	*sql.Tx
+	db *DB
+}
+
+// BeginTx starts a transaction
+func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	tx, err := db.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, db: db}, nil
+}
+
+// ExecContext executes a statement within the transaction
+func (tx *Tx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.ExecContext(ctx, query, tx.db.args(args)...)
+}
+
+// QueryContext runs a query within the transaction
+func (tx *Tx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.Tx.QueryContext(ctx, query, tx.db.args(args)...)
+}
+
+// QueryRowContext runs a single-row query within the transaction
+func (tx *Tx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return tx.Tx.QueryRowContext(ctx, query, tx.db.args(args)...)
+}
+
+// startQuerySpan starts a span for a statement if ctx belongs to a traced request
+func (db *DB) startQuerySpan(ctx context.Context, query string) (context.Context, *tracing.Span) {
+	if !tracing.Enabled() || tracing.FromContext(ctx) == nil {
+		return ctx, nil
+	}
+
+	query = strings.Join(strings.Fields(query), " ")
+	operation, _, _ := strings.Cut(query, " ")
+	operation = strings.ToUpper(operation)
+
+	ctx, span := tracing.Start(ctx, db.Driver()+" "+operation, tracing.KindClient)
+	span.SetAttribute("db.system", db.Driver())
+	span.SetAttribute("db.operation", operation)
+	span.SetAttribute("db.statement", query)
+	return ctx, span
+}
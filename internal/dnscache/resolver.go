@@ -0,0 +1,135 @@
+// Package dnscache resolves upstream hosts with configurable DNS servers and
+// caches the results, so connections to Tavily do not pay a lookup on every
+// dial and keep working through short outages of a flaky resolver.
+package dnscache
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/config"
+)
+
+// dnsTimeout bounds a single query to a configured DNS server
+const dnsTimeout = 5 * time.Second
+
+// Resolver dials hosts using cached lookups
+type Resolver struct {
+	resolver *net.Resolver
+	dialer   *net.Dialer
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+// entry is a cached lookup; addrs outlive expires so a failed refresh can fall back to them
+type entry struct {
+	addrs   []string
+	expires time.Time
+}
+
+// New creates a resolver from DNS_SERVERS and DNS_CACHE_TTL. Without servers the
+// system resolver is used. It returns nil when neither is set and connections
+// should use the default dialer.
+func New(cfg *config.Config) *Resolver {
+	if len(cfg.DNSServers) == 0 && cfg.DNSCacheTTL <= 0 {
+		return nil
+	}
+
+	r := &Resolver{
+		resolver: net.DefaultResolver,
+		dialer:   &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second},
+		ttl:      cfg.DNSCacheTTL,
+		entries:  make(map[string]*entry),
+	}
+
+	servers := make([]string, 0, len(cfg.DNSServers))
+	for _, server := range cfg.DNSServers {
+		server = strings.TrimSpace(server)
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		servers = append(servers, server)
+	}
+
+	if len(servers) > 0 {
+		var next uint64
+		dnsDialer := &net.Dialer{Timeout: dnsTimeout}
+		r.resolver = &net.Resolver{
+			PreferGo: true,
+			// Rotate through the servers so one unreachable server does not fail every lookup
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				server := servers[atomic.AddUint64(&next, 1)%uint64(len(servers))]
+				return dnsDialer.DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	return r
+}
+
+// DialContext connects to addr, resolving its host through the cache. It can be
+// used as http.Transport.DialContext.
+func (r *Resolver) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if net.ParseIP(host) != nil {
+		return r.dialer.DialContext(ctx, network, addr)
+	}
+
+	addrs, err := r.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	// Try each address in turn, like the standard dialer does
+	var lastErr error
+	for _, ip := range addrs {
+		conn, err := r.dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+// lookup returns the addresses of host, from the cache while it is fresh
+func (r *Resolver) lookup(ctx context.Context, host string) ([]string, error) {
+	r.mu.Lock()
+	cached, ok := r.entries[host]
+	r.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.addrs, nil
+	}
+
+	addrs, err := r.resolver.LookupHost(ctx, host)
+	if err == nil && len(addrs) == 0 {
+		err = fmt.Errorf("no addresses found for %s", host)
+	}
+	if err != nil {
+		// A stale answer is better than failing every request while DNS is down
+		if ok {
+			return cached.addrs, nil
+		}
+		return nil, err
+	}
+
+	if r.ttl > 0 {
+		r.mu.Lock()
+		r.entries[host] = &entry{addrs: addrs, expires: time.Now().Add(r.ttl)}
+		r.mu.Unlock()
+	}
+	return addrs, nil
+}
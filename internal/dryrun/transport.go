@@ -0,0 +1,192 @@
+// Package dryrun provides a simulated Tavily upstream. With DRY_RUN=true the proxy's
+// HTTP clients use Transport instead of the network, so key selection, retries,
+// blacklisting and stats can be rehearsed without spending credits.
+package dryrun
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/config"
+)
+
+// simulatedKeyLimit is the credit limit reported for every key by the fake /usage
+const simulatedKeyLimit = 1000
+
+// Transport is an http.RoundTripper that answers Tavily requests locally with
+// configurable latency and failure rates
+type Transport struct {
+	latency       time.Duration
+	jitter        time.Duration
+	errorRate     float64
+	rateLimitRate float64
+	quotaRate     float64
+
+	mu    sync.Mutex
+	usage map[string]int
+}
+
+// NewTransport creates a simulated upstream from the DRY_RUN_* settings
+func NewTransport(cfg *config.Config) *Transport {
+	return &Transport{
+		latency:       cfg.DryRunLatency,
+		jitter:        cfg.DryRunLatencyJitter,
+		errorRate:     cfg.DryRunErrorRate,
+		rateLimitRate: cfg.DryRunRateLimitRate,
+		quotaRate:     cfg.DryRunQuotaRate,
+		usage:         make(map[string]int),
+	}
+}
+
+// RoundTrip simulates a Tavily response to req
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		io.Copy(io.Discard, req.Body)
+		req.Body.Close()
+	}
+
+	delay := t.latency
+	if t.jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(t.jitter) + 1))
+	}
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+
+	key := requestKey(req)
+	if key == "" {
+		return t.respond(req, http.StatusUnauthorized, map[string]interface{}{
+			"detail": map[string]string{"error": "Unauthorized: missing or invalid API key."},
+		}), nil
+	}
+
+	// /usage is never failed, so health checks see the simulated quota
+	path := req.URL.Path
+	if path == "/usage" {
+		return t.respond(req, http.StatusOK, t.usageBody(key)), nil
+	}
+
+	roll := rand.Float64()
+	switch {
+	case roll < t.errorRate:
+		return t.respond(req, http.StatusInternalServerError, map[string]interface{}{
+			"detail": map[string]string{"error": "Simulated upstream error"},
+		}), nil
+	case roll < t.errorRate+t.rateLimitRate:
+		resp := t.respond(req, http.StatusTooManyRequests, map[string]interface{}{
+			"detail": map[string]string{"error": "Simulated rate limit"},
+		})
+		resp.Header.Set("Retry-After", "1")
+		return resp, nil
+	case roll < t.errorRate+t.rateLimitRate+t.quotaRate:
+		return t.respond(req, 432, map[string]interface{}{
+			"detail": map[string]string{"error": "Simulated plan usage limit exceeded"},
+		}), nil
+	}
+
+	t.mu.Lock()
+	t.usage[key]++
+	t.mu.Unlock()
+
+	return t.respond(req, http.StatusOK, successBody(path, delay)), nil
+}
+
+// requestKey extracts the API key from either supported auth header
+func requestKey(req *http.Request) string {
+	if key := req.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	return strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+}
+
+func (t *Transport) usageBody(key string) map[string]interface{} {
+	t.mu.Lock()
+	used := t.usage[key]
+	t.mu.Unlock()
+
+	return map[string]interface{}{
+		"key": map[string]int{"usage": used, "limit": simulatedKeyLimit},
+		"account": map[string]interface{}{
+			"current_plan": "dry-run",
+			"plan_usage":   0,
+			"plan_limit":   0,
+			"paygo_usage":  0,
+			"paygo_limit":  0,
+		},
+	}
+}
+
+// successBody returns a plausible response for the endpoint
+func successBody(path string, delay time.Duration) map[string]interface{} {
+	result := map[string]interface{}{
+		"url":     "https://example.com/dry-run",
+		"title":   "Dry run result",
+		"content": "Simulated content returned in dry-run mode.",
+		"score":   0.5,
+	}
+
+	switch path {
+	case "/extract":
+		return map[string]interface{}{
+			"results": []map[string]interface{}{
+				{"url": result["url"], "raw_content": result["content"]},
+			},
+			"failed_results": []interface{}{},
+			"response_time":  delay.Seconds(),
+		}
+	case "/map":
+		return map[string]interface{}{
+			"base_url":      result["url"],
+			"results":       []string{result["url"].(string)},
+			"response_time": delay.Seconds(),
+		}
+	case "/crawl":
+		return map[string]interface{}{
+			"base_url": result["url"],
+			"results": []map[string]interface{}{
+				{"url": result["url"], "raw_content": result["content"]},
+			},
+			"response_time": delay.Seconds(),
+		}
+	default:
+		return map[string]interface{}{
+			"query":         "dry run",
+			"answer":        nil,
+			"images":        []interface{}{},
+			"results":       []map[string]interface{}{result},
+			"response_time": delay.Seconds(),
+		}
+	}
+}
+
+func (t *Transport) respond(req *http.Request, status int, body interface{}) *http.Response {
+	data, err := json.Marshal(body)
+	if err != nil {
+		data = []byte(fmt.Sprintf(`{"detail":{"error":%q}}`, err.Error()))
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(data)),
+		ContentLength: int64(len(data)),
+		Request:       req,
+	}
+}
@@ -3,6 +3,9 @@ package errors
 import (
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // ErrorType represents the type of error
@@ -38,12 +41,15 @@ type TavilyError struct {
 	Permanent  bool      `json:"permanent"`
 	Retryable  bool      `json:"retryable"`
 	Details    string    `json:"details,omitempty"`
+
+	// RetryAfter is the upstream's requested backoff window, taken from the Retry-After header
+	RetryAfter time.Duration `json:"retry_after,omitempty"`
 }
 
 // Error implements the error interface
 func (e *TavilyError) Error() string {
 	if e.Key != "" {
-		return fmt.Sprintf("[%s] %s (key: %s...)", e.Type, e.Message, e.Key[:8])
+		return fmt.Sprintf("[%s] %s (key: %s...)", e.Type, e.Message, e.Key[:min(len(e.Key), 8)])
 	}
 	return fmt.Sprintf("[%s] %s", e.Type, e.Message)
 }
@@ -54,6 +60,17 @@ func (e *TavilyError) IsPermanent() bool {
 }
 
 // IsRetryable returns true if the request can be retried with a different key
+// IsKeySpecific reports whether the error is caused by the key itself, such as an
+// invalid key or an exhausted quota, so another key can be tried straight away
+func (e *TavilyError) IsKeySpecific() bool {
+	switch e.Type {
+	case ErrorTypeUnauthorized, ErrorTypeInvalidKey, ErrorTypeForbidden, ErrorTypeQuotaExceeded:
+		return true
+	default:
+		return false
+	}
+}
+
 func (e *TavilyError) IsRetryable() bool {
 	return e.Retryable
 }
@@ -97,7 +114,7 @@ func classifyError(errorType ErrorType, statusCode int) (permanent bool, retryab
 }
 
 // ParseHTTPError parses an HTTP response and creates a TavilyError
-func ParseHTTPError(statusCode int, body []byte, key string) *TavilyError {
+func ParseHTTPError(statusCode int, header http.Header, body []byte, key string) *TavilyError {
 	var errorType ErrorType
 	var message string
 
@@ -135,7 +152,36 @@ func ParseHTTPError(statusCode int, body []byte, key string) *TavilyError {
 		message = fmt.Sprintf("%s: %s", message, string(body))
 	}
 
-	return NewTavilyErrorWithKey(errorType, message, statusCode, key)
+	tavilyErr := NewTavilyErrorWithKey(errorType, message, statusCode, key)
+	if statusCode == http.StatusTooManyRequests && header != nil {
+		tavilyErr.RetryAfter = parseRetryAfter(header.Get("Retry-After"), time.Now())
+	}
+
+	return tavilyErr
+}
+
+// parseRetryAfter parses a Retry-After value given either as delay seconds or as an HTTP date.
+// It returns 0 when the value is missing, invalid or already in the past.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds <= 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := date.Sub(now); delay > 0 {
+			return delay.Round(time.Second)
+		}
+	}
+
+	return 0
 }
 
 // IsTemporaryError checks if an error is temporary
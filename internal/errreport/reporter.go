@@ -0,0 +1,248 @@
+// Package errreport sends panics and failed requests to Sentry, or any service
+// that accepts Sentry envelopes (GlitchTip, self-hosted Sentry), so failures are
+// grouped and alerted on instead of only being logged. Reporting is off unless
+// SENTRY_DSN is set; callers then hold a nil *Reporter, on which every method is
+// a no-op.
+package errreport
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// queueSize bounds the events waiting to be sent; later events are dropped
+	queueSize = 100
+	// sendTimeout bounds a single delivery
+	sendTimeout = 10 * time.Second
+	// modulePath marks stack frames that belong to this program
+	modulePath = "github.com/dbccccccc/tavily-load"
+)
+
+// Reporter delivers events to the DSN's project in the background
+type Reporter struct {
+	envelopeURL string
+	dsn         string
+	auth        string
+	environment string
+	serverName  string
+	client      *http.Client
+	logger      *logrus.Logger
+
+	queue   chan []byte
+	pending sync.WaitGroup
+}
+
+// New creates a reporter for SENTRY_DSN, or returns an error if it is malformed
+func New(cfg *config.Config, logger *logrus.Logger) (*Reporter, error) {
+	envelopeURL, publicKey, err := parseDSN(cfg.SentryDSN)
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, _ := os.Hostname()
+	r := &Reporter{
+		envelopeURL: envelopeURL,
+		dsn:         cfg.SentryDSN,
+		auth:        fmt.Sprintf("Sentry sentry_version=7, sentry_client=tavily-load/1.0, sentry_key=%s", publicKey),
+		environment: cfg.SentryEnvironment,
+		serverName:  hostname,
+		client:      &http.Client{Timeout: sendTimeout},
+		logger:      logger,
+		queue:       make(chan []byte, queueSize),
+	}
+	go r.run()
+	return r, nil
+}
+
+// parseDSN turns https://key@host[/path]/project into the project's envelope URL
+func parseDSN(dsn string) (string, string, error) {
+	u, err := url.Parse(dsn)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User == nil {
+		return "", "", fmt.Errorf("invalid Sentry DSN")
+	}
+	path := strings.TrimRight(u.Path, "/")
+	slash := strings.LastIndex(path, "/")
+	project := path[slash+1:]
+	if project == "" || u.User.Username() == "" {
+		return "", "", fmt.Errorf("invalid Sentry DSN: missing public key or project ID")
+	}
+	return fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, path[:slash], project), u.User.Username(), nil
+}
+
+// CapturePanic reports a recovered panic with the stack of the panicking goroutine.
+// Call it from the deferred function that recovered.
+func (r *Reporter) CapturePanic(recovered interface{}, tags map[string]string) {
+	if r == nil {
+		return
+	}
+	r.capture("fatal", map[string]interface{}{
+		"type":       "panic",
+		"value":      fmt.Sprint(recovered),
+		"mechanism":  map[string]interface{}{"type": "recover", "handled": false},
+		"stacktrace": map[string]interface{}{"frames": stackFrames(3)},
+	}, tags)
+}
+
+// CaptureError reports an error that could not be handled, such as a request that
+// failed after all retries
+func (r *Reporter) CaptureError(err error, tags map[string]string) {
+	if r == nil || err == nil {
+		return
+	}
+	r.capture("error", map[string]interface{}{
+		"type":  fmt.Sprintf("%T", err),
+		"value": err.Error(),
+	}, tags)
+}
+
+// Flush waits for queued events to be delivered, giving up when ctx is done
+func (r *Reporter) Flush(ctx context.Context) error {
+	if r == nil {
+		return nil
+	}
+	done := make(chan struct{})
+	go func() {
+		r.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// capture builds an event envelope and queues it without blocking the caller
+func (r *Reporter) capture(level string, exception map[string]interface{}, tags map[string]string) {
+	eventID := newEventID()
+	event := map[string]interface{}{
+		"event_id":    eventID,
+		"timestamp":   time.Now().UTC().Format(time.RFC3339Nano),
+		"platform":    "go",
+		"level":       level,
+		"logger":      "tavily-load",
+		"server_name": r.serverName,
+		"exception":   map[string]interface{}{"values": []interface{}{exception}},
+		"tags":        tags,
+		"contexts": map[string]interface{}{
+			"runtime": map[string]interface{}{"name": "go", "version": runtime.Version()},
+		},
+	}
+	if r.environment != "" {
+		event["environment"] = r.environment
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		r.logger.WithError(err).Warn("Failed to encode error report")
+		return
+	}
+	header, _ := json.Marshal(map[string]interface{}{
+		"event_id": eventID,
+		"dsn":      r.dsn,
+		"sent_at":  time.Now().UTC().Format(time.RFC3339Nano),
+	})
+	itemHeader, _ := json.Marshal(map[string]interface{}{
+		"type":   "event",
+		"length": len(payload),
+	})
+
+	var envelope bytes.Buffer
+	envelope.Write(header)
+	envelope.WriteByte('\n')
+	envelope.Write(itemHeader)
+	envelope.WriteByte('\n')
+	envelope.Write(payload)
+	envelope.WriteByte('\n')
+
+	r.pending.Add(1)
+	select {
+	case r.queue <- envelope.Bytes():
+	default:
+		r.pending.Done()
+		r.logger.Warn("Error report queue full, event dropped")
+	}
+}
+
+// run delivers queued envelopes one at a time
+func (r *Reporter) run() {
+	for envelope := range r.queue {
+		r.send(envelope)
+		r.pending.Done()
+	}
+}
+
+func (r *Reporter) send(envelope []byte) {
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.envelopeURL, bytes.NewReader(envelope))
+	if err != nil {
+		r.logger.WithError(err).Warn("Failed to create error report request")
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", r.auth)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		r.logger.WithError(err).Warn("Failed to send error report")
+		return
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		r.logger.WithField("status", resp.StatusCode).Warn("Error report rejected")
+	}
+}
+
+// stackFrames returns the caller's stack, oldest call first as Sentry expects
+func stackFrames(skip int) []map[string]interface{} {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var stack []map[string]interface{}
+	for {
+		frame, more := frames.Next()
+		stack = append(stack, map[string]interface{}{
+			"function": frame.Function,
+			"abs_path": frame.File,
+			"filename": frame.File,
+			"lineno":   frame.Line,
+			"in_app":   strings.HasPrefix(frame.Function, modulePath),
+		})
+		if !more {
+			break
+		}
+	}
+
+	for i, j := 0, len(stack)-1; i < j; i, j = i+1, j-1 {
+		stack[i], stack[j] = stack[j], stack[i]
+	}
+	return stack
+}
+
+func newEventID() string {
+	var id [16]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
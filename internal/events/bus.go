@@ -0,0 +1,130 @@
+// Package events is the in-process bus for key and request lifecycle events.
+// The key manager and the handler publish what happens to keys and requests once,
+// and the webhook, chat alert and metrics subsystems subscribe to the events they
+// care about instead of each instrumenting the publishers themselves.
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Type names an event
+type Type string
+
+// Key lifecycle events. Event.Key is the API key involved.
+const (
+	KeySelected      Type = "key.selected"
+	KeyBlacklisted   Type = "key.blacklisted"
+	KeyUnblacklisted Type = "key.unblacklisted"
+	KeyExhausted     Type = "key.exhausted"
+	KeyQuarantined   Type = "key.quarantined"
+	KeyReleased      Type = "key.released"
+	UsageUpdated     Type = "usage.updated"
+)
+
+// Pool events. Event.Pool is the pool involved, if any.
+const (
+	PoolLowKeys        Type = "pool.low_active_keys"
+	AllKeysUnavailable Type = "pool.all_keys_unavailable"
+	QuotaExhausted     Type = "pool.quota_exhausted"
+)
+
+// Request and deployment events
+const (
+	RequestSucceeded Type = "request.succeeded"
+	RequestFailed    Type = "request.failed"
+	UpstreamOutage   Type = "upstream.outage"
+	BudgetExceeded   Type = "budget.exceeded"
+	ImportCompleted  Type = "import.completed"
+)
+
+// Auth token events. Event.Data["token_id"] is the ID of the token involved.
+const (
+	TokenChanged Type = "token.changed"
+)
+
+// Event is something that happened to a key, a pool or a request
+type Event struct {
+	Type Type
+	Time time.Time
+	// Key is the API key the event is about, empty for events that concern no single key
+	Key  string
+	Pool string
+	// Data carries the event's details, ready to be encoded as JSON
+	Data map[string]interface{}
+}
+
+// Handler receives published events. Handlers run on the publishing goroutine,
+// often on the request path, so they must return quickly and hand slow work such
+// as network calls to a goroutine or queue of their own.
+type Handler func(Event)
+
+// Bus delivers published events to the handlers subscribed to their type
+type Bus struct {
+	logger *logrus.Logger
+
+	mu       sync.RWMutex
+	handlers map[Type][]Handler
+	all      []Handler
+}
+
+// NewBus creates an empty bus
+func NewBus(logger *logrus.Logger) *Bus {
+	return &Bus{
+		logger:   logger,
+		handlers: make(map[Type][]Handler),
+	}
+}
+
+// Subscribe registers a handler for the given event types, or for every event
+// when no type is given
+func (b *Bus) Subscribe(handler Handler, types ...Type) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(types) == 0 {
+		b.all = append(b.all, handler)
+		return
+	}
+	for _, eventType := range types {
+		b.handlers[eventType] = append(b.handlers[eventType], handler)
+	}
+}
+
+// Publish delivers an event to its subscribers, stamping it with the current time
+// if it has none. A handler that panics is logged and does not affect the others
+// or the publisher.
+func (b *Bus) Publish(event Event) {
+	if b == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.mu.RLock()
+	handlers := b.handlers[event.Type]
+	all := b.all
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		b.deliver(handler, event)
+	}
+	for _, handler := range all {
+		b.deliver(handler, event)
+	}
+}
+
+func (b *Bus) deliver(handler Handler, event Event) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			b.logger.WithField("event", event.Type).
+				WithField("panic", recovered).
+				Error("Event handler panicked")
+		}
+	}()
+	handler(event)
+}
@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/repository"
+)
+
+const (
+	// defaultAuditPerPage and maxAuditPerPage bound the page size of GET /api/audit
+	defaultAuditPerPage = 100
+	maxAuditPerPage     = 1000
+)
+
+// audit records a management change that is not tied to a key in the audit
+// log, for tenant or, when empty, for the whole proxy. Without the key database
+// there is nowhere to keep it; a failure is logged rather than failing a change
+// that has already been made.
+func (h *Handler) audit(ctx context.Context, action, tenant string, before, after interface{}) {
+	if h.keyRepo == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	entry := repository.NewAuditEntry(ctx, action, tenant, before, after)
+	if err := h.keyRepo.AddAuditEntry(ctx, entry); err != nil {
+		h.logger.WithError(err).WithField("action", action).Error("Failed to record audit entry")
+	}
+}
+
+// AuditHandler handles GET /api/audit requests, listing management changes
+// newest first. Optional parameters are actor, action, key (a key ID), from and
+// to (RFC 3339), page and per_page.
+func (h *Handler) AuditHandler(w http.ResponseWriter, r *http.Request) {
+	tenant, status, message := h.requestTenant(r)
+	if status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	query := r.URL.Query()
+	opts := repository.AuditLogOptions{
+		Actor:   query.Get("actor"),
+		Action:  query.Get("action"),
+		Tenant:  tenant,
+		Page:    1,
+		PerPage: defaultAuditPerPage,
+	}
+
+	if value := query.Get("key"); value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid key ID", http.StatusBadRequest)
+			return
+		}
+		opts.KeyID = id
+	}
+	if value := query.Get("from"); value != "" {
+		from, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "from must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		opts.From = from
+	}
+	if value := query.Get("to"); value != "" {
+		to, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "to must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		opts.To = to
+	}
+	if value := query.Get("page"); value != "" {
+		page, err := strconv.Atoi(value)
+		if err != nil || page < 1 {
+			http.Error(w, "Invalid page", http.StatusBadRequest)
+			return
+		}
+		opts.Page = page
+	}
+	if value := query.Get("per_page"); value != "" {
+		perPage, err := strconv.Atoi(value)
+		if err != nil || perPage < 1 || perPage > maxAuditPerPage {
+			http.Error(w, fmt.Sprintf("Invalid per_page: must be between 1 and %d", maxAuditPerPage), http.StatusBadRequest)
+			return
+		}
+		opts.PerPage = perPage
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	entries, total, err := h.keyRepo.ListAuditLog(ctx, opts)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to query audit log")
+		http.Error(w, "Failed to query audit log", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"entries":     entries,
+		"count":       len(entries),
+		"total":       total,
+		"page":        opts.Page,
+		"per_page":    opts.PerPage,
+		"total_pages": (total + opts.PerPage - 1) / opts.PerPage,
+	})
+}
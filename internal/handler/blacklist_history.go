@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/repository"
+	"github.com/dbccccccc/tavily-load/pkg/types"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// defaultBlacklistHistoryRange is the range returned without a from parameter
+	defaultBlacklistHistoryRange = 7 * 24 * time.Hour
+	// defaultBlacklistHistoryLimit and maxBlacklistHistoryLimit bound the entries
+	// one request returns
+	defaultBlacklistHistoryLimit = 500
+	maxBlacklistHistoryLimit     = 5000
+)
+
+// blacklistHistoryEntry renders a history entry, identifying its key with withKey
+// for lists that span several keys
+func blacklistHistoryEntry(entry *repository.BlacklistHistory, withKey bool) map[string]interface{} {
+	rendered := map[string]interface{}{
+		"id":                entry.ID,
+		"blacklisted_at":    entry.BlacklistedAt,
+		"blacklisted_until": entry.BlacklistedUntil,
+		"reason":            entry.Reason,
+		"is_permanent":      entry.IsPermanent,
+		"strike_count":      entry.StrikeCount,
+		"duration_seconds":  entry.DurationSeconds,
+	}
+	if withKey {
+		rendered["key_id"] = entry.KeyID
+		rendered["key_name"] = entry.KeyName
+		rendered["key_preview"] = types.KeyPreview(entry.KeyValue)
+	}
+	return rendered
+}
+
+// KeyBlacklistHistoryHandler handles GET /api/keys/{id}/blacklist-history
+// requests, listing every time the key was blacklisted, newest first
+func (h *Handler) KeyBlacklistHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid key ID", http.StatusBadRequest)
+		return
+	}
+
+	tenant, status, message := h.requestTenant(r)
+	if status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	key, err := h.keyRepo.GetKeyByID(ctx, id)
+	if err != nil || !tenantOwnsKey(tenant, key) {
+		http.Error(w, "Key not found", http.StatusNotFound)
+		return
+	}
+
+	history, err := h.keyRepo.GetBlacklistHistory(ctx, key.KeyValue)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to fetch blacklist history")
+		http.Error(w, "Failed to fetch blacklist history", http.StatusInternalServerError)
+		return
+	}
+
+	entries := make([]map[string]interface{}, len(history))
+	for i, entry := range history {
+		entries[i] = blacklistHistoryEntry(entry, false)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"key_id":      key.ID,
+		"key_name":    key.Name,
+		"key_preview": types.KeyPreview(key.KeyValue),
+		"history":     entries,
+		"count":       len(entries),
+	})
+}
+
+// BlacklistHistoryHandler handles GET /api/blacklist/history requests, listing
+// the blacklistings of all keys between from and to (RFC 3339, defaulting to the
+// last 7 days) newest first, with their number per reason. limit caps the
+// entries listed; the counts cover the whole range.
+func (h *Handler) BlacklistHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	tenant, status, message := h.requestTenant(r)
+	if status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	query := r.URL.Query()
+	opts := repository.BlacklistHistoryOptions{To: time.Now(), Tenant: tenant}
+	if value := query.Get("to"); value != "" {
+		to, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "to must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		opts.To = to
+	}
+	opts.From = opts.To.Add(-defaultBlacklistHistoryRange)
+	if value := query.Get("from"); value != "" {
+		from, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "from must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		opts.From = from
+	}
+	if !opts.From.Before(opts.To) {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultBlacklistHistoryLimit
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxBlacklistHistoryLimit {
+			http.Error(w, fmt.Sprintf("Invalid limit: must be between 1 and %d", maxBlacklistHistoryLimit), http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	history, err := h.keyRepo.ListBlacklistHistory(ctx, opts)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to fetch blacklist history")
+		http.Error(w, "Failed to fetch blacklist history", http.StatusInternalServerError)
+		return
+	}
+
+	byReason := make(map[string]int)
+	keys := make(map[int64]bool)
+	for _, entry := range history {
+		byReason[entry.Reason]++
+		keys[entry.KeyID] = true
+	}
+
+	entries := make([]map[string]interface{}, 0, min(len(history), limit))
+	for _, entry := range history[:min(len(history), limit)] {
+		entries = append(entries, blacklistHistoryEntry(entry, true))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"from":      opts.From,
+		"to":        opts.To,
+		"history":   entries,
+		"count":     len(entries),
+		"total":     len(history),
+		"keys":      len(keys),
+		"by_reason": byReason,
+	})
+}
@@ -0,0 +1,252 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/config"
+	"github.com/dbccccccc/tavily-load/internal/events"
+	"github.com/dbccccccc/tavily-load/internal/middleware"
+	"github.com/dbccccccc/tavily-load/pkg/types"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+// Global budget modes, applied to non-priority traffic once the budget is spent
+const (
+	budgetModeWarn     = "warn"
+	budgetModeThrottle = "throttle"
+	budgetModeReject   = "reject"
+)
+
+// budgetRefreshInterval bounds how stale the totals read from Redis may get, so
+// spending by other instances is noticed without a Redis call on every request
+const budgetRefreshInterval = 5 * time.Second
+
+// globalBudget enforces the deployment-wide daily and monthly credit budgets.
+// Totals are shared through Redis when it is available and counted by this
+// process otherwise.
+type globalBudget struct {
+	daily      int64
+	monthly    int64
+	mode       string
+	usageCache types.UsageCache
+	logger     *logrus.Logger
+	events     *events.Bus
+	throttle   *rate.Limiter
+
+	mu          sync.Mutex
+	day         string
+	month       string
+	dailyUsed   int64
+	monthlyUsed int64
+	refreshed   time.Time
+	warned      map[string]bool // windows whose breach has been logged
+}
+
+// newGlobalBudget returns nil unless a daily or monthly budget is configured
+func newGlobalBudget(cfg *config.Config, usageCache types.UsageCache, bus *events.Bus, logger *logrus.Logger) *globalBudget {
+	if cfg.GlobalDailyBudget <= 0 && cfg.GlobalMonthlyBudget <= 0 {
+		return nil
+	}
+	b := &globalBudget{
+		daily:      int64(cfg.GlobalDailyBudget),
+		monthly:    int64(cfg.GlobalMonthlyBudget),
+		mode:       cfg.GlobalBudgetMode,
+		usageCache: usageCache,
+		logger:     logger,
+		events:     bus,
+		warned:     make(map[string]bool),
+	}
+	if b.mode == budgetModeThrottle {
+		b.throttle = rate.NewLimiter(rate.Limit(float64(cfg.GlobalBudgetThrottleRPM)/60), max(1, cfg.GlobalBudgetThrottleRPM/60))
+	}
+	return b
+}
+
+// record counts credits spent by a successful request. The count is kept even
+// when the client has gone away, so it does not follow ctx's cancellation.
+func (b *globalBudget) record(ctx context.Context, credits int) {
+	if b == nil || credits <= 0 {
+		return
+	}
+
+	if b.usageCache != nil {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 2*time.Second)
+		daily, monthly, err := b.usageCache.AddGlobalCredits(ctx, credits)
+		cancel()
+		if err == nil {
+			b.mu.Lock()
+			b.rollWindow(time.Now())
+			b.dailyUsed, b.monthlyUsed, b.refreshed = daily, monthly, time.Now()
+			b.mu.Unlock()
+			b.warnIfExceeded()
+			return
+		}
+		b.logger.WithError(err).Warn("Failed to record global credits in Redis")
+	}
+
+	b.mu.Lock()
+	b.rollWindow(time.Now())
+	b.dailyUsed += int64(credits)
+	b.monthlyUsed += int64(credits)
+	b.mu.Unlock()
+	b.warnIfExceeded()
+}
+
+// totals returns the credits spent today and this month, re-reading them from
+// Redis once they are older than budgetRefreshInterval
+func (b *globalBudget) totals() (int64, int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.rollWindow(now)
+	if b.usageCache != nil && now.Sub(b.refreshed) > budgetRefreshInterval {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		daily, monthly, err := b.usageCache.GetGlobalCredits(ctx)
+		cancel()
+		if err == nil {
+			b.dailyUsed, b.monthlyUsed = daily, monthly
+		}
+		b.refreshed = now
+	}
+	return b.dailyUsed, b.monthlyUsed
+}
+
+// rollWindow restarts the local totals when the UTC day or month has changed.
+// Callers must hold mu.
+func (b *globalBudget) rollWindow(now time.Time) {
+	now = now.UTC()
+	if day := now.Format("2006-01-02"); b.day != day {
+		b.day, b.dailyUsed, b.refreshed = day, 0, time.Time{}
+	}
+	if month := now.Format("2006-01"); b.month != month {
+		b.month, b.monthlyUsed, b.refreshed = month, 0, time.Time{}
+	}
+}
+
+// exceeded reports whether the daily or monthly budget is spent and, if so, the
+// window that is spent and when it resets
+func (b *globalBudget) exceeded() (string, time.Time) {
+	daily, monthly := b.totals()
+	now := time.Now().UTC()
+	if b.monthly > 0 && monthly >= b.monthly {
+		return now.Format("2006-01"), time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	if b.daily > 0 && daily >= b.daily {
+		return now.Format("2006-01-02"), time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	}
+	return "", time.Time{}
+}
+
+// warnIfExceeded logs the first time each window's budget is spent
+func (b *globalBudget) warnIfExceeded() {
+	window, resetAt := b.exceeded()
+	if window == "" {
+		return
+	}
+
+	b.mu.Lock()
+	warned := b.warned[window]
+	b.warned[window] = true
+	b.mu.Unlock()
+
+	if !warned {
+		b.logger.WithFields(logrus.Fields{
+			"window":   window,
+			"mode":     b.mode,
+			"reset_at": resetAt,
+		}).Warn("Global credit budget exceeded")
+		b.events.Publish(events.Event{
+			Type: events.BudgetExceeded,
+			Data: map[string]interface{}{
+				"window":   window,
+				"mode":     b.mode,
+				"reset_at": resetAt,
+			},
+		})
+	}
+}
+
+// admit applies the budget mode to a request, writing the response when it is
+// turned away. Priority and admin callers are always admitted.
+func (b *globalBudget) admit(w http.ResponseWriter, r *http.Request) bool {
+	if b == nil || b.mode == budgetModeWarn {
+		return true
+	}
+	window, resetAt := b.exceeded()
+	if window == "" {
+		return true
+	}
+	if middleware.HasScope(r, middleware.ScopePriority) || middleware.HasScope(r, middleware.ScopeAdmin) {
+		return true
+	}
+
+	if b.mode == budgetModeThrottle {
+		reservation := b.throttle.Reserve()
+		delay := reservation.Delay()
+		if delay == 0 {
+			return true
+		}
+		reservation.Cancel()
+		w.Header().Set("Retry-After", strconv.Itoa(int(delay.Seconds())+1))
+		http.Error(w, "Global credit budget exceeded, request throttled", http.StatusTooManyRequests)
+		return false
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(resetAt).Seconds())+1))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusPaymentRequired)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":    "budget_exceeded",
+		"message":  "The global credit budget is spent; only priority traffic is served until it resets",
+		"reset_at": resetAt,
+	})
+	return false
+}
+
+// status describes the budgets and spending for /api/budget
+func (b *globalBudget) status() map[string]interface{} {
+	daily, monthly := b.totals()
+	window, resetAt := b.exceeded()
+	status := map[string]interface{}{
+		"enabled":        true,
+		"mode":           b.mode,
+		"daily_budget":   b.daily,
+		"monthly_budget": b.monthly,
+		"daily_used":     daily,
+		"monthly_used":   monthly,
+		"exceeded":       window != "",
+	}
+	if window != "" {
+		status["reset_at"] = resetAt
+	}
+	return status
+}
+
+// BudgetHandler handles GET /api/budget requests, reporting the global credit
+// budget and what has been spent against it
+func (h *Handler) BudgetHandler(w http.ResponseWriter, r *http.Request) {
+	tenant, status, message := h.requestTenant(r)
+	if status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+	if tenant != "" {
+		http.Error(w, "The global budget is not available to tenant-scoped callers", http.StatusForbidden)
+		return
+	}
+
+	response := map[string]interface{}{"enabled": false}
+	if h.budget != nil {
+		response = h.budget.status()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
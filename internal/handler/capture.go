@@ -0,0 +1,416 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/config"
+	"github.com/dbccccccc/tavily-load/internal/keymanager"
+	"github.com/dbccccccc/tavily-load/pkg/types"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// captureQueueSize bounds the captures waiting to be written; later ones are dropped
+	captureQueueSize = 100
+	// capturePruneInterval is how often expired capture files are deleted
+	capturePruneInterval = time.Minute
+	// defaultCaptureListLimit is the number of captures listed without a limit parameter
+	defaultCaptureListLimit = 50
+)
+
+var (
+	// captureIDPattern matches capture IDs, which double as file names
+	captureIDPattern = regexp.MustCompile(`^[0-9]{8}T[0-9]{15}Z-[0-9a-f]{8}$`)
+	// tavilyKeyPattern finds Tavily API keys that clients or Tavily echo in bodies
+	tavilyKeyPattern = regexp.MustCompile(`tvly-[A-Za-z0-9_-]{8,}`)
+	// redactedHeaders carry credentials and are never written to disk
+	redactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-API-Key"}
+)
+
+// captureStore writes a sample of proxied request/response pairs to CAPTURE_DIR
+// as JSON files, one per exchange, so odd Tavily responses can be inspected after
+// the fact. Files are written in the background and deleted once they are older
+// than CAPTURE_RETENTION or beyond the newest CAPTURE_MAX_FILES.
+type captureStore struct {
+	dir          string
+	percent      float64
+	retention    time.Duration
+	maxFiles     int
+	maxBodyBytes int
+	logger       *logrus.Logger
+	queue        chan *types.Capture
+}
+
+func newCaptureStore(cfg *config.Config, logger *logrus.Logger) *captureStore {
+	if cfg.CapturePercent <= 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(cfg.CaptureDir, 0o700); err != nil {
+		logger.WithError(err).WithField("dir", cfg.CaptureDir).Error("Request capture disabled, cannot create capture directory")
+		return nil
+	}
+
+	store := &captureStore{
+		dir:          cfg.CaptureDir,
+		percent:      cfg.CapturePercent,
+		retention:    cfg.CaptureRetention,
+		maxFiles:     cfg.CaptureMaxFiles,
+		maxBodyBytes: cfg.CaptureMaxBodyBytes,
+		logger:       logger,
+		queue:        make(chan *types.Capture, captureQueueSize),
+	}
+	go store.run()
+	return store
+}
+
+// sample reports whether the next request should be captured
+func (s *captureStore) sample() bool {
+	return s != nil && rand.Float64()*100 < s.percent
+}
+
+// save queues a capture for writing without blocking the request
+func (s *captureStore) save(capture *types.Capture) {
+	select {
+	case s.queue <- capture:
+	default:
+		s.logger.WithField("endpoint", capture.Endpoint).Debug("Capture queue full, dropping capture")
+	}
+}
+
+// run writes queued captures and periodically deletes expired ones
+func (s *captureStore) run() {
+	s.prune()
+	ticker := time.NewTicker(capturePruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case capture := <-s.queue:
+			s.write(capture)
+		case <-ticker.C:
+			s.prune()
+		}
+	}
+}
+
+func (s *captureStore) write(capture *types.Capture) {
+	data, err := json.MarshalIndent(capture, "", "  ")
+	if err != nil {
+		s.logger.WithError(err).Warn("Failed to encode capture")
+		return
+	}
+
+	// Write to a temporary name first so readers never see a partial file
+	path := filepath.Join(s.dir, capture.ID+".json")
+	if err := os.WriteFile(path+".tmp", data, 0o600); err != nil {
+		s.logger.WithError(err).Warn("Failed to write capture")
+		return
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		os.Remove(path + ".tmp")
+		s.logger.WithError(err).Warn("Failed to write capture")
+	}
+}
+
+// prune deletes captures older than the retention period and the oldest ones
+// beyond the file limit
+func (s *captureStore) prune() {
+	ids, err := s.ids()
+	if err != nil {
+		s.logger.WithError(err).Warn("Failed to list captures")
+		return
+	}
+
+	cutoff := time.Now().Add(-s.retention)
+	removed := 0
+	for i, id := range ids {
+		// ids are newest first, so everything past maxFiles is surplus
+		expired := i >= s.maxFiles
+		if !expired {
+			info, err := os.Stat(filepath.Join(s.dir, id+".json"))
+			expired = err == nil && info.ModTime().Before(cutoff)
+		}
+		if !expired {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.dir, id+".json")); err == nil {
+			removed++
+		}
+	}
+
+	if removed > 0 {
+		s.logger.WithField("removed", removed).Debug("Pruned expired captures")
+	}
+}
+
+// purge deletes captures written before before and returns how many were deleted
+func (s *captureStore) purge(before time.Time) (int, error) {
+	ids, err := s.ids()
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, id := range ids {
+		path := filepath.Join(s.dir, id+".json")
+		info, err := os.Stat(path)
+		if err != nil || !info.ModTime().Before(before) {
+			continue
+		}
+		if err := os.Remove(path); err == nil {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// ids returns the IDs of stored captures, newest first
+func (s *captureStore) ids() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if ok && !entry.IsDir() && captureIDPattern.MatchString(id) {
+			ids = append(ids, id)
+		}
+	}
+	// IDs start with their UTC timestamp, so they sort chronologically
+	sort.Sort(sort.Reverse(sort.StringSlice(ids)))
+	return ids, nil
+}
+
+// get reads a stored capture
+func (s *captureStore) get(id string) (*types.Capture, error) {
+	if !captureIDPattern.MatchString(id) {
+		return nil, os.ErrNotExist
+	}
+
+	data, err := os.ReadFile(filepath.Join(s.dir, id+".json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var capture types.Capture
+	if err := json.Unmarshal(data, &capture); err != nil {
+		return nil, err
+	}
+	return &capture, nil
+}
+
+// newCaptureID returns a unique ID that sorts by capture time
+func newCaptureID(now time.Time) string {
+	timestamp := strings.Replace(now.UTC().Format("20060102T150405.000000000"), ".", "", 1)
+	return timestamp + "Z-" + uuid.New().String()[:8]
+}
+
+// captureWriter records the status, headers and (up to a limit) body that the
+// client receives, while passing everything through unchanged
+type captureWriter struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+	limit      int
+	truncated  bool
+}
+
+func (w *captureWriter) WriteHeader(statusCode int) {
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *captureWriter) Write(data []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	if room := w.limit - w.body.Len(); room < len(data) {
+		w.body.Write(data[:max(room, 0)])
+		w.truncated = true
+	} else {
+		w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// Flush keeps streamed responses flowing while they are captured
+func (w *captureWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// startCapture decides whether the request is captured and, if so, returns a
+// writer that records the response, or nil otherwise. finishCapture must be
+// called once the response has been written.
+func (h *Handler) startCapture(w http.ResponseWriter) *captureWriter {
+	if !h.captures.sample() {
+		return nil
+	}
+	return &captureWriter{ResponseWriter: w, limit: h.captures.maxBodyBytes}
+}
+
+// finishCapture stores the exchange recorded by a captureWriter, redacting keys
+// and credentials
+func (h *Handler) finishCapture(cw *captureWriter, r *http.Request, req *proxyRequest, reqCtx *types.RequestContext) {
+	now := time.Now()
+	capture := &types.Capture{
+		ID:              newCaptureID(now),
+		RequestID:       reqCtx.RequestID,
+		TraceID:         reqCtx.TraceID,
+		CapturedAt:      now,
+		Method:          req.method,
+		Endpoint:        req.endpoint,
+		Pool:            req.pool,
+		Attempts:        reqCtx.RetryCount + 1,
+		StatusCode:      cw.statusCode,
+		UpstreamStatus:  reqCtx.UpstreamStatus,
+		Duration:        now.Sub(req.startTime),
+		RequestHeaders:  redactHeaders(r.Header),
+		RequestBody:     redactKeys(string(sanitizeRequestBody(req.body))),
+		ResponseHeaders: redactHeaders(cw.Header()),
+		ResponseBody:    redactKeys(cw.body.String()),
+		Truncated:       cw.truncated,
+	}
+	if len(reqCtx.Key) >= 12 {
+		capture.KeyPreview = types.KeyPreview(reqCtx.Key)
+	}
+	h.captures.save(capture)
+}
+
+// redactHeaders copies headers without the ones that carry credentials
+func redactHeaders(header http.Header) map[string][]string {
+	redacted := header.Clone()
+	for _, name := range redactedHeaders {
+		if redacted.Get(name) != "" {
+			redacted.Set(name, "[REDACTED]")
+		}
+	}
+	return redacted
+}
+
+// redactKeys shortens any Tavily API key in text to its usual log preview
+func redactKeys(text string) string {
+	return tavilyKeyPattern.ReplaceAllStringFunc(text, types.KeyPreview)
+}
+
+// captureVisible reports whether a tenant may see a capture
+func captureVisible(tenant string, capture *types.Capture) bool {
+	if tenant == "" {
+		return true
+	}
+	poolTenant, _ := keymanager.SplitTenantPool(capture.Pool)
+	return poolTenant == tenant
+}
+
+// CapturesHandler handles GET /api/debug/captures requests, listing the newest
+// captures without their headers and bodies
+func (h *Handler) CapturesHandler(w http.ResponseWriter, r *http.Request) {
+	if h.captures == nil {
+		http.Error(w, "Request capture is disabled", http.StatusNotFound)
+		return
+	}
+
+	tenant, status, message := h.requestTenant(r)
+	if status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	query := r.URL.Query()
+	limit := defaultCaptureListLimit
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+	statusFilter := 0
+	if value := query.Get("status"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, "status must be an HTTP status code", http.StatusBadRequest)
+			return
+		}
+		statusFilter = parsed
+	}
+	endpoint := query.Get("endpoint")
+
+	ids, err := h.captures.ids()
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list captures")
+		http.Error(w, "Failed to list captures", http.StatusInternalServerError)
+		return
+	}
+
+	summaries := make([]types.Capture, 0, min(limit, len(ids)))
+	for _, id := range ids {
+		if len(summaries) >= limit {
+			break
+		}
+		capture, err := h.captures.get(id)
+		if err != nil {
+			// Pruned or still being written; skip it
+			continue
+		}
+		if !captureVisible(tenant, capture) ||
+			(endpoint != "" && capture.Endpoint != endpoint) ||
+			(statusFilter != 0 && capture.StatusCode != statusFilter) {
+			continue
+		}
+		capture.RequestHeaders = nil
+		capture.RequestBody = ""
+		capture.ResponseHeaders = nil
+		capture.ResponseBody = ""
+		summaries = append(summaries, *capture)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"captures": summaries,
+		"count":    len(summaries),
+		"stored":   len(ids),
+	})
+}
+
+// CaptureHandler handles GET /api/debug/captures/{id} requests
+func (h *Handler) CaptureHandler(w http.ResponseWriter, r *http.Request) {
+	if h.captures == nil {
+		http.Error(w, "Request capture is disabled", http.StatusNotFound)
+		return
+	}
+
+	tenant, status, message := h.requestTenant(r)
+	if status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	capture, err := h.captures.get(mux.Vars(r)["id"])
+	if err != nil || !captureVisible(tenant, capture) {
+		http.Error(w, "Capture not found or expired", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(capture)
+}
@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"net"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/dbccccccc/tavily-load/pkg/types"
+)
+
+// connectionTracker counts the client connections of the HTTP server for /health
+type connectionTracker struct {
+	active int64
+	total  int64
+}
+
+// TrackConnection is the http.Server ConnState hook counting open and accepted
+// connections
+func (h *Handler) TrackConnection(conn net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		atomic.AddInt64(&h.connections.active, 1)
+		atomic.AddInt64(&h.connections.total, 1)
+	case http.StateHijacked, http.StateClosed:
+		atomic.AddInt64(&h.connections.active, -1)
+	}
+}
+
+// connectionHealth returns the connection counters
+func (h *Handler) connectionHealth() types.ConnectionHealth {
+	return types.ConnectionHealth{
+		ActiveConnections: int(atomic.LoadInt64(&h.connections.active)),
+		TotalConnections:  int(atomic.LoadInt64(&h.connections.total)),
+	}
+}
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// PprofHandler serves the net/http/pprof profiles under /debug/pprof/
+func (h *Handler) PprofHandler(w http.ResponseWriter, r *http.Request) {
+	switch strings.TrimPrefix(r.URL.Path, "/debug/pprof/") {
+	case "cmdline":
+		pprof.Cmdline(w, r)
+	case "profile":
+		pprof.Profile(w, r)
+	case "symbol":
+		pprof.Symbol(w, r)
+	case "trace":
+		pprof.Trace(w, r)
+	default:
+		// Index lists the profiles and serves named ones such as heap and goroutine
+		pprof.Index(w, r)
+	}
+}
+
+// DebugVarsHandler handles GET /debug/vars requests with goroutine, heap and GC
+// statistics, in the spirit of expvar
+func (h *Handler) DebugVarsHandler(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	var lastGC interface{}
+	if mem.LastGC > 0 {
+		lastGC = time.Unix(0, int64(mem.LastGC))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"uptime":     time.Since(h.startTime).String(),
+		"go_version": runtime.Version(),
+		"goroutines": runtime.NumGoroutine(),
+		"gomaxprocs": runtime.GOMAXPROCS(0),
+		"num_cpu":    runtime.NumCPU(),
+		"pools":      h.dependencies.PoolStats(),
+		"memory": map[string]interface{}{
+			"sys_bytes":         mem.Sys,
+			"total_alloc_bytes": mem.TotalAlloc,
+			"mallocs":           mem.Mallocs,
+			"frees":             mem.Frees,
+			"stack_inuse_bytes": mem.StackInuse,
+		},
+		"heap": map[string]interface{}{
+			"alloc_bytes":    mem.HeapAlloc,
+			"sys_bytes":      mem.HeapSys,
+			"idle_bytes":     mem.HeapIdle,
+			"inuse_bytes":    mem.HeapInuse,
+			"released_bytes": mem.HeapReleased,
+			"objects":        mem.HeapObjects,
+		},
+		"gc": map[string]interface{}{
+			"num_gc":        mem.NumGC,
+			"num_forced_gc": mem.NumForcedGC,
+			"last_gc":       lastGC,
+			"next_gc_bytes": mem.NextGC,
+			"pause_total":   time.Duration(mem.PauseTotalNs).String(),
+			"last_pause":    time.Duration(mem.PauseNs[(mem.NumGC+255)%256]).String(),
+			"cpu_fraction":  mem.GCCPUFraction,
+		},
+		"memstats": mem,
+	})
+}
@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// Dependency statuses reported by /health
+const (
+	dependencyUp   = "up"
+	dependencyDown = "down"
+)
+
+// dependencyPingTimeout bounds a single health ping
+const dependencyPingTimeout = 3 * time.Second
+
+// dependency is a service pinged by the dependency monitor
+type dependency struct {
+	name string
+	ping func(ctx context.Context) error
+	// recovered runs after the service is reachable again
+	recovered func()
+	// poolStats reports the client's connection pool
+	poolStats func() *types.PoolStats
+}
+
+// dependencyMonitor pings MySQL and Redis every DEPENDENCY_CHECK_INTERVAL so /health
+// reports a lost connection. The clients redial by themselves; the monitor notices
+// when they have and catches up on what was missed meanwhile.
+type dependencyMonitor struct {
+	dependencies []dependency
+	interval     time.Duration
+	logger       *logrus.Logger
+
+	mu     sync.RWMutex
+	health map[string]types.DependencyHealth
+}
+
+func newDependencyMonitor(interval time.Duration, logger *logrus.Logger, dependencies ...dependency) *dependencyMonitor {
+	now := time.Now()
+	health := make(map[string]types.DependencyHealth, len(dependencies))
+	for _, d := range dependencies {
+		health[d.name] = types.DependencyHealth{Status: dependencyUp, Since: now}
+	}
+	return &dependencyMonitor{
+		dependencies: dependencies,
+		interval:     interval,
+		logger:       logger,
+		health:       health,
+	}
+}
+
+// Start pings the dependencies until ctx is cancelled
+func (m *dependencyMonitor) Start(ctx context.Context) {
+	if len(m.dependencies) == 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				for _, d := range m.dependencies {
+					m.check(ctx, d)
+				}
+			}
+		}
+	}()
+}
+
+// check pings a dependency and records a change of status
+func (m *dependencyMonitor) check(ctx context.Context, d dependency) {
+	pingCtx, cancel := context.WithTimeout(ctx, dependencyPingTimeout)
+	err := d.ping(pingCtx)
+	cancel()
+	if ctx.Err() != nil {
+		return
+	}
+
+	status := dependencyUp
+	if err != nil {
+		status = dependencyDown
+	}
+
+	m.mu.Lock()
+	previous := m.health[d.name]
+	current := previous
+	if status != previous.Status {
+		current = types.DependencyHealth{Status: status, Since: time.Now()}
+	}
+	current.LastError = ""
+	if err != nil {
+		current.LastError = err.Error()
+	}
+	m.health[d.name] = current
+	m.mu.Unlock()
+
+	switch {
+	case status == previous.Status:
+	case err != nil:
+		m.logger.WithError(err).WithField("service", d.name).Error("Lost connection, serving in degraded mode")
+	default:
+		m.logger.WithFields(logrus.Fields{
+			"service":  d.name,
+			"downtime": time.Since(previous.Since).Round(time.Second).String(),
+		}).Info("Connection restored")
+		if d.recovered != nil {
+			d.recovered()
+		}
+	}
+}
+
+// Snapshot returns the current status and connection pool of every dependency,
+// or nil when none is monitored
+func (m *dependencyMonitor) Snapshot() map[string]types.DependencyHealth {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(m.health) == 0 {
+		return nil
+	}
+	health := make(map[string]types.DependencyHealth, len(m.health))
+	for name, h := range m.health {
+		health[name] = h
+	}
+	for _, d := range m.dependencies {
+		if h, ok := health[d.name]; ok && d.poolStats != nil {
+			h.Pool = d.poolStats()
+			health[d.name] = h
+		}
+	}
+	return health
+}
+
+// PoolStats returns the connection pool of every dependency that has one
+func (m *dependencyMonitor) PoolStats() map[string]*types.PoolStats {
+	pools := make(map[string]*types.PoolStats)
+	for _, d := range m.dependencies {
+		if d.poolStats == nil {
+			continue
+		}
+		if stats := d.poolStats(); stats != nil {
+			pools[d.name] = stats
+		}
+	}
+	return pools
+}
+
+// Degraded reports whether any dependency is unreachable
+func (m *dependencyMonitor) Degraded() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, h := range m.health {
+		if h.Status == dependencyDown {
+			return true
+		}
+	}
+	return false
+}
+
+// monitorDependencies watches the key database and a shared Redis cache. Once
+// the database is back the pool is reloaded, since key changes announced while it
+// was unreachable may have been missed.
+func (h *Handler) monitorDependencies() *dependencyMonitor {
+	var dependencies []dependency
+	if h.keyRepo != nil {
+		dependencies = append(dependencies, dependency{
+			name:      h.config.DBDriver,
+			ping:      h.keyRepo.Ping,
+			poolStats: h.keyRepo.PoolStats,
+			recovered: func() {
+				if err := h.keyManager.ReloadKeys(); err != nil {
+					h.logger.WithError(err).Warn("Failed to reload keys after reconnecting to the key database")
+				}
+			},
+		})
+	}
+	if h.usageCache != nil && h.usageCache.Shared() {
+		dependencies = append(dependencies, dependency{name: "redis", ping: h.usageCache.Ping, poolStats: h.usageCache.PoolStats})
+	}
+	return newDependencyMonitor(h.config.DependencyCheckInterval, h.logger, dependencies...)
+}
+
+// StartDependencyChecks starts pinging MySQL and Redis for /health
+func (h *Handler) StartDependencyChecks(ctx context.Context) {
+	h.dependencies.Start(ctx)
+}
+
+// DependencyHealth returns the reachability of MySQL and Redis and whether either
+// is down
+func (h *Handler) DependencyHealth() (map[string]types.DependencyHealth, bool) {
+	return h.dependencies.Snapshot(), h.dependencies.Degraded()
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// endpointLimiter holds the local fallback limiters of ENDPOINT_RATE_LIMITS.
+// The limits are normally shared through the cache, so they hold across
+// replicas; the local limiters only serve while the cache is unreachable.
+type endpointLimiter struct {
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+func newEndpointLimiter() *endpointLimiter {
+	return &endpointLimiter{limiters: make(map[string]*rate.Limiter)}
+}
+
+// take takes a request from the endpoint's local limiter
+func (l *endpointLimiter) take(path string, rpm int) (bool, time.Duration) {
+	l.mu.Lock()
+	limiter, ok := l.limiters[path]
+	if !ok || limiter.Burst() != rpm {
+		limiter = rate.NewLimiter(rate.Limit(float64(rpm)/60), rpm)
+		l.limiters[path] = limiter
+	}
+	l.mu.Unlock()
+
+	reservation := limiter.Reserve()
+	if delay := reservation.Delay(); delay > 0 {
+		reservation.Cancel()
+		return false, delay
+	}
+	return true, 0
+}
+
+// limitEndpoint applies the endpoint's requests-per-minute limit, writing a 429
+// response when it is reached. It reports whether the request was rejected.
+func (h *Handler) limitEndpoint(w http.ResponseWriter, r *http.Request, req *proxyRequest) bool {
+	path, _, _ := strings.Cut(req.endpoint, "?")
+	rpm := h.config.Endpoint(path).RateLimitRPM
+	if rpm <= 0 {
+		return false
+	}
+
+	allowed, wait, err := h.takeEndpointToken(r.Context(), path, rpm)
+	if err != nil {
+		h.logger.WithError(err).Warn("Failed to apply endpoint rate limit in the cache, using local limiter")
+		allowed, wait = h.endpoints.take(path, rpm)
+	}
+	if allowed {
+		return false
+	}
+
+	h.stats.addError()
+	w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+	http.Error(w, "Endpoint rate limit exceeded", http.StatusTooManyRequests)
+	return true
+}
+
+// takeEndpointToken takes a request from the endpoint's bucket in the cache
+func (h *Handler) takeEndpointToken(ctx context.Context, path string, rpm int) (bool, time.Duration, error) {
+	if h.usageCache == nil {
+		allowed, wait := h.endpoints.take(path, rpm)
+		return allowed, wait, nil
+	}
+	return h.usageCache.TakeKeyToken(ctx, "endpoint:"+path, rpm)
+}
@@ -0,0 +1,269 @@
+package handler
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/repository"
+	"github.com/dbccccccc/tavily-load/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// exportConfirmation must be passed as ?confirm= to export full key values
+const exportConfirmation = "export-full-keys"
+
+// ExportKeysHandler handles GET /api/keys/export requests. By default keys are exported
+// with previews only; full values additionally need include_values=true, the
+// confirmation parameter and the admin scope.
+func (h *Handler) ExportKeysHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	format := query.Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "txt" {
+		http.Error(w, "Invalid format: must be json or txt", http.StatusBadRequest)
+		return
+	}
+
+	includeValues := query.Get("include_values") == "true"
+	if format == "txt" && !includeValues {
+		http.Error(w, "The txt format contains full key values and requires include_values=true", http.StatusBadRequest)
+		return
+	}
+	if includeValues {
+		if query.Get("confirm") != exportConfirmation {
+			http.Error(w, fmt.Sprintf("Exporting full key values requires confirm=%s", exportConfirmation), http.StatusBadRequest)
+			return
+		}
+	}
+
+	tenant, status, message := h.requestTenant(r)
+	if status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	opts := repository.KeyListOptions{
+		Status: query.Get("status"),
+		Pool:   query.Get("pool"),
+		Tenant: tenant,
+		Tag:    strings.ToLower(strings.TrimSpace(query.Get("tag"))),
+	}
+	if !repository.ValidKeyStatus(opts.Status) {
+		http.Error(w, "Invalid status: must be one of active, inactive, blacklisted", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	keys, _, err := h.keyRepo.ListKeys(ctx, opts)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to fetch keys for export")
+		http.Error(w, "Failed to export keys", http.StatusInternalServerError)
+		return
+	}
+
+	if includeValues {
+		h.logger.WithFields(logrus.Fields{
+			"count":     len(keys),
+			"format":    format,
+			"client_ip": r.RemoteAddr,
+		}).Warn("Full API key values exported")
+	}
+
+	filename := fmt.Sprintf("tavily-keys-%s.%s", time.Now().Format("20060102-150405"), format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	if format == "txt" {
+		// keys.txt format: one key per line
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, key := range keys {
+			fmt.Fprintln(w, key.KeyValue)
+		}
+		return
+	}
+
+	keyIDs := make([]int64, len(keys))
+	for i, key := range keys {
+		keyIDs[i] = key.ID
+	}
+	keyTags, err := h.keyRepo.GetTagsForKeys(ctx, keyIDs)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to fetch key tags for export")
+		http.Error(w, "Failed to export keys", http.StatusInternalServerError)
+		return
+	}
+
+	exported := make([]map[string]interface{}, len(keys))
+	for i, key := range keys {
+		tags := keyTags[key.ID]
+		if tags == nil {
+			tags = []string{}
+		}
+		entry := map[string]interface{}{
+			"name":        key.Name,
+			"description": key.Description,
+			"pool":        key.Pool,
+			"tenant":      key.Tenant,
+			"tags":        tags,
+			"is_active":   key.IsActive,
+			"created_at":  key.CreatedAt,
+		}
+		if includeValues {
+			entry["key"] = key.KeyValue
+		} else {
+			entry["key_preview"] = types.KeyPreview(key.KeyValue)
+		}
+		exported[i] = entry
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"exported_at":    time.Now(),
+		"count":          len(exported),
+		"include_values": includeValues,
+		"keys":           exported,
+	})
+}
+
+// usageExportColumns is the header row of the usage analytics CSV export
+var usageExportColumns = []string{
+	"key_preview", "active", "request_count", "error_count", "error_rate",
+	"key_usage", "key_limit", "key_utilization",
+	"plan", "plan_usage", "plan_limit", "plan_utilization",
+	"paygo_usage", "paygo_limit", "paygo_utilization", "total_remaining",
+	"health_score", "cost_efficiency", "recommended_use", "last_used",
+}
+
+// UsageAnalyticsExportHandler handles GET /api/usage-analytics/export requests with
+// one CSV row per key for spreadsheets. Keys whose Tavily usage has not been
+// fetched yet are listed with empty usage columns.
+func (h *Handler) UsageAnalyticsExportHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" {
+		http.Error(w, "Invalid format: must be csv", http.StatusBadRequest)
+		return
+	}
+
+	tenant, status, message := h.requestTenant(r)
+	if status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	analytics := h.keyManager.GetUsageAnalytics()
+	stats := h.keyManager.GetStats()
+	if tenant != "" {
+		analytics = h.keyManager.GetTenantUsageAnalytics(tenant)
+		stats = h.keyManager.GetTenantStats(tenant)
+	}
+
+	keys := make([]string, 0, len(stats.KeyStatus))
+	for key := range stats.KeyStatus {
+		keys = append(keys, key)
+	}
+	for key := range analytics.KeyAnalytics {
+		if _, ok := stats.KeyStatus[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	filename := fmt.Sprintf("tavily-usage-%s.csv", time.Now().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	writer := csv.NewWriter(w)
+	writer.Write(usageExportColumns)
+	for _, key := range keys {
+		writer.Write(usageExportRow(key, stats, analytics.KeyAnalytics[key]))
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		h.logger.WithError(err).Warn("Failed to write usage analytics export")
+	}
+}
+
+// usageExportRow formats the CSV row of a key; analytics is nil for keys without usage data
+func usageExportRow(key string, stats types.KeyStats, analytics *types.KeyAnalytics) []string {
+	status := stats.KeyStatus[key]
+	requests := int64(stats.RequestCounts[key])
+	errors := int64(stats.ErrorCounts[key])
+	lastUsed := stats.LastUsed[key]
+	if analytics != nil {
+		requests, errors = analytics.RequestCount, analytics.ErrorCount
+		if analytics.LastUsed.After(lastUsed) {
+			lastUsed = analytics.LastUsed
+		}
+	}
+
+	row := make([]string, 0, len(usageExportColumns))
+	row = append(row,
+		types.KeyPreview(key),
+		strconv.FormatBool(status.Active),
+		strconv.FormatInt(requests, 10),
+		strconv.FormatInt(errors, 10),
+		formatRatio(errors, requests),
+	)
+
+	if analytics == nil || analytics.Usage == nil {
+		row = append(row, make([]string, 11)...)
+	} else {
+		usage := analytics.Usage
+		row = append(row,
+			strconv.Itoa(usage.Key.Usage),
+			strconv.Itoa(usage.Key.Limit),
+			formatRatio(int64(usage.Key.Usage), int64(usage.Key.Limit)),
+			usage.Account.CurrentPlan,
+			strconv.Itoa(usage.Account.PlanUsage),
+			strconv.Itoa(usage.Account.PlanLimit),
+			formatRatio(int64(usage.Account.PlanUsage), int64(usage.Account.PlanLimit)),
+			strconv.Itoa(usage.Account.PaygoUsage),
+			strconv.Itoa(usage.Account.PaygoLimit),
+			formatRatio(int64(usage.Account.PaygoUsage), int64(usage.Account.PaygoLimit)),
+		)
+		if analytics.RemainingPoints != nil {
+			row = append(row, strconv.Itoa(analytics.RemainingPoints.TotalRemaining))
+		} else {
+			row = append(row, "")
+		}
+	}
+
+	if analytics == nil {
+		row = append(row, "", "", "")
+	} else {
+		row = append(row,
+			strconv.FormatFloat(analytics.HealthScore, 'f', 3, 64),
+			strconv.FormatFloat(analytics.CostEfficiency, 'f', 3, 64),
+			strconv.FormatBool(analytics.RecommendedUse),
+		)
+	}
+
+	if lastUsed.IsZero() {
+		row = append(row, "")
+	} else {
+		row = append(row, lastUsed.UTC().Format(time.RFC3339))
+	}
+	return row
+}
+
+// formatRatio formats part/whole with four decimals, or "" when whole is zero
+func formatRatio(part, whole int64) string {
+	if whole <= 0 {
+		return ""
+	}
+	return strconv.FormatFloat(float64(part)/float64(whole), 'f', 4, 64)
+}
@@ -8,16 +8,23 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/dbccccccc/tavily-load/internal/config"
 	"github.com/dbccccccc/tavily-load/internal/errors"
+	"github.com/dbccccccc/tavily-load/internal/errreport"
+	"github.com/dbccccccc/tavily-load/internal/events"
 	"github.com/dbccccccc/tavily-load/internal/keymanager"
 	"github.com/dbccccccc/tavily-load/internal/middleware"
 	"github.com/dbccccccc/tavily-load/internal/repository"
+	"github.com/dbccccccc/tavily-load/internal/tracing"
+	"github.com/dbccccccc/tavily-load/internal/usage"
 	"github.com/dbccccccc/tavily-load/pkg/types"
+	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 )
 
@@ -29,40 +36,100 @@ type Handler struct {
 	httpClient *http.Client
 	startTime  time.Time
 	stats      *Stats
-	keyRepo    *repository.KeyRepository
+	keyRepo    types.KeyRepository
+	usageCache types.UsageCache
+	upstream   *upstreamBreaker
+	importJobs *importJobStore
+	cacheStats responseCacheStats
+	jobSlots   chan struct{}
+	latencies  *latencyWindow
+	// connections is fed by TrackConnection, the HTTP server's ConnState hook
+	connections connectionTracker
+	// retries is nil when RETRY_BUDGET_RATIO is 0
+	retries *retryBudget
+	// shadow is nil unless SHADOW_BASE_URL is set
+	shadow *shadowMirror
+	// reporter is nil unless SENTRY_DSN is set
+	reporter *errreport.Reporter
+	// captures is nil unless CAPTURE_PERCENT is set
+	captures *captureStore
+	// rollup and daily are nil unless USAGE_ROLLUP_ENABLED is set
+	rollup *usage.HourlyRollup
+	daily  *usage.DailyRollup
+	// requestLog is nil unless REQUEST_LOG_ENABLED is set
+	requestLog *usage.RequestLog
+	// budget is nil unless GLOBAL_DAILY_BUDGET or GLOBAL_MONTHLY_BUDGET is set
+	budget *globalBudget
+	// events is the key manager's lifecycle event bus
+	events *events.Bus
+	// dependencies pings MySQL and Redis for /health
+	dependencies *dependencyMonitor
+	// endpoints falls back to local limiters for ENDPOINT_RATE_LIMITS
+	endpoints *endpointLimiter
 }
 
-// Stats tracks request statistics
-type Stats struct {
-	RequestsTotal   int64         `json:"requests_total"`
-	RequestsSuccess int64         `json:"requests_success"`
-	RequestsError   int64         `json:"requests_error"`
-	AverageLatency  time.Duration `json:"average_latency"`
-	TotalLatency    time.Duration `json:"total_latency"`
-}
+// poolHeader lets clients choose the key pool a request is served from
+const poolHeader = "X-Tavily-Pool"
+
+const (
+	// defaultKeysPerPage is the page size used when only ?page= is given
+	defaultKeysPerPage = 50
+	// maxKeysPerPage caps the page size of the keys list
+	maxKeysPerPage = 500
+)
 
-// NewHandler creates a new HTTP handler
-func NewHandler(keyManager *keymanager.Manager, cfg *config.Config, logger *logrus.Logger, keyRepo *repository.KeyRepository) *Handler {
-	// Create HTTP client with timeouts
+// NewHandler creates a new HTTP handler. reporter receives the requests that
+// failed after all retries and is nil unless SENTRY_DSN is set; upstream carries
+// the proxied requests to Tavily.
+func NewHandler(keyManager *keymanager.Manager, cfg *config.Config, logger *logrus.Logger, keyRepo types.KeyRepository, usageCache types.UsageCache, reporter *errreport.Reporter, upstream http.RoundTripper) *Handler {
+	// REQUEST_TIMEOUT is applied per request by makeRequest, so a reload changes it
 	client := &http.Client{
-		Timeout: cfg.RequestTimeout,
-		Transport: &http.Transport{
-			IdleConnTimeout:       cfg.IdleConnTimeout,
-			ResponseHeaderTimeout: cfg.ResponseTimeout,
-			MaxIdleConns:          100,
-			MaxIdleConnsPerHost:   10,
-		},
+		Transport: upstream,
+	}
+
+	// Rollups are stored in the database, which file and env key sources run without
+	var rollup *usage.HourlyRollup
+	var dailyRollup *usage.DailyRollup
+	if cfg.UsageRollupEnabled && keyRepo != nil {
+		rollup = usage.NewHourlyRollup(keyRepo, logger, cfg.UsageRollupInterval)
+		dailyRollup = usage.NewDailyRollup(keyRepo, logger, cfg.UsageHourlyRetention)
+	}
+	var requestLog *usage.RequestLog
+	if cfg.RequestLogEnabled && keyRepo != nil {
+		requestLog = usage.NewRequestLog(keyRepo, logger, cfg.RequestLogFlushInterval, cfg.RequestLogRetention)
 	}
 
-	return &Handler{
+	var retries *retryBudget
+	if cfg.RetryBudgetRatio > 0 {
+		retries = newRetryBudget(cfg.RetryBudgetRatio, cfg.RetryBudgetWindow, cfg.RetryBudgetMinRetries)
+	}
+
+	h := &Handler{
 		keyManager: keyManager,
 		config:     cfg,
 		logger:     logger,
 		httpClient: client,
 		startTime:  time.Now(),
-		stats:      &Stats{},
+		stats:      newStats(),
 		keyRepo:    keyRepo,
+		usageCache: usageCache,
+		upstream:   newUpstreamBreaker(cfg.UpstreamBreakerThreshold, cfg.UpstreamBreakerMinKeys, cfg.UpstreamBreakerCooldown),
+		importJobs: newImportJobStore(cfg.ImportJobTTL),
+		jobSlots:   make(chan struct{}, cfg.JobMaxConcurrent),
+		latencies:  newLatencyWindow(),
+		retries:    retries,
+		shadow:     newShadowMirror(cfg),
+		reporter:   reporter,
+		captures:   newCaptureStore(cfg, logger),
+		rollup:     rollup,
+		daily:      dailyRollup,
+		requestLog: requestLog,
+		budget:     newGlobalBudget(cfg, usageCache, keyManager.Events(), logger),
+		events:     keyManager.Events(),
+		endpoints:  newEndpointLimiter(),
 	}
+	h.dependencies = h.monitorDependencies()
+	return h
 }
 
 // TavilySearchHandler handles POST /search requests
@@ -93,82 +160,314 @@ func (h *Handler) TavilyUsageHandler(w http.ResponseWriter, r *http.Request) {
 // proxyTavilyRequest proxies requests to the Tavily API with key rotation
 func (h *Handler) proxyTavilyRequest(w http.ResponseWriter, r *http.Request, endpoint string) {
 	startTime := time.Now()
-	h.stats.RequestsTotal++
+	h.stats.addRequest()
 
-	// Get request context
-	reqCtx := h.getRequestContext(r)
-	reqCtx.Endpoint = endpoint
+	if h.requestLog != nil {
+		sw := &statusWriter{ResponseWriter: w}
+		w = sw
+		defer h.logRequest(r, sw, endpoint, startTime)
+	}
 
-	// Read request body
+	// Read request body; it is kept in memory so retries can resend it, which
+	// MAX_REQUEST_BODY_SIZE_MB bounds
+	if h.config.MaxRequestBodySizeMB > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, int64(h.config.MaxRequestBodySizeMB)<<20)
+	}
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		h.logger.WithError(err).Error("Failed to read request body")
 		http.Error(w, "Failed to read request body", http.StatusBadRequest)
-		h.stats.RequestsError++
+		h.stats.addError()
 		return
 	}
 	defer r.Body.Close()
 
+	// Reject malformed requests before they cost a key any credits
+	if h.config.ValidateRequests {
+		path, _, _ := strings.Cut(endpoint, "?")
+		if err := validateRequestBody(path, body); err != nil {
+			h.stats.addError()
+			http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	tenant, status, message := h.requestTenant(r)
+	if status != 0 {
+		h.stats.addError()
+		http.Error(w, message, status)
+		return
+	}
+
+	pool := r.Header.Get(poolHeader)
+	if pool == "" {
+		pool = h.config.DefaultKeyPool
+	}
+	if !h.keyManager.HasPool(keymanager.TenantPool(tenant, pool)) {
+		h.stats.addError()
+		http.Error(w, fmt.Sprintf("Unknown key pool: %s", pool), http.StatusBadRequest)
+		return
+	}
+
+	pinnedKey, status, message := h.resolvePinnedKey(r, tenant, pool)
+	if status != 0 {
+		h.stats.addError()
+		http.Error(w, message, status)
+		return
+	}
+
+	filter, err := h.newResponseFilter(r)
+	if err != nil {
+		h.stats.addError()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req := &proxyRequest{
+		method:    r.Method,
+		endpoint:  endpoint,
+		body:      body,
+		pool:      keymanager.TenantPool(tenant, pool),
+		pinnedKey: pinnedKey,
+		filter:    filter,
+		startTime: startTime,
+	}
+
+	h.mirrorRequest(r, req)
+
+	// Pinned requests debug a key, so they always go upstream
+	if pinnedKey == "" {
+		req.cacheKey = h.responseCacheKey(endpoint, body)
+	}
+	if req.cacheKey != "" && h.serveCachedResponse(w, r, req) {
+		return
+	}
+
+	// Cached answers are free, so the budget only applies to requests sent upstream
+	if requestCredits(endpoint) > 0 && !h.budget.admit(w, r) {
+		h.stats.addError()
+		return
+	}
+
+	if h.beginIdempotentRequest(w, r, req) {
+		return
+	}
+	defer h.releaseIdempotencyKey(r.Context(), req)
+
+	h.forwardRequest(w, r, req)
+}
+
+// proxyRequest describes a request being forwarded to the Tavily API
+type proxyRequest struct {
+	method   string
+	endpoint string
+	body     []byte
+	// pool is the key pool the request draws its keys from, named with
+	// keymanager.TenantPool in multi-tenant mode
+	pool string
+	// pinnedKey, when set, serves every attempt instead of strategy selection
+	pinnedKey string
+	// filter trims the response body, if requested
+	filter *responseFilter
+	// cacheKey stores a successful response in the response cache when set
+	cacheKey string
+	// idempotencyKey is the claimed Idempotency-Key record, and idempotencyStored
+	// is set once the response has been remembered under it
+	idempotencyKey    string
+	idempotencyStored bool
+	// replayID is set when the request is a replay of a previously captured failure
+	replayID  string
+	startTime time.Time
+}
+
+// forwardRequest sends the request body upstream, rotating keys between retries
+func (h *Handler) forwardRequest(w http.ResponseWriter, r *http.Request, req *proxyRequest) {
+	// Get request context
+	reqCtx := h.getRequestContext(r)
+	reqCtx.Endpoint = req.endpoint
+
+	// Sampled exchanges are recorded for /api/debug/captures
+	if cw := h.startCapture(w); cw != nil {
+		w = cw
+		defer h.finishCapture(cw, r, req, reqCtx)
+	}
+
+	if h.preflightQuota(w, req) {
+		return
+	}
+
+	if h.limitEndpoint(w, r, req) {
+		return
+	}
+
+	h.retries.recordRequest()
+
 	// Try request with retries
+	maxRetries := h.config.Endpoint(req.endpoint).MaxRetries
 	var lastErr error
-	for attempt := 0; attempt <= h.config.MaxRetries; attempt++ {
+	var err error
+	attempts := 0
+	for attempt := 0; attempt <= maxRetries; attempt++ {
 		reqCtx.RetryCount = attempt
+		attempts = attempt + 1
+
+		// Short-circuit while Tavily itself is failing instead of burning through the key pool
+		if allowed, retryAfter := h.upstream.allow(); !allowed {
+			h.stats.addError()
+			h.rejectUpstreamUnavailable(w, retryAfter)
+			return
+		}
 
-		// Get next API key
-		apiKey, err := h.keyManager.GetNextKey()
+		// Get next API key; retries rotate instead of re-hashing to the same key
+		var apiKey string
+		var strategy types.SelectionStrategy
+		if req.pinnedKey != "" {
+			apiKey = req.pinnedKey
+		} else if attempt == 0 {
+			apiKey, strategy, err = h.keyManager.SelectKeyForRequest(r.Context(), req.pool, routingKey(req.body))
+		} else {
+			apiKey, strategy, err = h.keyManager.SelectKeyForRequest(r.Context(), req.pool, "")
+		}
 		if err != nil {
 			h.logger.WithError(err).Error("Failed to get API key")
+			h.stats.addError()
+			h.captureFailedRequest(w, r, req, err, attempt)
 			http.Error(w, "No API keys available", http.StatusServiceUnavailable)
-			h.stats.RequestsError++
 			return
 		}
 
 		reqCtx.Key = apiKey
 
 		// Make request to Tavily API
-		resp, err := h.makeRequest(r.Context(), r.Method, endpoint, apiKey, body, r.Header)
+		upstreamStart := time.Now()
+		apiKey, resp, err := h.doUpstream(r, req, apiKey)
+		reqCtx.Key = apiKey
+		reqCtx.UpstreamLatency = time.Since(upstreamStart)
+		reqCtx.UpstreamStatus = upstreamStatus(resp, err)
 		if err != nil {
 			lastErr = err
-			h.keyManager.RecordError(apiKey, err)
 
-			// Update usage tracker metrics for failed request
-			if usageTracker := h.getUsageTracker(); usageTracker != nil {
-				usageTracker.UpdateKeyMetrics(apiKey, false, time.Since(startTime))
+			// A client that went away says nothing about Tavily or the key, so the
+			// failure is neither counted against them nor retried
+			if r.Context().Err() != nil {
+				h.upstream.abandon()
+				h.stats.addError()
+				h.logger.WithError(err).
+					WithField("key", types.KeyPreview(apiKey)).
+					Debug("Client went away before the upstream answered")
+				return
+			}
+
+			if isUpstreamFailure(err) && h.upstream.recordFailure(apiKey) {
+				// The outage is not the key's fault, so leave it in rotation
+				h.stats.addError()
+				h.logger.WithError(err).
+					WithField("key", types.KeyPreview(apiKey)).
+					Warn("Upstream circuit open, Tavily appears to be failing across keys")
+				h.events.Publish(events.Event{
+					Type: events.UpstreamOutage,
+					Key:  apiKey,
+					Data: map[string]interface{}{
+						"error":    err.Error(),
+						"retry_in": h.config.UpstreamBreakerCooldown.String(),
+					},
+				})
+				h.rejectUpstreamUnavailable(w, h.config.UpstreamBreakerCooldown)
+				return
+			}
+			if !isUpstreamFailure(err) {
+				h.upstream.recordSuccess()
 			}
 
+			h.keyManager.RecordError(apiKey, err)
+			h.rollup.Record(apiKey, req.endpoint, false, reqCtx.UpstreamLatency)
+
+			h.events.Publish(events.Event{
+				Type: events.RequestFailed,
+				Key:  apiKey,
+				Pool: req.pool,
+				Data: map[string]interface{}{
+					"endpoint":         req.endpoint,
+					"error":            err.Error(),
+					"status":           reqCtx.UpstreamStatus,
+					"attempt":          attempt + 1,
+					"strategy":         strategy,
+					"latency":          time.Since(req.startTime),
+					"upstream_latency": reqCtx.UpstreamLatency,
+				},
+			})
+
 			// Check if we should retry
 			if tavilyErr, ok := err.(*errors.TavilyError); ok && !tavilyErr.IsRetryable() {
 				break
 			}
 
+			// A pinned request must not silently move to another key
+			if req.pinnedKey != "" {
+				break
+			}
+
+			if attempt == maxRetries {
+				break
+			}
+
+			// Shed retries once they outgrow the budget, so an outage is not amplified
+			if !h.retries.allowRetry() {
+				h.logger.WithError(err).
+					WithField("key", types.KeyPreview(apiKey)).
+					Warn("Retry budget exhausted, not retrying")
+				break
+			}
+
 			h.logger.WithError(err).
 				WithField("attempt", attempt+1).
-				WithField("key", apiKey[:12]+"...").
+				WithField("key", types.KeyPreview(apiKey)).
 				Warn("Request failed, retrying with different key")
+
+			if !h.waitBeforeRetry(r.Context(), attempt+1, err) {
+				h.stats.addError()
+				return
+			}
 			continue
 		}
 
 		// Success - copy response
-		h.copyResponse(w, resp)
-		h.stats.RequestsSuccess++
+		h.upstream.recordSuccess()
+		h.copyResponse(r.Context(), w, resp, req)
+		h.stats.addSuccess()
+		h.keyManager.RecordSuccess(apiKey)
+		credits := requestCredits(req.endpoint)
+		h.keyManager.RecordCredits(apiKey, credits)
+		h.budget.record(r.Context(), credits)
+		h.rollup.Record(apiKey, req.endpoint, true, reqCtx.UpstreamLatency)
 
 		// Update latency stats
-		latency := time.Since(startTime)
-		h.stats.TotalLatency += latency
-		if h.stats.RequestsTotal > 0 {
-			h.stats.AverageLatency = h.stats.TotalLatency / time.Duration(h.stats.RequestsTotal)
-		}
+		latency := time.Since(req.startTime)
+		h.stats.addLatency(req.endpoint, latency)
 
 		reqCtx.ResponseTime = latency
 
-		// Update usage tracker metrics
-		if usageTracker := h.getUsageTracker(); usageTracker != nil {
-			usageTracker.UpdateKeyMetrics(apiKey, true, latency)
+		h.events.Publish(events.Event{
+			Type: events.RequestSucceeded,
+			Key:  apiKey,
+			Pool: req.pool,
+			Data: map[string]interface{}{
+				"endpoint":         req.endpoint,
+				"credits":          credits,
+				"strategy":         strategy,
+				"latency":          latency,
+				"upstream_latency": reqCtx.UpstreamLatency,
+			},
+		})
+
+		// A successful replay no longer needs its captured copy
+		if req.replayID != "" {
+			h.deleteFailedRequest(r.Context(), req.replayID)
 		}
 
 		h.logger.WithFields(logrus.Fields{
-			"endpoint":      endpoint,
-			"key":           apiKey[:12] + "...",
+			"endpoint":      req.endpoint,
+			"key":           types.KeyPreview(apiKey),
 			"attempt":       attempt + 1,
 			"response_time": latency,
 			"status":        resp.StatusCode,
@@ -178,28 +477,96 @@ func (h *Handler) proxyTavilyRequest(w http.ResponseWriter, r *http.Request, end
 	}
 
 	// All retries failed
-	h.stats.RequestsError++
+	h.stats.addError()
 	h.logger.WithError(lastErr).Error("All retries failed")
 
 	if tavilyErr, ok := lastErr.(*errors.TavilyError); ok {
+		if tavilyErr.IsRetryable() {
+			h.reportExhaustedRetries(reqCtx, req, lastErr, attempts)
+			h.captureFailedRequest(w, r, req, lastErr, attempts)
+		}
 		http.Error(w, tavilyErr.Message, tavilyErr.StatusCode)
 	} else {
+		h.reportExhaustedRetries(reqCtx, req, lastErr, attempts)
+		h.captureFailedRequest(w, r, req, lastErr, attempts)
 		http.Error(w, "Request failed after all retries", http.StatusInternalServerError)
 	}
 }
 
+// reportExhaustedRetries sends a request that failed on every attempt to the error
+// reporter; client errors that were never retried are not reported
+func (h *Handler) reportExhaustedRetries(reqCtx *types.RequestContext, req *proxyRequest, err error, attempts int) {
+	if h.reporter == nil {
+		return
+	}
+	tags := map[string]string{
+		"request_id": reqCtx.RequestID,
+		"endpoint":   req.endpoint,
+		"attempts":   strconv.Itoa(attempts),
+	}
+	if len(reqCtx.Key) > 12 {
+		tags["key_preview"] = types.KeyPreview(reqCtx.Key)
+	}
+	if reqCtx.TraceID != "" {
+		tags["trace_id"] = reqCtx.TraceID
+	}
+	h.reporter.CaptureError(err, tags)
+}
+
+// upstreamStatus returns the HTTP status Tavily answered an attempt with, or 0 when
+// the request never got an answer
+func upstreamStatus(resp *http.Response, err error) int {
+	if resp != nil {
+		return resp.StatusCode
+	}
+	if tavilyErr, ok := err.(*errors.TavilyError); ok && tavilyErr.Type != errors.ErrorTypeNetworkError {
+		return tavilyErr.StatusCode
+	}
+	return 0
+}
+
+// rejectUpstreamUnavailable responds with 503 while the upstream circuit is open
+func (h *Handler) rejectUpstreamUnavailable(w http.ResponseWriter, retryAfter time.Duration) {
+	seconds := int((retryAfter + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, "Tavily API is currently unavailable", http.StatusServiceUnavailable)
+}
+
 // makeRequest makes a request to the Tavily API
 func (h *Handler) makeRequest(ctx context.Context, method, endpoint, apiKey string, body []byte, headers http.Header) (*http.Response, error) {
 	url := h.config.TavilyBaseURL + endpoint
 
+	path, _, _ := strings.Cut(endpoint, "?")
+	ctx, span := tracing.Start(ctx, "tavily "+path, tracing.KindClient)
+	defer span.End()
+	span.SetAttribute("http.request.method", method)
+	span.SetAttribute("url.path", path)
+	span.SetAttribute("key_preview", types.KeyPreview(apiKey))
+
+	// The timeout covers the whole exchange, including reading the body, so it
+	// ends when the body is closed
+	cancel := context.CancelFunc(func() {})
+	if timeout := h.config.Endpoint(endpoint).RequestTimeout; timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+
 	// Create request
 	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
 	if err != nil {
+		cancel()
+		span.RecordError(err)
 		return nil, errors.NewTavilyError(errors.ErrorTypeInternalError, "Failed to create request", 500)
 	}
 
 	// Set headers
-	req.Header.Set("Authorization", "Bearer "+apiKey)
+	if h.authHeaderStyle(endpoint) == "x-api-key" {
+		req.Header.Set("X-API-Key", apiKey)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("User-Agent", "tavily-load/1.0")
 
@@ -212,26 +579,70 @@ func (h *Handler) makeRequest(ctx context.Context, method, endpoint, apiKey stri
 		}
 	}
 
+	// Tie the upstream call to our trace and request ID, replacing the client's
+	// values, so Tavily support tickets can be correlated with proxy logs
+	if traceparent := tracing.FromContext(ctx).Traceparent(); traceparent != "" {
+		req.Header.Set(tracing.TraceparentHeader, traceparent)
+	}
+	if requestID, ok := ctx.Value(middleware.RequestIDKey{}).(string); ok {
+		req.Header.Set("X-Request-ID", requestID)
+	}
+
 	// Make request
 	resp, err := h.httpClient.Do(req)
 	if err != nil {
+		cancel()
+		span.RecordError(err)
 		return nil, errors.NewTavilyErrorWithKey(errors.ErrorTypeNetworkError, "Network error: "+err.Error(), 500, apiKey)
 	}
+	span.SetAttribute("http.response.status_code", resp.StatusCode)
+	resp.Body = cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
 
 	// Check for HTTP errors
 	if resp.StatusCode >= 400 {
 		body, _ := io.ReadAll(resp.Body)
 		resp.Body.Close()
-		return nil, errors.ParseHTTPError(resp.StatusCode, body, apiKey)
+		tavilyErr := errors.ParseHTTPError(resp.StatusCode, resp.Header, body, apiKey)
+		span.RecordError(tavilyErr)
+		return nil, tavilyErr
 	}
 
 	return resp, nil
 }
 
+// authHeaderStyle returns how the key is sent upstream for an endpoint
+func (h *Handler) authHeaderStyle(endpoint string) string {
+	path, _, _ := strings.Cut(endpoint, "?")
+	if style, ok := h.config.TavilyAuthHeaderOverrides[path]; ok {
+		return style
+	}
+	return h.config.TavilyAuthHeader
+}
+
 // copyResponse copies the response from Tavily API to the client
-func (h *Handler) copyResponse(w http.ResponseWriter, resp *http.Response) {
+func (h *Handler) copyResponse(ctx context.Context, w http.ResponseWriter, resp *http.Response, req *proxyRequest) {
 	defer resp.Body.Close()
 
+	encoded := resp.Header.Get("Content-Encoding") != "" && resp.Header.Get("Content-Encoding") != "identity"
+	cache := req.cacheKey != "" && resp.StatusCode == http.StatusOK && !encoded
+	idempotent := req.idempotencyKey != "" && !encoded
+	if cache || idempotent || req.filter.applies(resp) {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			h.logger.WithError(err).Error("Failed to read response body")
+			http.Error(w, "Failed to read upstream response", http.StatusBadGateway)
+			return
+		}
+		if cache {
+			h.storeCachedResponse(ctx, req, resp, body)
+		}
+		if idempotent {
+			h.storeIdempotentResponse(ctx, req, resp, body)
+		}
+		h.writeBufferedResponse(w, resp.StatusCode, resp.Header, body, req.filter)
+		return
+	}
+
 	// Copy headers
 	for key, values := range resp.Header {
 		for _, value := range values {
@@ -242,8 +653,60 @@ func (h *Handler) copyResponse(w http.ResponseWriter, resp *http.Response) {
 	// Set status code
 	w.WriteHeader(resp.StatusCode)
 
-	// Copy body
-	io.Copy(w, resp.Body)
+	// Stream the body, flushing each chunk so large crawl and extract payloads are
+	// relayed as they arrive instead of accumulating in buffers
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, streamChunkSize)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, writeErr := w.Write(buf[:n]); writeErr != nil {
+				h.logger.WithError(writeErr).Debug("Client went away while streaming response")
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			h.logger.WithError(err).Warn("Failed to stream upstream response")
+			return
+		}
+	}
+}
+
+// streamChunkSize is the read size used when streaming upstream responses
+const streamChunkSize = 32 * 1024
+
+// writeBufferedResponse writes a fully read response body, trimming it with the filter
+func (h *Handler) writeBufferedResponse(w http.ResponseWriter, statusCode int, header http.Header, body []byte, filter *responseFilter) {
+	if filter != nil && strings.HasPrefix(header.Get("Content-Type"), "application/json") {
+		body = filter.apply(body)
+	}
+
+	for key, values := range header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
+
+// routingKey derives the consistent-hash routing key for a request body. Search
+// requests are keyed on their normalized query; other bodies are used verbatim.
+func routingKey(body []byte) string {
+	var payload struct {
+		Query string `json:"query"`
+	}
+	if err := json.Unmarshal(body, &payload); err == nil && payload.Query != "" {
+		return strings.ToLower(strings.Join(strings.Fields(payload.Query), " "))
+	}
+	return string(body)
 }
 
 // shouldCopyHeader determines if a header should be copied to the upstream request
@@ -263,6 +726,16 @@ func shouldCopyHeader(header string) bool {
 		"te",
 		"trailers",
 		"transfer-encoding",
+		"x-tavily-pool",
+		"x-tavily-tenant",
+		"x-tavily-use-key",
+		"x-tavily-fields",
+		"x-tavily-max-results",
+		"x-tavily-cache",
+		// Go's transport negotiates and decodes compression itself, and the gzip
+		// middleware compresses for the client
+		"accept-encoding",
+		"x-api-key",
 	}
 
 	for _, skip := range skipHeaders {
@@ -292,10 +765,27 @@ func (h *Handler) getRequestContext(r *http.Request) *types.RequestContext {
 
 // HealthHandler handles GET /health requests
 func (h *Handler) HealthHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.Health())
+}
+
+// Health reports the service health served by /health and Server.Health. It is
+// unhealthy without an active key to serve requests with, and degraded while
+// the upstream circuit is open or MySQL or Redis is unreachable.
+func (h *Handler) Health() types.HealthStatus {
 	keyStats := h.keyManager.GetStats()
 
-	health := types.HealthStatus{
-		Status:    "healthy",
+	status := "healthy"
+	upstreamState := h.upstream.State()
+	dependencies, degraded := h.DependencyHealth()
+	if keyStats.ActiveKeys == 0 {
+		status = "unhealthy"
+	} else if upstreamState != types.CircuitClosed || degraded {
+		status = "degraded"
+	}
+
+	return types.HealthStatus{
+		Status:    status,
 		Timestamp: time.Now(),
 		Version:   "1.0.0",
 		Uptime:    time.Since(h.startTime),
@@ -304,25 +794,33 @@ func (h *Handler) HealthHandler(w http.ResponseWriter, r *http.Request) {
 			ActiveKeys:      keyStats.ActiveKeys,
 			BlacklistedKeys: keyStats.BlacklistedKeys,
 		},
-		Server: types.ServerHealth{
-			RequestsTotal:   h.stats.RequestsTotal,
-			RequestsSuccess: h.stats.RequestsSuccess,
-			RequestsError:   h.stats.RequestsError,
-			AverageLatency:  h.stats.AverageLatency,
-		},
-		Connections: types.ConnectionHealth{
-			ActiveConnections: 0, // TODO: implement connection tracking
-			TotalConnections:  0,
-		},
+		Server:          h.stats.Snapshot(),
+		Connections:     h.connectionHealth(),
+		UpstreamCircuit: upstreamState,
+		Dependencies:    dependencies,
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(health)
 }
 
 // StatsHandler handles GET /stats requests
 func (h *Handler) StatsHandler(w http.ResponseWriter, r *http.Request) {
-	stats := h.keyManager.GetStats()
+	tenant, status, message := h.requestTenant(r)
+	if status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	// Request counters span all tenants, so tenant callers only see their keys
+	var stats struct {
+		types.KeyStats
+		Requests *types.ServerHealth `json:"requests,omitempty"`
+	}
+	if tenant != "" {
+		stats.KeyStats = h.keyManager.GetTenantStats(tenant)
+	} else {
+		stats.KeyStats = h.keyManager.GetStats()
+		requests := h.stats.Snapshot()
+		stats.Requests = &requests
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(stats)
@@ -330,7 +828,16 @@ func (h *Handler) StatsHandler(w http.ResponseWriter, r *http.Request) {
 
 // BlacklistHandler handles GET /blacklist requests
 func (h *Handler) BlacklistHandler(w http.ResponseWriter, r *http.Request) {
+	tenant, status, message := h.requestTenant(r)
+	if status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
 	blacklist := h.keyManager.GetBlacklist()
+	if tenant != "" {
+		blacklist = h.keyManager.GetTenantBlacklist(tenant)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -341,7 +848,18 @@ func (h *Handler) BlacklistHandler(w http.ResponseWriter, r *http.Request) {
 
 // ResetKeysHandler handles GET /reset-keys requests
 func (h *Handler) ResetKeysHandler(w http.ResponseWriter, r *http.Request) {
-	h.keyManager.ResetKeys()
+	tenant, status, message := h.requestTenant(r)
+	if status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	if tenant != "" {
+		h.keyManager.ResetTenantKeys(tenant)
+	} else {
+		h.keyManager.ResetKeys()
+	}
+	h.audit(r.Context(), repository.AuditKeysReset, tenant, nil, nil)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
@@ -352,7 +870,16 @@ func (h *Handler) ResetKeysHandler(w http.ResponseWriter, r *http.Request) {
 
 // UsageAnalyticsHandler handles GET /usage-analytics requests
 func (h *Handler) UsageAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
+	tenant, status, message := h.requestTenant(r)
+	if status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
 	analytics := h.keyManager.GetUsageAnalytics()
+	if tenant != "" {
+		analytics = h.keyManager.GetTenantUsageAnalytics(tenant)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(analytics)
@@ -399,10 +926,8 @@ func (h *Handler) getStrategyHandler(w http.ResponseWriter, r *http.Request) {
 	response := map[string]interface{}{
 		"current_strategy":     currentStrategy,
 		"recommended_strategy": recommendedStrategy,
-		"available_strategies": []types.SelectionStrategy{
-			types.StrategyPlanFirst,
-			types.StrategyRoundRobin,
-		},
+		"available_strategies": h.keyManager.GetStrategyRegistry().Strategies(),
+		"strategies":           h.keyManager.GetStrategyRegistry().Describe(),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -420,17 +945,16 @@ func (h *Handler) setStrategyHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate strategy
-	validStrategies := map[types.SelectionStrategy]bool{
-		types.StrategyPlanFirst:  true,
-		types.StrategyRoundRobin: true,
-	}
-
-	if !validStrategies[request.Strategy] {
+	if !h.keyManager.GetStrategyRegistry().Has(request.Strategy) {
 		http.Error(w, "Invalid strategy", http.StatusBadRequest)
 		return
 	}
 
+	previous := h.keyManager.GetSelectionStrategy()
 	h.keyManager.SetSelectionStrategy(request.Strategy)
+	h.audit(r.Context(), repository.AuditStrategyUpdate, "",
+		map[string]types.SelectionStrategy{"strategy": previous},
+		map[string]types.SelectionStrategy{"strategy": request.Strategy})
 
 	response := map[string]interface{}{
 		"status":   "success",
@@ -442,6 +966,43 @@ func (h *Handler) setStrategyHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// StrategyCompareHandler handles GET /api/strategy/compare requests
+func (h *Handler) StrategyCompareHandler(w http.ResponseWriter, r *http.Request) {
+	window := time.Hour
+	if value := r.URL.Query().Get("window"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid window duration", http.StatusBadRequest)
+			return
+		}
+		window = parsed
+	}
+
+	metrics := h.getUsageTracker().GetStrategyMetrics(window)
+
+	// Rank by success rate, then by latency
+	var best types.SelectionStrategy
+	for strategy, m := range metrics {
+		current, ok := metrics[best]
+		if !ok || m.SuccessRate > current.SuccessRate ||
+			(m.SuccessRate == current.SuccessRate && m.AverageLatency < current.AverageLatency) {
+			best = strategy
+		}
+	}
+
+	response := map[string]interface{}{
+		"window":           window.String(),
+		"current_strategy": h.keyManager.GetSelectionStrategy(),
+		"strategies":       metrics,
+	}
+	if best != "" {
+		response["best_strategy"] = best
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
 // getUsageTracker returns the usage tracker from the key manager
 func (h *Handler) getUsageTracker() types.UsageTracker {
 	// Access the usage tracker through the key manager
@@ -464,46 +1025,126 @@ func (h *Handler) KeysHandler(w http.ResponseWriter, r *http.Request) {
 
 // listKeysHandler handles listing all keys
 func (h *Handler) listKeysHandler(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	tenant, status, message := h.requestTenant(r)
+	if status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	query := r.URL.Query()
+	opts := repository.KeyListOptions{
+		Status: query.Get("status"),
+		Tag:    strings.ToLower(strings.TrimSpace(query.Get("tag"))),
+		Pool:   query.Get("pool"),
+		Tenant: tenant,
+		Sort:   query.Get("sort"),
+		Order:  query.Get("order"),
+	}
+
+	if !repository.ValidKeyStatus(opts.Status) {
+		http.Error(w, "Invalid status: must be one of active, inactive, blacklisted", http.StatusBadRequest)
+		return
+	}
+	if !repository.ValidKeySort(opts.Sort) {
+		http.Error(w, "Invalid sort: must be one of created_at, updated_at, name, id", http.StatusBadRequest)
+		return
+	}
+	if opts.Order != "" && opts.Order != "asc" && opts.Order != "desc" {
+		http.Error(w, "Invalid order: must be asc or desc", http.StatusBadRequest)
+		return
+	}
+
+	// Without pagination parameters every matching key is returned, as before
+	if query.Get("page") != "" || query.Get("per_page") != "" {
+		opts.Page = 1
+		opts.PerPage = defaultKeysPerPage
+		if value := query.Get("page"); value != "" {
+			page, err := strconv.Atoi(value)
+			if err != nil || page < 1 {
+				http.Error(w, "Invalid page", http.StatusBadRequest)
+				return
+			}
+			opts.Page = page
+		}
+		if value := query.Get("per_page"); value != "" {
+			perPage, err := strconv.Atoi(value)
+			if err != nil || perPage < 1 || perPage > maxKeysPerPage {
+				http.Error(w, fmt.Sprintf("Invalid per_page: must be between 1 and %d", maxKeysPerPage), http.StatusBadRequest)
+				return
+			}
+			opts.PerPage = perPage
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
-	keys, err := h.keyRepo.GetAllKeys(ctx)
+	keys, total, err := h.keyRepo.ListKeys(ctx, opts)
 	if err != nil {
 		h.logger.WithError(err).Error("Failed to fetch keys from database")
 		http.Error(w, "Failed to fetch keys", http.StatusInternalServerError)
 		return
 	}
 
+	keyIDs := make([]int64, len(keys))
+	for i, key := range keys {
+		keyIDs[i] = key.ID
+	}
+	keyTags, err := h.keyRepo.GetTagsForKeys(ctx, keyIDs)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to fetch key tags")
+		http.Error(w, "Failed to fetch keys", http.StatusInternalServerError)
+		return
+	}
+
 	// Convert to response format (without exposing full key values)
 	response := make([]map[string]interface{}, len(keys))
 	for i, key := range keys {
+		tags := keyTags[key.ID]
+		if tags == nil {
+			tags = []string{}
+		}
 		response[i] = map[string]interface{}{
 			"id":                key.ID,
 			"name":              key.Name,
 			"description":       key.Description,
-			"key_preview":       key.KeyValue[:12] + "...",
+			"key_preview":       types.KeyPreview(key.KeyValue),
 			"is_active":         key.IsActive,
 			"is_blacklisted":    key.IsBlacklisted,
 			"blacklisted_until": key.BlacklistedUntil,
 			"blacklist_reason":  key.BlacklistReason,
+			"pool":              key.Pool,
+			"tenant":            key.Tenant,
+			"tags":              tags,
 			"created_at":        key.CreatedAt,
 			"updated_at":        key.UpdatedAt,
 		}
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	result := map[string]interface{}{
 		"keys":  response,
 		"count": len(response),
-	})
+		"total": total,
+	}
+	if opts.PerPage > 0 {
+		result["page"] = opts.Page
+		result["per_page"] = opts.PerPage
+		result["total_pages"] = (total + opts.PerPage - 1) / opts.PerPage
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
 }
 
 // addKeyHandler handles adding a single key
 func (h *Handler) addKeyHandler(w http.ResponseWriter, r *http.Request) {
 	var request struct {
-		Key         string `json:"key"`
-		Name        string `json:"name"`
-		Description string `json:"description"`
+		Key         string   `json:"key"`
+		Name        string   `json:"name"`
+		Description string   `json:"description"`
+		Pool        string   `json:"pool"`
+		Tags        []string `json:"tags"`
+		Validate    *bool    `json:"validate"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
@@ -511,6 +1152,12 @@ func (h *Handler) addKeyHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	tenant, status, message := h.requestTenant(r)
+	if status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
 	// Validate key format
 	if !strings.HasPrefix(request.Key, "tvly-") {
 		http.Error(w, "Invalid key format: key must start with 'tvly-'", http.StatusBadRequest)
@@ -526,12 +1173,31 @@ func (h *Handler) addKeyHandler(w http.ResponseWriter, r *http.Request) {
 		request.Name = "API Key"
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	tags, err := normalizeTags(request.Tags)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if request.Pool != "" && !poolPattern.MatchString(request.Pool) {
+		http.Error(w, "Invalid pool: must be 1-64 lowercase letters, digits or _.:- characters", http.StatusBadRequest)
+		return
+	}
+
+	if h.shouldValidate(request.Validate) {
+		if valid, reason := h.validateKey(request.Key); !valid {
+			http.Error(w, "Key "+reason, http.StatusUnprocessableEntity)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 10*time.Second)
 	defer cancel()
 
-	createdKey, err := h.keyRepo.CreateKey(ctx, request.Key, request.Name, request.Description)
+	// The pool and tags are stored with the key, so a key is never added half-configured
+	createdKey, err := h.keyRepo.CreateKey(ctx, request.Key, request.Name, request.Description, tenantOrDefault(tenant), request.Pool, tags)
 	if err != nil {
-		if strings.Contains(err.Error(), "Duplicate entry") {
+		if err == repository.ErrDuplicateKey {
 			http.Error(w, "Key already exists", http.StatusConflict)
 			return
 		}
@@ -545,6 +1211,8 @@ func (h *Handler) addKeyHandler(w http.ResponseWriter, r *http.Request) {
 		"key_name": createdKey.Name,
 	}).Info("New API key added")
 
+	h.reloadKeys()
+
 	response := map[string]interface{}{
 		"status":  "success",
 		"message": "API key added successfully",
@@ -552,7 +1220,10 @@ func (h *Handler) addKeyHandler(w http.ResponseWriter, r *http.Request) {
 			"id":          createdKey.ID,
 			"name":        createdKey.Name,
 			"description": createdKey.Description,
-			"key_preview": createdKey.KeyValue[:12] + "...",
+			"key_preview": types.KeyPreview(createdKey.KeyValue),
+			"pool":        createdKey.Pool,
+			"tenant":      createdKey.Tenant,
+			"tags":        tags,
 			"created_at":  createdKey.CreatedAt,
 		},
 	}
@@ -576,12 +1247,18 @@ func (h *Handler) deleteKeyHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	tenant, status, message := h.requestTenant(r)
+	if status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 10*time.Second)
 	defer cancel()
 
 	// Get key details before deletion for logging
 	key, err := h.keyRepo.GetKeyByID(ctx, id)
-	if err != nil {
+	if err != nil || !tenantOwnsKey(tenant, key) {
 		http.Error(w, "Key not found", http.StatusNotFound)
 		return
 	}
@@ -597,6 +1274,8 @@ func (h *Handler) deleteKeyHandler(w http.ResponseWriter, r *http.Request) {
 		"key_name": key.Name,
 	}).Info("API key deleted")
 
+	h.reloadKeys()
+
 	response := map[string]interface{}{
 		"status":  "success",
 		"message": "API key deleted successfully",
@@ -606,11 +1285,295 @@ func (h *Handler) deleteKeyHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// KeyDetailHandler handles GET /api/keys/{id} requests
+func (h *Handler) KeyDetailHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid key ID", http.StatusBadRequest)
+		return
+	}
+
+	tenant, status, message := h.requestTenant(r)
+	if status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	key, err := h.keyRepo.GetKeyByID(ctx, id)
+	if err != nil || !tenantOwnsKey(tenant, key) {
+		http.Error(w, "Key not found", http.StatusNotFound)
+		return
+	}
+
+	stats, err := h.keyRepo.GetKeyStats(ctx, key.KeyValue)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to fetch key stats")
+		http.Error(w, "Failed to fetch key stats", http.StatusInternalServerError)
+		return
+	}
+
+	history, err := h.keyRepo.GetBlacklistHistory(ctx, key.KeyValue)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to fetch blacklist history")
+		http.Error(w, "Failed to fetch blacklist history", http.StatusInternalServerError)
+		return
+	}
+
+	tags, err := h.keyRepo.GetKeyTags(ctx, key.ID)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to fetch key tags")
+		http.Error(w, "Failed to fetch key tags", http.StatusInternalServerError)
+		return
+	}
+
+	budget, err := h.keyRepo.GetKeyBudget(ctx, key.ID)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to fetch key budget")
+		http.Error(w, "Failed to fetch key budget", http.StatusInternalServerError)
+		return
+	}
+
+	blacklistHistory := make([]map[string]interface{}, len(history))
+	for i, entry := range history {
+		blacklistHistory[i] = blacklistHistoryEntry(entry, false)
+	}
+
+	response := map[string]interface{}{
+		"id":                key.ID,
+		"name":              key.Name,
+		"description":       key.Description,
+		"key_preview":       types.KeyPreview(key.KeyValue),
+		"is_active":         key.IsActive,
+		"is_blacklisted":    key.IsBlacklisted,
+		"blacklisted_until": key.BlacklistedUntil,
+		"blacklist_reason":  key.BlacklistReason,
+		"pool":              key.Pool,
+		"tenant":            key.Tenant,
+		"tags":              tags,
+		"budget":            budget,
+		"created_at":        key.CreatedAt,
+		"updated_at":        key.UpdatedAt,
+		"counters": map[string]interface{}{
+			"requests_count": stats.RequestsCount,
+			"errors_count":   stats.ErrorsCount,
+			"last_used_at":   stats.LastUsedAt,
+			"last_error_at":  stats.LastErrorAt,
+		},
+		"blacklist_history": blacklistHistory,
+	}
+
+	if status, ok := h.keyManager.GetKeyStatus(key.KeyValue); ok {
+		response["status"] = status
+	}
+	if budgetStatus := h.keyManager.BudgetStatus(key.KeyValue); budgetStatus != nil {
+		response["budget_status"] = budgetStatus
+	}
+
+	if usageTracker := h.getUsageTracker(); usageTracker != nil {
+		if usage, err := usageTracker.GetUsage(key.KeyValue); err == nil {
+			response["usage"] = usage
+		}
+		if remaining, err := usageTracker.CalculateRemainingPoints(key.KeyValue); err == nil {
+			response["remaining_points"] = remaining
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// UpdateKeyHandler handles PATCH /api/keys/{id} requests
+func (h *Handler) UpdateKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid key ID", http.StatusBadRequest)
+		return
+	}
+
+	tenant, status, message := h.requestTenant(r)
+	if status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	var request struct {
+		Name        *string               `json:"name"`
+		Description *string               `json:"description"`
+		IsActive    *bool                 `json:"is_active"`
+		Pool        *string               `json:"pool"`
+		Tags        *[]string             `json:"tags"`
+		Budget      *repository.KeyBudget `json:"budget"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 10*time.Second)
+	defer cancel()
+
+	key, err := h.keyRepo.GetKeyByID(ctx, id)
+	if err != nil || !tenantOwnsKey(tenant, key) {
+		http.Error(w, "Key not found", http.StatusNotFound)
+		return
+	}
+
+	name, description, pool, isActive := key.Name, key.Description, key.Pool, key.IsActive
+	if request.Name != nil {
+		if *request.Name == "" {
+			http.Error(w, "Name cannot be empty", http.StatusBadRequest)
+			return
+		}
+		name = *request.Name
+	}
+	if request.Description != nil {
+		description = *request.Description
+	}
+	if request.IsActive != nil {
+		isActive = *request.IsActive
+	}
+	if request.Pool != nil {
+		if !poolPattern.MatchString(*request.Pool) {
+			http.Error(w, "Invalid pool: must be 1-64 lowercase letters, digits or _.:- characters", http.StatusBadRequest)
+			return
+		}
+		pool = *request.Pool
+	}
+
+	var tags []string
+	if request.Tags != nil {
+		if tags, err = normalizeTags(*request.Tags); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if request.Budget != nil {
+		if err := validateKeyBudget(*request.Budget); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	updatedKey, err := h.keyRepo.UpdateKey(ctx, id, name, description, pool, isActive)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to update key")
+		http.Error(w, "Failed to update key", http.StatusInternalServerError)
+		return
+	}
+
+	if request.Tags != nil {
+		if err := h.keyRepo.SetKeyTags(ctx, id, tags); err != nil {
+			h.logger.WithError(err).Error("Failed to update key tags")
+			http.Error(w, "Failed to update key tags", http.StatusInternalServerError)
+			return
+		}
+	} else if tags, err = h.keyRepo.GetKeyTags(ctx, id); err != nil {
+		h.logger.WithError(err).Warn("Failed to fetch key tags")
+	}
+
+	var budget repository.KeyBudget
+	if request.Budget != nil {
+		budget = *request.Budget
+		if err := h.keyRepo.SetKeyBudget(ctx, id, budget); err != nil {
+			h.logger.WithError(err).Error("Failed to update key budget")
+			http.Error(w, "Failed to update key budget", http.StatusInternalServerError)
+			return
+		}
+	} else if budget, err = h.keyRepo.GetKeyBudget(ctx, id); err != nil {
+		h.logger.WithError(err).Warn("Failed to fetch key budget")
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"key_id":    updatedKey.ID,
+		"key_name":  updatedKey.Name,
+		"is_active": updatedKey.IsActive,
+	}).Info("API key updated")
+
+	// Activating, deactivating or moving a key changes the rotation pools, and
+	// budgets are loaded along with them
+	if updatedKey.IsActive != key.IsActive || updatedKey.Pool != key.Pool || request.Budget != nil {
+		h.reloadKeys()
+	}
+
+	response := map[string]interface{}{
+		"status":  "success",
+		"message": "API key updated successfully",
+		"key": map[string]interface{}{
+			"id":          updatedKey.ID,
+			"name":        updatedKey.Name,
+			"description": updatedKey.Description,
+			"key_preview": types.KeyPreview(updatedKey.KeyValue),
+			"is_active":   updatedKey.IsActive,
+			"pool":        updatedKey.Pool,
+			"tenant":      updatedKey.Tenant,
+			"tags":        tags,
+			"budget":      budget,
+			"updated_at":  updatedKey.UpdatedAt,
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// UnblacklistKeyHandler handles POST /api/keys/{id}/unblacklist requests
+func (h *Handler) UnblacklistKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid key ID", http.StatusBadRequest)
+		return
+	}
+
+	tenant, status, message := h.requestTenant(r)
+	if status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 10*time.Second)
+	defer cancel()
+
+	key, err := h.keyRepo.GetKeyByID(ctx, id)
+	if err != nil || !tenantOwnsKey(tenant, key) {
+		http.Error(w, "Key not found", http.StatusNotFound)
+		return
+	}
+
+	if err := h.keyManager.UnblacklistKey(ctx, key.KeyValue); err != nil {
+		h.logger.WithError(err).Error("Failed to unblacklist key")
+		http.Error(w, "Failed to unblacklist key", http.StatusInternalServerError)
+		return
+	}
+
+	// Keys blacklisted in the database are left out of the pool until they are reloaded
+	if key.IsBlacklisted {
+		h.reloadKeys()
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"key_id":   key.ID,
+		"key_name": key.Name,
+	}).Info("API key unblacklisted")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"message": "API key removed from blacklist",
+	})
+}
+
 // BulkImportKeysHandler handles POST /api/keys/bulk-import requests
 func (h *Handler) BulkImportKeysHandler(w http.ResponseWriter, r *http.Request) {
 	var request struct {
-		Keys   string `json:"keys"`   // Text with keys separated by newlines
-		Prefix string `json:"prefix"` // Optional prefix for naming
+		Keys     string `json:"keys"`     // Text with keys separated by newlines
+		Prefix   string `json:"prefix"`   // Optional prefix for naming
+		Validate *bool  `json:"validate"` // Optional override of VALIDATE_KEYS_ON_IMPORT
+		Async    *bool  `json:"async"`    // Optional override of IMPORT_ASYNC_THRESHOLD
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
@@ -623,16 +1586,27 @@ func (h *Handler) BulkImportKeysHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	tenant, status, message := h.requestTenant(r)
+	if status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
 	keys := h.parseKeysFromText(request.Keys)
 	if len(keys) == 0 {
 		http.Error(w, "No valid keys found in the provided text", http.StatusBadRequest)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	if h.shouldImportAsync(request.Async, len(keys)) {
+		h.startImportJob(w, r, keys, request.Prefix, h.shouldValidate(request.Validate), tenantOrDefault(tenant))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 30*time.Second)
 	defer cancel()
 
-	results := h.importKeysToDatabase(ctx, keys, request.Prefix)
+	results := h.importKeysToDatabase(ctx, keys, request.Prefix, h.shouldValidate(request.Validate), tenantOrDefault(tenant))
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(results)
@@ -640,48 +1614,98 @@ func (h *Handler) BulkImportKeysHandler(w http.ResponseWriter, r *http.Request)
 
 // FileUploadKeysHandler handles POST /api/keys/upload requests
 func (h *Handler) FileUploadKeysHandler(w http.ResponseWriter, r *http.Request) {
-	// Parse multipart form
-	err := r.ParseMultipartForm(10 << 20) // 10 MB max
-	if err != nil {
-		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+	if h.config.MaxUploadSizeMB > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, int64(h.config.MaxUploadSizeMB)<<20)
+	}
+
+	tenant, status, message := h.requestTenant(r)
+	if status != 0 {
+		http.Error(w, message, status)
 		return
 	}
 
-	file, header, err := r.FormFile("file")
+	// Stream the multipart body so large key files are never buffered in full
+	reader, err := r.MultipartReader()
 	if err != nil {
-		http.Error(w, "Failed to get file from form", http.StatusBadRequest)
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
 		return
 	}
-	defer file.Close()
 
-	// Validate file type
-	if !strings.HasSuffix(strings.ToLower(header.Filename), ".txt") {
-		http.Error(w, "Only .txt files are allowed", http.StatusBadRequest)
-		return
+	var (
+		keys     []string
+		filename string
+		prefix   string
+		validate *bool
+		async    *bool
+	)
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+
+		switch part.FormName() {
+		case "file":
+			filename = part.FileName()
+			// Validate file type
+			if !strings.HasSuffix(strings.ToLower(filename), ".txt") {
+				part.Close()
+				http.Error(w, "Only .txt files are allowed", http.StatusBadRequest)
+				return
+			}
+
+			keys, err = h.parseKeys(part)
+			if err != nil {
+				part.Close()
+				h.logger.WithError(err).Error("Failed to read uploaded key file")
+				http.Error(w, "Failed to read file content", http.StatusBadRequest)
+				return
+			}
+		case "prefix":
+			prefix = readFormValue(part)
+		case "validate":
+			if value, err := strconv.ParseBool(readFormValue(part)); err == nil {
+				validate = &value
+			}
+		case "async":
+			if value, err := strconv.ParseBool(readFormValue(part)); err == nil {
+				async = &value
+			}
+		}
+		part.Close()
 	}
 
-	// Read file content
-	content := make([]byte, header.Size)
-	_, err = file.Read(content)
-	if err != nil {
-		http.Error(w, "Failed to read file content", http.StatusInternalServerError)
+	if filename == "" {
+		http.Error(w, "Failed to get file from form", http.StatusBadRequest)
 		return
 	}
 
-	keys := h.parseKeysFromText(string(content))
 	if len(keys) == 0 {
 		http.Error(w, "No valid keys found in the uploaded file", http.StatusBadRequest)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	if h.shouldImportAsync(async, len(keys)) {
+		h.logger.WithFields(logrus.Fields{
+			"filename":   filename,
+			"keys_found": len(keys),
+		}).Info("Starting import job for file upload")
+		h.startImportJob(w, r, keys, prefix, h.shouldValidate(validate), tenantOrDefault(tenant))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 30*time.Second)
 	defer cancel()
 
-	prefix := r.FormValue("prefix")
-	results := h.importKeysToDatabase(ctx, keys, prefix)
+	results := h.importKeysToDatabase(ctx, keys, prefix, h.shouldValidate(validate), tenantOrDefault(tenant))
 
 	h.logger.WithFields(logrus.Fields{
-		"filename":      header.Filename,
+		"filename":      filename,
 		"keys_found":    len(keys),
 		"keys_imported": results["imported_count"],
 	}).Info("Keys imported from file upload")
@@ -690,10 +1714,26 @@ func (h *Handler) FileUploadKeysHandler(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(results)
 }
 
+// maxFormValueSize bounds the plain form fields read alongside an uploaded key file
+const maxFormValueSize = 1024
+
+// readFormValue reads a small, non-file multipart field
+func readFormValue(part io.Reader) string {
+	value, _ := io.ReadAll(io.LimitReader(part, maxFormValueSize))
+	return strings.TrimSpace(string(value))
+}
+
 // parseKeysFromText parses API keys from text content
 func (h *Handler) parseKeysFromText(text string) []string {
+	keys, _ := h.parseKeys(strings.NewReader(text))
+	return keys
+}
+
+// parseKeys parses API keys line by line from a reader
+func (h *Handler) parseKeys(r io.Reader) ([]string, error) {
 	var keys []string
-	scanner := bufio.NewScanner(strings.NewReader(text))
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
 	lineNum := 0
 
 	for scanner.Scan() {
@@ -714,59 +1754,72 @@ func (h *Handler) parseKeysFromText(text string) []string {
 		keys = append(keys, line)
 	}
 
-	return keys
+	return keys, scanner.Err()
 }
 
-// importKeysToDatabase imports multiple keys to the database
-func (h *Handler) importKeysToDatabase(ctx context.Context, keys []string, namePrefix string) map[string]interface{} {
-	imported := 0
-	skipped := 0
-	errors := 0
-	errorDetails := []string{}
+// importKeysToDatabase imports multiple keys to the database for a tenant
+func (h *Handler) importKeysToDatabase(ctx context.Context, keys []string, namePrefix string, validate bool, tenant string) map[string]interface{} {
+	job := newImportJob(len(keys), validate, tenant)
+	h.importKeys(ctx, job, keys, namePrefix)
+	return job.report()
+}
 
-	if namePrefix == "" {
-		namePrefix = "Imported Key"
-	}
+// tagPattern restricts tags to short lowercase labels such as team-a or paid
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.:-]{0,63}$`)
 
-	for i, key := range keys {
-		name := fmt.Sprintf("%s %d", namePrefix, i+1)
-		description := "Imported via web interface"
-
-		if _, err := h.keyRepo.CreateKey(ctx, key, name, description); err != nil {
-			if strings.Contains(err.Error(), "Duplicate entry") {
-				skipped++
-				h.logger.Debugf("Key %s already exists, skipping", key[:12]+"...")
-			} else {
-				errors++
-				errorMsg := fmt.Sprintf("Key %s: %s", key[:12]+"...", err.Error())
-				errorDetails = append(errorDetails, errorMsg)
-				h.logger.WithError(err).Errorf("Failed to import key %s", key[:12]+"...")
-			}
-			continue
-		}
+// poolPattern restricts pool names the same way as tags
+var poolPattern = tagPattern
 
-		imported++
-		h.logger.Debugf("Imported key: %s", key[:12]+"...")
+// normalizeTags lowercases, validates, de-duplicates and sorts tags
+func normalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if !tagPattern.MatchString(tag) {
+			return nil, fmt.Errorf("invalid tag %q: tags must be 1-64 lowercase letters, digits or _.:- characters", tag)
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
 	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
 
-	results := map[string]interface{}{
-		"status":         "success",
-		"total_keys":     len(keys),
-		"imported_count": imported,
-		"skipped_count":  skipped,
-		"error_count":    errors,
+// PoolsHandler handles GET /api/pools requests
+func (h *Handler) PoolsHandler(w http.ResponseWriter, r *http.Request) {
+	tenant, status, message := h.requestTenant(r)
+	if status != 0 {
+		http.Error(w, message, status)
+		return
 	}
 
-	if errors > 0 {
-		results["errors"] = errorDetails
+	// Unscoped callers see every tenant's pools as tenant/pool
+	pools := h.keyManager.GetPools()
+	if tenant != "" {
+		pools = h.keyManager.GetTenantPools(tenant)
 	}
 
-	if imported == 0 {
-		results["status"] = "warning"
-		results["message"] = "No new keys were imported"
-	} else {
-		results["message"] = fmt.Sprintf("Successfully imported %d keys", imported)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"default_pool": h.config.DefaultKeyPool,
+		"pools":        pools,
+	})
+}
+
+// shouldValidate resolves a request's validate option against VALIDATE_KEYS_ON_IMPORT
+func (h *Handler) shouldValidate(requested *bool) bool {
+	if requested != nil {
+		return *requested
 	}
+	return h.config.ValidateKeysOnImport
+}
 
-	return results
+// reloadKeys makes the key manager pick up keys added or removed through the API
+func (h *Handler) reloadKeys() {
+	if err := h.keyManager.KeysChanged(); err != nil {
+		h.logger.WithError(err).Error("Failed to reload API keys")
+	}
 }
@@ -0,0 +1,358 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/cache"
+	"github.com/dbccccccc/tavily-load/internal/config"
+	"github.com/dbccccccc/tavily-load/internal/keymanager"
+	"github.com/dbccccccc/tavily-load/internal/middleware"
+	"github.com/dbccccccc/tavily-load/internal/repository"
+	"github.com/dbccccccc/tavily-load/pkg/tavilymock"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	testKeyA = "tvly-aaaaaaaaaaaaaaaa"
+	testKeyB = "tvly-bbbbbbbbbbbbbbbb"
+)
+
+// proxyTest runs /search requests through a Handler and key manager rotating
+// keys from TAVILY_API_KEYS against a tavilymock server
+type proxyTest struct {
+	mock    *tavilymock.Server
+	keys    *keymanager.Manager
+	api     *Handler
+	handler http.Handler
+}
+
+// newProxyTest starts a mock and a handler rotating keys. env overrides the
+// settings that keep retries fast and deterministic.
+func newProxyTest(t *testing.T, keys []string, env map[string]string) *proxyTest {
+	t.Helper()
+
+	mock := tavilymock.New()
+	t.Cleanup(mock.Close)
+
+	settings := map[string]string{
+		"KEY_SOURCE":            "env",
+		"TAVILY_API_KEYS":       strings.Join(keys, ","),
+		"TAVILY_BASE_URL":       mock.URL(),
+		"RETRY_BACKOFF_BASE_MS": "0",
+		"RETRY_BACKOFF_MAX_MS":  "0",
+	}
+	for name, value := range env {
+		settings[name] = value
+	}
+	for name, value := range settings {
+		t.Setenv(name, value)
+	}
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	cfg, err := config.NewManager(logger).Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	store := cache.NewMemoryCache()
+	km, err := keymanager.NewManager(cfg, logger, nil, store, http.DefaultTransport)
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	h := NewHandler(km, cfg, logger, nil, store, nil, http.DefaultTransport)
+
+	return &proxyTest{
+		mock:    mock,
+		keys:    km,
+		api:     h,
+		handler: middleware.NewRequestIDMiddleware(cfg, logger).Handler(http.HandlerFunc(h.TavilySearchHandler)),
+	}
+}
+
+// search sends a search request through the proxy and returns its status
+func (p *proxyTest) search(t *testing.T) int {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/search", strings.NewReader(`{"query":"load balancing"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	p.handler.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+// blacklisted reports whether key is on the key manager's blacklist, and
+// whether permanently
+func (p *proxyTest) blacklisted(key string) (bool, bool) {
+	for _, entry := range p.keys.GetBlacklist() {
+		if entry.Key == key {
+			return true, entry.Permanent
+		}
+	}
+	return false, false
+}
+
+func TestProxyRetriesTransientErrors(t *testing.T) {
+	test := newProxyTest(t, []string{testKeyA}, map[string]string{
+		"MAX_RETRIES":         "3",
+		"BLACKLIST_THRESHOLD": "5",
+	})
+	test.mock.FailNext(testKeyA, http.StatusInternalServerError, 2)
+
+	if code := test.search(t); code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 after retrying", code)
+	}
+	if got := test.mock.Requests(testKeyA); got != 3 {
+		t.Errorf("upstream requests = %d, want 3", got)
+	}
+	if listed, _ := test.blacklisted(testKeyA); listed {
+		t.Error("key was blacklisted below BLACKLIST_THRESHOLD")
+	}
+}
+
+func TestProxyGivesUpAfterMaxRetries(t *testing.T) {
+	test := newProxyTest(t, []string{testKeyA}, map[string]string{
+		"MAX_RETRIES":         "2",
+		"BLACKLIST_THRESHOLD": "10",
+	})
+	test.mock.FailNext(testKeyA, http.StatusInternalServerError, 5)
+
+	if code := test.search(t); code < http.StatusInternalServerError {
+		t.Fatalf("status = %d, want a 5xx once retries are exhausted", code)
+	}
+	if got := test.mock.Requests(testKeyA); got != 3 {
+		t.Errorf("upstream requests = %d, want 3 (the first attempt and 2 retries)", got)
+	}
+}
+
+func TestProxyBlacklistsRevokedKeyAndFailsOver(t *testing.T) {
+	test := newProxyTest(t, []string{testKeyA, testKeyB}, map[string]string{
+		"MAX_RETRIES":        "2",
+		"QUARANTINE_ENABLED": "false",
+	})
+	test.mock.Revoke(testKeyA)
+
+	for i := 0; i < 4; i++ {
+		if code := test.search(t); code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want 200 from the other key", i+1, code)
+		}
+	}
+
+	if got := test.mock.Requests(testKeyA); got != 1 {
+		t.Errorf("revoked key received %d requests, want 1 before it was blacklisted", got)
+	}
+	if got := test.mock.Usage(testKeyB); got != 4 {
+		t.Errorf("healthy key spent %d credits, want 4", got)
+	}
+	if listed, permanent := test.blacklisted(testKeyA); !listed || !permanent {
+		t.Errorf("revoked key blacklisted = %v, permanent = %v, want both", listed, permanent)
+	}
+	if listed, _ := test.blacklisted(testKeyB); listed {
+		t.Error("healthy key was blacklisted")
+	}
+}
+
+func TestProxyFailsOverFromExhaustedKey(t *testing.T) {
+	test := newProxyTest(t, []string{testKeyA, testKeyB}, map[string]string{
+		"MAX_RETRIES": "2",
+	})
+	test.mock.SetQuota(testKeyA, 1)
+
+	for i := 0; i < 6; i++ {
+		if code := test.search(t); code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want 200 from the other key", i+1, code)
+		}
+	}
+
+	if got := test.mock.Usage(testKeyA); got != 1 {
+		t.Errorf("exhausted key spent %d credits, want its quota of 1", got)
+	}
+	if got := test.mock.Requests(testKeyA); got != 2 {
+		t.Errorf("exhausted key received %d requests, want 2 (one success, one 432)", got)
+	}
+	if got := test.mock.Usage(testKeyB); got != 5 {
+		t.Errorf("other key spent %d credits, want 5", got)
+	}
+	if listed, _ := test.blacklisted(testKeyA); !listed {
+		t.Error("exhausted key was not blacklisted")
+	}
+}
+
+func TestProxyIgnoresClientCancellation(t *testing.T) {
+	test := newProxyTest(t, []string{testKeyA, testKeyB}, map[string]string{
+		"MAX_RETRIES":                "2",
+		"BLACKLIST_THRESHOLD":        "1",
+		"UPSTREAM_BREAKER_THRESHOLD": "1",
+		"UPSTREAM_BREAKER_MIN_KEYS":  "1",
+	})
+	test.mock.SetLatency(200 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodPost, "/search", strings.NewReader(`{"query":"load balancing"}`)).WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	test.handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	for _, key := range []string{testKeyA, testKeyB} {
+		if listed, _ := test.blacklisted(key); listed {
+			t.Errorf("key %s was blacklisted for a client that left", key)
+		}
+	}
+
+	// The upstream breaker stayed closed, so the next request goes through
+	test.mock.SetLatency(0)
+	if code := test.search(t); code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 with the upstream breaker closed", code)
+	}
+}
+
+func TestHealthUnhealthyWithoutActiveKeys(t *testing.T) {
+	test := newProxyTest(t, []string{testKeyA}, map[string]string{
+		"MAX_RETRIES":        "0",
+		"QUARANTINE_ENABLED": "false",
+	})
+
+	if status := test.api.Health().Status; status != "healthy" {
+		t.Fatalf("status = %q, want healthy with an active key", status)
+	}
+
+	test.mock.Revoke(testKeyA)
+	test.search(t)
+	if listed, _ := test.blacklisted(testKeyA); !listed {
+		t.Fatal("revoked key was not blacklisted")
+	}
+	if status := test.api.Health().Status; status != "unhealthy" {
+		t.Fatalf("status = %q, want unhealthy without an active key", status)
+	}
+}
+
+func TestPinnedKeyMustBelongToThePool(t *testing.T) {
+	mock := tavilymock.New()
+	t.Cleanup(mock.Close)
+	for name, value := range map[string]string{
+		"KEY_SOURCE":      "database",
+		"DB_DRIVER":       "sqlite",
+		"DB_PATH":         t.TempDir() + "/unused.db",
+		"TAVILY_BASE_URL": mock.URL(),
+	} {
+		t.Setenv(name, value)
+	}
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	cfg, err := config.NewManager(logger).Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	ctx := context.Background()
+	repo := repository.NewMemoryKeyRepository()
+	if _, err := repo.CreateKey(ctx, testKeyA, "a", "", repository.DefaultTenant, "", nil); err != nil {
+		t.Fatalf("CreateKey: %v", err)
+	}
+	if _, err := repo.CreateKey(ctx, testKeyB, "b", "", repository.DefaultTenant, "batch", nil); err != nil {
+		t.Fatalf("CreateKey: %v", err)
+	}
+
+	store := cache.NewMemoryCache()
+	km, err := keymanager.NewManager(cfg, logger, repo, store, http.DefaultTransport)
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	h := NewHandler(km, cfg, logger, repo, store, nil, http.DefaultTransport)
+	handler := middleware.NewRequestIDMiddleware(cfg, logger).Handler(http.HandlerFunc(h.TavilySearchHandler))
+
+	search := func(pinned string) int {
+		req := httptest.NewRequest(http.MethodPost, "/search", strings.NewReader(`{"query":"load balancing"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(useKeyHeader, pinned)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := search("a"); code != http.StatusOK {
+		t.Fatalf("pinning a key of the default pool: status = %d, want 200", code)
+	}
+	if code := search("b"); code != http.StatusBadRequest {
+		t.Fatalf("pinning a key of another pool: status = %d, want 400", code)
+	}
+	if got := mock.Requests(testKeyB); got != 0 {
+		t.Errorf("key of another pool received %d requests, want 0", got)
+	}
+}
+
+func TestJobsArePolledOnlyByTheirCreator(t *testing.T) {
+	p := newProxyTest(t, []string{testKeyA}, nil)
+
+	// withToken makes a request look like it passed the auth middleware with a token
+	withToken := func(req *http.Request, id int64, scopes ...string) *http.Request {
+		ctx := context.WithValue(req.Context(), middleware.AuthTokenKey{}, &repository.AuthToken{ID: id, IsActive: true, Scopes: scopes})
+		ctx = context.WithValue(ctx, middleware.AuthScopesKey{}, scopes)
+		return req.WithContext(ctx)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/jobs", strings.NewReader(`{"endpoint":"/search","body":{"query":"load balancing"}}`))
+	rec := httptest.NewRecorder()
+	p.api.CreateJobHandler(rec, withToken(req, 1))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("create job: status = %d, want 202", rec.Code)
+	}
+	id := strings.TrimPrefix(rec.Header().Get("Location"), "/api/jobs/")
+
+	poll := func(req *http.Request) int {
+		rec := httptest.NewRecorder()
+		p.api.JobHandler(rec, mux.SetURLVars(req, map[string]string{"id": id}))
+		return rec.Code
+	}
+	get := func() *http.Request { return httptest.NewRequest(http.MethodGet, "/api/jobs/"+id, nil) }
+
+	if code := poll(withToken(get(), 1)); code != http.StatusOK {
+		t.Errorf("creating token: status = %d, want 200", code)
+	}
+	if code := poll(withToken(get(), 2)); code != http.StatusNotFound {
+		t.Errorf("other token: status = %d, want 404", code)
+	}
+	if code := poll(withToken(get(), 3, middleware.ScopeAdmin)); code != http.StatusOK {
+		t.Errorf("admin token: status = %d, want 200", code)
+	}
+}
+
+func TestJobsAreRefusedWhileEverySlotIsBusy(t *testing.T) {
+	p := newProxyTest(t, []string{testKeyA}, map[string]string{"JOB_MAX_CONCURRENT": "1"})
+	p.api.jobSlots <- struct{}{}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/jobs", strings.NewReader(`{"endpoint":"/search","body":{"query":"load balancing"}}`))
+	rec := httptest.NewRecorder()
+	p.api.CreateJobHandler(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503 while the only job slot is busy", rec.Code)
+	}
+}
+
+func TestHedgeLatencySamplesOnlyForHedgedEndpoints(t *testing.T) {
+	p := newProxyTest(t, []string{testKeyA}, map[string]string{"HEDGE_ENABLED": "true", "HEDGE_ENDPOINTS": "/search"})
+
+	p.api.recordLatency("/search?debug=1", time.Millisecond)
+	p.api.recordLatency("/extract", time.Millisecond)
+	for i := 0; i < 2*maxLatencyEndpoints; i++ {
+		p.api.latencies.record("/tavily/"+strconv.Itoa(i), time.Millisecond)
+	}
+
+	if got := len(p.api.latencies.samples["/search"]); got != 1 {
+		t.Errorf("/search samples = %d, want 1 recorded without its query", got)
+	}
+	if _, ok := p.api.latencies.samples["/extract"]; ok {
+		t.Error("samples recorded for an endpoint that is not hedged")
+	}
+	if got := len(p.api.latencies.samples); got != maxLatencyEndpoints {
+		t.Errorf("tracked endpoints = %d, want the cap of %d", got, maxLatencyEndpoints)
+	}
+}
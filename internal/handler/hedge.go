@@ -0,0 +1,228 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// hedgeLatencySamples is how many recent upstream latencies each endpoint keeps
+	hedgeLatencySamples = 200
+	// hedgeMinSamples is how many latencies are needed before the p95 is trusted
+	hedgeMinSamples = 20
+)
+
+// latencyWindow keeps the most recent upstream latencies per endpoint so the hedge
+// threshold can follow Tavily's current p95
+type latencyWindow struct {
+	mu      sync.Mutex
+	samples map[string][]time.Duration
+	next    map[string]int
+}
+
+func newLatencyWindow() *latencyWindow {
+	return &latencyWindow{
+		samples: make(map[string][]time.Duration),
+		next:    make(map[string]int),
+	}
+}
+
+// record adds a latency sample, overwriting the oldest once the window is full.
+// Endpoints beyond maxLatencyEndpoints are not tracked.
+func (l *latencyWindow) record(endpoint string, latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	samples, ok := l.samples[endpoint]
+	if !ok && len(l.samples) >= maxLatencyEndpoints {
+		return
+	}
+	if len(samples) < hedgeLatencySamples {
+		l.samples[endpoint] = append(samples, latency)
+		return
+	}
+	samples[l.next[endpoint]] = latency
+	l.next[endpoint] = (l.next[endpoint] + 1) % hedgeLatencySamples
+}
+
+// percentile returns the p-th percentile latency of an endpoint, or false while
+// there are too few samples
+func (l *latencyWindow) percentile(endpoint string, p float64) (time.Duration, bool) {
+	l.mu.Lock()
+	samples := append([]time.Duration(nil), l.samples[endpoint]...)
+	l.mu.Unlock()
+
+	if len(samples) < hedgeMinSamples {
+		return 0, false
+	}
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	idx := int(float64(len(samples)-1) * p)
+	return samples[idx], true
+}
+
+// hedgesEndpoint reports whether requests to the endpoint, without its query
+// string, may be hedged
+func (h *Handler) hedgesEndpoint(endpoint string) bool {
+	if !h.config.HedgeEnabled {
+		return false
+	}
+	endpoint, _, _ = strings.Cut(endpoint, "?")
+	for _, e := range h.config.HedgeEndpoints {
+		if e == endpoint {
+			return true
+		}
+	}
+	return false
+}
+
+// hedgeDelay returns how long to wait for the first attempt before hedging, or
+// false when the request should not be hedged
+func (h *Handler) hedgeDelay(req *proxyRequest) (time.Duration, bool) {
+	if req.pinnedKey != "" || !h.hedgesEndpoint(req.endpoint) {
+		return 0, false
+	}
+
+	if delay := h.config.Reloadable().HedgeDelay; delay > 0 {
+		return delay, true
+	}
+
+	path, _, _ := strings.Cut(req.endpoint, "?")
+	delay, ok := h.latencies.percentile(path, 0.95)
+	if !ok {
+		return 0, false
+	}
+	if delay < h.config.HedgeMinDelay {
+		delay = h.config.HedgeMinDelay
+	}
+	return delay, true
+}
+
+// recordLatency keeps an upstream latency sample for the hedge threshold. Only
+// hedged endpoints need samples, and they are kept per path without the query.
+func (h *Handler) recordLatency(endpoint string, latency time.Duration) {
+	if !h.hedgesEndpoint(endpoint) {
+		return
+	}
+	path, _, _ := strings.Cut(endpoint, "?")
+	h.latencies.record(path, latency)
+}
+
+// hedgeResult is the outcome of one of the racing upstream requests
+type hedgeResult struct {
+	apiKey string
+	resp   *http.Response
+	err    error
+}
+
+// cancelOnClose releases a request's context once its body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// doUpstream sends the request on apiKey and, when hedging applies and Tavily has
+// not answered within the hedge delay, races the same request on a second key.
+// The first success wins and the other request is cancelled; the returned key is
+// the one that served the response.
+func (h *Handler) doUpstream(r *http.Request, req *proxyRequest, apiKey string) (string, *http.Response, error) {
+	delay, hedge := h.hedgeDelay(req)
+	if !hedge {
+		start := time.Now()
+		resp, err := h.makeRequest(r.Context(), req.method, req.endpoint, apiKey, req.body, r.Header)
+		if err == nil {
+			h.recordLatency(req.endpoint, time.Since(start))
+		}
+		return apiKey, resp, err
+	}
+
+	results := make(chan hedgeResult, 2)
+	cancels := make(map[string]context.CancelFunc, 2)
+	launch := func(key string) {
+		ctx, cancel := context.WithCancel(r.Context())
+		cancels[key] = cancel
+		go func() {
+			start := time.Now()
+			resp, err := h.makeRequest(ctx, req.method, req.endpoint, key, req.body, r.Header)
+			if err == nil {
+				h.recordLatency(req.endpoint, time.Since(start))
+			}
+			results <- hedgeResult{apiKey: key, resp: resp, err: err}
+		}()
+	}
+
+	launch(apiKey)
+	inFlight := 1
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var primaryErr error
+	for {
+		select {
+		case <-timer.C:
+			hedgeKey, _, err := h.keyManager.SelectKeyForRequest(r.Context(), req.pool, "")
+			if err != nil || hedgeKey == apiKey {
+				continue
+			}
+			h.logger.WithFields(logrus.Fields{
+				"endpoint": req.endpoint,
+				"delay":    delay,
+				"key":      types.KeyPreview(hedgeKey),
+			}).Debug("Upstream slow, hedging request on a second key")
+			launch(hedgeKey)
+			inFlight++
+
+		case result := <-results:
+			inFlight--
+			if result.err == nil {
+				// Cancel the loser straight away and discard whatever it returns
+				for key, cancel := range cancels {
+					if key != result.apiKey {
+						cancel()
+					}
+				}
+				go drainHedge(results, inFlight)
+				if result.apiKey != apiKey {
+					h.logger.WithField("endpoint", req.endpoint).Debug("Hedged request won")
+				}
+				result.resp.Body = cancelOnClose{ReadCloser: result.resp.Body, cancel: cancels[result.apiKey]}
+				return result.apiKey, result.resp, nil
+			}
+
+			cancels[result.apiKey]()
+			if result.apiKey == apiKey {
+				primaryErr = result.err
+			} else if r.Context().Err() == nil {
+				// The first key's failure drives retries; a failed hedge only counts against its own key
+				h.keyManager.RecordError(result.apiKey, result.err)
+			}
+			if inFlight == 0 {
+				return apiKey, nil, primaryErr
+			}
+		}
+	}
+}
+
+// drainHedge discards the outcome of requests that lost the race
+func drainHedge(results chan hedgeResult, pending int) {
+	for i := 0; i < pending; i++ {
+		if result := <-results; result.resp != nil {
+			result.resp.Body.Close()
+		}
+	}
+}
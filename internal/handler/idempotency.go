@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/keymanager"
+	"github.com/dbccccccc/tavily-load/internal/repository"
+	"github.com/dbccccccc/tavily-load/pkg/types"
+)
+
+// idempotencyHeader lets clients mark a submission so duplicates are not billed twice
+const idempotencyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLength bounds the Idempotency-Key header value
+const maxIdempotencyKeyLength = 255
+
+// beginIdempotentRequest claims the request's Idempotency-Key before it is sent
+// upstream. A duplicate of a finished request is answered with the remembered
+// response, and a duplicate of one still in flight, including one the proxy is
+// retrying across keys, is rejected. It returns true when the request has been
+// answered.
+func (h *Handler) beginIdempotentRequest(w http.ResponseWriter, r *http.Request, req *proxyRequest) bool {
+	value := strings.TrimSpace(r.Header.Get(idempotencyHeader))
+	if value == "" || !h.config.IdempotencyEnabled || h.usageCache == nil {
+		return false
+	}
+	if len(value) > maxIdempotencyKeyLength {
+		h.stats.addError()
+		http.Error(w, "Idempotency-Key is too long", http.StatusBadRequest)
+		return true
+	}
+
+	// Keys are scoped per tenant so tenants cannot replay each other's responses
+	if tenant, _ := keymanager.SplitTenantPool(req.pool); tenant != repository.DefaultTenant {
+		value = tenant + ":" + value
+	}
+	keySum := sha256.Sum256([]byte(value))
+	key := strings.TrimPrefix(req.endpoint, "/") + ":" + hex.EncodeToString(keySum[:])
+	requestHash := h.requestHash(req.body)
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 2*time.Second)
+	defer cancel()
+
+	reserved, err := h.usageCache.ReserveIdempotencyKey(ctx, key, &types.IdempotencyRecord{
+		RequestHash: requestHash,
+		CreatedAt:   time.Now(),
+	}, h.idempotencyLockTTL(req.endpoint))
+	if err != nil {
+		// Without Redis the request still goes through, just without protection
+		h.logger.WithError(err).Warn("Failed to reserve idempotency key")
+		return false
+	}
+	if reserved {
+		req.idempotencyKey = key
+		return false
+	}
+
+	record, err := h.usageCache.GetIdempotencyRecord(ctx, key)
+	if err != nil {
+		// The record expired between the two calls; treat it as still in flight
+		record = &types.IdempotencyRecord{RequestHash: requestHash}
+	}
+
+	switch {
+	case record.RequestHash != requestHash:
+		h.stats.addError()
+		http.Error(w, "Idempotency-Key was already used with a different request body", http.StatusUnprocessableEntity)
+	case record.Response == nil:
+		h.stats.addError()
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "A request with this Idempotency-Key is still in progress", http.StatusConflict)
+	default:
+		h.stats.addSuccess()
+		header := http.Header{}
+		header.Set("Content-Type", record.Response.ContentType)
+		w.Header().Set("Idempotent-Replayed", "true")
+		h.writeBufferedResponse(w, record.Response.StatusCode, header, record.Response.Body, req.filter)
+	}
+	return true
+}
+
+// idempotencyLockTTL bounds how long an in-flight claim survives, so a crashed
+// instance cannot block a key for the whole retention window
+func (h *Handler) idempotencyLockTTL(endpoint string) time.Duration {
+	settings := h.config.Endpoint(endpoint)
+	attempts := time.Duration(settings.MaxRetries + 1)
+	return attempts*(settings.RequestTimeout+h.config.Reloadable().RetryBackoffMax) + 10*time.Second
+}
+
+// storeIdempotentResponse remembers the response served for the request's Idempotency-Key
+func (h *Handler) storeIdempotentResponse(ctx context.Context, req *proxyRequest, resp *http.Response, body []byte) {
+	record := &types.IdempotencyRecord{
+		RequestHash: h.requestHash(req.body),
+		Response: &types.CachedResponse{
+			StatusCode:  resp.StatusCode,
+			ContentType: resp.Header.Get("Content-Type"),
+			Body:        body,
+			CachedAt:    time.Now(),
+		},
+		CreatedAt: time.Now(),
+	}
+	req.idempotencyStored = true
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 2*time.Second)
+	defer cancel()
+	if err := h.usageCache.SetIdempotencyRecord(ctx, req.idempotencyKey, record, h.config.IdempotencyTTL); err != nil {
+		h.logger.WithError(err).Warn("Failed to store idempotent response")
+	}
+}
+
+// releaseIdempotencyKey drops the claim of a request that produced no response,
+// so the client can submit it again
+func (h *Handler) releaseIdempotencyKey(ctx context.Context, req *proxyRequest) {
+	if req.idempotencyKey == "" || req.idempotencyStored {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 2*time.Second)
+	defer cancel()
+	if err := h.usageCache.DeleteIdempotencyRecord(ctx, req.idempotencyKey); err != nil {
+		h.logger.WithError(err).Warn("Failed to release idempotency key")
+	}
+}
+
+// requestHash fingerprints a request body to detect reuse of an Idempotency-Key
+func (h *Handler) requestHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,367 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/events"
+	"github.com/dbccccccc/tavily-load/internal/repository"
+	"github.com/dbccccccc/tavily-load/pkg/types"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// importConcurrency bounds the number of keys validated and stored in parallel
+const importConcurrency = 5
+
+// Import job states
+const (
+	importJobRunning   = "running"
+	importJobCompleted = "completed"
+)
+
+// Per-key import outcomes
+const (
+	importOutcomeImported  = "imported"
+	importOutcomeDuplicate = "duplicate"
+	importOutcomeRejected  = "rejected"
+	importOutcomeError     = "error"
+)
+
+// importOutcome records what happened to a single imported key
+type importOutcome struct {
+	KeyPreview string `json:"key_preview"`
+	Status     string `json:"status"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+// importJob tracks the progress of a bulk key import
+type importJob struct {
+	mu sync.Mutex
+
+	ID         string          `json:"id"`
+	Status     string          `json:"status"`
+	Validated  bool            `json:"validated"`
+	Total      int             `json:"total_keys"`
+	Processed  int             `json:"processed_count"`
+	Imported   int             `json:"imported_count"`
+	Duplicates int             `json:"duplicate_count"`
+	Rejected   int             `json:"rejected_count"`
+	Errors     int             `json:"error_count"`
+	Outcomes   []importOutcome `json:"outcomes"`
+	CreatedAt  time.Time       `json:"created_at"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+
+	// tenant owns the imported keys
+	tenant string
+}
+
+func newImportJob(total int, validate bool, tenant string) *importJob {
+	return &importJob{
+		ID:        uuid.New().String(),
+		Status:    importJobRunning,
+		Validated: validate,
+		Total:     total,
+		tenant:    tenant,
+		Outcomes:  make([]importOutcome, 0, total),
+		CreatedAt: time.Now(),
+	}
+}
+
+// record adds the outcome of one key to the job
+func (j *importJob) record(key, status, reason string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.Processed++
+	switch status {
+	case importOutcomeImported:
+		j.Imported++
+	case importOutcomeDuplicate:
+		j.Duplicates++
+	case importOutcomeRejected:
+		j.Rejected++
+	case importOutcomeError:
+		j.Errors++
+	}
+	j.Outcomes = append(j.Outcomes, importOutcome{
+		KeyPreview: types.KeyPreview(key),
+		Status:     status,
+		Reason:     reason,
+	})
+}
+
+// finish marks the job as completed
+func (j *importJob) finish() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	j.Status = importJobCompleted
+	j.FinishedAt = &now
+}
+
+// snapshot returns a copy of the job that is safe to encode while the import runs
+func (j *importJob) snapshot() *importJob {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return &importJob{
+		ID:         j.ID,
+		Status:     j.Status,
+		Validated:  j.Validated,
+		Total:      j.Total,
+		Processed:  j.Processed,
+		Imported:   j.Imported,
+		Duplicates: j.Duplicates,
+		Rejected:   j.Rejected,
+		Errors:     j.Errors,
+		Outcomes:   append([]importOutcome(nil), j.Outcomes...),
+		CreatedAt:  j.CreatedAt,
+		FinishedAt: j.FinishedAt,
+		tenant:     j.tenant,
+	}
+}
+
+// report summarizes a finished job in the synchronous import response format
+func (j *importJob) report() map[string]interface{} {
+	job := j.snapshot()
+
+	results := map[string]interface{}{
+		"status":          "success",
+		"total_keys":      job.Total,
+		"imported_count":  job.Imported,
+		"skipped_count":   job.Duplicates,
+		"duplicate_count": job.Duplicates,
+		"error_count":     job.Errors,
+		"rejected_count":  job.Rejected,
+		"validated":       job.Validated,
+	}
+
+	var rejected []map[string]string
+	var duplicates []map[string]string
+	var errorDetails []string
+	for _, outcome := range job.Outcomes {
+		switch outcome.Status {
+		case importOutcomeDuplicate:
+			duplicates = append(duplicates, map[string]string{
+				"key_preview": outcome.KeyPreview,
+				"reason":      outcome.Reason,
+			})
+		case importOutcomeRejected:
+			rejected = append(rejected, map[string]string{
+				"key_preview": outcome.KeyPreview,
+				"reason":      outcome.Reason,
+			})
+		case importOutcomeError:
+			errorDetails = append(errorDetails, fmt.Sprintf("Key %s: %s", outcome.KeyPreview, outcome.Reason))
+		}
+	}
+
+	if len(rejected) > 0 {
+		results["rejected"] = rejected
+	}
+
+	if len(duplicates) > 0 {
+		results["duplicates"] = duplicates
+	}
+
+	if len(errorDetails) > 0 {
+		results["errors"] = errorDetails
+	}
+
+	if job.Imported == 0 {
+		results["status"] = "warning"
+		results["message"] = "No new keys were imported"
+	} else {
+		results["message"] = fmt.Sprintf("Successfully imported %d keys", job.Imported)
+	}
+
+	return results
+}
+
+// importJobStore keeps import jobs in memory until they expire
+type importJobStore struct {
+	mu   sync.Mutex
+	jobs map[string]*importJob
+	ttl  time.Duration
+}
+
+func newImportJobStore(ttl time.Duration) *importJobStore {
+	return &importJobStore{
+		jobs: make(map[string]*importJob),
+		ttl:  ttl,
+	}
+}
+
+// add stores a job and drops finished jobs older than the TTL
+func (s *importJobStore) add(job *importJob) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := time.Now().Add(-s.ttl)
+	for id, existing := range s.jobs {
+		existing.mu.Lock()
+		expired := existing.FinishedAt != nil && existing.FinishedAt.Before(cutoff)
+		existing.mu.Unlock()
+		if expired {
+			delete(s.jobs, id)
+		}
+	}
+
+	s.jobs[job.ID] = job
+}
+
+// get returns the job with the given ID
+func (s *importJobStore) get(id string) (*importJob, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	return job, ok
+}
+
+// importKeys validates and stores keys, recording every outcome in the job
+func (h *Handler) importKeys(ctx context.Context, job *importJob, keys []string, namePrefix string) {
+	if namePrefix == "" {
+		namePrefix = "Imported Key"
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, importConcurrency)
+	seen := make(map[string]bool, len(keys))
+
+	for i, key := range keys {
+		if seen[key] {
+			job.record(key, importOutcomeDuplicate, "repeated within the import")
+			continue
+		}
+		seen[key] = true
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, key string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			keyCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			defer cancel()
+
+			if job.Validated {
+				// Skip the Tavily call for keys that are already stored
+				if exists, err := h.keyRepo.KeyExists(keyCtx, key); err == nil && exists {
+					job.record(key, importOutcomeDuplicate, "already stored")
+					return
+				}
+				if valid, reason := h.validateKey(key); !valid {
+					job.record(key, importOutcomeRejected, reason)
+					return
+				}
+			}
+
+			name := fmt.Sprintf("%s %d", namePrefix, i+1)
+			description := "Imported via web interface"
+
+			if _, err := h.keyRepo.CreateKey(keyCtx, key, name, description, job.tenant, "", nil); err != nil {
+				if err == repository.ErrDuplicateKey {
+					job.record(key, importOutcomeDuplicate, "already stored")
+					h.logger.Debugf("Key %s already exists, skipping", types.KeyPreview(key))
+				} else {
+					job.record(key, importOutcomeError, err.Error())
+					h.logger.WithError(err).Errorf("Failed to import key %s", types.KeyPreview(key))
+				}
+				return
+			}
+
+			job.record(key, importOutcomeImported, "")
+			h.logger.Debugf("Imported key: %s", types.KeyPreview(key))
+		}(i, key)
+	}
+
+	wg.Wait()
+	job.finish()
+
+	result := job.snapshot()
+	if result.Imported > 0 {
+		h.reloadKeys()
+	}
+
+	h.events.Publish(events.Event{
+		Type: events.ImportCompleted,
+		Data: map[string]interface{}{
+			"job_id":          result.ID,
+			"tenant":          result.tenant,
+			"validated":       result.Validated,
+			"total_keys":      result.Total,
+			"imported_count":  result.Imported,
+			"duplicate_count": result.Duplicates,
+			"rejected_count":  result.Rejected,
+			"error_count":     result.Errors,
+		},
+	})
+}
+
+// shouldImportAsync decides whether an import runs as a background job
+func (h *Handler) shouldImportAsync(requested *bool, keyCount int) bool {
+	if requested != nil {
+		return *requested
+	}
+	return h.config.ImportAsyncThreshold > 0 && keyCount >= h.config.ImportAsyncThreshold
+}
+
+// startImportJob runs an import in the background and responds with the job to
+// poll. The job outlives r but keeps its context values, such as the actor its
+// keys are audited as added by.
+func (h *Handler) startImportJob(w http.ResponseWriter, r *http.Request, keys []string, namePrefix string, validate bool, tenant string) {
+	job := newImportJob(len(keys), validate, tenant)
+	h.importJobs.add(job)
+
+	go func() {
+		h.importKeys(context.WithoutCancel(r.Context()), job, keys, namePrefix)
+
+		summary := job.snapshot()
+		h.logger.WithFields(logrus.Fields{
+			"job_id":     summary.ID,
+			"total":      summary.Total,
+			"imported":   summary.Imported,
+			"duplicates": summary.Duplicates,
+			"rejected":   summary.Rejected,
+			"errors":     summary.Errors,
+		}).Info("Import job completed")
+	}()
+
+	statusURL := "/api/keys/import-jobs/" + job.ID
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", statusURL)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":     "accepted",
+		"job_id":     job.ID,
+		"total_keys": len(keys),
+		"validated":  validate,
+		"status_url": statusURL,
+	})
+}
+
+// ImportJobHandler handles GET /api/keys/import-jobs/{id} requests
+func (h *Handler) ImportJobHandler(w http.ResponseWriter, r *http.Request) {
+	tenant, status, message := h.requestTenant(r)
+	if status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	job, ok := h.importJobs.get(mux.Vars(r)["id"])
+	if !ok || (tenant != "" && job.tenant != tenant) {
+		http.Error(w, "Import job not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job.snapshot())
+}
@@ -0,0 +1,253 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/middleware"
+	"github.com/dbccccccc/tavily-load/internal/repository"
+	"github.com/dbccccccc/tavily-load/pkg/types"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// jobEndpoints are the Tavily endpoints that can run as background jobs
+var jobEndpoints = map[string]bool{
+	"/search":  true,
+	"/extract": true,
+	"/crawl":   true,
+	"/map":     true,
+}
+
+// jobResponseWriter collects the proxied response of a background job
+type jobResponseWriter struct {
+	header     http.Header
+	statusCode int
+	body       bytes.Buffer
+}
+
+func newJobResponseWriter() *jobResponseWriter {
+	return &jobResponseWriter{header: http.Header{}, statusCode: http.StatusOK}
+}
+
+func (w *jobResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *jobResponseWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *jobResponseWriter) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+}
+
+// CreateJobHandler handles POST /api/jobs requests, running a Tavily request in the
+// background so clients can poll for the result instead of holding a connection open
+func (h *Handler) CreateJobHandler(w http.ResponseWriter, r *http.Request) {
+	if h.usageCache == nil {
+		http.Error(w, "Job storage is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	var request struct {
+		Endpoint string          `json:"endpoint"`
+		Body     json.RawMessage `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	tenant, status, message := h.requestTenant(r)
+	if status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	if !jobEndpoints[request.Endpoint] {
+		http.Error(w, "endpoint must be one of /search, /extract, /crawl or /map", http.StatusBadRequest)
+		return
+	}
+	if len(request.Body) == 0 {
+		http.Error(w, "body is required", http.StatusBadRequest)
+		return
+	}
+	// The auth middleware only saw /jobs, so the caller's token is checked and
+	// charged against the endpoint the job calls
+	if !middleware.AuthorizeTokenEndpoint(w, r, request.Endpoint) {
+		return
+	}
+
+	// Jobs take a slot when they are created rather than queueing for one, so a
+	// burst of jobs is refused instead of piling up goroutines and request bodies
+	select {
+	case h.jobSlots <- struct{}{}:
+	default:
+		middleware.SettleTokenEndpoint(r.Context(), request.Endpoint, false)
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Too many jobs are running, try again later", http.StatusServiceUnavailable)
+		return
+	}
+
+	job := &types.Job{
+		ID:        uuid.New().String(),
+		Endpoint:  request.Endpoint,
+		Status:    types.JobQueued,
+		CreatedAt: time.Now(),
+		Tenant:    tenant,
+		TokenID:   requestTokenID(r),
+	}
+	// The job outlives this request but keeps its auth context, so it runs as the
+	// caller: scoped to their tenant and scopes, and audited as their actor
+	ctx := context.WithoutCancel(r.Context())
+	if err := h.saveJob(job); err != nil {
+		<-h.jobSlots
+		middleware.SettleTokenEndpoint(ctx, job.Endpoint, false)
+		h.logger.WithError(err).Error("Failed to store job")
+		http.Error(w, "Failed to create job", http.StatusInternalServerError)
+		return
+	}
+
+	// Only the headers that steer proxying are kept
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	for _, name := range []string{poolHeader, useKeyHeader, fieldsHeader, maxResultsHeader, cacheHeader} {
+		if value := r.Header.Get(name); value != "" {
+			header.Set(name, value)
+		}
+	}
+	// Callers without a token name their tenant in a header, so the resolved one is carried
+	if tenant != "" {
+		header.Set(tenantHeader, tenant)
+	}
+
+	go h.runJob(ctx, job, header, request.Body)
+
+	statusURL := "/api/jobs/" + job.ID
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", statusURL)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"job_id":     job.ID,
+		"status":     types.JobQueued, // runJob owns job from here on
+		"status_url": statusURL,
+	})
+}
+
+// runJob proxies the job's request with the creating request's context and stores
+// its outcome, then frees the job slot CreateJobHandler took
+func (h *Handler) runJob(ctx context.Context, job *types.Job, header http.Header, body []byte) {
+	defer func() { <-h.jobSlots }()
+
+	now := time.Now()
+	job.Status = types.JobRunning
+	job.StartedAt = &now
+	if err := h.saveJob(job); err != nil {
+		h.logger.WithError(err).Warn("Failed to update job")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, job.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		middleware.SettleTokenEndpoint(ctx, job.Endpoint, false)
+		h.finishJob(job, http.StatusInternalServerError, nil, err.Error())
+		return
+	}
+	req.Header = header
+
+	recorder := newJobResponseWriter()
+	h.proxyTavilyRequest(recorder, req, job.Endpoint)
+	middleware.SettleTokenEndpoint(ctx, job.Endpoint, recorder.statusCode < 400)
+
+	result := recorder.body.Bytes()
+	if recorder.statusCode >= 400 {
+		h.finishJob(job, recorder.statusCode, nil, string(bytes.TrimSpace(result)))
+		return
+	}
+	if !json.Valid(result) {
+		h.finishJob(job, http.StatusBadGateway, nil, "Tavily returned a non-JSON response")
+		return
+	}
+	h.finishJob(job, recorder.statusCode, result, "")
+}
+
+// finishJob records the final state of a job
+func (h *Handler) finishJob(job *types.Job, statusCode int, result json.RawMessage, errorMessage string) {
+	now := time.Now()
+	job.StatusCode = statusCode
+	job.Result = result
+	job.Error = errorMessage
+	job.CompletedAt = &now
+	job.Status = types.JobSucceeded
+	if errorMessage != "" {
+		job.Status = types.JobFailed
+	}
+
+	if err := h.saveJob(job); err != nil {
+		h.logger.WithError(err).Error("Failed to store job result")
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"job_id":      job.ID,
+		"endpoint":    job.Endpoint,
+		"status":      job.Status,
+		"status_code": statusCode,
+		"duration":    now.Sub(job.CreatedAt),
+	}).Info("Job finished")
+}
+
+// saveJob writes a job to Redis with the configured TTL
+func (h *Handler) saveJob(job *types.Job) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return h.usageCache.SetJob(ctx, job, h.config.JobTTL)
+}
+
+// JobHandler handles GET /api/jobs/{id} requests
+func (h *Handler) JobHandler(w http.ResponseWriter, r *http.Request) {
+	if h.usageCache == nil {
+		http.Error(w, "Job storage is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	tenant, status, message := h.requestTenant(r)
+	if status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	// Other callers' jobs are reported as missing, so job IDs reveal nothing
+	job, err := h.usageCache.GetJob(ctx, mux.Vars(r)["id"])
+	if err != nil || !canPollJob(r, tenant, job) {
+		http.Error(w, "Job not found or expired", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// canPollJob reports whether the caller of r may see job: only the token that
+// created a job, or a caller with admin scope, can poll it, and tenant-scoped
+// callers never see another tenant's jobs
+func canPollJob(r *http.Request, tenant string, job *types.Job) bool {
+	if tenant != "" && job.Tenant != tenant {
+		return false
+	}
+	return middleware.HasScope(r, middleware.ScopeAdmin) || requestTokenID(r) == job.TokenID
+}
+
+// requestTokenID returns the ID of the auth token a request was made with, or 0
+func requestTokenID(r *http.Request) int64 {
+	if token, ok := r.Context().Value(middleware.AuthTokenKey{}).(*repository.AuthToken); ok {
+		return token.ID
+	}
+	return 0
+}
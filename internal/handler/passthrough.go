@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// passthroughPrefix is the route prefix of the generic Tavily passthrough
+const passthroughPrefix = "/api/tavily"
+
+// TavilyPassthroughHandler handles requests under /api/tavily/ by forwarding them to the
+// same path on the Tavily API with key rotation, provided the path is on the
+// TAVILY_PASSTHROUGH_ALLOWLIST. New Tavily endpoints can be enabled by configuration.
+func (h *Handler) TavilyPassthroughHandler(w http.ResponseWriter, r *http.Request) {
+	endpoint := path.Clean("/" + strings.TrimPrefix(r.URL.Path, passthroughPrefix))
+	if !h.passthroughAllowed(endpoint) {
+		http.Error(w, "Endpoint is not allowed: "+endpoint, http.StatusForbidden)
+		return
+	}
+
+	if r.URL.RawQuery != "" {
+		endpoint += "?" + r.URL.RawQuery
+	}
+
+	h.proxyTavilyRequest(w, r, endpoint)
+}
+
+// passthroughAllowed matches an endpoint against the allowlist. Entries match exactly,
+// or as a path prefix when they end in /*.
+func (h *Handler) passthroughAllowed(endpoint string) bool {
+	for _, allowed := range h.config.TavilyPassthroughAllowlist {
+		if prefix, ok := strings.CutSuffix(allowed, "/*"); ok {
+			if strings.HasPrefix(endpoint, prefix+"/") {
+				return true
+			}
+			continue
+		}
+		if endpoint == allowed {
+			return true
+		}
+	}
+	return false
+}
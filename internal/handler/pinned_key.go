@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/keymanager"
+)
+
+// useKeyHeader pins a request to one key, given by ID or name, bypassing strategy selection
+const useKeyHeader = "X-Tavily-Use-Key"
+
+// resolvePinnedKey looks up the key named by the X-Tavily-Use-Key header among the
+// keys of tenant, which must belong to the pool the request is routed to. It
+// returns an empty key when the header is absent, or an HTTP status and message
+// when the key cannot be used.
+func (h *Handler) resolvePinnedKey(r *http.Request, tenant, pool string) (string, int, string) {
+	ref := r.Header.Get(useKeyHeader)
+	if ref == "" {
+		return "", 0, ""
+	}
+
+	if !h.config.AllowKeyOverride {
+		return "", http.StatusForbidden, useKeyHeader + " is disabled"
+	}
+	if h.keyRepo == nil {
+		return "", http.StatusNotImplemented, useKeyHeader + " needs the key database"
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 5*time.Second)
+	defer cancel()
+
+	var keyValue string
+	if id, err := strconv.ParseInt(ref, 10, 64); err == nil {
+		key, err := h.keyRepo.GetKeyByID(ctx, id)
+		if err == nil && h.config.MultiTenantEnabled && key.Tenant != tenantOrDefault(tenant) {
+			err = sql.ErrNoRows
+		}
+		if err == sql.ErrNoRows {
+			return "", http.StatusBadRequest, fmt.Sprintf("Unknown key: %s", ref)
+		}
+		if err != nil {
+			h.logger.WithError(err).Error("Failed to look up pinned key")
+			return "", http.StatusInternalServerError, "Failed to look up key"
+		}
+		keyValue = key.KeyValue
+	} else {
+		keys, err := h.keyRepo.GetKeysByName(ctx, ref)
+		if err != nil {
+			h.logger.WithError(err).Error("Failed to look up pinned key")
+			return "", http.StatusInternalServerError, "Failed to look up key"
+		}
+		if h.config.MultiTenantEnabled {
+			owned := keys[:0]
+			for _, key := range keys {
+				if key.Tenant == tenantOrDefault(tenant) {
+					owned = append(owned, key)
+				}
+			}
+			keys = owned
+		}
+		switch len(keys) {
+		case 0:
+			return "", http.StatusBadRequest, fmt.Sprintf("Unknown key: %s", ref)
+		case 1:
+			keyValue = keys[0].KeyValue
+		default:
+			return "", http.StatusConflict, fmt.Sprintf("Key name %s is ambiguous, use the key ID", ref)
+		}
+	}
+
+	// Only active keys in the rotation can be pinned, so deactivated and
+	// quarantined keys stay unused
+	if status, ok := h.keyManager.GetKeyStatus(keyValue); !ok || !status.Active || !h.keyManager.InRotation(keyValue) {
+		return "", http.StatusBadRequest, fmt.Sprintf("Key %s is not active", ref)
+	}
+	// Pinning must not reach past the pool, and so the tenant, the request is routed to
+	if !h.keyManager.InPool(keymanager.TenantPool(tenant, pool), keyValue) {
+		return "", http.StatusBadRequest, fmt.Sprintf("Key %s is not in pool %s", ref, pool)
+	}
+
+	return keyValue, 0, ""
+}
@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/repository"
+	"github.com/sirupsen/logrus"
+)
+
+// purgeRequestLogBatch is how many logged requests one purge statement deletes
+const purgeRequestLogBatch = 5000
+
+// purgeRequest selects the data POST /api/admin/purge deletes. Durations use Go
+// syntax such as 720h; 0s selects everything.
+type purgeRequest struct {
+	RequestLogOlderThan string `json:"request_log_older_than"`
+	CapturesOlderThan   string `json:"captures_older_than"`
+	DeletedKeyID        int64  `json:"deleted_key_id"`
+}
+
+// purgeCutoff parses an older-than duration into the time before which data is
+// deleted
+func purgeCutoff(value string, now time.Time) (time.Time, bool) {
+	age, err := time.ParseDuration(value)
+	if err != nil || age < 0 {
+		return time.Time{}, false
+	}
+	return now.Add(-age), true
+}
+
+// PurgeHandler handles POST /api/admin/purge requests, deleting logged requests
+// and captures older than a given age and the remaining data of a deleted key,
+// so retention policies can be met without touching the database directly. The
+// audit trail is never purged.
+func (h *Handler) PurgeHandler(w http.ResponseWriter, r *http.Request) {
+	tenant, status, message := h.requestTenant(r)
+	if status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+	// Logged requests and captures span all tenants
+	if tenant != "" {
+		http.Error(w, "Purging data is not available to tenant-scoped callers", http.StatusForbidden)
+		return
+	}
+
+	var request purgeRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if request.RequestLogOlderThan == "" && request.CapturesOlderThan == "" && request.DeletedKeyID == 0 {
+		http.Error(w, "Nothing to purge: set request_log_older_than, captures_older_than or deleted_key_id", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	var requestLogBefore, capturesBefore time.Time
+	if request.RequestLogOlderThan != "" {
+		before, ok := purgeCutoff(request.RequestLogOlderThan, now)
+		if !ok {
+			http.Error(w, "request_log_older_than must be a non-negative duration such as 720h", http.StatusBadRequest)
+			return
+		}
+		requestLogBefore = before
+	}
+	if request.CapturesOlderThan != "" {
+		before, ok := purgeCutoff(request.CapturesOlderThan, now)
+		if !ok {
+			http.Error(w, "captures_older_than must be a non-negative duration such as 24h", http.StatusBadRequest)
+			return
+		}
+		capturesBefore = before
+	}
+	if request.DeletedKeyID < 0 {
+		http.Error(w, "Invalid deleted_key_id", http.StatusBadRequest)
+		return
+	}
+	if (request.RequestLogOlderThan != "" || request.DeletedKeyID != 0) && h.keyRepo == nil {
+		http.Error(w, "Not available without the key database", http.StatusNotImplemented)
+		return
+	}
+	if request.CapturesOlderThan != "" && h.captures == nil {
+		http.Error(w, "Request capture is not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 5*time.Minute)
+	defer cancel()
+
+	purged := map[string]interface{}{}
+
+	if request.DeletedKeyID != 0 {
+		err := h.keyRepo.PurgeDeletedKey(ctx, request.DeletedKeyID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Deleted key not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			h.logger.WithError(err).Error("Failed to purge deleted key")
+			http.Error(w, "Failed to purge deleted key", http.StatusInternalServerError)
+			return
+		}
+		purged["deleted_key_purged"] = request.DeletedKeyID
+	}
+
+	if request.RequestLogOlderThan != "" {
+		var count int64
+		for {
+			batch, err := h.keyRepo.PurgeRequestLog(ctx, requestLogBefore, purgeRequestLogBatch)
+			count += batch
+			if err != nil {
+				h.logger.WithError(err).Error("Failed to purge request log")
+				http.Error(w, "Failed to purge request log", http.StatusInternalServerError)
+				return
+			}
+			if batch < purgeRequestLogBatch {
+				break
+			}
+		}
+		purged["request_log_purged"] = count
+	}
+
+	if request.CapturesOlderThan != "" {
+		count, err := h.captures.purge(capturesBefore)
+		if err != nil {
+			h.logger.WithError(err).Error("Failed to purge captures")
+			http.Error(w, "Failed to purge captures", http.StatusInternalServerError)
+			return
+		}
+		purged["captures_purged"] = count
+	}
+
+	h.logger.WithFields(logrus.Fields(purged)).Info("Data purged")
+	h.audit(r.Context(), repository.AuditDataPurge, "", nil, map[string]interface{}{"request": request, "purged": purged})
+
+	purged["status"] = "success"
+	purged["message"] = "Data purged"
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(purged)
+}
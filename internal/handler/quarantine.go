@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/keymanager"
+	"github.com/dbccccccc/tavily-load/pkg/types"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// QuarantineHandler handles GET /api/quarantine requests, listing the keys held
+// out of rotation pending review
+func (h *Handler) QuarantineHandler(w http.ResponseWriter, r *http.Request) {
+	tenant, status, message := h.requestTenant(r)
+	if status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	keys, err := h.keyRepo.GetQuarantinedKeys(ctx)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to fetch quarantined keys")
+		http.Error(w, "Failed to fetch quarantined keys", http.StatusInternalServerError)
+		return
+	}
+
+	entries := []map[string]interface{}{}
+	for _, key := range keys {
+		if tenant != "" && key.Tenant != tenant {
+			continue
+		}
+		entries = append(entries, map[string]interface{}{
+			"id":             key.KeyID,
+			"name":           key.Name,
+			"key_preview":    types.KeyPreview(key.KeyValue),
+			"pool":           key.Pool,
+			"tenant":         key.Tenant,
+			"reason":         key.Reason,
+			"details":        key.Details,
+			"quarantined_at": key.QuarantinedAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"quarantined": entries,
+		"total":       len(entries),
+	})
+}
+
+// QuarantineKeyHandler handles POST /api/keys/{id}/quarantine requests, taking a
+// key out of rotation by hand. The body may carry {"details": "..."}.
+func (h *Handler) QuarantineKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid key ID", http.StatusBadRequest)
+		return
+	}
+
+	tenant, status, message := h.requestTenant(r)
+	if status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	var request struct {
+		Details string `json:"details"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && err != io.EOF {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 10*time.Second)
+	defer cancel()
+
+	key, err := h.keyRepo.GetKeyByID(ctx, id)
+	if err != nil || !tenantOwnsKey(tenant, key) {
+		http.Error(w, "Key not found", http.StatusNotFound)
+		return
+	}
+
+	h.keyManager.QuarantineKey(ctx, key.KeyValue, keymanager.QuarantineReasonManual, request.Details)
+
+	h.logger.WithFields(logrus.Fields{
+		"key_id":   key.ID,
+		"key_name": key.Name,
+	}).Info("API key quarantined")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"message": "API key quarantined",
+	})
+}
+
+// UnquarantineKeyHandler handles POST /api/keys/{id}/unquarantine requests,
+// returning a reviewed key to rotation on probation
+func (h *Handler) UnquarantineKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid key ID", http.StatusBadRequest)
+		return
+	}
+
+	tenant, status, message := h.requestTenant(r)
+	if status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 10*time.Second)
+	defer cancel()
+
+	key, err := h.keyRepo.GetKeyByID(ctx, id)
+	if err != nil || !tenantOwnsKey(tenant, key) {
+		http.Error(w, "Key not found", http.StatusNotFound)
+		return
+	}
+
+	if err := h.keyManager.ReleaseQuarantine(ctx, key.KeyValue); err != nil {
+		h.logger.WithError(err).Error("Failed to release key from quarantine")
+		http.Error(w, "Failed to release key from quarantine", http.StatusInternalServerError)
+		return
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"key_id":   key.ID,
+		"key_name": key.Name,
+	}).Info("API key released from quarantine")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"message": "API key released from quarantine",
+	})
+}
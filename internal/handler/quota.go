@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/events"
+	"github.com/dbccccccc/tavily-load/internal/keymanager"
+	"github.com/dbccccccc/tavily-load/internal/repository"
+)
+
+// preflightQuota rejects a request with 402 when usage data shows the keys that
+// could serve it are all out of credits, instead of retrying through 432/433
+// answers from every key. It reports whether the request was rejected.
+func (h *Handler) preflightQuota(w http.ResponseWriter, req *proxyRequest) bool {
+	if !h.config.QuotaPreflightEnabled {
+		return false
+	}
+	// /usage is free and reports the exhausted quota itself
+	if path, _, _ := strings.Cut(req.endpoint, "?"); path == "/usage" {
+		return false
+	}
+
+	if req.pinnedKey != "" {
+		if !h.keyManager.QuotaExhausted(req.pinnedKey) {
+			return false
+		}
+		h.rejectQuotaExhausted(w, "The pinned API key has no credits left", req.pool, time.Time{})
+		return true
+	}
+
+	exhausted, resetAt := h.keyManager.PoolQuotaExhausted(req.pool)
+	if !exhausted {
+		return false
+	}
+	h.rejectQuotaExhausted(w, "All API keys in the pool have no credits left", req.pool, resetAt)
+	return true
+}
+
+// rejectQuotaExhausted responds with a 402 JSON error
+func (h *Handler) rejectQuotaExhausted(w http.ResponseWriter, message, pool string, resetAt time.Time) {
+	_, name := keymanager.SplitTenantPool(pool)
+	response := map[string]interface{}{
+		"error":   "quota_exhausted",
+		"message": message,
+		"pool":    name,
+	}
+	if !resetAt.IsZero() {
+		response["plan_reset_at"] = resetAt
+	}
+
+	h.stats.addError()
+	h.logger.WithField("pool", pool).Warn("Rejected request before forwarding, API key credits are exhausted")
+	h.events.Publish(events.Event{
+		Type: events.QuotaExhausted,
+		Pool: pool,
+		Data: response,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusPaymentRequired)
+	json.NewEncoder(w).Encode(response)
+}
+
+// requestCredits estimates the credits a successful request spent. Each proxied
+// call counts as one credit; /usage is free.
+func requestCredits(endpoint string) int {
+	if path, _, _ := strings.Cut(endpoint, "?"); path == "/usage" {
+		return 0
+	}
+	return 1
+}
+
+// validateKeyBudget checks a per-key budget before it is stored
+func validateKeyBudget(budget repository.KeyBudget) error {
+	if budget.DailySoft < 0 || budget.DailyHard < 0 || budget.MonthlySoft < 0 || budget.MonthlyHard < 0 {
+		return fmt.Errorf("budget values must be >= 0")
+	}
+	if budget.DailyHard > 0 && budget.DailySoft > budget.DailyHard {
+		return fmt.Errorf("budget daily_soft must not exceed daily_hard")
+	}
+	if budget.MonthlyHard > 0 && budget.MonthlySoft > budget.MonthlyHard {
+		return fmt.Errorf("budget monthly_soft must not exceed monthly_hard")
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/keymanager"
+	"github.com/dbccccccc/tavily-load/pkg/types"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// sensitiveBodyFields are stripped from request bodies before they are captured
+var sensitiveBodyFields = []string{"api_key", "apiKey", "key"}
+
+// captureFailedRequest stores a sanitized copy of a request that exhausted all retries
+// and advertises its replay ID to the client. Replays that fail again keep their ID.
+func (h *Handler) captureFailedRequest(w http.ResponseWriter, r *http.Request, req *proxyRequest, lastErr error, attempts int) {
+	if req.replayID != "" {
+		w.Header().Set("X-Replay-ID", req.replayID)
+		return
+	}
+
+	if !h.config.EnableFailedRequestCapture || h.usageCache == nil {
+		return
+	}
+
+	failed := &types.FailedRequest{
+		ID:          uuid.New().String(),
+		Method:      req.method,
+		Endpoint:    req.endpoint,
+		Pool:        req.pool,
+		ContentType: r.Header.Get("Content-Type"),
+		Body:        sanitizeRequestBody(req.body),
+		Attempts:    attempts,
+		CapturedAt:  time.Now(),
+	}
+	if lastErr != nil {
+		failed.LastError = lastErr.Error()
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 2*time.Second)
+	defer cancel()
+
+	if err := h.usageCache.SetFailedRequest(ctx, failed, h.config.FailedRequestTTL); err != nil {
+		h.logger.WithError(err).Warn("Failed to capture failed request")
+		return
+	}
+
+	w.Header().Set("X-Replay-ID", failed.ID)
+
+	h.logger.WithFields(logrus.Fields{
+		"replay_id": failed.ID,
+		"endpoint":  req.endpoint,
+		"attempts":  attempts,
+	}).Info("Captured failed request for replay")
+}
+
+// deleteFailedRequest removes a captured request after it has been replayed successfully
+func (h *Handler) deleteFailedRequest(ctx context.Context, id string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 2*time.Second)
+	defer cancel()
+
+	if err := h.usageCache.DeleteFailedRequest(ctx, id); err != nil {
+		h.logger.WithError(err).Debug("Failed to delete replayed request")
+	}
+}
+
+// ReplayRequestHandler handles POST /api/requests/{id}/replay requests
+func (h *Handler) ReplayRequestHandler(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	id := mux.Vars(r)["id"]
+	if id == "" {
+		http.Error(w, "Request ID is required", http.StatusBadRequest)
+		return
+	}
+
+	if !h.config.EnableFailedRequestCapture || h.usageCache == nil {
+		http.Error(w, "Failed request capture is disabled", http.StatusNotFound)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	tenant, status, message := h.requestTenant(r)
+	if status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	failed, err := h.usageCache.GetFailedRequest(ctx, id)
+	if err != nil {
+		http.Error(w, "Captured request not found or expired", http.StatusNotFound)
+		return
+	}
+	// Captured requests remember their tenant through the pool they were routed to
+	poolTenant, _ := keymanager.SplitTenantPool(failed.Pool)
+	if tenant != "" && poolTenant != tenant {
+		http.Error(w, "Captured request not found or expired", http.StatusNotFound)
+		return
+	}
+
+	if failed.ContentType != "" {
+		r.Header.Set("Content-Type", failed.ContentType)
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"replay_id": failed.ID,
+		"endpoint":  failed.Endpoint,
+	}).Info("Replaying captured request")
+
+	pool := failed.Pool
+	if pool == "" || !h.keyManager.HasPool(pool) {
+		pool = keymanager.TenantPool(poolTenant, h.config.DefaultKeyPool)
+	}
+
+	h.stats.addRequest()
+	h.forwardRequest(w, r, &proxyRequest{
+		method:    failed.Method,
+		endpoint:  failed.Endpoint,
+		body:      failed.Body,
+		pool:      pool,
+		replayID:  failed.ID,
+		startTime: startTime,
+	})
+}
+
+// sanitizeRequestBody removes credentials that clients may embed in JSON request bodies
+func sanitizeRequestBody(body []byte) []byte {
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return body
+	}
+
+	for _, field := range sensitiveBodyFields {
+		delete(payload, field)
+	}
+
+	sanitized, err := json.Marshal(payload)
+	if err != nil {
+		return body
+	}
+	return sanitized
+}
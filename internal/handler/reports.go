@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// defaultReportListLimit is the number of reports listed without a limit parameter
+	defaultReportListLimit = 30
+	// maxReportListLimit caps the limit parameter
+	maxReportListLimit = 365
+)
+
+// ReportsHandler handles GET /api/reports requests, listing the newest usage
+// reports without their bodies. ?period= selects daily or weekly reports.
+func (h *Handler) ReportsHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.requireUnscopedReports(w, r) {
+		return
+	}
+
+	query := r.URL.Query()
+	period := query.Get("period")
+	if period != "" && period != "daily" && period != "weekly" {
+		http.Error(w, "Invalid period: must be daily or weekly", http.StatusBadRequest)
+		return
+	}
+	limit := defaultReportListLimit
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > maxReportListLimit {
+			http.Error(w, "limit must be between 1 and 365", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	reports, err := h.keyRepo.ListUsageReports(ctx, period, limit)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list usage reports")
+		http.Error(w, "Failed to list usage reports", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"reports": reports,
+		"count":   len(reports),
+	})
+}
+
+// ReportHandler handles GET /api/reports/{id} requests
+func (h *Handler) ReportHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.requireUnscopedReports(w, r) {
+		return
+	}
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid report ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	report, err := h.keyRepo.GetUsageReport(ctx, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Report not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to fetch usage report")
+		http.Error(w, "Failed to fetch usage report", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// requireUnscopedReports rejects tenant-scoped callers, since reports cover every tenant
+func (h *Handler) requireUnscopedReports(w http.ResponseWriter, r *http.Request) bool {
+	tenant, status, message := h.requestTenant(r)
+	if status != 0 {
+		http.Error(w, message, status)
+		return false
+	}
+	if tenant != "" {
+		http.Error(w, "Usage reports are not available to tenant-scoped callers", http.StatusForbidden)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/repository"
+	"github.com/dbccccccc/tavily-load/pkg/types"
+)
+
+const (
+	// defaultRequestsPerPage and maxRequestsPerPage bound the page size of
+	// GET /api/requests
+	defaultRequestsPerPage = 100
+	maxRequestsPerPage     = 1000
+)
+
+// statusWriter remembers the status of the response sent to the client
+type statusWriter struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (w *statusWriter) WriteHeader(statusCode int) {
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *statusWriter) Write(data []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// Flush lets streamed responses through
+func (w *statusWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// StartRequestLog starts storing logged requests and purging expired ones
+func (h *Handler) StartRequestLog(ctx context.Context) {
+	h.requestLog.Start(ctx)
+}
+
+// FlushRequestLog stores requests that are still buffered, for use at shutdown
+func (h *Handler) FlushRequestLog(ctx context.Context) error {
+	return h.requestLog.Flush(ctx)
+}
+
+// logRequest adds a finished proxy request to the request log
+func (h *Handler) logRequest(r *http.Request, sw *statusWriter, endpoint string, start time.Time) {
+	reqCtx := h.getRequestContext(r)
+	tenant, _, _ := h.requestTenant(r)
+	path, _, _ := strings.Cut(endpoint, "?")
+
+	status := sw.statusCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+	h.requestLog.Record(types.RequestLogEntry{
+		CreatedAt:         start,
+		RequestID:         reqCtx.RequestID,
+		Method:            r.Method,
+		Endpoint:          path,
+		ClientIP:          reqCtx.ClientIP,
+		Tenant:            tenantOrDefault(tenant),
+		KeyValue:          reqCtx.Key,
+		StatusCode:        status,
+		LatencyMs:         time.Since(start).Milliseconds(),
+		UpstreamLatencyMs: reqCtx.UpstreamLatency.Milliseconds(),
+		Retries:           reqCtx.RetryCount,
+		CacheStatus:       reqCtx.CacheStatus,
+	})
+}
+
+// RequestsHandler handles GET /api/requests requests, listing logged requests
+// newest first. Optional parameters are key (a key ID), endpoint, status, from
+// and to (RFC 3339), page and per_page.
+func (h *Handler) RequestsHandler(w http.ResponseWriter, r *http.Request) {
+	if h.requestLog == nil {
+		http.Error(w, "Request log is not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	tenant, status, message := h.requestTenant(r)
+	if status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	query := r.URL.Query()
+	opts := repository.RequestLogOptions{
+		Endpoint: query.Get("endpoint"),
+		Tenant:   tenant,
+		Page:     1,
+		PerPage:  defaultRequestsPerPage,
+	}
+
+	if value := query.Get("key"); value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid key ID", http.StatusBadRequest)
+			return
+		}
+		opts.KeyID = id
+	}
+	if value := query.Get("status"); value != "" {
+		code, err := strconv.Atoi(value)
+		if err != nil || code < 100 || code > 599 {
+			http.Error(w, "Invalid status", http.StatusBadRequest)
+			return
+		}
+		opts.StatusCode = code
+	}
+	if value := query.Get("from"); value != "" {
+		from, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "from must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		opts.From = from
+	}
+	if value := query.Get("to"); value != "" {
+		to, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "to must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		opts.To = to
+	}
+	if value := query.Get("page"); value != "" {
+		page, err := strconv.Atoi(value)
+		if err != nil || page < 1 {
+			http.Error(w, "Invalid page", http.StatusBadRequest)
+			return
+		}
+		opts.Page = page
+	}
+	if value := query.Get("per_page"); value != "" {
+		perPage, err := strconv.Atoi(value)
+		if err != nil || perPage < 1 || perPage > maxRequestsPerPage {
+			http.Error(w, fmt.Sprintf("Invalid per_page: must be between 1 and %d", maxRequestsPerPage), http.StatusBadRequest)
+			return
+		}
+		opts.PerPage = perPage
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	entries, total, err := h.keyRepo.ListRequestLog(ctx, opts)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to query request log")
+		http.Error(w, "Failed to query request log", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"requests":    entries,
+		"count":       len(entries),
+		"total":       total,
+		"page":        opts.Page,
+		"per_page":    opts.PerPage,
+		"total_pages": (total + opts.PerPage - 1) / opts.PerPage,
+	})
+}
@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/repository"
+	"github.com/dbccccccc/tavily-load/pkg/types"
+)
+
+// cacheHeader lets clients skip the response cache with "bypass"
+const cacheHeader = "X-Tavily-Cache"
+
+// Cache outcomes reported in the X-Cache response header and the access log
+const (
+	cacheHit    = "HIT"
+	cacheMiss   = "MISS"
+	cacheBypass = "BYPASS"
+)
+
+// responseCacheStats counts response cache lookups
+type responseCacheStats struct {
+	hits     int64
+	misses   int64
+	bypasses int64
+}
+
+// responseCacheKey derives the cache key of a request from its normalized body. It
+// returns an empty key when the endpoint is not cached or the body is not JSON.
+func (h *Handler) responseCacheKey(endpoint string, body []byte) string {
+	if !h.config.Endpoint(endpoint).Cached || h.usageCache == nil {
+		return ""
+	}
+
+	var request map[string]interface{}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return ""
+	}
+
+	// Requests that differ only in query spacing or URL order share an entry
+	if query, ok := request["query"].(string); ok {
+		request["query"] = strings.ToLower(strings.Join(strings.Fields(query), " "))
+	}
+	switch urls := request["urls"].(type) {
+	case string:
+		request["urls"] = []string{urls}
+	case []interface{}:
+		sorted := make([]string, 0, len(urls))
+		for _, url := range urls {
+			if s, ok := url.(string); ok {
+				sorted = append(sorted, s)
+			}
+		}
+		sort.Strings(sorted)
+		request["urls"] = sorted
+	}
+
+	// Map keys are marshalled in sorted order, so the encoding is canonical
+	normalized, err := json.Marshal(request)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(normalized)
+	return strings.TrimPrefix(endpoint, "/") + ":" + hex.EncodeToString(sum[:])
+}
+
+// serveCachedResponse writes a cached response if one exists, recording the cache
+// outcome. It returns true when the request has been served.
+func (h *Handler) serveCachedResponse(w http.ResponseWriter, r *http.Request, req *proxyRequest) bool {
+	reqCtx := h.getRequestContext(r)
+
+	if strings.EqualFold(r.Header.Get(cacheHeader), "bypass") || strings.Contains(r.Header.Get("Cache-Control"), "no-cache") {
+		atomic.AddInt64(&h.cacheStats.bypasses, 1)
+		reqCtx.CacheStatus = cacheBypass
+		w.Header().Set("X-Cache", cacheBypass)
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 2*time.Second)
+	defer cancel()
+
+	cached, err := h.usageCache.GetCachedResponse(ctx, req.cacheKey)
+	if err != nil {
+		atomic.AddInt64(&h.cacheStats.misses, 1)
+		reqCtx.CacheStatus = cacheMiss
+		w.Header().Set("X-Cache", cacheMiss)
+		return false
+	}
+
+	atomic.AddInt64(&h.cacheStats.hits, 1)
+	reqCtx.CacheStatus = cacheHit
+	h.stats.addSuccess()
+
+	header := http.Header{}
+	header.Set("Content-Type", cached.ContentType)
+	w.Header().Set("X-Cache", cacheHit)
+	w.Header().Set("Age", strconv.Itoa(int(time.Since(cached.CachedAt).Seconds())))
+	h.writeBufferedResponse(w, cached.StatusCode, header, cached.Body, req.filter)
+	return true
+}
+
+// storeCachedResponse saves a successful upstream response body under the request's cache key
+func (h *Handler) storeCachedResponse(ctx context.Context, req *proxyRequest, resp *http.Response, body []byte) {
+	cached := &types.CachedResponse{
+		StatusCode:  resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Body:        body,
+		CachedAt:    time.Now(),
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 2*time.Second)
+		defer cancel()
+		if err := h.usageCache.SetCachedResponse(ctx, req.cacheKey, cached, h.config.Endpoint(req.endpoint).CacheTTL); err != nil {
+			h.logger.WithError(err).Debug("Failed to cache response")
+		}
+	}()
+}
+
+// ResponseCacheHandler handles GET /api/cache (statistics) and DELETE /api/cache
+// (invalidation, optionally limited to one ?endpoint=) requests
+func (h *Handler) ResponseCacheHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodDelete {
+		if h.usageCache == nil {
+			http.Error(w, "Response cache is not available", http.StatusServiceUnavailable)
+			return
+		}
+
+		prefix := ""
+		if endpoint := r.URL.Query().Get("endpoint"); endpoint != "" {
+			prefix = strings.TrimPrefix(endpoint, "/") + ":"
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		if err := h.usageCache.InvalidateCachedResponses(ctx, prefix); err != nil {
+			h.logger.WithError(err).Error("Failed to invalidate response cache")
+			http.Error(w, "Failed to invalidate response cache", http.StatusInternalServerError)
+			return
+		}
+		h.audit(ctx, repository.AuditCacheInvalidate, "", nil, map[string]string{"endpoint": r.URL.Query().Get("endpoint")})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"status":  "success",
+			"message": "Response cache invalidated",
+		})
+		return
+	}
+
+	hits := atomic.LoadInt64(&h.cacheStats.hits)
+	misses := atomic.LoadInt64(&h.cacheStats.misses)
+	hitRate := 0.0
+	if hits+misses > 0 {
+		hitRate = float64(hits) / float64(hits+misses)
+	}
+
+	// Endpoints cached through ENDPOINT_CACHE_TTLS are listed with their own TTL
+	endpoints := []string{}
+	endpointTTLs := make(map[string]string)
+	reloadable := h.config.Reloadable()
+	candidates := append([]string{}, h.config.ResponseCacheEndpoints...)
+	for endpoint := range reloadable.EndpointOverrides {
+		candidates = append(candidates, endpoint)
+	}
+	for _, endpoint := range candidates {
+		settings := h.config.Endpoint(endpoint)
+		if _, listed := endpointTTLs[endpoint]; listed || !settings.Cached {
+			continue
+		}
+		endpoints = append(endpoints, endpoint)
+		endpointTTLs[endpoint] = settings.CacheTTL.String()
+	}
+	sort.Strings(endpoints)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled":       h.config.ResponseCacheEnabled,
+		"ttl":           reloadable.ResponseCacheTTL.String(),
+		"endpoints":     endpoints,
+		"endpoint_ttls": endpointTTLs,
+		"hits":          hits,
+		"misses":        misses,
+		"bypasses":      atomic.LoadInt64(&h.cacheStats.bypasses),
+		"hit_rate":      hitRate,
+	})
+}
@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// fieldsHeader selects result fields: "title,url" keeps only those fields,
+	// "-raw_content" drops a field
+	fieldsHeader = "X-Tavily-Fields"
+	// maxResultsHeader truncates the results array of the response
+	maxResultsHeader = "X-Tavily-Max-Results"
+)
+
+// responseFilter trims fields and results from JSON responses
+type responseFilter struct {
+	keep       map[string]bool // result fields to keep; nil keeps all
+	drop       map[string]bool // fields removed from the response and its results
+	maxResults int             // 0 keeps all results
+}
+
+// newResponseFilter combines the configured defaults with the request headers.
+// It returns nil when the response should be passed through untouched.
+func (h *Handler) newResponseFilter(r *http.Request) (*responseFilter, error) {
+	filter := &responseFilter{
+		drop:       make(map[string]bool),
+		maxResults: h.config.ResponseMaxResults,
+	}
+	for _, field := range h.config.ResponseStripFields {
+		if field = strings.TrimSpace(field); field != "" {
+			filter.drop[field] = true
+		}
+	}
+
+	if fields := r.Header.Get(fieldsHeader); fields != "" {
+		for _, field := range strings.Split(fields, ",") {
+			field = strings.TrimSpace(field)
+			switch {
+			case field == "":
+			case strings.HasPrefix(field, "-"):
+				filter.drop[strings.TrimPrefix(field, "-")] = true
+			default:
+				if filter.keep == nil {
+					filter.keep = make(map[string]bool)
+				}
+				filter.keep[field] = true
+			}
+		}
+	}
+
+	if value := r.Header.Get(maxResultsHeader); value != "" {
+		maxResults, err := strconv.Atoi(value)
+		if err != nil || maxResults < 0 {
+			return nil, fmt.Errorf("%s must be a non-negative integer", maxResultsHeader)
+		}
+		filter.maxResults = maxResults
+	}
+
+	if filter.keep == nil && len(filter.drop) == 0 && filter.maxResults == 0 {
+		return nil, nil
+	}
+	return filter, nil
+}
+
+// applies reports whether the filter can rewrite the response body
+func (f *responseFilter) applies(resp *http.Response) bool {
+	if f == nil {
+		return false
+	}
+	if encoding := resp.Header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		return false
+	}
+	return strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json")
+}
+
+// apply rewrites a JSON response body, returning it unchanged if it is not a JSON object
+func (f *responseFilter) apply(body []byte) []byte {
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return body
+	}
+
+	for field := range f.drop {
+		delete(payload, field)
+	}
+
+	if results, ok := payload["results"].([]interface{}); ok {
+		if f.maxResults > 0 && len(results) > f.maxResults {
+			results = results[:f.maxResults]
+		}
+		for _, result := range results {
+			item, ok := result.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for field := range item {
+				if f.drop[field] || (f.keep != nil && !f.keep[field]) {
+					delete(item, field)
+				}
+			}
+		}
+		payload["results"] = results
+	}
+
+	filtered, err := json.Marshal(payload)
+	if err != nil {
+		return body
+	}
+	return filtered
+}
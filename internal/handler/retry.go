@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/errors"
+)
+
+// retryDelay returns the full-jitter exponential backoff before the given retry
+// (1 for the first retry), capped at RETRY_BACKOFF_MAX_MS
+func (h *Handler) retryDelay(retry int) time.Duration {
+	reloadable := h.config.Reloadable()
+	base := reloadable.RetryBackoffBase
+	if base <= 0 || retry <= 0 {
+		return 0
+	}
+
+	ceiling := reloadable.RetryBackoffMax
+	backoff := base
+	for i := 1; i < retry && backoff < ceiling; i++ {
+		backoff *= 2
+	}
+	if backoff > ceiling {
+		backoff = ceiling
+	}
+
+	return time.Duration(rand.Int63n(int64(backoff) + 1))
+}
+
+// waitBeforeRetry sleeps before the next attempt unless the failure was specific to
+// the key, in which case another key can be tried at once. It returns false if the
+// client went away while waiting.
+func (h *Handler) waitBeforeRetry(ctx context.Context, retry int, lastErr error) bool {
+	if tavilyErr, ok := lastErr.(*errors.TavilyError); ok && tavilyErr.IsKeySpecific() {
+		return true
+	}
+
+	delay := h.retryDelay(retry)
+	if delay <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// retryBudget caps retries at a fraction of recent request volume, so a Tavily
+// outage does not multiply load by MAX_RETRIES and trip every key's blacklist
+// threshold at once. Counts are kept in one-second buckets over a sliding window,
+// and a minimum number of retries is always allowed so quiet periods still retry.
+type retryBudget struct {
+	mu         sync.Mutex
+	ratio      float64
+	minRetries int
+	requests   []int64
+	retries    []int64
+	seconds    []int64
+}
+
+func newRetryBudget(ratio float64, window time.Duration, minRetries int) *retryBudget {
+	buckets := int(window / time.Second)
+	if buckets < 1 {
+		buckets = 1
+	}
+	return &retryBudget{
+		ratio:      ratio,
+		minRetries: minRetries,
+		requests:   make([]int64, buckets),
+		retries:    make([]int64, buckets),
+		seconds:    make([]int64, buckets),
+	}
+}
+
+// bucket returns the index for the current second, clearing it if it is stale
+func (b *retryBudget) bucket() int {
+	now := time.Now().Unix()
+	idx := int(now % int64(len(b.seconds)))
+	if b.seconds[idx] != now {
+		b.seconds[idx] = now
+		b.requests[idx] = 0
+		b.retries[idx] = 0
+	}
+	return idx
+}
+
+// totals sums the requests and retries seen within the window
+func (b *retryBudget) totals() (int64, int64) {
+	oldest := time.Now().Unix() - int64(len(b.seconds))
+	var requests, retries int64
+	for i, second := range b.seconds {
+		if second > oldest {
+			requests += b.requests[i]
+			retries += b.retries[i]
+		}
+	}
+	return requests, retries
+}
+
+// recordRequest counts an incoming request towards the budget
+func (b *retryBudget) recordRequest() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.requests[b.bucket()]++
+}
+
+// allowRetry reports whether a retry fits in the budget and, if so, spends it
+func (b *retryBudget) allowRetry() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	idx := b.bucket()
+	requests, retries := b.totals()
+	if retries >= int64(b.minRetries) && float64(retries+1) > b.ratio*float64(requests) {
+		return false
+	}
+	b.retries[idx]++
+	return true
+}
@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// requestValidators check request bodies locally before a key is spent on them,
+// keyed by endpoint
+var requestValidators = map[string]func(map[string]interface{}) error{
+	"/search":  validateSearchRequest,
+	"/extract": validateExtractRequest,
+}
+
+// validateRequestBody checks a JSON body against the Tavily schema of the endpoint.
+// Endpoints without a validator are not checked.
+func validateRequestBody(endpoint string, body []byte) error {
+	validate, ok := requestValidators[endpoint]
+	if !ok {
+		return nil
+	}
+
+	var request map[string]interface{}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return fmt.Errorf("request body must be a JSON object")
+	}
+	return validate(request)
+}
+
+func validateSearchRequest(request map[string]interface{}) error {
+	query, ok := request["query"].(string)
+	if !ok || query == "" {
+		return fmt.Errorf("query is required and must be a non-empty string")
+	}
+
+	checks := []error{
+		checkEnum(request, "search_depth", "basic", "advanced"),
+		checkEnum(request, "topic", "general", "news", "finance"),
+		checkEnum(request, "time_range", "day", "week", "month", "year", "d", "w", "m", "y"),
+		checkInt(request, "max_results", 0, 20),
+		checkInt(request, "chunks_per_source", 1, 3),
+		checkInt(request, "days", 1, 0),
+		checkBoolOrEnum(request, "include_answer", "basic", "advanced"),
+		checkBoolOrEnum(request, "include_raw_content", "markdown", "text"),
+		checkBoolOrEnum(request, "include_images"),
+		checkStringList(request, "include_domains"),
+		checkStringList(request, "exclude_domains"),
+	}
+	for _, err := range checks {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateExtractRequest(request map[string]interface{}) error {
+	switch urls := request["urls"].(type) {
+	case string:
+		if urls == "" {
+			return fmt.Errorf("urls must not be empty")
+		}
+	case []interface{}:
+		if len(urls) == 0 {
+			return fmt.Errorf("urls must not be empty")
+		}
+		if err := checkStringList(request, "urls"); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("urls is required and must be a string or a list of strings")
+	}
+
+	checks := []error{
+		checkEnum(request, "extract_depth", "basic", "advanced"),
+		checkEnum(request, "format", "markdown", "text"),
+		checkBoolOrEnum(request, "include_images"),
+	}
+	for _, err := range checks {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkEnum validates an optional string field against its allowed values
+func checkEnum(request map[string]interface{}, field string, allowed ...string) error {
+	value, ok := request[field]
+	if !ok || value == nil {
+		return nil
+	}
+	s, ok := value.(string)
+	if ok {
+		for _, a := range allowed {
+			if s == a {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%s must be one of %v", field, allowed)
+}
+
+// checkInt validates an optional integer field; a max of 0 means unbounded
+func checkInt(request map[string]interface{}, field string, min, max int) error {
+	value, ok := request[field]
+	if !ok || value == nil {
+		return nil
+	}
+	n, ok := value.(float64)
+	if !ok || n != float64(int(n)) {
+		return fmt.Errorf("%s must be an integer", field)
+	}
+	if int(n) < min || (max > 0 && int(n) > max) {
+		if max > 0 {
+			return fmt.Errorf("%s must be between %d and %d", field, min, max)
+		}
+		return fmt.Errorf("%s must be at least %d", field, min)
+	}
+	return nil
+}
+
+// checkBoolOrEnum validates an optional field that is a boolean or one of the allowed strings
+func checkBoolOrEnum(request map[string]interface{}, field string, allowed ...string) error {
+	value, ok := request[field]
+	if !ok || value == nil {
+		return nil
+	}
+	if _, ok := value.(bool); ok {
+		return nil
+	}
+	if len(allowed) == 0 {
+		return fmt.Errorf("%s must be a boolean", field)
+	}
+	if err := checkEnum(request, field, allowed...); err != nil {
+		return fmt.Errorf("%s must be a boolean or one of %v", field, allowed)
+	}
+	return nil
+}
+
+// checkStringList validates an optional field holding a list of strings
+func checkStringList(request map[string]interface{}, field string) error {
+	value, ok := request[field]
+	if !ok || value == nil {
+		return nil
+	}
+	list, ok := value.([]interface{})
+	if !ok {
+		return fmt.Errorf("%s must be a list of strings", field)
+	}
+	for _, item := range list {
+		if _, ok := item.(string); !ok {
+			return fmt.Errorf("%s must be a list of strings", field)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+// shadowMirror copies a sample of proxied requests to a secondary base URL, such
+// as a staging Tavily mock or a logging sink, for capacity tests and regression
+// comparison. Mirrored requests never affect the client response, and they are
+// dropped rather than queued once SHADOW_MAX_PENDING are in flight.
+type shadowMirror struct {
+	baseURL string
+	percent float64
+	apiKey  string
+	client  *http.Client
+	pending chan struct{}
+}
+
+func newShadowMirror(cfg *config.Config) *shadowMirror {
+	if cfg.ShadowBaseURL == "" || cfg.ShadowPercent <= 0 {
+		return nil
+	}
+
+	maxPending := cfg.ShadowMaxPending
+	if maxPending <= 0 {
+		maxPending = 1
+	}
+
+	return &shadowMirror{
+		baseURL: cfg.ShadowBaseURL,
+		percent: cfg.ShadowPercent,
+		apiKey:  cfg.ShadowAPIKey,
+		client:  &http.Client{Timeout: cfg.ShadowTimeout},
+		pending: make(chan struct{}, maxPending),
+	}
+}
+
+// mirrorRequest sends a sampled copy of the request to the shadow target in the background
+func (h *Handler) mirrorRequest(r *http.Request, req *proxyRequest) {
+	shadow := h.shadow
+	if shadow == nil || rand.Float64()*100 >= shadow.percent {
+		return
+	}
+
+	select {
+	case shadow.pending <- struct{}{}:
+	default:
+		h.logger.WithField("endpoint", req.endpoint).Debug("Shadow queue full, dropping mirrored request")
+		return
+	}
+
+	// Copy what the goroutine needs; the client request is gone once it returns
+	headers := r.Header.Clone()
+	parent := context.WithoutCancel(r.Context())
+	go func() {
+		defer func() { <-shadow.pending }()
+
+		ctx, cancel := context.WithTimeout(parent, shadow.client.Timeout)
+		defer cancel()
+
+		mirror, err := http.NewRequestWithContext(ctx, req.method, shadow.baseURL+req.endpoint, bytes.NewReader(req.body))
+		if err != nil {
+			h.logger.WithError(err).Debug("Failed to build mirrored request")
+			return
+		}
+		for key, values := range headers {
+			if shouldCopyHeader(key) {
+				for _, value := range values {
+					mirror.Header.Add(key, value)
+				}
+			}
+		}
+		mirror.Header.Set("Content-Type", "application/json")
+		mirror.Header.Set("User-Agent", "tavily-load/1.0")
+		mirror.Header.Set("X-Tavily-Load-Shadow", "true")
+		if shadow.apiKey != "" {
+			mirror.Header.Set("Authorization", "Bearer "+shadow.apiKey)
+		}
+
+		start := time.Now()
+		resp, err := shadow.client.Do(mirror)
+		if err != nil {
+			h.logger.WithError(err).WithField("endpoint", req.endpoint).Debug("Mirrored request failed")
+			return
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		h.logger.WithFields(logrus.Fields{
+			"endpoint": req.endpoint,
+			"status":   resp.StatusCode,
+			"latency":  time.Since(start),
+		}).Debug("Mirrored request completed")
+	}()
+}
@@ -0,0 +1,408 @@
+package handler
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/repository"
+	"github.com/dbccccccc/tavily-load/pkg/types"
+)
+
+const (
+	// histogramMinLatency is the upper bound of the first latency bucket
+	histogramMinLatency = time.Millisecond
+	// histogramGrowth is the ratio between adjacent bucket bounds, which bounds the
+	// error of a reported percentile to about half of it
+	histogramGrowth = 1.25
+	// histogramBuckets covers 1ms to roughly two minutes; slower requests land in
+	// an overflow bucket reported as the maximum seen
+	histogramBuckets = 54
+	// maxLatencyEndpoints caps the per-endpoint histograms; passthrough prefixes can
+	// match IDs in paths, and further endpoints are counted under "other"
+	maxLatencyEndpoints = 100
+	// statsWindowSlots keeps one slot per minute for windowed snapshots
+	statsWindowSlots = 24 * 60
+	// maxStatsWindow is the longest window a snapshot can cover
+	maxStatsWindow = statsWindowSlots * time.Minute
+)
+
+// histogramBounds are the bucket upper bounds shared by all latency histograms
+var histogramBounds = func() []time.Duration {
+	bounds := make([]time.Duration, histogramBuckets)
+	for i := range bounds {
+		bounds[i] = time.Duration(float64(histogramMinLatency) * math.Pow(histogramGrowth, float64(i)))
+	}
+	return bounds
+}()
+
+// Stats tracks request statistics. Concurrent requests update it through atomic
+// counters; readers take a Snapshot instead of reading the counters one by one.
+type Stats struct {
+	requestsTotal   atomic.Int64
+	requestsSuccess atomic.Int64
+	requestsError   atomic.Int64
+	// latency covers requests answered by Tavily; cache and idempotency hits do
+	// not reach it and would hide its tail
+	latency latencyHistogram
+
+	// window holds the same counters per minute for windowed snapshots
+	window statsWindow
+
+	mu        sync.RWMutex
+	endpoints map[string]*latencyHistogram
+	resetAt   time.Time
+}
+
+func newStats() *Stats {
+	return &Stats{resetAt: time.Now()}
+}
+
+func (s *Stats) addRequest() {
+	s.requestsTotal.Add(1)
+	s.window.slot(time.Now()).requestsTotal.Add(1)
+}
+
+func (s *Stats) addSuccess() {
+	s.requestsSuccess.Add(1)
+	s.window.slot(time.Now()).requestsSuccess.Add(1)
+}
+
+func (s *Stats) addError() {
+	s.requestsError.Add(1)
+	s.window.slot(time.Now()).requestsError.Add(1)
+}
+
+// addLatency records the end-to-end latency of a request served by Tavily
+func (s *Stats) addLatency(endpoint string, latency time.Duration) {
+	path, _, _ := strings.Cut(endpoint, "?")
+	s.latency.record(latency)
+	s.endpointHistogram(path).record(latency)
+	s.window.slot(time.Now()).latency.record(latency)
+}
+
+// Reset clears all counters and histograms, leaving key state alone
+func (s *Stats) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requestsTotal.Store(0)
+	s.requestsSuccess.Store(0)
+	s.requestsError.Store(0)
+	s.latency.reset()
+	s.endpoints = nil
+	s.window.reset()
+	s.resetAt = time.Now()
+}
+
+// ResetAt returns when the counters were last reset, or created
+func (s *Stats) ResetAt() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.resetAt
+}
+
+// endpointHistogram returns the histogram of an endpoint, creating it on first use
+func (s *Stats) endpointHistogram(endpoint string) *latencyHistogram {
+	s.mu.RLock()
+	histogram, ok := s.endpoints[endpoint]
+	s.mu.RUnlock()
+	if ok {
+		return histogram
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if histogram, ok := s.endpoints[endpoint]; ok {
+		return histogram
+	}
+	if s.endpoints == nil {
+		s.endpoints = make(map[string]*latencyHistogram)
+	}
+	if len(s.endpoints) >= maxLatencyEndpoints && endpoint != "other" {
+		if histogram, ok := s.endpoints["other"]; ok {
+			return histogram
+		}
+		endpoint = "other"
+	}
+	histogram = &latencyHistogram{}
+	s.endpoints[endpoint] = histogram
+	return histogram
+}
+
+// Snapshot returns the current counters with the average and percentile latencies
+func (s *Stats) Snapshot() types.ServerHealth {
+	latency := s.latency.summary()
+	snapshot := types.ServerHealth{
+		RequestsTotal:   s.requestsTotal.Load(),
+		RequestsSuccess: s.requestsSuccess.Load(),
+		RequestsError:   s.requestsError.Load(),
+		AverageLatency:  latency.Average,
+		Latency:         latency,
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.endpoints) > 0 {
+		snapshot.EndpointLatency = make(map[string]types.LatencySummary, len(s.endpoints))
+		for endpoint, histogram := range s.endpoints {
+			snapshot.EndpointLatency[endpoint] = histogram.summary()
+		}
+	}
+	return snapshot
+}
+
+// latencyHistogram counts latencies in exponentially growing buckets, so
+// percentiles can be estimated in constant memory without locking writers
+type latencyHistogram struct {
+	counts [histogramBuckets + 1]atomic.Int64
+	count  atomic.Int64
+	sum    atomic.Int64
+	max    atomic.Int64
+}
+
+func (h *latencyHistogram) record(latency time.Duration) {
+	// Bounds grow monotonically, so the bucket is the first bound at or above the latency
+	bucket := histogramBuckets
+	if latency <= histogramBounds[0] {
+		bucket = 0
+	} else if latency <= histogramBounds[histogramBuckets-1] {
+		bucket = int(math.Ceil(math.Log(float64(latency)/float64(histogramMinLatency)) / math.Log(histogramGrowth)))
+		// Guard against floating point landing one bucket off
+		if bucket > 0 && latency <= histogramBounds[bucket-1] {
+			bucket--
+		} else if latency > histogramBounds[bucket] {
+			bucket++
+		}
+	}
+
+	h.counts[bucket].Add(1)
+	h.count.Add(1)
+	h.sum.Add(int64(latency))
+	for {
+		current := h.max.Load()
+		if int64(latency) <= current || h.max.CompareAndSwap(current, int64(latency)) {
+			break
+		}
+	}
+}
+
+// summary estimates the average and percentile latencies
+func (h *latencyHistogram) summary() types.LatencySummary {
+	var counts [histogramBuckets + 1]int64
+	var total int64
+	for i := range counts {
+		counts[i] = h.counts[i].Load()
+		total += counts[i]
+	}
+	if total == 0 {
+		return types.LatencySummary{}
+	}
+
+	return summarizeBuckets(counts[:], total, h.sum.Load(), time.Duration(h.max.Load()))
+}
+
+// reset clears the histogram
+func (h *latencyHistogram) reset() {
+	for i := range h.counts {
+		h.counts[i].Store(0)
+	}
+	h.count.Store(0)
+	h.sum.Store(0)
+	h.max.Store(0)
+}
+
+// summarizeBuckets estimates the average and percentile latencies from bucket counts
+func summarizeBuckets(counts []int64, total, sum int64, maxLatency time.Duration) types.LatencySummary {
+	return types.LatencySummary{
+		Count:   total,
+		Average: time.Duration(sum / total),
+		P50:     min(percentileFromBuckets(counts, total, 0.50, maxLatency), maxLatency),
+		P95:     min(percentileFromBuckets(counts, total, 0.95, maxLatency), maxLatency),
+		P99:     min(percentileFromBuckets(counts, total, 0.99, maxLatency), maxLatency),
+		Max:     maxLatency,
+	}
+}
+
+// percentileFromBuckets interpolates the p-th percentile within the bucket that
+// holds it; the overflow bucket reports the maximum seen
+func percentileFromBuckets(counts []int64, total int64, p float64, maxLatency time.Duration) time.Duration {
+	rank := p * float64(total)
+	var cumulative int64
+	for i, count := range counts {
+		if count == 0 || float64(cumulative+count) < rank {
+			cumulative += count
+			continue
+		}
+		if i == histogramBuckets {
+			return maxLatency
+		}
+		lower := time.Duration(0)
+		if i > 0 {
+			lower = histogramBounds[i-1]
+		}
+		fraction := (rank - float64(cumulative)) / float64(count)
+		return lower + time.Duration(fraction*float64(histogramBounds[i]-lower))
+	}
+	return maxLatency
+}
+
+// statsSlot holds the counters of one minute
+type statsSlot struct {
+	// minute is the Unix minute the slot currently counts
+	minute          int64
+	requestsTotal   atomic.Int64
+	requestsSuccess atomic.Int64
+	requestsError   atomic.Int64
+	latency         latencyHistogram
+}
+
+func (s *statsSlot) reset(minute int64) {
+	s.minute = minute
+	s.requestsTotal.Store(0)
+	s.requestsSuccess.Store(0)
+	s.requestsError.Store(0)
+	s.latency.reset()
+}
+
+// statsWindow is a ring of per-minute slots covering the last maxStatsWindow
+type statsWindow struct {
+	mu    sync.Mutex
+	slots [statsWindowSlots]statsSlot
+}
+
+// slot returns the slot counting the given time, recycling it if it still
+// holds a minute from an earlier lap of the ring
+func (w *statsWindow) slot(now time.Time) *statsSlot {
+	minute := now.Unix() / 60
+	slot := &w.slots[minute%statsWindowSlots]
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if slot.minute != minute {
+		slot.reset(minute)
+	}
+	return slot
+}
+
+func (w *statsWindow) reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i := range w.slots {
+		w.slots[i].reset(0)
+	}
+}
+
+// WindowSnapshot returns the counters and latency percentiles of the last window,
+// rounded up to whole minutes
+func (s *Stats) WindowSnapshot(window time.Duration) types.ServerHealth {
+	now := time.Now().Unix() / 60
+	minutes := int64((window + time.Minute - 1) / time.Minute)
+
+	var snapshot types.ServerHealth
+	var counts [histogramBuckets + 1]int64
+	var total, sum, maxLatency int64
+
+	s.window.mu.Lock()
+	defer s.window.mu.Unlock()
+	for i := range s.window.slots {
+		slot := &s.window.slots[i]
+		if slot.minute == 0 || slot.minute <= now-minutes || slot.minute > now {
+			continue
+		}
+		snapshot.RequestsTotal += slot.requestsTotal.Load()
+		snapshot.RequestsSuccess += slot.requestsSuccess.Load()
+		snapshot.RequestsError += slot.requestsError.Load()
+		for b := range counts {
+			n := slot.latency.counts[b].Load()
+			counts[b] += n
+			total += n
+		}
+		sum += slot.latency.sum.Load()
+		maxLatency = max(maxLatency, slot.latency.max.Load())
+	}
+
+	if total > 0 {
+		snapshot.Latency = summarizeBuckets(counts[:], total, sum, time.Duration(maxLatency))
+		snapshot.AverageLatency = snapshot.Latency.Average
+	}
+	return snapshot
+}
+
+// StatsResetHandler handles POST /api/stats/reset requests. Only request counters
+// and latency histograms are cleared; key state is reset by /reset-keys.
+func (h *Handler) StatsResetHandler(w http.ResponseWriter, r *http.Request) {
+	tenant, status, message := h.requestTenant(r)
+	if status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+	// Request counters span all tenants
+	if tenant != "" {
+		http.Error(w, "Resetting stats is not available to tenant-scoped callers", http.StatusForbidden)
+		return
+	}
+
+	h.stats.Reset()
+	h.logger.Info("Request stats reset")
+	h.audit(r.Context(), repository.AuditStatsReset, "", nil, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   "success",
+		"message":  "Request stats reset",
+		"reset_at": h.stats.ResetAt(),
+	})
+}
+
+// StatsSnapshotHandler handles GET /api/stats/snapshot requests. With ?window=
+// (a duration such as 15m or 1h, at most 24h) only requests in that window are
+// counted; without it the snapshot covers everything since the last reset.
+func (h *Handler) StatsSnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	tenant, status, message := h.requestTenant(r)
+	if status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+	if tenant != "" {
+		http.Error(w, "Request stats are not available to tenant-scoped callers", http.StatusForbidden)
+		return
+	}
+
+	now := time.Now()
+	resetAt := h.stats.ResetAt()
+	response := map[string]interface{}{
+		"to":       now,
+		"reset_at": resetAt,
+	}
+
+	if value := r.URL.Query().Get("window"); value != "" {
+		window, err := time.ParseDuration(value)
+		if err != nil || window <= 0 || window > maxStatsWindow {
+			http.Error(w, "window must be a duration between 1m and 24h, e.g. 15m or 1h", http.StatusBadRequest)
+			return
+		}
+		window = window.Round(time.Minute)
+		if window < time.Minute {
+			window = time.Minute
+		}
+		from := now.Add(-window)
+		// Nothing before the last reset is counted
+		if from.Before(resetAt) {
+			from = resetAt
+		}
+		response["window"] = window.String()
+		response["from"] = from
+		response["requests"] = h.stats.WindowSnapshot(window)
+	} else {
+		response["from"] = resetAt
+		response["requests"] = h.stats.Snapshot()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
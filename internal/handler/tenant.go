@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/middleware"
+	"github.com/dbccccccc/tavily-load/internal/repository"
+)
+
+// tenantHeader lets callers that are not bound to a tenant act for one
+const tenantHeader = "X-Tavily-Tenant"
+
+// tenantPattern restricts tenant names the same way as pools
+var tenantPattern = tagPattern
+
+// requestTenant returns the tenant a request acts for. Callers authenticated with
+// an auth token are bound to the token's tenant; AUTH_KEY, JWT and anonymous
+// callers may pick one with X-Tavily-Tenant. The tenant is empty when
+// multi-tenant mode is off or an unbound caller names none, which management
+// endpoints treat as all tenants and proxy requests as the default tenant. On
+// failure it returns an HTTP status and message instead.
+func (h *Handler) requestTenant(r *http.Request) (string, int, string) {
+	if !h.config.MultiTenantEnabled {
+		return "", 0, ""
+	}
+
+	requested := r.Header.Get(tenantHeader)
+	if token, ok := r.Context().Value(middleware.AuthTokenKey{}).(*repository.AuthToken); ok {
+		if requested != "" && requested != token.Tenant {
+			return "", http.StatusForbidden, "Token is bound to tenant " + token.Tenant
+		}
+		return token.Tenant, 0, ""
+	}
+
+	if requested != "" && !tenantPattern.MatchString(requested) {
+		return "", http.StatusBadRequest, "Invalid tenant: must be 1-64 lowercase letters, digits or _.:- characters"
+	}
+	return requested, 0, ""
+}
+
+// tenantOrDefault returns the tenant new keys and tokens are assigned to
+func tenantOrDefault(tenant string) string {
+	if tenant == "" {
+		return repository.DefaultTenant
+	}
+	return tenant
+}
+
+// tenantOwnsKey reports whether a request scoped to tenant may act on key;
+// unscoped requests may act on every key
+func tenantOwnsKey(tenant string, key *repository.APIKey) bool {
+	return tenant == "" || key.Tenant == tenant
+}
+
+// TenantsHandler handles GET /api/tenants requests
+func (h *Handler) TenantsHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.config.MultiTenantEnabled {
+		http.Error(w, "Multi-tenant mode is disabled", http.StatusNotFound)
+		return
+	}
+	tenant, status, message := h.requestTenant(r)
+	if status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+	if tenant != "" {
+		http.Error(w, "Listing tenants is not available to tenant-scoped callers", http.StatusForbidden)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	tenants, err := h.keyRepo.ListTenants(ctx)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list tenants")
+		http.Error(w, "Failed to list tenants", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tenants": tenants,
+		"total":   len(tenants),
+	})
+}
@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/repository"
+)
+
+const (
+	// defaultTimeseriesRange is the range returned without a from parameter
+	defaultTimeseriesRange = 24 * time.Hour
+	// maxHourlyTimeseriesRange and maxDailyTimeseriesRange bound the points one
+	// request can return
+	maxHourlyTimeseriesRange = 31 * 24 * time.Hour
+	maxDailyTimeseriesRange  = 366 * 24 * time.Hour
+)
+
+// StartUsageRollup starts adding buffered per-key usage to the hourly rollups
+// and summing those into the daily rollups
+func (h *Handler) StartUsageRollup(ctx context.Context) {
+	h.rollup.Start(ctx)
+	h.daily.Start(ctx)
+}
+
+// FlushUsageRollup writes usage that is still buffered, for use at shutdown
+func (h *Handler) FlushUsageRollup(ctx context.Context) error {
+	return h.rollup.Flush(ctx)
+}
+
+// TimeseriesHandler handles GET /api/analytics/timeseries requests. Optional
+// parameters are key (a key ID), endpoint, from and to (RFC 3339, defaulting to
+// the last 24 hours) and resolution (hour or day).
+func (h *Handler) TimeseriesHandler(w http.ResponseWriter, r *http.Request) {
+	tenant, status, message := h.requestTenant(r)
+	if status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	query := r.URL.Query()
+	opts := repository.TimeseriesOptions{
+		To:         time.Now(),
+		Resolution: query.Get("resolution"),
+		Endpoint:   query.Get("endpoint"),
+		Tenant:     tenant,
+	}
+
+	if opts.Resolution == "" {
+		opts.Resolution = repository.ResolutionHour
+	}
+	if opts.Resolution != repository.ResolutionHour && opts.Resolution != repository.ResolutionDay {
+		http.Error(w, "resolution must be hour or day", http.StatusBadRequest)
+		return
+	}
+
+	if value := query.Get("key"); value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid key ID", http.StatusBadRequest)
+			return
+		}
+		opts.KeyID = id
+	}
+
+	if value := query.Get("to"); value != "" {
+		to, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "to must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		opts.To = to
+	}
+	opts.From = opts.To.Add(-defaultTimeseriesRange)
+	if value := query.Get("from"); value != "" {
+		from, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "from must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		opts.From = from
+	}
+
+	if !opts.From.Before(opts.To) {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+	maxRange := maxHourlyTimeseriesRange
+	if opts.Resolution == repository.ResolutionDay {
+		maxRange = maxDailyTimeseriesRange
+	}
+	if opts.To.Sub(opts.From) > maxRange {
+		http.Error(w, "Time range is too long for resolution "+opts.Resolution, http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	points, err := h.keyRepo.GetUsageTimeseries(ctx, opts)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to query usage time series")
+		http.Error(w, "Failed to query usage time series", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"from":       opts.From,
+		"to":         opts.To,
+		"resolution": opts.Resolution,
+		"points":     points,
+	})
+}
@@ -0,0 +1,308 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/events"
+	"github.com/dbccccccc/tavily-load/internal/middleware"
+	"github.com/dbccccccc/tavily-load/internal/repository"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// authTokenPrefix marks generated auth token secrets
+const authTokenPrefix = "tvl_"
+
+// tokenRequest is the body of token create and update requests; omitted fields
+// keep their current value on update
+type tokenRequest struct {
+	Name             *string   `json:"name"`
+	RateLimitRPM     *int      `json:"rate_limit_rpm"`
+	DailyCreditQuota *int      `json:"daily_credit_quota"`
+	AllowedEndpoints *[]string `json:"allowed_endpoints"`
+	Scopes           *[]string `json:"scopes"`
+	Tenant           *string   `json:"tenant"`
+	IsActive         *bool     `json:"is_active"`
+}
+
+// apply copies the request's fields onto token, validating them
+func (req *tokenRequest) apply(token *repository.AuthToken) error {
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" || len(name) > 255 {
+			return fmt.Errorf("name must be 1-255 characters")
+		}
+		token.Name = name
+	}
+	if req.RateLimitRPM != nil {
+		if *req.RateLimitRPM < 0 {
+			return fmt.Errorf("rate_limit_rpm must be >= 0")
+		}
+		token.RateLimitRPM = *req.RateLimitRPM
+	}
+	if req.DailyCreditQuota != nil {
+		if *req.DailyCreditQuota < 0 {
+			return fmt.Errorf("daily_credit_quota must be >= 0")
+		}
+		token.DailyCreditQuota = *req.DailyCreditQuota
+	}
+	if req.AllowedEndpoints != nil {
+		endpoints := []string{}
+		for _, endpoint := range *req.AllowedEndpoints {
+			endpoint = strings.TrimSpace(endpoint)
+			if !strings.HasPrefix(endpoint, "/") || strings.Contains(endpoint, ",") {
+				return fmt.Errorf("invalid endpoint %q: must start with /", endpoint)
+			}
+			endpoints = append(endpoints, endpoint)
+		}
+		token.AllowedEndpoints = endpoints
+	}
+	if req.Scopes != nil {
+		scopes := []string{}
+		for _, scope := range *req.Scopes {
+			if scope != middleware.ScopeAdmin && scope != middleware.ScopePriority {
+				return fmt.Errorf("unknown scope %q", scope)
+			}
+			scopes = append(scopes, scope)
+		}
+		token.Scopes = scopes
+	}
+	if req.Tenant != nil {
+		if !tenantPattern.MatchString(*req.Tenant) {
+			return fmt.Errorf("invalid tenant: must be 1-64 lowercase letters, digits or _.:- characters")
+		}
+		token.Tenant = *req.Tenant
+	}
+	if req.IsActive != nil {
+		token.IsActive = *req.IsActive
+	}
+	return nil
+}
+
+// TokensHandler handles GET /api/tokens (list) and POST /api/tokens (create)
+func (h *Handler) TokensHandler(w http.ResponseWriter, r *http.Request) {
+	tenant, status, message := h.requestTenant(r)
+	if status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if r.Method == http.MethodPost {
+		h.createTokenHandler(ctx, w, r, tenant)
+		return
+	}
+
+	tokens, err := h.keyRepo.ListAuthTokens(ctx, tenant)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list auth tokens")
+		http.Error(w, "Failed to list auth tokens", http.StatusInternalServerError)
+		return
+	}
+
+	views := make([]map[string]interface{}, 0, len(tokens))
+	for _, token := range tokens {
+		views = append(views, h.tokenView(ctx, token))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tokens": views,
+		"total":  len(views),
+	})
+}
+
+func (h *Handler) createTokenHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, tenant string) {
+	var request tokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if request.Name == nil {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+
+	token := &repository.AuthToken{IsActive: true, AllowedEndpoints: []string{}, Scopes: []string{}, Tenant: tenantOrDefault(tenant)}
+	if err := request.apply(token); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if tenant != "" && token.Tenant != tenant {
+		http.Error(w, "Tenant-scoped callers cannot create tokens for other tenants", http.StatusForbidden)
+		return
+	}
+
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		h.logger.WithError(err).Error("Failed to generate auth token")
+		http.Error(w, "Failed to generate auth token", http.StatusInternalServerError)
+		return
+	}
+	secret := authTokenPrefix + hex.EncodeToString(raw)
+	token.TokenHash = repository.HashKey(secret)
+	token.TokenPrefix = secret[:12]
+
+	created, err := h.keyRepo.CreateAuthToken(ctx, token)
+	if err == repository.ErrDuplicateToken {
+		http.Error(w, "A token with this name already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to create auth token")
+		http.Error(w, "Failed to create auth token", http.StatusInternalServerError)
+		return
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"token_id":   created.ID,
+		"token_name": created.Name,
+	}).Info("Auth token created")
+	h.audit(ctx, repository.AuditTokenCreate, created.Tenant, nil, created)
+
+	// The secret is only ever returned here; only its hash is stored
+	view := h.tokenView(ctx, created)
+	view["token"] = secret
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"message": "Auth token created; store the token now, it cannot be shown again",
+		"token":   view,
+	})
+}
+
+// TokenDetailHandler handles GET, PATCH and DELETE /api/tokens/{id}
+func (h *Handler) TokenDetailHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid token ID", http.StatusBadRequest)
+		return
+	}
+
+	tenant, status, message := h.requestTenant(r)
+	if status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	token, err := h.keyRepo.GetAuthTokenByID(ctx, id)
+	if err == nil && tenant != "" && token.Tenant != tenant {
+		err = sql.ErrNoRows
+	}
+	if err == sql.ErrNoRows {
+		http.Error(w, "Token not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to get auth token")
+		http.Error(w, "Failed to get auth token", http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodDelete:
+		if err := h.keyRepo.DeleteAuthToken(ctx, id); err != nil {
+			h.logger.WithError(err).Error("Failed to delete auth token")
+			http.Error(w, "Failed to delete auth token", http.StatusInternalServerError)
+			return
+		}
+		h.logger.WithField("token_name", token.Name).Info("Auth token deleted")
+		h.audit(ctx, repository.AuditTokenDelete, token.Tenant, token, nil)
+		h.tokenChanged(id)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"status":  "success",
+			"message": "Auth token deleted",
+		})
+
+	case http.MethodPatch:
+		var request tokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		before := *token
+		if err := request.apply(token); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if tenant != "" && token.Tenant != tenant {
+			http.Error(w, "Tenant-scoped callers cannot move tokens to other tenants", http.StatusForbidden)
+			return
+		}
+
+		updated, err := h.keyRepo.UpdateAuthToken(ctx, token)
+		if err == repository.ErrDuplicateToken {
+			http.Error(w, "A token with this name already exists", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			h.logger.WithError(err).Error("Failed to update auth token")
+			http.Error(w, "Failed to update auth token", http.StatusInternalServerError)
+			return
+		}
+		h.logger.WithField("token_name", updated.Name).Info("Auth token updated")
+		h.audit(ctx, repository.AuditTokenUpdate, updated.Tenant, &before, updated)
+		h.tokenChanged(id)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  "success",
+			"message": "Auth token updated",
+			"token":   h.tokenView(ctx, updated),
+		})
+
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(h.tokenView(ctx, token))
+	}
+}
+
+// tokenChanged announces that a token was updated or deleted, so the auth
+// middleware stops serving its cached copy
+func (h *Handler) tokenChanged(id int64) {
+	h.events.Publish(events.Event{
+		Type: events.TokenChanged,
+		Data: map[string]interface{}{"token_id": id},
+	})
+}
+
+// tokenView renders a token with the credits it has used today
+func (h *Handler) tokenView(ctx context.Context, token *repository.AuthToken) map[string]interface{} {
+	view := map[string]interface{}{
+		"id":                 token.ID,
+		"name":               token.Name,
+		"token_preview":      token.TokenPrefix + "...",
+		"rate_limit_rpm":     token.RateLimitRPM,
+		"daily_credit_quota": token.DailyCreditQuota,
+		"allowed_endpoints":  token.AllowedEndpoints,
+		"scopes":             token.Scopes,
+		"tenant":             token.Tenant,
+		"is_active":          token.IsActive,
+		"created_at":         token.CreatedAt,
+		"updated_at":         token.UpdatedAt,
+	}
+	if h.usageCache != nil {
+		if used, err := h.usageCache.GetTokenCredits(ctx, token.ID); err == nil {
+			view["credits_used_today"] = used
+		}
+	}
+	return view
+}
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/errors"
+	"github.com/dbccccccc/tavily-load/pkg/types"
+)
+
+// upstreamBreaker detects Tavily-wide outages. When consecutive upstream failures
+// span several different keys the fault is the upstream's rather than the keys',
+// so the breaker opens and requests are rejected without touching the key pool.
+// After the cooldown a single probe request is let through to test for recovery.
+type upstreamBreaker struct {
+	mu        sync.Mutex
+	state     types.CircuitState
+	threshold int
+	minKeys   int
+	cooldown  time.Duration
+
+	failures     int
+	keys         map[string]struct{}
+	openedAt     time.Time
+	probing      bool
+	probeStarted time.Time
+}
+
+func newUpstreamBreaker(threshold, minKeys int, cooldown time.Duration) *upstreamBreaker {
+	return &upstreamBreaker{
+		state:     types.CircuitClosed,
+		threshold: threshold,
+		minKeys:   minKeys,
+		cooldown:  cooldown,
+		keys:      make(map[string]struct{}),
+	}
+}
+
+// allow reports whether a request may go upstream. When it may not, it returns
+// how long the caller should wait before retrying.
+func (b *upstreamBreaker) allow() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case types.CircuitOpen:
+		if remaining := b.cooldown - time.Since(b.openedAt); remaining > 0 {
+			return false, remaining
+		}
+		b.state = types.CircuitHalfOpen
+		b.probing = true
+		b.probeStarted = time.Now()
+		return true, 0
+	case types.CircuitHalfOpen:
+		// A probe that never reported back is abandoned after another cooldown
+		if b.probing && time.Since(b.probeStarted) < b.cooldown {
+			return false, time.Second
+		}
+		b.probing = true
+		b.probeStarted = time.Now()
+		return true, 0
+	default:
+		return true, 0
+	}
+}
+
+// recordFailure records an upstream failure seen through the key and reports
+// whether the breaker is now open
+func (b *upstreamBreaker) recordFailure(key string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == types.CircuitHalfOpen {
+		b.open()
+		return true
+	}
+	if b.state == types.CircuitOpen {
+		return true
+	}
+
+	b.failures++
+	b.keys[key] = struct{}{}
+	if b.failures >= b.threshold && len(b.keys) >= b.minKeys {
+		b.open()
+		return true
+	}
+	return false
+}
+
+// recordSuccess records that the upstream answered, closing the breaker
+func (b *upstreamBreaker) recordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = types.CircuitClosed
+	b.failures = 0
+	b.keys = make(map[string]struct{})
+	b.probing = false
+}
+
+// abandon records that a request let through got no answer because its client
+// went away, freeing the half-open probe for the next request
+func (b *upstreamBreaker) abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == types.CircuitHalfOpen {
+		b.probing = false
+	}
+}
+
+// State returns the current breaker state
+func (b *upstreamBreaker) State() types.CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// open trips the breaker; callers must hold the lock
+func (b *upstreamBreaker) open() {
+	b.state = types.CircuitOpen
+	b.openedAt = time.Now()
+	b.failures = 0
+	b.keys = make(map[string]struct{})
+	b.probing = false
+}
+
+// isUpstreamFailure reports whether an error points at the upstream service
+// rather than at the key that was used
+func isUpstreamFailure(err error) bool {
+	tavilyErr, ok := err.(*errors.TavilyError)
+	if !ok {
+		return false
+	}
+	switch tavilyErr.Type {
+	case errors.ErrorTypeServerError, errors.ErrorTypeTimeout, errors.ErrorTypeNetworkError:
+		return true
+	default:
+		return false
+	}
+}
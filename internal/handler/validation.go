@@ -0,0 +1,25 @@
+package handler
+
+import (
+	"github.com/dbccccccc/tavily-load/internal/errors"
+)
+
+// validateKey checks a key against the Tavily /usage endpoint, caching the usage it
+// returns. The returned reason explains why an unusable key was rejected.
+func (h *Handler) validateKey(key string) (bool, string) {
+	usageTracker := h.getUsageTracker()
+	if usageTracker == nil {
+		return true, ""
+	}
+
+	usage, err := usageTracker.FetchUsageFromAPI(key)
+	if err != nil {
+		if tavilyErr, ok := err.(*errors.TavilyError); ok && tavilyErr.IsPermanent() {
+			return false, "rejected by Tavily: " + tavilyErr.Message
+		}
+		return false, "could not be validated: " + err.Error()
+	}
+
+	usageTracker.UpdateUsage(key, usage)
+	return true, ""
+}
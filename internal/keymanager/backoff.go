@@ -0,0 +1,83 @@
+package keymanager
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/events"
+	"github.com/dbccccccc/tavily-load/pkg/types"
+)
+
+// keyBackoff tracks how often a key has been temporarily blacklisted and how many
+// requests it has served successfully since its last failure
+type keyBackoff struct {
+	strikes       int64
+	successStreak int64
+}
+
+func (m *Manager) getBackoff(key string) *keyBackoff {
+	backoff, _ := m.backoffs.LoadOrStore(key, &keyBackoff{})
+	return backoff.(*keyBackoff)
+}
+
+// nextBlacklistDuration records a new strike for the key and returns the strike count
+// together with the temporary blacklist duration for it
+func (m *Manager) nextBlacklistDuration(key string) (int, time.Duration) {
+	strikes := int(atomic.AddInt64(&m.getBackoff(key).strikes, 1))
+
+	steps := m.config.BlacklistBackoffSteps
+	step := strikes - 1
+	if step >= len(steps) {
+		step = len(steps) - 1
+	}
+	return strikes, steps[step]
+}
+
+// RecordSuccess records a successful request for a key. After enough consecutive
+// successes the key's blacklist backoff starts again from the first step.
+func (m *Manager) RecordSuccess(key string) {
+	m.recordProbeSuccess(key)
+	m.lastSuccess.Store(key, time.Now())
+	m.exhaustedNotified.Delete(key)
+
+	backoff := m.getBackoff(key)
+	streak := atomic.AddInt64(&backoff.successStreak, 1)
+
+	if streak >= int64(m.config.Reloadable().BlacklistResetSuccesses) && atomic.SwapInt64(&backoff.strikes, 0) > 0 {
+		keyPreview := types.KeyPreview(key)
+		m.logger.WithField("key", keyPreview).Debug("Blacklist backoff reset after sustained success")
+	}
+}
+
+// isBlacklisted reports whether a key is blacklisted, releasing temporary
+// blacklist entries whose duration has elapsed into a half-open circuit
+func (m *Manager) isBlacklisted(key string) bool {
+	value, ok := m.blacklist.Load(key)
+	if !ok {
+		return false
+	}
+
+	entry := value.(*types.BlacklistEntry)
+	if entry.Permanent || entry.BlacklistedUntil == nil || time.Now().Before(*entry.BlacklistedUntil) {
+		return true
+	}
+
+	if !m.blacklist.CompareAndDelete(key, value) {
+		return m.isBlacklisted(key)
+	}
+
+	if statusInterface, ok := m.keyStatus.Load(key); ok {
+		status := statusInterface.(*types.KeyStatus)
+		status.Active = true
+		m.keyStatus.Store(key, status)
+	}
+	m.setCircuitState(key, types.CircuitHalfOpen)
+
+	keyPreview := types.KeyPreview(key)
+	m.logger.WithField("key", keyPreview).
+		WithField("strikes", entry.Strikes).
+		Info("Temporary blacklist expired, circuit half-open")
+	m.publishKeyEvent(events.KeyUnblacklisted, key, map[string]interface{}{"reason": unblacklistReasonExpired})
+	m.checkPoolHealth()
+	return false
+}
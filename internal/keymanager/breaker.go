@@ -0,0 +1,123 @@
+package keymanager
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/pkg/types"
+)
+
+// circuitBreaker tracks the circuit state of a single key. An open circuit is the
+// blacklist; when a temporary blacklist expires the circuit becomes half-open and
+// only a limited number of probe requests may use the key until enough of them
+// succeed to close it again.
+type circuitBreaker struct {
+	mu           sync.Mutex
+	state        types.CircuitState
+	probes       int
+	successes    int
+	probeStarted time.Time
+}
+
+func (m *Manager) getBreaker(key string) *circuitBreaker {
+	breaker, _ := m.breakers.LoadOrStore(key, &circuitBreaker{state: types.CircuitClosed})
+	return breaker.(*circuitBreaker)
+}
+
+// circuitState returns the circuit state of a key
+func (m *Manager) circuitState(key string) types.CircuitState {
+	breaker := m.getBreaker(key)
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	return breaker.state
+}
+
+// setCircuitState moves a key's circuit to the given state
+func (m *Manager) setCircuitState(key string, state types.CircuitState) {
+	breaker := m.getBreaker(key)
+	breaker.mu.Lock()
+	breaker.state = state
+	breaker.probes = 0
+	breaker.successes = 0
+	breaker.mu.Unlock()
+
+	if statusInterface, ok := m.keyStatus.Load(key); ok {
+		status := statusInterface.(*types.KeyStatus)
+		status.CircuitState = state
+		m.keyStatus.Store(key, status)
+	}
+}
+
+// probeAvailable reports whether a request could currently use the key without
+// reserving a probe slot
+func (m *Manager) probeAvailable(key string) bool {
+	breaker := m.getBreaker(key)
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	return breaker.state != types.CircuitHalfOpen || breaker.hasProbeSlot(m.config.CircuitHalfOpenProbes, m.config.Reloadable().RequestTimeout)
+}
+
+// allowRequest reports whether a request may use the key, reserving a probe slot
+// when the circuit is half-open
+func (m *Manager) allowRequest(key string) bool {
+	breaker := m.getBreaker(key)
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+
+	if breaker.state != types.CircuitHalfOpen {
+		return true
+	}
+	if !breaker.hasProbeSlot(m.config.CircuitHalfOpenProbes, m.config.Reloadable().RequestTimeout) {
+		return false
+	}
+
+	breaker.probes++
+	breaker.probeStarted = time.Now()
+	return true
+}
+
+// releaseProbe hands back a probe slot reserved by allowRequest for a request
+// that was never sent
+func (m *Manager) releaseProbe(key string) {
+	breaker := m.getBreaker(key)
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	if breaker.state == types.CircuitHalfOpen && breaker.probes > 0 {
+		breaker.probes--
+	}
+}
+
+// hasProbeSlot reports whether another probe may start; probes that never reported
+// back are abandoned after the request timeout. Callers must hold the lock.
+func (b *circuitBreaker) hasProbeSlot(maxProbes int, timeout time.Duration) bool {
+	if b.probes > 0 && time.Since(b.probeStarted) > timeout {
+		b.probes = 0
+	}
+	return b.probes < maxProbes
+}
+
+// recordProbeSuccess records a successful request through a half-open circuit and
+// closes it once enough probes have succeeded
+func (m *Manager) recordProbeSuccess(key string) {
+	breaker := m.getBreaker(key)
+	breaker.mu.Lock()
+	if breaker.state != types.CircuitHalfOpen {
+		breaker.mu.Unlock()
+		return
+	}
+
+	if breaker.probes > 0 {
+		breaker.probes--
+	}
+	breaker.successes++
+	closed := breaker.successes >= m.config.CircuitHalfOpenSuccesses
+	breaker.mu.Unlock()
+
+	if closed {
+		m.setCircuitState(key, types.CircuitClosed)
+		m.startProbation(key)
+
+		keyPreview := types.KeyPreview(key)
+		m.logger.WithField("key", keyPreview).Info("Circuit closed, key reinstated on probation")
+	}
+}
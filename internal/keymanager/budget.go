@@ -0,0 +1,213 @@
+package keymanager
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/repository"
+	"github.com/dbccccccc/tavily-load/pkg/types"
+)
+
+// keyCredits is the in-memory credit counter of a key, used without Redis
+type keyCredits struct {
+	day     string
+	month   string
+	daily   int64
+	monthly int64
+}
+
+// loadBudgets refreshes the per-key credit budgets from the database and works out
+// again which keys have reached a hard budget, so changed budgets and counters
+// kept in Redis across restarts take effect straight away
+func (m *Manager) loadBudgets() {
+	if m.provider != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(m.ctx, 10*time.Second)
+	defer cancel()
+
+	budgets, err := m.keyRepo.GetAllKeyBudgets(ctx)
+	if err != nil {
+		m.logger.WithError(err).Warn("Failed to load key budgets")
+		return
+	}
+
+	m.mu.Lock()
+	m.budgets = budgets
+	m.mu.Unlock()
+
+	m.budgetCappedUntil.Range(func(key, _ interface{}) bool {
+		m.budgetCappedUntil.Delete(key)
+		return true
+	})
+	for key, budget := range budgets {
+		daily, monthly := m.keyCredits(ctx, key)
+		m.checkHardBudget(key, budget, daily, monthly)
+	}
+}
+
+// keyBudget returns the budget of a key and whether it has one
+func (m *Manager) keyBudget(key string) (repository.KeyBudget, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	budget, ok := m.budgets[key]
+	return budget, ok
+}
+
+// RecordCredits counts credits spent by a key against its budgets and its usage baseline
+func (m *Manager) RecordCredits(key string, credits int) {
+	if credits <= 0 {
+		return
+	}
+	atomic.AddInt64(m.getProxiedCreditsPtr(key), int64(credits))
+
+	budget, ok := m.keyBudget(key)
+	if !ok {
+		return
+	}
+
+	daily, monthly := m.addKeyCredits(key, credits)
+	m.checkHardBudget(key, budget, daily, monthly)
+
+	// Warn once, when a request crosses a soft budget
+	preview := types.KeyPreview(key)
+	if budget.DailySoft > 0 && daily >= int64(budget.DailySoft) && daily-int64(credits) < int64(budget.DailySoft) {
+		m.logger.WithField("key", preview).Warnf("Key crossed its soft daily budget of %d credits", budget.DailySoft)
+	}
+	if budget.MonthlySoft > 0 && monthly >= int64(budget.MonthlySoft) && monthly-int64(credits) < int64(budget.MonthlySoft) {
+		m.logger.WithField("key", preview).Warnf("Key crossed its soft monthly budget of %d credits", budget.MonthlySoft)
+	}
+}
+
+// checkHardBudget takes a key out of rotation until the end of the UTC day or
+// month whose hard budget it has reached
+func (m *Manager) checkHardBudget(key string, budget repository.KeyBudget, daily, monthly int64) {
+	now := time.Now().UTC()
+	var until time.Time
+	if budget.MonthlyHard > 0 && monthly >= int64(budget.MonthlyHard) {
+		until = time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	} else if budget.DailyHard > 0 && daily >= int64(budget.DailyHard) {
+		until = time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	} else {
+		return
+	}
+
+	if _, capped := m.budgetCappedUntil.Swap(key, until); !capped {
+		m.logger.WithField("key", types.KeyPreview(key)).
+			WithField("until", until).
+			Warn("Key reached its hard credit budget and left rotation")
+	}
+}
+
+// budgetCapped reports whether a key has reached a hard budget in the current window
+func (m *Manager) budgetCapped(key string) bool {
+	value, ok := m.budgetCappedUntil.Load(key)
+	if !ok {
+		return false
+	}
+	if time.Now().Before(value.(time.Time)) {
+		return true
+	}
+	m.budgetCappedUntil.Delete(key)
+	return false
+}
+
+// addKeyCredits adds credits to a key's counters and returns its daily and
+// monthly totals, shared through Redis when it is available
+func (m *Manager) addKeyCredits(key string, credits int) (int64, int64) {
+	if m.usageCache != nil {
+		ctx, cancel := context.WithTimeout(m.ctx, 2*time.Second)
+		defer cancel()
+		daily, monthly, err := m.usageCache.AddKeyCredits(ctx, key, credits)
+		if err == nil {
+			return daily, monthly
+		}
+		m.logger.WithError(err).Warn("Failed to record key credits in Redis")
+	}
+
+	m.creditsMu.Lock()
+	defer m.creditsMu.Unlock()
+	counter := m.localCredits(key)
+	counter.daily += int64(credits)
+	counter.monthly += int64(credits)
+	return counter.daily, counter.monthly
+}
+
+// keyCredits returns the credits a key has spent today and this month
+func (m *Manager) keyCredits(ctx context.Context, key string) (int64, int64) {
+	if m.usageCache != nil {
+		daily, monthly, err := m.usageCache.GetKeyCredits(ctx, key)
+		if err == nil {
+			return daily, monthly
+		}
+		m.logger.WithError(err).Warn("Failed to read key credits from Redis")
+	}
+
+	m.creditsMu.Lock()
+	defer m.creditsMu.Unlock()
+	counter := m.localCredits(key)
+	return counter.daily, counter.monthly
+}
+
+// localCredits returns the in-memory counter of a key, restarting the daily and
+// monthly totals when the window has moved on. Callers must hold creditsMu.
+func (m *Manager) localCredits(key string) *keyCredits {
+	if m.credits == nil {
+		m.credits = make(map[string]*keyCredits)
+	}
+	counter, ok := m.credits[key]
+	if !ok {
+		counter = &keyCredits{}
+		m.credits[key] = counter
+	}
+
+	now := time.Now().UTC()
+	if day := now.Format("2006-01-02"); counter.day != day {
+		counter.day, counter.daily = day, 0
+	}
+	if month := now.Format("2006-01"); counter.month != month {
+		counter.month, counter.monthly = month, 0
+	}
+	return counter
+}
+
+// BudgetStatus returns a key's budgets and spending, or nil when it has none
+func (m *Manager) BudgetStatus(key string) *types.KeyBudgetStatus {
+	budget, ok := m.keyBudget(key)
+	if !ok {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(m.ctx, 2*time.Second)
+	defer cancel()
+	daily, monthly := m.keyCredits(ctx, key)
+
+	status := &types.KeyBudgetStatus{
+		DailyUsed:   daily,
+		MonthlyUsed: monthly,
+		DailySoft:   budget.DailySoft,
+		DailyHard:   budget.DailyHard,
+		MonthlySoft: budget.MonthlySoft,
+		MonthlyHard: budget.MonthlyHard,
+	}
+	if m.budgetCapped(key) {
+		if value, ok := m.budgetCappedUntil.Load(key); ok {
+			until := value.(time.Time)
+			status.CappedUntil = &until
+		}
+	}
+
+	if budget.DailySoft > 0 && daily >= int64(budget.DailySoft) {
+		status.Warnings = append(status.Warnings, fmt.Sprintf("%d of %d daily credits spent (soft budget)", daily, budget.DailySoft))
+	}
+	if budget.MonthlySoft > 0 && monthly >= int64(budget.MonthlySoft) {
+		status.Warnings = append(status.Warnings, fmt.Sprintf("%d of %d monthly credits spent (soft budget)", monthly, budget.MonthlySoft))
+	}
+	if status.CappedUntil != nil {
+		status.Warnings = append(status.Warnings, fmt.Sprintf("hard budget reached, out of rotation until %s", status.CappedUntil.Format(time.RFC3339)))
+	}
+	return status
+}
@@ -0,0 +1,41 @@
+package keymanager
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// sharedCursorTimeout bounds advancing the shared cursor; a slower Redis leaves
+// the request to the local cursor
+const sharedCursorTimeout = 200 * time.Millisecond
+
+// nextPosition advances a pool's rotation and returns the new position. With
+// SHARED_CURSOR_ENABLED the position comes from a cursor in Redis that every
+// replica advances, so together they rotate through the pool evenly instead of
+// each starting from the same keys.
+func (m *Manager) nextPosition(ctx context.Context, pool string, cursor *int64) int64 {
+	if position, ok := m.sharedPosition(ctx, pool, cursor); ok {
+		return position
+	}
+	return atomic.AddInt64(cursor, 1)
+}
+
+// sharedPosition advances a pool's shared cursor. The local cursor follows it so
+// rotation carries on from there while Redis is unreachable.
+func (m *Manager) sharedPosition(ctx context.Context, pool string, cursor *int64) (int64, bool) {
+	if !m.config.SharedCursorEnabled || !m.usageCache.Shared() {
+		return 0, false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sharedCursorTimeout)
+	defer cancel()
+
+	position, err := m.usageCache.NextCursor(ctx, pool)
+	if err != nil {
+		m.logger.WithError(err).Debug("Failed to advance shared rotation cursor")
+		return 0, false
+	}
+	atomic.StoreInt64(cursor, position)
+	return position, true
+}
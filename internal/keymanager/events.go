@@ -0,0 +1,150 @@
+package keymanager
+
+import (
+	"sort"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/events"
+	"github.com/dbccccccc/tavily-load/pkg/types"
+)
+
+// Events returns the bus key and request lifecycle events are published on
+func (m *Manager) Events() *events.Bus {
+	return m.events
+}
+
+// publishKeyEvent publishes a key lifecycle event, adding the pools the key serves
+func (m *Manager) publishKeyEvent(eventType events.Type, key string, data map[string]interface{}) {
+	data["pools"] = m.keyPools(key)
+	m.events.Publish(events.Event{Type: eventType, Key: key, Data: data})
+}
+
+// notifyExhausted publishes key.exhausted the first time a key is found out of
+// credits; the key is reported again only after it has served a request
+func (m *Manager) notifyExhausted(key, reason string) {
+	if _, notified := m.exhaustedNotified.LoadOrStore(key, true); notified {
+		return
+	}
+
+	data := map[string]interface{}{"reason": reason}
+	if remaining, err := m.usageTracker.CalculateRemainingPoints(key); err == nil && remaining.PlanResetAt != nil {
+		data["plan_reset_at"] = remaining.PlanResetAt
+	}
+	m.publishKeyEvent(events.KeyExhausted, key, data)
+}
+
+// checkPoolHealth publishes pool.low_active_keys when a pool's keys that are
+// neither blacklisted nor quarantined drop below WEBHOOK_POOL_MIN_ACTIVE_KEYS, and
+// pool.all_keys_unavailable when no key at all is left. Each is published again
+// only after a recovery.
+func (m *Manager) checkPoolHealth() {
+	m.mu.RLock()
+	keys := m.keys
+	pools := make(map[string][]string, len(m.pools))
+	for pool, poolKeys := range m.pools {
+		pools[pool] = poolKeys
+	}
+	m.mu.RUnlock()
+
+	usable := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		usable[key] = !m.blacklistedNow(key) && !m.IsQuarantined(key)
+	}
+
+	if threshold := m.config.Reloadable().WebhookPoolMinActiveKeys; threshold > 0 {
+		for pool, poolKeys := range pools {
+			active := 0
+			for _, key := range poolKeys {
+				if usable[key] {
+					active++
+				}
+			}
+			if active >= threshold {
+				m.lowPools.Delete(pool)
+				continue
+			}
+			if _, reported := m.lowPools.LoadOrStore(pool, true); reported {
+				continue
+			}
+
+			m.logger.WithField("pool", pool).
+				WithField("active_keys", active).
+				Warn("Pool is running out of active keys")
+			m.events.Publish(events.Event{
+				Type: events.PoolLowKeys,
+				Pool: pool,
+				Data: map[string]interface{}{
+					"pool":        pool,
+					"active_keys": active,
+					"total_keys":  len(poolKeys),
+					"threshold":   threshold,
+				},
+			})
+		}
+	}
+
+	blacklisted, quarantined := 0, 0
+	for _, key := range keys {
+		if usable[key] {
+			m.allKeysDown.Store(false)
+			return
+		}
+		if m.IsQuarantined(key) {
+			quarantined++
+		} else {
+			blacklisted++
+		}
+	}
+	if len(keys) == 0 || m.allKeysDown.Swap(true) {
+		return
+	}
+	m.events.Publish(events.Event{
+		Type: events.AllKeysUnavailable,
+		Data: map[string]interface{}{
+			"total_keys":       len(keys),
+			"blacklisted_keys": blacklisted,
+			"quarantined_keys": quarantined,
+		},
+	})
+}
+
+// recordRequestMetrics feeds the outcome of proxied requests to the usage tracker
+func (m *Manager) recordRequestMetrics(event events.Event) {
+	success := event.Type == events.RequestSucceeded
+	latency, _ := event.Data["latency"].(time.Duration)
+	m.usageTracker.UpdateKeyMetrics(event.Key, success, latency)
+
+	if strategy, _ := event.Data["strategy"].(types.SelectionStrategy); strategy != "" {
+		upstreamLatency, _ := event.Data["upstream_latency"].(time.Duration)
+		m.usageTracker.RecordStrategyOutcome(strategy, event.Key, success, upstreamLatency)
+	}
+}
+
+// blacklistedNow reports whether a key's blacklist entry is in force, without
+// releasing expired entries as isBlacklisted does
+func (m *Manager) blacklistedNow(key string) bool {
+	value, ok := m.blacklist.Load(key)
+	if !ok {
+		return false
+	}
+	entry := value.(*types.BlacklistEntry)
+	return entry.Permanent || entry.BlacklistedUntil == nil || time.Now().Before(*entry.BlacklistedUntil)
+}
+
+// keyPools returns the names of the pools a key belongs to
+func (m *Manager) keyPools(key string) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	pools := []string{}
+	for pool, keys := range m.pools {
+		for _, poolKey := range keys {
+			if poolKey == key {
+				pools = append(pools, pool)
+				break
+			}
+		}
+	}
+	sort.Strings(pools)
+	return pools
+}
@@ -3,53 +3,99 @@ package keymanager
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/dbccccccc/tavily-load/internal/cache"
 	"github.com/dbccccccc/tavily-load/internal/config"
 	"github.com/dbccccccc/tavily-load/internal/errors"
+	"github.com/dbccccccc/tavily-load/internal/events"
+	"github.com/dbccccccc/tavily-load/internal/keyprovider"
 	"github.com/dbccccccc/tavily-load/internal/repository"
+	"github.com/dbccccccc/tavily-load/internal/strategy"
+	"github.com/dbccccccc/tavily-load/internal/tracing"
 	"github.com/dbccccccc/tavily-load/internal/usage"
 	"github.com/dbccccccc/tavily-load/pkg/types"
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
 
 // Manager implements the KeyManager interface
 type Manager struct {
 	keys              []string
+	pools             map[string][]string // pool name -> keys, guarded by mu
+	poolCursors       sync.Map            // map[string]*int64
 	currentIndex      int64
-	keyRepo           *repository.KeyRepository
-	usageCache        *cache.UsageCache
+	keyRepo           types.KeyRepository  // nil when running without a database
+	provider          keyprovider.Provider // nil when keys come from the database
+	usageCache        types.UsageCache
 	blacklist         sync.Map // map[string]*types.BlacklistEntry
 	keyStatus         sync.Map // map[string]*types.KeyStatus
 	requestCounts     sync.Map // map[string]int64
 	errorCounts       sync.Map // map[string]int64
 	lastUsed          sync.Map // map[string]time.Time
+	backoffs          sync.Map // map[string]*keyBackoff
+	breakers          sync.Map // map[string]*circuitBreaker
+	rateLimitedUntil  sync.Map // map[string]time.Time
+	probationUntil    sync.Map // map[string]time.Time
+	budgetCappedUntil sync.Map // map[string]time.Time
+	quarantined       sync.Map // map[string]*types.QuarantineEntry
+	lastSuccess       sync.Map // map[string]time.Time
+	usageBaselines    sync.Map // map[string]*usageBaseline
+	proxiedCredits    sync.Map // map[string]*int64
+	exhaustedNotified sync.Map // map[string]bool
+	lowPools          sync.Map // map[string]bool
+	sharedEntries     sync.Map // map[string]*types.BlacklistEntry, adopted from other replicas
 	config            *config.Config
 	logger            *logrus.Logger
 	usageTracker      *usage.Tracker
 	selectionStrategy types.SelectionStrategy
+	strategies        *strategy.Registry
 	mu                sync.RWMutex
 	startTime         time.Time
 	ctx               context.Context
+
+	budgets   map[string]repository.KeyBudget // key -> credit budget, guarded by mu
+	creditsMu sync.Mutex
+	credits   map[string]*keyCredits // in-memory credit counters, guarded by creditsMu
+
+	// events carries key and request lifecycle events to their subscribers
+	events      *events.Bus
+	allKeysDown atomic.Bool
+	// instanceID tells this replica's key change announcements from the others'
+	instanceID string
 }
 
-// NewManager creates a new key manager
-func NewManager(cfg *config.Config, logger *logrus.Logger, keyRepo *repository.KeyRepository, usageCache *cache.UsageCache) (*Manager, error) {
+// NewManager creates a new key manager. upstream carries its /usage lookups to
+// Tavily.
+func NewManager(cfg *config.Config, logger *logrus.Logger, keyRepo types.KeyRepository, usageCache types.UsageCache, upstream http.RoundTripper) (*Manager, error) {
+	provider, err := keyprovider.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	ctx := context.Background()
 	manager := &Manager{
 		config:            cfg,
 		logger:            logger,
 		keyRepo:           keyRepo,
+		provider:          provider,
 		usageCache:        usageCache,
-		usageTracker:      usage.NewTracker(cfg, logger, usageCache),
-		selectionStrategy: types.StrategyPlanFirst,
+		usageTracker:      usage.NewTracker(cfg, logger, usageCache, upstream),
+		selectionStrategy: types.SelectionStrategy(cfg.DefaultSelectionStrategy),
 		startTime:         time.Now(),
 		ctx:               ctx,
+		events:            events.NewBus(logger),
+		instanceID:        uuid.New().String(),
 	}
 
+	manager.events.Subscribe(manager.recordRequestMetrics, events.RequestSucceeded, events.RequestFailed)
+	manager.strategies = strategy.NewDefaultRegistry(&manager.currentIndex)
+	manager.usageTracker.SetRegistry(manager.strategies)
+	manager.restoreSelectionStrategy()
+
 	if err := manager.loadKeys(); err != nil {
 		return nil, fmt.Errorf("failed to load keys: %w", err)
 	}
@@ -58,117 +104,302 @@ func NewManager(cfg *config.Config, logger *logrus.Logger, keyRepo *repository.K
 	return manager, nil
 }
 
-// loadKeys loads API keys from the database
+// loadKeys loads API keys from the key source. An empty pool is allowed so the
+// service can start before any keys have been added.
 func (m *Manager) loadKeys() error {
+	keys, pools, err := m.fetchActiveKeys()
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.keys = keys
+	m.pools = pools
+	if len(keys) > 0 {
+		m.currentIndex = int64(m.config.StartIndex % len(keys))
+	}
+	m.mu.Unlock()
+	m.usageTracker.SetKeys(keys)
+	m.loadBudgets()
+	m.loadQuarantine()
+
+	if len(keys) == 0 {
+		m.logger.Warnf("No active API keys found in %s, proxy requests will fail until keys are added", m.keySourceName())
+		return nil
+	}
+
+	m.logger.Infof("Loaded %d API keys from %s", len(keys), m.keySourceName())
+	return nil
+}
+
+// ReloadKeys refreshes the key pool from the key source, keeping the state of keys
+// that are still present
+func (m *Manager) ReloadKeys() error {
+	keys, pools, err := m.fetchActiveKeys()
+	if err != nil {
+		return err
+	}
+
+	m.applyKeys(keys, pools)
+	m.loadBudgets()
+	m.loadQuarantine()
+	m.logger.Infof("Reloaded %d API keys from %s", len(keys), m.keySourceName())
+	return nil
+}
+
+// applyKeys replaces the rotation pool, initializing keys that are new
+func (m *Manager) applyKeys(keys []string, pools map[string][]string) {
+	for _, key := range keys {
+		m.initializeKey(key)
+	}
+
+	m.mu.Lock()
+	m.keys = keys
+	m.pools = pools
+	m.mu.Unlock()
+	m.usageTracker.SetKeys(keys)
+}
+
+// fetchActiveKeys returns the values of all active keys in the key source, along
+// with the same keys grouped by pool. Keys from an external provider all belong
+// to the default pool. In multi-tenant mode pools are named with TenantPool.
+func (m *Manager) fetchActiveKeys() ([]string, map[string][]string, error) {
 	ctx, cancel := context.WithTimeout(m.ctx, 10*time.Second)
 	defer cancel()
 
-	apiKeys, err := m.keyRepo.GetAllActiveKeys(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to load keys from database: %w", err)
+	if m.provider != nil {
+		keys, err := m.provider.FetchKeys(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load keys from %s: %w", m.provider.Name(), err)
+		}
+		return keys, map[string][]string{m.config.DefaultKeyPool: keys}, nil
 	}
 
-	if len(apiKeys) == 0 {
-		return fmt.Errorf("no active API keys found in database")
+	apiKeys, err := m.keyRepo.GetAllActiveKeys(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load keys from database: %w", err)
 	}
 
-	var keys []string
+	keys := make([]string, 0, len(apiKeys))
+	pools := make(map[string][]string)
 	for _, apiKey := range apiKeys {
+		pool := apiKey.Pool
+		if m.config.MultiTenantEnabled {
+			pool = TenantPool(apiKey.Tenant, apiKey.Pool)
+		}
 		keys = append(keys, apiKey.KeyValue)
+		pools[pool] = append(pools[pool], apiKey.KeyValue)
 	}
-
-	m.keys = keys
-	m.currentIndex = int64(m.config.StartIndex % len(keys))
-
-	m.logger.Infof("Loaded %d API keys from database", len(keys))
-	return nil
+	return keys, pools, nil
 }
 
 // initializeKeyStatus initializes the status for all keys
 func (m *Manager) initializeKeyStatus() {
 	for _, key := range m.keys {
-		m.keyStatus.Store(key, &types.KeyStatus{
-			Active:       true,
-			ErrorCount:   0,
-			RequestCount: 0,
-			LastUsed:     time.Time{},
-		})
-		requestCount := int64(0)
-		errorCount := int64(0)
-		m.requestCounts.Store(key, &requestCount)
-		m.errorCounts.Store(key, &errorCount)
+		m.initializeKey(key)
 	}
 }
 
+// initializeKey sets up the status and counters of a key unless it already has them
+func (m *Manager) initializeKey(key string) {
+	m.keyStatus.LoadOrStore(key, &types.KeyStatus{
+		Active:       true,
+		ErrorCount:   0,
+		RequestCount: 0,
+		LastUsed:     time.Time{},
+		CircuitState: types.CircuitClosed,
+	})
+	requestCount := int64(0)
+	errorCount := int64(0)
+	m.requestCounts.LoadOrStore(key, &requestCount)
+	m.errorCounts.LoadOrStore(key, &errorCount)
+}
+
 // GetNextKey returns the next available API key using the current strategy
 func (m *Manager) GetNextKey() (string, error) {
 	return m.GetNextKeyWithStrategy(m.selectionStrategy)
 }
 
-// GetNextKeyWithStrategy returns the next available API key using the specified strategy
+// GetNextKeyWithStrategy returns the next available API key from the default pool
+// using the specified strategy
 func (m *Manager) GetNextKeyWithStrategy(strategy types.SelectionStrategy) (string, error) {
-	// Try strategy-based selection first
-	if strategy == types.StrategyPlanFirst {
-		if key, err := m.usageTracker.GetOptimalKey(strategy); err == nil {
-			// Verify the key is not blacklisted
-			if _, blacklisted := m.blacklist.Load(key); !blacklisted {
-				m.updateKeyUsage(key)
-				return key, nil
-			}
+	key, _, err := m.selectKey(m.ctx, strategy, m.config.DefaultKeyPool, "")
+	return key, err
+}
+
+// SelectKeyForRequest returns the next available API key from a pool for a request,
+// together with the strategy that actually chose it. With the consistent-hash strategy
+// the routing key pins identical requests to the same key; other strategies ignore it.
+func (m *Manager) SelectKeyForRequest(ctx context.Context, pool, routingKey string) (string, types.SelectionStrategy, error) {
+	ctx, span := tracing.Start(ctx, "keymanager.SelectKey", tracing.KindInternal)
+	defer span.End()
+
+	key, strategy, err := m.selectKey(ctx, m.GetSelectionStrategy(), pool, routingKey)
+	span.SetAttribute("key_pool", pool)
+	span.SetAttribute("strategy", string(strategy))
+	if err != nil {
+		span.RecordError(err)
+		return key, strategy, err
+	}
+	if len(key) > 12 {
+		span.SetAttribute("key_preview", types.KeyPreview(key))
+	}
+	m.events.Publish(events.Event{
+		Type: events.KeySelected,
+		Key:  key,
+		Pool: pool,
+		Data: map[string]interface{}{"strategy": strategy},
+	})
+	return key, strategy, nil
+}
+
+// selectKey runs the registered selector for the strategy, falling back to round-robin
+func (m *Manager) selectKey(ctx context.Context, strategy types.SelectionStrategy, pool, routingKey string) (string, types.SelectionStrategy, error) {
+	usageSource := &selectionContext{Tracker: m.usageTracker, manager: m, ctx: ctx, pool: pool, routingKey: routingKey, cursor: m.poolCursor(pool)}
+	if key, err := m.strategies.Select(strategy, m.availableKeys(pool), usageSource); err == nil {
+		// Verify the key is not blacklisted
+		if !m.isBlacklisted(key) && m.claimKey(ctx, key) {
+			m.updateKeyUsage(ctx, key)
+			return key, strategy, nil
 		}
 	}
 
 	// Fallback to round-robin selection
-	return m.getRoundRobinKey()
+	key, err := m.getRoundRobinKey(ctx, pool)
+	return key, types.StrategyRoundRobin, err
 }
 
-// getRoundRobinKey returns the next available API key using round-robin
-func (m *Manager) getRoundRobinKey() (string, error) {
-	m.mu.RLock()
-	totalKeys := len(m.keys)
-	m.mu.RUnlock()
+// selectionContext exposes usage data to strategies, using the manager's own error counters
+type selectionContext struct {
+	*usage.Tracker
+	manager    *Manager
+	ctx        context.Context
+	pool       string
+	routingKey string
+	cursor     *int64
+}
+
+// ErrorRate implements types.KeyUsageSource
+func (c *selectionContext) ErrorRate(key string) float64 {
+	return c.manager.errorRate(key)
+}
+
+// RoutingKey implements types.RoutingKeySource
+func (c *selectionContext) RoutingKey() string {
+	return c.routingKey
+}
+
+// Cursor implements types.CursorSource, giving each pool its own rotation
+func (c *selectionContext) Cursor() *int64 {
+	return c.cursor
+}
+
+// NextPosition implements types.PositionSource, advancing the pool's cursor shared
+// by the replicas when SHARED_CURSOR_ENABLED is set
+func (c *selectionContext) NextPosition() (int64, bool) {
+	return c.manager.sharedPosition(c.ctx, c.pool, c.cursor)
+}
+
+// RegisterStrategy registers a custom key selection strategy
+func (m *Manager) RegisterStrategy(strategy types.SelectionStrategy, description string, selector types.KeySelector) {
+	m.strategies.Register(strategy, description, selector)
+	m.logger.WithField("strategy", strategy).Info("Selection strategy registered")
+}
+
+// GetStrategyRegistry returns the registry of available selection strategies
+func (m *Manager) GetStrategyRegistry() *strategy.Registry {
+	return m.strategies
+}
+
+// availableKeys returns the keys of a pool that are currently not blacklisted or rate limited
+func (m *Manager) availableKeys(pool string) []string {
+	poolKeys := m.poolKeys(pool)
+
+	keys := make([]string, 0, len(poolKeys))
+	for _, key := range poolKeys {
+		if !m.isBlacklisted(key) && !m.rateLimited(key) && !m.budgetCapped(key) && !m.IsQuarantined(key) && m.probeAvailable(key) && m.probationAllows(key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// getRoundRobinKey returns the next available API key of a pool using round-robin
+func (m *Manager) getRoundRobinKey(ctx context.Context, pool string) (string, error) {
+	keys := m.poolKeys(pool)
+	cursor := m.poolCursor(pool)
+	totalKeys := len(keys)
 
 	if totalKeys == 0 {
-		return "", errors.NewTavilyError(errors.ErrorTypeNoKeysAvailable, "no API keys available", 500)
+		return "", errors.NewTavilyError(errors.ErrorTypeNoKeysAvailable, "no API keys available", 503)
 	}
 
 	// Try to find an active key, starting from current index
 	for i := 0; i < totalKeys; i++ {
-		index := atomic.AddInt64(&m.currentIndex, 1) % int64(totalKeys)
-
-		m.mu.RLock()
-		key := m.keys[index]
-		m.mu.RUnlock()
+		index := m.nextPosition(ctx, pool, cursor) % int64(totalKeys)
+		key := keys[index]
 
 		// Check if key is blacklisted
-		if _, blacklisted := m.blacklist.Load(key); blacklisted {
+		if m.isBlacklisted(key) || m.budgetCapped(key) || m.IsQuarantined(key) || !m.probationAllows(key) || !m.claimKey(ctx, key) {
 			continue
 		}
 
 		// Update usage statistics
-		m.updateKeyUsage(key)
-		keyPreview := key
-		if len(key) > 12 {
-			keyPreview = key[:12] + "..."
-		}
+		m.updateKeyUsage(ctx, key)
+		keyPreview := types.KeyPreview(key)
 		m.logger.Debugf("Selected key: %s (index: %d)", keyPreview, index)
 		return key, nil
 	}
 
-	return "", errors.NewTavilyError(errors.ErrorTypeNoKeysAvailable, "all API keys are blacklisted", 500)
+	return "", errors.NewTavilyError(errors.ErrorTypeNoKeysAvailable, "all API keys are blacklisted or rate limited", 500)
+}
+
+// claimKey reserves a request on a key that passed the local checks. The circuit
+// breaker is consulted before the key's RPM bucket, so a key that cannot be used
+// spends no token of the shared limit, and a probe slot reserved for a half-open
+// circuit is handed back when the bucket turns out to be empty.
+func (m *Manager) claimKey(ctx context.Context, key string) bool {
+	if !m.allowRequest(key) {
+		return false
+	}
+	if !m.takeToken(ctx, key) {
+		m.releaseProbe(key)
+		return false
+	}
+	return true
+}
+
+// errorRate returns the smoothed error rate of a key
+func (m *Manager) errorRate(key string) float64 {
+	requests := atomic.LoadInt64(m.getRequestCountPtr(key))
+	errorCount := atomic.LoadInt64(m.getErrorCountPtr(key))
+	return float64(errorCount) / float64(requests+1)
 }
 
 // BlacklistKey adds a key to the blacklist
 func (m *Manager) BlacklistKey(key string, permanent bool) {
+	m.blacklistKey(key, permanent, 0)
+}
+
+// blacklistKey adds a key to the blacklist. A positive retryAfter, as requested by the
+// upstream, replaces the backoff duration of a temporary blacklist.
+func (m *Manager) blacklistKey(key string, permanent bool, retryAfter time.Duration) {
 	now := time.Now()
 	reason := "temporary error"
 	var until *time.Time
-	
+	var duration time.Duration
+	strikes := 0
+
 	if permanent {
 		reason = "permanent error"
 	} else {
-		// Temporary blacklist for 5 minutes
-		tempUntil := now.Add(5 * time.Minute)
+		// Temporary blacklist that grows with each repeated failure
+		strikes, duration = m.nextBlacklistDuration(key)
+		if retryAfter > 0 {
+			reason = "rate limited"
+			duration = retryAfter
+		}
+		tempUntil := now.Add(duration)
 		until = &tempUntil
 	}
 
@@ -178,48 +409,109 @@ func (m *Manager) BlacklistKey(key string, permanent bool) {
 	// Blacklist in database
 	ctx, cancel := context.WithTimeout(m.ctx, 5*time.Second)
 	defer cancel()
-	
-	if err := m.keyRepo.BlacklistKey(ctx, key, reason, permanent, until); err != nil {
-		m.logger.WithError(err).Error("Failed to blacklist key in database")
-	}
 
-	// Cache blacklist status
-	if err := m.usageCache.SetBlacklistStatus(ctx, key, true, reason, until); err != nil {
-		m.logger.WithError(err).Warn("Failed to cache blacklist status")
+	if m.keyRepo != nil {
+		if err := m.keyRepo.BlacklistKey(ctx, key, reason, permanent, until, strikes); err != nil {
+			m.logger.WithError(err).Error("Failed to blacklist key in database")
+		}
 	}
 
 	entry := &types.BlacklistEntry{
-		Key:           key,
-		Reason:        reason,
-		BlacklistedAt: now,
-		Permanent:     permanent,
-		ErrorCount:    errorCount,
+		Key:              key,
+		Reason:           reason,
+		BlacklistedAt:    now,
+		BlacklistedUntil: until,
+		Permanent:        permanent,
+		ErrorCount:       errorCount,
+		Strikes:          strikes,
+		Duration:         duration,
 	}
 
-	m.blacklist.Store(key, entry)
-
-	// Update key status
-	if statusInterface, ok := m.keyStatus.Load(key); ok {
-		status := statusInterface.(*types.KeyStatus)
-		status.Active = false
-		status.BlacklistedAt = now
-		status.Permanent = permanent
-		m.keyStatus.Store(key, status)
-	}
+	m.shareBlacklistEntry(ctx, entry)
+	m.storeBlacklistEntry(entry)
 
 	logLevel := logrus.InfoLevel
 	if permanent {
 		logLevel = logrus.WarnLevel
 	}
 
-	keyPreview := key
-	if len(key) > 12 {
-		keyPreview = key[:12] + "..."
-	}
+	keyPreview := types.KeyPreview(key)
 	m.logger.WithField("key", keyPreview).
 		WithField("permanent", permanent).
 		WithField("error_count", errorCount).
+		WithField("strikes", strikes).
+		WithField("duration", duration).
 		Log(logLevel, "Key blacklisted")
+
+	m.publishKeyEvent(events.KeyBlacklisted, key, map[string]interface{}{
+		"reason":            reason,
+		"permanent":         permanent,
+		"blacklisted_until": until,
+		"error_count":       errorCount,
+		"strikes":           strikes,
+	})
+	m.checkPoolHealth()
+}
+
+// UnblacklistKey removes a single key from the blacklist in the database, Redis and
+// memory. The key's error count is cleared and it rejoins the rotation on probation.
+// The change is audited as made by the actor of ctx.
+func (m *Manager) UnblacklistKey(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if m.keyRepo != nil {
+		if err := m.keyRepo.UnblacklistKey(ctx, key); err != nil {
+			return fmt.Errorf("failed to unblacklist key in database: %w", err)
+		}
+	}
+
+	m.clearSharedBlacklist(key)
+
+	if m.clearBlacklistEntry(key) {
+		m.publishKeyEvent(events.KeyUnblacklisted, key, map[string]interface{}{"reason": unblacklistReasonReinstated})
+		m.checkPoolHealth()
+	}
+
+	keyPreview := types.KeyPreview(key)
+	m.logger.WithField("key", keyPreview).Info("Key removed from blacklist")
+	return nil
+}
+
+// storeBlacklistEntry takes a key out of rotation in memory
+func (m *Manager) storeBlacklistEntry(entry *types.BlacklistEntry) {
+	m.blacklist.Store(entry.Key, entry)
+	m.setCircuitState(entry.Key, types.CircuitOpen)
+	m.endProbation(entry.Key)
+
+	// Update key status
+	if statusInterface, ok := m.keyStatus.Load(entry.Key); ok {
+		status := statusInterface.(*types.KeyStatus)
+		status.Active = false
+		status.BlacklistedAt = entry.BlacklistedAt
+		status.Permanent = entry.Permanent
+		m.keyStatus.Store(entry.Key, status)
+	}
+}
+
+// clearBlacklistEntry returns a key to rotation in memory, on probation if it was
+// blacklisted, and reports whether it was
+func (m *Manager) clearBlacklistEntry(key string) bool {
+	_, wasBlacklisted := m.blacklist.LoadAndDelete(key)
+	atomic.StoreInt64(m.getErrorCountPtr(key), 0)
+
+	if statusInterface, ok := m.keyStatus.Load(key); ok {
+		status := statusInterface.(*types.KeyStatus)
+		status.Active = true
+		status.ErrorCount = 0
+		status.Permanent = false
+		m.keyStatus.Store(key, status)
+	}
+	m.setCircuitState(key, types.CircuitClosed)
+	if wasBlacklisted {
+		m.startProbation(key)
+	}
+	return wasBlacklisted
 }
 
 // ResetKeys clears all blacklisted keys and resets statistics
@@ -228,27 +520,53 @@ func (m *Manager) ResetKeys() {
 		m.blacklist.Delete(key)
 		return true
 	})
+	m.backoffs.Range(func(key, value interface{}) bool {
+		m.backoffs.Delete(key)
+		return true
+	})
+	m.breakers.Range(func(key, value interface{}) bool {
+		m.breakers.Delete(key)
+		return true
+	})
+	m.probationUntil.Range(func(key, value interface{}) bool {
+		m.probationUntil.Delete(key)
+		return true
+	})
+
+	m.mu.RLock()
+	keys := make([]string, len(m.keys))
+	copy(keys, m.keys)
+	m.mu.RUnlock()
+
+	m.clearSharedBlacklist(keys...)
 
 	// Reset key status
-	for _, key := range m.keys {
-		m.keyStatus.Store(key, &types.KeyStatus{
-			Active:       true,
-			ErrorCount:   0,
-			RequestCount: 0,
-			LastUsed:     time.Time{},
-		})
-		requestCount := int64(0)
-		errorCount := int64(0)
-		m.requestCounts.Store(key, &requestCount)
-		m.errorCounts.Store(key, &errorCount)
+	for _, key := range keys {
+		m.resetKeyStatus(key)
 	}
 
 	m.logger.Info("All keys reset and blacklist cleared")
 }
 
+// resetKeyStatus gives a key a fresh status and zeroed counters
+func (m *Manager) resetKeyStatus(key string) {
+	m.keyStatus.Store(key, &types.KeyStatus{
+		Active:       true,
+		ErrorCount:   0,
+		RequestCount: 0,
+		LastUsed:     time.Time{},
+		CircuitState: types.CircuitClosed,
+	})
+	requestCount := int64(0)
+	errorCount := int64(0)
+	m.requestCounts.Store(key, &requestCount)
+	m.errorCounts.Store(key, &errorCount)
+}
+
 // RecordError records an error for a specific key
 func (m *Manager) RecordError(key string, err error) {
 	atomic.AddInt64(m.getErrorCountPtr(key), 1)
+	atomic.StoreInt64(&m.getBackoff(key).successStreak, 0)
 
 	// Update key status
 	if statusInterface, ok := m.keyStatus.Load(key); ok {
@@ -258,24 +576,49 @@ func (m *Manager) RecordError(key string, err error) {
 		m.keyStatus.Store(key, status)
 	}
 
-	// Check if we should blacklist the key
-	errorCount := atomic.LoadInt64(m.getErrorCountPtr(key))
-	if int(errorCount) >= m.config.BlacklistThreshold {
+	// A key revoked behind the proxy's back waits for review instead of being
+	// blacklisted for good
+	if m.checkSuddenAuthFailure(key, err) {
+		return
+	}
+
+	if tavilyErr, ok := err.(*errors.TavilyError); ok && tavilyErr.Type == errors.ErrorTypeQuotaExceeded {
+		m.notifyExhausted(key, tavilyErr.Message)
+	}
+
+	// Check if we should blacklist the key; a failed probe or a failure on probation
+	// sends it back to the blacklist immediately
+	errorCount := m.sharedErrorCount(key, atomic.LoadInt64(m.getErrorCountPtr(key)))
+	if int(errorCount) >= m.config.Reloadable().BlacklistThreshold || m.circuitState(key) == types.CircuitHalfOpen || m.inProbation(key) {
 		permanent := false
+		var retryAfter time.Duration
 		if tavilyErr, ok := err.(*errors.TavilyError); ok {
 			permanent = tavilyErr.IsPermanent()
+			retryAfter = tavilyErr.RetryAfter
 		}
-		m.BlacklistKey(key, permanent)
+		m.blacklistKey(key, permanent, retryAfter)
 	}
 }
 
 // GetStats returns current statistics
 func (m *Manager) GetStats() types.KeyStats {
 	m.mu.RLock()
-	totalKeys := len(m.keys)
-	currentIndex := int(atomic.LoadInt64(&m.currentIndex)) % totalKeys
+	keys := make([]string, len(m.keys))
+	copy(keys, m.keys)
 	m.mu.RUnlock()
 
+	return m.statsForKeys(keys, &m.currentIndex)
+}
+
+// statsForKeys returns the statistics of the given keys, reporting cursor as the
+// rotation position
+func (m *Manager) statsForKeys(keys []string, cursor *int64) types.KeyStats {
+	totalKeys := len(keys)
+	currentIndex := 0
+	if totalKeys > 0 {
+		currentIndex = int(atomic.LoadInt64(cursor)) % totalKeys
+	}
+
 	stats := types.KeyStats{
 		TotalKeys:     totalKeys,
 		CurrentIndex:  currentIndex,
@@ -288,7 +631,7 @@ func (m *Manager) GetStats() types.KeyStats {
 	activeKeys := 0
 	blacklistedKeys := 0
 
-	for _, key := range m.keys {
+	for _, key := range keys {
 		// Get request count
 		if countInterface, ok := m.requestCounts.Load(key); ok {
 			stats.RequestCounts[key] = int(atomic.LoadInt64(countInterface.(*int64)))
@@ -307,6 +650,10 @@ func (m *Manager) GetStats() types.KeyStats {
 		// Get key status
 		if statusInterface, ok := m.keyStatus.Load(key); ok {
 			status := *statusInterface.(*types.KeyStatus)
+			if m.IsQuarantined(key) {
+				status.Active = false
+				status.Quarantined = true
+			}
 			stats.KeyStatus[key] = status
 
 			if status.Active {
@@ -323,6 +670,35 @@ func (m *Manager) GetStats() types.KeyStats {
 	return stats
 }
 
+// InRotation reports whether key is one of the keys currently loaded from the
+// key source. Statuses outlive keys that were deactivated or removed since.
+func (m *Manager) InRotation(key string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, k := range m.keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// GetKeyStatus returns the in-memory status of a single key
+func (m *Manager) GetKeyStatus(key string) (types.KeyStatus, bool) {
+	statusInterface, ok := m.keyStatus.Load(key)
+	if !ok {
+		return types.KeyStatus{}, false
+	}
+	status := *statusInterface.(*types.KeyStatus)
+	status.RequestCount = int(atomic.LoadInt64(m.getRequestCountPtr(key)))
+	status.ErrorCount = int(atomic.LoadInt64(m.getErrorCountPtr(key)))
+	if m.IsQuarantined(key) {
+		status.Active = false
+		status.Quarantined = true
+	}
+	return status, true
+}
+
 // GetBlacklist returns current blacklisted keys
 func (m *Manager) GetBlacklist() []types.BlacklistEntry {
 	var entries []types.BlacklistEntry
@@ -348,25 +724,31 @@ func (m *Manager) getRequestCountPtr(key string) *int64 {
 	return &count
 }
 
-// updateKeyUsage updates usage statistics for a key
-func (m *Manager) updateKeyUsage(key string) {
+// updateKeyUsage updates usage statistics for a key selected for a request. The
+// writes run in the background and are detached from ctx's cancellation, so a
+// client disconnecting does not lose the count.
+func (m *Manager) updateKeyUsage(ctx context.Context, key string) {
 	now := time.Now()
 	m.lastUsed.Store(key, now)
 	atomic.AddInt64(m.getRequestCountPtr(key), 1)
+	m.usageTracker.RecordKeyRequest(key)
+
+	parent := context.WithoutCancel(ctx)
 
 	// Update in database
-	ctx, cancel := context.WithTimeout(m.ctx, 2*time.Second)
-	defer cancel()
-	
-	go func() {
-		if err := m.keyRepo.UpdateKeyUsage(ctx, key, 1, 0); err != nil {
-			m.logger.WithError(err).Debug("Failed to update key usage in database")
-		}
-	}()
+	if m.keyRepo != nil {
+		go func() {
+			ctx, cancel := context.WithTimeout(parent, 2*time.Second)
+			defer cancel()
+			if err := m.keyRepo.UpdateKeyUsage(ctx, key, 1, 0); err != nil {
+				m.logger.WithError(err).Debug("Failed to update key usage in database")
+			}
+		}()
+	}
 
 	// Update in cache
 	go func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		ctx, cancel := context.WithTimeout(parent, 1*time.Second)
 		defer cancel()
 		if err := m.usageCache.IncrementKeyUsage(ctx, key, true); err != nil {
 			m.logger.WithError(err).Debug("Failed to update key usage in cache")
@@ -382,14 +764,41 @@ func (m *Manager) updateKeyUsage(key string) {
 	}
 }
 
-// SetSelectionStrategy sets the key selection strategy
+// SetSelectionStrategy sets the key selection strategy and persists it so it survives restarts
 func (m *Manager) SetSelectionStrategy(strategy types.SelectionStrategy) {
 	m.mu.Lock()
-	defer m.mu.Unlock()
 	m.selectionStrategy = strategy
+	m.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(m.ctx, 2*time.Second)
+	defer cancel()
+	if err := m.usageCache.SetSelectionStrategy(ctx, strategy); err != nil {
+		m.logger.WithError(err).Warn("Failed to persist selection strategy")
+	}
+
 	m.logger.WithField("strategy", strategy).Info("Selection strategy updated")
 }
 
+// restoreSelectionStrategy applies the persisted strategy, falling back to the configured default
+func (m *Manager) restoreSelectionStrategy() {
+	ctx, cancel := context.WithTimeout(m.ctx, 2*time.Second)
+	defer cancel()
+
+	if persisted, err := m.usageCache.GetSelectionStrategy(ctx); err == nil && persisted != "" {
+		if m.strategies.Has(persisted) {
+			m.selectionStrategy = persisted
+			m.logger.WithField("strategy", persisted).Info("Restored persisted selection strategy")
+			return
+		}
+		m.logger.WithField("strategy", persisted).Warn("Ignoring unknown persisted selection strategy")
+	}
+
+	if !m.strategies.Has(m.selectionStrategy) {
+		m.logger.WithField("strategy", m.selectionStrategy).Warn("Unknown DEFAULT_SELECTION_STRATEGY, using round_robin")
+		m.selectionStrategy = types.StrategyRoundRobin
+	}
+}
+
 // GetSelectionStrategy returns the current selection strategy
 func (m *Manager) GetSelectionStrategy() types.SelectionStrategy {
 	m.mu.RLock()
@@ -407,12 +816,9 @@ func (m *Manager) UpdateUsageFromAPI() error {
 	var errors []error
 	for _, key := range keys {
 		if usage, err := m.usageTracker.FetchUsageFromAPI(key); err == nil {
-			m.usageTracker.UpdateUsage(key, usage)
+			m.updateUsage(key, usage)
 		} else {
-			keyPreview := key
-			if len(key) > 12 {
-				keyPreview = key[:12] + "..."
-			}
+			keyPreview := types.KeyPreview(key)
 			errors = append(errors, fmt.Errorf("failed to update usage for key %s: %w", keyPreview, err))
 		}
 	}
@@ -427,8 +833,11 @@ func (m *Manager) UpdateUsageFromAPI() error {
 
 // GetUsageAnalytics returns comprehensive usage analytics
 func (m *Manager) GetUsageAnalytics() *types.UsageAnalytics {
-	allUsage := m.usageTracker.GetAllUsage()
-	keyStats := m.GetStats()
+	return m.usageAnalytics(m.GetStats(), m.usageTracker.GetAllUsage())
+}
+
+// usageAnalytics builds analytics from key statistics and the usage of the same keys
+func (m *Manager) usageAnalytics(keyStats types.KeyStats, allUsage map[string]*types.TavilyUsage) *types.UsageAnalytics {
 
 	analytics := &types.UsageAnalytics{
 		TotalKeys:           keyStats.TotalKeys,
@@ -436,7 +845,7 @@ func (m *Manager) GetUsageAnalytics() *types.UsageAnalytics {
 		KeysWithUsage:       len(allUsage),
 		RecommendedStrategy: m.usageTracker.GetRecommendedStrategy(),
 		KeyAnalytics:        make(map[string]*types.KeyAnalytics),
-		StrategyMetrics:     make(map[types.SelectionStrategy]*types.StrategyMetrics),
+		StrategyMetrics:     m.usageTracker.GetStrategyMetrics(0),
 	}
 
 	var totalPlanUsage, totalPlanLimit, totalPaygoUsage, totalPaygoLimit int
@@ -453,6 +862,7 @@ func (m *Manager) GetUsageAnalytics() *types.UsageAnalytics {
 			ErrorCount:      int64(keyStats.ErrorCounts[key]),
 			LastUsed:        keyStats.LastUsed[key],
 			LastUpdated:     time.Now(),
+			Budget:          m.BudgetStatus(key),
 		}
 
 		if remaining != nil {
@@ -472,6 +882,9 @@ func (m *Manager) GetUsageAnalytics() *types.UsageAnalytics {
 		if remaining != nil {
 			totalPlanUtil += remaining.PlanUtilization
 			totalPaygoUtil += remaining.PaygoUtilization
+			if remaining.PlanResetAt != nil && (analytics.NextPlanReset == nil || remaining.PlanResetAt.Before(*analytics.NextPlanReset)) {
+				analytics.NextPlanReset = remaining.PlanResetAt
+			}
 		}
 	}
 
@@ -485,9 +898,74 @@ func (m *Manager) GetUsageAnalytics() *types.UsageAnalytics {
 		analytics.AveragePaygoUtil = totalPaygoUtil / float64(len(allUsage))
 	}
 
+	analytics.TagBreakdown = m.tagBreakdown(keyStats, analytics.KeyAnalytics)
+
+	// Soft budgets are reported for every key in scope, with or without usage data
+	for key := range keyStats.KeyStatus {
+		var status *types.KeyBudgetStatus
+		if keyAnalytics, ok := analytics.KeyAnalytics[key]; ok {
+			status = keyAnalytics.Budget
+		} else {
+			status = m.BudgetStatus(key)
+		}
+		if status == nil {
+			continue
+		}
+		for _, warning := range status.Warnings {
+			analytics.BudgetWarnings = append(analytics.BudgetWarnings, types.KeyPreview(key)+": "+warning)
+		}
+	}
+	sort.Strings(analytics.BudgetWarnings)
+
 	return analytics
 }
 
+// tagBreakdown aggregates key statistics and usage per tag
+func (m *Manager) tagBreakdown(keyStats types.KeyStats, keyAnalytics map[string]*types.KeyAnalytics) map[string]*types.TagAnalytics {
+	breakdown := make(map[string]*types.TagAnalytics)
+	if m.keyRepo == nil {
+		return breakdown
+	}
+
+	ctx, cancel := context.WithTimeout(m.ctx, 5*time.Second)
+	defer cancel()
+
+	keyTags, err := m.keyRepo.GetAllKeyTags(ctx)
+	if err != nil {
+		m.logger.WithError(err).Warn("Failed to load key tags for analytics")
+		return breakdown
+	}
+
+	for key, tags := range keyTags {
+		for _, tag := range tags {
+			tagAnalytics, ok := breakdown[tag]
+			if !ok {
+				tagAnalytics = &types.TagAnalytics{Tag: tag}
+				breakdown[tag] = tagAnalytics
+			}
+
+			tagAnalytics.Keys++
+			if status, ok := keyStats.KeyStatus[key]; ok && status.Active {
+				tagAnalytics.ActiveKeys++
+			}
+			tagAnalytics.RequestCount += int64(keyStats.RequestCounts[key])
+			tagAnalytics.ErrorCount += int64(keyStats.ErrorCounts[key])
+
+			if ka, ok := keyAnalytics[key]; ok {
+				if ka.Usage != nil {
+					tagAnalytics.PlanUsage += ka.Usage.Account.PlanUsage
+					tagAnalytics.PaygoUsage += ka.Usage.Account.PaygoUsage
+				}
+				if ka.RemainingPoints != nil {
+					tagAnalytics.TotalRemaining += ka.RemainingPoints.TotalRemaining
+				}
+			}
+		}
+	}
+
+	return breakdown
+}
+
 // Helper methods for analytics calculations
 func (m *Manager) calculateHealthScore(analytics *types.KeyAnalytics) float64 {
 	if analytics.RequestCount == 0 {
@@ -0,0 +1,103 @@
+package keymanager
+
+import (
+	"context"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// strategyOptimizer switches the active strategy to the tracker's recommendation.
+// A recommendation must be seen on several consecutive evaluations before it is
+// applied, and the active strategy is held for a minimum dwell time after a switch,
+// so the strategy does not flap when usage sits near a decision boundary.
+type strategyOptimizer struct {
+	manager       *Manager
+	interval      time.Duration
+	confirmations int
+	minDwell      time.Duration
+
+	candidate      types.SelectionStrategy
+	candidateCount int
+	lastSwitch     time.Time
+}
+
+// StartAutoStrategyOptimization runs the strategy optimization loop until ctx is cancelled.
+// It does nothing unless AUTO_STRATEGY_OPTIMIZATION is enabled.
+func (m *Manager) StartAutoStrategyOptimization(ctx context.Context) {
+	if !m.config.AutoStrategyOptimization {
+		return
+	}
+
+	optimizer := &strategyOptimizer{
+		manager:       m,
+		interval:      m.config.StrategyOptimizationInterval,
+		confirmations: m.config.StrategySwitchConfirmations,
+		minDwell:      m.config.StrategyOptimizationInterval * time.Duration(m.config.StrategySwitchConfirmations),
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"interval":      optimizer.interval,
+		"confirmations": optimizer.confirmations,
+	}).Info("Automatic strategy optimization enabled")
+
+	go optimizer.run(ctx)
+}
+
+func (o *strategyOptimizer) run(ctx context.Context) {
+	ticker := time.NewTicker(o.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			o.evaluate()
+		}
+	}
+}
+
+// evaluate checks the current recommendation and switches once it is stable
+func (o *strategyOptimizer) evaluate() {
+	current := o.manager.GetSelectionStrategy()
+	recommended := o.manager.usageTracker.GetRecommendedStrategy()
+
+	if recommended == current {
+		o.candidate = ""
+		o.candidateCount = 0
+		return
+	}
+
+	if recommended != o.candidate {
+		o.candidate = recommended
+		o.candidateCount = 0
+	}
+	o.candidateCount++
+
+	if o.candidateCount < o.confirmations {
+		o.manager.logger.WithFields(logrus.Fields{
+			"current":     current,
+			"recommended": recommended,
+			"seen":        o.candidateCount,
+			"required":    o.confirmations,
+		}).Debug("Strategy recommendation pending confirmation")
+		return
+	}
+
+	if !o.lastSwitch.IsZero() && time.Since(o.lastSwitch) < o.minDwell {
+		return
+	}
+
+	o.manager.SetSelectionStrategy(recommended)
+	o.lastSwitch = time.Now()
+	o.candidate = ""
+	o.candidateCount = 0
+
+	o.manager.logger.WithFields(logrus.Fields{
+		"from":   current,
+		"to":     recommended,
+		"reason": "auto_strategy_optimization",
+	}).Info("Selection strategy switched automatically")
+}
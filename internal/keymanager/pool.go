@@ -0,0 +1,53 @@
+package keymanager
+
+// poolKeys returns the active keys of a pool
+func (m *Manager) poolKeys(pool string) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.pools[pool]
+}
+
+// poolCursor returns the rotation cursor of a pool. The default pool keeps the
+// manager's own cursor so START_INDEX and existing rotation behave as before.
+func (m *Manager) poolCursor(pool string) *int64 {
+	if pool == m.config.DefaultKeyPool {
+		return &m.currentIndex
+	}
+	cursor, _ := m.poolCursors.LoadOrStore(pool, new(int64))
+	return cursor.(*int64)
+}
+
+// HasPool reports whether requests can be routed to a pool. Every tenant's
+// default pool always exists, even while it has no keys, so requests to it fail
+// for want of a key rather than as an unknown pool.
+func (m *Manager) HasPool(name string) bool {
+	if _, pool := SplitTenantPool(name); pool == m.config.DefaultKeyPool {
+		return true
+	}
+	return len(m.poolKeys(name)) > 0
+}
+
+// InPool reports whether key is one of the active keys of a pool
+func (m *Manager) InPool(pool, key string) bool {
+	for _, poolKey := range m.poolKeys(pool) {
+		if poolKey == key {
+			return true
+		}
+	}
+	return false
+}
+
+// GetPools returns the number of active keys in each pool
+func (m *Manager) GetPools() map[string]int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	pools := make(map[string]int, len(m.pools))
+	for pool, keys := range m.pools {
+		pools[pool] = len(keys)
+	}
+	if _, ok := pools[m.config.DefaultKeyPool]; !ok {
+		pools[m.config.DefaultKeyPool] = 0
+	}
+	return pools
+}
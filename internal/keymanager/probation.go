@@ -0,0 +1,64 @@
+package keymanager
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/pkg/types"
+)
+
+// startProbation puts a key that just came back from the blacklist on probation.
+// For the warm-up window it only receives a fraction of the traffic it would
+// otherwise get, and any failure sends it straight back to the blacklist.
+func (m *Manager) startProbation(key string) {
+	if m.config.KeyProbationWindow <= 0 {
+		return
+	}
+
+	until := time.Now().Add(m.config.KeyProbationWindow)
+	m.probationUntil.Store(key, until)
+
+	if statusInterface, ok := m.keyStatus.Load(key); ok {
+		status := statusInterface.(*types.KeyStatus)
+		status.ProbationUntil = &until
+		m.keyStatus.Store(key, status)
+	}
+}
+
+// inProbation reports whether a key is still within its warm-up window
+func (m *Manager) inProbation(key string) bool {
+	value, ok := m.probationUntil.Load(key)
+	if !ok {
+		return false
+	}
+	if time.Now().Before(value.(time.Time)) {
+		return true
+	}
+
+	m.probationUntil.Delete(key)
+	if statusInterface, ok := m.keyStatus.Load(key); ok {
+		status := statusInterface.(*types.KeyStatus)
+		status.ProbationUntil = nil
+		m.keyStatus.Store(key, status)
+	}
+	return false
+}
+
+// probationAllows reports whether a key may be offered for selection, letting
+// keys on probation through only for their share of the traffic
+func (m *Manager) probationAllows(key string) bool {
+	if !m.inProbation(key) {
+		return true
+	}
+	return rand.Float64() < m.config.KeyProbationTraffic
+}
+
+// endProbation takes a key off probation
+func (m *Manager) endProbation(key string) {
+	m.probationUntil.Delete(key)
+	if statusInterface, ok := m.keyStatus.Load(key); ok {
+		status := statusInterface.(*types.KeyStatus)
+		status.ProbationUntil = nil
+		m.keyStatus.Store(key, status)
+	}
+}
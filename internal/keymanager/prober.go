@@ -0,0 +1,131 @@
+package keymanager
+
+import (
+	"context"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/errors"
+	"github.com/dbccccccc/tavily-load/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// StartKeyHealthProber periodically checks every key against Tavily /usage until ctx is
+// cancelled, blacklisting revoked keys and reinstating recovered ones before user
+// traffic hits them. It does nothing unless KEY_HEALTH_CHECK_ENABLED is set.
+func (m *Manager) StartKeyHealthProber(ctx context.Context) {
+	if !m.config.KeyHealthCheckEnabled {
+		return
+	}
+
+	m.logger.WithField("interval", m.config.KeyHealthCheckInterval).Info("Key health prober enabled")
+
+	go func() {
+		ticker := time.NewTicker(m.config.KeyHealthCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.ProbeKeys(ctx)
+			}
+		}
+	}()
+}
+
+// ProbeKeys runs one health check over all keys
+func (m *Manager) ProbeKeys(ctx context.Context) {
+	m.mu.RLock()
+	keys := make([]string, len(m.keys))
+	copy(keys, m.keys)
+	m.mu.RUnlock()
+
+	revoked, recovered, failed := 0, 0, 0
+	for _, key := range keys {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		switch m.probeKey(key) {
+		case probeRevoked:
+			revoked++
+		case probeRecovered:
+			recovered++
+		case probeFailed:
+			failed++
+		}
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"keys":      len(keys),
+		"revoked":   revoked,
+		"recovered": recovered,
+		"failed":    failed,
+	}).Info("Key health check completed")
+}
+
+// probeResult describes what a health check changed for a key
+type probeResult int
+
+const (
+	probeUnchanged probeResult = iota
+	probeRevoked
+	probeRecovered
+	probeFailed
+)
+
+// probeKey checks a single key and updates its blacklist state
+func (m *Manager) probeKey(key string) probeResult {
+	keyPreview := types.KeyPreview(key)
+
+	entry, blacklisted := m.blacklist.Load(key)
+
+	usage, err := m.usageTracker.FetchUsageFromAPI(key)
+	if err != nil {
+		tavilyErr, ok := err.(*errors.TavilyError)
+		if !ok || !tavilyErr.IsPermanent() {
+			// Outages and rate limits say nothing about the key itself
+			m.logger.WithError(err).WithField("key", keyPreview).Debug("Key health check failed")
+			return probeFailed
+		}
+
+		if blacklisted && entry.(*types.BlacklistEntry).Permanent {
+			return probeUnchanged
+		}
+
+		if m.checkSuddenAuthFailure(key, err) {
+			return probeRevoked
+		}
+		m.logger.WithField("key", keyPreview).Warn("Key health check found a revoked key")
+		m.BlacklistKey(key, true)
+		return probeRevoked
+	}
+
+	m.updateUsage(key, usage)
+
+	if !blacklisted {
+		return probeUnchanged
+	}
+
+	// Rate limits are lifted by Tavily on its own schedule, which /usage does not reveal
+	blacklistEntry := entry.(*types.BlacklistEntry)
+	if blacklistEntry.Reason == "rate limited" && blacklistEntry.BlacklistedUntil != nil && time.Now().Before(*blacklistEntry.BlacklistedUntil) {
+		return probeUnchanged
+	}
+
+	// A valid key without credits left stays out of the rotation
+	if remaining, err := m.usageTracker.CalculateRemainingPoints(key); err == nil && remaining.TotalRemaining <= 0 {
+		return probeUnchanged
+	}
+
+	if err := m.UnblacklistKey(m.ctx, key); err != nil {
+		m.logger.WithError(err).WithField("key", keyPreview).Warn("Failed to reinstate recovered key")
+		return probeFailed
+	}
+
+	m.logger.WithField("key", keyPreview).Info("Key health check reinstated a recovered key")
+	return probeRecovered
+}
@@ -0,0 +1,205 @@
+package keymanager
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/errors"
+	"github.com/dbccccccc/tavily-load/internal/events"
+	"github.com/dbccccccc/tavily-load/pkg/types"
+)
+
+// Reasons a key is quarantined for
+const (
+	QuarantineReasonRevoked   = "suspected_revocation"
+	QuarantineReasonUsageJump = "usage_jump"
+	QuarantineReasonManual    = "manual"
+)
+
+// suddenAuthFailureWindow is how recently a key must have answered successfully
+// for an authentication failure to look like a revocation rather than a bad key
+const suddenAuthFailureWindow = 24 * time.Hour
+
+// usageBaseline is a key's usage as last fetched from Tavily
+type usageBaseline struct {
+	usage     int
+	fetchedAt time.Time
+}
+
+// loadQuarantine refreshes the quarantined keys from the database
+func (m *Manager) loadQuarantine() {
+	if m.provider != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(m.ctx, 10*time.Second)
+	defer cancel()
+
+	keys, err := m.keyRepo.GetQuarantinedKeys(ctx)
+	if err != nil {
+		m.logger.WithError(err).Warn("Failed to load quarantined keys")
+		return
+	}
+
+	stored := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		stored[key.KeyValue] = true
+		m.quarantined.Store(key.KeyValue, &types.QuarantineEntry{
+			Key:           key.KeyValue,
+			Reason:        key.Reason,
+			Details:       key.Details,
+			QuarantinedAt: key.QuarantinedAt,
+		})
+	}
+	m.quarantined.Range(func(key, _ interface{}) bool {
+		if !stored[key.(string)] {
+			m.quarantined.Delete(key)
+		}
+		return true
+	})
+}
+
+// IsQuarantined reports whether a key is held out of rotation pending review
+func (m *Manager) IsQuarantined(key string) bool {
+	_, ok := m.quarantined.Load(key)
+	return ok
+}
+
+// QuarantineKey takes a key out of rotation until an operator releases it. The
+// change is audited as made by the actor of ctx.
+func (m *Manager) QuarantineKey(ctx context.Context, key, reason, details string) {
+	entry := &types.QuarantineEntry{
+		Key:           key,
+		Reason:        reason,
+		Details:       details,
+		QuarantinedAt: time.Now(),
+	}
+	m.quarantined.Store(key, entry)
+	m.endProbation(key)
+
+	if m.keyRepo != nil {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		if err := m.keyRepo.QuarantineKey(ctx, key, reason, details); err != nil {
+			m.logger.WithError(err).Error("Failed to quarantine key in database")
+		}
+	}
+
+	m.logger.WithField("key", types.KeyPreview(key)).
+		WithField("reason", reason).
+		WithField("details", details).
+		Warn("Key quarantined pending review")
+	m.publishKeyEvent(events.KeyQuarantined, key, map[string]interface{}{
+		"reason":  reason,
+		"details": details,
+	})
+	m.checkPoolHealth()
+}
+
+// ReleaseQuarantine returns a quarantined key to rotation on probation. The
+// change is audited as made by the actor of ctx.
+func (m *Manager) ReleaseQuarantine(ctx context.Context, key string) error {
+	if m.keyRepo != nil {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+
+		if err := m.keyRepo.ReleaseQuarantine(ctx, key); err != nil {
+			return fmt.Errorf("failed to release key from quarantine in database: %w", err)
+		}
+	}
+
+	if _, wasQuarantined := m.quarantined.LoadAndDelete(key); wasQuarantined {
+		atomic.StoreInt64(m.getErrorCountPtr(key), 0)
+		m.usageBaselines.Delete(key)
+		m.startProbation(key)
+		m.publishKeyEvent(events.KeyReleased, key, map[string]interface{}{})
+		m.checkPoolHealth()
+	}
+
+	m.logger.WithField("key", types.KeyPreview(key)).Info("Key released from quarantine")
+	return nil
+}
+
+// GetQuarantine returns the quarantined keys, most recently quarantined first
+func (m *Manager) GetQuarantine() []types.QuarantineEntry {
+	var entries []types.QuarantineEntry
+	m.quarantined.Range(func(_, value interface{}) bool {
+		entries = append(entries, *value.(*types.QuarantineEntry))
+		return true
+	})
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].QuarantinedAt.After(entries[j].QuarantinedAt)
+	})
+	return entries
+}
+
+// checkSuddenAuthFailure quarantines a key that is rejected as unauthorized soon
+// after answering successfully, which suggests it was revoked or rotated outside
+// the proxy. It reports whether the key was quarantined.
+func (m *Manager) checkSuddenAuthFailure(key string, err error) bool {
+	if !m.config.QuarantineEnabled {
+		return false
+	}
+	tavilyErr, ok := err.(*errors.TavilyError)
+	if !ok || (tavilyErr.Type != errors.ErrorTypeUnauthorized && tavilyErr.Type != errors.ErrorTypeForbidden) {
+		return false
+	}
+	value, ok := m.lastSuccess.Load(key)
+	if !ok {
+		return false
+	}
+	lastSuccess := value.(time.Time)
+	if time.Since(lastSuccess) > suddenAuthFailureWindow {
+		return false
+	}
+
+	m.QuarantineKey(m.ctx, key, QuarantineReasonRevoked,
+		fmt.Sprintf("HTTP %d after a successful request at %s", tavilyErr.StatusCode, lastSuccess.UTC().Format(time.RFC3339)))
+	return true
+}
+
+// updateUsage stores usage fetched from Tavily, first quarantining the key if its
+// usage grew by far more than the credits this instance spent through it since
+// the previous fetch, which suggests someone else is using it
+func (m *Manager) updateUsage(key string, usage *types.TavilyUsage) {
+	proxied := atomic.SwapInt64(m.getProxiedCreditsPtr(key), 0)
+	previous, ok := m.usageBaselines.Swap(key, &usageBaseline{usage: usage.Key.Usage, fetchedAt: time.Now()})
+
+	threshold := m.config.Reloadable().QuarantineUsageJump
+	if ok && m.config.QuarantineEnabled && threshold > 0 && !m.IsQuarantined(key) {
+		baseline := previous.(*usageBaseline)
+		// Usage falls when the billing cycle restarts
+		if jump := int64(usage.Key.Usage-baseline.usage) - proxied; jump > int64(threshold) {
+			m.QuarantineKey(m.ctx, key, QuarantineReasonUsageJump,
+				fmt.Sprintf("usage rose by %d credits since %s while this instance spent %d",
+					usage.Key.Usage-baseline.usage, baseline.fetchedAt.UTC().Format(time.RFC3339), proxied))
+		}
+	}
+
+	m.usageTracker.UpdateUsage(key, usage)
+	m.events.Publish(events.Event{
+		Type: events.UsageUpdated,
+		Key:  key,
+		Data: map[string]interface{}{
+			"key_usage":   usage.Key.Usage,
+			"key_limit":   usage.Key.Limit,
+			"plan_usage":  usage.Account.PlanUsage,
+			"plan_limit":  usage.Account.PlanLimit,
+			"paygo_usage": usage.Account.PaygoUsage,
+			"paygo_limit": usage.Account.PaygoLimit,
+		},
+	})
+	if m.QuotaExhausted(key) {
+		m.notifyExhausted(key, "usage shows no credits left")
+	}
+}
+
+// getProxiedCreditsPtr returns the counter of credits spent through a key since
+// its usage was last fetched
+func (m *Manager) getProxiedCreditsPtr(key string) *int64 {
+	value, _ := m.proxiedCredits.LoadOrStore(key, new(int64))
+	return value.(*int64)
+}
@@ -0,0 +1,47 @@
+package keymanager
+
+import (
+	"time"
+)
+
+// QuotaExhausted reports whether the last known usage of a key shows it out of
+// credits, so a request would only be answered with 432 or 433. Keys without
+// usage data are assumed to have credits left.
+func (m *Manager) QuotaExhausted(key string) bool {
+	usage, err := m.usageTracker.GetUsage(key)
+	if err != nil || usage == nil {
+		return false
+	}
+
+	if usage.Key.Limit > 0 && usage.Key.Usage >= usage.Key.Limit {
+		return true
+	}
+	if usage.Account.PlanLimit == 0 && usage.Account.PaygoLimit == 0 {
+		return false
+	}
+	return usage.Account.PlanUsage >= usage.Account.PlanLimit && usage.Account.PaygoUsage >= usage.Account.PaygoLimit
+}
+
+// PoolQuotaExhausted reports whether every key of a pool is out of credits,
+// together with the earliest time one of their plans resets
+func (m *Manager) PoolQuotaExhausted(pool string) (bool, time.Time) {
+	keys := m.poolKeys(pool)
+	if len(keys) == 0 {
+		return false, time.Time{}
+	}
+
+	var resetAt time.Time
+	for _, key := range keys {
+		if !m.QuotaExhausted(key) {
+			return false, time.Time{}
+		}
+		remaining, err := m.usageTracker.CalculateRemainingPoints(key)
+		if err != nil || remaining.PlanResetAt == nil {
+			continue
+		}
+		if resetAt.IsZero() || remaining.PlanResetAt.Before(resetAt) {
+			resetAt = *remaining.PlanResetAt
+		}
+	}
+	return true, resetAt
+}
@@ -0,0 +1,49 @@
+package keymanager
+
+import (
+	"context"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/tracing"
+)
+
+// takeToken takes a token from the key's requests-per-minute bucket. Keys whose
+// bucket is empty are remembered locally so selection skips them until a token is
+// due, without another Redis round trip. Redis errors fail open.
+func (m *Manager) takeToken(ctx context.Context, key string) bool {
+	limit := m.config.Reloadable().KeyRPMLimit
+	if limit <= 0 {
+		return true
+	}
+	if m.rateLimited(key) {
+		return false
+	}
+
+	// The call outlives a cancelled request like the rest of selection, but is
+	// still recorded in its trace
+	ctx, cancel := context.WithTimeout(tracing.ContextWithSpan(m.ctx, tracing.FromContext(ctx)), time.Second)
+	defer cancel()
+
+	allowed, wait, err := m.usageCache.TakeKeyToken(ctx, key, limit)
+	if err != nil {
+		m.logger.WithError(err).Debug("Failed to take rate limit token, allowing request")
+		return true
+	}
+	if !allowed {
+		m.rateLimitedUntil.Store(key, time.Now().Add(wait))
+	}
+	return allowed
+}
+
+// rateLimited reports whether the key's bucket was recently found empty
+func (m *Manager) rateLimited(key string) bool {
+	value, ok := m.rateLimitedUntil.Load(key)
+	if !ok {
+		return false
+	}
+	if time.Now().Before(value.(time.Time)) {
+		return true
+	}
+	m.rateLimitedUntil.Delete(key)
+	return false
+}
@@ -0,0 +1,164 @@
+package keymanager
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/pkg/types"
+)
+
+// sharedErrorWindow is how long a key's shared error count is kept after its
+// last error
+const sharedErrorWindow = time.Hour
+
+// sharedBlacklistEnabled reports whether blacklist state is shared through Redis,
+// which an in-memory cache cannot do
+func (m *Manager) sharedBlacklistEnabled() bool {
+	return m.config.SharedBlacklistEnabled && m.usageCache.Shared()
+}
+
+// StartSharedBlacklist rereads the blacklist shared by the replicas every
+// SHARED_BLACKLIST_CACHE_TTL until ctx is cancelled, so a key another replica
+// blacklisted leaves this rotation too. It does nothing when
+// SHARED_BLACKLIST_ENABLED is off or Redis is not configured.
+func (m *Manager) StartSharedBlacklist(ctx context.Context) {
+	if !m.sharedBlacklistEnabled() {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(m.config.SharedBlacklistCacheTTL)
+		defer ticker.Stop()
+
+		for {
+			m.refreshSharedBlacklist(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// refreshSharedBlacklist adopts the shared entries of the pool's keys and releases
+// adopted entries another replica has since cleared
+func (m *Manager) refreshSharedBlacklist(ctx context.Context) {
+	m.mu.RLock()
+	keys := make([]string, len(m.keys))
+	copy(keys, m.keys)
+	m.mu.RUnlock()
+
+	readCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	entries, err := m.usageCache.GetBlacklistEntries(readCtx, keys)
+	if err != nil {
+		m.logger.WithError(err).Debug("Failed to read shared blacklist")
+		return
+	}
+
+	changed := false
+	for _, key := range keys {
+		if entry, ok := entries[key]; ok {
+			changed = m.adoptSharedEntry(entry) || changed
+			continue
+		}
+
+		value, ok := m.sharedEntries.LoadAndDelete(key)
+		if !ok {
+			continue
+		}
+		// Expired entries are released into a half-open circuit by isBlacklisted
+		if current, ok := m.blacklist.Load(key); ok && current == value && m.blacklistedNow(key) {
+			m.clearBlacklistEntry(key)
+			m.logger.WithField("key", types.KeyPreview(key)).Info("Key removed from blacklist by another replica")
+			changed = true
+		}
+	}
+
+	if changed {
+		m.checkPoolHealth()
+	}
+}
+
+// adoptSharedEntry takes a key out of rotation for a blacklist entry stored by
+// another replica, unless this replica already holds it out at least as long.
+// Nothing is published since the replica that stored the entry already did.
+func (m *Manager) adoptSharedEntry(entry *types.BlacklistEntry) bool {
+	if !entry.Permanent && (entry.BlacklistedUntil == nil || !time.Now().Before(*entry.BlacklistedUntil)) {
+		return false
+	}
+	if value, ok := m.blacklist.Load(entry.Key); ok && m.blacklistedNow(entry.Key) {
+		current := value.(*types.BlacklistEntry)
+		if current.Permanent || current.BlacklistedUntil == nil ||
+			(!entry.Permanent && !current.BlacklistedUntil.Before(*entry.BlacklistedUntil)) {
+			return false
+		}
+	}
+
+	m.storeBlacklistEntry(entry)
+	m.sharedEntries.Store(entry.Key, entry)
+
+	// Continue the backoff where the other replica left it
+	backoff := m.getBackoff(entry.Key)
+	if strikes := int64(entry.Strikes); strikes > atomic.LoadInt64(&backoff.strikes) {
+		atomic.StoreInt64(&backoff.strikes, strikes)
+	}
+
+	m.logger.WithField("key", types.KeyPreview(entry.Key)).
+		WithField("permanent", entry.Permanent).
+		Info("Key blacklisted by another replica")
+	return true
+}
+
+// shareBlacklistEntry stores a blacklist entry in Redis for the other replicas
+// and starts the key's shared error count afresh
+func (m *Manager) shareBlacklistEntry(ctx context.Context, entry *types.BlacklistEntry) {
+	m.sharedEntries.Delete(entry.Key)
+	if !m.sharedBlacklistEnabled() {
+		return
+	}
+
+	if err := m.usageCache.SetBlacklistEntry(ctx, entry); err != nil {
+		m.logger.WithError(err).Warn("Failed to share blacklist entry")
+	}
+	if err := m.usageCache.DeleteKeyErrors(ctx, entry.Key); err != nil {
+		m.logger.WithError(err).Debug("Failed to reset shared error count")
+	}
+}
+
+// clearSharedBlacklist removes the shared blacklist entries and error counts of keys
+func (m *Manager) clearSharedBlacklist(keys ...string) {
+	for _, key := range keys {
+		m.sharedEntries.Delete(key)
+	}
+	if !m.sharedBlacklistEnabled() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(m.ctx, 5*time.Second)
+	defer cancel()
+	if err := m.usageCache.DeleteBlacklistEntries(ctx, keys...); err != nil {
+		m.logger.WithError(err).Warn("Failed to clear shared blacklist")
+	}
+}
+
+// sharedErrorCount adds an error of a key to the count shared by the replicas and
+// returns the larger of that count and the local one, so replicas failing on the
+// same key reach BLACKLIST_THRESHOLD together
+func (m *Manager) sharedErrorCount(key string, local int64) int64 {
+	if !m.sharedBlacklistEnabled() {
+		return local
+	}
+
+	ctx, cancel := context.WithTimeout(m.ctx, time.Second)
+	defer cancel()
+	shared, err := m.usageCache.AddKeyError(ctx, key, sharedErrorWindow)
+	if err != nil {
+		m.logger.WithError(err).Debug("Failed to count shared key error")
+		return local
+	}
+	return max(local, shared)
+}
@@ -0,0 +1,100 @@
+package keymanager
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/keyprovider"
+	"github.com/sirupsen/logrus"
+)
+
+// keySourceName names where keys are loaded from, for logs
+func (m *Manager) keySourceName() string {
+	if m.provider != nil {
+		return m.provider.Name()
+	}
+	return "database"
+}
+
+// StartKeySourceRefresh periodically reloads keys from an external key provider until
+// ctx is cancelled, so secret rotations reach the pool without a restart. Providers
+// that can watch their keys, such as KEYS_FILE, are also reloaded as soon as they
+// change. It does nothing when keys are stored in the database or given in
+// TAVILY_API_KEYS, which cannot change while the process runs.
+func (m *Manager) StartKeySourceRefresh(ctx context.Context) {
+	if m.provider == nil || m.provider.Name() == keyprovider.SourceEnv {
+		return
+	}
+
+	// changes stays nil, and never fires, unless the provider is watched
+	var changes <-chan struct{}
+	if watcher, ok := m.provider.(keyprovider.Watcher); ok {
+		var err error
+		if changes, err = watcher.Watch(ctx); err != nil {
+			m.logger.WithError(err).Warn("Failed to watch key source, relying on periodic refresh")
+		}
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"source":   m.provider.Name(),
+		"interval": m.config.KeySourceRefreshInterval,
+		"watching": changes != nil,
+	}).Info("Key source refresh enabled")
+
+	go func() {
+		ticker := time.NewTicker(m.config.KeySourceRefreshInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.refreshKeySource()
+			case <-changes:
+				m.refreshKeySource()
+			}
+		}
+	}()
+}
+
+// refreshKeySource reloads the pool when the provider's key set has changed
+func (m *Manager) refreshKeySource() {
+	keys, pools, err := m.fetchActiveKeys()
+	if err != nil {
+		// Keep serving the last known keys while the source is unreachable
+		m.logger.WithError(err).Warn("Failed to refresh keys from key source")
+		return
+	}
+
+	m.mu.RLock()
+	unchanged := sameKeys(m.keys, keys)
+	m.mu.RUnlock()
+	if unchanged {
+		return
+	}
+
+	m.applyKeys(keys, pools)
+	m.logger.WithFields(logrus.Fields{
+		"source": m.provider.Name(),
+		"keys":   len(keys),
+	}).Info("Key source changed, rotation pool refreshed")
+}
+
+// sameKeys reports whether two key lists contain the same keys in any order
+func sameKeys(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sortedA := append([]string(nil), a...)
+	sortedB := append([]string(nil), b...)
+	sort.Strings(sortedA)
+	sort.Strings(sortedB)
+	for i := range sortedA {
+		if sortedA[i] != sortedB[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,157 @@
+package keymanager
+
+import (
+	"context"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/cache"
+	"github.com/dbccccccc/tavily-load/internal/events"
+	"github.com/dbccccccc/tavily-load/internal/repository"
+	"github.com/dbccccccc/tavily-load/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// Reasons a key leaves the blacklist, as published on key.unblacklisted
+const (
+	unblacklistReasonReinstated = "reinstated"
+	unblacklistReasonExpired    = "blacklist expired"
+)
+
+// keySyncRetryInterval is how long to wait before subscribing again after the
+// subscription failed
+const keySyncRetryInterval = 5 * time.Second
+
+// StartKeySync announces this instance's key changes to the other replicas over
+// Redis pub/sub and applies theirs until ctx is cancelled, so every replica serves
+// the same pool without waiting for a restart. It does nothing when
+// KEY_SYNC_ENABLED is off, Redis is not configured or keys come from an external
+// provider.
+func (m *Manager) StartKeySync(ctx context.Context) {
+	if !m.config.KeySyncEnabled || !m.usageCache.Shared() || m.provider != nil {
+		return
+	}
+
+	m.events.Subscribe(m.announceKeyEvent, events.KeyBlacklisted, events.KeyUnblacklisted, events.KeyQuarantined, events.KeyReleased)
+	m.logger.WithField("instance", m.instanceID).Info("Key sync across replicas enabled")
+
+	go func() {
+		for {
+			err := m.usageCache.SubscribeKeyChanges(ctx, m.applyKeyChange)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				m.logger.WithError(err).Warn("Key sync subscription failed, retrying")
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(keySyncRetryInterval):
+			}
+		}
+	}()
+}
+
+// KeysChanged reloads the pool after keys were added, updated or deleted and
+// tells the other replicas to do the same
+func (m *Manager) KeysChanged() error {
+	if err := m.ReloadKeys(); err != nil {
+		return err
+	}
+	m.announceKeyChange(&cache.KeyChange{Action: cache.KeyChangeReload})
+	return nil
+}
+
+// announceKeyEvent announces a blacklist or quarantine change published on the bus.
+// Expired blacklists are not announced since every replica expires them itself.
+func (m *Manager) announceKeyEvent(event events.Event) {
+	change := &cache.KeyChange{KeyHash: repository.HashKey(event.Key)}
+	switch event.Type {
+	case events.KeyBlacklisted:
+		change.Action = cache.KeyChangeBlacklist
+		change.Reason, _ = event.Data["reason"].(string)
+		change.Permanent, _ = event.Data["permanent"].(bool)
+		change.Until, _ = event.Data["blacklisted_until"].(*time.Time)
+	case events.KeyUnblacklisted:
+		if event.Data["reason"] == unblacklistReasonExpired {
+			return
+		}
+		change.Action = cache.KeyChangeUnblacklist
+	default:
+		// Quarantine is stored in the database, which a reload reads again
+		change.Action = cache.KeyChangeReload
+		change.KeyHash = ""
+	}
+	m.announceKeyChange(change)
+}
+
+// announceKeyChange publishes a key change without holding up the caller
+func (m *Manager) announceKeyChange(change *cache.KeyChange) {
+	if !m.config.KeySyncEnabled || !m.usageCache.Shared() || m.provider != nil {
+		return
+	}
+	change.Instance = m.instanceID
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		if err := m.usageCache.PublishKeyChange(ctx, change); err != nil {
+			m.logger.WithError(err).WithField("action", change.Action).Warn("Failed to announce key change to replicas")
+		}
+	}()
+}
+
+// applyKeyChange applies a key change announced by another replica. The change is
+// already stored, so only this instance's memory is updated and nothing is
+// published again.
+func (m *Manager) applyKeyChange(change *cache.KeyChange) {
+	if change.Instance == m.instanceID {
+		return
+	}
+	entry := m.logger.WithFields(logrus.Fields{
+		"instance": change.Instance,
+		"action":   change.Action,
+	})
+
+	switch change.Action {
+	case cache.KeyChangeReload:
+		if err := m.ReloadKeys(); err != nil {
+			entry.WithError(err).Warn("Failed to reload keys changed by another replica")
+		}
+	case cache.KeyChangeBlacklist:
+		key, ok := m.keyByHash(change.KeyHash)
+		if !ok {
+			return
+		}
+		m.storeBlacklistEntry(&types.BlacklistEntry{
+			Key:              key,
+			Reason:           change.Reason,
+			BlacklistedAt:    time.Now(),
+			BlacklistedUntil: change.Until,
+			Permanent:        change.Permanent,
+		})
+		entry.WithField("key", types.KeyPreview(key)).Info("Key blacklisted by another replica")
+	case cache.KeyChangeUnblacklist:
+		// A key that was blacklisted when the pool was last loaded is not in it yet
+		if err := m.ReloadKeys(); err != nil {
+			entry.WithError(err).Warn("Failed to reload keys changed by another replica")
+		}
+		if key, ok := m.keyByHash(change.KeyHash); ok {
+			m.clearBlacklistEntry(key)
+			entry.WithField("key", types.KeyPreview(key)).Info("Key removed from blacklist by another replica")
+		}
+	}
+}
+
+// keyByHash finds a key of the pool by its hash
+func (m *Manager) keyByHash(hash string) (string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, key := range m.keys {
+		if repository.HashKey(key) == hash {
+			return key, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,110 @@
+package keymanager
+
+import (
+	"strings"
+
+	"github.com/dbccccccc/tavily-load/internal/repository"
+	"github.com/dbccccccc/tavily-load/pkg/types"
+)
+
+// TenantPool returns the name a tenant's pool is routed by in multi-tenant mode.
+// The default tenant keeps plain pool names, so existing pools and
+// X-Tavily-Pool values are unchanged; pool names cannot contain a slash.
+func TenantPool(tenant, pool string) string {
+	if tenant == "" || tenant == repository.DefaultTenant {
+		return pool
+	}
+	return tenant + "/" + pool
+}
+
+// SplitTenantPool reverses TenantPool, returning the tenant and pool of a pool name
+func SplitTenantPool(name string) (string, string) {
+	if tenant, pool, ok := strings.Cut(name, "/"); ok {
+		return tenant, pool
+	}
+	return repository.DefaultTenant, name
+}
+
+// TenantKeys returns the active keys of a tenant
+func (m *Manager) TenantKeys(tenant string) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var keys []string
+	for pool, poolKeys := range m.pools {
+		if poolTenant, _ := SplitTenantPool(pool); poolTenant == tenant {
+			keys = append(keys, poolKeys...)
+		}
+	}
+	return keys
+}
+
+// tenantKeySet returns the active keys of a tenant as a set
+func (m *Manager) tenantKeySet(tenant string) map[string]bool {
+	keys := m.TenantKeys(tenant)
+	set := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		set[key] = true
+	}
+	return set
+}
+
+// GetTenantPools returns the number of active keys in each of a tenant's pools,
+// by the pool names the tenant uses
+func (m *Manager) GetTenantPools(tenant string) map[string]int {
+	pools := make(map[string]int)
+	for name, count := range m.GetPools() {
+		if poolTenant, pool := SplitTenantPool(name); poolTenant == tenant {
+			pools[pool] = count
+		}
+	}
+	if _, ok := pools[m.config.DefaultKeyPool]; !ok {
+		pools[m.config.DefaultKeyPool] = 0
+	}
+	return pools
+}
+
+// GetTenantStats returns the statistics of a tenant's keys
+func (m *Manager) GetTenantStats(tenant string) types.KeyStats {
+	return m.statsForKeys(m.TenantKeys(tenant), m.poolCursor(TenantPool(tenant, m.config.DefaultKeyPool)))
+}
+
+// GetTenantBlacklist returns the blacklisted keys of a tenant
+func (m *Manager) GetTenantBlacklist(tenant string) []types.BlacklistEntry {
+	keys := m.tenantKeySet(tenant)
+	var entries []types.BlacklistEntry
+	for _, entry := range m.GetBlacklist() {
+		if keys[entry.Key] {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// GetTenantUsageAnalytics returns usage analytics covering only a tenant's keys
+func (m *Manager) GetTenantUsageAnalytics(tenant string) *types.UsageAnalytics {
+	keys := m.tenantKeySet(tenant)
+	usage := make(map[string]*types.TavilyUsage)
+	for key, keyUsage := range m.usageTracker.GetAllUsage() {
+		if keys[key] {
+			usage[key] = keyUsage
+		}
+	}
+	return m.usageAnalytics(m.GetTenantStats(tenant), usage)
+}
+
+// ResetTenantKeys clears the blacklist entries and statistics of a tenant's keys,
+// leaving other tenants untouched
+func (m *Manager) ResetTenantKeys(tenant string) {
+	keys := m.TenantKeys(tenant)
+	m.clearSharedBlacklist(keys...)
+	for _, key := range keys {
+		m.blacklist.Delete(key)
+		m.backoffs.Delete(key)
+		m.breakers.Delete(key)
+		m.probationUntil.Delete(key)
+		m.resetKeyStatus(key)
+	}
+
+	m.logger.WithField("tenant", tenant).Info("Tenant keys reset and blacklist cleared")
+}
@@ -0,0 +1,142 @@
+package keyprovider
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/config"
+)
+
+// AWSProvider reads keys from an AWS Secrets Manager secret using the
+// GetSecretValue API, signed with static credentials. The default credential
+// chain (ECS task roles, instance profiles, profiles) is not consulted.
+type AWSProvider struct {
+	region          string
+	secretID        string
+	field           string
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+	endpoint        string
+	httpClient      *http.Client
+}
+
+// NewAWSProvider creates a provider for the secret AWS_SECRET_ID in AWS_REGION
+func NewAWSProvider(cfg *config.Config) *AWSProvider {
+	return &AWSProvider{
+		region:          cfg.AWSRegion,
+		secretID:        cfg.AWSSecretID,
+		field:           cfg.AWSSecretKeysField,
+		accessKeyID:     cfg.AWSAccessKeyID,
+		secretAccessKey: cfg.AWSSecretAccessKey,
+		sessionToken:    cfg.AWSSessionToken,
+		endpoint:        fmt.Sprintf("https://secretsmanager.%s.amazonaws.com/", cfg.AWSRegion),
+		httpClient:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Name identifies the provider in logs
+func (p *AWSProvider) Name() string {
+	return SourceAWS
+}
+
+// FetchKeys reads the current version of the secret
+func (p *AWSProvider) FetchKeys(ctx context.Context) ([]string, error) {
+	payload, err := json.Marshal(map[string]string{"SecretId": p.secretID})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	p.sign(req, payload, time.Now().UTC())
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read AWS secret: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read AWS response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("aws secrets manager returned status %d for %s", resp.StatusCode, p.secretID)
+	}
+
+	var secret struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return nil, fmt.Errorf("failed to decode AWS response: %w", err)
+	}
+	if secret.SecretString == "" {
+		return nil, fmt.Errorf("aws secret %s has no string value", p.secretID)
+	}
+
+	return parseSecretKeys(secret.SecretString, p.field)
+}
+
+// sign adds AWS Signature Version 4 headers to the request
+func (p *AWSProvider) sign(req *http.Request, payload []byte, now time.Time) {
+	const service = "secretsmanager"
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if p.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", p.sessionToken)
+	}
+
+	// Canonical headers must be sorted by name
+	signedHeaders := "content-type;host;x-amz-date"
+	canonicalHeaders := "content-type:" + req.Header.Get("Content-Type") + "\n" +
+		"host:" + req.URL.Host + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	if p.sessionToken != "" {
+		signedHeaders += ";x-amz-security-token"
+		canonicalHeaders += "x-amz-security-token:" + p.sessionToken + "\n"
+	}
+	signedHeaders += ";x-amz-target"
+	canonicalHeaders += "x-amz-target:" + req.Header.Get("X-Amz-Target") + "\n"
+
+	canonicalRequest := req.Method + "\n/\n\n" + canonicalHeaders + "\n" + signedHeaders + "\n" + sha256Hex(payload)
+	scope := date + "/" + p.region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	signingKey := hmacSHA256([]byte("AWS4"+p.secretAccessKey), date)
+	signingKey = hmacSHA256(signingKey, p.region)
+	signingKey = hmacSHA256(signingKey, service)
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		p.accessKeyID, scope, signedHeaders, signature,
+	))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,29 @@
+package keyprovider
+
+import (
+	"context"
+	"strings"
+
+	"github.com/dbccccccc/tavily-load/internal/config"
+)
+
+// EnvProvider supplies the keys listed in TAVILY_API_KEYS, for container
+// platforms where mounting a keys file or running MySQL is awkward
+type EnvProvider struct {
+	keys []string
+}
+
+// NewEnvProvider creates a provider for the keys in TAVILY_API_KEYS
+func NewEnvProvider(cfg *config.Config) *EnvProvider {
+	return &EnvProvider{keys: cfg.TavilyAPIKeys}
+}
+
+// Name identifies the provider in logs
+func (p *EnvProvider) Name() string {
+	return SourceEnv
+}
+
+// FetchKeys returns the keys from TAVILY_API_KEYS
+func (p *EnvProvider) FetchKeys(ctx context.Context) ([]string, error) {
+	return parseKeyList(strings.Join(p.keys, "\n"))
+}
@@ -0,0 +1,91 @@
+package keyprovider
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/config"
+	"github.com/fsnotify/fsnotify"
+)
+
+// fileSettleDelay lets a burst of writes to the keys file finish before it is
+// read again, so a half-written file is not loaded
+const fileSettleDelay = 250 * time.Millisecond
+
+// FileProvider reads keys from KEYS_FILE, one key per line. Blank lines and #
+// comments are skipped.
+type FileProvider struct {
+	path string
+}
+
+var _ Watcher = (*FileProvider)(nil)
+
+// NewFileProvider creates a provider for the keys file at KEYS_FILE
+func NewFileProvider(cfg *config.Config) *FileProvider {
+	return &FileProvider{path: cfg.KeysFile}
+}
+
+// Name identifies the provider in logs
+func (p *FileProvider) Name() string {
+	return SourceFile
+}
+
+// FetchKeys reads the keys file
+func (p *FileProvider) FetchKeys(ctx context.Context) ([]string, error) {
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keys file: %w", err)
+	}
+	return parseKeyList(string(data))
+}
+
+// Watch signals changes to the keys file. The directory is watched rather than
+// the file, so editors that replace the file and Kubernetes, which swaps a
+// symlink to update mounted secrets, are noticed too; every change in the
+// directory is signalled and the key manager ignores those that leave the key
+// set unchanged.
+func (p *FileProvider) Watch(ctx context.Context) (<-chan struct{}, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch keys file: %w", err)
+	}
+	if err := watcher.Add(filepath.Dir(p.path)); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("failed to watch keys file: %w", err)
+	}
+
+	changes := make(chan struct{}, 1)
+	go func() {
+		defer watcher.Close()
+
+		settle := time.NewTimer(fileSettleDelay)
+		settle.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				settle.Stop()
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op != fsnotify.Chmod {
+					settle.Reset(fileSettleDelay)
+				}
+			case _, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+			case <-settle.C:
+				select {
+				case changes <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return changes, nil
+}
@@ -0,0 +1,117 @@
+package keyprovider
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/config"
+)
+
+// gcpMetadataTokenURL serves access tokens for the instance's service account
+const gcpMetadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+// GCPProvider reads keys from a GCP Secret Manager secret version. It authenticates
+// with GCP_ACCESS_TOKEN when set, otherwise with the metadata server's service account.
+type GCPProvider struct {
+	project     string
+	secret      string
+	version     string
+	field       string
+	accessToken string
+	httpClient  *http.Client
+}
+
+// NewGCPProvider creates a provider for GCP_SECRET_NAME in GCP_PROJECT_ID
+func NewGCPProvider(cfg *config.Config) *GCPProvider {
+	return &GCPProvider{
+		project:     cfg.GCPProjectID,
+		secret:      cfg.GCPSecretName,
+		version:     cfg.GCPSecretVersion,
+		field:       cfg.GCPSecretKeysField,
+		accessToken: cfg.GCPAccessToken,
+		httpClient:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Name identifies the provider in logs
+func (p *GCPProvider) Name() string {
+	return SourceGCP
+}
+
+// FetchKeys reads the configured secret version
+func (p *GCPProvider) FetchKeys(ctx context.Context) ([]string, error) {
+	token, err := p.token(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("https://secretmanager.googleapis.com/v1/projects/%s/secrets/%s/versions/%s:access",
+		p.project, p.secret, p.version)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	var secret struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := p.getJSON(req, &secret); err != nil {
+		return nil, fmt.Errorf("failed to read GCP secret %s: %w", p.secret, err)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(secret.Payload.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode GCP secret payload: %w", err)
+	}
+
+	return parseSecretKeys(string(data), p.field)
+}
+
+// token returns the static access token or fetches one from the metadata server
+func (p *GCPProvider) token(ctx context.Context) (string, error) {
+	if p.accessToken != "" {
+		return p.accessToken, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gcpMetadataTokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := p.getJSON(req, &token); err != nil {
+		return "", fmt.Errorf("failed to get GCP access token from metadata server: %w", err)
+	}
+	return token.AccessToken, nil
+}
+
+// getJSON performs the request and decodes a successful JSON response
+func (p *GCPProvider) getJSON(req *http.Request, dest interface{}) error {
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	return json.Unmarshal(body, dest)
+}
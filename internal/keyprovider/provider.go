@@ -0,0 +1,124 @@
+package keyprovider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/dbccccccc/tavily-load/internal/config"
+	"github.com/dbccccccc/tavily-load/pkg/types"
+)
+
+// Key sources selectable with KEY_SOURCE
+const (
+	SourceDatabase = "database"
+	SourceVault    = "vault"
+	SourceAWS      = "aws"
+	SourceGCP      = "gcp"
+	SourceFile     = "file"
+	SourceEnv      = "env"
+)
+
+// Provider supplies the API keys the key manager rotates through from a store
+// other than the database
+type Provider interface {
+	// Name identifies the provider in logs
+	Name() string
+	// FetchKeys returns the current key values
+	FetchKeys(ctx context.Context) ([]string, error)
+}
+
+// Watcher is implemented by providers that can tell when their keys change, so
+// the key manager reloads them at once rather than at the next refresh
+type Watcher interface {
+	// Watch returns a channel that receives a value after the keys may have
+	// changed, until ctx is cancelled
+	Watch(ctx context.Context) (<-chan struct{}, error)
+}
+
+// New creates the provider selected by KEY_SOURCE. It returns nil for the
+// database source, which the key manager reads directly.
+func New(cfg *config.Config) (Provider, error) {
+	switch cfg.KeySource {
+	case "", SourceDatabase:
+		return nil, nil
+	case SourceVault:
+		return NewVaultProvider(cfg), nil
+	case SourceAWS:
+		return NewAWSProvider(cfg), nil
+	case SourceGCP:
+		return NewGCPProvider(cfg), nil
+	case SourceFile:
+		return NewFileProvider(cfg), nil
+	case SourceEnv:
+		return NewEnvProvider(cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown key source: %s", cfg.KeySource)
+	}
+}
+
+// parseSecretKeys reads keys from a secret string. When field is set the secret
+// is a JSON object and the keys are read from that field.
+func parseSecretKeys(secret, field string) ([]string, error) {
+	if field == "" {
+		return parseKeyList(secret)
+	}
+
+	var object map[string]interface{}
+	if err := json.Unmarshal([]byte(secret), &object); err != nil {
+		return nil, fmt.Errorf("secret is not a JSON object: %w", err)
+	}
+
+	value, ok := object[field]
+	if !ok {
+		return nil, fmt.Errorf("secret has no %q field", field)
+	}
+	return parseKeyList(value)
+}
+
+// parseKeyList reads keys from a secret value that is either a JSON array or
+// text with one key per line or comma. Blank entries and # comments are skipped;
+// any other entry that is not a well-formed Tavily key fails the whole list.
+func parseKeyList(value interface{}) ([]string, error) {
+	var entries []string
+
+	switch v := value.(type) {
+	case string:
+		trimmed := strings.TrimSpace(v)
+		if strings.HasPrefix(trimmed, "[") {
+			if err := json.Unmarshal([]byte(trimmed), &entries); err != nil {
+				return nil, fmt.Errorf("invalid key list: %w", err)
+			}
+			break
+		}
+		entries = strings.FieldsFunc(v, func(r rune) bool {
+			return r == '\n' || r == '\r' || r == ','
+		})
+	case []interface{}:
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid key list: expected strings, got %T", item)
+			}
+			entries = append(entries, s)
+		}
+	default:
+		return nil, fmt.Errorf("invalid key list: unsupported type %T", value)
+	}
+
+	seen := make(map[string]bool, len(entries))
+	keys := make([]string, 0, len(entries))
+	for i, entry := range entries {
+		key := strings.TrimSpace(entry)
+		if key == "" || strings.HasPrefix(key, "#") || seen[key] {
+			continue
+		}
+		if err := types.ValidateKey(key); err != nil {
+			return nil, fmt.Errorf("invalid key list: entry %d: %w", i+1, err)
+		}
+		seen[key] = true
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
@@ -0,0 +1,89 @@
+package keyprovider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/config"
+)
+
+// VaultProvider reads keys from a HashiCorp Vault KV version 2 secret
+type VaultProvider struct {
+	addr       string
+	token      string
+	namespace  string
+	mount      string
+	path       string
+	field      string
+	httpClient *http.Client
+}
+
+// NewVaultProvider creates a provider for the secret at VAULT_KV_MOUNT/VAULT_KV_PATH
+func NewVaultProvider(cfg *config.Config) *VaultProvider {
+	return &VaultProvider{
+		addr:       strings.TrimRight(cfg.VaultAddr, "/"),
+		token:      cfg.VaultToken,
+		namespace:  cfg.VaultNamespace,
+		mount:      strings.Trim(cfg.VaultKVMount, "/"),
+		path:       strings.Trim(cfg.VaultKVPath, "/"),
+		field:      cfg.VaultKeysField,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Name identifies the provider in logs
+func (p *VaultProvider) Name() string {
+	return SourceVault
+}
+
+// vaultKVResponse is the subset of a KV v2 read response the provider uses
+type vaultKVResponse struct {
+	Data struct {
+		Data map[string]interface{} `json:"data"`
+	} `json:"data"`
+}
+
+// FetchKeys reads the latest version of the secret and returns the keys in its keys field
+func (p *VaultProvider) FetchKeys(ctx context.Context) ([]string, error) {
+	url := fmt.Sprintf("%s/v1/%s/data/%s", p.addr, p.mount, p.path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", p.token)
+	if p.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.namespace)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Vault secret: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Vault response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault returned status %d for %s/%s", resp.StatusCode, p.mount, p.path)
+	}
+
+	var secret vaultKVResponse
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return nil, fmt.Errorf("failed to decode Vault response: %w", err)
+	}
+
+	value, ok := secret.Data.Data[p.field]
+	if !ok {
+		return nil, fmt.Errorf("vault secret %s/%s has no %q field", p.mount, p.path, p.field)
+	}
+
+	return parseKeyList(value)
+}
@@ -0,0 +1,105 @@
+// Package logging lets log levels be changed while the server runs, for the whole
+// process or for single components, so debug logging can be switched on while an
+// incident is reproduced and off again without a restart.
+package logging
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Levels hands out per-component loggers derived from the root logger and
+// tracks which of them have their own level
+type Levels struct {
+	root *logrus.Logger
+
+	mu         sync.Mutex
+	components map[string]*logrus.Logger
+	overridden map[string]bool
+}
+
+// NewLevels creates a level registry for a root logger
+func NewLevels(root *logrus.Logger) *Levels {
+	return &Levels{
+		root:       root,
+		components: make(map[string]*logrus.Logger),
+		overridden: make(map[string]bool),
+	}
+}
+
+// Logger returns the logger of a component. It writes to the same output with the
+// same formatter and hooks as the root logger, and follows the root level until
+// the component is given a level of its own.
+func (l *Levels) Logger(component string) *logrus.Logger {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if logger, ok := l.components[component]; ok {
+		return logger
+	}
+	logger := &logrus.Logger{
+		Out:          l.root.Out,
+		Hooks:        l.root.Hooks,
+		Formatter:    l.root.Formatter,
+		ReportCaller: l.root.ReportCaller,
+		Level:        l.root.GetLevel(),
+		ExitFunc:     l.root.ExitFunc,
+	}
+	l.components[component] = logger
+	return logger
+}
+
+// SetLevel changes the root level and that of every component without its own level
+func (l *Levels) SetLevel(level logrus.Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.root.SetLevel(level)
+	for name, logger := range l.components {
+		if !l.overridden[name] {
+			logger.SetLevel(level)
+		}
+	}
+}
+
+// SetComponentLevel gives a component its own level
+func (l *Levels) SetComponentLevel(component string, level logrus.Level) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	logger, ok := l.components[component]
+	if !ok {
+		return fmt.Errorf("unknown log component: %s", component)
+	}
+	logger.SetLevel(level)
+	l.overridden[component] = true
+	return nil
+}
+
+// ResetComponentLevel makes a component follow the root level again
+func (l *Levels) ResetComponentLevel(component string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	logger, ok := l.components[component]
+	if !ok {
+		return fmt.Errorf("unknown log component: %s", component)
+	}
+	logger.SetLevel(l.root.GetLevel())
+	delete(l.overridden, component)
+	return nil
+}
+
+// Snapshot returns the root level and the level of each component
+func (l *Levels) Snapshot() (string, map[string]string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	components := make(map[string]string, len(l.components))
+	for name, logger := range l.components {
+		components[name] = logger.GetLevel().String()
+	}
+	return l.root.GetLevel().String(), components
+}
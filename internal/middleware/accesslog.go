@@ -0,0 +1,198 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/pkg/types"
+)
+
+// accessLogEntry holds the fields emitted for a single proxied request
+type accessLogEntry struct {
+	Time              time.Time `json:"time"`
+	RequestID         string    `json:"request_id"`
+	TraceID           string    `json:"trace_id,omitempty"`
+	ClientIP          string    `json:"client_ip"`
+	Method            string    `json:"method"`
+	Path              string    `json:"path"`
+	Protocol          string    `json:"protocol"`
+	Status            int       `json:"status"`
+	BytesSent         int64     `json:"bytes_sent"`
+	DurationMs        float64   `json:"duration_ms"`
+	UpstreamLatencyMs float64   `json:"upstream_latency_ms"`
+	UpstreamStatus    int       `json:"upstream_status,omitempty"`
+	KeyHash           string    `json:"key_hash,omitempty"`
+	KeyPreview        string    `json:"key_preview,omitempty"`
+	RetryCount        int       `json:"retry_count"`
+	CacheStatus       string    `json:"cache_status,omitempty"`
+	Referer           string    `json:"referer,omitempty"`
+	UserAgent         string    `json:"user_agent,omitempty"`
+}
+
+// newAccessLogEntry builds an access log entry from the finished request
+func newAccessLogEntry(r *http.Request, rw *responseWriter, requestID string, start time.Time, duration time.Duration) *accessLogEntry {
+	entry := &accessLogEntry{
+		Time:       start,
+		RequestID:  requestID,
+		ClientIP:   getClientIP(r),
+		Method:     r.Method,
+		Path:       r.URL.RequestURI(),
+		Protocol:   r.Proto,
+		Status:     rw.statusCode,
+		BytesSent:  rw.bytesWritten,
+		DurationMs: float64(duration.Microseconds()) / 1000.0,
+		Referer:    r.Referer(),
+		UserAgent:  r.UserAgent(),
+	}
+
+	if reqCtx, ok := r.Context().Value(RequestContextKey{}).(*types.RequestContext); ok {
+		entry.UpstreamLatencyMs = float64(reqCtx.UpstreamLatency.Microseconds()) / 1000.0
+		entry.UpstreamStatus = reqCtx.UpstreamStatus
+		entry.KeyHash = keyIDHash(reqCtx.Key)
+		if len(reqCtx.Key) > 12 {
+			entry.KeyPreview = types.KeyPreview(reqCtx.Key)
+		}
+		entry.RetryCount = reqCtx.RetryCount
+		entry.CacheStatus = reqCtx.CacheStatus
+		entry.TraceID = reqCtx.TraceID
+	}
+
+	return entry
+}
+
+// accessLogWriter serializes access log lines onto a single writer
+type accessLogWriter struct {
+	out io.Writer
+	mu  sync.Mutex
+}
+
+func newAccessLogWriter(out io.Writer) *accessLogWriter {
+	return &accessLogWriter{out: out}
+}
+
+// openAccessLogFile opens ACCESS_LOG_FILE for appending, creating it and its directory
+func openAccessLogFile(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+}
+
+// write formats the entry in the requested format and writes it as one line
+func (w *accessLogWriter) write(format string, entry *accessLogEntry) {
+	var line string
+	switch format {
+	case "json":
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return
+		}
+		line = string(data)
+	case "combined":
+		line = formatCombined(entry)
+	case "logfmt":
+		line = formatLogfmt(entry)
+	default:
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	fmt.Fprintln(w.out, line)
+}
+
+// formatCombined renders the Apache combined log format followed by proxy-specific fields
+func formatCombined(e *accessLogEntry) string {
+	bytesSent := "-"
+	if e.BytesSent > 0 {
+		bytesSent = strconv.FormatInt(e.BytesSent, 10)
+	}
+	upstreamStatus := "-"
+	if e.UpstreamStatus > 0 {
+		upstreamStatus = strconv.Itoa(e.UpstreamStatus)
+	}
+
+	return fmt.Sprintf(`%s - - [%s] "%s %s %s" %d %s "%s" "%s" rid=%s trace=%s upstream_ms=%.3f upstream_status=%s key=%s key_preview=%s retries=%d cache=%s`,
+		e.ClientIP,
+		e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		e.Method, e.Path, e.Protocol,
+		e.Status,
+		bytesSent,
+		dashIfEmpty(e.Referer),
+		dashIfEmpty(e.UserAgent),
+		dashIfEmpty(e.RequestID),
+		dashIfEmpty(e.TraceID),
+		e.UpstreamLatencyMs,
+		upstreamStatus,
+		dashIfEmpty(e.KeyHash),
+		dashIfEmpty(e.KeyPreview),
+		e.RetryCount,
+		dashIfEmpty(e.CacheStatus),
+	)
+}
+
+// formatLogfmt renders the entry as logfmt key=value pairs
+func formatLogfmt(e *accessLogEntry) string {
+	fields := [][2]string{
+		{"time", e.Time.Format(time.RFC3339Nano)},
+		{"request_id", e.RequestID},
+		{"trace_id", e.TraceID},
+		{"client_ip", e.ClientIP},
+		{"method", e.Method},
+		{"path", e.Path},
+		{"protocol", e.Protocol},
+		{"status", strconv.Itoa(e.Status)},
+		{"bytes_sent", strconv.FormatInt(e.BytesSent, 10)},
+		{"duration_ms", strconv.FormatFloat(e.DurationMs, 'f', 3, 64)},
+		{"upstream_latency_ms", strconv.FormatFloat(e.UpstreamLatencyMs, 'f', 3, 64)},
+		{"upstream_status", strconv.Itoa(e.UpstreamStatus)},
+		{"key_hash", e.KeyHash},
+		{"key_preview", e.KeyPreview},
+		{"retry_count", strconv.Itoa(e.RetryCount)},
+		{"cache_status", e.CacheStatus},
+		{"referer", e.Referer},
+		{"user_agent", e.UserAgent},
+	}
+
+	parts := make([]string, 0, len(fields))
+	for _, field := range fields {
+		parts = append(parts, field[0]+"="+logfmtValue(field[1]))
+	}
+	return strings.Join(parts, " ")
+}
+
+func logfmtValue(value string) string {
+	if value == "" {
+		return `""`
+	}
+	if strings.ContainsAny(value, " \t\"=") {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+func dashIfEmpty(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// keyIDHash returns a short, non-reversible identifier for an API key
+func keyIDHash(key string) string {
+	if key == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])[:12]
+}
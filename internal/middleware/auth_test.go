@@ -0,0 +1,364 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/cache"
+	"github.com/dbccccccc/tavily-load/internal/config"
+	"github.com/dbccccccc/tavily-load/internal/events"
+	"github.com/dbccccccc/tavily-load/internal/repository"
+	"github.com/sirupsen/logrus"
+)
+
+const testAuthKey = "admin-secret"
+
+// authTest runs requests through an AuthMiddleware backed by the in-memory key
+// database and cache, recording what the wrapped handler saw
+type authTest struct {
+	repo    *repository.MemoryKeyRepository
+	handler http.Handler
+
+	scopes []string
+	actor  string
+}
+
+func newAuthTest(t *testing.T, cfg *config.Config) *authTest {
+	t.Helper()
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	test := &authTest{repo: repository.NewMemoryKeyRepository()}
+	auth := NewAuthMiddleware(cfg, logger, test.repo, cache.NewMemoryCache())
+	test.handler = auth.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		test.scopes, _ = r.Context().Value(AuthScopesKey{}).([]string)
+		test.actor = repository.Actor(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+	return test
+}
+
+// addToken stores token with secret as its credential
+func (a *authTest) addToken(t *testing.T, secret string, token *repository.AuthToken) *repository.AuthToken {
+	t.Helper()
+
+	token.TokenHash = repository.HashKey(secret)
+	created, err := a.repo.CreateAuthToken(context.Background(), token)
+	if err != nil {
+		t.Fatalf("CreateAuthToken: %v", err)
+	}
+	return created
+}
+
+// do sends a request for path with secret as its bearer token, if any
+func (a *authTest) do(path, secret string) int {
+	req := httptest.NewRequest(http.MethodPost, path, nil)
+	if secret != "" {
+		req.Header.Set("Authorization", "Bearer "+secret)
+	}
+	rec := httptest.NewRecorder()
+	a.handler.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func tokenConfig() *config.Config {
+	return &config.Config{
+		AuthKey:           testAuthKey,
+		AuthTokensEnabled: true,
+		AuthTokenCacheTTL: time.Minute,
+	}
+}
+
+func TestAuthMiddlewareAdminKey(t *testing.T) {
+	test := newAuthTest(t, tokenConfig())
+
+	if code := test.do("/api/keys", testAuthKey); code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", code)
+	}
+	if len(test.scopes) != 1 || test.scopes[0] != ScopeAdmin {
+		t.Errorf("scopes = %v, want [admin]", test.scopes)
+	}
+	if test.actor != ActorAdmin {
+		t.Errorf("actor = %q, want %q", test.actor, ActorAdmin)
+	}
+}
+
+func TestAuthMiddlewareRejectsMissingAndUnknownCredentials(t *testing.T) {
+	test := newAuthTest(t, tokenConfig())
+	test.addToken(t, "tok-inactive", &repository.AuthToken{Name: "inactive"})
+
+	tests := []struct {
+		name   string
+		secret string
+	}{
+		{"missing", ""},
+		{"unknown", "tok-unknown"},
+		{"inactive", "tok-inactive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := test.do("/search", tt.secret); code != http.StatusUnauthorized {
+				t.Errorf("status = %d, want 401", code)
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareTokenEndpoints(t *testing.T) {
+	test := newAuthTest(t, tokenConfig())
+	test.addToken(t, "tok-default", &repository.AuthToken{Name: "default", IsActive: true})
+	test.addToken(t, "tok-keys", &repository.AuthToken{
+		Name:             "keys",
+		IsActive:         true,
+		AllowedEndpoints: []string{"/keys/*"},
+	})
+
+	tests := []struct {
+		name   string
+		secret string
+		path   string
+		want   int
+	}{
+		{"default token proxies search", "tok-default", "/search", http.StatusOK},
+		{"default token proxies under /api", "tok-default", "/api/extract", http.StatusOK},
+		{"default token polls jobs", "tok-default", "/jobs/123", http.StatusOK},
+		{"default token cannot manage keys", "tok-default", "/api/keys", http.StatusForbidden},
+		{"listed prefix", "tok-keys", "/api/keys/7", http.StatusOK},
+		{"listed prefix itself", "tok-keys", "/api/keys", http.StatusOK},
+		{"unlisted proxy endpoint", "tok-keys", "/search", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := test.do(tt.path, tt.secret); code != tt.want {
+				t.Errorf("status = %d, want %d", code, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareTokenScopesAndActor(t *testing.T) {
+	test := newAuthTest(t, tokenConfig())
+	token := test.addToken(t, "tok-priority", &repository.AuthToken{
+		Name:     "priority",
+		IsActive: true,
+		Scopes:   []string{ScopePriority},
+	})
+
+	if code := test.do("/search", "tok-priority"); code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", code)
+	}
+	if len(test.scopes) != 1 || test.scopes[0] != ScopePriority {
+		t.Errorf("scopes = %v, want [priority]", test.scopes)
+	}
+	if want := "token:" + strconv.FormatInt(token.ID, 10); test.actor != want {
+		t.Errorf("actor = %q, want %q", test.actor, want)
+	}
+}
+
+func TestAuthMiddlewareTokenRateLimit(t *testing.T) {
+	test := newAuthTest(t, tokenConfig())
+	test.addToken(t, "tok-limited", &repository.AuthToken{Name: "limited", IsActive: true, RateLimitRPM: 2})
+
+	for i := 0; i < 2; i++ {
+		if code := test.do("/usage", "tok-limited"); code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want 200", i+1, code)
+		}
+	}
+	if code := test.do("/usage", "tok-limited"); code != http.StatusTooManyRequests {
+		t.Errorf("request over the limit: status = %d, want 429", code)
+	}
+}
+
+func TestAuthMiddlewareTokenDailyCreditQuota(t *testing.T) {
+	test := newAuthTest(t, tokenConfig())
+	test.addToken(t, "tok-quota", &repository.AuthToken{Name: "quota", IsActive: true, DailyCreditQuota: 2})
+
+	for i := 0; i < 2; i++ {
+		if code := test.do("/search", "tok-quota"); code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want 200", i+1, code)
+		}
+	}
+	if code := test.do("/search", "tok-quota"); code != http.StatusTooManyRequests {
+		t.Errorf("request over the quota: status = %d, want 429", code)
+	}
+	// /usage spends no credits, so it stays available
+	if code := test.do("/usage", "tok-quota"); code != http.StatusOK {
+		t.Errorf("free endpoint: status = %d, want 200", code)
+	}
+}
+
+func TestAuthMiddlewareTokenQuotaHoldsUnderConcurrency(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	repo := repository.NewMemoryKeyRepository()
+	auth := NewAuthMiddleware(tokenConfig(), logger, repo, cache.NewMemoryCache())
+	// Requests overlap, so a quota checked before and charged after each one would be overspent
+	release := make(chan struct{})
+	test := &authTest{repo: repo, handler: auth.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))}
+	test.addToken(t, "tok-quota", &repository.AuthToken{Name: "quota", IsActive: true, DailyCreditQuota: 3})
+
+	const requests = 10
+	codes := make(chan int, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- test.do("/search", "tok-quota")
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(codes)
+
+	served := 0
+	for code := range codes {
+		if code == http.StatusOK {
+			served++
+		}
+	}
+	if served != 3 {
+		t.Errorf("served %d concurrent requests, want the quota of 3", served)
+	}
+}
+
+func TestAuthMiddlewareTokenQuotaRefundsFailedRequests(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	repo := repository.NewMemoryKeyRepository()
+	auth := NewAuthMiddleware(tokenConfig(), logger, repo, cache.NewMemoryCache())
+	test := &authTest{repo: repo, handler: auth.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))}
+	test.addToken(t, "tok-quota", &repository.AuthToken{Name: "quota", IsActive: true, DailyCreditQuota: 1})
+
+	for i := 0; i < 3; i++ {
+		if code := test.do("/search", "tok-quota"); code != http.StatusBadGateway {
+			t.Fatalf("request %d: status = %d, want the upstream's 502 with its credit refunded", i+1, code)
+		}
+	}
+}
+
+func TestAuthMiddlewareEvictsChangedTokens(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	repo := repository.NewMemoryKeyRepository()
+	auth := NewAuthMiddleware(tokenConfig(), logger, repo, cache.NewMemoryCache())
+	bus := events.NewBus(logger)
+	auth.Subscribe(bus)
+	test := &authTest{repo: repo, handler: auth.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))}
+	token := test.addToken(t, "tok-revoked", &repository.AuthToken{Name: "revoked", IsActive: true})
+
+	if code := test.do("/search", "tok-revoked"); code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", code)
+	}
+	if err := repo.DeleteAuthToken(context.Background(), token.ID); err != nil {
+		t.Fatalf("DeleteAuthToken: %v", err)
+	}
+	bus.Publish(events.Event{Type: events.TokenChanged, Data: map[string]interface{}{"token_id": token.ID}})
+	if code := test.do("/search", "tok-revoked"); code != http.StatusUnauthorized {
+		t.Errorf("deleted token: status = %d, want 401 without waiting for the cache TTL", code)
+	}
+}
+
+func TestAuthorizeTokenEndpointForJobs(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	repo := repository.NewMemoryKeyRepository()
+	auth := NewAuthMiddleware(tokenConfig(), logger, repo, cache.NewMemoryCache())
+	// The wrapped handler stands in for POST /jobs, running the endpoint it is given
+	handler := auth.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		endpoint := r.URL.Query().Get("endpoint")
+		if !AuthorizeTokenEndpoint(w, r, endpoint) {
+			return
+		}
+		SettleTokenEndpoint(r.Context(), endpoint, true)
+	}))
+
+	test := &authTest{repo: repo, handler: handler}
+	test.addToken(t, "tok-jobs", &repository.AuthToken{
+		Name:             "jobs",
+		IsActive:         true,
+		DailyCreditQuota: 1,
+		AllowedEndpoints: []string{"/jobs", "/search"},
+	})
+
+	if code := test.do("/jobs?endpoint=/crawl", "tok-jobs"); code != http.StatusForbidden {
+		t.Errorf("job for an unlisted endpoint: status = %d, want 403", code)
+	}
+	if code := test.do("/jobs?endpoint=/search", "tok-jobs"); code != http.StatusOK {
+		t.Fatalf("job for a listed endpoint: status = %d, want 200", code)
+	}
+	if code := test.do("/jobs?endpoint=/search", "tok-jobs"); code != http.StatusTooManyRequests {
+		t.Errorf("job over the quota: status = %d, want 429", code)
+	}
+}
+
+func TestAuthMiddlewareTokensNeedTheKeyDatabase(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	auth := NewAuthMiddleware(tokenConfig(), logger, nil, nil)
+	if auth.tokens != nil {
+		t.Fatal("tokens are enabled without a key database")
+	}
+}
+
+func TestAuthMiddlewareFailsClosedWithoutVerifier(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	cfg := &config.Config{AuthTokensEnabled: true}
+	called := false
+	handler := NewAuthMiddleware(cfg, logger, nil, nil).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/search", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if called || rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, handler called = %v; want 503 without calling the handler", rec.Code, called)
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    *config.Config
+		scopes []string
+		want   bool
+	}{
+		{"auth disabled", &config.Config{}, nil, true},
+		{"admin scope", &config.Config{AuthKey: testAuthKey}, []string{ScopeAdmin}, true},
+		{"other scope", &config.Config{AuthKey: testAuthKey}, []string{ScopePriority}, false},
+		{"no scope", &config.Config{AuthTokensEnabled: true}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/reset-keys", nil)
+			req = req.WithContext(context.WithValue(req.Context(), AuthScopesKey{}, tt.scopes))
+			rec := httptest.NewRecorder()
+
+			if got := RequireAdmin(tt.cfg, rec, req, "Resetting keys"); got != tt.want {
+				t.Errorf("RequireAdmin = %v, want %v", got, tt.want)
+			}
+			if !tt.want && rec.Code != http.StatusForbidden {
+				t.Errorf("status = %d, want 403", rec.Code)
+			}
+		})
+	}
+}
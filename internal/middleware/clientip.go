@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/dbccccccc/tavily-load/pkg/types"
+)
+
+// trustedProxies holds the networks whose forwarded client IP headers are honored
+type trustedProxies []*net.IPNet
+
+// parseTrustedProxies parses TRUSTED_PROXIES entries; bare IPs match only themselves
+func parseTrustedProxies(entries []string) trustedProxies {
+	var proxies trustedProxies
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil {
+				bits := 8 * net.IPv6len
+				if ip.To4() != nil {
+					ip, bits = ip.To4(), 8*net.IPv4len
+				}
+				proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			}
+			continue
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			proxies = append(proxies, network)
+		}
+	}
+	return proxies
+}
+
+// trusts reports whether ip belongs to a trusted proxy
+func (t trustedProxies) trusts(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range t {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the client that made a request. Forwarded
+// headers are only believed when the connection comes from a trusted proxy, and
+// X-Forwarded-For is read from the right so clients cannot prepend fake hops.
+func (t trustedProxies) clientIP(r *http.Request) string {
+	ip := remoteIP(r)
+	if !t.trusts(ip) {
+		return ip
+	}
+
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		hops := strings.Split(xff, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if hop == "" {
+				continue
+			}
+			ip = hop
+			if !t.trusts(hop) {
+				break
+			}
+		}
+		return ip
+	}
+
+	if xri := strings.TrimSpace(r.Header.Get("X-Real-IP")); xri != "" {
+		return xri
+	}
+
+	return ip
+}
+
+// remoteIP returns the host part of the connection's remote address
+func remoteIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// getClientIP returns the client IP resolved by the request ID middleware, or the
+// connection's address for requests that did not pass through it
+func getClientIP(r *http.Request) string {
+	if reqCtx, ok := r.Context().Value(RequestContextKey{}).(*types.RequestContext); ok && reqCtx.ClientIP != "" {
+		return reqCtx.ClientIP
+	}
+	return remoteIP(r)
+}
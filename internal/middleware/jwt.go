@@ -0,0 +1,381 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256" // registers SHA-256 for crypto.SHA256.New
+	_ "crypto/sha512" // registers SHA-384 and SHA-512
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/config"
+)
+
+const (
+	// jwksRefreshInterval is how long fetched signing keys are trusted
+	jwksRefreshInterval = time.Hour
+	// jwksMinRefresh limits refetches triggered by unknown key IDs
+	jwksMinRefresh = time.Minute
+	// jwtLeeway tolerates clock skew when checking exp and nbf
+	jwtLeeway = time.Minute
+	// jwtMinRSABits is the smallest RSA modulus accepted for signing keys
+	jwtMinRSABits = 2048
+)
+
+// jwtAlgorithm is a signing algorithm a token may be signed with, and the key
+// type and curve it needs
+type jwtAlgorithm struct {
+	hash  crypto.Hash
+	kty   string
+	curve elliptic.Curve
+}
+
+// jwtAlgorithms is the allow-list of signing algorithms. Symmetric algorithms
+// and "none" are deliberately absent.
+var jwtAlgorithms = map[string]jwtAlgorithm{
+	"RS256": {hash: crypto.SHA256, kty: "RSA"},
+	"RS384": {hash: crypto.SHA384, kty: "RSA"},
+	"RS512": {hash: crypto.SHA512, kty: "RSA"},
+	"ES256": {hash: crypto.SHA256, kty: "EC", curve: elliptic.P256()},
+	"ES384": {hash: crypto.SHA384, kty: "EC", curve: elliptic.P384()},
+	"ES512": {hash: crypto.SHA512, kty: "EC", curve: elliptic.P521()},
+}
+
+// jwk is a signing key from the JWKS, with the algorithm it is restricted to
+// when the JWKS names one
+type jwk struct {
+	key crypto.PublicKey
+	alg string
+}
+
+// jwtVerifier validates JWTs issued by an OIDC provider against its JWKS. Only
+// the asymmetric algorithms of jwtAlgorithms are accepted, each with keys of its
+// own type and curve.
+type jwtVerifier struct {
+	issuer     string
+	audience   string
+	jwksURL    string
+	adminClaim string
+	adminValue string
+	client     *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]jwk
+	fetchedAt time.Time
+}
+
+func newJWTVerifier(cfg *config.Config) *jwtVerifier {
+	return &jwtVerifier{
+		issuer:     strings.TrimRight(cfg.JWTIssuer, "/"),
+		audience:   cfg.JWTAudience,
+		jwksURL:    cfg.JWTJWKSURL,
+		adminClaim: cfg.JWTAdminClaim,
+		adminValue: cfg.JWTAdminValue,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// looksLikeJWT reports whether a bearer token has the three-part JWT shape
+func looksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// verify checks the token's signature and standard claims, returning its claims
+func (v *jwtVerifier) verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid header: %w", err)
+	}
+
+	key, err := v.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature encoding: %w", err)
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid claims: %w", err)
+	}
+
+	now := time.Now()
+	if iss, _ := claims["iss"].(string); strings.TrimRight(iss, "/") != v.issuer {
+		return nil, errors.New("unexpected issuer")
+	}
+	if !claimContains(claims["aud"], v.audience) {
+		return nil, errors.New("unexpected audience")
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(exp), 0).Add(jwtLeeway)) {
+		return nil, errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(jwtLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, errors.New("token not yet valid")
+	}
+
+	return claims, nil
+}
+
+// scopes returns the proxy scopes granted by a verified token's claims. Admin
+// scope needs JWT_ADMIN_CLAIM to contain JWT_ADMIN_VALUE; an issuer may sign
+// tokens for far more users than the proxy's administrators.
+func (v *jwtVerifier) scopes(claims map[string]interface{}) []string {
+	if v.adminClaim == "" {
+		return []string{}
+	}
+
+	value := claims[v.adminClaim]
+	// OAuth scope claims are space-separated strings
+	if s, ok := value.(string); ok {
+		value = strings.Fields(s)
+	}
+	if claimContains(value, v.adminValue) {
+		return []string{ScopeAdmin}
+	}
+	return []string{}
+}
+
+// key returns the signing key with the given ID, refreshing the JWKS when the
+// cached set is stale or does not contain it
+func (v *jwtVerifier) key(kid string) (jwk, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	stale := time.Since(v.fetchedAt) > jwksRefreshInterval
+	key, ok := v.lookup(kid)
+	if ok && !stale {
+		return key, nil
+	}
+
+	if stale || time.Since(v.fetchedAt) > jwksMinRefresh {
+		keys, err := v.fetchKeys()
+		if err != nil {
+			if ok {
+				// Keep serving the last known key while the provider is unreachable
+				return key, nil
+			}
+			return jwk{}, fmt.Errorf("failed to fetch signing keys: %w", err)
+		}
+		v.keys = keys
+		v.fetchedAt = time.Now()
+	}
+
+	if key, ok = v.lookup(kid); !ok {
+		return jwk{}, errors.New("unknown signing key")
+	}
+	return key, nil
+}
+
+// lookup finds the cached key with the given ID; callers must hold the lock.
+// Providers with a single key often omit kid, but with several a token must say
+// which one signed it, so a token without one is never tried against each.
+func (v *jwtVerifier) lookup(kid string) (jwk, bool) {
+	if kid == "" {
+		if len(v.keys) != 1 {
+			return jwk{}, false
+		}
+		for _, only := range v.keys {
+			return only, true
+		}
+	}
+	key, ok := v.keys[kid]
+	return key, ok
+}
+
+// fetchKeys downloads the JWKS, discovering its URL from the issuer if needed.
+// Keys the verifier cannot use safely, such as RSA keys under 2048 bits or
+// algorithms outside the allow-list, are skipped.
+func (v *jwtVerifier) fetchKeys() (map[string]jwk, error) {
+	if v.jwksURL == "" {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := v.getJSON(v.issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+			return nil, err
+		}
+		if discovery.JWKSURI == "" {
+			return nil, errors.New("issuer does not advertise a jwks_uri")
+		}
+		v.jwksURL = discovery.JWKSURI
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			Alg string `json:"alg"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := v.getJSON(v.jwksURL, &jwks); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]jwk)
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if k.Alg != "" {
+			if alg, ok := jwtAlgorithms[k.Alg]; !ok || alg.kty != k.Kty {
+				continue
+			}
+		}
+		switch k.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil || len(e) > 4 {
+				continue
+			}
+			key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+			if key.N.BitLen() < jwtMinRSABits || key.E < 3 || key.E%2 == 0 {
+				continue
+			}
+			keys[k.Kid] = jwk{key: key, alg: k.Alg}
+		case "EC":
+			var curve elliptic.Curve
+			switch k.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				continue
+			}
+			x, errX := base64.RawURLEncoding.DecodeString(k.X)
+			y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+			if errX != nil || errY != nil {
+				continue
+			}
+			key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+			if !curve.IsOnCurve(key.X, key.Y) {
+				continue
+			}
+			keys[k.Kid] = jwk{key: key, alg: k.Alg}
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS contains no usable signing keys")
+	}
+	return keys, nil
+}
+
+func (v *jwtVerifier) getJSON(url string, dest interface{}) error {
+	resp, err := v.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned HTTP %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(dest)
+}
+
+// verifySignature checks a JWS signature over signed. The algorithm must be on
+// the allow-list, match the algorithm the JWKS restricts the key to, if any, and
+// match the key's type and curve.
+func verifySignature(alg string, key jwk, signed string, signature []byte) error {
+	algorithm, ok := jwtAlgorithms[alg]
+	if !ok {
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	if key.alg != "" && key.alg != alg {
+		return errors.New("key is not for this algorithm")
+	}
+
+	hasher := algorithm.hash.New()
+	hasher.Write([]byte(signed))
+	digest := hasher.Sum(nil)
+
+	switch publicKey := key.key.(type) {
+	case *rsa.PublicKey:
+		if algorithm.kty != "RSA" {
+			return errors.New("key type does not match algorithm")
+		}
+		if publicKey.N.BitLen() < jwtMinRSABits {
+			return errors.New("RSA key is too small")
+		}
+		if err := rsa.VerifyPKCS1v15(publicKey, algorithm.hash, digest, signature); err != nil {
+			return errors.New("invalid signature")
+		}
+	case *ecdsa.PublicKey:
+		if algorithm.kty != "EC" || publicKey.Curve != algorithm.curve {
+			return errors.New("key type does not match algorithm")
+		}
+		size := (publicKey.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("invalid signature")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(publicKey, digest, r, s) {
+			return errors.New("invalid signature")
+		}
+	default:
+		return errors.New("key type does not match algorithm")
+	}
+	return nil
+}
+
+func decodeSegment(segment string, dest interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dest)
+}
+
+// claimContains reports whether a string or array claim includes want
+func claimContains(claim interface{}, want string) bool {
+	switch v := claim.(type) {
+	case string:
+		return v == want
+	case []string:
+		for _, s := range v {
+			if s == want {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok && s == want {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,220 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/config"
+)
+
+const testAudience = "tavily-load"
+
+// testJWK is a signing key served from the test JWKS
+type testJWK struct {
+	kid string
+	alg string
+	key crypto.Signer
+}
+
+// newJWTTest serves keys as the issuer's JWKS and returns a verifier for it
+func newJWTTest(t *testing.T, keys ...testJWK) *jwtVerifier {
+	t.Helper()
+
+	var set []map[string]string
+	for _, k := range keys {
+		entry := map[string]string{"kid": k.kid, "use": "sig"}
+		if k.alg != "" {
+			entry["alg"] = k.alg
+		}
+		switch pub := k.key.Public().(type) {
+		case *rsa.PublicKey:
+			entry["kty"] = "RSA"
+			entry["n"] = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			entry["e"] = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case *ecdsa.PublicKey:
+			entry["kty"] = "EC"
+			entry["crv"] = pub.Curve.Params().Name
+			entry["x"] = base64.RawURLEncoding.EncodeToString(pub.X.Bytes())
+			entry["y"] = base64.RawURLEncoding.EncodeToString(pub.Y.Bytes())
+		}
+		set = append(set, entry)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": set})
+	}))
+	t.Cleanup(server.Close)
+
+	return newJWTVerifier(&config.Config{
+		JWTIssuer:   server.URL,
+		JWTAudience: testAudience,
+		JWTJWKSURL:  server.URL,
+	})
+}
+
+// signJWT returns a token for the verifier's issuer signed by key with alg,
+// naming kid in its header when set
+func signJWT(t *testing.T, v *jwtVerifier, alg, kid string, key crypto.Signer, hash crypto.Hash) string {
+	t.Helper()
+
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	claims := map[string]interface{}{
+		"iss": v.issuer,
+		"aud": testAudience,
+		"sub": "alice",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	headerJSON, _ := json.Marshal(header)
+	claimsJSON, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+
+	hasher := hash.New()
+	hasher.Write([]byte(signed))
+	digest := hasher.Sum(nil)
+
+	var signature []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		sig, err := rsa.SignPKCS1v15(rand.Reader, k, hash, digest)
+		if err != nil {
+			t.Fatalf("SignPKCS1v15: %v", err)
+		}
+		signature = sig
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest)
+		if err != nil {
+			t.Fatalf("ecdsa.Sign: %v", err)
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		signature = make([]byte, 2*size)
+		r.FillBytes(signature[:size])
+		s.FillBytes(signature[size:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func rsaKey(t *testing.T, bits int) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey: %v", err)
+	}
+	return key
+}
+
+func ecKey(t *testing.T, curve elliptic.Curve) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey: %v", err)
+	}
+	return key
+}
+
+func TestJWTVerifierAcceptsAllowedAlgorithms(t *testing.T) {
+	rsa2048 := rsaKey(t, 2048)
+	p256 := ecKey(t, elliptic.P256())
+	v := newJWTTest(t, testJWK{kid: "rsa", key: rsa2048}, testJWK{kid: "ec", alg: "ES256", key: p256})
+
+	for _, token := range []string{
+		signJWT(t, v, "RS256", "rsa", rsa2048, crypto.SHA256),
+		signJWT(t, v, "RS512", "rsa", rsa2048, crypto.SHA512),
+		signJWT(t, v, "ES256", "ec", p256, crypto.SHA256),
+	} {
+		if _, err := v.verify(token); err != nil {
+			t.Errorf("verify: %v", err)
+		}
+	}
+}
+
+func TestJWTVerifierRejectsCurveMismatch(t *testing.T) {
+	p384 := ecKey(t, elliptic.P384())
+	v := newJWTTest(t, testJWK{kid: "ec", key: p384})
+
+	if _, err := v.verify(signJWT(t, v, "ES256", "ec", p384, crypto.SHA256)); err == nil {
+		t.Fatal("ES256 token verified against a P-384 key")
+	}
+	if _, err := v.verify(signJWT(t, v, "ES384", "ec", p384, crypto.SHA384)); err != nil {
+		t.Fatalf("ES384 token on its own curve: %v", err)
+	}
+}
+
+func TestJWTVerifierRejectsKeyTypeMismatch(t *testing.T) {
+	p256 := ecKey(t, elliptic.P256())
+	v := newJWTTest(t, testJWK{kid: "ec", key: p256})
+
+	// An RS256 header cannot select an EC key, whatever the signature
+	token := signJWT(t, v, "ES256", "ec", p256, crypto.SHA256)
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","kid":"ec"}`))
+	forged := header + token[strings.Index(token, "."):]
+	if _, err := v.verify(forged); err == nil {
+		t.Fatal("RS256 token verified against an EC key")
+	}
+}
+
+func TestJWTVerifierRejectsSmallRSAKeys(t *testing.T) {
+	rsa1024 := rsaKey(t, 1024)
+	v := newJWTTest(t, testJWK{kid: "rsa", key: rsa1024})
+
+	if _, err := v.verify(signJWT(t, v, "RS256", "rsa", rsa1024, crypto.SHA256)); err == nil {
+		t.Fatal("token verified against a 1024-bit RSA key")
+	}
+}
+
+func TestJWTVerifierRejectsAlgorithmsOutsideAllowList(t *testing.T) {
+	rsa2048 := rsaKey(t, 2048)
+	v := newJWTTest(t, testJWK{kid: "rsa", key: rsa2048})
+
+	valid := signJWT(t, v, "RS256", "rsa", rsa2048, crypto.SHA256)
+	claimsAndSignature := valid[strings.Index(valid, "."):]
+	for _, alg := range []string{"none", "HS256", "PS256", "RS1"} {
+		header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"` + alg + `","kid":"rsa"}`))
+		if _, err := v.verify(header + claimsAndSignature); err == nil {
+			t.Errorf("token with alg %s verified", alg)
+		}
+	}
+}
+
+func TestJWTVerifierHonorsJWKAlgorithm(t *testing.T) {
+	rsa2048 := rsaKey(t, 2048)
+	v := newJWTTest(t, testJWK{kid: "rsa", alg: "RS384", key: rsa2048})
+
+	if _, err := v.verify(signJWT(t, v, "RS256", "rsa", rsa2048, crypto.SHA256)); err == nil {
+		t.Fatal("RS256 token verified against a key restricted to RS384")
+	}
+	if _, err := v.verify(signJWT(t, v, "RS384", "rsa", rsa2048, crypto.SHA384)); err != nil {
+		t.Fatalf("RS384 token: %v", err)
+	}
+}
+
+func TestJWTVerifierKeyIDs(t *testing.T) {
+	first := ecKey(t, elliptic.P256())
+	second := ecKey(t, elliptic.P256())
+
+	single := newJWTTest(t, testJWK{kid: "only", key: first})
+	if _, err := single.verify(signJWT(t, single, "ES256", "", first, crypto.SHA256)); err != nil {
+		t.Fatalf("token without kid from a single-key issuer: %v", err)
+	}
+
+	several := newJWTTest(t, testJWK{kid: "first", key: first}, testJWK{kid: "second", key: second})
+	if _, err := several.verify(signJWT(t, several, "ES256", "", second, crypto.SHA256)); err == nil {
+		t.Fatal("token without kid verified against an issuer with several keys")
+	}
+	if _, err := several.verify(signJWT(t, several, "ES256", "first", second, crypto.SHA256)); err == nil {
+		t.Fatal("token verified against a key other than the one that signed it")
+	}
+}
@@ -5,10 +5,15 @@ import (
 	"context"
 	"io"
 	"net/http"
+	"os"
+	"regexp"
 	"strings"
 	"time"
 
 	"github.com/dbccccccc/tavily-load/internal/config"
+	"github.com/dbccccccc/tavily-load/internal/errreport"
+	"github.com/dbccccccc/tavily-load/internal/events"
+	"github.com/dbccccccc/tavily-load/internal/repository"
 	"github.com/dbccccccc/tavily-load/pkg/types"
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
@@ -21,26 +26,110 @@ type RequestIDKey struct{}
 // RequestContextKey is the context key for request context
 type RequestContextKey struct{}
 
-// AuthMiddleware handles authentication
+// AuthScopesKey is the context key for the scopes granted to the authenticated caller
+type AuthScopesKey struct{}
+
+// AuthTokenKey is the context key for the auth token a request was made with
+type AuthTokenKey struct{}
+
+// JWTClaimsKey is the context key for the claims of a verified JWT
+type JWTClaimsKey struct{}
+
+// Actors recorded in the audit log for changes made with the admin AUTH_KEY and
+// while authentication is disabled; tokens and JWTs are recorded as token:<id>
+// and jwt:<subject>
+const (
+	ActorAdmin     = "admin"
+	ActorAnonymous = "anonymous"
+)
+
+// ScopeAdmin grants access to sensitive management operations such as full key
+// export and token management
+const ScopeAdmin = "admin"
+
+// ScopePriority marks a caller's traffic as priority, exempt from the throttling
+// and rejection applied once the global credit budget is spent
+const ScopePriority = "priority"
+
+// HasScope reports whether the authenticated caller of a request was granted a scope
+func HasScope(r *http.Request, scope string) bool {
+	scopes, _ := r.Context().Value(AuthScopesKey{}).([]string)
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireAdmin rejects a request whose caller lacks admin scope whenever
+// authentication is enabled, answering 403 "<action> requires admin scope"
+func RequireAdmin(cfg *config.Config, w http.ResponseWriter, r *http.Request, action string) bool {
+	if !cfg.AuthEnabled() {
+		return true
+	}
+	if !HasScope(r, ScopeAdmin) {
+		http.Error(w, action+" requires admin scope", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// AuthMiddleware handles authentication. The static AUTH_KEY is the
+// administrator's credential; with AUTH_TOKENS_ENABLED, named tokens from the
+// auth_tokens table are accepted too, each limited to its own endpoints, request
+// rate and daily credits.
 type AuthMiddleware struct {
+	enabled bool
 	authKey string
+	tokens  *tokenAuthenticator
+	jwt     *jwtVerifier
 	logger  *logrus.Logger
 }
 
-// NewAuthMiddleware creates a new auth middleware
-func NewAuthMiddleware(cfg *config.Config, logger *logrus.Logger) *AuthMiddleware {
-	return &AuthMiddleware{
+// NewAuthMiddleware creates a new auth middleware. keyRepo is nil without the key
+// database, which disables auth tokens, and usageCache may be nil too.
+func NewAuthMiddleware(cfg *config.Config, logger *logrus.Logger, keyRepo types.KeyRepository, usageCache types.UsageCache) *AuthMiddleware {
+	m := &AuthMiddleware{
+		enabled: cfg.AuthEnabled(),
 		authKey: cfg.AuthKey,
 		logger:  logger,
 	}
+	if cfg.AuthTokensEnabled && keyRepo != nil {
+		m.tokens = newTokenAuthenticator(keyRepo, usageCache, cfg.AuthTokenCacheTTL, logger)
+	}
+	if cfg.JWTIssuer != "" {
+		m.jwt = newJWTVerifier(cfg)
+	}
+	return m
+}
+
+// Subscribe drops the cached copy of an auth token as soon as the token is
+// updated or deleted. Other instances serve their copy until AUTH_TOKEN_CACHE_TTL
+// runs out.
+func (m *AuthMiddleware) Subscribe(bus *events.Bus) {
+	if m.tokens == nil {
+		return
+	}
+	bus.Subscribe(func(event events.Event) {
+		if id, ok := event.Data["token_id"].(int64); ok {
+			m.tokens.evict(id)
+		}
+	}, events.TokenChanged)
 }
 
 // Handler implements the middleware interface
 func (m *AuthMiddleware) Handler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Skip auth if no auth key is configured
-		if m.authKey == "" {
-			next.ServeHTTP(w, r)
+		// Skip auth only when it is disabled; with auth enabled but no credential
+		// that could be verified, every request is refused rather than let through
+		if !m.enabled {
+			next.ServeHTTP(w, r.WithContext(repository.WithActor(r.Context(), ActorAnonymous)))
+			return
+		}
+		if m.authKey == "" && m.tokens == nil && m.jwt == nil {
+			m.logger.Error("Authentication is enabled but no credential can be verified, rejecting request")
+			http.Error(w, "Authentication is not available", http.StatusServiceUnavailable)
 			return
 		}
 
@@ -59,31 +148,69 @@ func (m *AuthMiddleware) Handler(next http.Handler) http.Handler {
 		}
 
 		token := parts[1]
-		if token != m.authKey {
-			http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		if m.authKey != "" && token == m.authKey {
+			// The configured auth key is the administrator's credential
+			ctx := context.WithValue(r.Context(), AuthScopesKey{}, []string{ScopeAdmin})
+			ctx = repository.WithActor(ctx, ActorAdmin)
+			next.ServeHTTP(w, r.WithContext(ctx))
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		// SSO-issued JWTs authenticate dashboard users for the management API
+		if m.jwt != nil && looksLikeJWT(token) {
+			if isProxyPath(r.URL.Path) {
+				http.Error(w, "JWTs are only accepted for the management API", http.StatusUnauthorized)
+				return
+			}
+			claims, err := m.jwt.verify(token)
+			if err != nil {
+				m.logger.WithError(err).Debug("Rejected JWT")
+				http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+				return
+			}
+			ctx := context.WithValue(r.Context(), AuthScopesKey{}, m.jwt.scopes(claims))
+			ctx = context.WithValue(ctx, JWTClaimsKey{}, claims)
+			subject, _ := claims["sub"].(string)
+			ctx = repository.WithActor(ctx, "jwt:"+subject)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		if m.tokens == nil {
+			http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+			return
+		}
+		m.tokens.serve(w, r, token, next)
 	})
 }
 
-// RequestIDMiddleware adds a unique request ID to each request
+// requestIDPattern limits the client-supplied request IDs that are reused, so they
+// are safe to log and forward
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestIDMiddleware adds a unique request ID to each request, reusing the
+// caller's X-Request-ID when it has one
 type RequestIDMiddleware struct {
-	logger *logrus.Logger
+	logger  *logrus.Logger
+	proxies trustedProxies
 }
 
 // NewRequestIDMiddleware creates a new request ID middleware
-func NewRequestIDMiddleware(logger *logrus.Logger) *RequestIDMiddleware {
+func NewRequestIDMiddleware(cfg *config.Config, logger *logrus.Logger) *RequestIDMiddleware {
 	return &RequestIDMiddleware{
-		logger: logger,
+		logger:  logger,
+		proxies: parseTrustedProxies(cfg.TrustedProxies),
 	}
 }
 
 // Handler implements the middleware interface
 func (m *RequestIDMiddleware) Handler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		requestID := uuid.New().String()
+		// Keep the caller's request ID so its logs and ours can be matched up
+		requestID := r.Header.Get("X-Request-ID")
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = uuid.New().String()
+		}
 
 		// Add request ID to context
 		ctx := context.WithValue(r.Context(), RequestIDKey{}, requestID)
@@ -97,7 +224,7 @@ func (m *RequestIDMiddleware) Handler(next http.Handler) http.Handler {
 			StartTime: time.Now(),
 			Method:    r.Method,
 			Endpoint:  r.URL.Path,
-			ClientIP:  getClientIP(r),
+			ClientIP:  m.proxies.clientIP(r),
 			UserAgent: r.Header.Get("User-Agent"),
 		}
 
@@ -111,13 +238,28 @@ func (m *RequestIDMiddleware) Handler(next http.Handler) http.Handler {
 type LoggingMiddleware struct {
 	logger        *logrus.Logger
 	enableLogging bool
+	format        string
+	accessLog     *accessLogWriter
 }
 
-// NewLoggingMiddleware creates a new logging middleware
+// NewLoggingMiddleware creates a new logging middleware. With ACCESS_LOG_FILE set,
+// access log lines go to that file instead of stdout, apart from the application log.
 func NewLoggingMiddleware(cfg *config.Config, logger *logrus.Logger) *LoggingMiddleware {
+	var out io.Writer = os.Stdout
+	if cfg.AccessLogFile != "" {
+		file, err := openAccessLogFile(cfg.AccessLogFile)
+		if err != nil {
+			logger.WithError(err).WithField("path", cfg.AccessLogFile).Error("Failed to open access log file, writing access logs to stdout")
+		} else {
+			out = file
+		}
+	}
+
 	return &LoggingMiddleware{
 		logger:        logger,
 		enableLogging: cfg.LogEnableRequest,
+		format:        cfg.AccessLogFormat,
+		accessLog:     newAccessLogWriter(out),
 	}
 }
 
@@ -144,8 +286,20 @@ func (m *LoggingMiddleware) Handler(next http.Handler) http.Handler {
 			requestID = id.(string)
 		}
 
+		if m.format != "" && m.format != "text" {
+			entry := newAccessLogEntry(r, wrapped, requestID, start, duration)
+			m.accessLog.write(m.format, entry)
+			return
+		}
+
+		traceID := ""
+		if reqCtx, ok := r.Context().Value(RequestContextKey{}).(*types.RequestContext); ok {
+			traceID = reqCtx.TraceID
+		}
+
 		m.logger.WithFields(logrus.Fields{
 			"request_id": requestID,
+			"trace_id":   traceID,
 			"method":     r.Method,
 			"path":       r.URL.Path,
 			"status":     wrapped.statusCode,
@@ -175,6 +329,12 @@ func NewRateLimitMiddleware(cfg *config.Config, logger *logrus.Logger) *RateLimi
 	}
 }
 
+// SetMaxConcurrentRequests resizes the limiter for a reloaded MAX_CONCURRENT_REQUESTS
+func (m *RateLimitMiddleware) SetMaxConcurrentRequests(n int) {
+	m.limiter.SetLimit(rate.Limit(float64(n) / 10.0))
+	m.limiter.SetBurst(n)
+}
+
 // Handler implements the middleware interface
 func (m *RateLimitMiddleware) Handler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -232,12 +392,16 @@ func (m *GzipMiddleware) Handler(next http.Handler) http.Handler {
 // RecoveryMiddleware handles panics
 type RecoveryMiddleware struct {
 	logger *logrus.Logger
+	// reporter is nil unless SENTRY_DSN is set
+	reporter *errreport.Reporter
 }
 
-// NewRecoveryMiddleware creates a new recovery middleware
-func NewRecoveryMiddleware(logger *logrus.Logger) *RecoveryMiddleware {
+// NewRecoveryMiddleware creates a new recovery middleware that reports panics to
+// reporter, which is nil unless SENTRY_DSN is set
+func NewRecoveryMiddleware(logger *logrus.Logger, reporter *errreport.Reporter) *RecoveryMiddleware {
 	return &RecoveryMiddleware{
-		logger: logger,
+		logger:   logger,
+		reporter: reporter,
 	}
 }
 
@@ -258,6 +422,8 @@ func (m *RecoveryMiddleware) Handler(next http.Handler) http.Handler {
 					"panic":      err,
 				}).Error("Panic recovered")
 
+				m.reporter.CapturePanic(err, requestTags(r, requestID))
+
 				http.Error(w, "Internal server error", http.StatusInternalServerError)
 			}
 		}()
@@ -266,11 +432,30 @@ func (m *RecoveryMiddleware) Handler(next http.Handler) http.Handler {
 	})
 }
 
+// requestTags describes a request for error reports, identifying its key only by preview
+func requestTags(r *http.Request, requestID string) map[string]string {
+	tags := map[string]string{
+		"request_id": requestID,
+		"method":     r.Method,
+		"endpoint":   r.URL.Path,
+	}
+	if reqCtx, ok := r.Context().Value(RequestContextKey{}).(*types.RequestContext); ok {
+		if len(reqCtx.Key) > 12 {
+			tags["key_preview"] = types.KeyPreview(reqCtx.Key)
+		}
+		if reqCtx.TraceID != "" {
+			tags["trace_id"] = reqCtx.TraceID
+		}
+	}
+	return tags
+}
+
 // Helper types and functions
 
 type responseWriter struct {
 	http.ResponseWriter
-	statusCode int
+	statusCode   int
+	bytesWritten int64
 }
 
 func (rw *responseWriter) WriteHeader(code int) {
@@ -278,32 +463,41 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytesWritten += int64(n)
+	return n, err
+}
+
+// Flush lets streamed responses reach the client through the wrapper
+func (rw *responseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
 type gzipResponseWriter struct {
 	http.ResponseWriter
 	io.Writer
 }
 
+// WriteHeader drops any Content-Length set by the handler, which describes the
+// uncompressed body
+func (w *gzipResponseWriter) WriteHeader(code int) {
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(code)
+}
+
 func (w *gzipResponseWriter) Write(b []byte) (int, error) {
 	return w.Writer.Write(b)
 }
 
-func getClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		ips := strings.Split(xff, ",")
-		return strings.TrimSpace(ips[0])
+// Flush writes pending compressed data through to the client
+func (w *gzipResponseWriter) Flush() {
+	if gz, ok := w.Writer.(*gzip.Writer); ok {
+		gz.Flush()
 	}
-
-	// Check X-Real-IP header
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return xri
-	}
-
-	// Fall back to remote address
-	ip := r.RemoteAddr
-	if idx := strings.LastIndex(ip, ":"); idx != -1 {
-		ip = ip[:idx]
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
 	}
-
-	return ip
 }
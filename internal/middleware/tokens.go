@@ -0,0 +1,314 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/repository"
+	"github.com/dbccccccc/tavily-load/pkg/types"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+// tokenAuthenticator authenticates requests against the auth_tokens table and
+// enforces each token's endpoint allowlist, rate limit and daily credit quota.
+// Lookups are cached briefly so the database is not queried on every request.
+// Rate limits and credit counters live in Redis when it is available so they
+// hold across instances, and fall back to this process otherwise.
+type tokenAuthenticator struct {
+	keyRepo    types.KeyRepository
+	usageCache types.UsageCache
+	cacheTTL   time.Duration
+	logger     *logrus.Logger
+
+	mu       sync.Mutex
+	cached   map[string]cachedToken
+	limiters map[int64]*rate.Limiter
+	credits  map[int64]dailyCredits
+}
+
+// tokenAuthenticatorKey is the context key for the authenticator that admitted a
+// token's request, so calls made on the request's behalf are charged to the token
+type tokenAuthenticatorKey struct{}
+
+type cachedToken struct {
+	token   *repository.AuthToken // nil when the secret matched no token
+	expires time.Time
+}
+
+// dailyCredits is the in-memory credit counter used without Redis
+type dailyCredits struct {
+	day  string
+	used int64
+}
+
+func newTokenAuthenticator(keyRepo types.KeyRepository, usageCache types.UsageCache, cacheTTL time.Duration, logger *logrus.Logger) *tokenAuthenticator {
+	return &tokenAuthenticator{
+		keyRepo:    keyRepo,
+		usageCache: usageCache,
+		cacheTTL:   cacheTTL,
+		logger:     logger,
+		cached:     make(map[string]cachedToken),
+		limiters:   make(map[int64]*rate.Limiter),
+		credits:    make(map[int64]dailyCredits),
+	}
+}
+
+// serve authenticates secret and, if the token may make the request, passes it on
+func (a *tokenAuthenticator) serve(w http.ResponseWriter, r *http.Request, secret string, next http.Handler) {
+	token, err := a.lookup(r.Context(), secret)
+	if err != nil {
+		a.logger.WithError(err).Error("Failed to look up auth token")
+		http.Error(w, "Failed to verify authorization token", http.StatusInternalServerError)
+		return
+	}
+	if token == nil || !token.IsActive {
+		http.Error(w, "Invalid authorization token", http.StatusUnauthorized)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/api")
+	if !endpointAllowed(token.AllowedEndpoints, path) {
+		http.Error(w, "Token is not allowed to access this endpoint", http.StatusForbidden)
+		return
+	}
+
+	if allowed, wait := a.takeRequest(r.Context(), token); !allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		http.Error(w, "Token rate limit exceeded", http.StatusTooManyRequests)
+		return
+	}
+
+	cost := creditCost(path)
+	if !a.reserveCredits(w, token, cost) {
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), AuthTokenKey{}, token)
+	ctx = context.WithValue(ctx, tokenAuthenticatorKey{}, a)
+	ctx = context.WithValue(ctx, AuthScopesKey{}, token.Scopes)
+	ctx = repository.WithActor(ctx, "token:"+strconv.FormatInt(token.ID, 10))
+
+	wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+	next.ServeHTTP(wrapped, r.WithContext(ctx))
+
+	// Only requests Tavily answered successfully spend credits
+	a.settleCredits(token, cost, wrapped.statusCode < 400)
+}
+
+// reserveCredits takes the credits of a request from the token's daily quota
+// before it runs, so concurrent requests cannot overspend the quota between a
+// check and a charge. It answers 429 and returns false, taking nothing, when the
+// quota cannot cover them. Tokens without a quota are charged once their request
+// succeeds instead.
+func (a *tokenAuthenticator) reserveCredits(w http.ResponseWriter, token *repository.AuthToken, cost int) bool {
+	if cost == 0 || token.DailyCreditQuota <= 0 {
+		return true
+	}
+	if used := a.addCredits(token.ID, cost); used <= int64(token.DailyCreditQuota) {
+		return true
+	}
+	a.addCredits(token.ID, -cost)
+
+	now := time.Now().UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	w.Header().Set("Retry-After", strconv.Itoa(int(midnight.Sub(now).Seconds())+1))
+	http.Error(w, "Token daily credit quota exhausted", http.StatusTooManyRequests)
+	return false
+}
+
+// settleCredits charges a token for a finished request: credits reserved for a
+// request that failed are refunded, and tokens without a quota are charged for
+// one that succeeded
+func (a *tokenAuthenticator) settleCredits(token *repository.AuthToken, cost int, succeeded bool) {
+	if cost == 0 {
+		return
+	}
+	reserved := token.DailyCreditQuota > 0
+	switch {
+	case reserved && !succeeded:
+		a.addCredits(token.ID, -cost)
+	case !reserved && succeeded:
+		a.addCredits(token.ID, cost)
+	}
+}
+
+// AuthorizeTokenEndpoint applies the endpoint allowlist and daily credit quota of
+// the auth token a request was made with to a Tavily endpoint the request calls
+// on the caller's behalf, such as a background job's, answering 403 or 429 and
+// returning false when the token may not call it. Requests made without a token
+// are always authorized. Every authorized call must be settled with
+// SettleTokenEndpoint once it finishes.
+func AuthorizeTokenEndpoint(w http.ResponseWriter, r *http.Request, endpoint string) bool {
+	token, a := requestToken(r.Context())
+	if token == nil {
+		return true
+	}
+	if !endpointAllowed(token.AllowedEndpoints, endpoint) {
+		http.Error(w, "Token is not allowed to access this endpoint", http.StatusForbidden)
+		return false
+	}
+	return a.reserveCredits(w, token, creditCost(endpoint))
+}
+
+// SettleTokenEndpoint charges the auth token ctx carries for an authorized call
+// to endpoint once it finished, refunding the credits reserved for it if it failed
+func SettleTokenEndpoint(ctx context.Context, endpoint string, succeeded bool) {
+	if token, a := requestToken(ctx); token != nil {
+		a.settleCredits(token, creditCost(endpoint), succeeded)
+	}
+}
+
+// requestToken returns the auth token a request was made with and the
+// authenticator that admitted it, or nil for requests made without a token
+func requestToken(ctx context.Context) (*repository.AuthToken, *tokenAuthenticator) {
+	token, _ := ctx.Value(AuthTokenKey{}).(*repository.AuthToken)
+	a, _ := ctx.Value(tokenAuthenticatorKey{}).(*tokenAuthenticator)
+	if token == nil || a == nil {
+		return nil, nil
+	}
+	return token, a
+}
+
+// evict drops the cached lookups of a token, so its next request sees the
+// token's current settings or deletion
+func (a *tokenAuthenticator) evict(tokenID int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for hash, entry := range a.cached {
+		if entry.token != nil && entry.token.ID == tokenID {
+			delete(a.cached, hash)
+		}
+	}
+}
+
+// lookup returns the token whose secret hashes to the same value, or nil
+func (a *tokenAuthenticator) lookup(ctx context.Context, secret string) (*repository.AuthToken, error) {
+	hash := repository.HashKey(secret)
+
+	a.mu.Lock()
+	entry, ok := a.cached[hash]
+	a.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.token, nil
+	}
+
+	token, err := a.keyRepo.GetAuthTokenByHash(ctx, hash)
+	if err == sql.ErrNoRows {
+		token, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	a.cached[hash] = cachedToken{token: token, expires: time.Now().Add(a.cacheTTL)}
+	a.mu.Unlock()
+	return token, nil
+}
+
+// takeRequest applies the token's requests-per-minute limit
+func (a *tokenAuthenticator) takeRequest(ctx context.Context, token *repository.AuthToken) (bool, time.Duration) {
+	if token.RateLimitRPM <= 0 {
+		return true, 0
+	}
+
+	if a.usageCache != nil {
+		allowed, wait, err := a.usageCache.TakeKeyToken(ctx, "token:"+strconv.FormatInt(token.ID, 10), token.RateLimitRPM)
+		if err == nil {
+			return allowed, wait
+		}
+		a.logger.WithError(err).Warn("Failed to apply token rate limit in Redis, using local limiter")
+	}
+
+	a.mu.Lock()
+	limiter, ok := a.limiters[token.ID]
+	if !ok || limiter.Burst() != token.RateLimitRPM {
+		limiter = rate.NewLimiter(rate.Limit(float64(token.RateLimitRPM)/60), token.RateLimitRPM)
+		a.limiters[token.ID] = limiter
+	}
+	a.mu.Unlock()
+
+	reservation := limiter.Reserve()
+	if delay := reservation.Delay(); delay > 0 {
+		reservation.Cancel()
+		return false, delay
+	}
+	return true, 0
+}
+
+// addCredits adds credits to what a token spent today, negative to refund them,
+// and returns the new total
+func (a *tokenAuthenticator) addCredits(tokenID int64, credits int) int64 {
+	if a.usageCache != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		used, err := a.usageCache.AddTokenCredits(ctx, tokenID, credits)
+		if err == nil {
+			return used
+		}
+		a.logger.WithError(err).Warn("Failed to record token credits in Redis")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	counter := a.credits[tokenID]
+	if counter.day != today() {
+		counter = dailyCredits{day: today()}
+	}
+	counter.used += int64(credits)
+	a.credits[tokenID] = counter
+	return counter.used
+}
+
+func today() string {
+	return time.Now().UTC().Format("2006-01-02")
+}
+
+// endpointAllowed reports whether path matches a token's allowlist; entries ending
+// in /* allow every path below them. An empty list allows only the proxied Tavily
+// endpoints and background jobs, so management access has to be granted explicitly.
+func endpointAllowed(allowed []string, path string) bool {
+	if len(allowed) == 0 {
+		return isProxyPath(path) || path == "/jobs" || strings.HasPrefix(path, "/jobs/")
+	}
+	for _, entry := range allowed {
+		if prefix, ok := strings.CutSuffix(entry, "/*"); ok {
+			if path == prefix || strings.HasPrefix(path, prefix+"/") {
+				return true
+			}
+		} else if path == entry {
+			return true
+		}
+	}
+	return false
+}
+
+// isProxyPath reports whether a request path is proxied to Tavily rather than
+// served by the management API
+func isProxyPath(path string) bool {
+	path = strings.TrimPrefix(path, "/api")
+	switch path {
+	case "/search", "/extract", "/crawl", "/map", "/usage":
+		return true
+	}
+	return strings.HasPrefix(path, "/tavily/")
+}
+
+// creditCost estimates the credits a request spends. Each proxied Tavily call
+// counts as one credit; management endpoints and /usage are free.
+func creditCost(path string) int {
+	switch {
+	case path == "/search", path == "/extract", path == "/crawl", path == "/map":
+		return 1
+	case strings.HasPrefix(path, "/tavily/") && path != "/tavily/usage":
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/dbccccccc/tavily-load/internal/tracing"
+	"github.com/dbccccccc/tavily-load/pkg/types"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// TracingMiddleware starts the server span that the handler, key manager, Redis
+// and database spans of a request are recorded under. It continues the caller's
+// W3C trace context and echoes it in the traceparent response header, so client
+// traces, proxy logs and upstream requests share one trace ID.
+type TracingMiddleware struct {
+	logger *logrus.Logger
+}
+
+// NewTracingMiddleware creates a new tracing middleware
+func NewTracingMiddleware(logger *logrus.Logger) *TracingMiddleware {
+	return &TracingMiddleware{
+		logger: logger,
+	}
+}
+
+// Handler implements the middleware interface
+func (m *TracingMiddleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Name spans by route template so IDs in paths do not explode span names
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		ctx, span := tracing.StartServer(r.Context(), r.Method+" "+route, r.Header.Get(tracing.TraceparentHeader))
+		defer span.End()
+
+		w.Header().Set(tracing.TraceparentHeader, span.Traceparent())
+		if reqCtx, ok := r.Context().Value(RequestContextKey{}).(*types.RequestContext); ok {
+			reqCtx.TraceID = span.TraceID()
+		}
+
+		if !tracing.Enabled() {
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		span.SetAttribute("http.request.method", r.Method)
+		span.SetAttribute("http.route", route)
+		span.SetAttribute("url.path", r.URL.Path)
+		span.SetAttribute("client.address", getClientIP(r))
+		if id, ok := r.Context().Value(RequestIDKey{}).(string); ok {
+			span.SetAttribute("request_id", id)
+		}
+
+		wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(wrapped, r.WithContext(ctx))
+
+		span.SetAttribute("http.response.status_code", wrapped.statusCode)
+		if wrapped.statusCode >= 500 {
+			span.SetError(strconv.Itoa(wrapped.statusCode) + " " + http.StatusText(wrapped.statusCode))
+		}
+	})
+}
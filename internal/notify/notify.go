@@ -0,0 +1,259 @@
+// Package notify posts critical alerts, such as every key being blacklisted or
+// Tavily failing across keys, to Slack and Discord incoming webhooks so operators
+// hear about them without a separate alerting stack. Notifications are off unless
+// SLACK_WEBHOOK_URL or DISCORD_WEBHOOK_URL is set; until then New returns nil, on
+// which every method is a no-op.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/config"
+	"github.com/dbccccccc/tavily-load/internal/events"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// queueSize bounds the alerts waiting to be sent; later alerts are dropped
+	queueSize = 50
+	// sendTimeout bounds a single delivery
+	sendTimeout = 10 * time.Second
+	// alertColor is the red bar shown next to every alert
+	alertColor = 0xd32f2f
+)
+
+// Field is a labelled value shown beneath an alert's message
+type Field struct {
+	Name  string
+	Value string
+}
+
+// alert is a notification waiting to be posted
+type alert struct {
+	title   string
+	message string
+	fields  []Field
+	at      time.Time
+}
+
+// Notifier posts alerts to the configured Slack and Discord webhooks in the background
+type Notifier struct {
+	slackURL   string
+	discordURL string
+	cooldown   time.Duration
+	client     *http.Client
+	logger     *logrus.Logger
+
+	mu       sync.Mutex
+	lastSent map[string]time.Time // alert key -> when it was last posted
+
+	queue   chan alert
+	pending sync.WaitGroup
+}
+
+// New creates a notifier for SLACK_WEBHOOK_URL and DISCORD_WEBHOOK_URL, or returns
+// nil when neither is set
+func New(cfg *config.Config, logger *logrus.Logger) *Notifier {
+	if cfg.SlackWebhookURL == "" && cfg.DiscordWebhookURL == "" {
+		return nil
+	}
+
+	n := &Notifier{
+		slackURL:   cfg.SlackWebhookURL,
+		discordURL: cfg.DiscordWebhookURL,
+		cooldown:   cfg.NotifyCooldown,
+		client:     &http.Client{Timeout: sendTimeout},
+		logger:     logger,
+		lastSent:   make(map[string]time.Time),
+		queue:      make(chan alert, queueSize),
+	}
+	go n.run()
+	return n
+}
+
+// Subscribe posts an alert for every critical bus event
+func (n *Notifier) Subscribe(bus *events.Bus) {
+	if n == nil {
+		return
+	}
+	bus.Subscribe(n.alertFor, events.AllKeysUnavailable, events.BudgetExceeded, events.QuotaExhausted, events.UpstreamOutage)
+}
+
+// alertFor turns a critical bus event into an alert
+func (n *Notifier) alertFor(event events.Event) {
+	switch event.Type {
+	case events.AllKeysUnavailable:
+		n.Critical("all_keys_unavailable", "All API keys are unavailable",
+			"Every key is blacklisted or quarantined, so proxy requests are failing until a key recovers or is added.",
+			Field{Name: "Keys", Value: fmt.Sprint(event.Data["total_keys"])},
+			Field{Name: "Blacklisted", Value: fmt.Sprint(event.Data["blacklisted_keys"])},
+			Field{Name: "Quarantined", Value: fmt.Sprint(event.Data["quarantined_keys"])})
+	case events.BudgetExceeded:
+		window, mode := fmt.Sprint(event.Data["window"]), fmt.Sprint(event.Data["mode"])
+		n.Critical("budget_exceeded:"+window, "Global credit budget exceeded",
+			fmt.Sprintf("The credit budget for %s is spent; mode %s now applies to callers without the priority scope.", window, mode),
+			Field{Name: "Mode", Value: mode},
+			Field{Name: "Resets", Value: formatTime(event.Data["reset_at"])})
+	case events.QuotaExhausted:
+		n.Critical("quota_exhausted:"+event.Pool, "API key credits exhausted",
+			"Every key that could serve the pool is out of credits, so its requests are answered with 402.",
+			Field{Name: "Pool", Value: event.Pool},
+			Field{Name: "Plan resets", Value: formatTime(event.Data["plan_reset_at"])})
+	case events.UpstreamOutage:
+		n.Critical("upstream_outage", "Tavily upstream outage detected",
+			"Requests are failing across several keys, so the upstream circuit opened and requests are rejected until a probe succeeds.",
+			Field{Name: "Last error", Value: fmt.Sprint(event.Data["error"])},
+			Field{Name: "Retry in", Value: fmt.Sprint(event.Data["retry_in"])})
+	}
+}
+
+// formatTime renders an event timestamp for an alert
+func formatTime(value interface{}) string {
+	t, ok := value.(time.Time)
+	if !ok || t.IsZero() {
+		return "unknown"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// Critical queues an alert without blocking the caller. Alerts sharing a key are
+// posted at most once per NOTIFY_COOLDOWN, so a condition that persists or flaps
+// does not flood the channel.
+func (n *Notifier) Critical(key, title, message string, fields ...Field) {
+	if n == nil {
+		return
+	}
+
+	now := time.Now()
+	n.mu.Lock()
+	if last, ok := n.lastSent[key]; ok && now.Sub(last) < n.cooldown {
+		n.mu.Unlock()
+		return
+	}
+	n.lastSent[key] = now
+	n.mu.Unlock()
+
+	n.pending.Add(1)
+	select {
+	case n.queue <- alert{title: title, message: message, fields: fields, at: now}:
+	default:
+		n.pending.Done()
+		n.logger.WithField("alert", key).Warn("Notification queue full, alert dropped")
+	}
+}
+
+// Flush waits for queued alerts to be posted, giving up when ctx is done
+func (n *Notifier) Flush(ctx context.Context) error {
+	if n == nil {
+		return nil
+	}
+	done := make(chan struct{})
+	go func() {
+		n.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run posts queued alerts one at a time
+func (n *Notifier) run() {
+	for a := range n.queue {
+		if n.slackURL != "" {
+			n.post("Slack", n.slackURL, slackMessage(a))
+		}
+		if n.discordURL != "" {
+			n.post("Discord", n.discordURL, discordMessage(a))
+		}
+		n.pending.Done()
+	}
+}
+
+// slackMessage formats an alert for a Slack incoming webhook
+func slackMessage(a alert) map[string]interface{} {
+	fields := make([]map[string]interface{}, 0, len(a.fields))
+	for _, field := range a.fields {
+		fields = append(fields, map[string]interface{}{
+			"title": field.Name,
+			"value": field.Value,
+			"short": true,
+		})
+	}
+	return map[string]interface{}{
+		"text": fmt.Sprintf(":rotating_light: *%s*", a.title),
+		"attachments": []map[string]interface{}{{
+			"color":  fmt.Sprintf("#%06x", alertColor),
+			"text":   a.message,
+			"fields": fields,
+			"footer": "tavily-load",
+			"ts":     a.at.Unix(),
+		}},
+	}
+}
+
+// discordMessage formats an alert for a Discord webhook
+func discordMessage(a alert) map[string]interface{} {
+	fields := make([]map[string]interface{}, 0, len(a.fields))
+	for _, field := range a.fields {
+		fields = append(fields, map[string]interface{}{
+			"name":   field.Name,
+			"value":  field.Value,
+			"inline": true,
+		})
+	}
+	return map[string]interface{}{
+		"username": "tavily-load",
+		"embeds": []map[string]interface{}{{
+			"title":       a.title,
+			"description": a.message,
+			"color":       alertColor,
+			"fields":      fields,
+			"timestamp":   a.at.UTC().Format(time.RFC3339),
+		}},
+	}
+}
+
+func (n *Notifier) post(service, url string, message map[string]interface{}) {
+	body, err := json.Marshal(message)
+	if err != nil {
+		n.logger.WithError(err).Warn("Failed to encode notification")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		n.logger.WithError(err).Warnf("Failed to create %s notification request", service)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "tavily-load/1.0")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		n.logger.WithError(err).Warnf("Failed to send %s notification", service)
+		return
+	}
+	defer resp.Body.Close()
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	if resp.StatusCode >= 300 {
+		n.logger.WithField("status", resp.StatusCode).
+			WithField("response", strings.TrimSpace(string(detail))).
+			Warnf("%s notification rejected", service)
+	}
+}
@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+)
+
+// logLevelRequest is the body of PUT /api/admin/log-level. An empty or "default"
+// component level makes that component follow the root level again.
+type logLevelRequest struct {
+	Level      string            `json:"level"`
+	Components map[string]string `json:"components"`
+}
+
+// logLevelHandler handles GET /api/admin/log-level (current levels) and
+// PUT /api/admin/log-level (change them without a restart)
+func (s *Server) logLevelHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPut {
+		var req logLevelRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.Level == "" && len(req.Components) == 0 {
+			http.Error(w, "level or components is required", http.StatusBadRequest)
+			return
+		}
+
+		// Validate everything before changing anything, so a bad entry leaves levels untouched
+		var level logrus.Level
+		if req.Level != "" {
+			parsed, err := logrus.ParseLevel(req.Level)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			level = parsed
+		}
+		_, current := s.logLevels.Snapshot()
+		componentLevels := make(map[string]logrus.Level)
+		for name, value := range req.Components {
+			if _, ok := current[name]; !ok {
+				http.Error(w, "Unknown log component: "+name, http.StatusBadRequest)
+				return
+			}
+			if value == "" || value == "default" {
+				continue
+			}
+			parsed, err := logrus.ParseLevel(value)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			componentLevels[name] = parsed
+		}
+
+		if req.Level != "" {
+			s.logLevels.SetLevel(level)
+		}
+		for name := range req.Components {
+			if parsed, ok := componentLevels[name]; ok {
+				s.logLevels.SetComponentLevel(name, parsed)
+			} else {
+				s.logLevels.ResetComponentLevel(name)
+			}
+		}
+
+		s.logger.WithFields(logrus.Fields{
+			"level":      req.Level,
+			"components": req.Components,
+		}).Warn("Log levels changed")
+	}
+
+	root, components := s.logLevels.Snapshot()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"level":      root,
+		"components": components,
+	})
+}
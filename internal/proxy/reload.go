@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/config"
+	"github.com/dbccccccc/tavily-load/internal/repository"
+	"github.com/dbccccccc/tavily-load/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// Reload loads the configuration again and applies the settings that can change
+// without a restart, such as timeouts, retry and rate limits, the selection
+// strategy and the log level. In-flight requests are not interrupted. It returns
+// the settings that changed and those that changed but need a restart.
+func (s *Server) Reload(ctx context.Context) (changed, restart []string, err error) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	next, err := config.NewManager(s.logger).Load()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	changed, restart = s.config.Apply(next)
+	reloadable := s.config.Reloadable()
+	for _, name := range changed {
+		switch name {
+		case "log_level":
+			if level, err := logrus.ParseLevel(reloadable.LogLevel); err == nil {
+				s.logLevels.SetLevel(level)
+			}
+		case "default_selection_strategy":
+			strategy := types.SelectionStrategy(reloadable.DefaultSelectionStrategy)
+			if !s.keyManager.GetStrategyRegistry().Has(strategy) {
+				s.logger.WithField("strategy", strategy).Warn("Unknown selection strategy, keeping the current one")
+				continue
+			}
+			s.keyManager.SetSelectionStrategy(strategy)
+		case "max_concurrent_requests":
+			s.rateLimit.SetMaxConcurrentRequests(reloadable.MaxConcurrentRequests)
+		}
+	}
+
+	s.logger.WithField("changed", changed).Info("Configuration reloaded")
+	if len(restart) > 0 {
+		s.logger.WithField("settings", restart).Warn("Changed settings take effect after a restart")
+	}
+
+	if len(changed) > 0 && s.keyRepo != nil {
+		auditCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		entry := repository.NewAuditEntry(auditCtx, repository.AuditConfigReload, "", nil, map[string][]string{"changed": changed})
+		if err := s.keyRepo.AddAuditEntry(auditCtx, entry); err != nil {
+			s.logger.WithError(err).Error("Failed to record audit entry")
+		}
+	}
+	return changed, restart, nil
+}
+
+// watchReloadSignal reloads the configuration on SIGHUP until ctx is done
+func (s *Server) watchReloadSignal(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-signals:
+				s.logger.Info("Received SIGHUP, reloading configuration")
+				if _, _, err := s.Reload(ctx); err != nil {
+					s.logger.WithError(err).Error("Failed to reload configuration, keeping the current one")
+				}
+			}
+		}
+	}()
+}
+
+// reloadHandler handles POST /api/admin/reload requests, reloading the
+// configuration as SIGHUP does
+func (s *Server) reloadHandler(w http.ResponseWriter, r *http.Request) {
+	changed, restart, err := s.Reload(r.Context())
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to reload configuration, keeping the current one")
+		http.Error(w, "Failed to reload configuration: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if changed == nil {
+		changed = []string{}
+	}
+	if restart == nil {
+		restart = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":           "success",
+		"message":          "Configuration reloaded",
+		"changed":          changed,
+		"restart_required": restart,
+	})
+}
@@ -6,14 +6,21 @@ import (
 	"fmt"
 	"net/http"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/dbccccccc/tavily-load/internal/cache"
 	"github.com/dbccccccc/tavily-load/internal/config"
+	"github.com/dbccccccc/tavily-load/internal/errreport"
 	"github.com/dbccccccc/tavily-load/internal/handler"
 	"github.com/dbccccccc/tavily-load/internal/keymanager"
+	"github.com/dbccccccc/tavily-load/internal/logging"
 	"github.com/dbccccccc/tavily-load/internal/middleware"
+	"github.com/dbccccccc/tavily-load/internal/notify"
+	"github.com/dbccccccc/tavily-load/internal/reports"
 	"github.com/dbccccccc/tavily-load/internal/repository"
+	"github.com/dbccccccc/tavily-load/internal/tracing"
+	"github.com/dbccccccc/tavily-load/internal/webhooks"
 	"github.com/dbccccccc/tavily-load/pkg/types"
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
@@ -22,27 +29,65 @@ import (
 
 // Server implements the ProxyServer interface
 type Server struct {
-	config      *config.Config
-	logger      *logrus.Logger
-	keyManager  *keymanager.Manager
-	handler     *handler.Handler
-	httpServer  *http.Server
-	startTime   time.Time
-	keyRepo     *repository.KeyRepository
-	usageCache  *cache.UsageCache
+	config     *config.Config
+	logger     *logrus.Logger
+	keyManager *keymanager.Manager
+	handler    *handler.Handler
+	httpServer *http.Server
+	startTime  time.Time
+	keyRepo    *repository.KeyRepository
+	usageCache *cache.UsageCache
+	ctx        context.Context
+	cancel     context.CancelFunc
+
+	// redirectServer redirects plain HTTP to HTTPS; nil unless TLS_REDIRECT_PORT is set
+	redirectServer *http.Server
+	// logLevels holds the component loggers whose levels can change at runtime
+	logLevels *logging.Levels
+	// reports is nil unless REPORTS_ENABLED is set
+	reports *reports.Generator
+	// rateLimit is resized when MAX_CONCURRENT_REQUESTS is reloaded
+	rateLimit *middleware.RateLimitMiddleware
+	// reloadMu serializes configuration reloads
+	reloadMu sync.Mutex
+	// reporter is nil unless SENTRY_DSN is set
+	reporter *errreport.Reporter
+	// webhooks is nil unless WEBHOOK_URLS is set
+	webhooks *webhooks.Dispatcher
+	// notifier is nil unless SLACK_WEBHOOK_URL or DISCORD_WEBHOOK_URL is set
+	notifier *notify.Notifier
 }
 
-// NewServer creates a new proxy server
-func NewServer(cfg *config.Config, logger *logrus.Logger, keyRepo *repository.KeyRepository, usageCache *cache.UsageCache) (*Server, error) {
+// NewServer creates a new proxy server. keyRepo is nil when keys are read from
+// KEYS_FILE or TAVILY_API_KEYS, which run without a database, and reporter is nil
+// unless SENTRY_DSN is set.
+func NewServer(cfg *config.Config, logger *logrus.Logger, keyRepo *repository.KeyRepository, usageCache *cache.UsageCache, reporter *errreport.Reporter) (*Server, error) {
+	// Start exporting spans before anything is traced
+	tracing.Init(cfg, logger)
+
+	logLevels := logging.NewLevels(logger)
+	repo, store := backends(keyRepo, usageCache)
+
+	// Proxied requests and usage lookups share one upstream, so under DRY_RUN both
+	// see the same simulated credit usage
+	upstream := upstreamTransport(cfg)
+
 	// Create key manager
-	keyManager, err := keymanager.NewManager(cfg, logger, keyRepo, usageCache)
+	keyManager, err := keymanager.NewManager(cfg, logLevels.Logger("keymanager"), repo, store, upstream)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create key manager: %w", err)
 	}
 
 	// Create handler
-	h := handler.NewHandler(keyManager, cfg, logger, keyRepo)
+	h := handler.NewHandler(keyManager, cfg, logLevels.Logger("handler"), repo, store, reporter, upstream)
+
+	// Deliver lifecycle events to webhooks and chat alerts
+	webhookDispatcher := webhooks.New(cfg, logger)
+	webhookDispatcher.Subscribe(keyManager.Events())
+	notifier := notify.New(cfg, logger)
+	notifier.Subscribe(keyManager.Events())
 
+	ctx, cancel := context.WithCancel(context.Background())
 	server := &Server{
 		config:     cfg,
 		logger:     logger,
@@ -51,16 +96,39 @@ func NewServer(cfg *config.Config, logger *logrus.Logger, keyRepo *repository.Ke
 		startTime:  time.Now(),
 		keyRepo:    keyRepo,
 		usageCache: usageCache,
+		ctx:        ctx,
+		cancel:     cancel,
+		logLevels:  logLevels,
+		reports:    reports.NewGenerator(cfg, logLevels.Logger("reports"), keyRepo),
+		reporter:   reporter,
+		webhooks:   webhookDispatcher,
+		notifier:   notifier,
 	}
 
 	// Setup HTTP server
 	if err := server.setupServer(); err != nil {
+		cancel()
 		return nil, fmt.Errorf("failed to setup server: %w", err)
 	}
 
 	return server, nil
 }
 
+// backends returns the key database and cache as the interfaces the key manager
+// and handler depend on. A nil pointer becomes a nil interface so their checks
+// for a missing database or cache keep working.
+func backends(keyRepo *repository.KeyRepository, usageCache *cache.UsageCache) (types.KeyRepository, types.UsageCache) {
+	var repo types.KeyRepository
+	if keyRepo != nil {
+		repo = keyRepo
+	}
+	var store types.UsageCache
+	if usageCache != nil {
+		store = usageCache
+	}
+	return repo, store
+}
+
 // setupServer configures the HTTP server with routes and middleware
 func (s *Server) setupServer() error {
 	// Create router
@@ -91,6 +159,14 @@ func (s *Server) setupServer() error {
 		ReadTimeout:  s.config.ServerReadTimeout,
 		WriteTimeout: s.config.ServerWriteTimeout,
 		IdleTimeout:  s.config.ServerIdleTimeout,
+		ConnState:    s.handler.TrackConnection,
+	}
+
+	if s.tlsEnabled() {
+		s.httpServer.TLSConfig = tlsConfig()
+		if s.config.TLSRedirectPort != "" {
+			s.redirectServer = s.newRedirectServer()
+		}
 	}
 
 	return nil
@@ -98,29 +174,37 @@ func (s *Server) setupServer() error {
 
 // setupMiddleware configures middleware for the router
 func (s *Server) setupMiddleware(router *mux.Router) {
+	logger := s.logLevels.Logger("middleware")
+
 	// Recovery middleware (should be first)
-	recoveryMiddleware := middleware.NewRecoveryMiddleware(s.logger)
+	recoveryMiddleware := middleware.NewRecoveryMiddleware(logger, s.reporter)
 	router.Use(recoveryMiddleware.Handler)
 
 	// Request ID middleware
-	requestIDMiddleware := middleware.NewRequestIDMiddleware(s.logger)
+	requestIDMiddleware := middleware.NewRequestIDMiddleware(s.config, logger)
 	router.Use(requestIDMiddleware.Handler)
 
+	// Tracing middleware (continues W3C trace context; spans are only exported with OTEL_EXPORTER_OTLP_ENDPOINT)
+	tracingMiddleware := middleware.NewTracingMiddleware(logger)
+	router.Use(tracingMiddleware.Handler)
+
 	// Logging middleware
-	loggingMiddleware := middleware.NewLoggingMiddleware(s.config, s.logger)
+	loggingMiddleware := middleware.NewLoggingMiddleware(s.config, logger)
 	router.Use(loggingMiddleware.Handler)
 
 	// Rate limiting middleware
-	rateLimitMiddleware := middleware.NewRateLimitMiddleware(s.config, s.logger)
-	router.Use(rateLimitMiddleware.Handler)
+	s.rateLimit = middleware.NewRateLimitMiddleware(s.config, logger)
+	router.Use(s.rateLimit.Handler)
 
 	// Gzip compression middleware
-	gzipMiddleware := middleware.NewGzipMiddleware(s.config, s.logger)
+	gzipMiddleware := middleware.NewGzipMiddleware(s.config, logger)
 	router.Use(gzipMiddleware.Handler)
 
-	// Authentication middleware (if auth key is configured)
-	if s.config.AuthKey != "" {
-		authMiddleware := middleware.NewAuthMiddleware(s.config, s.logger)
+	// Authentication middleware (if an auth key, auth tokens or a JWT issuer are configured)
+	if s.config.AuthEnabled() {
+		repo, store := backends(s.keyRepo, s.usageCache)
+		authMiddleware := middleware.NewAuthMiddleware(s.config, logger, repo, store)
+		authMiddleware.Subscribe(s.keyManager.Events())
 		router.Use(authMiddleware.Handler)
 	}
 }
@@ -130,29 +214,81 @@ func (s *Server) setupRoutes(router *mux.Router) {
 	// API routes FIRST (more specific routes)
 	// API routes with /api prefix to avoid conflicts
 	apiRouter := router.PathPrefix("/api").Subrouter()
-	
+
 	// Tavily API endpoints
 	apiRouter.HandleFunc("/search", s.handler.TavilySearchHandler).Methods("POST")
 	apiRouter.HandleFunc("/extract", s.handler.TavilyExtractHandler).Methods("POST")
 	apiRouter.HandleFunc("/crawl", s.handler.TavilyCrawlHandler).Methods("POST")
 	apiRouter.HandleFunc("/map", s.handler.TavilyMapHandler).Methods("POST")
 	apiRouter.HandleFunc("/usage", s.handler.TavilyUsageHandler).Methods("GET")
+	apiRouter.PathPrefix("/tavily/").HandlerFunc(s.handler.TavilyPassthroughHandler)
 
 	// Management endpoints
 	apiRouter.HandleFunc("/health", s.handler.HealthHandler).Methods("GET")
 	apiRouter.HandleFunc("/stats", s.handler.StatsHandler).Methods("GET")
+	apiRouter.HandleFunc("/stats/reset", s.requireAdmin("Resetting stats", s.handler.StatsResetHandler)).Methods("POST")
+	apiRouter.HandleFunc("/stats/snapshot", s.handler.StatsSnapshotHandler).Methods("GET")
+	apiRouter.HandleFunc("/analytics/timeseries", s.requireDatabase(s.handler.TimeseriesHandler)).Methods("GET")
+	apiRouter.HandleFunc("/reports", s.requireDatabase(s.handler.ReportsHandler)).Methods("GET")
+	apiRouter.HandleFunc("/reports/{id}", s.requireDatabase(s.handler.ReportHandler)).Methods("GET")
 	apiRouter.HandleFunc("/blacklist", s.handler.BlacklistHandler).Methods("GET")
-	apiRouter.HandleFunc("/reset-keys", s.handler.ResetKeysHandler).Methods("GET")
+	apiRouter.HandleFunc("/blacklist/history", s.requireDatabase(s.handler.BlacklistHistoryHandler)).Methods("GET")
+	apiRouter.HandleFunc("/reset-keys", s.requireAdmin("Resetting keys", s.handler.ResetKeysHandler)).Methods("GET")
 
 	// Usage and strategy endpoints
 	apiRouter.HandleFunc("/usage-analytics", s.handler.UsageAnalyticsHandler).Methods("GET")
-	apiRouter.HandleFunc("/update-usage", s.handler.UpdateUsageHandler).Methods("POST")
-	apiRouter.HandleFunc("/strategy", s.handler.StrategyHandler).Methods("GET", "POST")
+	apiRouter.HandleFunc("/usage-analytics/export", s.handler.UsageAnalyticsExportHandler).Methods("GET")
+	apiRouter.HandleFunc("/update-usage", s.requireAdmin("Refreshing usage", s.handler.UpdateUsageHandler)).Methods("POST")
+	apiRouter.HandleFunc("/strategy", s.requireAdminWrites("Changing the selection strategy", s.handler.StrategyHandler)).Methods("GET", "POST")
+	apiRouter.HandleFunc("/strategy/compare", s.handler.StrategyCompareHandler).Methods("GET")
+	apiRouter.HandleFunc("/budget", s.handler.BudgetHandler).Methods("GET")
 
 	// Key management endpoints
-	apiRouter.HandleFunc("/keys", s.handler.KeysHandler).Methods("GET", "POST", "DELETE")
-	apiRouter.HandleFunc("/keys/bulk-import", s.handler.BulkImportKeysHandler).Methods("POST")
-	apiRouter.HandleFunc("/keys/upload", s.handler.FileUploadKeysHandler).Methods("POST")
+	apiRouter.HandleFunc("/keys", s.requireDatabase(s.requireAdminWrites("Managing keys", s.handler.KeysHandler))).Methods("GET", "POST", "DELETE")
+	apiRouter.HandleFunc("/keys/bulk-import", s.requireDatabase(s.requireAdmin("Importing keys", s.handler.BulkImportKeysHandler))).Methods("POST")
+	apiRouter.HandleFunc("/keys/upload", s.requireDatabase(s.requireAdmin("Importing keys", s.handler.FileUploadKeysHandler))).Methods("POST")
+	apiRouter.HandleFunc("/keys/export", s.requireDatabase(s.requireAdminWhen("Exporting full key values", exportsKeyValues, s.handler.ExportKeysHandler))).Methods("GET")
+	apiRouter.HandleFunc("/keys/import-jobs/{id}", s.requireDatabase(s.handler.ImportJobHandler)).Methods("GET")
+	apiRouter.HandleFunc("/keys/{id}", s.requireDatabase(s.handler.KeyDetailHandler)).Methods("GET")
+	apiRouter.HandleFunc("/keys/{id}", s.requireDatabase(s.requireAdmin("Managing keys", s.handler.UpdateKeyHandler))).Methods("PATCH")
+	apiRouter.HandleFunc("/keys/{id}/blacklist-history", s.requireDatabase(s.handler.KeyBlacklistHistoryHandler)).Methods("GET")
+	apiRouter.HandleFunc("/keys/{id}/unblacklist", s.requireDatabase(s.requireAdmin("Managing keys", s.handler.UnblacklistKeyHandler))).Methods("POST")
+	apiRouter.HandleFunc("/keys/{id}/quarantine", s.requireDatabase(s.requireAdmin("Managing keys", s.handler.QuarantineKeyHandler))).Methods("POST")
+	apiRouter.HandleFunc("/keys/{id}/unquarantine", s.requireDatabase(s.requireAdmin("Managing keys", s.handler.UnquarantineKeyHandler))).Methods("POST")
+	apiRouter.HandleFunc("/quarantine", s.requireDatabase(s.handler.QuarantineHandler)).Methods("GET")
+	apiRouter.HandleFunc("/pools", s.handler.PoolsHandler).Methods("GET")
+
+	// Auth tokens
+	apiRouter.HandleFunc("/tokens", s.requireDatabase(s.requireAdmin("Managing auth tokens", s.handler.TokensHandler))).Methods("GET", "POST")
+	apiRouter.HandleFunc("/tokens/{id}", s.requireDatabase(s.requireAdmin("Managing auth tokens", s.handler.TokenDetailHandler))).Methods("GET", "PATCH", "DELETE")
+	apiRouter.HandleFunc("/tenants", s.requireDatabase(s.requireAdmin("Listing tenants", s.handler.TenantsHandler))).Methods("GET")
+
+	// Response cache
+	apiRouter.HandleFunc("/cache", s.requireAdminWrites("Invalidating the response cache", s.handler.ResponseCacheHandler)).Methods("GET", "DELETE")
+
+	// Background jobs
+	apiRouter.HandleFunc("/jobs", s.handler.CreateJobHandler).Methods("POST")
+	apiRouter.HandleFunc("/jobs/{id}", s.handler.JobHandler).Methods("GET")
+
+	// Request log and failed request replay
+	apiRouter.HandleFunc("/requests", s.requireDatabase(s.handler.RequestsHandler)).Methods("GET")
+	apiRouter.HandleFunc("/requests/{id}/replay", s.requireAdmin("Replaying requests", s.handler.ReplayRequestHandler)).Methods("POST")
+	apiRouter.HandleFunc("/audit", s.requireDatabase(s.requireAdmin("Reading the audit log", s.handler.AuditHandler))).Methods("GET")
+
+	// Debug captures
+	apiRouter.HandleFunc("/debug/captures", s.requireAdmin("Browsing captures", s.handler.CapturesHandler)).Methods("GET")
+	apiRouter.HandleFunc("/debug/captures/{id}", s.requireAdmin("Browsing captures", s.handler.CaptureHandler)).Methods("GET")
+
+	// Runtime administration
+	apiRouter.HandleFunc("/admin/log-level", s.requireAdmin("Changing log levels", s.logLevelHandler)).Methods("GET", "PUT")
+	apiRouter.HandleFunc("/admin/purge", s.requireAdmin("Purging data", s.handler.PurgeHandler)).Methods("POST")
+	apiRouter.HandleFunc("/admin/reload", s.requireAdmin("Reloading the configuration", s.reloadHandler)).Methods("POST")
+
+	// Profiling and runtime statistics (admin only; PPROF_ENABLED requires authentication)
+	if s.config.PprofEnabled {
+		router.HandleFunc("/debug/vars", s.requireAdmin("Profiling", s.handler.DebugVarsHandler)).Methods("GET")
+		router.PathPrefix("/debug/pprof/").HandlerFunc(s.requireAdmin("Profiling", s.handler.PprofHandler))
+	}
 
 	// Legacy API endpoints (without /api prefix for backward compatibility)
 	router.HandleFunc("/search", s.handler.TavilySearchHandler).Methods("POST")
@@ -163,15 +299,56 @@ func (s *Server) setupRoutes(router *mux.Router) {
 	router.HandleFunc("/health", s.handler.HealthHandler).Methods("GET")
 	router.HandleFunc("/stats", s.handler.StatsHandler).Methods("GET")
 	router.HandleFunc("/blacklist", s.handler.BlacklistHandler).Methods("GET")
-	router.HandleFunc("/reset-keys", s.handler.ResetKeysHandler).Methods("GET")
+	router.HandleFunc("/reset-keys", s.requireAdmin("Resetting keys", s.handler.ResetKeysHandler)).Methods("GET")
 	router.HandleFunc("/usage-analytics", s.handler.UsageAnalyticsHandler).Methods("GET")
-	router.HandleFunc("/update-usage", s.handler.UpdateUsageHandler).Methods("POST")
-	router.HandleFunc("/strategy", s.handler.StrategyHandler).Methods("GET", "POST")
+	router.HandleFunc("/update-usage", s.requireAdmin("Refreshing usage", s.handler.UpdateUsageHandler)).Methods("POST")
+	router.HandleFunc("/strategy", s.requireAdminWrites("Changing the selection strategy", s.handler.StrategyHandler)).Methods("GET", "POST")
 
 	// Frontend routes LAST (catch-all route)
 	s.setupFrontendRoutes(router)
 }
 
+// requireAdmin restricts an endpoint to callers with admin scope whenever
+// authentication is enabled. Admin-only endpoints are gated here, where their
+// routes are registered, rather than inside their handlers.
+func (s *Server) requireAdmin(action string, next http.HandlerFunc) http.HandlerFunc {
+	return s.requireAdminWhen(action, func(*http.Request) bool { return true }, next)
+}
+
+// requireAdminWrites restricts the methods of an endpoint that change state to
+// callers with admin scope, leaving GET open to every authenticated caller
+func (s *Server) requireAdminWrites(action string, next http.HandlerFunc) http.HandlerFunc {
+	return s.requireAdminWhen(action, func(r *http.Request) bool { return r.Method != http.MethodGet }, next)
+}
+
+// requireAdminWhen restricts the requests to an endpoint for which needsAdmin
+// is true to callers with admin scope
+func (s *Server) requireAdminWhen(action string, needsAdmin func(*http.Request) bool, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if needsAdmin(r) && !middleware.RequireAdmin(s.config, w, r, action) {
+			return
+		}
+		next(w, r)
+	}
+}
+
+// exportsKeyValues reports whether a key export asks for full key values, which
+// only admins may download
+func exportsKeyValues(r *http.Request) bool {
+	return r.URL.Query().Get("include_values") == "true"
+}
+
+// requireDatabase answers 501 for an endpoint backed by the key database when
+// running without one
+func (s *Server) requireDatabase(next http.HandlerFunc) http.HandlerFunc {
+	if s.keyRepo != nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Not available without the key database", http.StatusNotImplemented)
+	}
+}
+
 // setupFrontendRoutes configures frontend static file serving
 func (s *Server) setupFrontendRoutes(router *mux.Router) {
 	// Check if web build directory exists
@@ -184,7 +361,7 @@ func (s *Server) setupFrontendRoutes(router *mux.Router) {
 
 	// Serve static files
 	fs := http.FileServer(http.Dir(webDir))
-	
+
 	// Handle SPA routing - serve index.html for non-API routes
 	router.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Check if it's an API route
@@ -210,10 +387,10 @@ func fileExists(path string) bool {
 func isAPIRoute(path string) bool {
 	apiPaths := []string{
 		"/api/", "/search", "/extract", "/crawl", "/map", "/usage",
-		"/health", "/stats", "/blacklist", "/reset-keys", 
+		"/health", "/stats", "/blacklist", "/reset-keys",
 		"/usage-analytics", "/update-usage", "/strategy",
 	}
-	
+
 	for _, apiPath := range apiPaths {
 		if len(path) >= len(apiPath) && path[:len(apiPath)] == apiPath {
 			return true
@@ -272,63 +449,102 @@ func (s *Server) Start() error {
 		"max_concurrent_requests": s.config.MaxConcurrentRequests,
 		"cors_enabled":            s.config.EnableCORS,
 		"gzip_enabled":            s.config.EnableGzip,
-		"auth_enabled":            s.config.AuthKey != "",
+		"auth_enabled":            s.config.AuthEnabled(),
+		"tls_enabled":             s.tlsEnabled(),
+		"tracing_enabled":         tracing.Enabled(),
 	}).Info("Server configuration")
 
+	if s.config.DryRun {
+		s.logger.Warn("DRY_RUN is enabled: upstream calls are simulated and never reach Tavily")
+	}
+
+	// Start background tasks
+	s.startBackgroundTasks()
+
 	// Start server
-	if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	var err error
+	if s.tlsEnabled() {
+		if s.redirectServer != nil {
+			go s.serveRedirects()
+		}
+		err = s.httpServer.ListenAndServeTLS(s.config.TLSCertFile, s.config.TLSKeyFile)
+	} else {
+		err = s.httpServer.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
 		return fmt.Errorf("failed to start server: %w", err)
 	}
 
 	return nil
 }
 
+// startBackgroundTasks starts the periodic jobs that run alongside the HTTP server
+func (s *Server) startBackgroundTasks() {
+	s.keyManager.StartAutoStrategyOptimization(s.ctx)
+	s.keyManager.StartKeyHealthProber(s.ctx)
+	s.keyManager.StartKeySourceRefresh(s.ctx)
+	s.keyManager.StartKeySync(s.ctx)
+	s.keyManager.StartSharedBlacklist(s.ctx)
+	s.handler.StartUsageRollup(s.ctx)
+	s.handler.StartRequestLog(s.ctx)
+	s.handler.StartDependencyChecks(s.ctx)
+	s.reports.Start(s.ctx)
+	s.watchReloadSignal(s.ctx)
+}
+
 // Stop gracefully stops the proxy server
 func (s *Server) Stop(ctx context.Context) error {
 	s.logger.Info("Shutting down server...")
 
+	// Stop background tasks
+	s.cancel()
+
 	// Create shutdown context with timeout
 	shutdownCtx, cancel := context.WithTimeout(ctx, s.config.ServerGracefulShutdownTimeout)
 	defer cancel()
 
 	// Shutdown server
+	if s.redirectServer != nil {
+		if err := s.redirectServer.Shutdown(shutdownCtx); err != nil {
+			s.logger.WithError(err).Warn("HTTP redirect listener shutdown failed")
+		}
+	}
 	if err := s.httpServer.Shutdown(shutdownCtx); err != nil {
 		s.logger.WithError(err).Error("Server shutdown failed")
 		return err
 	}
 
+	// Keep the usage of the last requests in the time series
+	if err := s.handler.FlushUsageRollup(shutdownCtx); err != nil {
+		s.logger.WithError(err).Warn("Failed to store hourly usage rollups")
+	}
+	if err := s.handler.FlushRequestLog(shutdownCtx); err != nil {
+		s.logger.WithError(err).Warn("Failed to store request log")
+	}
+
+	// Deliver pending error reports
+	if err := s.reporter.Flush(shutdownCtx); err != nil {
+		s.logger.WithError(err).Warn("Failed to flush error reports")
+	}
+
+	// Deliver pending webhook events and chat alerts
+	if err := s.webhooks.Flush(shutdownCtx); err != nil {
+		s.logger.WithError(err).Warn("Failed to deliver webhook events")
+	}
+	if err := s.notifier.Flush(shutdownCtx); err != nil {
+		s.logger.WithError(err).Warn("Failed to send chat notifications")
+	}
+
+	// Export the spans of the last requests
+	if err := tracing.Shutdown(shutdownCtx); err != nil {
+		s.logger.WithError(err).Warn("Failed to flush trace spans")
+	}
+
 	s.logger.Info("Server shutdown complete")
 	return nil
 }
 
 // Health returns the current health status
 func (s *Server) Health() types.HealthStatus {
-	keyStats := s.keyManager.GetStats()
-
-	status := "healthy"
-	if keyStats.ActiveKeys == 0 {
-		status = "unhealthy"
-	}
-
-	return types.HealthStatus{
-		Status:    status,
-		Timestamp: time.Now(),
-		Version:   "1.0.0",
-		Uptime:    time.Since(s.startTime),
-		KeyManager: types.KeyManagerHealth{
-			TotalKeys:       keyStats.TotalKeys,
-			ActiveKeys:      keyStats.ActiveKeys,
-			BlacklistedKeys: keyStats.BlacklistedKeys,
-		},
-		Server: types.ServerHealth{
-			RequestsTotal:   0, // TODO: get from handler stats
-			RequestsSuccess: 0,
-			RequestsError:   0,
-			AverageLatency:  0,
-		},
-		Connections: types.ConnectionHealth{
-			ActiveConnections: 0,
-			TotalConnections:  0,
-		},
-	}
+	return s.handler.Health()
 }
@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+)
+
+// tlsEnabled reports whether the server terminates TLS itself
+func (s *Server) tlsEnabled() bool {
+	return s.config.TLSCertFile != "" && s.config.TLSKeyFile != ""
+}
+
+// tlsConfig returns the TLS settings of the HTTPS listener
+func tlsConfig() *tls.Config {
+	return &tls.Config{MinVersion: tls.VersionTLS12}
+}
+
+// newRedirectServer returns a plain HTTP server that sends every request to the
+// same path on the HTTPS listener
+func (s *Server) newRedirectServer() *http.Server {
+	httpsPort := s.config.Port
+
+	redirect := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+
+		// Permanent redirects that preserve the method, so POSTs are resent as POSTs
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+
+	return &http.Server{
+		Addr:              s.config.Host + ":" + s.config.TLSRedirectPort,
+		Handler:           redirect,
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       s.config.ServerIdleTimeout,
+	}
+}
+
+// serveRedirects runs the HTTP to HTTPS redirect listener until it is shut down
+func (s *Server) serveRedirects() {
+	s.logger.WithField("address", s.redirectServer.Addr).Info("Redirecting HTTP to HTTPS")
+	if err := s.redirectServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		s.logger.WithError(err).Error("HTTP redirect listener failed")
+	}
+}
@@ -0,0 +1,29 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/dbccccccc/tavily-load/internal/config"
+	"github.com/dbccccccc/tavily-load/internal/dnscache"
+	"github.com/dbccccccc/tavily-load/internal/dryrun"
+)
+
+// upstreamTransport returns the transport for requests to Tavily: the simulated
+// upstream under DRY_RUN, otherwise a pooled transport that dials through the DNS
+// cache when DNS_SERVERS or DNS_CACHE_TTL is set
+func upstreamTransport(cfg *config.Config) http.RoundTripper {
+	if cfg.DryRun {
+		return dryrun.NewTransport(cfg)
+	}
+
+	transport := &http.Transport{
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		ResponseHeaderTimeout: cfg.ResponseTimeout,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   10,
+	}
+	if resolver := dnscache.New(cfg); resolver != nil {
+		transport.DialContext = resolver.DialContext
+	}
+	return transport
+}
@@ -0,0 +1,332 @@
+// Package reports compiles daily and weekly usage summaries (credits consumed,
+// top keys, blacklist events and error spikes) from the hourly usage rollups,
+// stores them for GET /api/reports and optionally pushes them to a webhook.
+package reports
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/config"
+	"github.com/dbccccccc/tavily-load/internal/repository"
+	"github.com/dbccccccc/tavily-load/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// Report periods
+const (
+	PeriodDaily  = "daily"
+	PeriodWeekly = "weekly"
+)
+
+const (
+	// checkInterval is how often the generator looks for a finished period
+	checkInterval = 10 * time.Minute
+	// webhookTimeout bounds a webhook delivery
+	webhookTimeout = 10 * time.Second
+	// spikeMinErrors is the fewest errors an hour needs to count as a spike
+	spikeMinErrors = 10
+	// spikeMinRate is the lowest error rate an hour needs to count as a spike
+	spikeMinRate = 0.05
+)
+
+// ValidPeriod reports whether period is a supported report period
+func ValidPeriod(period string) bool {
+	return period == PeriodDaily || period == PeriodWeekly
+}
+
+// Report summarizes proxy usage over one period
+type Report struct {
+	Period      string    `json:"period"`
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	GeneratedAt time.Time `json:"generated_at"`
+
+	Requests  int64   `json:"requests"`
+	Errors    int64   `json:"errors"`
+	ErrorRate float64 `json:"error_rate"`
+	// EstimatedCredits counts successful Tavily calls; /usage lookups are free
+	EstimatedCredits int64 `json:"estimated_credits"`
+
+	Endpoints       []EndpointSummary  `json:"endpoints"`
+	TopKeys         []KeySummary       `json:"top_keys"`
+	BlacklistEvents []BlacklistSummary `json:"blacklist_events"`
+	ErrorSpikes     []ErrorSpike       `json:"error_spikes"`
+}
+
+// EndpointSummary is the usage of one endpoint
+type EndpointSummary struct {
+	Endpoint string `json:"endpoint"`
+	Requests int64  `json:"requests"`
+	Errors   int64  `json:"errors"`
+}
+
+// KeySummary is the usage of one of the busiest keys
+type KeySummary struct {
+	KeyID      int64  `json:"key_id"`
+	Name       string `json:"name,omitempty"`
+	KeyPreview string `json:"key_preview"`
+	Requests   int64  `json:"requests"`
+	Errors     int64  `json:"errors"`
+}
+
+// BlacklistSummary is a key blacklisting during the period
+type BlacklistSummary struct {
+	KeyID         int64     `json:"key_id"`
+	KeyPreview    string    `json:"key_preview"`
+	BlacklistedAt time.Time `json:"blacklisted_at"`
+	Reason        string    `json:"reason,omitempty"`
+	Permanent     bool      `json:"permanent"`
+}
+
+// ErrorSpike is an hour whose error rate was well above the period's
+type ErrorSpike struct {
+	Hour      time.Time `json:"hour"`
+	Requests  int64     `json:"requests"`
+	Errors    int64     `json:"errors"`
+	ErrorRate float64   `json:"error_rate"`
+}
+
+// Generator produces the reports of finished periods in the background
+type Generator struct {
+	config  *config.Config
+	logger  *logrus.Logger
+	keyRepo *repository.KeyRepository
+	client  *http.Client
+}
+
+// NewGenerator creates a report generator, or returns nil when REPORTS_ENABLED is off
+func NewGenerator(cfg *config.Config, logger *logrus.Logger, keyRepo *repository.KeyRepository) *Generator {
+	if !cfg.ReportsEnabled {
+		return nil
+	}
+	return &Generator{
+		config:  cfg,
+		logger:  logger,
+		keyRepo: keyRepo,
+		client:  &http.Client{Timeout: webhookTimeout},
+	}
+}
+
+// Start generates missing reports now and whenever a period finishes, until ctx is done
+func (g *Generator) Start(ctx context.Context) {
+	if g == nil {
+		return
+	}
+
+	g.logger.WithField("periods", g.config.ReportPeriods).Info("Scheduled usage reports enabled")
+
+	go func() {
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+
+		for {
+			g.generateDue(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// generateDue stores the report of each configured period that has just finished
+func (g *Generator) generateDue(ctx context.Context) {
+	now := time.Now().UTC()
+	for _, period := range g.config.ReportPeriods {
+		from, to := lastPeriod(period, now)
+		// Give the usage rollups time to flush the period's last requests
+		if now.Before(to.Add(2 * g.config.UsageRollupInterval)) {
+			continue
+		}
+
+		checkCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		exists, err := g.keyRepo.UsageReportExists(checkCtx, period, from)
+		cancel()
+		if err != nil {
+			g.logger.WithError(err).Warn("Failed to check for existing usage report")
+			continue
+		}
+		if exists {
+			continue
+		}
+
+		if err := g.generateAndStore(ctx, period, from, to); err != nil {
+			g.logger.WithError(err).WithField("period", period).Error("Failed to generate usage report")
+		}
+	}
+}
+
+// generateAndStore builds, stores and delivers the report of one period. Other
+// instances may race to store the same period; only the one that wins delivers it.
+func (g *Generator) generateAndStore(ctx context.Context, period string, from, to time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	report, err := g.Generate(ctx, period, from, to)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	id, err := g.keyRepo.CreateUsageReport(ctx, &repository.UsageReport{
+		Period:      period,
+		PeriodStart: from,
+		PeriodEnd:   to,
+		Body:        body,
+	})
+	if err == repository.ErrDuplicateReport {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	g.logger.WithFields(logrus.Fields{
+		"report_id": id,
+		"period":    period,
+		"from":      from,
+		"requests":  report.Requests,
+	}).Info("Usage report generated")
+
+	if g.config.ReportWebhookURL != "" {
+		if err := g.deliver(ctx, body); err != nil {
+			g.logger.WithError(err).WithField("report_id", id).Warn("Failed to deliver usage report to webhook")
+		}
+	}
+	return nil
+}
+
+// Generate compiles the report of the given range
+func (g *Generator) Generate(ctx context.Context, period string, from, to time.Time) (*Report, error) {
+	report := &Report{
+		Period:          period,
+		From:            from,
+		To:              to,
+		GeneratedAt:     time.Now().UTC(),
+		Endpoints:       []EndpointSummary{},
+		TopKeys:         []KeySummary{},
+		BlacklistEvents: []BlacklistSummary{},
+		ErrorSpikes:     []ErrorSpike{},
+	}
+
+	endpoints, err := g.keyRepo.GetUsageByEndpoint(ctx, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query endpoint usage: %w", err)
+	}
+	for _, e := range endpoints {
+		report.Requests += e.RequestsCount
+		report.Errors += e.ErrorsCount
+		if !isFreeEndpoint(e.Endpoint) {
+			report.EstimatedCredits += e.RequestsCount - e.ErrorsCount
+		}
+		report.Endpoints = append(report.Endpoints, EndpointSummary{
+			Endpoint: e.Endpoint,
+			Requests: e.RequestsCount,
+			Errors:   e.ErrorsCount,
+		})
+	}
+	if report.Requests > 0 {
+		report.ErrorRate = float64(report.Errors) / float64(report.Requests)
+	}
+
+	topKeys, err := g.keyRepo.GetTopKeysByUsage(ctx, from, to, g.config.ReportTopKeys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query top keys: %w", err)
+	}
+	for _, k := range topKeys {
+		report.TopKeys = append(report.TopKeys, KeySummary{
+			KeyID:      k.KeyID,
+			Name:       k.Name,
+			KeyPreview: types.KeyPreview(k.KeyValue),
+			Requests:   k.RequestsCount,
+			Errors:     k.ErrorsCount,
+		})
+	}
+
+	events, err := g.keyRepo.GetBlacklistEvents(ctx, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query blacklist events: %w", err)
+	}
+	for _, e := range events {
+		report.BlacklistEvents = append(report.BlacklistEvents, BlacklistSummary{
+			KeyID:         e.KeyID,
+			KeyPreview:    types.KeyPreview(e.KeyValue),
+			BlacklistedAt: e.BlacklistedAt,
+			Reason:        e.Reason,
+			Permanent:     e.IsPermanent,
+		})
+	}
+
+	hours, err := g.keyRepo.GetUsageTimeseries(ctx, repository.TimeseriesOptions{
+		From:       from,
+		To:         to,
+		Resolution: repository.ResolutionHour,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query hourly usage: %w", err)
+	}
+	for _, hour := range hours {
+		if hour.ErrorsCount < spikeMinErrors || hour.RequestsCount == 0 {
+			continue
+		}
+		rate := float64(hour.ErrorsCount) / float64(hour.RequestsCount)
+		if rate >= spikeMinRate && rate >= 2*report.ErrorRate {
+			report.ErrorSpikes = append(report.ErrorSpikes, ErrorSpike{
+				Hour:      hour.Time,
+				Requests:  hour.RequestsCount,
+				Errors:    hour.ErrorsCount,
+				ErrorRate: rate,
+			})
+		}
+	}
+
+	return report, nil
+}
+
+// deliver posts a report to REPORT_WEBHOOK_URL
+func (g *Generator) deliver(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.config.ReportWebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "tavily-load/1.0")
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// lastPeriod returns the UTC range of the most recently finished day or ISO week
+func lastPeriod(period string, now time.Time) (time.Time, time.Time) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if period == PeriodWeekly {
+		// Weeks start on Monday
+		monday := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+		return monday.AddDate(0, 0, -7), monday
+	}
+	return today.AddDate(0, 0, -1), today
+}
+
+// isFreeEndpoint reports whether calls to the endpoint spend no Tavily credits
+func isFreeEndpoint(endpoint string) bool {
+	return endpoint == "/usage"
+}
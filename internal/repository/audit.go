@@ -0,0 +1,214 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/pkg/types"
+)
+
+// Actions recorded in the audit log
+const (
+	AuditKeyCreate      = "key.create"
+	AuditKeyUpdate      = "key.update"
+	AuditKeyDelete      = "key.delete"
+	AuditKeyBlacklist   = "key.blacklist"
+	AuditKeyUnblacklist = "key.unblacklist"
+	AuditKeyTags        = "key.tags"
+	AuditKeyBudget      = "key.budget"
+	AuditKeyQuarantine  = "key.quarantine"
+	AuditKeyRelease     = "key.release"
+	AuditKeyPurge       = "key.purge"
+
+	AuditStrategyUpdate  = "strategy.update"
+	AuditKeysReset       = "keys.reset"
+	AuditStatsReset      = "stats.reset"
+	AuditCacheInvalidate = "cache.invalidate"
+	AuditTokenCreate     = "token.create"
+	AuditTokenUpdate     = "token.update"
+	AuditTokenDelete     = "token.delete"
+	AuditDataPurge       = "data.purge"
+	AuditConfigReload    = "config.reload"
+)
+
+// ActorSystem is the actor of changes the proxy makes by itself, such as
+// blacklisting a failing key
+const ActorSystem = "system"
+
+// actorKey is the context key for the actor changes are recorded for
+type actorKey struct{}
+
+// WithActor returns a context whose key changes are recorded in the audit log as
+// made by actor
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// Actor returns the actor of changes made with ctx, ActorSystem if none is set
+func Actor(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return ActorSystem
+}
+
+// auditedKey is the state of a key recorded in the audit log. The key value is
+// left out; its preview identifies the key.
+type auditedKey struct {
+	KeyPreview       string     `json:"key_preview"`
+	Name             string     `json:"name"`
+	Description      string     `json:"description"`
+	IsActive         bool       `json:"is_active"`
+	IsBlacklisted    bool       `json:"is_blacklisted"`
+	BlacklistedUntil *time.Time `json:"blacklisted_until,omitempty"`
+	BlacklistReason  string     `json:"blacklist_reason,omitempty"`
+	Pool             string     `json:"pool"`
+	Tenant           string     `json:"tenant"`
+}
+
+// keyState returns the audited state of key
+func keyState(key *APIKey) *auditedKey {
+	return &auditedKey{
+		KeyPreview:       types.KeyPreview(key.KeyValue),
+		Name:             key.Name,
+		Description:      key.Description,
+		IsActive:         key.IsActive,
+		IsBlacklisted:    key.IsBlacklisted,
+		BlacklistedUntil: key.BlacklistedUntil,
+		BlacklistReason:  key.BlacklistReason,
+		Pool:             key.Pool,
+		Tenant:           key.Tenant,
+	}
+}
+
+// NewAuditEntry describes a change by the actor of ctx that is not tied to a
+// key, such as a new selection strategy. before and after are stored as JSON;
+// nil values are left out, as for the state before a create.
+func NewAuditEntry(ctx context.Context, action, tenant string, before, after interface{}) *AuditEntry {
+	return &AuditEntry{
+		CreatedAt: time.Now(),
+		Actor:     Actor(ctx),
+		Action:    action,
+		Tenant:    tenant,
+		Before:    auditValue(before),
+		After:     auditValue(after),
+	}
+}
+
+// newAuditEntry describes a change to key by the actor of ctx
+func newAuditEntry(ctx context.Context, action string, key *APIKey, before, after interface{}) *AuditEntry {
+	entry := NewAuditEntry(ctx, action, key.Tenant, before, after)
+	entry.KeyID = key.ID
+	return entry
+}
+
+// auditValue marshals an audited value, nil for none
+func auditValue(value interface{}) json.RawMessage {
+	data, err := json.Marshal(value)
+	if err != nil || string(data) == "null" {
+		return nil
+	}
+	return data
+}
+
+// addAuditEntry stores an audit entry, usually within the transaction of the
+// change it describes so neither is stored without the other
+func addAuditEntry(ctx context.Context, q querier, entry *AuditEntry) error {
+	query := `
+		INSERT INTO audit_log (actor, action, key_id, tenant, before_value, after_value)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+	var keyID interface{}
+	if entry.KeyID != 0 {
+		keyID = entry.KeyID
+	}
+	_, err := q.ExecContext(ctx, query, entry.Actor, entry.Action, keyID, nullString(entry.Tenant),
+		nullString(string(entry.Before)), nullString(string(entry.After)))
+	return err
+}
+
+// AddAuditEntry stores an audit entry for a change made outside the repository
+func (r *KeyRepository) AddAuditEntry(ctx context.Context, entry *AuditEntry) error {
+	return addAuditEntry(ctx, r.db, entry)
+}
+
+// ListAuditLog returns a page of audit entries matching opts, newest first,
+// along with the number of matching entries. PerPage 0 returns every match.
+func (r *KeyRepository) ListAuditLog(ctx context.Context, opts AuditLogOptions) ([]*AuditEntry, int, error) {
+	var conditions []string
+	var args []interface{}
+	if !opts.From.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, opts.From)
+	}
+	if !opts.To.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, opts.To)
+	}
+	if opts.Actor != "" {
+		conditions = append(conditions, "actor = ?")
+		args = append(args, opts.Actor)
+	}
+	if opts.Action != "" {
+		conditions = append(conditions, "action = ?")
+		args = append(args, opts.Action)
+	}
+	if opts.KeyID != 0 {
+		conditions = append(conditions, "key_id = ?")
+		args = append(args, opts.KeyID)
+	}
+	if opts.Tenant != "" {
+		conditions = append(conditions, "tenant = ?")
+		args = append(args, opts.Tenant)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM audit_log"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT id, created_at, actor, action, key_id, tenant, before_value, after_value
+		FROM audit_log` + where + `
+		ORDER BY created_at DESC, id DESC`
+	if opts.PerPage > 0 {
+		page := max(opts.Page, 1)
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, opts.PerPage, (page-1)*opts.PerPage)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	entries := []*AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		var keyID sql.NullInt64
+		var tenant, before, after sql.NullString
+		if err := rows.Scan(&e.ID, &e.CreatedAt, &e.Actor, &e.Action, &keyID, &tenant, &before, &after); err != nil {
+			return nil, 0, err
+		}
+		e.KeyID = keyID.Int64
+		e.Tenant = tenant.String
+		if before.Valid {
+			e.Before = json.RawMessage(before.String)
+		}
+		if after.Valid {
+			e.After = json.RawMessage(after.String)
+		}
+		entries = append(entries, &e)
+	}
+
+	return entries, total, rows.Err()
+}
@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/dbccccccc/tavily-load/internal/database"
+)
+
+// ErrDuplicateToken is returned when an auth token name is already taken
+var ErrDuplicateToken = errors.New("token name already exists")
+
+const authTokenColumns = `id, name, token_hash, token_prefix, rate_limit_rpm, daily_credit_quota,
+		       allowed_endpoints, scopes, tenant, is_active, created_at, updated_at`
+
+// CreateAuthToken stores a new token whose secret hashes to tokenHash, returning
+// ErrDuplicateToken if the name is taken
+func (r *KeyRepository) CreateAuthToken(ctx context.Context, token *AuthToken) (*AuthToken, error) {
+	query := `
+		INSERT INTO auth_tokens (name, token_hash, token_prefix, rate_limit_rpm, daily_credit_quota,
+		                         allowed_endpoints, scopes, tenant, is_active)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := r.db.ExecContext(ctx, query, token.Name, token.TokenHash, token.TokenPrefix,
+		token.RateLimitRPM, token.DailyCreditQuota, joinList(token.AllowedEndpoints),
+		joinList(token.Scopes), token.Tenant, token.IsActive)
+	if err != nil {
+		if database.IsDuplicate(err) {
+			return nil, ErrDuplicateToken
+		}
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.GetAuthTokenByID(ctx, id)
+}
+
+func (r *KeyRepository) GetAuthTokenByID(ctx context.Context, id int64) (*AuthToken, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT "+authTokenColumns+" FROM auth_tokens WHERE id = ?", id)
+	return scanAuthToken(row)
+}
+
+// GetAuthTokenByHash looks a token up by the SHA-256 hash of its secret
+func (r *KeyRepository) GetAuthTokenByHash(ctx context.Context, tokenHash string) (*AuthToken, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT "+authTokenColumns+" FROM auth_tokens WHERE token_hash = ?", tokenHash)
+	return scanAuthToken(row)
+}
+
+// ListAuthTokens returns the tokens of a tenant, or every token when tenant is empty
+func (r *KeyRepository) ListAuthTokens(ctx context.Context, tenant string) ([]*AuthToken, error) {
+	query := "SELECT " + authTokenColumns + " FROM auth_tokens"
+	var args []interface{}
+	if tenant != "" {
+		query += " WHERE tenant = ?"
+		args = append(args, tenant)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query+" ORDER BY name", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*AuthToken{}
+	for rows.Next() {
+		token, err := scanAuthToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// UpdateAuthToken saves a token's name, limits, scopes, tenant and active flag
+func (r *KeyRepository) UpdateAuthToken(ctx context.Context, token *AuthToken) (*AuthToken, error) {
+	query := `
+		UPDATE auth_tokens
+		SET name = ?, rate_limit_rpm = ?, daily_credit_quota = ?, allowed_endpoints = ?,
+		    scopes = ?, tenant = ?, is_active = ?, updated_at = ` + r.db.Now() + `
+		WHERE id = ?
+	`
+	_, err := r.db.ExecContext(ctx, query, token.Name, token.RateLimitRPM, token.DailyCreditQuota,
+		joinList(token.AllowedEndpoints), joinList(token.Scopes), token.Tenant, token.IsActive, token.ID)
+	if err != nil {
+		if database.IsDuplicate(err) {
+			return nil, ErrDuplicateToken
+		}
+		return nil, err
+	}
+
+	return r.GetAuthTokenByID(ctx, token.ID)
+}
+
+func (r *KeyRepository) DeleteAuthToken(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM auth_tokens WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAuthToken(row rowScanner) (*AuthToken, error) {
+	var token AuthToken
+	var endpoints sql.NullString
+	var scopes string
+	err := row.Scan(
+		&token.ID, &token.Name, &token.TokenHash, &token.TokenPrefix, &token.RateLimitRPM,
+		&token.DailyCreditQuota, &endpoints, &scopes, &token.Tenant, &token.IsActive,
+		&token.CreatedAt, &token.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	token.AllowedEndpoints = splitList(endpoints.String)
+	token.Scopes = splitList(scopes)
+	return &token, nil
+}
+
+// joinList stores a list as a comma-separated column
+func joinList(values []string) string {
+	return strings.Join(values, ",")
+}
+
+// splitList parses a comma-separated column, dropping empty entries
+func splitList(value string) []string {
+	values := []string{}
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
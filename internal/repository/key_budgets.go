@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+// GetKeyBudget returns the budget of a key, which is zero when none is set
+func (r *KeyRepository) GetKeyBudget(ctx context.Context, keyID int64) (KeyBudget, error) {
+	return keyBudget(ctx, r.db, keyID)
+}
+
+// keyBudget returns the budget of a key, which is zero when none is set
+func keyBudget(ctx context.Context, q querier, keyID int64) (KeyBudget, error) {
+	var budget KeyBudget
+	err := q.QueryRowContext(ctx,
+		"SELECT daily_soft, daily_hard, monthly_soft, monthly_hard FROM key_budgets WHERE key_id = ?", keyID,
+	).Scan(&budget.DailySoft, &budget.DailyHard, &budget.MonthlySoft, &budget.MonthlyHard)
+	if err == sql.ErrNoRows {
+		return KeyBudget{}, nil
+	}
+	return budget, err
+}
+
+// SetKeyBudget replaces the budget of a key; a zero budget removes it
+func (r *KeyRepository) SetKeyBudget(ctx context.Context, keyID int64, budget KeyBudget) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	key, err := getKey(ctx, tx, "id", keyID)
+	if err != nil {
+		return err
+	}
+	before, err := keyBudget(ctx, tx, keyID)
+	if err != nil {
+		return err
+	}
+	if before == budget {
+		return nil
+	}
+
+	query := `
+		INSERT INTO key_budgets (key_id, daily_soft, daily_hard, monthly_soft, monthly_hard)
+		VALUES (?, ?, ?, ?, ?)
+		` + r.db.Upsert("key_id") + `
+		daily_soft = ` + r.db.Excluded("daily_soft") + `,
+		daily_hard = ` + r.db.Excluded("daily_hard") + `,
+		monthly_soft = ` + r.db.Excluded("monthly_soft") + `,
+		monthly_hard = ` + r.db.Excluded("monthly_hard") + `
+	`
+	args := []interface{}{keyID, budget.DailySoft, budget.DailyHard, budget.MonthlySoft, budget.MonthlyHard}
+	if budget.IsZero() {
+		query, args = "DELETE FROM key_budgets WHERE key_id = ?", []interface{}{keyID}
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+
+	if err := addAuditEntry(ctx, tx, newAuditEntry(ctx, AuditKeyBudget, key, before, budget)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetAllKeyBudgets returns the budget of every key that has one, indexed by key value
+func (r *KeyRepository) GetAllKeyBudgets(ctx context.Context) (map[string]KeyBudget, error) {
+	query := `
+		SELECT k.key_value, b.daily_soft, b.daily_hard, b.monthly_soft, b.monthly_hard
+		FROM key_budgets b
+		JOIN api_keys k ON b.key_id = k.id
+		WHERE k.deleted_at IS NULL
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	budgets := make(map[string]KeyBudget)
+	for rows.Next() {
+		var keyValue string
+		var budget KeyBudget
+		if err := rows.Scan(&keyValue, &budget.DailySoft, &budget.DailyHard, &budget.MonthlySoft, &budget.MonthlyHard); err != nil {
+			return nil, err
+		}
+		budgets[keyValue] = budget
+	}
+
+	return budgets, rows.Err()
+}
@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+// quarantineRecord is a key's quarantine as recorded in the audit log
+type quarantineRecord struct {
+	Reason  string `json:"reason"`
+	Details string `json:"details,omitempty"`
+}
+
+// keyQuarantine returns a key's quarantine record, nil if it is not quarantined
+func keyQuarantine(ctx context.Context, q querier, keyID int64) (*quarantineRecord, error) {
+	var record quarantineRecord
+	err := q.QueryRowContext(ctx, "SELECT reason, COALESCE(details, '') FROM key_quarantine WHERE key_id = ?", keyID).
+		Scan(&record.Reason, &record.Details)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// QuarantineKey records that a key was quarantined, replacing an earlier record.
+// Keys that are not stored are ignored.
+func (r *KeyRepository) QuarantineKey(ctx context.Context, keyValue, reason, details string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	key, err := getKey(ctx, tx, "key_hash", HashKey(keyValue))
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	before, err := keyQuarantine(ctx, tx, key.ID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO key_quarantine (key_id, reason, details, quarantined_at)
+		VALUES (?, ?, ?, ` + r.db.Now() + `)
+		` + r.db.Upsert("key_id") + `
+		reason = ` + r.db.Excluded("reason") + `,
+		details = ` + r.db.Excluded("details") + `,
+		quarantined_at = ` + r.db.Excluded("quarantined_at") + `
+	`
+	if _, err := tx.ExecContext(ctx, query, key.ID, reason, details); err != nil {
+		return err
+	}
+
+	after := &quarantineRecord{Reason: reason, Details: details}
+	if err := addAuditEntry(ctx, tx, newAuditEntry(ctx, AuditKeyQuarantine, key, before, after)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReleaseQuarantine removes a key's quarantine record
+func (r *KeyRepository) ReleaseQuarantine(ctx context.Context, keyValue string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	key, err := getKey(ctx, tx, "key_hash", HashKey(keyValue))
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	before, err := keyQuarantine(ctx, tx, key.ID)
+	if err != nil || before == nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM key_quarantine WHERE key_id = ?", key.ID); err != nil {
+		return err
+	}
+	if err := addAuditEntry(ctx, tx, newAuditEntry(ctx, AuditKeyRelease, key, before, nil)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetQuarantinedKeys returns every quarantined key, most recently quarantined first
+func (r *KeyRepository) GetQuarantinedKeys(ctx context.Context) ([]*QuarantinedKey, error) {
+	query := `
+		SELECT k.id, k.key_value, k.name, k.pool, k.tenant, q.reason, COALESCE(q.details, ''), q.quarantined_at
+		FROM key_quarantine q
+		JOIN api_keys k ON q.key_id = k.id
+		WHERE k.deleted_at IS NULL
+		ORDER BY q.quarantined_at DESC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*QuarantinedKey{}
+	for rows.Next() {
+		var key QuarantinedKey
+		if err := rows.Scan(&key.KeyID, &key.KeyValue, &key.Name, &key.Pool, &key.Tenant, &key.Reason, &key.Details, &key.QuarantinedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, &key)
+	}
+
+	return keys, rows.Err()
+}
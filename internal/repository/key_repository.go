@@ -2,61 +2,113 @@ package repository
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/dbccccccc/tavily-load/internal/database"
+	"github.com/dbccccccc/tavily-load/pkg/types"
 )
 
-type APIKey struct {
-	ID               int64      `db:"id"`
-	KeyValue         string     `db:"key_value"`
-	Name             string     `db:"name"`
-	Description      string     `db:"description"`
-	IsActive         bool       `db:"is_active"`
-	IsBlacklisted    bool       `db:"is_blacklisted"`
-	BlacklistedUntil *time.Time `db:"blacklisted_until"`
-	BlacklistReason  string     `db:"blacklist_reason"`
-	CreatedAt        time.Time  `db:"created_at"`
-	UpdatedAt        time.Time  `db:"updated_at"`
+// ErrDuplicateKey is returned when a key value is already stored
+var ErrDuplicateKey = errors.New("key already exists")
+
+// HashKey returns the SHA-256 hex digest used to look keys up, so plaintext key
+// values never appear in query parameters
+func HashKey(keyValue string) string {
+	sum := sha256.Sum256([]byte(keyValue))
+	return hex.EncodeToString(sum[:])
+}
+
+// keySortColumns whitelists the columns keys can be sorted by
+var keySortColumns = map[string]string{
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+	"name":       "name",
+	"id":         "id",
 }
 
-type KeyUsageStats struct {
-	ID            int64      `db:"id"`
-	KeyID         int64      `db:"key_id"`
-	RequestsCount int64      `db:"requests_count"`
-	ErrorsCount   int64      `db:"errors_count"`
-	LastUsedAt    *time.Time `db:"last_used_at"`
-	LastErrorAt   *time.Time `db:"last_error_at"`
-	CreatedAt     time.Time  `db:"created_at"`
-	UpdatedAt     time.Time  `db:"updated_at"`
+// ValidKeyStatus reports whether status is a supported ListKeys status filter
+func ValidKeyStatus(status string) bool {
+	switch status {
+	case "", "active", "inactive", "blacklisted":
+		return true
+	default:
+		return false
+	}
 }
 
-type BlacklistHistory struct {
-	ID               int64      `db:"id"`
-	KeyID            int64      `db:"key_id"`
-	BlacklistedAt    time.Time  `db:"blacklisted_at"`
-	BlacklistedUntil *time.Time `db:"blacklisted_until"`
-	Reason           string     `db:"reason"`
-	IsPermanent      bool       `db:"is_permanent"`
+// ValidKeySort reports whether sort is a supported ListKeys sort column
+func ValidKeySort(sort string) bool {
+	_, ok := keySortColumns[sort]
+	return sort == "" || ok
 }
 
 type KeyRepository struct {
 	db *database.DB
 }
 
+var _ types.KeyRepository = (*KeyRepository)(nil)
+
 func NewKeyRepository(db *database.DB) *KeyRepository {
 	return &KeyRepository{db: db}
 }
 
-func (r *KeyRepository) CreateKey(ctx context.Context, keyValue, name, description string) (*APIKey, error) {
+// Ping checks that the database is reachable
+func (r *KeyRepository) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
+// PoolStats returns the statistics of the database connection pool
+func (r *KeyRepository) PoolStats() *types.PoolStats {
+	stats := r.db.Stats()
+	return &types.PoolStats{
+		MaxOpen:      stats.MaxOpenConnections,
+		Open:         stats.OpenConnections,
+		InUse:        stats.InUse,
+		Idle:         stats.Idle,
+		WaitCount:    stats.WaitCount,
+		WaitDuration: stats.WaitDuration,
+	}
+}
+
+// CreateKey stores a new key for a tenant in pool, DefaultPool if empty, with its
+// tags in the same transaction, returning ErrDuplicateKey if the value already exists
+func (r *KeyRepository) CreateKey(ctx context.Context, keyValue, name, description, tenant, pool string, tags []string) (*APIKey, error) {
+	if pool == "" {
+		pool = DefaultPool
+	}
+
+	exists, err := r.KeyExists(ctx, keyValue)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrDuplicateKey
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
 	query := `
-		INSERT INTO api_keys (key_value, name, description, is_active, is_blacklisted)
-		VALUES (?, ?, ?, true, false)
+		INSERT INTO api_keys (key_value, key_hash, name, description, tenant, pool, is_active, is_blacklisted, blacklist_reason)
+		VALUES (?, ?, ?, ?, ?, ?, true, false, '')
 	`
 
-	result, err := r.db.ExecContext(ctx, query, keyValue, name, description)
+	result, err := tx.ExecContext(ctx, query, keyValue, HashKey(keyValue), name, description, tenant, pool)
 	if err != nil {
+		// A concurrent insert can still win the race after the existence check
+		if database.IsDuplicate(err) {
+			return nil, ErrDuplicateKey
+		}
 		return nil, err
 	}
 
@@ -65,21 +117,59 @@ func (r *KeyRepository) CreateKey(ctx context.Context, keyValue, name, descripti
 		return nil, err
 	}
 
-	return r.GetKeyByID(ctx, id)
+	key, err := getKey(ctx, tx, "id", id)
+	if err != nil {
+		return nil, err
+	}
+	if err := addAuditEntry(ctx, tx, newAuditEntry(ctx, AuditKeyCreate, key, nil, keyState(key))); err != nil {
+		return nil, err
+	}
+
+	if len(tags) > 0 {
+		for _, tag := range tags {
+			if _, err := tx.ExecContext(ctx, "INSERT INTO key_tags (key_id, tag) VALUES (?, ?)", id, tag); err != nil {
+				return nil, err
+			}
+		}
+		sorted := append([]string{}, tags...)
+		sort.Strings(sorted)
+		entry := newAuditEntry(ctx, AuditKeyTags, key, map[string][]string{"tags": {}}, map[string][]string{"tags": sorted})
+		if err := addAuditEntry(ctx, tx, entry); err != nil {
+			return nil, err
+		}
+	}
+
+	return key, tx.Commit()
 }
 
-func (r *KeyRepository) GetKeyByID(ctx context.Context, id int64) (*APIKey, error) {
+// KeyExists reports whether a key value is already stored
+func (r *KeyRepository) KeyExists(ctx context.Context, keyValue string) (bool, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM api_keys WHERE key_hash = ?)", HashKey(keyValue)).Scan(&exists)
+	return exists, err
+}
+
+// querier runs statements on the database or within one of its transactions
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// getKey returns the stored key whose column equals value; deleted keys are
+// never returned
+func getKey(ctx context.Context, q querier, column string, value interface{}) (*APIKey, error) {
 	query := `
 		SELECT id, key_value, name, description, is_active, is_blacklisted, 
-		       blacklisted_until, blacklist_reason, created_at, updated_at
-		FROM api_keys WHERE id = ?
+		       blacklisted_until, blacklist_reason, pool, tenant, created_at, updated_at
+		FROM api_keys WHERE ` + column + ` = ? AND deleted_at IS NULL
 	`
 
 	var key APIKey
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
+	err := q.QueryRowContext(ctx, query, value).Scan(
 		&key.ID, &key.KeyValue, &key.Name, &key.Description, &key.IsActive,
 		&key.IsBlacklisted, &key.BlacklistedUntil, &key.BlacklistReason,
-		&key.CreatedAt, &key.UpdatedAt,
+		&key.Pool, &key.Tenant, &key.CreatedAt, &key.UpdatedAt,
 	)
 
 	if err != nil {
@@ -89,34 +179,53 @@ func (r *KeyRepository) GetKeyByID(ctx context.Context, id int64) (*APIKey, erro
 	return &key, nil
 }
 
+func (r *KeyRepository) GetKeyByID(ctx context.Context, id int64) (*APIKey, error) {
+	return getKey(ctx, r.db, "id", id)
+}
+
 func (r *KeyRepository) GetKeyByValue(ctx context.Context, keyValue string) (*APIKey, error) {
+	return getKey(ctx, r.db, "key_hash", HashKey(keyValue))
+}
+
+// GetKeysByName returns the keys with the given name; names are not unique
+func (r *KeyRepository) GetKeysByName(ctx context.Context, name string) ([]*APIKey, error) {
 	query := `
-		SELECT id, key_value, name, description, is_active, is_blacklisted, 
-		       blacklisted_until, blacklist_reason, created_at, updated_at
-		FROM api_keys WHERE key_value = ?
+		SELECT id, key_value, name, description, is_active, is_blacklisted,
+		       blacklisted_until, blacklist_reason, pool, tenant, created_at, updated_at
+		FROM api_keys WHERE name = ? AND deleted_at IS NULL
+		ORDER BY id
 	`
 
-	var key APIKey
-	err := r.db.QueryRowContext(ctx, query, keyValue).Scan(
-		&key.ID, &key.KeyValue, &key.Name, &key.Description, &key.IsActive,
-		&key.IsBlacklisted, &key.BlacklistedUntil, &key.BlacklistReason,
-		&key.CreatedAt, &key.UpdatedAt,
-	)
-
+	rows, err := r.db.QueryContext(ctx, query, name)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	return &key, nil
+	var keys []*APIKey
+	for rows.Next() {
+		var key APIKey
+		err := rows.Scan(
+			&key.ID, &key.KeyValue, &key.Name, &key.Description, &key.IsActive,
+			&key.IsBlacklisted, &key.BlacklistedUntil, &key.BlacklistReason,
+			&key.Pool, &key.Tenant, &key.CreatedAt, &key.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, &key)
+	}
+
+	return keys, rows.Err()
 }
 
 func (r *KeyRepository) GetAllActiveKeys(ctx context.Context) ([]*APIKey, error) {
 	query := `
 		SELECT id, key_value, name, description, is_active, is_blacklisted, 
-		       blacklisted_until, blacklist_reason, created_at, updated_at
+		       blacklisted_until, blacklist_reason, pool, tenant, created_at, updated_at
 		FROM api_keys 
-		WHERE is_active = true AND (is_blacklisted = false OR 
-		      (blacklisted_until IS NOT NULL AND blacklisted_until < NOW()))
+		WHERE is_active = true AND deleted_at IS NULL AND (is_blacklisted = false OR 
+		      (blacklisted_until IS NOT NULL AND blacklisted_until < ` + r.db.Now() + `))
 		ORDER BY created_at ASC
 	`
 
@@ -132,7 +241,7 @@ func (r *KeyRepository) GetAllActiveKeys(ctx context.Context) ([]*APIKey, error)
 		err := rows.Scan(
 			&key.ID, &key.KeyValue, &key.Name, &key.Description, &key.IsActive,
 			&key.IsBlacklisted, &key.BlacklistedUntil, &key.BlacklistReason,
-			&key.CreatedAt, &key.UpdatedAt,
+			&key.Pool, &key.Tenant, &key.CreatedAt, &key.UpdatedAt,
 		)
 		if err != nil {
 			return nil, err
@@ -143,24 +252,23 @@ func (r *KeyRepository) GetAllActiveKeys(ctx context.Context) ([]*APIKey, error)
 	return keys, rows.Err()
 }
 
-func (r *KeyRepository) BlacklistKey(ctx context.Context, keyValue, reason string, permanent bool, until *time.Time) error {
+func (r *KeyRepository) BlacklistKey(ctx context.Context, keyValue, reason string, permanent bool, until *time.Time, strikes int) error {
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	// Get key ID
-	var keyID int64
-	err = tx.QueryRowContext(ctx, "SELECT id FROM api_keys WHERE key_value = ?", keyValue).Scan(&keyID)
+	key, err := getKey(ctx, tx, "key_hash", HashKey(keyValue))
 	if err != nil {
 		return err
 	}
+	keyID := key.ID
 
 	// Update key status
 	updateQuery := `
 		UPDATE api_keys 
-		SET is_blacklisted = true, blacklisted_until = ?, blacklist_reason = ?, updated_at = NOW()
+		SET is_blacklisted = true, blacklisted_until = ?, blacklist_reason = ?, updated_at = ` + r.db.Now() + `
 		WHERE id = ?
 	`
 	_, err = tx.ExecContext(ctx, updateQuery, until, reason, keyID)
@@ -169,26 +277,98 @@ func (r *KeyRepository) BlacklistKey(ctx context.Context, keyValue, reason strin
 	}
 
 	// Add to blacklist history
+	var durationSeconds *int64
+	if until != nil {
+		seconds := int64(time.Until(*until).Round(time.Second) / time.Second)
+		durationSeconds = &seconds
+	}
+
 	historyQuery := `
-		INSERT INTO key_blacklist_history (key_id, blacklisted_until, reason, is_permanent)
-		VALUES (?, ?, ?, ?)
+		INSERT INTO key_blacklist_history (key_id, blacklisted_until, reason, is_permanent, strike_count, duration_seconds)
+		VALUES (?, ?, ?, ?, ?, ?)
 	`
-	_, err = tx.ExecContext(ctx, historyQuery, keyID, until, reason, permanent)
+	_, err = tx.ExecContext(ctx, historyQuery, keyID, until, reason, permanent, strikes, durationSeconds)
 	if err != nil {
 		return err
 	}
 
+	after := *key
+	after.IsBlacklisted, after.BlacklistedUntil, after.BlacklistReason = true, until, reason
+	if err := addAuditEntry(ctx, tx, newAuditEntry(ctx, AuditKeyBlacklist, key, keyState(key), keyState(&after))); err != nil {
+		return err
+	}
+
 	return tx.Commit()
 }
 
+func (r *KeyRepository) UpdateKey(ctx context.Context, id int64, name, description, pool string, isActive bool) (*APIKey, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	before, err := getKey(ctx, tx, "id", id)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		UPDATE api_keys 
+		SET name = ?, description = ?, pool = ?, is_active = ?, updated_at = ` + r.db.Now() + `
+		WHERE id = ?
+	`
+	if _, err := tx.ExecContext(ctx, query, name, description, pool, isActive, id); err != nil {
+		return nil, err
+	}
+
+	after, err := getKey(ctx, tx, "id", id)
+	if err != nil {
+		return nil, err
+	}
+	if err := addAuditEntry(ctx, tx, newAuditEntry(ctx, AuditKeyUpdate, before, keyState(before), keyState(after))); err != nil {
+		return nil, err
+	}
+
+	return after, tx.Commit()
+}
+
+// UnblacklistKey clears a key's blacklisting; keys that are not blacklisted or
+// not stored are left alone
 func (r *KeyRepository) UnblacklistKey(ctx context.Context, keyValue string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	key, err := getKey(ctx, tx, "key_hash", HashKey(keyValue))
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !key.IsBlacklisted {
+		return nil
+	}
+
 	query := `
 		UPDATE api_keys 
-		SET is_blacklisted = false, blacklisted_until = NULL, blacklist_reason = '', updated_at = NOW()
-		WHERE key_value = ?
+		SET is_blacklisted = false, blacklisted_until = NULL, blacklist_reason = '', updated_at = ` + r.db.Now() + `
+		WHERE id = ?
 	`
-	_, err := r.db.ExecContext(ctx, query, keyValue)
-	return err
+	if _, err := tx.ExecContext(ctx, query, key.ID); err != nil {
+		return err
+	}
+
+	after := *key
+	after.IsBlacklisted, after.BlacklistedUntil, after.BlacklistReason = false, nil, ""
+	if err := addAuditEntry(ctx, tx, newAuditEntry(ctx, AuditKeyUnblacklist, key, keyState(key), keyState(&after))); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (r *KeyRepository) UpdateKeyUsage(ctx context.Context, keyValue string, requestsIncrement, errorsIncrement int64) error {
@@ -200,7 +380,7 @@ func (r *KeyRepository) UpdateKeyUsage(ctx context.Context, keyValue string, req
 
 	// Get key ID
 	var keyID int64
-	err = tx.QueryRowContext(ctx, "SELECT id FROM api_keys WHERE key_value = ?", keyValue).Scan(&keyID)
+	err = tx.QueryRowContext(ctx, "SELECT id FROM api_keys WHERE key_hash = ?", HashKey(keyValue)).Scan(&keyID)
 	if err != nil {
 		return err
 	}
@@ -209,12 +389,12 @@ func (r *KeyRepository) UpdateKeyUsage(ctx context.Context, keyValue string, req
 	query := `
 		INSERT INTO key_usage_stats (key_id, requests_count, errors_count, last_used_at, last_error_at)
 		VALUES (?, ?, ?, ?, ?)
-		ON DUPLICATE KEY UPDATE
-		requests_count = requests_count + VALUES(requests_count),
-		errors_count = errors_count + VALUES(errors_count),
-		last_used_at = CASE WHEN VALUES(requests_count) > 0 THEN VALUES(last_used_at) ELSE last_used_at END,
-		last_error_at = CASE WHEN VALUES(errors_count) > 0 THEN VALUES(last_error_at) ELSE last_error_at END,
-		updated_at = NOW()
+		` + r.db.Upsert("key_id") + `
+		requests_count = requests_count + ` + r.db.Excluded("requests_count") + `,
+		errors_count = errors_count + ` + r.db.Excluded("errors_count") + `,
+		last_used_at = CASE WHEN ` + r.db.Excluded("requests_count") + ` > 0 THEN ` + r.db.Excluded("last_used_at") + ` ELSE last_used_at END,
+		last_error_at = CASE WHEN ` + r.db.Excluded("errors_count") + ` > 0 THEN ` + r.db.Excluded("last_error_at") + ` ELSE last_error_at END,
+		updated_at = ` + r.db.Now() + `
 	`
 
 	now := time.Now()
@@ -239,11 +419,11 @@ func (r *KeyRepository) GetKeyStats(ctx context.Context, keyValue string) (*KeyU
 		SELECT s.id, s.key_id, s.requests_count, s.errors_count, s.last_used_at, s.last_error_at, s.created_at, s.updated_at
 		FROM key_usage_stats s
 		JOIN api_keys k ON s.key_id = k.id
-		WHERE k.key_value = ?
+		WHERE k.key_hash = ?
 	`
 
 	var stats KeyUsageStats
-	err := r.db.QueryRowContext(ctx, query, keyValue).Scan(
+	err := r.db.QueryRowContext(ctx, query, HashKey(keyValue)).Scan(
 		&stats.ID, &stats.KeyID, &stats.RequestsCount, &stats.ErrorsCount,
 		&stats.LastUsedAt, &stats.LastErrorAt, &stats.CreatedAt, &stats.UpdatedAt,
 	)
@@ -262,14 +442,15 @@ func (r *KeyRepository) GetKeyStats(ctx context.Context, keyValue string) (*KeyU
 
 func (r *KeyRepository) GetBlacklistHistory(ctx context.Context, keyValue string) ([]*BlacklistHistory, error) {
 	query := `
-		SELECT h.id, h.key_id, h.blacklisted_at, h.blacklisted_until, h.reason, h.is_permanent
+		SELECT h.id, h.key_id, h.blacklisted_at, h.blacklisted_until, h.reason, h.is_permanent,
+		       h.strike_count, h.duration_seconds
 		FROM key_blacklist_history h
 		JOIN api_keys k ON h.key_id = k.id
-		WHERE k.key_value = ?
+		WHERE k.key_hash = ?
 		ORDER BY h.blacklisted_at DESC
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, keyValue)
+	rows, err := r.db.QueryContext(ctx, query, HashKey(keyValue))
 	if err != nil {
 		return nil, err
 	}
@@ -278,7 +459,44 @@ func (r *KeyRepository) GetBlacklistHistory(ctx context.Context, keyValue string
 	var history []*BlacklistHistory
 	for rows.Next() {
 		var h BlacklistHistory
-		err := rows.Scan(&h.ID, &h.KeyID, &h.BlacklistedAt, &h.BlacklistedUntil, &h.Reason, &h.IsPermanent)
+		err := rows.Scan(&h.ID, &h.KeyID, &h.BlacklistedAt, &h.BlacklistedUntil, &h.Reason, &h.IsPermanent, &h.StrikeCount, &h.DurationSeconds)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, &h)
+	}
+
+	return history, rows.Err()
+}
+
+// ListBlacklistHistory returns the blacklistings of all keys between opts.From
+// and opts.To, newest first
+func (r *KeyRepository) ListBlacklistHistory(ctx context.Context, opts BlacklistHistoryOptions) ([]*BlacklistHistory, error) {
+	query := `
+		SELECT h.id, h.key_id, h.blacklisted_at, h.blacklisted_until, COALESCE(h.reason, ''), h.is_permanent,
+		       h.strike_count, h.duration_seconds, k.key_value, k.name
+		FROM key_blacklist_history h
+		JOIN api_keys k ON h.key_id = k.id
+		WHERE h.blacklisted_at >= ? AND h.blacklisted_at < ?
+	`
+	args := []interface{}{opts.From, opts.To}
+	if opts.Tenant != "" {
+		query += " AND k.tenant = ?"
+		args = append(args, opts.Tenant)
+	}
+	query += " ORDER BY h.blacklisted_at DESC, h.id DESC"
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []*BlacklistHistory{}
+	for rows.Next() {
+		var h BlacklistHistory
+		err := rows.Scan(&h.ID, &h.KeyID, &h.BlacklistedAt, &h.BlacklistedUntil, &h.Reason, &h.IsPermanent,
+			&h.StrikeCount, &h.DurationSeconds, &h.KeyValue, &h.KeyName)
 		if err != nil {
 			return nil, err
 		}
@@ -288,17 +506,79 @@ func (r *KeyRepository) GetBlacklistHistory(ctx context.Context, keyValue string
 	return history, rows.Err()
 }
 
+// DeleteKey soft-deletes a key: it is deactivated and its hash cleared, so it is
+// never returned again and its value can be added anew, while its usage,
+// blacklist history and audit trail are kept
 func (r *KeyRepository) DeleteKey(ctx context.Context, keyValue string) error {
-	query := "DELETE FROM api_keys WHERE key_value = ?"
-	_, err := r.db.ExecContext(ctx, query, keyValue)
-	return err
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	key, err := getKey(ctx, tx, "key_hash", HashKey(keyValue))
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	query := "UPDATE api_keys SET deleted_at = " + r.db.Now() + ", key_hash = NULL, is_active = false WHERE id = ?"
+	if _, err := tx.ExecContext(ctx, query, key.ID); err != nil {
+		return err
+	}
+	if err := addAuditEntry(ctx, tx, newAuditEntry(ctx, AuditKeyDelete, key, keyState(key), nil)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// PurgeDeletedKey removes a deleted key for good, along with its usage,
+// blacklist history, tags, budget and logged requests. Its audit trail is kept.
+// sql.ErrNoRows is returned unless id is a deleted key.
+func (r *KeyRepository) PurgeDeletedKey(ctx context.Context, id int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT key_value, name, description, is_active, is_blacklisted,
+		       blacklisted_until, blacklist_reason, pool, tenant
+		FROM api_keys WHERE id = ? AND deleted_at IS NOT NULL` + r.db.ForUpdate() + `
+	`
+	key := &APIKey{ID: id}
+	if err := tx.QueryRowContext(ctx, query, id).Scan(
+		&key.KeyValue, &key.Name, &key.Description, &key.IsActive, &key.IsBlacklisted,
+		&key.BlacklistedUntil, &key.BlacklistReason, &key.Pool, &key.Tenant,
+	); err != nil {
+		return err
+	}
+
+	// Logged requests only lose their key when it is deleted, so remove them first
+	if _, err := tx.ExecContext(ctx, "DELETE FROM request_log WHERE key_id = ?", id); err != nil {
+		return err
+	}
+	// The remaining key data is deleted by the foreign keys
+	if _, err := tx.ExecContext(ctx, "DELETE FROM api_keys WHERE id = ?", id); err != nil {
+		return err
+	}
+	if err := addAuditEntry(ctx, tx, newAuditEntry(ctx, AuditKeyPurge, key, keyState(key), nil)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (r *KeyRepository) GetAllKeys(ctx context.Context) ([]*APIKey, error) {
 	query := `
 		SELECT id, key_value, name, description, is_active, is_blacklisted, 
-		       blacklisted_until, blacklist_reason, created_at, updated_at
+		       blacklisted_until, blacklist_reason, pool, tenant, created_at, updated_at
 		FROM api_keys
+		WHERE deleted_at IS NULL
 		ORDER BY created_at ASC
 	`
 
@@ -314,7 +594,7 @@ func (r *KeyRepository) GetAllKeys(ctx context.Context) ([]*APIKey, error) {
 		err := rows.Scan(
 			&key.ID, &key.KeyValue, &key.Name, &key.Description, &key.IsActive,
 			&key.IsBlacklisted, &key.BlacklistedUntil, &key.BlacklistReason,
-			&key.CreatedAt, &key.UpdatedAt,
+			&key.Pool, &key.Tenant, &key.CreatedAt, &key.UpdatedAt,
 		)
 		if err != nil {
 			return nil, err
@@ -324,3 +604,85 @@ func (r *KeyRepository) GetAllKeys(ctx context.Context) ([]*APIKey, error) {
 
 	return keys, rows.Err()
 }
+
+// ListKeys returns one page of keys matching the options together with the total
+// number of matching keys
+func (r *KeyRepository) ListKeys(ctx context.Context, opts KeyListOptions) ([]*APIKey, int, error) {
+	conditions := []string{"deleted_at IS NULL"}
+	var args []interface{}
+	switch opts.Status {
+	case "active":
+		conditions = append(conditions, "is_active = true AND is_blacklisted = false")
+	case "inactive":
+		conditions = append(conditions, "is_active = false")
+	case "blacklisted":
+		conditions = append(conditions, "is_blacklisted = true")
+	}
+	if opts.Pool != "" {
+		conditions = append(conditions, "pool = ?")
+		args = append(args, opts.Pool)
+	}
+	if opts.Tenant != "" {
+		conditions = append(conditions, "tenant = ?")
+		args = append(args, opts.Tenant)
+	}
+	if opts.Tag != "" {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM key_tags t WHERE t.key_id = api_keys.id AND t.tag = ?)")
+		args = append(args, opts.Tag)
+	}
+
+	where := "WHERE " + strings.Join(conditions, " AND ")
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM api_keys "+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	column, ok := keySortColumns[opts.Sort]
+	if !ok {
+		column = "created_at"
+	}
+	order := "ASC"
+	if strings.EqualFold(opts.Order, "desc") {
+		order = "DESC"
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, key_value, name, description, is_active, is_blacklisted, 
+		       blacklisted_until, blacklist_reason, pool, tenant, created_at, updated_at
+		FROM api_keys
+		%s
+		ORDER BY %s %s, id %s
+	`, where, column, order, order)
+
+	if opts.PerPage > 0 {
+		page := opts.Page
+		if page < 1 {
+			page = 1
+		}
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, opts.PerPage, (page-1)*opts.PerPage)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var keys []*APIKey
+	for rows.Next() {
+		var key APIKey
+		err := rows.Scan(
+			&key.ID, &key.KeyValue, &key.Name, &key.Description, &key.IsActive,
+			&key.IsBlacklisted, &key.BlacklistedUntil, &key.BlacklistReason,
+			&key.Pool, &key.Tenant, &key.CreatedAt, &key.UpdatedAt,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		keys = append(keys, &key)
+	}
+
+	return keys, total, rows.Err()
+}
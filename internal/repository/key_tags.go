@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// GetKeyTags returns the tags of a key in alphabetical order
+func (r *KeyRepository) GetKeyTags(ctx context.Context, keyID int64) ([]string, error) {
+	return keyTags(ctx, r.db, keyID)
+}
+
+// keyTags returns the tags of a key in alphabetical order
+func keyTags(ctx context.Context, q querier, keyID int64) ([]string, error) {
+	rows, err := q.QueryContext(ctx, "SELECT tag FROM key_tags WHERE key_id = ? ORDER BY tag", keyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []string{}
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
+
+// SetKeyTags replaces the tags of a key
+func (r *KeyRepository) SetKeyTags(ctx context.Context, keyID int64, tags []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	key, err := getKey(ctx, tx, "id", keyID)
+	if err != nil {
+		return err
+	}
+	before, err := keyTags(ctx, tx, keyID)
+	if err != nil {
+		return err
+	}
+	after := append([]string{}, tags...)
+	sort.Strings(after)
+	if slices.Equal(before, after) {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM key_tags WHERE key_id = ?", keyID); err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO key_tags (key_id, tag) VALUES (?, ?)", keyID, tag); err != nil {
+			return err
+		}
+	}
+
+	entry := newAuditEntry(ctx, AuditKeyTags, key, map[string][]string{"tags": before}, map[string][]string{"tags": after})
+	if err := addAuditEntry(ctx, tx, entry); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetTagsForKeys returns the tags of the given keys, indexed by key ID
+func (r *KeyRepository) GetTagsForKeys(ctx context.Context, keyIDs []int64) (map[int64][]string, error) {
+	tags := make(map[int64][]string)
+	if len(keyIDs) == 0 {
+		return tags, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(keyIDs)), ",")
+	args := make([]interface{}, len(keyIDs))
+	for i, id := range keyIDs {
+		args[i] = id
+	}
+
+	rows, err := r.db.QueryContext(ctx, "SELECT key_id, tag FROM key_tags WHERE key_id IN ("+placeholders+") ORDER BY tag", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var keyID int64
+		var tag string
+		if err := rows.Scan(&keyID, &tag); err != nil {
+			return nil, err
+		}
+		tags[keyID] = append(tags[keyID], tag)
+	}
+
+	return tags, rows.Err()
+}
+
+// GetAllKeyTags returns the tags of every tagged key, indexed by key value
+func (r *KeyRepository) GetAllKeyTags(ctx context.Context) (map[string][]string, error) {
+	query := `
+		SELECT k.key_value, t.tag
+		FROM key_tags t
+		JOIN api_keys k ON t.key_id = k.id
+		WHERE k.deleted_at IS NULL
+		ORDER BY t.tag
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make(map[string][]string)
+	for rows.Next() {
+		var keyValue, tag string
+		if err := rows.Scan(&keyValue, &tag); err != nil {
+			return nil, err
+		}
+		tags[keyValue] = append(tags[keyValue], tag)
+	}
+
+	return tags, rows.Err()
+}
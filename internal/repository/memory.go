@@ -0,0 +1,1194 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/pkg/types"
+)
+
+// memoryHour identifies one hourly usage rollup
+type memoryHour struct {
+	keyID     int64
+	endpoint  string
+	hourStart time.Time
+}
+
+// MemoryKeyRepository keeps the key database in process memory. It follows the
+// MySQL repository's behaviour, including sql.ErrNoRows for missing rows and the
+// duplicate errors, so the key manager and handlers can be unit-tested without
+// MySQL. Paired with cache.NewMemoryCache nothing external is needed.
+type MemoryKeyRepository struct {
+	mu sync.Mutex
+
+	nextID     int64
+	keys       map[int64]*APIKey
+	stats      map[int64]*KeyUsageStats
+	history    []*BlacklistHistory
+	tags       map[int64][]string
+	budgets    map[int64]KeyBudget
+	quarantine map[int64]*QuarantinedKey
+	tokens     map[int64]*AuthToken
+	hourly     map[memoryHour]*HourlyUsage
+	daily      map[memoryHour]*HourlyUsage // keyed by the start of the day
+	reports    map[int64]*UsageReport
+	requests   []*RequestLogEntry
+	audit      []*AuditEntry
+}
+
+var _ types.KeyRepository = (*MemoryKeyRepository)(nil)
+
+// NewMemoryKeyRepository creates an empty in-memory key database
+func NewMemoryKeyRepository() *MemoryKeyRepository {
+	return &MemoryKeyRepository{
+		keys:       make(map[int64]*APIKey),
+		stats:      make(map[int64]*KeyUsageStats),
+		tags:       make(map[int64][]string),
+		budgets:    make(map[int64]KeyBudget),
+		quarantine: make(map[int64]*QuarantinedKey),
+		tokens:     make(map[int64]*AuthToken),
+		hourly:     make(map[memoryHour]*HourlyUsage),
+		daily:      make(map[memoryHour]*HourlyUsage),
+		reports:    make(map[int64]*UsageReport),
+	}
+}
+
+// id hands out the next row ID; r.mu must be held
+func (r *MemoryKeyRepository) id() int64 {
+	r.nextID++
+	return r.nextID
+}
+
+// byValue finds a stored key by its value, skipping deleted keys; r.mu must be held
+func (r *MemoryKeyRepository) byValue(keyValue string) (*APIKey, bool) {
+	for _, key := range r.keys {
+		if key.KeyValue == keyValue && key.DeletedAt == nil {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// byID finds a stored key by its ID, skipping deleted keys; r.mu must be held
+func (r *MemoryKeyRepository) byID(id int64) (*APIKey, bool) {
+	key, ok := r.keys[id]
+	if !ok || key.DeletedAt != nil {
+		return nil, false
+	}
+	return key, true
+}
+
+// record adds an entry to the audit log; r.mu must be held
+func (r *MemoryKeyRepository) record(entry *AuditEntry) {
+	entry.ID = r.id()
+	r.audit = append(r.audit, entry)
+}
+
+// sortedKeys returns copies of the stored keys that match, oldest first; r.mu
+// must be held
+func (r *MemoryKeyRepository) sortedKeys(match func(*APIKey) bool) []*APIKey {
+	keys := []*APIKey{}
+	for _, key := range r.keys {
+		if key.DeletedAt == nil && match(key) {
+			copied := *key
+			keys = append(keys, &copied)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+	return keys
+}
+
+// Ping always succeeds
+func (r *MemoryKeyRepository) Ping(ctx context.Context) error {
+	return nil
+}
+
+// PoolStats returns nil, since there is no connection pool
+func (r *MemoryKeyRepository) PoolStats() *types.PoolStats {
+	return nil
+}
+
+func (r *MemoryKeyRepository) CreateKey(ctx context.Context, keyValue, name, description, tenant, pool string, tags []string) (*APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.byValue(keyValue); exists {
+		return nil, ErrDuplicateKey
+	}
+	now := time.Now()
+	key := &APIKey{
+		ID:          r.id(),
+		KeyValue:    keyValue,
+		Name:        name,
+		Description: description,
+		IsActive:    true,
+		Pool:        pool,
+		Tenant:      tenant,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if key.Pool == "" {
+		key.Pool = DefaultPool
+	}
+	r.keys[key.ID] = key
+	r.record(newAuditEntry(ctx, AuditKeyCreate, key, nil, keyState(key)))
+	if len(tags) > 0 {
+		sorted := append([]string{}, tags...)
+		sort.Strings(sorted)
+		r.tags[key.ID] = sorted
+		r.record(newAuditEntry(ctx, AuditKeyTags, key, map[string][]string{"tags": {}}, map[string][]string{"tags": sorted}))
+	}
+
+	copied := *key
+	return &copied, nil
+}
+
+func (r *MemoryKeyRepository) KeyExists(ctx context.Context, keyValue string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, exists := r.byValue(keyValue)
+	return exists, nil
+}
+
+func (r *MemoryKeyRepository) GetKeyByID(ctx context.Context, id int64) (*APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.byID(id)
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *key
+	return &copied, nil
+}
+
+func (r *MemoryKeyRepository) GetKeyByValue(ctx context.Context, keyValue string) (*APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.byValue(keyValue)
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *key
+	return &copied, nil
+}
+
+func (r *MemoryKeyRepository) GetKeysByName(ctx context.Context, name string) ([]*APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys := r.sortedKeys(func(key *APIKey) bool { return key.Name == name })
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, nil
+}
+
+func (r *MemoryKeyRepository) GetAllActiveKeys(ctx context.Context) ([]*APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	return r.sortedKeys(func(key *APIKey) bool {
+		return key.IsActive && (!key.IsBlacklisted || (key.BlacklistedUntil != nil && key.BlacklistedUntil.Before(now)))
+	}), nil
+}
+
+func (r *MemoryKeyRepository) GetAllKeys(ctx context.Context) ([]*APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.sortedKeys(func(*APIKey) bool { return true }), nil
+}
+
+func (r *MemoryKeyRepository) ListKeys(ctx context.Context, opts KeyListOptions) ([]*APIKey, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys := r.sortedKeys(func(key *APIKey) bool {
+		switch opts.Status {
+		case "active":
+			if !key.IsActive || key.IsBlacklisted {
+				return false
+			}
+		case "inactive":
+			if key.IsActive {
+				return false
+			}
+		case "blacklisted":
+			if !key.IsBlacklisted {
+				return false
+			}
+		}
+		if opts.Pool != "" && key.Pool != opts.Pool {
+			return false
+		}
+		if opts.Tenant != "" && key.Tenant != opts.Tenant {
+			return false
+		}
+		return opts.Tag == "" || contains(r.tags[key.ID], opts.Tag)
+	})
+
+	less := func(a, b *APIKey) bool {
+		switch opts.Sort {
+		case "updated_at":
+			if !a.UpdatedAt.Equal(b.UpdatedAt) {
+				return a.UpdatedAt.Before(b.UpdatedAt)
+			}
+		case "name":
+			if a.Name != b.Name {
+				return a.Name < b.Name
+			}
+		case "id":
+		default:
+			if !a.CreatedAt.Equal(b.CreatedAt) {
+				return a.CreatedAt.Before(b.CreatedAt)
+			}
+		}
+		return a.ID < b.ID
+	}
+	desc := strings.EqualFold(opts.Order, "desc")
+	sort.SliceStable(keys, func(i, j int) bool {
+		if desc {
+			return less(keys[j], keys[i])
+		}
+		return less(keys[i], keys[j])
+	})
+
+	total := len(keys)
+	if opts.PerPage > 0 {
+		page := opts.Page
+		if page < 1 {
+			page = 1
+		}
+		start := (page - 1) * opts.PerPage
+		if start > total {
+			start = total
+		}
+		end := start + opts.PerPage
+		if end > total {
+			end = total
+		}
+		keys = keys[start:end]
+	}
+	return keys, total, nil
+}
+
+func (r *MemoryKeyRepository) UpdateKey(ctx context.Context, id int64, name, description, pool string, isActive bool) (*APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.byID(id)
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	before := keyState(key)
+	key.Name, key.Description, key.Pool, key.IsActive = name, description, pool, isActive
+	key.UpdatedAt = time.Now()
+	r.record(newAuditEntry(ctx, AuditKeyUpdate, key, before, keyState(key)))
+
+	copied := *key
+	return &copied, nil
+}
+
+// DeleteKey soft-deletes a key as in MySQL: it is no longer returned, but its
+// usage, blacklist history and audit trail are kept
+func (r *MemoryKeyRepository) DeleteKey(ctx context.Context, keyValue string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.byValue(keyValue)
+	if !ok {
+		return nil
+	}
+	before := keyState(key)
+	now := time.Now()
+	key.DeletedAt, key.IsActive, key.UpdatedAt = &now, false, now
+	r.record(newAuditEntry(ctx, AuditKeyDelete, key, before, nil))
+	return nil
+}
+
+func (r *MemoryKeyRepository) PurgeDeletedKey(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.keys[id]
+	if !ok || key.DeletedAt == nil {
+		return sql.ErrNoRows
+	}
+
+	delete(r.keys, id)
+	delete(r.stats, id)
+	delete(r.tags, id)
+	delete(r.budgets, id)
+	delete(r.quarantine, id)
+	history := r.history[:0]
+	for _, entry := range r.history {
+		if entry.KeyID != id {
+			history = append(history, entry)
+		}
+	}
+	r.history = history
+	for hour := range r.hourly {
+		if hour.keyID == id {
+			delete(r.hourly, hour)
+		}
+	}
+	for day := range r.daily {
+		if day.keyID == id {
+			delete(r.daily, day)
+		}
+	}
+	requests := r.requests[:0]
+	for _, entry := range r.requests {
+		if entry.KeyID != id {
+			requests = append(requests, entry)
+		}
+	}
+	r.requests = requests
+	r.record(newAuditEntry(ctx, AuditKeyPurge, key, keyState(key), nil))
+	return nil
+}
+
+func (r *MemoryKeyRepository) BlacklistKey(ctx context.Context, keyValue, reason string, permanent bool, until *time.Time, strikes int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.byValue(keyValue)
+	if !ok {
+		return sql.ErrNoRows
+	}
+	now := time.Now()
+	before := keyState(key)
+	key.IsBlacklisted, key.BlacklistedUntil, key.BlacklistReason = true, until, reason
+	key.UpdatedAt = now
+	r.record(newAuditEntry(ctx, AuditKeyBlacklist, key, before, keyState(key)))
+
+	var durationSeconds *int64
+	if until != nil {
+		seconds := int64(time.Until(*until).Round(time.Second) / time.Second)
+		durationSeconds = &seconds
+	}
+	r.history = append(r.history, &BlacklistHistory{
+		ID:               r.id(),
+		KeyID:            key.ID,
+		BlacklistedAt:    now,
+		BlacklistedUntil: until,
+		Reason:           reason,
+		IsPermanent:      permanent,
+		StrikeCount:      strikes,
+		DurationSeconds:  durationSeconds,
+	})
+	return nil
+}
+
+func (r *MemoryKeyRepository) UnblacklistKey(ctx context.Context, keyValue string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if key, ok := r.byValue(keyValue); ok && key.IsBlacklisted {
+		before := keyState(key)
+		key.IsBlacklisted, key.BlacklistedUntil, key.BlacklistReason = false, nil, ""
+		key.UpdatedAt = time.Now()
+		r.record(newAuditEntry(ctx, AuditKeyUnblacklist, key, before, keyState(key)))
+	}
+	return nil
+}
+
+func (r *MemoryKeyRepository) GetBlacklistHistory(ctx context.Context, keyValue string) ([]*BlacklistHistory, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.byValue(keyValue)
+	if !ok {
+		return nil, nil
+	}
+	var history []*BlacklistHistory
+	for i := len(r.history) - 1; i >= 0; i-- {
+		if r.history[i].KeyID == key.ID {
+			entry := *r.history[i]
+			history = append(history, &entry)
+		}
+	}
+	return history, nil
+}
+
+func (r *MemoryKeyRepository) ListBlacklistHistory(ctx context.Context, opts BlacklistHistoryOptions) ([]*BlacklistHistory, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	history := []*BlacklistHistory{}
+	for i := len(r.history) - 1; i >= 0; i-- {
+		entry := *r.history[i]
+		key := r.keys[entry.KeyID]
+		if entry.BlacklistedAt.Before(opts.From) || !entry.BlacklistedAt.Before(opts.To) {
+			continue
+		}
+		if opts.Tenant != "" && key.Tenant != opts.Tenant {
+			continue
+		}
+		entry.KeyValue, entry.KeyName = key.KeyValue, key.Name
+		history = append(history, &entry)
+	}
+	return history, nil
+}
+
+func (r *MemoryKeyRepository) UpdateKeyUsage(ctx context.Context, keyValue string, requestsIncrement, errorsIncrement int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.byValue(keyValue)
+	if !ok {
+		return sql.ErrNoRows
+	}
+	now := time.Now()
+	stats, ok := r.stats[key.ID]
+	if !ok {
+		stats = &KeyUsageStats{ID: r.id(), KeyID: key.ID, CreatedAt: now}
+		r.stats[key.ID] = stats
+	}
+	stats.RequestsCount += requestsIncrement
+	stats.ErrorsCount += errorsIncrement
+	if requestsIncrement > 0 {
+		stats.LastUsedAt = &now
+	}
+	if errorsIncrement > 0 {
+		stats.LastErrorAt = &now
+	}
+	stats.UpdatedAt = now
+	return nil
+}
+
+func (r *MemoryKeyRepository) GetKeyStats(ctx context.Context, keyValue string) (*KeyUsageStats, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.byValue(keyValue)
+	if !ok {
+		return &KeyUsageStats{}, nil
+	}
+	stats, ok := r.stats[key.ID]
+	if !ok {
+		return &KeyUsageStats{}, nil
+	}
+	copied := *stats
+	return &copied, nil
+}
+
+func (r *MemoryKeyRepository) GetKeyTags(ctx context.Context, keyID int64) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string{}, r.tags[keyID]...), nil
+}
+
+func (r *MemoryKeyRepository) SetKeyTags(ctx context.Context, keyID int64, tags []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.byID(keyID)
+	if !ok {
+		return sql.ErrNoRows
+	}
+	before := append([]string{}, r.tags[keyID]...)
+	sorted := append([]string{}, tags...)
+	sort.Strings(sorted)
+	if slices.Equal(before, sorted) {
+		return nil
+	}
+
+	if len(sorted) == 0 {
+		delete(r.tags, keyID)
+	} else {
+		r.tags[keyID] = sorted
+	}
+	r.record(newAuditEntry(ctx, AuditKeyTags, key, map[string][]string{"tags": before}, map[string][]string{"tags": sorted}))
+	return nil
+}
+
+func (r *MemoryKeyRepository) GetTagsForKeys(ctx context.Context, keyIDs []int64) (map[int64][]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tags := make(map[int64][]string)
+	for _, id := range keyIDs {
+		if keyTags, ok := r.tags[id]; ok {
+			tags[id] = append([]string{}, keyTags...)
+		}
+	}
+	return tags, nil
+}
+
+func (r *MemoryKeyRepository) GetAllKeyTags(ctx context.Context) (map[string][]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tags := make(map[string][]string)
+	for id, keyTags := range r.tags {
+		if key, ok := r.byID(id); ok {
+			tags[key.KeyValue] = append([]string{}, keyTags...)
+		}
+	}
+	return tags, nil
+}
+
+func (r *MemoryKeyRepository) GetKeyBudget(ctx context.Context, keyID int64) (KeyBudget, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.budgets[keyID], nil
+}
+
+func (r *MemoryKeyRepository) SetKeyBudget(ctx context.Context, keyID int64, budget KeyBudget) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.byID(keyID)
+	if !ok {
+		return sql.ErrNoRows
+	}
+	before := r.budgets[keyID]
+	if before == budget {
+		return nil
+	}
+
+	if budget.IsZero() {
+		delete(r.budgets, keyID)
+	} else {
+		r.budgets[keyID] = budget
+	}
+	r.record(newAuditEntry(ctx, AuditKeyBudget, key, before, budget))
+	return nil
+}
+
+func (r *MemoryKeyRepository) GetAllKeyBudgets(ctx context.Context) (map[string]KeyBudget, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	budgets := make(map[string]KeyBudget)
+	for id, budget := range r.budgets {
+		if key, ok := r.byID(id); ok {
+			budgets[key.KeyValue] = budget
+		}
+	}
+	return budgets, nil
+}
+
+func (r *MemoryKeyRepository) QuarantineKey(ctx context.Context, keyValue, reason, details string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if key, ok := r.byValue(keyValue); ok {
+		var before *quarantineRecord
+		if previous, ok := r.quarantine[key.ID]; ok {
+			before = &quarantineRecord{Reason: previous.Reason, Details: previous.Details}
+		}
+		r.quarantine[key.ID] = &QuarantinedKey{KeyID: key.ID, Reason: reason, Details: details, QuarantinedAt: time.Now()}
+		r.record(newAuditEntry(ctx, AuditKeyQuarantine, key, before, &quarantineRecord{Reason: reason, Details: details}))
+	}
+	return nil
+}
+
+func (r *MemoryKeyRepository) ReleaseQuarantine(ctx context.Context, keyValue string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.byValue(keyValue)
+	if !ok {
+		return nil
+	}
+	if previous, ok := r.quarantine[key.ID]; ok {
+		delete(r.quarantine, key.ID)
+		r.record(newAuditEntry(ctx, AuditKeyRelease, key, &quarantineRecord{Reason: previous.Reason, Details: previous.Details}, nil))
+	}
+	return nil
+}
+
+func (r *MemoryKeyRepository) GetQuarantinedKeys(ctx context.Context) ([]*QuarantinedKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys := []*QuarantinedKey{}
+	for id, entry := range r.quarantine {
+		key, ok := r.byID(id)
+		if !ok {
+			continue
+		}
+		quarantined := *entry
+		quarantined.KeyValue, quarantined.Name, quarantined.Pool, quarantined.Tenant = key.KeyValue, key.Name, key.Pool, key.Tenant
+		keys = append(keys, &quarantined)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].QuarantinedAt.After(keys[j].QuarantinedAt) })
+	return keys, nil
+}
+
+// tokenNameTaken reports whether another token uses name; r.mu must be held
+func (r *MemoryKeyRepository) tokenNameTaken(name string, id int64) bool {
+	for _, token := range r.tokens {
+		if token.Name == name && token.ID != id {
+			return true
+		}
+	}
+	return false
+}
+
+// copyToken returns a copy of a stored token that does not share its lists
+func copyToken(token *AuthToken) *AuthToken {
+	copied := *token
+	copied.AllowedEndpoints = append([]string{}, token.AllowedEndpoints...)
+	copied.Scopes = append([]string{}, token.Scopes...)
+	return &copied
+}
+
+func (r *MemoryKeyRepository) CreateAuthToken(ctx context.Context, token *AuthToken) (*AuthToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.tokenNameTaken(token.Name, 0) {
+		return nil, ErrDuplicateToken
+	}
+	stored := copyToken(token)
+	stored.ID = r.id()
+	stored.CreatedAt = time.Now()
+	stored.UpdatedAt = stored.CreatedAt
+	r.tokens[stored.ID] = stored
+	return copyToken(stored), nil
+}
+
+func (r *MemoryKeyRepository) GetAuthTokenByID(ctx context.Context, id int64) (*AuthToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.tokens[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return copyToken(token), nil
+}
+
+func (r *MemoryKeyRepository) GetAuthTokenByHash(ctx context.Context, tokenHash string) (*AuthToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, token := range r.tokens {
+		if token.TokenHash == tokenHash {
+			return copyToken(token), nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r *MemoryKeyRepository) ListAuthTokens(ctx context.Context, tenant string) ([]*AuthToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tokens := []*AuthToken{}
+	for _, token := range r.tokens {
+		if tenant == "" || token.Tenant == tenant {
+			tokens = append(tokens, copyToken(token))
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].Name < tokens[j].Name })
+	return tokens, nil
+}
+
+func (r *MemoryKeyRepository) UpdateAuthToken(ctx context.Context, token *AuthToken) (*AuthToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.tokens[token.ID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if r.tokenNameTaken(token.Name, token.ID) {
+		return nil, ErrDuplicateToken
+	}
+	stored.Name, stored.RateLimitRPM, stored.DailyCreditQuota = token.Name, token.RateLimitRPM, token.DailyCreditQuota
+	stored.AllowedEndpoints = append([]string{}, token.AllowedEndpoints...)
+	stored.Scopes = append([]string{}, token.Scopes...)
+	stored.Tenant, stored.IsActive = token.Tenant, token.IsActive
+	stored.UpdatedAt = time.Now()
+	return copyToken(stored), nil
+}
+
+func (r *MemoryKeyRepository) DeleteAuthToken(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.tokens[id]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(r.tokens, id)
+	return nil
+}
+
+func (r *MemoryKeyRepository) ListTenants(ctx context.Context) ([]*TenantSummary, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	byName := make(map[string]*TenantSummary)
+	summary := func(name string) *TenantSummary {
+		if _, ok := byName[name]; !ok {
+			byName[name] = &TenantSummary{Name: name}
+		}
+		return byName[name]
+	}
+	for _, key := range r.keys {
+		if key.DeletedAt == nil {
+			summary(key.Tenant).KeyCount++
+		}
+	}
+	for _, token := range r.tokens {
+		summary(token.Tenant).TokenCount++
+	}
+
+	tenants := make([]*TenantSummary, 0, len(byName))
+	for _, tenant := range byName {
+		tenants = append(tenants, tenant)
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].Name < tenants[j].Name })
+	return tenants, nil
+}
+
+func (r *MemoryKeyRepository) AddHourlyUsage(ctx context.Context, usage []HourlyUsage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, u := range usage {
+		key, ok := r.byValue(u.KeyValue)
+		if !ok {
+			continue
+		}
+		hour := memoryHour{keyID: key.ID, endpoint: u.Endpoint, hourStart: u.HourStart.Truncate(time.Hour)}
+		rollup, ok := r.hourly[hour]
+		if !ok {
+			rollup = &HourlyUsage{KeyValue: key.KeyValue, Endpoint: u.Endpoint, HourStart: hour.hourStart}
+			r.hourly[hour] = rollup
+		}
+		rollup.RequestsCount += u.RequestsCount
+		rollup.ErrorsCount += u.ErrorsCount
+		rollup.LatencyMsTotal += u.LatencyMsTotal
+	}
+	return nil
+}
+
+// rollupsBetween returns the hourly rollups from (inclusive) to to (exclusive);
+// r.mu must be held
+func (r *MemoryKeyRepository) rollupsBetween(from, to time.Time) map[memoryHour]*HourlyUsage {
+	rollups := make(map[memoryHour]*HourlyUsage)
+	for hour, rollup := range r.hourly {
+		if !hour.hourStart.Before(from) && hour.hourStart.Before(to) {
+			rollups[hour] = rollup
+		}
+	}
+	return rollups
+}
+
+// startOfDay returns midnight of t's day in t's location
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+// latestDay returns the day of the latest daily rollup; r.mu must be held
+func (r *MemoryKeyRepository) latestDay() (time.Time, bool) {
+	var latest time.Time
+	for day := range r.daily {
+		if day.hourStart.After(latest) {
+			latest = day.hourStart
+		}
+	}
+	return latest, !latest.IsZero()
+}
+
+func (r *MemoryKeyRepository) RollupDailyUsage(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	since, ok := r.latestDay()
+	if ok {
+		since = since.AddDate(0, 0, -1)
+	} else {
+		for hour := range r.hourly {
+			if since.IsZero() || hour.hourStart.Before(since) {
+				since = hour.hourStart
+			}
+		}
+	}
+	since = startOfDay(since)
+
+	for day := range r.daily {
+		if !day.hourStart.Before(since) {
+			delete(r.daily, day)
+		}
+	}
+	for hour, rollup := range r.hourly {
+		if hour.hourStart.Before(since) {
+			continue
+		}
+		day := memoryHour{keyID: hour.keyID, endpoint: hour.endpoint, hourStart: startOfDay(hour.hourStart)}
+		total, ok := r.daily[day]
+		if !ok {
+			total = &HourlyUsage{KeyValue: rollup.KeyValue, Endpoint: hour.endpoint, HourStart: day.hourStart}
+			r.daily[day] = total
+		}
+		total.RequestsCount += rollup.RequestsCount
+		total.ErrorsCount += rollup.ErrorsCount
+		total.LatencyMsTotal += rollup.LatencyMsTotal
+	}
+	return nil
+}
+
+func (r *MemoryKeyRepository) PruneHourlyUsage(ctx context.Context, before time.Time, limit int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var pruned int64
+	for hour := range r.hourly {
+		if pruned == int64(limit) {
+			break
+		}
+		if hour.hourStart.Before(before) {
+			delete(r.hourly, hour)
+			pruned++
+		}
+	}
+	return pruned, nil
+}
+
+func (r *MemoryKeyRepository) GetUsageTimeseries(ctx context.Context, opts TimeseriesOptions) ([]*TimeseriesPoint, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	buckets := make(map[time.Time]*TimeseriesPoint)
+	latency := make(map[time.Time]int64)
+	add := func(id memoryHour, rollup *HourlyUsage, bucket time.Time) {
+		if opts.KeyID != 0 && id.keyID != opts.KeyID {
+			return
+		}
+		if opts.Endpoint != "" && id.endpoint != opts.Endpoint {
+			return
+		}
+		if opts.Tenant != "" && r.keys[id.keyID].Tenant != opts.Tenant {
+			return
+		}
+
+		point, ok := buckets[bucket]
+		if !ok {
+			point = &TimeseriesPoint{Time: bucket}
+			buckets[bucket] = point
+		}
+		point.RequestsCount += rollup.RequestsCount
+		point.ErrorsCount += rollup.ErrorsCount
+		latency[bucket] += rollup.LatencyMsTotal
+	}
+
+	if opts.Resolution == ResolutionDay {
+		// As in MySQL, days before the latest daily rollup come from the daily
+		// rollups and later ones from the hourly rollups
+		from := startOfDay(opts.From)
+		split, ok := r.latestDay()
+		if ok {
+			for day, rollup := range r.daily {
+				if !day.hourStart.Before(from) && day.hourStart.Before(opts.To) && day.hourStart.Before(split) {
+					add(day, rollup, day.hourStart)
+				}
+			}
+			from = maxTime(from, split)
+		}
+		for hour, rollup := range r.rollupsBetween(from, opts.To) {
+			add(hour, rollup, startOfDay(hour.hourStart))
+		}
+	} else {
+		for hour, rollup := range r.rollupsBetween(opts.From, opts.To) {
+			add(hour, rollup, hour.hourStart)
+		}
+	}
+
+	points := make([]*TimeseriesPoint, 0, len(buckets))
+	for bucket, point := range buckets {
+		if point.RequestsCount > 0 {
+			point.AverageLatency = latency[bucket] / point.RequestsCount
+		}
+		points = append(points, point)
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+	return points, nil
+}
+
+// maxTime returns the later of a and b
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func (r *MemoryKeyRepository) CreateUsageReport(ctx context.Context, report *UsageReport) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, stored := range r.reports {
+		if stored.Period == report.Period && stored.PeriodStart.Equal(report.PeriodStart) {
+			return 0, ErrDuplicateReport
+		}
+	}
+	stored := *report
+	stored.ID = r.id()
+	stored.CreatedAt = time.Now()
+	r.reports[stored.ID] = &stored
+	return stored.ID, nil
+}
+
+func (r *MemoryKeyRepository) UsageReportExists(ctx context.Context, period string, start time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, report := range r.reports {
+		if report.Period == period && report.PeriodStart.Equal(start) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *MemoryKeyRepository) ListUsageReports(ctx context.Context, period string, limit int) ([]*UsageReport, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reports := []*UsageReport{}
+	for _, report := range r.reports {
+		if period == "" || report.Period == period {
+			listed := *report
+			listed.Body = nil
+			reports = append(reports, &listed)
+		}
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		if !reports[i].PeriodStart.Equal(reports[j].PeriodStart) {
+			return reports[i].PeriodStart.After(reports[j].PeriodStart)
+		}
+		return reports[i].ID > reports[j].ID
+	})
+	if len(reports) > limit {
+		reports = reports[:limit]
+	}
+	return reports, nil
+}
+
+func (r *MemoryKeyRepository) GetUsageReport(ctx context.Context, id int64) (*UsageReport, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report, ok := r.reports[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *report
+	return &copied, nil
+}
+
+func (r *MemoryKeyRepository) GetTopKeysByUsage(ctx context.Context, from, to time.Time, limit int) ([]*KeyUsageTotal, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	byKey := make(map[int64]*KeyUsageTotal)
+	for hour, rollup := range r.rollupsBetween(from, to) {
+		total, ok := byKey[hour.keyID]
+		if !ok {
+			key := r.keys[hour.keyID]
+			total = &KeyUsageTotal{KeyID: key.ID, KeyValue: key.KeyValue, Name: key.Name}
+			byKey[hour.keyID] = total
+		}
+		total.RequestsCount += rollup.RequestsCount
+		total.ErrorsCount += rollup.ErrorsCount
+	}
+
+	totals := make([]*KeyUsageTotal, 0, len(byKey))
+	for _, total := range byKey {
+		totals = append(totals, total)
+	}
+	sort.Slice(totals, func(i, j int) bool { return totals[i].RequestsCount > totals[j].RequestsCount })
+	if len(totals) > limit {
+		totals = totals[:limit]
+	}
+	return totals, nil
+}
+
+func (r *MemoryKeyRepository) GetUsageByEndpoint(ctx context.Context, from, to time.Time) ([]*EndpointUsageTotal, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	byEndpoint := make(map[string]*EndpointUsageTotal)
+	for hour, rollup := range r.rollupsBetween(from, to) {
+		total, ok := byEndpoint[hour.endpoint]
+		if !ok {
+			total = &EndpointUsageTotal{Endpoint: hour.endpoint}
+			byEndpoint[hour.endpoint] = total
+		}
+		total.RequestsCount += rollup.RequestsCount
+		total.ErrorsCount += rollup.ErrorsCount
+	}
+
+	totals := make([]*EndpointUsageTotal, 0, len(byEndpoint))
+	for _, total := range byEndpoint {
+		totals = append(totals, total)
+	}
+	sort.Slice(totals, func(i, j int) bool { return totals[i].Endpoint < totals[j].Endpoint })
+	return totals, nil
+}
+
+func (r *MemoryKeyRepository) GetBlacklistEvents(ctx context.Context, from, to time.Time) ([]*BlacklistEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	events := []*BlacklistEvent{}
+	for _, entry := range r.history {
+		if entry.BlacklistedAt.Before(from) || !entry.BlacklistedAt.Before(to) {
+			continue
+		}
+		events = append(events, &BlacklistEvent{
+			KeyID:         entry.KeyID,
+			KeyValue:      r.keys[entry.KeyID].KeyValue,
+			BlacklistedAt: entry.BlacklistedAt,
+			Reason:        entry.Reason,
+			IsPermanent:   entry.IsPermanent,
+		})
+	}
+	return events, nil
+}
+
+func (r *MemoryKeyRepository) AddRequestLog(ctx context.Context, entries []RequestLogEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, e := range entries {
+		stored := e
+		stored.ID = r.id()
+		stored.KeyID = 0
+		if key, ok := r.byValue(e.KeyValue); ok && e.KeyValue != "" {
+			stored.KeyID = key.ID
+		}
+		stored.KeyValue = ""
+		r.requests = append(r.requests, &stored)
+	}
+	return nil
+}
+
+func (r *MemoryKeyRepository) ListRequestLog(ctx context.Context, opts RequestLogOptions) ([]*RequestLogEntry, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entries := []*RequestLogEntry{}
+	for _, e := range r.requests {
+		if !opts.From.IsZero() && e.CreatedAt.Before(opts.From) {
+			continue
+		}
+		if !opts.To.IsZero() && !e.CreatedAt.Before(opts.To) {
+			continue
+		}
+		if (opts.KeyID != 0 && e.KeyID != opts.KeyID) || (opts.Endpoint != "" && e.Endpoint != opts.Endpoint) {
+			continue
+		}
+		if (opts.StatusCode != 0 && e.StatusCode != opts.StatusCode) || (opts.Tenant != "" && e.Tenant != opts.Tenant) {
+			continue
+		}
+		listed := *e
+		entries = append(entries, &listed)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].CreatedAt.Equal(entries[j].CreatedAt) {
+			return entries[i].CreatedAt.After(entries[j].CreatedAt)
+		}
+		return entries[i].ID > entries[j].ID
+	})
+
+	total := len(entries)
+	if opts.PerPage > 0 {
+		start := min((max(opts.Page, 1)-1)*opts.PerPage, total)
+		entries = entries[start:min(start+opts.PerPage, total)]
+	}
+	return entries, total, nil
+}
+
+func (r *MemoryKeyRepository) PurgeRequestLog(ctx context.Context, before time.Time, limit int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var purged int64
+	kept := r.requests[:0]
+	for _, e := range r.requests {
+		if e.CreatedAt.Before(before) && purged < int64(limit) {
+			purged++
+			continue
+		}
+		kept = append(kept, e)
+	}
+	r.requests = kept
+	return purged, nil
+}
+
+// contains reports whether values holds value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *MemoryKeyRepository) AddAuditEntry(ctx context.Context, entry *AuditEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored := *entry
+	r.record(&stored)
+	return nil
+}
+
+func (r *MemoryKeyRepository) ListAuditLog(ctx context.Context, opts AuditLogOptions) ([]*AuditEntry, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entries := []*AuditEntry{}
+	for _, e := range r.audit {
+		if !opts.From.IsZero() && e.CreatedAt.Before(opts.From) {
+			continue
+		}
+		if !opts.To.IsZero() && !e.CreatedAt.Before(opts.To) {
+			continue
+		}
+		if (opts.Actor != "" && e.Actor != opts.Actor) || (opts.Action != "" && e.Action != opts.Action) {
+			continue
+		}
+		if (opts.KeyID != 0 && e.KeyID != opts.KeyID) || (opts.Tenant != "" && e.Tenant != opts.Tenant) {
+			continue
+		}
+		listed := *e
+		entries = append(entries, &listed)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].CreatedAt.Equal(entries[j].CreatedAt) {
+			return entries[i].CreatedAt.After(entries[j].CreatedAt)
+		}
+		return entries[i].ID > entries[j].ID
+	})
+
+	total := len(entries)
+	if opts.PerPage > 0 {
+		start := min((max(opts.Page, 1)-1)*opts.PerPage, total)
+		entries = entries[start:min(start+opts.PerPage, total)]
+	}
+	return entries, total, nil
+}
@@ -0,0 +1,28 @@
+package repository
+
+import "github.com/dbccccccc/tavily-load/pkg/types"
+
+// The models live in pkg/types so the KeyRepository interface there can name
+// them; the aliases keep them usable as repository types.
+type (
+	APIKey                  = types.APIKey
+	KeyUsageStats           = types.KeyUsageStats
+	BlacklistHistory        = types.BlacklistHistory
+	BlacklistHistoryOptions = types.BlacklistHistoryOptions
+	KeyListOptions          = types.KeyListOptions
+	AuthToken               = types.AuthToken
+	KeyBudget               = types.KeyBudget
+	QuarantinedKey          = types.QuarantinedKey
+	UsageReport             = types.UsageReport
+	KeyUsageTotal           = types.KeyUsageTotal
+	EndpointUsageTotal      = types.EndpointUsageTotal
+	BlacklistEvent          = types.BlacklistEvent
+	TenantSummary           = types.TenantSummary
+	HourlyUsage             = types.HourlyUsage
+	TimeseriesOptions       = types.TimeseriesOptions
+	TimeseriesPoint         = types.TimeseriesPoint
+	RequestLogEntry         = types.RequestLogEntry
+	RequestLogOptions       = types.RequestLogOptions
+	AuditEntry              = types.AuditEntry
+	AuditLogOptions         = types.AuditLogOptions
+)
@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/database"
+)
+
+// ErrDuplicateReport is returned when a report for the same period already exists
+var ErrDuplicateReport = errors.New("report already exists")
+
+// CreateUsageReport stores a report, returning ErrDuplicateReport if one already
+// covers the period
+func (r *KeyRepository) CreateUsageReport(ctx context.Context, report *UsageReport) (int64, error) {
+	query := `
+		INSERT INTO usage_reports (period, period_start, period_end, body)
+		VALUES (?, ?, ?, ?)
+	`
+
+	result, err := r.db.ExecContext(ctx, query, report.Period, report.PeriodStart, report.PeriodEnd, string(report.Body))
+	if err != nil {
+		if database.IsDuplicate(err) {
+			return 0, ErrDuplicateReport
+		}
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// UsageReportExists reports whether a report covers the period starting at start
+func (r *KeyRepository) UsageReportExists(ctx context.Context, period string, start time.Time) (bool, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx,
+		"SELECT EXISTS(SELECT 1 FROM usage_reports WHERE period = ? AND period_start = ?)", period, start).Scan(&exists)
+	return exists, err
+}
+
+// ListUsageReports returns the newest reports without their bodies, optionally
+// only those of one period
+func (r *KeyRepository) ListUsageReports(ctx context.Context, period string, limit int) ([]*UsageReport, error) {
+	query := "SELECT id, period, period_start, period_end, created_at FROM usage_reports"
+	args := []interface{}{}
+	if period != "" {
+		query += " WHERE period = ?"
+		args = append(args, period)
+	}
+	query += " ORDER BY period_start DESC, id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []*UsageReport{}
+	for rows.Next() {
+		var report UsageReport
+		if err := rows.Scan(&report.ID, &report.Period, &report.PeriodStart, &report.PeriodEnd, &report.CreatedAt); err != nil {
+			return nil, err
+		}
+		reports = append(reports, &report)
+	}
+
+	return reports, rows.Err()
+}
+
+// GetUsageReport returns a stored report with its body, or sql.ErrNoRows
+func (r *KeyRepository) GetUsageReport(ctx context.Context, id int64) (*UsageReport, error) {
+	query := "SELECT id, period, period_start, period_end, created_at, body FROM usage_reports WHERE id = ?"
+
+	var report UsageReport
+	var body string
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&report.ID, &report.Period, &report.PeriodStart, &report.PeriodEnd, &report.CreatedAt, &body,
+	)
+	if err != nil {
+		return nil, err
+	}
+	report.Body = json.RawMessage(body)
+	return &report, nil
+}
+
+// GetTopKeysByUsage returns the keys with the most requests between from and to
+// according to the hourly rollups
+func (r *KeyRepository) GetTopKeysByUsage(ctx context.Context, from, to time.Time, limit int) ([]*KeyUsageTotal, error) {
+	query := `
+		SELECT k.id, k.key_value, COALESCE(k.name, ''), SUM(h.requests_count), SUM(h.errors_count)
+		FROM key_usage_hourly h
+		JOIN api_keys k ON h.key_id = k.id
+		WHERE h.hour_start >= ? AND h.hour_start < ?
+		GROUP BY k.id, k.key_value, k.name
+		ORDER BY SUM(h.requests_count) DESC
+		LIMIT ?
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	totals := []*KeyUsageTotal{}
+	for rows.Next() {
+		var total KeyUsageTotal
+		if err := rows.Scan(&total.KeyID, &total.KeyValue, &total.Name, &total.RequestsCount, &total.ErrorsCount); err != nil {
+			return nil, err
+		}
+		totals = append(totals, &total)
+	}
+
+	return totals, rows.Err()
+}
+
+// GetUsageByEndpoint returns the usage of each endpoint between from and to
+// according to the hourly rollups
+func (r *KeyRepository) GetUsageByEndpoint(ctx context.Context, from, to time.Time) ([]*EndpointUsageTotal, error) {
+	query := `
+		SELECT endpoint, SUM(requests_count), SUM(errors_count)
+		FROM key_usage_hourly
+		WHERE hour_start >= ? AND hour_start < ?
+		GROUP BY endpoint
+		ORDER BY endpoint
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	totals := []*EndpointUsageTotal{}
+	for rows.Next() {
+		var total EndpointUsageTotal
+		if err := rows.Scan(&total.Endpoint, &total.RequestsCount, &total.ErrorsCount); err != nil {
+			return nil, err
+		}
+		totals = append(totals, &total)
+	}
+
+	return totals, rows.Err()
+}
+
+// GetBlacklistEvents returns the blacklistings between from and to, oldest first
+func (r *KeyRepository) GetBlacklistEvents(ctx context.Context, from, to time.Time) ([]*BlacklistEvent, error) {
+	query := `
+		SELECT h.key_id, k.key_value, h.blacklisted_at, COALESCE(h.reason, ''), h.is_permanent
+		FROM key_blacklist_history h
+		JOIN api_keys k ON h.key_id = k.id
+		WHERE h.blacklisted_at >= ? AND h.blacklisted_at < ?
+		ORDER BY h.blacklisted_at
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*BlacklistEvent{}
+	for rows.Next() {
+		var event BlacklistEvent
+		if err := rows.Scan(&event.KeyID, &event.KeyValue, &event.BlacklistedAt, &event.Reason, &event.IsPermanent); err != nil {
+			return nil, err
+		}
+		events = append(events, &event)
+	}
+
+	return events, rows.Err()
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// AddRequestLog stores proxied requests in one statement. The key of each entry
+// is looked up by its hash; entries of deleted keys are stored without one.
+func (r *KeyRepository) AddRequestLog(ctx context.Context, entries []RequestLogEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	rows := make([]string, 0, len(entries))
+	args := make([]interface{}, 0, len(entries)*13)
+	for _, e := range entries {
+		rows = append(rows, "(?, ?, ?, ?, ?, ?, (SELECT id FROM api_keys WHERE key_hash = ?), ?, ?, ?, ?, ?)")
+		var keyHash interface{}
+		if e.KeyValue != "" {
+			keyHash = HashKey(e.KeyValue)
+		}
+		args = append(args,
+			e.CreatedAt, nullString(e.RequestID), e.Method, e.Endpoint, nullString(e.ClientIP), nullString(e.Tenant),
+			keyHash, e.StatusCode, e.LatencyMs, e.UpstreamLatencyMs, e.Retries, nullString(e.CacheStatus),
+		)
+	}
+
+	query := `
+		INSERT INTO request_log (created_at, request_id, method, endpoint, client_ip, tenant, key_id,
+			status_code, latency_ms, upstream_latency_ms, retries, cache_status)
+		VALUES ` + strings.Join(rows, ", ")
+
+	_, err := r.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+// ListRequestLog returns a page of logged requests matching opts, newest first,
+// along with the number of matching requests. PerPage 0 returns every match.
+func (r *KeyRepository) ListRequestLog(ctx context.Context, opts RequestLogOptions) ([]*RequestLogEntry, int, error) {
+	var conditions []string
+	var args []interface{}
+	if !opts.From.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, opts.From)
+	}
+	if !opts.To.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, opts.To)
+	}
+	if opts.KeyID != 0 {
+		conditions = append(conditions, "key_id = ?")
+		args = append(args, opts.KeyID)
+	}
+	if opts.Endpoint != "" {
+		conditions = append(conditions, "endpoint = ?")
+		args = append(args, opts.Endpoint)
+	}
+	if opts.StatusCode != 0 {
+		conditions = append(conditions, "status_code = ?")
+		args = append(args, opts.StatusCode)
+	}
+	if opts.Tenant != "" {
+		conditions = append(conditions, "tenant = ?")
+		args = append(args, opts.Tenant)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM request_log"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT id, created_at, request_id, method, endpoint, client_ip, tenant, key_id,
+			status_code, latency_ms, upstream_latency_ms, retries, cache_status
+		FROM request_log` + where + `
+		ORDER BY created_at DESC, id DESC`
+	if opts.PerPage > 0 {
+		page := max(opts.Page, 1)
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, opts.PerPage, (page-1)*opts.PerPage)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	entries := []*RequestLogEntry{}
+	for rows.Next() {
+		var e RequestLogEntry
+		var requestID, clientIP, tenant, cacheStatus sql.NullString
+		var keyID sql.NullInt64
+		if err := rows.Scan(&e.ID, &e.CreatedAt, &requestID, &e.Method, &e.Endpoint, &clientIP, &tenant, &keyID,
+			&e.StatusCode, &e.LatencyMs, &e.UpstreamLatencyMs, &e.Retries, &cacheStatus); err != nil {
+			return nil, 0, err
+		}
+		e.RequestID = requestID.String
+		e.ClientIP = clientIP.String
+		e.Tenant = tenant.String
+		e.KeyID = keyID.Int64
+		e.CacheStatus = cacheStatus.String
+		entries = append(entries, &e)
+	}
+
+	return entries, total, rows.Err()
+}
+
+// PurgeRequestLog deletes up to limit logged requests older than before and
+// returns how many were deleted. Deleting in batches keeps each statement short
+// on a large table.
+func (r *KeyRepository) PurgeRequestLog(ctx context.Context, before time.Time, limit int) (int64, error) {
+	result, err := r.db.ExecContext(ctx, r.db.DeleteOldest("request_log", "created_at"), before, limit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// nullString stores an empty string as NULL
+func nullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
@@ -0,0 +1,281 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/database"
+	"github.com/dbccccccc/tavily-load/migrations"
+	"github.com/sirupsen/logrus"
+)
+
+// newSQLiteRepository returns a repository on a migrated SQLite database in a
+// temporary directory
+func newSQLiteRepository(t *testing.T) (*KeyRepository, *database.DB) {
+	t.Helper()
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	db, err := database.NewConnection(&database.Config{
+		Driver:       database.DriverSQLite,
+		Path:         filepath.Join(t.TempDir(), "data", "tavily-load.db"),
+		MaxOpenConns: 4,
+		MaxIdleConns: 4,
+	}, logger)
+	if err != nil {
+		t.Fatalf("NewConnection: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := database.NewMigrator(db, migrations.Source(database.DriverSQLite, ""), logger)
+	if err != nil {
+		t.Fatalf("NewMigrator: %v", err)
+	}
+	defer migrator.Close()
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+
+	return NewKeyRepository(db), db
+}
+
+func TestSQLiteMigrationsRevert(t *testing.T) {
+	_, db := newSQLiteRepository(t)
+	ctx := context.Background()
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	migrator, err := database.NewMigrator(db, migrations.Source(database.DriverSQLite, ""), logger)
+	if err != nil {
+		t.Fatalf("NewMigrator: %v", err)
+	}
+	defer migrator.Close()
+
+	status, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	applied := int(status.Version)
+
+	if reverted, err := migrator.Down(ctx, applied); err != nil || reverted != applied {
+		t.Fatalf("Down = %d, %v; want %d", reverted, err, applied)
+	}
+	if reapplied, err := migrator.Up(ctx); err != nil || reapplied != applied {
+		t.Fatalf("Up = %d, %v; want %d", reapplied, err, applied)
+	}
+}
+
+func TestSQLiteMigrationsUnversionedSchema(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	ctx := context.Background()
+
+	db, err := database.NewConnection(&database.Config{
+		Driver:       database.DriverSQLite,
+		Path:         filepath.Join(t.TempDir(), "tavily-load.db"),
+		MaxOpenConns: 1,
+		MaxIdleConns: 1,
+	}, logger)
+	if err != nil {
+		t.Fatalf("NewConnection: %v", err)
+	}
+	defer db.Close()
+
+	// A schema created outside the migrator, as docker-entrypoint-initdb.d did
+	schema, err := migrations.FS.ReadFile("sqlite/001_initial_schema.up.sql")
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if _, err := db.ExecContext(ctx, string(schema)); err != nil {
+		t.Fatalf("creating schema: %v", err)
+	}
+
+	migrator, err := database.NewMigrator(db, migrations.Source(database.DriverSQLite, ""), logger)
+	if err != nil {
+		t.Fatalf("NewMigrator: %v", err)
+	}
+	defer migrator.Close()
+
+	if _, err := migrator.Up(ctx); !errors.Is(err, database.ErrUnversionedSchema) {
+		t.Fatalf("Up = %v, want ErrUnversionedSchema", err)
+	}
+	if err := migrator.Force(ctx, 99); err == nil {
+		t.Fatal("Force accepted a version with no migration")
+	}
+	if err := migrator.Force(ctx, 1); err != nil {
+		t.Fatalf("Force: %v", err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Up after Force: %v", err)
+	}
+	status, err := migrator.Status(ctx)
+	if err != nil || status.Unversioned || len(status.Pending) != 0 {
+		t.Fatalf("Status = %+v, %v; want every migration applied", status, err)
+	}
+}
+
+func TestSQLiteKeys(t *testing.T) {
+	repo, _ := newSQLiteRepository(t)
+	ctx := context.Background()
+
+	key, err := repo.CreateKey(ctx, "tvly-sqlite-a", "a", "first key", DefaultTenant, "", nil)
+	if err != nil {
+		t.Fatalf("CreateKey: %v", err)
+	}
+	if _, err := repo.CreateKey(ctx, "tvly-sqlite-a", "a", "", DefaultTenant, "", nil); !errors.Is(err, ErrDuplicateKey) {
+		t.Fatalf("CreateKey with a stored value = %v, want ErrDuplicateKey", err)
+	}
+
+	until := time.Now().Add(time.Hour)
+	if err := repo.BlacklistKey(ctx, key.KeyValue, "rate limited", false, &until, 1); err != nil {
+		t.Fatalf("BlacklistKey: %v", err)
+	}
+	if active, err := repo.GetAllActiveKeys(ctx); err != nil || len(active) != 0 {
+		t.Fatalf("GetAllActiveKeys = %d keys, %v; want none while blacklisted", len(active), err)
+	}
+	blacklisted, err := repo.GetKeyByID(ctx, key.ID)
+	if err != nil {
+		t.Fatalf("GetKeyByID: %v", err)
+	}
+	if blacklisted.BlacklistedUntil == nil || !blacklisted.BlacklistedUntil.Equal(until) {
+		t.Errorf("BlacklistedUntil = %v, want %v", blacklisted.BlacklistedUntil, until)
+	}
+
+	expired := time.Now().Add(-time.Minute)
+	if err := repo.BlacklistKey(ctx, key.KeyValue, "rate limited", false, &expired, 2); err != nil {
+		t.Fatalf("BlacklistKey: %v", err)
+	}
+	if active, err := repo.GetAllActiveKeys(ctx); err != nil || len(active) != 1 {
+		t.Fatalf("GetAllActiveKeys = %d keys, %v; want the key once its blacklisting expired", len(active), err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := repo.UpdateKeyUsage(ctx, key.KeyValue, 3, 1); err != nil {
+			t.Fatalf("UpdateKeyUsage: %v", err)
+		}
+	}
+	stats, err := repo.GetKeyStats(ctx, key.KeyValue)
+	if err != nil {
+		t.Fatalf("GetKeyStats: %v", err)
+	}
+	if stats.RequestsCount != 6 || stats.ErrorsCount != 2 || stats.LastUsedAt == nil {
+		t.Errorf("stats = %d requests, %d errors, last used %v; want 6, 2 and a time",
+			stats.RequestsCount, stats.ErrorsCount, stats.LastUsedAt)
+	}
+
+	budget := KeyBudget{DailySoft: 10, DailyHard: 20}
+	for _, b := range []KeyBudget{{DailySoft: 5}, budget} {
+		if err := repo.SetKeyBudget(ctx, key.ID, b); err != nil {
+			t.Fatalf("SetKeyBudget: %v", err)
+		}
+	}
+	if got, err := repo.GetKeyBudget(ctx, key.ID); err != nil || got != budget {
+		t.Errorf("GetKeyBudget = %+v, %v; want %+v", got, err, budget)
+	}
+
+	for _, reason := range []string{"error_spike", "latency"} {
+		if err := repo.QuarantineKey(ctx, key.KeyValue, reason, ""); err != nil {
+			t.Fatalf("QuarantineKey: %v", err)
+		}
+	}
+	quarantined, err := repo.GetQuarantinedKeys(ctx)
+	if err != nil || len(quarantined) != 1 || quarantined[0].Reason != "latency" {
+		t.Fatalf("GetQuarantinedKeys = %v, %v; want the key quarantined for latency", quarantined, err)
+	}
+
+	if err := repo.DeleteKey(ctx, key.KeyValue); err != nil {
+		t.Fatalf("DeleteKey: %v", err)
+	}
+	if _, err := repo.CreateKey(ctx, key.KeyValue, "a", "", DefaultTenant, "", nil); err != nil {
+		t.Fatalf("CreateKey with a deleted value: %v", err)
+	}
+	if err := repo.PurgeDeletedKey(ctx, key.ID); err != nil {
+		t.Fatalf("PurgeDeletedKey: %v", err)
+	}
+	if err := repo.PurgeDeletedKey(ctx, key.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("PurgeDeletedKey of a purged key = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestSQLiteCreateKeyWithPoolAndTags(t *testing.T) {
+	repo, _ := newSQLiteRepository(t)
+	ctx := context.Background()
+
+	key, err := repo.CreateKey(ctx, "tvly-sqlite-c", "c", "", DefaultTenant, "batch", []string{"team-b", "team-a"})
+	if err != nil {
+		t.Fatalf("CreateKey: %v", err)
+	}
+	if key.Pool != "batch" {
+		t.Errorf("Pool = %q, want batch", key.Pool)
+	}
+	tags, err := repo.GetTagsForKeys(ctx, []int64{key.ID})
+	if err != nil || len(tags[key.ID]) != 2 || tags[key.ID][0] != "team-a" {
+		t.Errorf("GetTagsForKeys = %v, %v; want [team-a team-b]", tags, err)
+	}
+
+	// A tag that cannot be stored leaves no key behind
+	if _, err := repo.CreateKey(ctx, "tvly-sqlite-d", "d", "", DefaultTenant, "", []string{"x", "x"}); err == nil {
+		t.Fatal("CreateKey with a duplicate tag succeeded")
+	}
+	if exists, err := repo.KeyExists(ctx, "tvly-sqlite-d"); err != nil || exists {
+		t.Errorf("KeyExists = %v, %v; want the key rolled back with its tags", exists, err)
+	}
+}
+
+func TestSQLiteUsageTimeseries(t *testing.T) {
+	repo, _ := newSQLiteRepository(t)
+	ctx := context.Background()
+
+	key, err := repo.CreateKey(ctx, "tvly-sqlite-b", "b", "", DefaultTenant, "", nil)
+	if err != nil {
+		t.Fatalf("CreateKey: %v", err)
+	}
+
+	day := time.Now().UTC().Truncate(24 * time.Hour).Add(-48 * time.Hour)
+	usage := []HourlyUsage{
+		{KeyValue: key.KeyValue, Endpoint: "/search", HourStart: day.Add(time.Hour), RequestsCount: 2, LatencyMsTotal: 200},
+		{KeyValue: key.KeyValue, Endpoint: "/search", HourStart: day.Add(time.Hour), RequestsCount: 1, ErrorsCount: 1, LatencyMsTotal: 100},
+		{KeyValue: key.KeyValue, Endpoint: "/search", HourStart: day.Add(25 * time.Hour), RequestsCount: 4, LatencyMsTotal: 400},
+		{KeyValue: "tvly-not-stored", Endpoint: "/search", HourStart: day, RequestsCount: 9},
+	}
+	if err := repo.AddHourlyUsage(ctx, usage); err != nil {
+		t.Fatalf("AddHourlyUsage: %v", err)
+	}
+
+	hourly, err := repo.GetUsageTimeseries(ctx, TimeseriesOptions{From: day, To: day.Add(48 * time.Hour), Resolution: ResolutionHour})
+	if err != nil {
+		t.Fatalf("GetUsageTimeseries: %v", err)
+	}
+	if len(hourly) != 2 || !hourly[0].Time.Equal(day.Add(time.Hour)) || hourly[0].RequestsCount != 3 || hourly[0].ErrorsCount != 1 {
+		t.Fatalf("hourly series = %v, want 3 requests and 1 error at %v, then one more hour", hourly, day.Add(time.Hour))
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := repo.RollupDailyUsage(ctx); err != nil {
+			t.Fatalf("RollupDailyUsage: %v", err)
+		}
+	}
+	pruned, err := repo.PruneHourlyUsage(ctx, day.Add(24*time.Hour), 100)
+	if err != nil || pruned != 1 {
+		t.Fatalf("PruneHourlyUsage = %d, %v; want the first day's hour", pruned, err)
+	}
+
+	daily, err := repo.GetUsageTimeseries(ctx, TimeseriesOptions{From: day, To: day.Add(48 * time.Hour), Resolution: ResolutionDay})
+	if err != nil {
+		t.Fatalf("GetUsageTimeseries: %v", err)
+	}
+	if len(daily) != 2 {
+		t.Fatalf("daily series has %d points, want 2", len(daily))
+	}
+	for i, want := range []int64{3, 4} {
+		if !daily[i].Time.Equal(day.Add(time.Duration(i)*24*time.Hour)) || daily[i].RequestsCount != want {
+			t.Errorf("day %d = %d requests at %v, want %d at %v", i, daily[i].RequestsCount, daily[i].Time,
+				want, day.Add(time.Duration(i)*24*time.Hour))
+		}
+	}
+}
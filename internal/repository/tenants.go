@@ -0,0 +1,39 @@
+package repository
+
+import "context"
+
+// DefaultTenant owns keys and tokens that were not assigned to a tenant
+const DefaultTenant = "default"
+
+// DefaultPool holds keys that were not assigned to a pool
+const DefaultPool = "default"
+
+// ListTenants returns every tenant that owns keys or auth tokens, ordered by name
+func (r *KeyRepository) ListTenants(ctx context.Context) ([]*TenantSummary, error) {
+	query := `
+		SELECT tenant, SUM(is_key), SUM(is_token) FROM (
+			SELECT tenant, 1 AS is_key, 0 AS is_token FROM api_keys WHERE deleted_at IS NULL
+			UNION ALL
+			SELECT tenant, 0, 1 FROM auth_tokens
+		) owned
+		GROUP BY tenant
+		ORDER BY tenant
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tenants := []*TenantSummary{}
+	for rows.Next() {
+		var tenant TenantSummary
+		if err := rows.Scan(&tenant.Name, &tenant.KeyCount, &tenant.TokenCount); err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, &tenant)
+	}
+
+	return tenants, rows.Err()
+}
@@ -0,0 +1,196 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/database"
+)
+
+// Timeseries resolutions supported by GetUsageTimeseries
+const (
+	ResolutionHour = "hour"
+	ResolutionDay  = "day"
+)
+
+// AddHourlyUsage adds counters to the hourly rollups, creating rows as needed.
+// Rows for keys that are no longer stored are skipped.
+func (r *KeyRepository) AddHourlyUsage(ctx context.Context, usage []HourlyUsage) error {
+	if len(usage) == 0 {
+		return nil
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO key_usage_hourly (key_id, endpoint, hour_start, requests_count, errors_count, latency_ms_total)
+		SELECT id, ?, ?, ?, ?, ? FROM api_keys WHERE key_hash = ?
+		` + r.db.Upsert("key_id", "endpoint", "hour_start") + `
+		requests_count = requests_count + ` + r.db.Excluded("requests_count") + `,
+		errors_count = errors_count + ` + r.db.Excluded("errors_count") + `,
+		latency_ms_total = latency_ms_total + ` + r.db.Excluded("latency_ms_total") + `
+	`
+	for _, u := range usage {
+		if _, err := tx.ExecContext(ctx, query, u.Endpoint, u.HourStart, u.RequestsCount, u.ErrorsCount, u.LatencyMsTotal, HashKey(u.KeyValue)); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// RollupDailyUsage sums the hourly rollups into the daily rollups. It recomputes
+// every day from the one before the latest daily row, which may have been rolled
+// up while its hours were still being counted, or from the oldest hourly row when
+// there are no daily rows yet.
+func (r *KeyRepository) RollupDailyUsage(ctx context.Context) error {
+	var since database.NullTime
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COALESCE(
+			(SELECT `+r.db.DayBefore("MAX(day)")+` FROM key_usage_daily),
+			(SELECT MIN(hour_start) FROM key_usage_hourly))
+	`).Scan(&since)
+	if err != nil || !since.Valid {
+		return err
+	}
+
+	query := `
+		INSERT INTO key_usage_daily (key_id, endpoint, day, requests_count, errors_count, latency_ms_total)
+		SELECT key_id, endpoint, ` + r.db.Date("hour_start") + `, SUM(requests_count), SUM(errors_count), SUM(latency_ms_total)
+		FROM key_usage_hourly
+		WHERE hour_start >= ?
+		GROUP BY key_id, endpoint, ` + r.db.Date("hour_start") + `
+		` + r.db.Upsert("key_id", "endpoint", "day") + `
+		requests_count = ` + r.db.Excluded("requests_count") + `,
+		errors_count = ` + r.db.Excluded("errors_count") + `,
+		latency_ms_total = ` + r.db.Excluded("latency_ms_total") + `
+	`
+	_, err = r.db.ExecContext(ctx, query, since.Time)
+	return err
+}
+
+// PruneHourlyUsage deletes up to limit hourly rollups older than before and
+// returns how many were deleted. Callers roll them up with RollupDailyUsage first.
+func (r *KeyRepository) PruneHourlyUsage(ctx context.Context, before time.Time, limit int) (int64, error) {
+	result, err := r.db.ExecContext(ctx, r.db.DeleteOldest("key_usage_hourly", "hour_start"), before, limit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// usageFilters returns the conditions on the rollup table aliased as table and
+// its keys aliased k that match opts, apart from the time range
+func usageFilters(table string, opts TimeseriesOptions) ([]string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	if opts.KeyID != 0 {
+		conditions = append(conditions, table+".key_id = ?")
+		args = append(args, opts.KeyID)
+	}
+	if opts.Endpoint != "" {
+		conditions = append(conditions, table+".endpoint = ?")
+		args = append(args, opts.Endpoint)
+	}
+	if opts.Tenant != "" {
+		conditions = append(conditions, "k.tenant = ?")
+		args = append(args, opts.Tenant)
+	}
+	return conditions, args
+}
+
+// GetUsageTimeseries returns usage between From (inclusive) and To (exclusive)
+// summed per hour or per day, oldest first. Buckets without usage are omitted.
+func (r *KeyRepository) GetUsageTimeseries(ctx context.Context, opts TimeseriesOptions) ([]*TimeseriesPoint, error) {
+	filters, filterArgs := usageFilters("h", opts)
+	conditions := append([]string{"h.hour_start >= ?", "h.hour_start < ?"}, filters...)
+	args := append([]interface{}{opts.From, opts.To}, filterArgs...)
+
+	query := `
+		SELECT h.hour_start AS bucket, SUM(h.requests_count), SUM(h.errors_count), SUM(h.latency_ms_total)
+		FROM key_usage_hourly h
+		JOIN api_keys k ON h.key_id = k.id
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		GROUP BY bucket
+		ORDER BY bucket
+	`
+	if opts.Resolution == ResolutionDay {
+		var err error
+		query, args, err = r.dailyUsageQuery(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := []*TimeseriesPoint{}
+	for rows.Next() {
+		var point TimeseriesPoint
+		var bucket database.NullTime
+		var latencyTotal int64
+		if err := rows.Scan(&bucket, &point.RequestsCount, &point.ErrorsCount, &latencyTotal); err != nil {
+			return nil, err
+		}
+		point.Time = bucket.Time
+		if point.RequestsCount > 0 {
+			point.AverageLatency = latencyTotal / point.RequestsCount
+		}
+		points = append(points, &point)
+	}
+
+	return points, rows.Err()
+}
+
+// dailyUsageQuery builds the day-resolution time series query. Days before the
+// latest daily rollup are read from the daily rollups, whose hourly rows may have
+// been pruned, and later ones from the hourly rollups, which are more recent.
+func (r *KeyRepository) dailyUsageQuery(ctx context.Context, opts TimeseriesOptions) (string, []interface{}, error) {
+	var split database.NullTime
+	if err := r.db.QueryRowContext(ctx, "SELECT MAX(day) FROM key_usage_daily").Scan(&split); err != nil {
+		return "", nil, err
+	}
+
+	filters, filterArgs := usageFilters("h", opts)
+	conditions := append([]string{"h.hour_start >= " + r.db.Timestamp(r.db.Date("?")), "h.hour_start < ?"}, filters...)
+	args := append([]interface{}{opts.From, opts.To}, filterArgs...)
+	if split.Valid {
+		conditions = append(conditions, "h.hour_start >= ?")
+		args = append(args, split.Time)
+	}
+	union := `
+			SELECT ` + r.db.Timestamp(r.db.Date("h.hour_start")) + ` AS bucket, h.requests_count, h.errors_count, h.latency_ms_total
+			FROM key_usage_hourly h
+			JOIN api_keys k ON h.key_id = k.id
+			WHERE ` + strings.Join(conditions, " AND ")
+
+	if split.Valid {
+		filters, filterArgs := usageFilters("d", opts)
+		conditions := append([]string{"d.day >= " + r.db.Date("?"), r.db.DateCompared("d.day") + " < ?", r.db.DateCompared("d.day") + " < ?"}, filters...)
+		args = append(append(args, opts.From, opts.To, split.Time), filterArgs...)
+		union += `
+			UNION ALL
+			SELECT ` + r.db.Timestamp("d.day") + `, d.requests_count, d.errors_count, d.latency_ms_total
+			FROM key_usage_daily d
+			JOIN api_keys k ON d.key_id = k.id
+			WHERE ` + strings.Join(conditions, " AND ")
+	}
+
+	query := `
+		SELECT bucket, SUM(requests_count), SUM(errors_count), SUM(latency_ms_total)
+		FROM (` + union + `
+		) usage_rows
+		GROUP BY bucket
+		ORDER BY bucket
+	`
+	return query, args, nil
+}
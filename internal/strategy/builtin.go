@@ -0,0 +1,283 @@
+package strategy
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/pkg/types"
+)
+
+// errorRateTolerance is how far above the healthiest key's error rate a key may be
+// and still be selected by the least-errors strategy
+const errorRateTolerance = 0.05
+
+var errNoCandidates = fmt.Errorf("no candidate keys available")
+
+// cursorFor returns the usage source's rotation cursor when it has one
+func cursorFor(usage types.KeyUsageSource, fallback *int64) *int64 {
+	if source, ok := usage.(types.CursorSource); ok {
+		if cursor := source.Cursor(); cursor != nil {
+			return cursor
+		}
+	}
+	return fallback
+}
+
+// advance moves the rotation on by one and returns the new position, which the
+// usage source provides when it keeps the position itself
+func advance(usage types.KeyUsageSource, fallback *int64) int64 {
+	if source, ok := usage.(types.PositionSource); ok {
+		if position, ok := source.NextPosition(); ok {
+			return position
+		}
+	}
+	return atomic.AddInt64(cursorFor(usage, fallback), 1)
+}
+
+// PlanFirst prefers keys with plan credits and only falls back to paygo credits
+// when no plan credits are available
+type PlanFirst struct{}
+
+// SelectKey implements types.KeySelector
+func (s *PlanFirst) SelectKey(candidates []string, usage types.KeyUsageSource) (string, error) {
+	// First pass: Look for keys with plan credits available. Keys are compared by
+	// the plan credits they have left per day until their plan resets, so credits
+	// that would otherwise expire unused are spent first.
+	var bestPlanKey string
+	mostPlanRemaining := -1
+	bestAllowance := -1.0
+
+	// Second pass data: No plan credits available, find key with most paygo credits
+	var bestPaygoKey string
+	mostPaygoRemaining := -1
+
+	for _, key := range candidates {
+		remaining, err := usage.CalculateRemainingPoints(key)
+		if err != nil || remaining.TotalRemaining <= 0 {
+			continue
+		}
+
+		// Prioritize keys with plan credits
+		allowance := planAllowance(remaining)
+		if allowance > bestAllowance || (allowance == bestAllowance && remaining.PlanRemaining > mostPlanRemaining) {
+			bestAllowance = allowance
+			mostPlanRemaining = remaining.PlanRemaining
+			bestPlanKey = key
+		}
+
+		if remaining.PaygoRemaining > mostPaygoRemaining {
+			mostPaygoRemaining = remaining.PaygoRemaining
+			bestPaygoKey = key
+		}
+	}
+
+	// If we found a key with plan credits, use it
+	if bestPlanKey != "" && mostPlanRemaining > 0 {
+		return bestPlanKey, nil
+	}
+
+	if bestPaygoKey != "" {
+		return bestPaygoKey, nil
+	}
+
+	return "", fmt.Errorf("no available keys with remaining quota")
+}
+
+// planAllowance returns the plan credits a key has left per day until its reset,
+// or its plan credits left when the reset date is unknown
+func planAllowance(remaining *types.RemainingPoints) float64 {
+	if remaining.PlanRemaining <= 0 {
+		return 0
+	}
+	if remaining.PlanResetAt == nil {
+		return float64(remaining.PlanRemaining)
+	}
+	return remaining.PlanDailyAllowance
+}
+
+// BurnBeforeReset spends the plan credits of the key whose plan resets soonest, so
+// credits that would expire unused at the reset are used first. Keys resetting at
+// the same time are compared by plan credits left. Without plan credits on any key
+// with a known reset date it falls back to PlanFirst.
+type BurnBeforeReset struct{}
+
+// SelectKey implements types.KeySelector
+func (s *BurnBeforeReset) SelectKey(candidates []string, usage types.KeyUsageSource) (string, error) {
+	var bestKey string
+	var bestReset time.Time
+	bestRemaining := 0
+
+	for _, key := range candidates {
+		remaining, err := usage.CalculateRemainingPoints(key)
+		if err != nil || remaining.PlanRemaining <= 0 || remaining.PlanResetAt == nil {
+			continue
+		}
+
+		resetAt := *remaining.PlanResetAt
+		if bestKey == "" || resetAt.Before(bestReset) || (resetAt.Equal(bestReset) && remaining.PlanRemaining > bestRemaining) {
+			bestKey = key
+			bestReset = resetAt
+			bestRemaining = remaining.PlanRemaining
+		}
+	}
+
+	if bestKey != "" {
+		return bestKey, nil
+	}
+	return (&PlanFirst{}).SelectKey(candidates, usage)
+}
+
+// RoundRobin rotates through the candidates
+type RoundRobin struct {
+	cursor *int64
+}
+
+// NewRoundRobin creates a round-robin selector; a nil cursor gets a private one
+func NewRoundRobin(cursor *int64) *RoundRobin {
+	if cursor == nil {
+		cursor = new(int64)
+	}
+	return &RoundRobin{cursor: cursor}
+}
+
+// SelectKey implements types.KeySelector
+func (s *RoundRobin) SelectKey(candidates []string, usage types.KeyUsageSource) (string, error) {
+	if len(candidates) == 0 {
+		return "", errNoCandidates
+	}
+	index := advance(usage, s.cursor) % int64(len(candidates))
+	return candidates[index], nil
+}
+
+// LeastUsed selects the key with the fewest requests in the current window
+type LeastUsed struct{}
+
+// SelectKey implements types.KeySelector
+func (s *LeastUsed) SelectKey(candidates []string, usage types.KeyUsageSource) (string, error) {
+	var bestKey string
+	lowestCount := -1.0
+
+	for _, key := range candidates {
+		count := usage.WindowRequestCount(key)
+		if lowestCount < 0 || count < lowestCount {
+			lowestCount = count
+			bestKey = key
+		}
+	}
+
+	if bestKey == "" {
+		return "", errNoCandidates
+	}
+
+	return bestKey, nil
+}
+
+// WeightedRandom picks keys randomly, weighted by their remaining credits
+type WeightedRandom struct{}
+
+// SelectKey implements types.KeySelector
+func (s *WeightedRandom) SelectKey(candidates []string, usage types.KeyUsageSource) (string, error) {
+	keys := make([]string, 0, len(candidates))
+	weights := make([]int, 0, len(candidates))
+	totalWeight := 0
+
+	for _, key := range candidates {
+		remaining, err := usage.CalculateRemainingPoints(key)
+		if err != nil || remaining.TotalRemaining <= 0 {
+			continue
+		}
+
+		keys = append(keys, key)
+		weights = append(weights, remaining.TotalRemaining)
+		totalWeight += remaining.TotalRemaining
+	}
+
+	if totalWeight == 0 {
+		return "", fmt.Errorf("no available keys with remaining quota")
+	}
+
+	pick := rand.Intn(totalWeight)
+	for i, weight := range weights {
+		if pick < weight {
+			return keys[i], nil
+		}
+		pick -= weight
+	}
+
+	return keys[len(keys)-1], nil
+}
+
+// LeastErrors rotates across the keys whose error rate is close to the lowest in the pool,
+// shifting traffic away from flaky keys before they reach the blacklist threshold
+type LeastErrors struct {
+	cursor *int64
+}
+
+// NewLeastErrors creates a least-errors selector; a nil cursor gets a private one
+func NewLeastErrors(cursor *int64) *LeastErrors {
+	if cursor == nil {
+		cursor = new(int64)
+	}
+	return &LeastErrors{cursor: cursor}
+}
+
+// SelectKey implements types.KeySelector
+func (s *LeastErrors) SelectKey(candidates []string, usage types.KeyUsageSource) (string, error) {
+	if len(candidates) == 0 {
+		return "", errNoCandidates
+	}
+
+	rates := make([]float64, len(candidates))
+	lowestRate := -1.0
+	for i, key := range candidates {
+		rates[i] = usage.ErrorRate(key)
+		if lowestRate < 0 || rates[i] < lowestRate {
+			lowestRate = rates[i]
+		}
+	}
+
+	for i := 0; i < len(candidates); i++ {
+		index := advance(usage, s.cursor) % int64(len(candidates))
+		if rates[index] <= lowestRate+errorRateTolerance {
+			return candidates[index], nil
+		}
+	}
+
+	return "", fmt.Errorf("no healthy API keys available")
+}
+
+// ConsistentHash maps the request's routing key onto the candidates using
+// rendezvous hashing, so only requests routed to a removed key move elsewhere
+type ConsistentHash struct{}
+
+// SelectKey implements types.KeySelector
+func (s *ConsistentHash) SelectKey(candidates []string, usage types.KeyUsageSource) (string, error) {
+	source, ok := usage.(types.RoutingKeySource)
+	if !ok || source.RoutingKey() == "" {
+		return "", fmt.Errorf("no routing key available")
+	}
+	routingKey := source.RoutingKey()
+
+	var bestKey string
+	var bestScore uint64
+
+	for _, key := range candidates {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		h.Write([]byte{0})
+		h.Write([]byte(routingKey))
+		if score := h.Sum64(); bestKey == "" || score > bestScore {
+			bestScore = score
+			bestKey = key
+		}
+	}
+
+	if bestKey == "" {
+		return "", errNoCandidates
+	}
+
+	return bestKey, nil
+}
@@ -0,0 +1,110 @@
+package strategy
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/dbccccccc/tavily-load/pkg/types"
+)
+
+// Info describes a registered selection strategy
+type Info struct {
+	Strategy    types.SelectionStrategy `json:"strategy"`
+	Description string                  `json:"description"`
+}
+
+type registration struct {
+	info     Info
+	selector types.KeySelector
+}
+
+// Registry holds the available key selection strategies
+type Registry struct {
+	mu         sync.RWMutex
+	selectors  map[types.SelectionStrategy]*registration
+	strategies []types.SelectionStrategy
+}
+
+// NewRegistry creates an empty strategy registry
+func NewRegistry() *Registry {
+	return &Registry{
+		selectors: make(map[types.SelectionStrategy]*registration),
+	}
+}
+
+// NewDefaultRegistry creates a registry with the built-in strategies registered.
+// The cursor is shared by the rotating strategies so they continue from the same position.
+func NewDefaultRegistry(cursor *int64) *Registry {
+	r := NewRegistry()
+	r.Register(types.StrategyPlanFirst, "Default: Prefer plan credits over paygo, only switch to paid when no plans available", &PlanFirst{})
+	r.Register(types.StrategyRoundRobin, "Round-robin selection across all available keys", NewRoundRobin(cursor))
+	r.Register(types.StrategyLeastUsed, "Select the key with the fewest requests in the current window", &LeastUsed{})
+	r.Register(types.StrategyWeightedRandom, "Random selection weighted by each key's remaining credits", &WeightedRandom{})
+	r.Register(types.StrategyLeastErrors, "Round-robin across the keys with the lowest error rates", NewLeastErrors(cursor))
+	r.Register(types.StrategyConsistentHash, "Route identical queries to the same key", &ConsistentHash{})
+	r.Register(types.StrategyBurnBeforeReset, "Drain plan credits of the keys whose plan resets soonest, falling back to plan-first", &BurnBeforeReset{})
+	return r
+}
+
+// Register adds or replaces a strategy
+func (r *Registry) Register(strategy types.SelectionStrategy, description string, selector types.KeySelector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.selectors[strategy]; !exists {
+		r.strategies = append(r.strategies, strategy)
+	}
+	r.selectors[strategy] = &registration{
+		info:     Info{Strategy: strategy, Description: description},
+		selector: selector,
+	}
+}
+
+// Get returns the selector registered for a strategy
+func (r *Registry) Get(strategy types.SelectionStrategy) (types.KeySelector, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	reg, ok := r.selectors[strategy]
+	if !ok {
+		return nil, false
+	}
+	return reg.selector, true
+}
+
+// Has reports whether a strategy is registered
+func (r *Registry) Has(strategy types.SelectionStrategy) bool {
+	_, ok := r.Get(strategy)
+	return ok
+}
+
+// Strategies returns the registered strategies in registration order
+func (r *Registry) Strategies() []types.SelectionStrategy {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	strategies := make([]types.SelectionStrategy, len(r.strategies))
+	copy(strategies, r.strategies)
+	return strategies
+}
+
+// Describe returns the registered strategies with their descriptions
+func (r *Registry) Describe() []Info {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	infos := make([]Info, 0, len(r.strategies))
+	for _, strategy := range r.strategies {
+		infos = append(infos, r.selectors[strategy].info)
+	}
+	return infos
+}
+
+// Select runs the strategy's selector against the candidates
+func (r *Registry) Select(strategy types.SelectionStrategy, candidates []string, usage types.KeyUsageSource) (string, error) {
+	selector, ok := r.Get(strategy)
+	if !ok {
+		return "", fmt.Errorf("unknown selection strategy: %s", strategy)
+	}
+	return selector.SelectKey(candidates, usage)
+}
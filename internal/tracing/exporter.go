@@ -0,0 +1,282 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// queueSize bounds the spans waiting for export; spans are dropped when it is full
+	queueSize = 4096
+	// batchSize is the most spans sent in one export request
+	batchSize = 512
+	// flushInterval is how long a partial batch waits before it is exported
+	flushInterval = 5 * time.Second
+	// exportTimeout bounds a single export request
+	exportTimeout = 10 * time.Second
+)
+
+// exporter batches finished spans and POSTs them to the collector as OTLP/HTTP JSON
+type exporter struct {
+	url         string
+	headers     map[string]string
+	serviceName string
+	client      *http.Client
+	logger      *logrus.Logger
+
+	queue   chan *Span
+	flush   chan chan struct{}
+	dropped int64
+	mu      sync.Mutex
+}
+
+func newExporter(cfg *config.Config, logger *logrus.Logger) *exporter {
+	return &exporter{
+		url:         strings.TrimRight(cfg.OTLPEndpoint, "/") + "/v1/traces",
+		headers:     cfg.OTLPHeaders,
+		serviceName: cfg.OTelServiceName,
+		client:      &http.Client{Timeout: exportTimeout},
+		logger:      logger,
+		queue:       make(chan *Span, queueSize),
+		flush:       make(chan chan struct{}),
+	}
+}
+
+// enqueue hands a finished span to the export loop without blocking the request
+func (e *exporter) enqueue(span *Span) {
+	select {
+	case e.queue <- span:
+	default:
+		e.mu.Lock()
+		e.dropped++
+		e.mu.Unlock()
+	}
+}
+
+// run exports spans in batches until the process exits
+func (e *exporter) run() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, batchSize)
+	send := func() {
+		if len(batch) > 0 {
+			e.export(batch)
+			batch = batch[:0]
+		}
+	}
+
+	for {
+		select {
+		case span := <-e.queue:
+			batch = append(batch, span)
+			if len(batch) == batchSize {
+				send()
+			}
+		case <-ticker.C:
+			send()
+			e.reportDropped()
+		case done := <-e.flush:
+			// Drain whatever is queued, then acknowledge
+			for drained := false; !drained; {
+				select {
+				case span := <-e.queue:
+					batch = append(batch, span)
+					if len(batch) == batchSize {
+						send()
+					}
+				default:
+					drained = true
+				}
+			}
+			send()
+			close(done)
+		}
+	}
+}
+
+// shutdown exports the queued spans, giving up when ctx is done
+func (e *exporter) shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	select {
+	case e.flush <- done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reportDropped logs spans lost to a full queue since the last report
+func (e *exporter) reportDropped() {
+	e.mu.Lock()
+	dropped := e.dropped
+	e.dropped = 0
+	e.mu.Unlock()
+	if dropped > 0 {
+		e.logger.WithField("dropped", dropped).Warn("Trace export queue full, spans dropped")
+	}
+}
+
+// export sends one batch to the collector. Failures are logged and the batch is
+// discarded, so a collector outage never backs up into request handling.
+func (e *exporter) export(batch []*Span) {
+	body, err := json.Marshal(e.payload(batch))
+	if err != nil {
+		e.logger.WithError(err).Warn("Failed to encode trace spans")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		e.logger.WithError(err).Warn("Failed to create trace export request")
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range e.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		e.logger.WithError(err).Warn("Failed to export trace spans")
+		return
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		e.logger.WithFields(logrus.Fields{
+			"status": resp.StatusCode,
+			"spans":  len(batch),
+		}).Warn("Trace collector rejected spans")
+	}
+}
+
+// OTLP/HTTP JSON request body, see opentelemetry-proto trace/v1
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              Kind            `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+// statusError is the OTLP status code of failed spans; others are left unset
+const statusError = 2
+
+func (e *exporter) payload(batch []*Span) otlpRequest {
+	spans := make([]otlpSpan, 0, len(batch))
+	for _, span := range batch {
+		spans = append(spans, span.otlp())
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpAttribute{
+			attribute("service.name", e.serviceName),
+		}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "github.com/dbccccccc/tavily-load"},
+			Spans: spans,
+		}},
+	}}}
+}
+
+func (s *Span) otlp() otlpSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	span := otlpSpan{
+		TraceID:           hex.EncodeToString(s.traceID[:]),
+		SpanID:            hex.EncodeToString(s.spanID[:]),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+	}
+	if s.parentID != ([8]byte{}) {
+		span.ParentSpanID = hex.EncodeToString(s.parentID[:])
+	}
+	for key, value := range s.attributes {
+		span.Attributes = append(span.Attributes, attribute(key, value))
+	}
+	if s.errMessage != "" {
+		span.Status = otlpStatus{Code: statusError, Message: s.errMessage}
+	}
+	return span
+}
+
+// attribute encodes a value as an OTLP AnyValue; 64-bit integers are strings in OTLP JSON
+func attribute(key string, value interface{}) otlpAttribute {
+	var encoded map[string]interface{}
+	switch v := value.(type) {
+	case string:
+		encoded = map[string]interface{}{"stringValue": v}
+	case bool:
+		encoded = map[string]interface{}{"boolValue": v}
+	case int:
+		encoded = map[string]interface{}{"intValue": strconv.Itoa(v)}
+	case int64:
+		encoded = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+	case float64:
+		encoded = map[string]interface{}{"doubleValue": v}
+	default:
+		encoded = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+	}
+	return otlpAttribute{Key: key, Value: encoded}
+}
@@ -0,0 +1,85 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	mathrand "math/rand"
+	"strings"
+	"time"
+)
+
+// TraceparentHeader is the W3C Trace Context header carrying the trace and parent span IDs
+const TraceparentHeader = "traceparent"
+
+// StartServer begins the span of an incoming request. A valid traceparent makes it
+// part of the caller's trace and inherits the caller's sampling decision; without
+// one a new trace is started. Unlike Start it always returns a span, so requests
+// have IDs to propagate to Tavily even while tracing is disabled.
+func StartServer(ctx context.Context, name, traceparent string) (context.Context, *Span) {
+	t := tracer.Load()
+	span := &Span{
+		tracer: t,
+		name:   name,
+		kind:   KindServer,
+		start:  time.Now(),
+		spanID: newSpanID(),
+	}
+
+	if traceID, parentID, sampled, ok := parseTraceparent(traceparent); ok {
+		span.traceID = traceID
+		span.parentID = parentID
+		span.sampled = sampled
+	} else {
+		span.traceID = newTraceID()
+		span.sampled = t != nil && (t.sampleRatio >= 1 || mathrand.Float64() < t.sampleRatio)
+	}
+
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// Traceparent formats the span as a traceparent header value, or returns "" for a nil span
+func (s *Span) Traceparent() string {
+	if s == nil {
+		return ""
+	}
+	flags := "00"
+	if s.sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(s.traceID[:]) + "-" + hex.EncodeToString(s.spanID[:]) + "-" + flags
+}
+
+// parseTraceparent parses a version-00 traceparent value. Later versions are read
+// as version 00, as the specification asks, provided they only append fields.
+func parseTraceparent(value string) (traceID [16]byte, parentID [8]byte, sampled bool, ok bool) {
+	if len(value) < 55 || (len(value) > 55 && value[55] != '-') {
+		return
+	}
+	if value[2] != '-' || value[35] != '-' || value[52] != '-' {
+		return
+	}
+	version := value[0:2]
+	if version == "ff" || (version == "00" && len(value) != 55) {
+		return
+	}
+	if _, err := hex.Decode(make([]byte, 1), []byte(version)); err != nil {
+		return
+	}
+
+	var flags [1]byte
+	if _, err := hex.Decode(traceID[:], []byte(value[3:35])); err != nil {
+		return
+	}
+	if _, err := hex.Decode(parentID[:], []byte(value[36:52])); err != nil {
+		return
+	}
+	if _, err := hex.Decode(flags[:], []byte(value[53:55])); err != nil {
+		return
+	}
+	// All-zero IDs are invalid, and so are upper-case hex digits
+	if traceID == ([16]byte{}) || parentID == ([8]byte{}) || strings.ToLower(value[:55]) != value[:55] {
+		return
+	}
+
+	return traceID, parentID, flags[0]&1 == 1, true
+}
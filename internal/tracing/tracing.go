@@ -0,0 +1,236 @@
+// Package tracing records spans for proxied requests and exports them to an
+// OpenTelemetry collector over OTLP/HTTP, so the time spent selecting a key,
+// talking to Redis and MySQL and waiting on Tavily can be told apart in a
+// tracing backend. Tracing is off unless OTEL_EXPORTER_OTLP_ENDPOINT is set, in
+// which case Start returns a nil span whose methods do nothing.
+//
+// The package does not use the OpenTelemetry SDK on purpose. Its OTLP/HTTP
+// exporter depends on the generated OTLP protobuf and gRPC packages, which would
+// add about a dozen modules to a proxy that otherwise has nine direct
+// dependencies. The proxy only needs a small part of the SDK: one tracer, ratio
+// sampling, W3C traceparent propagation and batched export. That part is
+// written here, and spans are encoded as OTLP/HTTP JSON, which the collector and
+// OTLP backends accept at /v1/traces. gRPC transport, protobuf encoding, span
+// links and events are not supported. If they are ever needed, switch to the SDK
+// rather than extending this package.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	mathrand "math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+// Kind is the OTLP span kind
+type Kind int
+
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+)
+
+// Tracer creates spans and hands finished, sampled ones to the exporter
+type Tracer struct {
+	exporter    *exporter
+	sampleRatio float64
+}
+
+// tracer is the process-wide tracer; nil while tracing is disabled
+var tracer atomic.Pointer[Tracer]
+
+// Init enables tracing when OTEL_EXPORTER_OTLP_ENDPOINT is set. It is safe to
+// call more than once; only the first call with an endpoint takes effect.
+func Init(cfg *config.Config, logger *logrus.Logger) {
+	if cfg.OTLPEndpoint == "" || tracer.Load() != nil {
+		return
+	}
+	t := &Tracer{
+		exporter:    newExporter(cfg, logger),
+		sampleRatio: cfg.TraceSampleRatio,
+	}
+	if tracer.CompareAndSwap(nil, t) {
+		go t.exporter.run()
+		logger.WithFields(logrus.Fields{
+			"endpoint":     cfg.OTLPEndpoint,
+			"sample_ratio": cfg.TraceSampleRatio,
+		}).Info("OpenTelemetry tracing enabled")
+	}
+}
+
+// Enabled reports whether spans are being recorded
+func Enabled() bool {
+	return tracer.Load() != nil
+}
+
+// Shutdown flushes the spans that are still queued for export
+func Shutdown(ctx context.Context) error {
+	t := tracer.Load()
+	if t == nil {
+		return nil
+	}
+	return t.exporter.shutdown(ctx)
+}
+
+// Span is a timed operation within a trace. All methods are safe on a nil span.
+// Spans from StartServer while tracing is disabled only carry IDs for
+// propagation; they record nothing and are never exported.
+type Span struct {
+	tracer   *Tracer
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	sampled  bool
+	name     string
+	kind     Kind
+	start    time.Time
+
+	mu         sync.Mutex
+	end        time.Time
+	attributes map[string]interface{}
+	errMessage string
+	ended      bool
+}
+
+type spanKey struct{}
+
+// FromContext returns the span carried by ctx, or nil
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// ContextWithSpan returns a copy of ctx carrying span, so work done under another
+// context (such as a background timeout) is still recorded in the same trace
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	if span == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// Start begins a span, as a child of the span in ctx when there is one and as the
+// root of a new trace otherwise
+func Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	t := tracer.Load()
+	if t == nil {
+		return ctx, nil
+	}
+
+	span := &Span{
+		tracer: t,
+		name:   name,
+		kind:   kind,
+		start:  time.Now(),
+	}
+	if parent := FromContext(ctx); parent != nil {
+		span.traceID = parent.traceID
+		span.parentID = parent.spanID
+		span.sampled = parent.sampled
+	} else {
+		span.traceID = newTraceID()
+		span.sampled = t.sampleRatio >= 1 || mathrand.Float64() < t.sampleRatio
+	}
+	span.spanID = newSpanID()
+
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// StartChild begins a span only when ctx already carries one, so low-level calls
+// such as Redis and SQL queries are traced as part of a request but background
+// jobs do not each start a trace of their own
+func StartChild(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	if FromContext(ctx) == nil {
+		return ctx, nil
+	}
+	return Start(ctx, name, kind)
+}
+
+// SetAttribute records a string, integer, float or boolean attribute on the span
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if !s.recording() {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.attributes == nil {
+		s.attributes = make(map[string]interface{})
+	}
+	s.attributes[key] = value
+}
+
+// RecordError marks the span as failed with err's message
+func (s *Span) RecordError(err error) {
+	if err != nil {
+		s.SetError(err.Error())
+	}
+}
+
+// SetError marks the span as failed
+func (s *Span) SetError(message string) {
+	if !s.recording() {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errMessage = message
+}
+
+// recording reports whether the span collects attributes for export
+func (s *Span) recording() bool {
+	return s != nil && s.tracer != nil
+}
+
+// End finishes the span and queues it for export if its trace is sampled
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	if s.sampled && s.tracer != nil {
+		s.tracer.exporter.enqueue(s)
+	}
+}
+
+// TraceID returns the hex-encoded trace ID, or "" for a nil span
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.traceID[:])
+}
+
+// SpanID returns the hex-encoded span ID, or "" for a nil span
+func (s *Span) SpanID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.spanID[:])
+}
+
+func newTraceID() [16]byte {
+	var id [16]byte
+	rand.Read(id[:])
+	return id
+}
+
+func newSpanID() [8]byte {
+	var id [8]byte
+	rand.Read(id[:])
+	return id
+}
@@ -0,0 +1,160 @@
+package usage
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// requestLogMaxPending bounds the requests buffered between flushes; more are
+	// dropped rather than let a database outage grow memory without limit
+	requestLogMaxPending = 10000
+	// requestLogPurgeInterval is how often requests older than the retention
+	// period are deleted
+	requestLogPurgeInterval = time.Hour
+	// requestLogInsertBatch is how many rows one insert statement stores, well
+	// below MySQL's placeholder limit
+	requestLogInsertBatch = 500
+	// requestLogPurgeBatch is how many rows one purge statement deletes
+	requestLogPurgeBatch = 5000
+)
+
+// RequestLog buffers one entry per proxied request and stores them in batches,
+// deleting entries once they are older than the retention period
+type RequestLog struct {
+	keyRepo   types.KeyRepository
+	logger    *logrus.Logger
+	interval  time.Duration
+	retention time.Duration
+
+	pending chan types.RequestLogEntry
+	dropped atomic.Int64
+}
+
+// NewRequestLog creates a request log flushed every interval and keeping
+// entries for retention
+func NewRequestLog(keyRepo types.KeyRepository, logger *logrus.Logger, interval, retention time.Duration) *RequestLog {
+	return &RequestLog{
+		keyRepo:   keyRepo,
+		logger:    logger,
+		interval:  interval,
+		retention: retention,
+		pending:   make(chan types.RequestLogEntry, requestLogMaxPending),
+	}
+}
+
+// Record queues a request to be stored with the next flush
+func (l *RequestLog) Record(entry types.RequestLogEntry) {
+	if l == nil {
+		return
+	}
+	select {
+	case l.pending <- entry:
+	default:
+		l.dropped.Add(1)
+	}
+}
+
+// Start flushes the buffer every interval and purges expired entries at once
+// and then every hour until ctx is done
+func (l *RequestLog) Start(ctx context.Context) {
+	if l == nil {
+		return
+	}
+
+	go func() {
+		l.purge(ctx)
+
+		flush := time.NewTicker(l.interval)
+		defer flush.Stop()
+		purge := time.NewTicker(requestLogPurgeInterval)
+		defer purge.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-flush.C:
+				flushCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+				if err := l.Flush(flushCtx); err != nil {
+					l.logger.WithError(err).Warn("Failed to store request log")
+				}
+				cancel()
+			case <-purge.C:
+				l.purge(ctx)
+			}
+		}
+	}()
+}
+
+// purge runs one purge, logging a failure
+func (l *RequestLog) purge(ctx context.Context) {
+	purgeCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	if _, err := l.Purge(purgeCtx); err != nil {
+		l.logger.WithError(err).Warn("Failed to purge request log")
+	}
+}
+
+// Flush stores the buffered requests. Requests that fail to be stored are lost,
+// since the log is meant for inspection rather than accounting.
+func (l *RequestLog) Flush(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	entries := make([]types.RequestLogEntry, 0, len(l.pending))
+drain:
+	for len(entries) < requestLogMaxPending {
+		select {
+		case entry := <-l.pending:
+			entries = append(entries, entry)
+		default:
+			break drain
+		}
+	}
+
+	if dropped := l.dropped.Swap(0); dropped > 0 {
+		l.logger.WithField("dropped", dropped).Warn("Request log buffer was full, requests were not logged")
+	}
+
+	for start := 0; start < len(entries); start += requestLogInsertBatch {
+		if err := l.keyRepo.AddRequestLog(ctx, entries[start:min(start+requestLogInsertBatch, len(entries))]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Purge deletes requests older than the retention period in batches and
+// returns how many were deleted
+func (l *RequestLog) Purge(ctx context.Context) (int64, error) {
+	if l == nil {
+		return 0, nil
+	}
+
+	before := time.Now().Add(-l.retention)
+	var total int64
+	for {
+		purged, err := l.keyRepo.PurgeRequestLog(ctx, before, requestLogPurgeBatch)
+		total += purged
+		if err != nil {
+			return total, err
+		}
+		if purged < requestLogPurgeBatch {
+			break
+		}
+	}
+
+	if total > 0 {
+		l.logger.WithFields(logrus.Fields{
+			"purged": total,
+			"before": before.Format(time.RFC3339),
+		}).Info("Purged expired request log entries")
+	}
+	return total, nil
+}
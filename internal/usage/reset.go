@@ -0,0 +1,24 @@
+package usage
+
+import "time"
+
+// nextPlanReset returns when plan credits next refresh after now. A reset date
+// reported by Tavily wins; one that has already passed is rolled forward month by
+// month, since cached usage can outlive the cycle it was fetched in. Without one,
+// credits refresh at midnight UTC on resetDay of the month.
+func nextPlanReset(reported *time.Time, resetDay int, now time.Time) time.Time {
+	now = now.UTC()
+	if reported != nil && !reported.IsZero() {
+		reset := reported.UTC()
+		for months := 1; !reset.After(now); months++ {
+			reset = reported.UTC().AddDate(0, months, 0)
+		}
+		return reset
+	}
+
+	reset := time.Date(now.Year(), now.Month(), resetDay, 0, 0, 0, 0, time.UTC)
+	if !reset.After(now) {
+		reset = reset.AddDate(0, 1, 0)
+	}
+	return reset
+}
@@ -0,0 +1,225 @@
+package usage
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/repository"
+	"github.com/dbccccccc/tavily-load/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// rollupKey identifies one row of the hourly usage rollups
+type rollupKey struct {
+	key      string
+	endpoint string
+	hour     time.Time
+}
+
+// rollupCounts are the counters buffered for one rollup row
+type rollupCounts struct {
+	requests  int64
+	errors    int64
+	latencyMs int64
+}
+
+// HourlyRollup buffers per-key, per-endpoint request counts in memory and adds
+// them to the hourly rollup table in batches, so recording a request never
+// waits for the database
+type HourlyRollup struct {
+	keyRepo  types.KeyRepository
+	logger   *logrus.Logger
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending map[rollupKey]*rollupCounts
+}
+
+// NewHourlyRollup creates a rollup buffer flushed every interval
+func NewHourlyRollup(keyRepo types.KeyRepository, logger *logrus.Logger, interval time.Duration) *HourlyRollup {
+	return &HourlyRollup{
+		keyRepo:  keyRepo,
+		logger:   logger,
+		interval: interval,
+		pending:  make(map[rollupKey]*rollupCounts),
+	}
+}
+
+// Record counts one upstream attempt of a key against an endpoint
+func (r *HourlyRollup) Record(key, endpoint string, success bool, latency time.Duration) {
+	if r == nil {
+		return
+	}
+	path, _, _ := strings.Cut(endpoint, "?")
+	id := rollupKey{key: key, endpoint: path, hour: time.Now().Truncate(time.Hour)}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	counts, ok := r.pending[id]
+	if !ok {
+		counts = &rollupCounts{}
+		r.pending[id] = counts
+	}
+	counts.requests++
+	if !success {
+		counts.errors++
+	}
+	counts.latencyMs += latency.Milliseconds()
+}
+
+// Start flushes the buffer every interval until ctx is done
+func (r *HourlyRollup) Start(ctx context.Context) {
+	if r == nil {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				flushCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+				if err := r.Flush(flushCtx); err != nil {
+					r.logger.WithError(err).Warn("Failed to store hourly usage rollups")
+				}
+				cancel()
+			}
+		}
+	}()
+}
+
+// Flush writes the buffered counters. Counters that fail to be written are
+// kept and retried with the next flush.
+func (r *HourlyRollup) Flush(ctx context.Context) error {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = make(map[rollupKey]*rollupCounts)
+	r.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	usage := make([]repository.HourlyUsage, 0, len(pending))
+	for id, counts := range pending {
+		usage = append(usage, repository.HourlyUsage{
+			KeyValue:       id.key,
+			Endpoint:       id.endpoint,
+			HourStart:      id.hour,
+			RequestsCount:  counts.requests,
+			ErrorsCount:    counts.errors,
+			LatencyMsTotal: counts.latencyMs,
+		})
+	}
+
+	if err := r.keyRepo.AddHourlyUsage(ctx, usage); err != nil {
+		r.restore(pending)
+		return err
+	}
+	return nil
+}
+
+// restore merges counters that could not be written back into the buffer
+func (r *HourlyRollup) restore(pending map[rollupKey]*rollupCounts) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, counts := range pending {
+		current, ok := r.pending[id]
+		if !ok {
+			r.pending[id] = counts
+			continue
+		}
+		current.requests += counts.requests
+		current.errors += counts.errors
+		current.latencyMs += counts.latencyMs
+	}
+}
+
+const (
+	// dailyRollupInterval is how often the hourly rollups are summed into the
+	// daily rollups and old hourly rows are pruned
+	dailyRollupInterval = time.Hour
+	// hourlyPruneBatch is how many hourly rows one prune statement deletes
+	hourlyPruneBatch = 5000
+)
+
+// DailyRollup sums the hourly rollups into daily rollups and then deletes hourly
+// rows older than the retention period, so day-resolution history outlives them
+type DailyRollup struct {
+	keyRepo   types.KeyRepository
+	logger    *logrus.Logger
+	retention time.Duration
+}
+
+// NewDailyRollup creates a daily rollup keeping hourly rows for retention
+func NewDailyRollup(keyRepo types.KeyRepository, logger *logrus.Logger, retention time.Duration) *DailyRollup {
+	return &DailyRollup{keyRepo: keyRepo, logger: logger, retention: retention}
+}
+
+// Start runs the rollup at once and then every hour until ctx is done
+func (d *DailyRollup) Start(ctx context.Context) {
+	if d == nil {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(dailyRollupInterval)
+		defer ticker.Stop()
+
+		for {
+			runCtx, cancel := context.WithTimeout(ctx, time.Minute)
+			if _, err := d.Run(runCtx); err != nil {
+				d.logger.WithError(err).Warn("Failed to roll up daily usage")
+			}
+			cancel()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Run updates the daily rollups and then prunes expired hourly rows in batches,
+// returning how many were pruned. Nothing is pruned if the rollup fails, so no
+// hour is deleted before it is counted.
+func (d *DailyRollup) Run(ctx context.Context) (int64, error) {
+	if err := d.keyRepo.RollupDailyUsage(ctx); err != nil {
+		return 0, err
+	}
+
+	before := time.Now().Add(-d.retention).Truncate(time.Hour)
+	var total int64
+	for {
+		pruned, err := d.keyRepo.PruneHourlyUsage(ctx, before, hourlyPruneBatch)
+		total += pruned
+		if err != nil {
+			return total, err
+		}
+		if pruned < hourlyPruneBatch {
+			break
+		}
+	}
+
+	if total > 0 {
+		d.logger.WithFields(logrus.Fields{
+			"pruned": total,
+			"before": before.Format(time.RFC3339),
+		}).Info("Pruned hourly usage rollups")
+	}
+	return total, nil
+}
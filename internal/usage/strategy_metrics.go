@@ -0,0 +1,119 @@
+package usage
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/pkg/types"
+)
+
+const (
+	// strategyBucketSize is the granularity of strategy metric buckets
+	strategyBucketSize = time.Minute
+	// strategyMetricsRetention is how long strategy outcomes are kept for comparison
+	strategyMetricsRetention = 24 * time.Hour
+)
+
+// strategyBucket aggregates request outcomes for one strategy over one bucket
+type strategyBucket struct {
+	start          time.Time
+	requests       int64
+	successes      int64
+	totalLatency   time.Duration
+	costEfficiency float64
+	lastUsed       time.Time
+}
+
+// strategyMetricsRecorder keeps per-minute outcome buckets for each strategy
+type strategyMetricsRecorder struct {
+	mu      sync.Mutex
+	buckets map[types.SelectionStrategy][]*strategyBucket
+}
+
+func newStrategyMetricsRecorder() *strategyMetricsRecorder {
+	return &strategyMetricsRecorder{
+		buckets: make(map[types.SelectionStrategy][]*strategyBucket),
+	}
+}
+
+// record adds a request outcome for the strategy
+func (r *strategyMetricsRecorder) record(strategy types.SelectionStrategy, success bool, latency time.Duration, costEfficiency float64) {
+	now := time.Now()
+	bucketStart := now.Truncate(strategyBucketSize)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	buckets := r.buckets[strategy]
+	if len(buckets) == 0 || !buckets[len(buckets)-1].start.Equal(bucketStart) {
+		buckets = append(r.prune(buckets, now), &strategyBucket{start: bucketStart})
+	}
+
+	bucket := buckets[len(buckets)-1]
+	bucket.requests++
+	if success {
+		bucket.successes++
+	}
+	bucket.totalLatency += latency
+	bucket.costEfficiency += costEfficiency
+	bucket.lastUsed = now
+
+	r.buckets[strategy] = buckets
+}
+
+// prune drops buckets older than the retention period; callers must hold the lock
+func (r *strategyMetricsRecorder) prune(buckets []*strategyBucket, now time.Time) []*strategyBucket {
+	cutoff := now.Add(-strategyMetricsRetention)
+	i := 0
+	for i < len(buckets) && buckets[i].start.Before(cutoff) {
+		i++
+	}
+	return buckets[i:]
+}
+
+// snapshot aggregates the outcomes of every strategy within the window
+func (r *strategyMetricsRecorder) snapshot(window time.Duration) map[types.SelectionStrategy]*types.StrategyMetrics {
+	if window <= 0 || window > strategyMetricsRetention {
+		window = strategyMetricsRetention
+	}
+	cutoff := time.Now().Add(-window).Truncate(strategyBucketSize)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := make(map[types.SelectionStrategy]*types.StrategyMetrics)
+	for strategy, buckets := range r.buckets {
+		var requests, successes int64
+		var totalLatency time.Duration
+		var costEfficiency float64
+		var lastUsed time.Time
+
+		for _, bucket := range buckets {
+			if bucket.start.Before(cutoff) {
+				continue
+			}
+			requests += bucket.requests
+			successes += bucket.successes
+			totalLatency += bucket.totalLatency
+			costEfficiency += bucket.costEfficiency
+			if bucket.lastUsed.After(lastUsed) {
+				lastUsed = bucket.lastUsed
+			}
+		}
+
+		if requests == 0 {
+			continue
+		}
+
+		result[strategy] = &types.StrategyMetrics{
+			Strategy:       strategy,
+			TimesUsed:      requests,
+			SuccessRate:    float64(successes) / float64(requests),
+			AverageLatency: totalLatency / time.Duration(requests),
+			CostEfficiency: costEfficiency / float64(requests),
+			LastUsed:       lastUsed,
+		}
+	}
+
+	return result
+}
@@ -8,9 +8,9 @@ import (
 	"sync"
 	"time"
 
-	"github.com/dbccccccc/tavily-load/internal/cache"
 	"github.com/dbccccccc/tavily-load/internal/config"
 	"github.com/dbccccccc/tavily-load/internal/errors"
+	"github.com/dbccccccc/tavily-load/internal/strategy"
 	"github.com/dbccccccc/tavily-load/pkg/types"
 	"github.com/sirupsen/logrus"
 )
@@ -20,26 +20,26 @@ type Tracker struct {
 	config         *config.Config
 	logger         *logrus.Logger
 	httpClient     *http.Client
-	usageCache     *cache.UsageCache
-	memoryCache    sync.Map // map[string]*types.TavilyUsage - in-memory fallback
-	analytics      sync.Map // map[string]*types.KeyAnalytics
+	usageCache     types.UsageCache
+	memoryCache    sync.Map   // map[string]*types.TavilyUsage - in-memory fallback
+	analytics      sync.Map   // map[string]*types.KeyAnalytics, replaced rather than modified
+	analyticsMu    sync.Mutex // serializes analytics updates
 	strategies     map[types.SelectionStrategy]*types.UsageStrategy
 	mu             sync.RWMutex
 	lastUpdate     time.Time
 	updateInterval time.Duration
 	ctx            context.Context
+	keys           []string
+	requestWindow  *requestWindow
+	registry       *strategy.Registry
+	strategyStats  *strategyMetricsRecorder
 }
 
-// NewTracker creates a new usage tracker
-func NewTracker(cfg *config.Config, logger *logrus.Logger, usageCache *cache.UsageCache) *Tracker {
+// NewTracker creates a new usage tracker that looks up key usage through upstream
+func NewTracker(cfg *config.Config, logger *logrus.Logger, usageCache types.UsageCache, upstream http.RoundTripper) *Tracker {
 	client := &http.Client{
-		Timeout: cfg.RequestTimeout,
-		Transport: &http.Transport{
-			IdleConnTimeout:       cfg.IdleConnTimeout,
-			ResponseHeaderTimeout: cfg.ResponseTimeout,
-			MaxIdleConns:          10,
-			MaxIdleConnsPerHost:   5,
-		},
+		Timeout:   cfg.RequestTimeout,
+		Transport: upstream,
 	}
 
 	tracker := &Tracker{
@@ -50,6 +50,8 @@ func NewTracker(cfg *config.Config, logger *logrus.Logger, usageCache *cache.Usa
 		updateInterval: 5 * time.Minute, // Update usage every 5 minutes
 		strategies:     make(map[types.SelectionStrategy]*types.UsageStrategy),
 		ctx:            context.Background(),
+		requestWindow:  newRequestWindow(cfg.LeastUsedWindow),
+		strategyStats:  newStrategyMetricsRecorder(),
 	}
 
 	tracker.initializeStrategies()
@@ -77,6 +79,39 @@ func (t *Tracker) initializeStrategies() {
 		CostWeight:       0.0,
 		BalanceWeight:    1.0,
 	}
+
+	t.strategies[types.StrategyLeastUsed] = &types.UsageStrategy{
+		Strategy:         types.StrategyLeastUsed,
+		Description:      "Select the key with the fewest requests in the current window",
+		PreferPlan:       false,
+		PreferPaygo:      false,
+		ThresholdPercent: 0.0,
+		CostWeight:       0.0,
+		BalanceWeight:    1.0,
+	}
+
+	t.strategies[types.StrategyWeightedRandom] = &types.UsageStrategy{
+		Strategy:         types.StrategyWeightedRandom,
+		Description:      "Random selection weighted by each key's remaining credits",
+		PreferPlan:       false,
+		PreferPaygo:      false,
+		ThresholdPercent: 0.0,
+		CostWeight:       0.0,
+		BalanceWeight:    1.0,
+	}
+}
+
+// SetKeys sets the pool of keys known to the tracker
+func (t *Tracker) SetKeys(keys []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.keys = make([]string, len(keys))
+	copy(t.keys, keys)
+}
+
+// RecordKeyRequest counts a request routed to a key in the current window
+func (t *Tracker) RecordKeyRequest(key string) {
+	t.requestWindow.record(key)
 }
 
 // UpdateUsage updates the usage information for a specific key
@@ -84,7 +119,7 @@ func (t *Tracker) UpdateUsage(key string, usage *types.TavilyUsage) error {
 	// Store in Redis cache
 	ctx, cancel := context.WithTimeout(t.ctx, 2*time.Second)
 	defer cancel()
-	
+
 	if err := t.usageCache.SetUsage(ctx, key, usage); err != nil {
 		t.logger.WithError(err).Warn("Failed to cache usage in Redis, storing in memory")
 		t.memoryCache.Store(key, usage) // Fallback to memory
@@ -94,12 +129,13 @@ func (t *Tracker) UpdateUsage(key string, usage *types.TavilyUsage) error {
 	}
 
 	// Update analytics
-	analytics := t.getOrCreateKeyAnalytics(key)
-	analytics.Usage = usage
-	analytics.LastUpdated = time.Now()
-	analytics.RemainingPoints, _ = t.CalculateRemainingPoints(key)
-	analytics.HealthScore = t.calculateHealthScore(analytics)
-	analytics.CostEfficiency = t.calculateCostEfficiency(analytics)
+	analytics := t.updateKeyAnalytics(key, func(analytics *types.KeyAnalytics) {
+		analytics.Usage = usage
+		analytics.LastUpdated = time.Now()
+		analytics.RemainingPoints, _ = t.CalculateRemainingPoints(key)
+		analytics.HealthScore = t.calculateHealthScore(analytics)
+		analytics.CostEfficiency = t.calculateCostEfficiency(analytics)
+	})
 
 	// Cache analytics
 	ctx2, cancel2 := context.WithTimeout(t.ctx, 1*time.Second)
@@ -108,11 +144,10 @@ func (t *Tracker) UpdateUsage(key string, usage *types.TavilyUsage) error {
 		t.logger.WithError(err).Debug("Failed to cache analytics")
 	}
 
-	t.analytics.Store(key, analytics)
 	t.lastUpdate = time.Now()
 
 	t.logger.WithFields(logrus.Fields{
-		"key":             key[:12] + "...",
+		"key":             types.KeyPreview(key),
 		"key_usage":       usage.Key.Usage,
 		"key_limit":       usage.Key.Limit,
 		"plan_usage":      usage.Account.PlanUsage,
@@ -131,7 +166,7 @@ func (t *Tracker) GetUsage(key string) (*types.TavilyUsage, error) {
 	// Try Redis cache first
 	ctx, cancel := context.WithTimeout(t.ctx, 1*time.Second)
 	defer cancel()
-	
+
 	if usage, err := t.usageCache.GetUsage(ctx, key); err == nil {
 		return usage, nil
 	}
@@ -140,7 +175,7 @@ func (t *Tracker) GetUsage(key string) (*types.TavilyUsage, error) {
 	if usageInterface, ok := t.memoryCache.Load(key); ok {
 		return usageInterface.(*types.TavilyUsage), nil
 	}
-	
+
 	return nil, fmt.Errorf("usage information not found for key")
 }
 
@@ -174,7 +209,7 @@ func (t *Tracker) FetchUsageFromAPI(key string) (*types.TavilyUsage, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, errors.ParseHTTPError(resp.StatusCode, nil, key)
+		return nil, errors.ParseHTTPError(resp.StatusCode, resp.Header, nil, key)
 	}
 
 	var usage types.TavilyUsage
@@ -208,79 +243,64 @@ func (t *Tracker) CalculateRemainingPoints(key string) (*types.RemainingPoints,
 		paygoUtil = float64(usage.Account.PaygoUsage) / float64(usage.Account.PaygoLimit)
 	}
 
+	// Spread the plan credits left over the rest of the cycle; whatever is unused
+	// at the reset is lost
+	resetAt := nextPlanReset(usage.Account.PlanResetDate, t.config.PlanResetDay, time.Now())
+	daysUntilReset := time.Until(resetAt).Hours() / 24
+	var dailyAllowance float64
+	if planRemaining > 0 {
+		dailyAllowance = float64(planRemaining) / max(daysUntilReset, 1)
+	}
+
 	return &types.RemainingPoints{
-		KeyRemaining:     keyRemaining,
-		PlanRemaining:    planRemaining,
-		PaygoRemaining:   paygoRemaining,
-		TotalRemaining:   totalRemaining,
-		KeyUtilization:   keyUtil,
-		PlanUtilization:  planUtil,
-		PaygoUtilization: paygoUtil,
+		KeyRemaining:       keyRemaining,
+		PlanRemaining:      planRemaining,
+		PaygoRemaining:     paygoRemaining,
+		TotalRemaining:     totalRemaining,
+		KeyUtilization:     keyUtil,
+		PlanUtilization:    planUtil,
+		PaygoUtilization:   paygoUtil,
+		PlanResetAt:        &resetAt,
+		DaysUntilReset:     daysUntilReset,
+		PlanDailyAllowance: dailyAllowance,
 	}, nil
 }
 
 // GetOptimalKey selects the optimal key based on the given strategy
 func (t *Tracker) GetOptimalKey(strategy types.SelectionStrategy) (string, error) {
-	allUsage := t.GetAllUsage()
-	if len(allUsage) == 0 {
-		return "", fmt.Errorf("no usage information available")
-	}
-
-	switch strategy {
-	case types.StrategyPlanFirst:
-		return t.selectPlanFirstKey(allUsage)
-	default:
-		// Default to round-robin (handled by key manager)
-		return "", fmt.Errorf("strategy not implemented in usage tracker")
-	}
-}
-
-// Helper methods for different selection strategies
-
-func (t *Tracker) selectPlanFirstKey(allUsage map[string]*types.TavilyUsage) (string, error) {
-	// First pass: Look for keys with plan credits available
-	var bestPlanKey string
-	var mostPlanRemaining int = -1
+	t.mu.RLock()
+	keys := make([]string, len(t.keys))
+	copy(keys, t.keys)
+	registry := t.registry
+	t.mu.RUnlock()
 
-	for key := range allUsage {
-		remaining, err := t.CalculateRemainingPoints(key)
-		if err != nil || remaining.TotalRemaining <= 0 {
-			continue
-		}
-
-		// Prioritize keys with plan credits
-		if remaining.PlanRemaining > mostPlanRemaining {
-			mostPlanRemaining = remaining.PlanRemaining
-			bestPlanKey = key
-		}
-	}
-
-	// If we found a key with plan credits, use it
-	if bestPlanKey != "" && mostPlanRemaining > 0 {
-		return bestPlanKey, nil
+	if registry == nil {
+		return "", fmt.Errorf("no strategy registry configured")
 	}
 
-	// Second pass: No plan credits available, find key with most paygo credits
-	var bestPaygoKey string
-	var mostPaygoRemaining int = -1
+	return registry.Select(strategy, keys, t)
+}
 
-	for key := range allUsage {
-		remaining, err := t.CalculateRemainingPoints(key)
-		if err != nil || remaining.TotalRemaining <= 0 {
-			continue
-		}
+// SetRegistry sets the strategy registry used by GetOptimalKey
+func (t *Tracker) SetRegistry(registry *strategy.Registry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.registry = registry
+}
 
-		if remaining.PaygoRemaining > mostPaygoRemaining {
-			mostPaygoRemaining = remaining.PaygoRemaining
-			bestPaygoKey = key
-		}
-	}
+// WindowRequestCount returns the number of requests routed to a key in the current window
+func (t *Tracker) WindowRequestCount(key string) float64 {
+	return t.requestWindow.count(key)
+}
 
-	if bestPaygoKey != "" {
-		return bestPaygoKey, nil
+// ErrorRate returns the observed error rate of a key
+func (t *Tracker) ErrorRate(key string) float64 {
+	analyticsInterface, ok := t.analytics.Load(key)
+	if !ok {
+		return 0
 	}
-
-	return "", fmt.Errorf("no available keys with remaining quota")
+	analytics := analyticsInterface.(*types.KeyAnalytics)
+	return float64(analytics.ErrorCount) / float64(analytics.RequestCount+1)
 }
 
 // Helper methods for analytics
@@ -305,6 +325,19 @@ func (t *Tracker) getOrCreateKeyAnalytics(key string) *types.KeyAnalytics {
 	return analytics
 }
 
+// updateKeyAnalytics applies update to a copy of the analytics of key and stores
+// the copy. Stored analytics are never modified, so readers and the cache writes
+// still in flight do not race with the update.
+func (t *Tracker) updateKeyAnalytics(key string, update func(*types.KeyAnalytics)) *types.KeyAnalytics {
+	t.analyticsMu.Lock()
+	defer t.analyticsMu.Unlock()
+
+	analytics := *t.getOrCreateKeyAnalytics(key)
+	update(&analytics)
+	t.analytics.Store(key, &analytics)
+	return &analytics
+}
+
 func (t *Tracker) calculateHealthScore(analytics *types.KeyAnalytics) float64 {
 	if analytics.RequestCount == 0 {
 		return 1.0
@@ -360,34 +393,32 @@ func (t *Tracker) calculateCostEfficiency(analytics *types.KeyAnalytics) float64
 // UpdateKeyMetrics updates metrics for a key after a request
 func (t *Tracker) UpdateKeyMetrics(key string, success bool, latency time.Duration) {
 	// Update in Redis cache
-	ctx, cancel := context.WithTimeout(t.ctx, 1*time.Second)
-	defer cancel()
-	
 	go func() {
+		ctx, cancel := context.WithTimeout(t.ctx, 1*time.Second)
+		defer cancel()
 		if err := t.usageCache.IncrementKeyUsage(ctx, key, success); err != nil {
 			t.logger.WithError(err).Debug("Failed to update key metrics in cache")
 		}
 	}()
 
 	// Update analytics in memory
-	analytics := t.getOrCreateKeyAnalytics(key)
-	analytics.RequestCount++
-	analytics.LastUsed = time.Now()
+	analytics := t.updateKeyAnalytics(key, func(analytics *types.KeyAnalytics) {
+		analytics.RequestCount++
+		analytics.LastUsed = time.Now()
 
-	if !success {
-		analytics.ErrorCount++
-	}
+		if !success {
+			analytics.ErrorCount++
+		}
 
-	// Recalculate scores
-	analytics.HealthScore = t.calculateHealthScore(analytics)
-	analytics.CostEfficiency = t.calculateCostEfficiency(analytics)
-	analytics.RecommendedUse = analytics.HealthScore > 0.5 && analytics.RemainingPoints != nil && analytics.RemainingPoints.TotalRemaining > 0
+		// Recalculate scores
+		analytics.HealthScore = t.calculateHealthScore(analytics)
+		analytics.CostEfficiency = t.calculateCostEfficiency(analytics)
+		analytics.RecommendedUse = analytics.HealthScore > 0.5 && analytics.RemainingPoints != nil && analytics.RemainingPoints.TotalRemaining > 0
+	})
 
-	t.analytics.Store(key, analytics)
-	
 	// Cache updated analytics
 	go func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		ctx, cancel := context.WithTimeout(t.ctx, 2*time.Second)
 		defer cancel()
 		if err := t.usageCache.SetKeyAnalytics(ctx, key, analytics); err != nil {
 			t.logger.WithError(err).Debug("Failed to cache updated analytics")
@@ -395,6 +426,21 @@ func (t *Tracker) UpdateKeyMetrics(key string, success bool, latency time.Durati
 	}()
 }
 
+// RecordStrategyOutcome records the outcome of a request whose key was chosen by the strategy
+func (t *Tracker) RecordStrategyOutcome(strategy types.SelectionStrategy, key string, success bool, latency time.Duration) {
+	costEfficiency := 0.5
+	if analyticsInterface, ok := t.analytics.Load(key); ok {
+		costEfficiency = analyticsInterface.(*types.KeyAnalytics).CostEfficiency
+	}
+	t.strategyStats.record(strategy, success, latency, costEfficiency)
+}
+
+// GetStrategyMetrics returns per-strategy metrics aggregated over the window.
+// A zero window covers the full retention period.
+func (t *Tracker) GetStrategyMetrics(window time.Duration) map[types.SelectionStrategy]*types.StrategyMetrics {
+	return t.strategyStats.snapshot(window)
+}
+
 // GetRecommendedStrategy returns the recommended strategy based on current usage patterns
 func (t *Tracker) GetRecommendedStrategy() types.SelectionStrategy {
 	allUsage := t.GetAllUsage()
@@ -0,0 +1,67 @@
+package usage
+
+import (
+	"sync"
+	"time"
+)
+
+// requestWindow tracks per-key request counts over a sliding window.
+// It keeps the counts of the current and previous fixed windows and
+// weights the previous window by how much of it still overlaps "now".
+type requestWindow struct {
+	mu       sync.Mutex
+	size     time.Duration
+	start    time.Time
+	current  map[string]int64
+	previous map[string]int64
+}
+
+// newRequestWindow creates a sliding request window of the given size
+func newRequestWindow(size time.Duration) *requestWindow {
+	if size <= 0 {
+		size = time.Hour
+	}
+	return &requestWindow{
+		size:     size,
+		start:    time.Now(),
+		current:  make(map[string]int64),
+		previous: make(map[string]int64),
+	}
+}
+
+// record counts one request for the key
+func (w *requestWindow) record(key string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.rotate(time.Now())
+	w.current[key]++
+}
+
+// count returns the estimated number of requests for the key in the last window
+func (w *requestWindow) count(key string) float64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := time.Now()
+	w.rotate(now)
+
+	elapsed := float64(now.Sub(w.start)) / float64(w.size)
+	return float64(w.previous[key])*(1-elapsed) + float64(w.current[key])
+}
+
+// rotate advances the fixed windows; callers must hold the lock
+func (w *requestWindow) rotate(now time.Time) {
+	elapsed := now.Sub(w.start)
+	if elapsed < w.size {
+		return
+	}
+
+	if elapsed < 2*w.size {
+		w.previous = w.current
+	} else {
+		w.previous = make(map[string]int64)
+	}
+	w.current = make(map[string]int64)
+	w.start = now.Add(-(elapsed % w.size))
+}
@@ -0,0 +1,271 @@
+// Package webhooks notifies external services of key lifecycle events, such as a
+// key being blacklisted or a pool running out of active keys, so dead pools are
+// noticed before users report them. Every payload is signed with HMAC-SHA256 when
+// WEBHOOK_SECRET is set, and failed deliveries are retried with exponential
+// backoff. Webhooks are off unless WEBHOOK_URLS is set; until then New returns
+// nil, on which every method is a no-op.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dbccccccc/tavily-load/internal/config"
+	"github.com/dbccccccc/tavily-load/internal/events"
+	"github.com/dbccccccc/tavily-load/pkg/types"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Event types, named after the bus events they are sent for
+const (
+	EventKeyBlacklisted   = string(events.KeyBlacklisted)
+	EventKeyUnblacklisted = string(events.KeyUnblacklisted)
+	EventKeyExhausted     = string(events.KeyExhausted)
+	EventPoolLowKeys      = string(events.PoolLowKeys)
+	EventImportCompleted  = string(events.ImportCompleted)
+)
+
+// EventTypes lists every event a webhook can subscribe to
+var EventTypes = []string{
+	EventKeyBlacklisted,
+	EventKeyUnblacklisted,
+	EventKeyExhausted,
+	EventPoolLowKeys,
+	EventImportCompleted,
+}
+
+// Headers sent with every delivery. The signature is "sha256=" followed by the
+// hex HMAC-SHA256 of "<timestamp>.<body>" keyed with WEBHOOK_SECRET.
+const (
+	EventHeader     = "X-Tavily-Load-Event"
+	DeliveryHeader  = "X-Tavily-Load-Delivery"
+	TimestampHeader = "X-Tavily-Load-Timestamp"
+	SignatureHeader = "X-Tavily-Load-Signature"
+)
+
+const (
+	// queueSize bounds the events waiting to be sent; later events are dropped
+	queueSize = 256
+	// sendTimeout bounds a single delivery attempt
+	sendTimeout = 10 * time.Second
+	// maxBackoff caps the wait between two attempts
+	maxBackoff = 5 * time.Minute
+)
+
+// Event is the JSON body POSTed to every webhook URL
+type Event struct {
+	ID        string                 `json:"id"`
+	Type      string                 `json:"type"`
+	Timestamp time.Time              `json:"timestamp"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+// Dispatcher delivers events to the configured URLs in the background
+type Dispatcher struct {
+	urls        []string
+	secret      string
+	events      map[string]bool // subscribed event types, nil for all
+	maxAttempts int
+	backoff     time.Duration
+	client      *http.Client
+	logger      *logrus.Logger
+
+	queue   chan *Event
+	pending sync.WaitGroup
+}
+
+// New creates a dispatcher for WEBHOOK_URLS, or returns nil when it is not set
+func New(cfg *config.Config, logger *logrus.Logger) *Dispatcher {
+	if len(cfg.WebhookURLs) == 0 {
+		return nil
+	}
+
+	d := &Dispatcher{
+		urls:        cfg.WebhookURLs,
+		secret:      cfg.WebhookSecret,
+		maxAttempts: cfg.WebhookMaxAttempts,
+		backoff:     cfg.WebhookRetryBackoff,
+		client:      &http.Client{Timeout: sendTimeout},
+		logger:      logger,
+		queue:       make(chan *Event, queueSize),
+	}
+	if len(cfg.WebhookEvents) > 0 {
+		d.events = make(map[string]bool, len(cfg.WebhookEvents))
+		for _, event := range cfg.WebhookEvents {
+			d.events[event] = true
+		}
+	}
+	go d.run()
+	return d
+}
+
+// Subscribe sends a webhook for every bus event of a subscribable type
+func (d *Dispatcher) Subscribe(bus *events.Bus) {
+	if d == nil {
+		return
+	}
+	types := make([]events.Type, 0, len(EventTypes))
+	for _, eventType := range EventTypes {
+		types = append(types, events.Type(eventType))
+	}
+	bus.Subscribe(d.forward, types...)
+}
+
+// forward sends a bus event, identifying its key by the key's preview
+func (d *Dispatcher) forward(event events.Event) {
+	data := make(map[string]interface{}, len(event.Data)+1)
+	for name, value := range event.Data {
+		data[name] = value
+	}
+	if event.Key != "" {
+		data["key_preview"] = types.KeyPreview(event.Key)
+	}
+	d.Send(string(event.Type), data)
+}
+
+// Send queues an event without blocking the caller. Events the webhooks are not
+// subscribed to are ignored.
+func (d *Dispatcher) Send(eventType string, data map[string]interface{}) {
+	if d == nil || (d.events != nil && !d.events[eventType]) {
+		return
+	}
+
+	event := &Event{
+		ID:        uuid.New().String(),
+		Type:      eventType,
+		Timestamp: time.Now().UTC(),
+		Data:      data,
+	}
+
+	d.pending.Add(1)
+	select {
+	case d.queue <- event:
+	default:
+		d.pending.Done()
+		d.logger.WithField("event", eventType).Warn("Webhook queue full, event dropped")
+	}
+}
+
+// Flush waits for queued events to be delivered, giving up when ctx is done
+func (d *Dispatcher) Flush(ctx context.Context) error {
+	if d == nil {
+		return nil
+	}
+	done := make(chan struct{})
+	go func() {
+		d.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run hands each queued event to every URL. Deliveries run concurrently so a
+// slow or failing endpoint does not hold back the others or later events.
+func (d *Dispatcher) run() {
+	for event := range d.queue {
+		body, err := json.Marshal(event)
+		if err != nil {
+			d.logger.WithError(err).WithField("event", event.Type).Warn("Failed to encode webhook event")
+			d.pending.Done()
+			continue
+		}
+
+		var deliveries sync.WaitGroup
+		for _, url := range d.urls {
+			deliveries.Add(1)
+			go func(url string) {
+				defer deliveries.Done()
+				d.deliver(url, event, body)
+			}(url)
+		}
+		go func() {
+			deliveries.Wait()
+			d.pending.Done()
+		}()
+	}
+}
+
+// deliver posts an event to one URL, retrying network errors, 429 and 5xx
+// responses with exponential backoff until maxAttempts is reached
+func (d *Dispatcher) deliver(url string, event *Event, body []byte) {
+	wait := d.backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := d.send(url, event, body)
+		if err == nil {
+			return
+		}
+
+		entry := d.logger.WithError(err).WithFields(logrus.Fields{
+			"event":    event.Type,
+			"delivery": event.ID,
+			"attempt":  attempt,
+		})
+		if !retry || attempt >= d.maxAttempts {
+			entry.Warn("Webhook delivery failed")
+			return
+		}
+		entry.WithField("retry_in", wait).Debug("Webhook delivery failed, retrying")
+
+		time.Sleep(wait)
+		wait = min(2*wait, maxBackoff)
+	}
+}
+
+// send makes a single delivery attempt and reports whether a failure is worth retrying
+func (d *Dispatcher) send(url string, event *Event, body []byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	timestamp := strconv.FormatInt(event.Timestamp.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "tavily-load/1.0")
+	req.Header.Set(EventHeader, event.Type)
+	req.Header.Set(DeliveryHeader, event.ID)
+	req.Header.Set(TimestampHeader, timestamp)
+	if d.secret != "" {
+		req.Header.Set(SignatureHeader, Sign(d.secret, timestamp, body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return retry, fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return false, nil
+}
+
+// Sign returns the signature header value of a payload, for receivers to
+// recompute and compare against SignatureHeader
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
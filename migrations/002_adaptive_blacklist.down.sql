@@ -0,0 +1,3 @@
+ALTER TABLE key_blacklist_history
+    DROP COLUMN duration_seconds,
+    DROP COLUMN strike_count;
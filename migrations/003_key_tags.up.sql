@@ -0,0 +1,10 @@
+-- Create key_tags table for labeling keys
+CREATE TABLE key_tags (
+    key_id BIGINT NOT NULL,
+    tag VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (key_id, tag),
+    FOREIGN KEY (key_id) REFERENCES api_keys(id) ON DELETE CASCADE,
+    INDEX idx_tag (tag)
+);
@@ -0,0 +1,4 @@
+-- Group keys into named pools
+ALTER TABLE api_keys
+    ADD COLUMN pool VARCHAR(64) NOT NULL DEFAULT 'default',
+    ADD INDEX idx_pool (pool);
@@ -0,0 +1,3 @@
+ALTER TABLE api_keys
+    DROP INDEX idx_key_hash,
+    DROP COLUMN key_hash;
@@ -0,0 +1,9 @@
+-- Look keys up by their SHA-256 digest so plaintext values stay out of query logs
+ALTER TABLE api_keys
+    ADD COLUMN key_hash CHAR(64) NULL AFTER key_value;
+
+UPDATE api_keys SET key_hash = SHA2(key_value, 256);
+
+ALTER TABLE api_keys
+    MODIFY COLUMN key_hash CHAR(64) NOT NULL,
+    ADD UNIQUE INDEX idx_key_hash (key_hash);
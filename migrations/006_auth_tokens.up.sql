@@ -0,0 +1,16 @@
+-- Create auth_tokens table for named client tokens with their own limits
+CREATE TABLE auth_tokens (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    token_prefix VARCHAR(16) NOT NULL,
+    rate_limit_rpm INT NOT NULL DEFAULT 0,
+    daily_credit_quota INT NOT NULL DEFAULT 0,
+    allowed_endpoints TEXT,
+    scopes VARCHAR(255) NOT NULL DEFAULT '',
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+    INDEX idx_active (is_active)
+);
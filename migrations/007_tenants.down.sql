@@ -0,0 +1,6 @@
+ALTER TABLE auth_tokens
+    DROP INDEX idx_tenant,
+    DROP COLUMN tenant;
+ALTER TABLE api_keys
+    DROP INDEX idx_tenant,
+    DROP COLUMN tenant;
@@ -0,0 +1,7 @@
+-- Assign keys and auth tokens to tenants
+ALTER TABLE api_keys
+    ADD COLUMN tenant VARCHAR(64) NOT NULL DEFAULT 'default',
+    ADD INDEX idx_tenant (tenant);
+ALTER TABLE auth_tokens
+    ADD COLUMN tenant VARCHAR(64) NOT NULL DEFAULT 'default',
+    ADD INDEX idx_tenant (tenant);
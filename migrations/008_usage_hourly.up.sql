@@ -0,0 +1,14 @@
+-- Hourly per-key, per-endpoint usage rollups for time-series analytics
+CREATE TABLE key_usage_hourly (
+    key_id BIGINT NOT NULL,
+    endpoint VARCHAR(128) NOT NULL,
+    hour_start TIMESTAMP NOT NULL,
+    requests_count BIGINT NOT NULL DEFAULT 0,
+    errors_count BIGINT NOT NULL DEFAULT 0,
+    latency_ms_total BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (key_id, endpoint, hour_start),
+    FOREIGN KEY (key_id) REFERENCES api_keys(id) ON DELETE CASCADE,
+    INDEX idx_hour_start (hour_start)
+);
@@ -0,0 +1,12 @@
+-- Generated daily and weekly usage reports
+CREATE TABLE usage_reports (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    period VARCHAR(16) NOT NULL,
+    period_start TIMESTAMP NOT NULL,
+    period_end TIMESTAMP NOT NULL,
+    body MEDIUMTEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    UNIQUE KEY uniq_period (period, period_start),
+    INDEX idx_period_start (period_start)
+);
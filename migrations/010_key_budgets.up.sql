@@ -0,0 +1,12 @@
+-- Per-key credit budgets; 0 leaves a budget unset
+CREATE TABLE key_budgets (
+    key_id BIGINT PRIMARY KEY,
+    daily_soft INT NOT NULL DEFAULT 0,
+    daily_hard INT NOT NULL DEFAULT 0,
+    monthly_soft INT NOT NULL DEFAULT 0,
+    monthly_hard INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+    FOREIGN KEY (key_id) REFERENCES api_keys(id) ON DELETE CASCADE
+);
@@ -0,0 +1,21 @@
+-- One row per proxied request, kept for REQUEST_LOG_RETENTION
+CREATE TABLE request_log (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    created_at TIMESTAMP(3) NOT NULL,
+    request_id VARCHAR(64),
+    method VARCHAR(8) NOT NULL,
+    endpoint VARCHAR(128) NOT NULL,
+    client_ip VARCHAR(64),
+    tenant VARCHAR(64),
+    key_id BIGINT NULL,
+    status_code INT NOT NULL,
+    latency_ms INT NOT NULL,
+    upstream_latency_ms INT NOT NULL DEFAULT 0,
+    retries INT NOT NULL DEFAULT 0,
+    cache_status VARCHAR(16),
+
+    FOREIGN KEY (key_id) REFERENCES api_keys(id) ON DELETE SET NULL,
+    INDEX idx_created_at (created_at),
+    INDEX idx_key_created (key_id, created_at),
+    INDEX idx_tenant_created (tenant, created_at)
+);
@@ -0,0 +1,9 @@
+DELETE FROM api_keys WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE api_keys
+    DROP INDEX idx_deleted_at,
+    DROP COLUMN deleted_at,
+    MODIFY COLUMN key_hash CHAR(64) NOT NULL,
+    ADD UNIQUE INDEX key_value (key_value);
+
+DROP TABLE IF EXISTS audit_log;
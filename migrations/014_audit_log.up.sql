@@ -0,0 +1,25 @@
+-- Audit trail of key changes: who made them, when, and the key before and after.
+-- key_id has no foreign key so entries outlive the keys they describe.
+CREATE TABLE audit_log (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    actor VARCHAR(128) NOT NULL,
+    action VARCHAR(64) NOT NULL,
+    key_id BIGINT NULL,
+    tenant VARCHAR(64) NULL,
+    before_value JSON NULL,
+    after_value JSON NULL,
+
+    INDEX idx_created_at (created_at),
+    INDEX idx_key_created (key_id, created_at),
+    INDEX idx_actor_created (actor, created_at),
+    INDEX idx_action_created (action, created_at)
+);
+
+-- Deleted keys are kept with their history. Their hash is cleared, which keeps
+-- them out of value lookups and lets the same value be added again.
+ALTER TABLE api_keys
+    ADD COLUMN deleted_at TIMESTAMP NULL,
+    MODIFY COLUMN key_hash CHAR(64) NULL,
+    DROP INDEX key_value,
+    ADD INDEX idx_deleted_at (deleted_at);
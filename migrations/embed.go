@@ -0,0 +1,28 @@
+// Package migrations embeds the schema migrations into the binary so deployments
+// do not need to ship the SQL files alongside it
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+	"os"
+)
+
+// FS holds the NNN_name.up.sql and NNN_name.down.sql migration pairs for MySQL,
+// and in sqlite/ the same migrations for SQLite
+//
+//go:embed *.sql sqlite/*.sql
+var FS embed.FS
+
+// Source returns the migrations to apply for driver: the directory at path when
+// it is set, such as MIGRATION_PATH, otherwise the ones built into the binary
+func Source(driver, path string) fs.FS {
+	if path != "" {
+		return os.DirFS(path)
+	}
+	if driver == "sqlite" {
+		sqlite, _ := fs.Sub(FS, "sqlite")
+		return sqlite
+	}
+	return FS
+}
@@ -0,0 +1,4 @@
+-- Drop tables in reverse order of dependencies
+DROP TABLE IF EXISTS key_blacklist_history;
+DROP TABLE IF EXISTS key_usage_stats;
+DROP TABLE IF EXISTS api_keys;
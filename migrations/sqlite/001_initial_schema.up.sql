@@ -0,0 +1,63 @@
+-- SQLite version of the initial schema. Index names are unique per database
+-- rather than per table, so they are prefixed with their table. Triggers stand in
+-- for MySQL's ON UPDATE CURRENT_TIMESTAMP.
+
+-- Create api_keys table
+CREATE TABLE api_keys (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    key_value VARCHAR(255) NOT NULL,
+    name VARCHAR(255),
+    description TEXT,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    is_blacklisted BOOLEAN NOT NULL DEFAULT FALSE,
+    blacklisted_until TIMESTAMP NULL,
+    blacklist_reason VARCHAR(500),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX uniq_api_keys_key_value ON api_keys (key_value);
+CREATE INDEX idx_api_keys_key_value ON api_keys (key_value);
+CREATE INDEX idx_api_keys_active ON api_keys (is_active);
+CREATE INDEX idx_api_keys_blacklisted ON api_keys (is_blacklisted);
+CREATE INDEX idx_api_keys_blacklisted_until ON api_keys (blacklisted_until);
+CREATE TRIGGER api_keys_updated_at AFTER UPDATE ON api_keys
+    WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE api_keys SET updated_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
+
+-- Create key_usage_stats table
+CREATE TABLE key_usage_stats (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    key_id BIGINT NOT NULL,
+    requests_count BIGINT NOT NULL DEFAULT 0,
+    errors_count BIGINT NOT NULL DEFAULT 0,
+    last_used_at TIMESTAMP NULL,
+    last_error_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    FOREIGN KEY (key_id) REFERENCES api_keys(id) ON DELETE CASCADE
+);
+-- Unique, unlike in MySQL: an upsert in SQLite names the constraint it conflicts on
+CREATE UNIQUE INDEX idx_key_usage_stats_key_id ON key_usage_stats (key_id);
+CREATE INDEX idx_key_usage_stats_last_used ON key_usage_stats (last_used_at);
+CREATE TRIGGER key_usage_stats_updated_at AFTER UPDATE ON key_usage_stats
+    WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE key_usage_stats SET updated_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
+
+-- Create key_blacklist_history table
+CREATE TABLE key_blacklist_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    key_id BIGINT NOT NULL,
+    blacklisted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    blacklisted_until TIMESTAMP NULL,
+    reason VARCHAR(500),
+    is_permanent BOOLEAN NOT NULL DEFAULT FALSE,
+
+    FOREIGN KEY (key_id) REFERENCES api_keys(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_key_blacklist_history_key_id ON key_blacklist_history (key_id);
+CREATE INDEX idx_key_blacklist_history_blacklisted_at ON key_blacklist_history (blacklisted_at);
@@ -0,0 +1,2 @@
+ALTER TABLE key_blacklist_history DROP COLUMN duration_seconds;
+ALTER TABLE key_blacklist_history DROP COLUMN strike_count;
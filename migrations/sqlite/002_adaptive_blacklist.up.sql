@@ -0,0 +1,3 @@
+-- Track escalating blacklist backoff per history entry
+ALTER TABLE key_blacklist_history ADD COLUMN strike_count INT NOT NULL DEFAULT 0;
+ALTER TABLE key_blacklist_history ADD COLUMN duration_seconds BIGINT NULL;
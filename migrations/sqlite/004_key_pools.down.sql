@@ -0,0 +1,2 @@
+DROP INDEX idx_api_keys_pool;
+ALTER TABLE api_keys DROP COLUMN pool;
@@ -0,0 +1,3 @@
+-- Group keys into named pools
+ALTER TABLE api_keys ADD COLUMN pool VARCHAR(64) NOT NULL DEFAULT 'default';
+CREATE INDEX idx_api_keys_pool ON api_keys (pool);
@@ -0,0 +1,2 @@
+DROP INDEX idx_api_keys_key_hash;
+ALTER TABLE api_keys DROP COLUMN key_hash;
@@ -0,0 +1,6 @@
+-- Look keys up by their SHA-256 digest so plaintext values stay out of query logs.
+-- SQLite has no SHA2, but no SQLite database holds keys from before this
+-- migration. The column stays nullable, as SQLite cannot change that afterwards
+-- and migration 014 makes it nullable anyway.
+ALTER TABLE api_keys ADD COLUMN key_hash CHAR(64) NULL;
+CREATE UNIQUE INDEX idx_api_keys_key_hash ON api_keys (key_hash);
@@ -0,0 +1,20 @@
+-- Create auth_tokens table for named client tokens with their own limits
+CREATE TABLE auth_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    token_prefix VARCHAR(16) NOT NULL,
+    rate_limit_rpm INT NOT NULL DEFAULT 0,
+    daily_credit_quota INT NOT NULL DEFAULT 0,
+    allowed_endpoints TEXT,
+    scopes VARCHAR(255) NOT NULL DEFAULT '',
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_auth_tokens_active ON auth_tokens (is_active);
+CREATE TRIGGER auth_tokens_updated_at AFTER UPDATE ON auth_tokens
+    WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE auth_tokens SET updated_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
@@ -0,0 +1,4 @@
+DROP INDEX idx_auth_tokens_tenant;
+ALTER TABLE auth_tokens DROP COLUMN tenant;
+DROP INDEX idx_api_keys_tenant;
+ALTER TABLE api_keys DROP COLUMN tenant;
@@ -0,0 +1,5 @@
+-- Assign keys and auth tokens to tenants
+ALTER TABLE api_keys ADD COLUMN tenant VARCHAR(64) NOT NULL DEFAULT 'default';
+CREATE INDEX idx_api_keys_tenant ON api_keys (tenant);
+ALTER TABLE auth_tokens ADD COLUMN tenant VARCHAR(64) NOT NULL DEFAULT 'default';
+CREATE INDEX idx_auth_tokens_tenant ON auth_tokens (tenant);
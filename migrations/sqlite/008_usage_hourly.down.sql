@@ -0,0 +1 @@
+DROP TABLE IF EXISTS key_usage_hourly;
@@ -0,0 +1,19 @@
+-- Hourly per-key, per-endpoint usage rollups for time-series analytics
+CREATE TABLE key_usage_hourly (
+    key_id BIGINT NOT NULL,
+    endpoint VARCHAR(128) NOT NULL,
+    hour_start TIMESTAMP NOT NULL,
+    requests_count BIGINT NOT NULL DEFAULT 0,
+    errors_count BIGINT NOT NULL DEFAULT 0,
+    latency_ms_total BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (key_id, endpoint, hour_start),
+    FOREIGN KEY (key_id) REFERENCES api_keys(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_key_usage_hourly_hour_start ON key_usage_hourly (hour_start);
+CREATE TRIGGER key_usage_hourly_updated_at AFTER UPDATE ON key_usage_hourly
+    WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE key_usage_hourly SET updated_at = CURRENT_TIMESTAMP WHERE rowid = NEW.rowid;
+END;
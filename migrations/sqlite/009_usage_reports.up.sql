@@ -0,0 +1,11 @@
+-- Generated daily and weekly usage reports
+CREATE TABLE usage_reports (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    period VARCHAR(16) NOT NULL,
+    period_start TIMESTAMP NOT NULL,
+    period_end TIMESTAMP NOT NULL,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX uniq_usage_reports_period ON usage_reports (period, period_start);
+CREATE INDEX idx_usage_reports_period_start ON usage_reports (period_start);
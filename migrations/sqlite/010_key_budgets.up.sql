@@ -0,0 +1,17 @@
+-- Per-key credit budgets; 0 leaves a budget unset
+CREATE TABLE key_budgets (
+    key_id BIGINT PRIMARY KEY,
+    daily_soft INT NOT NULL DEFAULT 0,
+    daily_hard INT NOT NULL DEFAULT 0,
+    monthly_soft INT NOT NULL DEFAULT 0,
+    monthly_hard INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    FOREIGN KEY (key_id) REFERENCES api_keys(id) ON DELETE CASCADE
+);
+CREATE TRIGGER key_budgets_updated_at AFTER UPDATE ON key_budgets
+    WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE key_budgets SET updated_at = CURRENT_TIMESTAMP WHERE key_id = NEW.key_id;
+END;
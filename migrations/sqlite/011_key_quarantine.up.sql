@@ -0,0 +1,9 @@
+-- Keys taken out of rotation by anomaly detection, pending operator review
+CREATE TABLE key_quarantine (
+    key_id BIGINT PRIMARY KEY,
+    reason VARCHAR(64) NOT NULL,
+    details TEXT,
+    quarantined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    FOREIGN KEY (key_id) REFERENCES api_keys(id) ON DELETE CASCADE
+);
@@ -0,0 +1,21 @@
+-- One row per proxied request, kept for REQUEST_LOG_RETENTION
+CREATE TABLE request_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at TIMESTAMP NOT NULL,
+    request_id VARCHAR(64),
+    method VARCHAR(8) NOT NULL,
+    endpoint VARCHAR(128) NOT NULL,
+    client_ip VARCHAR(64),
+    tenant VARCHAR(64),
+    key_id BIGINT NULL,
+    status_code INT NOT NULL,
+    latency_ms INT NOT NULL,
+    upstream_latency_ms INT NOT NULL DEFAULT 0,
+    retries INT NOT NULL DEFAULT 0,
+    cache_status VARCHAR(16),
+
+    FOREIGN KEY (key_id) REFERENCES api_keys(id) ON DELETE SET NULL
+);
+CREATE INDEX idx_request_log_created_at ON request_log (created_at);
+CREATE INDEX idx_request_log_key_created ON request_log (key_id, created_at);
+CREATE INDEX idx_request_log_tenant_created ON request_log (tenant, created_at);
@@ -0,0 +1,20 @@
+-- Daily per-key, per-endpoint usage rolled up from key_usage_hourly, so hourly
+-- rows can be pruned while day-resolution time series stay available
+CREATE TABLE key_usage_daily (
+    key_id BIGINT NOT NULL,
+    endpoint VARCHAR(128) NOT NULL,
+    day DATE NOT NULL,
+    requests_count BIGINT NOT NULL DEFAULT 0,
+    errors_count BIGINT NOT NULL DEFAULT 0,
+    latency_ms_total BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (key_id, endpoint, day),
+    FOREIGN KEY (key_id) REFERENCES api_keys(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_key_usage_daily_day ON key_usage_daily (day);
+CREATE TRIGGER key_usage_daily_updated_at AFTER UPDATE ON key_usage_daily
+    WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE key_usage_daily SET updated_at = CURRENT_TIMESTAMP WHERE rowid = NEW.rowid;
+END;
@@ -0,0 +1,7 @@
+DELETE FROM api_keys WHERE deleted_at IS NOT NULL;
+
+DROP INDEX idx_api_keys_deleted_at;
+ALTER TABLE api_keys DROP COLUMN deleted_at;
+CREATE UNIQUE INDEX uniq_api_keys_key_value ON api_keys (key_value);
+
+DROP TABLE IF EXISTS audit_log;
@@ -0,0 +1,22 @@
+-- Audit trail of key changes: who made them, when, and the key before and after.
+-- key_id has no foreign key so entries outlive the keys they describe.
+CREATE TABLE audit_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    actor VARCHAR(128) NOT NULL,
+    action VARCHAR(64) NOT NULL,
+    key_id BIGINT NULL,
+    tenant VARCHAR(64) NULL,
+    before_value TEXT NULL,
+    after_value TEXT NULL
+);
+CREATE INDEX idx_audit_log_created_at ON audit_log (created_at);
+CREATE INDEX idx_audit_log_key_created ON audit_log (key_id, created_at);
+CREATE INDEX idx_audit_log_actor_created ON audit_log (actor, created_at);
+CREATE INDEX idx_audit_log_action_created ON audit_log (action, created_at);
+
+-- Deleted keys are kept with their history. Their hash is cleared, which keeps
+-- them out of value lookups and lets the same value be added again.
+ALTER TABLE api_keys ADD COLUMN deleted_at TIMESTAMP NULL;
+DROP INDEX uniq_api_keys_key_value;
+CREATE INDEX idx_api_keys_deleted_at ON api_keys (deleted_at);
@@ -0,0 +1,322 @@
+// Package tavilymock provides an in-process fake of the Tavily API built on
+// net/http/httptest. It implements /search, /extract and /usage with scriptable
+// per-key quotas, scripted failures (such as 429 and 432) and added latency, so
+// the proxy's retry and blacklist paths can be exercised end to end.
+//
+//	mock := tavilymock.New()
+//	defer mock.Close()
+//	mock.SetQuota("tvly-a", 10)
+//	mock.FailNext("tvly-b", http.StatusTooManyRequests, 2)
+//	cfg.TavilyBaseURL = mock.URL()
+package tavilymock
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StatusPlanLimitExceeded and StatusPaygoLimitExceeded are the Tavily status codes
+// for exhausted plan and pay-as-you-go credits
+const (
+	StatusPlanLimitExceeded  = 432
+	StatusPaygoLimitExceeded = 433
+)
+
+// Server is a fake Tavily API. Keys are accepted as bearer tokens or X-API-Key
+// headers; unknown keys are accepted with an unlimited quota unless SetStrict is enabled.
+type Server struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	strict  bool
+	latency time.Duration
+	keys    map[string]*keyState
+}
+
+// keyState is the scripted behaviour and observed traffic of one key
+type keyState struct {
+	limit    int // 0 = unlimited
+	usage    int
+	revoked  bool
+	failures []int // status codes returned by the next requests, in order
+	requests int
+}
+
+// New starts a mock server; callers must Close it
+func New() *Server {
+	s := &Server{keys: make(map[string]*keyState)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/search", s.handleSearch)
+	mux.HandleFunc("/extract", s.handleExtract)
+	mux.HandleFunc("/usage", s.handleUsage)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// URL returns the base URL to use as TAVILY_BASE_URL
+func (s *Server) URL() string {
+	return s.Server.URL
+}
+
+// SetStrict makes the mock reject keys that were not configured with SetQuota
+func (s *Server) SetStrict(strict bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.strict = strict
+}
+
+// SetLatency delays every response by d
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// SetQuota registers key with a credit limit (0 = unlimited). Once its usage
+// reaches the limit, requests fail with 432.
+func (s *Server) SetQuota(key string, limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state(key).limit = limit
+}
+
+// Revoke makes every request with key fail with 401
+func (s *Server) Revoke(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state(key).revoked = true
+}
+
+// FailNext makes the next n requests with key fail with status
+func (s *Server) FailNext(key string, status, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := s.state(key)
+	for i := 0; i < n; i++ {
+		state.failures = append(state.failures, status)
+	}
+}
+
+// Requests returns how many requests were received with key, including failed ones
+func (s *Server) Requests(key string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state, ok := s.keys[key]; ok {
+		return state.requests
+	}
+	return 0
+}
+
+// Usage returns the credits key has spent on successful requests
+func (s *Server) Usage(key string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state, ok := s.keys[key]; ok {
+		return state.usage
+	}
+	return 0
+}
+
+// Reset forgets all keys, usage and scripted failures
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = make(map[string]*keyState)
+	s.latency = 0
+}
+
+// state returns the state of key, creating it; the caller must hold s.mu
+func (s *Server) state(key string) *keyState {
+	state, ok := s.keys[key]
+	if !ok {
+		state = &keyState{}
+		s.keys[key] = state
+	}
+	return state
+}
+
+// admit authenticates the request and applies latency, scripted failures and
+// quotas. It returns the key when the request may proceed; otherwise the error
+// response has been written.
+func (s *Server) admit(w http.ResponseWriter, r *http.Request, chargeCredit bool) (string, bool) {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		key = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+
+	s.mu.Lock()
+	latency := s.latency
+	s.mu.Unlock()
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return "", false
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key == "" {
+		writeError(w, http.StatusUnauthorized, "Unauthorized: missing or invalid API key.")
+		return "", false
+	}
+	if _, known := s.keys[key]; !known && s.strict {
+		writeError(w, http.StatusUnauthorized, "Unauthorized: missing or invalid API key.")
+		return "", false
+	}
+
+	state := s.state(key)
+	state.requests++
+
+	if state.revoked {
+		writeError(w, http.StatusUnauthorized, "Unauthorized: missing or invalid API key.")
+		return "", false
+	}
+	if len(state.failures) > 0 {
+		status := state.failures[0]
+		state.failures = state.failures[1:]
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "1")
+		}
+		writeError(w, status, http.StatusText(status))
+		return "", false
+	}
+	if chargeCredit {
+		if state.limit > 0 && state.usage >= state.limit {
+			writeError(w, StatusPlanLimitExceeded, "This request exceeds your plan's set usage limit.")
+			return "", false
+		}
+		state.usage++
+	}
+
+	return key, true
+}
+
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var body struct {
+		Query      string `json:"query"`
+		MaxResults int    `json:"max_results"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Query == "" {
+		writeError(w, http.StatusBadRequest, "query is required")
+		return
+	}
+	if _, ok := s.admit(w, r, true); !ok {
+		return
+	}
+
+	count := body.MaxResults
+	if count <= 0 {
+		count = 5
+	}
+	results := make([]map[string]interface{}, 0, count)
+	for i := 0; i < count; i++ {
+		results = append(results, map[string]interface{}{
+			"title":   "Mock result",
+			"url":     "https://example.com/" + strings.ReplaceAll(body.Query, " ", "-"),
+			"content": "Mock content for " + body.Query,
+			"score":   1 - float64(i)/float64(count),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"query":         body.Query,
+		"answer":        nil,
+		"images":        []interface{}{},
+		"results":       results,
+		"response_time": 0.01,
+	})
+}
+
+func (s *Server) handleExtract(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var body struct {
+		URLs interface{} `json:"urls"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "urls is required")
+		return
+	}
+
+	var urls []string
+	switch v := body.URLs.(type) {
+	case string:
+		urls = []string{v}
+	case []interface{}:
+		for _, u := range v {
+			if url, ok := u.(string); ok {
+				urls = append(urls, url)
+			}
+		}
+	}
+	if len(urls) == 0 {
+		writeError(w, http.StatusBadRequest, "urls is required")
+		return
+	}
+	if _, ok := s.admit(w, r, true); !ok {
+		return
+	}
+
+	results := make([]map[string]interface{}, 0, len(urls))
+	for _, u := range urls {
+		results = append(results, map[string]interface{}{
+			"url":         u,
+			"raw_content": "Mock content of " + u,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"results":        results,
+		"failed_results": []interface{}{},
+		"response_time":  0.01,
+	})
+}
+
+func (s *Server) handleUsage(w http.ResponseWriter, r *http.Request) {
+	key, ok := s.admit(w, r, false)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	state := s.state(key)
+	usage, limit := state.usage, state.limit
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"key": map[string]int{"usage": usage, "limit": limit},
+		"account": map[string]interface{}{
+			"current_plan": "mock",
+			"plan_usage":   usage,
+			"plan_limit":   limit,
+			"paygo_usage":  0,
+			"paygo_limit":  0,
+		},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeError writes an error in Tavily's {"detail": {"error": ...}} shape
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"detail": map[string]string{"error": message},
+	})
+}
@@ -2,6 +2,7 @@ package types
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"time"
 )
@@ -36,33 +37,90 @@ type KeyStats struct {
 
 // KeyStatus represents the status of an API key
 type KeyStatus struct {
-	Active        bool      `json:"active"`
-	ErrorCount    int       `json:"error_count"`
-	RequestCount  int       `json:"request_count"`
-	LastUsed      time.Time `json:"last_used"`
-	LastError     string    `json:"last_error,omitempty"`
-	BlacklistedAt time.Time `json:"blacklisted_at,omitempty"`
-	Permanent     bool      `json:"permanent"`
+	Active        bool         `json:"active"`
+	ErrorCount    int          `json:"error_count"`
+	RequestCount  int          `json:"request_count"`
+	LastUsed      time.Time    `json:"last_used"`
+	LastError     string       `json:"last_error,omitempty"`
+	BlacklistedAt time.Time    `json:"blacklisted_at,omitempty"`
+	Permanent     bool         `json:"permanent"`
+	CircuitState  CircuitState `json:"circuit_state"`
+	// ProbationUntil is set while a key that came back from the blacklist is warming up
+	ProbationUntil *time.Time `json:"probation_until,omitempty"`
+	// Quarantined is set while a key is held out of rotation pending operator review
+	Quarantined bool `json:"quarantined,omitempty"`
 }
 
+// CircuitState represents the circuit breaker state of a key
+type CircuitState string
+
+const (
+	// CircuitClosed lets all traffic through the key
+	CircuitClosed CircuitState = "closed"
+	// CircuitOpen blocks the key while it is blacklisted
+	CircuitOpen CircuitState = "open"
+	// CircuitHalfOpen lets limited probe traffic through before the key is reinstated
+	CircuitHalfOpen CircuitState = "half_open"
+)
+
 // BlacklistEntry represents a blacklisted key
 type BlacklistEntry struct {
+	Key              string        `json:"key"`
+	Reason           string        `json:"reason"`
+	BlacklistedAt    time.Time     `json:"blacklisted_at"`
+	BlacklistedUntil *time.Time    `json:"blacklisted_until,omitempty"`
+	Permanent        bool          `json:"permanent"`
+	ErrorCount       int           `json:"error_count"`
+	Strikes          int           `json:"strikes"`
+	Duration         time.Duration `json:"duration,omitempty"`
+}
+
+// QuarantineEntry describes a key held out of rotation because anomaly detection
+// or an operator flagged it
+type QuarantineEntry struct {
 	Key           string    `json:"key"`
 	Reason        string    `json:"reason"`
-	BlacklistedAt time.Time `json:"blacklisted_at"`
-	Permanent     bool      `json:"permanent"`
-	ErrorCount    int       `json:"error_count"`
+	Details       string    `json:"details,omitempty"`
+	QuarantinedAt time.Time `json:"quarantined_at"`
 }
 
 // HealthStatus represents the health status of the service
 type HealthStatus struct {
-	Status      string           `json:"status"`
-	Timestamp   time.Time        `json:"timestamp"`
-	Version     string           `json:"version"`
-	Uptime      time.Duration    `json:"uptime"`
-	KeyManager  KeyManagerHealth `json:"key_manager"`
-	Server      ServerHealth     `json:"server"`
-	Connections ConnectionHealth `json:"connections"`
+	Status          string           `json:"status"`
+	Timestamp       time.Time        `json:"timestamp"`
+	Version         string           `json:"version"`
+	Uptime          time.Duration    `json:"uptime"`
+	KeyManager      KeyManagerHealth `json:"key_manager"`
+	Server          ServerHealth     `json:"server"`
+	Connections     ConnectionHealth `json:"connections"`
+	UpstreamCircuit CircuitState     `json:"upstream_circuit"`
+	// Dependencies reports MySQL and Redis when they are in use
+	Dependencies map[string]DependencyHealth `json:"dependencies,omitempty"`
+}
+
+// DependencyHealth is the reachability of a service the proxy depends on
+type DependencyHealth struct {
+	// Status is "up" or "down"
+	Status string `json:"status"`
+	// Since is when the status last changed
+	Since     time.Time `json:"since"`
+	LastError string    `json:"last_error,omitempty"`
+	// Pool is the client's connection pool, for spotting exhaustion early
+	Pool *PoolStats `json:"pool,omitempty"`
+}
+
+// PoolStats describes the connection pool of a MySQL or Redis client
+type PoolStats struct {
+	// MaxOpen is the pool's size limit, 0 for unlimited
+	MaxOpen int `json:"max_open"`
+	Open    int `json:"open"`
+	InUse   int `json:"in_use"`
+	Idle    int `json:"idle"`
+	// WaitCount and WaitDuration count the waits for a free MySQL connection
+	WaitCount    int64         `json:"wait_count"`
+	WaitDuration time.Duration `json:"wait_duration"`
+	// Timeouts counts the Redis commands that gave up waiting for a connection
+	Timeouts uint32 `json:"timeouts"`
 }
 
 // KeyManagerHealth represents key manager health
@@ -78,6 +136,19 @@ type ServerHealth struct {
 	RequestsSuccess int64         `json:"requests_success"`
 	RequestsError   int64         `json:"requests_error"`
 	AverageLatency  time.Duration `json:"average_latency"`
+	// Latency and EndpointLatency cover requests answered by Tavily
+	Latency         LatencySummary            `json:"latency"`
+	EndpointLatency map[string]LatencySummary `json:"endpoint_latency,omitempty"`
+}
+
+// LatencySummary reports latency percentiles estimated from a histogram
+type LatencySummary struct {
+	Count   int64         `json:"count"`
+	Average time.Duration `json:"average"`
+	P50     time.Duration `json:"p50"`
+	P95     time.Duration `json:"p95"`
+	P99     time.Duration `json:"p99"`
+	Max     time.Duration `json:"max"`
 }
 
 // ConnectionHealth represents connection health
@@ -104,15 +175,21 @@ type TavilyResponse struct {
 
 // RequestContext contains context information for a request
 type RequestContext struct {
-	RequestID    string
-	StartTime    time.Time
-	Key          string
-	Endpoint     string
-	Method       string
-	ClientIP     string
-	UserAgent    string
-	RetryCount   int
-	ResponseTime time.Duration
+	RequestID       string
+	StartTime       time.Time
+	Key             string
+	Endpoint        string
+	Method          string
+	ClientIP        string
+	UserAgent       string
+	RetryCount      int
+	ResponseTime    time.Duration
+	UpstreamLatency time.Duration
+	// UpstreamStatus is the HTTP status of Tavily's last answer (0 if it never answered)
+	UpstreamStatus int
+	CacheStatus    string
+	// TraceID is the W3C trace ID shared with the client and Tavily
+	TraceID string
 }
 
 // Middleware defines the interface for HTTP middleware
@@ -130,6 +207,158 @@ type UsageTracker interface {
 	UpdateKeyMetrics(key string, success bool, latency time.Duration)
 	GetRecommendedStrategy() SelectionStrategy
 	FetchUsageFromAPI(key string) (*TavilyUsage, error)
+	RecordStrategyOutcome(strategy SelectionStrategy, key string, success bool, latency time.Duration)
+	GetStrategyMetrics(window time.Duration) map[SelectionStrategy]*StrategyMetrics
+}
+
+// KeyRepository defines the interface for the key database. Lookups of rows that
+// do not exist return sql.ErrNoRows.
+type KeyRepository interface {
+	// Ping checks that the database is reachable
+	Ping(ctx context.Context) error
+	// PoolStats returns the connection pool statistics, nil without a pool
+	PoolStats() *PoolStats
+
+	// Keys
+	CreateKey(ctx context.Context, keyValue, name, description, tenant, pool string, tags []string) (*APIKey, error)
+	KeyExists(ctx context.Context, keyValue string) (bool, error)
+	GetKeyByID(ctx context.Context, id int64) (*APIKey, error)
+	GetKeyByValue(ctx context.Context, keyValue string) (*APIKey, error)
+	GetKeysByName(ctx context.Context, name string) ([]*APIKey, error)
+	GetAllActiveKeys(ctx context.Context) ([]*APIKey, error)
+	GetAllKeys(ctx context.Context) ([]*APIKey, error)
+	ListKeys(ctx context.Context, opts KeyListOptions) ([]*APIKey, int, error)
+	UpdateKey(ctx context.Context, id int64, name, description, pool string, isActive bool) (*APIKey, error)
+	DeleteKey(ctx context.Context, keyValue string) error
+	PurgeDeletedKey(ctx context.Context, id int64) error
+
+	// Blacklist and usage
+	BlacklistKey(ctx context.Context, keyValue, reason string, permanent bool, until *time.Time, strikes int) error
+	UnblacklistKey(ctx context.Context, keyValue string) error
+	GetBlacklistHistory(ctx context.Context, keyValue string) ([]*BlacklistHistory, error)
+	ListBlacklistHistory(ctx context.Context, opts BlacklistHistoryOptions) ([]*BlacklistHistory, error)
+	UpdateKeyUsage(ctx context.Context, keyValue string, requestsIncrement, errorsIncrement int64) error
+	GetKeyStats(ctx context.Context, keyValue string) (*KeyUsageStats, error)
+
+	// Tags, budgets and quarantine
+	GetKeyTags(ctx context.Context, keyID int64) ([]string, error)
+	SetKeyTags(ctx context.Context, keyID int64, tags []string) error
+	GetTagsForKeys(ctx context.Context, keyIDs []int64) (map[int64][]string, error)
+	GetAllKeyTags(ctx context.Context) (map[string][]string, error)
+	GetKeyBudget(ctx context.Context, keyID int64) (KeyBudget, error)
+	SetKeyBudget(ctx context.Context, keyID int64, budget KeyBudget) error
+	GetAllKeyBudgets(ctx context.Context) (map[string]KeyBudget, error)
+	QuarantineKey(ctx context.Context, keyValue, reason, details string) error
+	ReleaseQuarantine(ctx context.Context, keyValue string) error
+	GetQuarantinedKeys(ctx context.Context) ([]*QuarantinedKey, error)
+
+	// Auth tokens and tenants
+	CreateAuthToken(ctx context.Context, token *AuthToken) (*AuthToken, error)
+	GetAuthTokenByID(ctx context.Context, id int64) (*AuthToken, error)
+	GetAuthTokenByHash(ctx context.Context, tokenHash string) (*AuthToken, error)
+	ListAuthTokens(ctx context.Context, tenant string) ([]*AuthToken, error)
+	UpdateAuthToken(ctx context.Context, token *AuthToken) (*AuthToken, error)
+	DeleteAuthToken(ctx context.Context, id int64) error
+	ListTenants(ctx context.Context) ([]*TenantSummary, error)
+
+	// Usage history and reports
+	AddHourlyUsage(ctx context.Context, usage []HourlyUsage) error
+	RollupDailyUsage(ctx context.Context) error
+	PruneHourlyUsage(ctx context.Context, before time.Time, limit int) (int64, error)
+	GetUsageTimeseries(ctx context.Context, opts TimeseriesOptions) ([]*TimeseriesPoint, error)
+	CreateUsageReport(ctx context.Context, report *UsageReport) (int64, error)
+	UsageReportExists(ctx context.Context, period string, start time.Time) (bool, error)
+	ListUsageReports(ctx context.Context, period string, limit int) ([]*UsageReport, error)
+	GetUsageReport(ctx context.Context, id int64) (*UsageReport, error)
+	GetTopKeysByUsage(ctx context.Context, from, to time.Time, limit int) ([]*KeyUsageTotal, error)
+	GetUsageByEndpoint(ctx context.Context, from, to time.Time) ([]*EndpointUsageTotal, error)
+	GetBlacklistEvents(ctx context.Context, from, to time.Time) ([]*BlacklistEvent, error)
+
+	// Request log
+	AddRequestLog(ctx context.Context, entries []RequestLogEntry) error
+	ListRequestLog(ctx context.Context, opts RequestLogOptions) ([]*RequestLogEntry, int, error)
+	PurgeRequestLog(ctx context.Context, before time.Time, limit int) (int64, error)
+
+	// Audit log
+	AddAuditEntry(ctx context.Context, entry *AuditEntry) error
+	ListAuditLog(ctx context.Context, opts AuditLogOptions) ([]*AuditEntry, int, error)
+}
+
+// UsageCache defines the interface for the cache of usage, counters and shared
+// key state. Lookups of entries that are not cached return an error.
+type UsageCache interface {
+	// Shared reports whether the cache is shared with other replicas
+	Shared() bool
+	// Ping checks that the cache is reachable
+	Ping(ctx context.Context) error
+	// PoolStats returns the Redis connection pool statistics, nil for the
+	// in-memory cache
+	PoolStats() *PoolStats
+
+	// Usage, analytics and statistics
+	SetUsage(ctx context.Context, key string, usage *TavilyUsage) error
+	GetUsage(ctx context.Context, key string) (*TavilyUsage, error)
+	DeleteUsage(ctx context.Context, key string) error
+	SetKeyAnalytics(ctx context.Context, key string, analytics *KeyAnalytics) error
+	GetKeyAnalytics(ctx context.Context, key string) (*KeyAnalytics, error)
+	SetKeyStats(ctx context.Context, key string, stats *KeyStatus) error
+	GetKeyStats(ctx context.Context, key string) (*KeyStatus, error)
+	InvalidateKeyCache(ctx context.Context, key string) error
+	InvalidateAllUsage(ctx context.Context) error
+	InvalidateAllAnalytics(ctx context.Context) error
+	SetUsageAnalytics(ctx context.Context, analytics *UsageAnalytics) error
+	GetUsageAnalytics(ctx context.Context) (*UsageAnalytics, error)
+	SetSelectionStrategy(ctx context.Context, strategy SelectionStrategy) error
+	GetSelectionStrategy(ctx context.Context) (SelectionStrategy, error)
+	SetStrategyMetrics(ctx context.Context, strategy SelectionStrategy, metrics *StrategyMetrics) error
+	GetStrategyMetrics(ctx context.Context, strategy SelectionStrategy) (*StrategyMetrics, error)
+	IncrementKeyUsage(ctx context.Context, key string, success bool) error
+	GetKeyCounters(ctx context.Context, key string) (int64, int64, *time.Time, error)
+
+	// Shared key state
+	SetBlacklistEntry(ctx context.Context, entry *BlacklistEntry) error
+	GetBlacklistEntries(ctx context.Context, keys []string) (map[string]*BlacklistEntry, error)
+	DeleteBlacklistEntries(ctx context.Context, keys ...string) error
+	AddKeyError(ctx context.Context, key string, window time.Duration) (int64, error)
+	DeleteKeyErrors(ctx context.Context, key string) error
+	NextCursor(ctx context.Context, pool string) (int64, error)
+	PublishKeyChange(ctx context.Context, change *KeyChange) error
+	SubscribeKeyChanges(ctx context.Context, handle func(*KeyChange)) error
+
+	// Rate limits and credits
+	TakeKeyToken(ctx context.Context, key string, rpm int) (bool, time.Duration, error)
+	AddTokenCredits(ctx context.Context, tokenID int64, credits int) (int64, error)
+	GetTokenCredits(ctx context.Context, tokenID int64) (int64, error)
+	AddKeyCredits(ctx context.Context, key string, credits int) (int64, int64, error)
+	GetKeyCredits(ctx context.Context, key string) (int64, int64, error)
+	AddGlobalCredits(ctx context.Context, credits int) (int64, int64, error)
+	GetGlobalCredits(ctx context.Context) (int64, int64, error)
+
+	// Requests, responses and jobs
+	ReserveIdempotencyKey(ctx context.Context, key string, record *IdempotencyRecord, ttl time.Duration) (bool, error)
+	SetIdempotencyRecord(ctx context.Context, key string, record *IdempotencyRecord, ttl time.Duration) error
+	GetIdempotencyRecord(ctx context.Context, key string) (*IdempotencyRecord, error)
+	DeleteIdempotencyRecord(ctx context.Context, key string) error
+	SetFailedRequest(ctx context.Context, request *FailedRequest, ttl time.Duration) error
+	GetFailedRequest(ctx context.Context, id string) (*FailedRequest, error)
+	DeleteFailedRequest(ctx context.Context, id string) error
+	SetCachedResponse(ctx context.Context, key string, response *CachedResponse, ttl time.Duration) error
+	GetCachedResponse(ctx context.Context, key string) (*CachedResponse, error)
+	InvalidateCachedResponses(ctx context.Context, prefix string) error
+	SetJob(ctx context.Context, job *Job, ttl time.Duration) error
+	GetJob(ctx context.Context, id string) (*Job, error)
+}
+
+// KeyChange is a change to the key pool announced to the other replicas. Keys are
+// identified by their hash so key values never travel over pub/sub.
+type KeyChange struct {
+	// Instance identifies the announcing replica, which ignores its own changes
+	Instance  string     `json:"instance"`
+	Action    string     `json:"action"`
+	KeyHash   string     `json:"key_hash,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+	Permanent bool       `json:"permanent,omitempty"`
+	Until     *time.Time `json:"until,omitempty"`
 }
 
 // TavilyUsage represents the usage response from Tavily API
@@ -151,6 +380,8 @@ type AccountUsage struct {
 	PlanLimit   int    `json:"plan_limit"`
 	PaygoUsage  int    `json:"paygo_usage"`
 	PaygoLimit  int    `json:"paygo_limit"`
+	// PlanResetDate is when plan credits next refresh, if the usage response reports it
+	PlanResetDate *time.Time `json:"plan_reset_date,omitempty"`
 }
 
 // RemainingPoints represents calculated remaining points
@@ -162,16 +393,56 @@ type RemainingPoints struct {
 	KeyUtilization   float64 `json:"key_utilization"`
 	PlanUtilization  float64 `json:"plan_utilization"`
 	PaygoUtilization float64 `json:"paygo_utilization"`
+	// PlanResetAt is when plan credits next refresh; DaysUntilReset and
+	// PlanDailyAllowance spread PlanRemaining over the rest of the billing cycle
+	PlanResetAt        *time.Time `json:"plan_reset_at,omitempty"`
+	DaysUntilReset     float64    `json:"days_until_reset"`
+	PlanDailyAllowance float64    `json:"plan_daily_allowance"`
 }
 
 // SelectionStrategy defines different key selection strategies
 type SelectionStrategy string
 
 const (
-	StrategyPlanFirst  SelectionStrategy = "plan_first"  // Default: Prefer plan credits over paygo, only switch to paid when no plans available
-	StrategyRoundRobin SelectionStrategy = "round_robin" // Round-robin selection across all available keys
+	StrategyPlanFirst       SelectionStrategy = "plan_first"        // Default: Prefer plan credits over paygo, only switch to paid when no plans available
+	StrategyRoundRobin      SelectionStrategy = "round_robin"       // Round-robin selection across all available keys
+	StrategyLeastUsed       SelectionStrategy = "least_used"        // Select the key with the fewest requests in the current window
+	StrategyWeightedRandom  SelectionStrategy = "weighted_random"   // Random selection weighted by remaining credits
+	StrategyLeastErrors     SelectionStrategy = "least_errors"      // Round-robin across the keys with the lowest error rates
+	StrategyConsistentHash  SelectionStrategy = "consistent_hash"   // Route identical queries to the same key
+	StrategyBurnBeforeReset SelectionStrategy = "burn_before_reset" // Drain plan credits of the keys whose plan resets soonest
 )
 
+// KeySelector implements a key selection strategy
+type KeySelector interface {
+	SelectKey(candidates []string, usage KeyUsageSource) (string, error)
+}
+
+// KeyUsageSource exposes the per-key data available to key selectors
+type KeyUsageSource interface {
+	CalculateRemainingPoints(key string) (*RemainingPoints, error)
+	WindowRequestCount(key string) float64
+	ErrorRate(key string) float64
+}
+
+// RoutingKeySource is implemented by usage sources that carry a per-request routing key
+type RoutingKeySource interface {
+	RoutingKey() string
+}
+
+// CursorSource is implemented by usage sources that keep their own rotation position,
+// such as a key pool; rotating strategies use it instead of their shared cursor
+type CursorSource interface {
+	Cursor() *int64
+}
+
+// PositionSource is implemented by usage sources whose rotation position is shared
+// with other replicas. NextPosition advances it and reports false when the shared
+// position is unavailable, in which case the cursor is advanced instead.
+type PositionSource interface {
+	NextPosition() (int64, bool)
+}
+
 // UsageStrategy represents a usage optimization strategy
 type UsageStrategy struct {
 	Strategy         SelectionStrategy `json:"strategy"`
@@ -194,9 +465,24 @@ type UsageAnalytics struct {
 	TotalPaygoLimit     int                                    `json:"total_paygo_limit"`
 	AveragePlanUtil     float64                                `json:"average_plan_utilization"`
 	AveragePaygoUtil    float64                                `json:"average_paygo_utilization"`
+	NextPlanReset       *time.Time                             `json:"next_plan_reset,omitempty"`
 	RecommendedStrategy SelectionStrategy                      `json:"recommended_strategy"`
 	KeyAnalytics        map[string]*KeyAnalytics               `json:"key_analytics"`
 	StrategyMetrics     map[SelectionStrategy]*StrategyMetrics `json:"strategy_metrics"`
+	TagBreakdown        map[string]*TagAnalytics               `json:"tag_breakdown"`
+	BudgetWarnings      []string                               `json:"budget_warnings,omitempty"`
+}
+
+// TagAnalytics aggregates usage across the keys carrying a tag
+type TagAnalytics struct {
+	Tag            string `json:"tag"`
+	Keys           int    `json:"keys"`
+	ActiveKeys     int    `json:"active_keys"`
+	RequestCount   int64  `json:"request_count"`
+	ErrorCount     int64  `json:"error_count"`
+	PlanUsage      int    `json:"plan_usage"`
+	PaygoUsage     int    `json:"paygo_usage"`
+	TotalRemaining int    `json:"total_remaining"`
 }
 
 // KeyAnalytics represents analytics for a specific key
@@ -211,6 +497,20 @@ type KeyAnalytics struct {
 	HealthScore     float64          `json:"health_score"`
 	CostEfficiency  float64          `json:"cost_efficiency"`
 	RecommendedUse  bool             `json:"recommended_use"`
+	Budget          *KeyBudgetStatus `json:"budget,omitempty"`
+}
+
+// KeyBudgetStatus reports a key's credit budgets and its spending against them in
+// the current UTC day and month. Zero budgets are unset.
+type KeyBudgetStatus struct {
+	DailyUsed   int64      `json:"daily_used"`
+	MonthlyUsed int64      `json:"monthly_used"`
+	DailySoft   int        `json:"daily_soft"`
+	DailyHard   int        `json:"daily_hard"`
+	MonthlySoft int        `json:"monthly_soft"`
+	MonthlyHard int        `json:"monthly_hard"`
+	CappedUntil *time.Time `json:"capped_until,omitempty"`
+	Warnings    []string   `json:"warnings,omitempty"`
 }
 
 // StrategyMetrics represents metrics for a selection strategy
@@ -222,3 +522,82 @@ type StrategyMetrics struct {
 	CostEfficiency float64           `json:"cost_efficiency"`
 	LastUsed       time.Time         `json:"last_used"`
 }
+
+// FailedRequest represents a sanitized proxied request that exhausted all retries
+type FailedRequest struct {
+	ID          string    `json:"id"`
+	Method      string    `json:"method"`
+	Endpoint    string    `json:"endpoint"`
+	Pool        string    `json:"pool,omitempty"`
+	ContentType string    `json:"content_type,omitempty"`
+	Body        []byte    `json:"body"`
+	LastError   string    `json:"last_error,omitempty"`
+	Attempts    int       `json:"attempts"`
+	CapturedAt  time.Time `json:"captured_at"`
+}
+
+// Capture is a sampled request/response pair recorded for debugging, with API
+// keys and credentials redacted
+type Capture struct {
+	ID             string              `json:"id"`
+	RequestID      string              `json:"request_id,omitempty"`
+	TraceID        string              `json:"trace_id,omitempty"`
+	CapturedAt     time.Time           `json:"captured_at"`
+	Method         string              `json:"method"`
+	Endpoint       string              `json:"endpoint"`
+	Pool           string              `json:"pool,omitempty"`
+	KeyPreview     string              `json:"key_preview,omitempty"`
+	Attempts       int                 `json:"attempts"`
+	StatusCode     int                 `json:"status_code"`
+	UpstreamStatus int                 `json:"upstream_status,omitempty"`
+	Duration       time.Duration       `json:"duration"`
+	RequestHeaders map[string][]string `json:"request_headers,omitempty"`
+	RequestBody    string              `json:"request_body,omitempty"`
+	// ResponseHeaders and ResponseBody are what the client received
+	ResponseHeaders map[string][]string `json:"response_headers,omitempty"`
+	ResponseBody    string              `json:"response_body,omitempty"`
+	// Truncated is set when the response body exceeded CAPTURE_MAX_BODY_BYTES
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// CachedResponse is a successful upstream response stored for reuse by identical requests
+type CachedResponse struct {
+	StatusCode  int       `json:"status_code"`
+	ContentType string    `json:"content_type"`
+	Body        []byte    `json:"body"`
+	CachedAt    time.Time `json:"cached_at"`
+}
+
+// JobStatus represents the state of a background job
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+)
+
+// Job is a Tavily request executed in the background, with its stored result
+type Job struct {
+	ID          string          `json:"id"`
+	Endpoint    string          `json:"endpoint"`
+	Status      JobStatus       `json:"status"`
+	StatusCode  int             `json:"status_code,omitempty"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	StartedAt   *time.Time      `json:"started_at,omitempty"`
+	CompletedAt *time.Time      `json:"completed_at,omitempty"`
+	// Tenant and TokenID record who created the job; only they can poll it
+	Tenant  string `json:"tenant,omitempty"`
+	TokenID int64  `json:"token_id,omitempty"`
+}
+
+// IdempotencyRecord tracks a request submitted with an Idempotency-Key header. It
+// holds no response while the request is in flight.
+type IdempotencyRecord struct {
+	RequestHash string          `json:"request_hash"`
+	Response    *CachedResponse `json:"response,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
@@ -0,0 +1,39 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// KeyPrefix starts every Tavily API key
+const KeyPrefix = "tvly-"
+
+// minKeyLength is the length of the shortest key accepted: the prefix and at
+// least 8 more characters
+const minKeyLength = len(KeyPrefix) + 8
+
+// ValidateKey checks that key has the shape of a Tavily API key, so a
+// truncated or mispasted entry is caught before it is sent upstream
+func ValidateKey(key string) error {
+	if !strings.HasPrefix(key, KeyPrefix) {
+		return fmt.Errorf("key must start with %q", KeyPrefix)
+	}
+	if len(key) < minKeyLength {
+		return fmt.Errorf("key must be at least %d characters long", minKeyLength)
+	}
+	if i := strings.IndexFunc(key, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_')
+	}); i >= 0 {
+		return fmt.Errorf("key contains an invalid character at position %d", i+1)
+	}
+	return nil
+}
+
+// KeyPreview shortens an API key to its first 12 characters for logs, responses
+// and span attributes. Shorter values are returned unchanged.
+func KeyPreview(key string) string {
+	if len(key) > 12 {
+		return key[:12] + "..."
+	}
+	return key
+}
@@ -0,0 +1,245 @@
+package types
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// The models below are read and written by KeyRepository.
+
+// APIKey is a stored Tavily API key
+type APIKey struct {
+	ID               int64      `db:"id"`
+	KeyValue         string     `db:"key_value"`
+	Name             string     `db:"name"`
+	Description      string     `db:"description"`
+	IsActive         bool       `db:"is_active"`
+	IsBlacklisted    bool       `db:"is_blacklisted"`
+	BlacklistedUntil *time.Time `db:"blacklisted_until"`
+	BlacklistReason  string     `db:"blacklist_reason"`
+	Pool             string     `db:"pool"`
+	Tenant           string     `db:"tenant"`
+	CreatedAt        time.Time  `db:"created_at"`
+	UpdatedAt        time.Time  `db:"updated_at"`
+	// DeletedAt is set on deleted keys, which are kept for their history but
+	// never returned by KeyRepository
+	DeletedAt *time.Time `db:"deleted_at"`
+}
+
+// KeyUsageStats are the lifetime request and error counts of a key
+type KeyUsageStats struct {
+	ID            int64      `db:"id"`
+	KeyID         int64      `db:"key_id"`
+	RequestsCount int64      `db:"requests_count"`
+	ErrorsCount   int64      `db:"errors_count"`
+	LastUsedAt    *time.Time `db:"last_used_at"`
+	LastErrorAt   *time.Time `db:"last_error_at"`
+	CreatedAt     time.Time  `db:"created_at"`
+	UpdatedAt     time.Time  `db:"updated_at"`
+}
+
+// BlacklistHistory is one blacklisting of a key
+type BlacklistHistory struct {
+	ID               int64      `db:"id"`
+	KeyID            int64      `db:"key_id"`
+	BlacklistedAt    time.Time  `db:"blacklisted_at"`
+	BlacklistedUntil *time.Time `db:"blacklisted_until"`
+	Reason           string     `db:"reason"`
+	IsPermanent      bool       `db:"is_permanent"`
+	StrikeCount      int        `db:"strike_count"`
+	DurationSeconds  *int64     `db:"duration_seconds"`
+	// KeyValue and KeyName identify the key; only ListBlacklistHistory sets them
+	KeyValue string `db:"key_value"`
+	KeyName  string `db:"name"`
+}
+
+// BlacklistHistoryOptions filters ListBlacklistHistory results
+type BlacklistHistoryOptions struct {
+	From   time.Time // only blacklistings at or after From
+	To     time.Time // only blacklistings before To
+	Tenant string    // only keys of this tenant; empty matches all keys
+}
+
+// KeyListOptions filters, sorts and paginates ListKeys results
+type KeyListOptions struct {
+	Page    int    // 1-based page number
+	PerPage int    // 0 returns all matching keys
+	Status  string // active, inactive or blacklisted; empty matches all keys
+	Tag     string // only keys carrying this tag; empty matches all keys
+	Pool    string // only keys in this pool; empty matches all keys
+	Tenant  string // only keys of this tenant; empty matches all keys
+	Sort    string // created_at, updated_at, name or id
+	Order   string // asc or desc
+}
+
+// AuthToken is a named client credential with its own limits. Only the SHA-256
+// hash of the secret is stored; TokenPrefix identifies it in listings.
+type AuthToken struct {
+	ID               int64     `db:"id" json:"id"`
+	Name             string    `db:"name" json:"name"`
+	TokenHash        string    `db:"token_hash" json:"-"`
+	TokenPrefix      string    `db:"token_prefix" json:"token_prefix"`
+	RateLimitRPM     int       `db:"rate_limit_rpm" json:"rate_limit_rpm"`
+	DailyCreditQuota int       `db:"daily_credit_quota" json:"daily_credit_quota"`
+	AllowedEndpoints []string  `db:"allowed_endpoints" json:"allowed_endpoints"`
+	Scopes           []string  `db:"scopes" json:"scopes"`
+	Tenant           string    `db:"tenant" json:"tenant"`
+	IsActive         bool      `db:"is_active" json:"is_active"`
+	CreatedAt        time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt        time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// KeyBudget caps the credits a key may spend per UTC day and month. Crossing a
+// soft budget raises a warning; a key that reaches a hard budget leaves rotation
+// until the window resets. Zero leaves a budget unset.
+type KeyBudget struct {
+	DailySoft   int `json:"daily_soft"`
+	DailyHard   int `json:"daily_hard"`
+	MonthlySoft int `json:"monthly_soft"`
+	MonthlyHard int `json:"monthly_hard"`
+}
+
+// IsZero reports whether no budget is set
+func (b KeyBudget) IsZero() bool {
+	return b == KeyBudget{}
+}
+
+// QuarantinedKey is a key held out of rotation pending operator review
+type QuarantinedKey struct {
+	KeyID         int64
+	KeyValue      string
+	Name          string
+	Pool          string
+	Tenant        string
+	Reason        string
+	Details       string
+	QuarantinedAt time.Time
+}
+
+// UsageReport is a stored daily or weekly usage report; Body is the report as JSON
+type UsageReport struct {
+	ID          int64           `json:"id"`
+	Period      string          `json:"period"`
+	PeriodStart time.Time       `json:"period_start"`
+	PeriodEnd   time.Time       `json:"period_end"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Body        json.RawMessage `json:"report,omitempty"`
+}
+
+// KeyUsageTotal is the usage of one key summed over a time range
+type KeyUsageTotal struct {
+	KeyID         int64
+	KeyValue      string
+	Name          string
+	RequestsCount int64
+	ErrorsCount   int64
+}
+
+// EndpointUsageTotal is the usage of one endpoint summed over a time range
+type EndpointUsageTotal struct {
+	Endpoint      string
+	RequestsCount int64
+	ErrorsCount   int64
+}
+
+// BlacklistEvent is a key being blacklisted
+type BlacklistEvent struct {
+	KeyID         int64
+	KeyValue      string
+	BlacklistedAt time.Time
+	Reason        string
+	IsPermanent   bool
+}
+
+// TenantSummary counts the keys and auth tokens of a tenant
+type TenantSummary struct {
+	Name       string `json:"name"`
+	KeyCount   int    `json:"key_count"`
+	TokenCount int    `json:"token_count"`
+}
+
+// HourlyUsage is the usage of one key on one endpoint during one hour
+type HourlyUsage struct {
+	KeyValue       string
+	Endpoint       string
+	HourStart      time.Time
+	RequestsCount  int64
+	ErrorsCount    int64
+	LatencyMsTotal int64
+}
+
+// TimeseriesOptions filters GetUsageTimeseries results
+type TimeseriesOptions struct {
+	From       time.Time
+	To         time.Time
+	Resolution string // hour or day; day buckets cover whole days
+	KeyID      int64  // only this key; 0 matches all keys
+	Endpoint   string // only this endpoint; empty matches all endpoints
+	Tenant     string // only keys of this tenant; empty matches all keys
+}
+
+// AuditEntry records one management change: who made it, when, and what the
+// changed key or setting looked like before and after. Entries outlive the keys
+// they describe; KeyID is 0 for changes not tied to a key.
+type AuditEntry struct {
+	ID        int64           `json:"id"`
+	CreatedAt time.Time       `json:"timestamp"`
+	Actor     string          `json:"actor"`
+	Action    string          `json:"action"`
+	KeyID     int64           `json:"key_id,omitempty"`
+	Tenant    string          `json:"tenant,omitempty"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+}
+
+// AuditLogOptions filters and pages ListAuditLog results, newest first
+type AuditLogOptions struct {
+	From    time.Time // only entries at or after From; zero for no bound
+	To      time.Time // only entries before To; zero for no bound
+	Actor   string    // only changes by this actor; empty matches all
+	Action  string    // only this action; empty matches all
+	KeyID   int64     // only changes to this key; 0 matches all
+	Tenant  string    // only this tenant's changes; empty matches all
+	Page    int
+	PerPage int
+}
+
+// RequestLogEntry is one proxied request kept in the request log
+type RequestLogEntry struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"timestamp"`
+	RequestID string    `json:"request_id,omitempty"`
+	Method    string    `json:"method"`
+	Endpoint  string    `json:"endpoint"`
+	ClientIP  string    `json:"client_ip,omitempty"`
+	Tenant    string    `json:"tenant,omitempty"`
+	// KeyValue is the key that served the request; it is stored as KeyID, which
+	// is 0 when no key was used or the key has since been deleted
+	KeyValue          string `json:"-"`
+	KeyID             int64  `json:"key_id,omitempty"`
+	StatusCode        int    `json:"status"`
+	LatencyMs         int64  `json:"latency_ms"`
+	UpstreamLatencyMs int64  `json:"upstream_latency_ms"`
+	Retries           int    `json:"retries"`
+	CacheStatus       string `json:"cache_status,omitempty"`
+}
+
+// RequestLogOptions filters and pages ListRequestLog results, newest first
+type RequestLogOptions struct {
+	From       time.Time // only requests at or after From; zero for no bound
+	To         time.Time // only requests before To; zero for no bound
+	KeyID      int64     // only requests served by this key; 0 matches all
+	Endpoint   string    // only this endpoint; empty matches all
+	StatusCode int       // only this status; 0 matches all
+	Tenant     string    // only this tenant's requests; empty matches all
+	Page       int
+	PerPage    int
+}
+
+// TimeseriesPoint is the usage aggregated over one bucket of a time series
+type TimeseriesPoint struct {
+	Time           time.Time `json:"time"`
+	RequestsCount  int64     `json:"requests_count"`
+	ErrorsCount    int64     `json:"errors_count"`
+	AverageLatency int64     `json:"average_latency_ms"`
+}